@@ -2,7 +2,6 @@ package copy
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
@@ -10,14 +9,19 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/containers/image/image"
+	"github.com/containers/image/internal/progress"
+	"github.com/containers/image/manifest"
 	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/pkg/encryption"
 	"github.com/containers/image/signature"
 	"github.com/containers/image/transports"
 	"github.com/containers/image/types"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	pb "gopkg.in/cheggaaa/pb.v1"
@@ -68,15 +72,33 @@ func (d *digestingReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
+// defaultMaxParallelUploads is the number of layers copied concurrently if Options.MaxParallelUploads is 0.
+const defaultMaxParallelUploads = 6
+
 // copier allows us to keep track of diffID values for blobs, and other
 // data shared across one or more images in a possible manifest list.
+// Layers may be copied concurrently, so the members which are modified during the copy are protected by locks.
 type copier struct {
-	cachedDiffIDs    map[digest.Digest]digest.Digest
-	dest             types.ImageDestination
-	rawSource        types.ImageSource
-	reportWriter     io.Writer
-	progressInterval time.Duration
-	progress         chan types.ProgressProperties
+	cachedDiffIDsMutex sync.Mutex
+	cachedDiffIDs      map[digest.Digest]digest.Digest
+	dest               types.ImageDestination
+	rawSource          types.ImageSource
+	reportMutex        sync.Mutex
+	reportWriter       io.Writer
+	progressInterval   time.Duration
+	progress           chan types.ProgressProperties
+	destinationCtx     *types.SystemContext
+	// The maximum number of layers copied concurrently; 1 if the destination does not support concurrent copies.
+	maxParallelUploads uint
+	compressionFormat  compression.Algorithm // The algorithm used to compress layers
+	compressionLevel   *int                  // The compression level, or nil for the default
+	// Whether compressionFormat was explicitly requested, and layers compressed using other algorithms should be recompressed.
+	recompressLayers bool
+	decompressLayers bool                      // Whether layers should be decompressed even if the destination does not ask for that
+	resumeState      *resumeState              // The layers copied so far, if Options.ResumeStateFile is set; nil otherwise
+	ociEncryptConfig *encryption.EncryptConfig // Options.OciEncryptConfig
+	ociEncryptLayers *[]int                    // Options.OciEncryptLayers
+	ociDecryptConfig *encryption.DecryptConfig // Options.OciDecryptConfig
 }
 
 // imageCopier tracks state specific to a single image (possibly an item of a manifest list)
@@ -86,19 +108,74 @@ type imageCopier struct {
 	src               types.Image
 	diffIDsAreNeeded  bool
 	canModifyManifest bool
+	preserveDigests   bool // Options.PreserveDigests; implies !canModifyManifest
+	// If not nil, the image is an instance of a manifest list, and its manifest and signatures are written using listDest,
+	// identified by a digest computed using instanceDigestAlgorithm.
+	listDest                types.ManifestListDestination
+	instanceDigestAlgorithm digest.Algorithm
+	layersToEncrypt         map[int]struct{} // Indices of the layers of src to encrypt, per Options.OciEncryptLayers
 }
 
+// ImageListSelection is one of CopySystemImage, CopyAllImages, or CopySpecificImages, to control whether,
+// when the source reference is a manifest list, copy.Image() copies only the image which matches the current
+// runtime environment, or the manifest list with all, or only some, of the images it references.
+type ImageListSelection int
+
+const (
+	// CopySystemImage is the default value which, for a manifest list, copies only the image which matches
+	// the current runtime environment (see types.SystemContext.ArchitectureChoice and OSChoice in Options.SourceCtx).
+	CopySystemImage ImageListSelection = iota
+	// CopyAllImages copies the manifest list and all the images it references.
+	CopyAllImages
+	// CopySpecificImages copies the manifest list, reduced to the images selected by Options.Instances and Options.InstancePlatforms,
+	// and those images.
+	CopySpecificImages
+)
+
 // Options allows supplying non-default configuration modifying the behavior of CopyImage.
 type Options struct {
 	RemoveSignatures bool   // Remove any pre-existing signatures. SignBy will still add a new signature.
 	SignBy           string // If non-empty, asks for a signature to be added during the copy, and specifies a key ID, as accepted by signature.NewGPGSigningMechanism().SignDockerManifest(),
+	SignPassphrase   string // If non-empty, used to unlock the SignBy private key without any user interaction.
 	ReportWriter     io.Writer
 	SourceCtx        *types.SystemContext
 	DestinationCtx   *types.SystemContext
 	ProgressInterval time.Duration                 // time to wait between reports to signal the progress channel
-	Progress         chan types.ProgressProperties // Reported to when ProgressInterval has arrived for a single artifact+offset.
+	Progress         chan types.ProgressProperties // Reported to when ProgressInterval has arrived for a single artifact+offset, when all of an artifact has been read, and when copying an artifact starts, finishes or is skipped. Ignored if ProgressInterval is 0. Must be read, or copying blocks.
 	// manifest MIME type of image set by user. "" is default and means use the autodetection to the the manifest MIME type
 	ForceManifestMIMEType string
+	// The maximum number of layers copied concurrently, if the destination supports it; 0 means a default (6).
+	// Progress bars are not shown for layers copied concurrently.
+	MaxParallelUploads uint
+	// If non-empty, asks for a sigstore signature to be added during the copy, using the unencrypted PEM-encoded private key in this file,
+	// as accepted by signature.LoadSigstorePrivateKey(). Can be combined with SignBy.
+	SignBySigstorePrivateKeyFile string
+	// If set, the manifest and all blobs are copied without any modification, so that the digests at the destination
+	// are the same as in the source, and signatures of the image remain valid. The copy fails if a manifest conversion,
+	// a change of layer compression, or any other modification would be necessary.
+	PreserveDigests bool
+	// When the source is a manifest list, whether to copy only the image which matches the current runtime environment (the default),
+	// or the manifest list together with all or some of the images it references.
+	// Copying manifest lists requires a destination which implements types.ManifestListDestination.
+	ImageListSelection ImageListSelection
+	// With CopySpecificImages, the images to copy, identified by their manifest digests, in addition to those selected by InstancePlatforms.
+	Instances []digest.Digest
+	// With CopySpecificImages, the platforms of the images to copy, in addition to Instances.
+	// Only Architecture, OS and Variant are compared; an empty Variant matches any variant.
+	InstancePlatforms []imgspecv1.Platform
+	// If non-empty, a path of a file which records the layers copied to the destination, so that if the copy is interrupted,
+	// a later copy of the same image to the same destination with the same ResumeStateFile does not copy them again.
+	// The file is removed when the copy succeeds.
+	ResumeStateFile string
+	// If not nil, the layers selected by OciEncryptLayers are encrypted for the recipients in OciEncryptConfig.
+	// Encrypted layers are only supported in OCI images; the manifest is converted to OCI if necessary, which requires
+	// that it can be modified. Images with schema1 manifests can not be encrypted.
+	OciEncryptConfig *encryption.EncryptConfig
+	// The layers to encrypt using OciEncryptConfig, as indices into the layers of the image (0 is the base layer);
+	// negative indices count from the top-most layer (-1). If nil, no layers are encrypted; if empty, all layers are encrypted.
+	OciEncryptLayers *[]int
+	// If not nil, encrypted layers are decrypted using the keys in OciDecryptConfig.
+	OciDecryptConfig *encryption.DecryptConfig
 }
 
 // Image copies image from srcRef to destRef, using policyContext to validate
@@ -141,12 +218,60 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 	}()
 
 	c := &copier{
-		cachedDiffIDs:    make(map[digest.Digest]digest.Digest),
-		dest:             dest,
-		rawSource:        rawSource,
-		reportWriter:     reportWriter,
-		progressInterval: options.ProgressInterval,
-		progress:         options.Progress,
+		cachedDiffIDs:      make(map[digest.Digest]digest.Digest),
+		dest:               dest,
+		rawSource:          rawSource,
+		reportWriter:       reportWriter,
+		progressInterval:   options.ProgressInterval,
+		progress:           options.Progress,
+		destinationCtx:     options.DestinationCtx,
+		maxParallelUploads: 1,
+		compressionFormat:  compression.Gzip,
+		ociEncryptConfig:   options.OciEncryptConfig,
+		ociEncryptLayers:   options.OciEncryptLayers,
+		ociDecryptConfig:   options.OciDecryptConfig,
+	}
+	if options.DestinationCtx != nil {
+		if options.DestinationCtx.CompressionFormat != nil {
+			c.compressionFormat = *options.DestinationCtx.CompressionFormat
+			c.recompressLayers = true
+		}
+		c.compressionLevel = options.DestinationCtx.CompressionLevel
+		if options.DestinationCtx.DecompressLayers {
+			if c.recompressLayers {
+				return nil, errors.New("Layers can not be both compressed and decompressed")
+			}
+			if dest.DesiredLayerCompression() == types.Compress {
+				return nil, errors.Errorf("Destination %s requires compressed layers, they can not be decompressed", transports.ImageName(destRef))
+			}
+			c.decompressLayers = true
+		}
+	}
+	if options.ImageListSelection != CopySystemImage && options.ImageListSelection != CopyAllImages && options.ImageListSelection != CopySpecificImages {
+		return nil, errors.Errorf("Invalid image list selection %d", options.ImageListSelection)
+	}
+	if options.PreserveDigests && (c.recompressLayers || c.decompressLayers) {
+		return nil, errors.New("Preserving digests is not possible when changing the compression of layers")
+	}
+	if (options.OciEncryptConfig == nil) != (options.OciEncryptLayers == nil) {
+		return nil, errors.New("OciEncryptConfig and OciEncryptLayers must be set together")
+	}
+	if options.PreserveDigests && (options.OciEncryptConfig != nil || options.OciDecryptConfig != nil) {
+		return nil, errors.New("Preserving digests is not possible when encrypting or decrypting layers")
+	}
+	if options.ResumeStateFile != "" && (options.OciEncryptConfig != nil || options.OciDecryptConfig != nil) {
+		return nil, errors.New("Resuming copies is not supported when encrypting or decrypting layers")
+	}
+	if dest.HasThreadSafePutBlob() {
+		c.maxParallelUploads = options.MaxParallelUploads
+		if c.maxParallelUploads == 0 {
+			c.maxParallelUploads = defaultMaxParallelUploads
+		}
+	}
+	if options.ResumeStateFile != "" {
+		if c.resumeState, err = loadResumeState(options.ResumeStateFile, transports.ImageName(destRef), c.resumeSettings()); err != nil {
+			return nil, err
+		}
 	}
 
 	unparsedToplevel := image.UnparsedInstance(rawSource, nil)
@@ -157,10 +282,18 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 
 	if !multiImage {
 		// The simple case: Just copy a single image.
-		if manifest, err = c.copyOneImage(ctx, policyContext, options, unparsedToplevel); err != nil {
+		if manifest, _, err = c.copyOneImage(ctx, policyContext, options, unparsedToplevel, nil, ""); err != nil {
+			return nil, err
+		}
+	} else if options.ImageListSelection != CopySystemImage {
+		// Copy the manifest list and the selected images it references.
+		if manifest, err = c.copyMultipleImages(ctx, policyContext, options, unparsedToplevel); err != nil {
 			return nil, err
 		}
 	} else {
+		if options.PreserveDigests {
+			return nil, errors.Errorf("Preserving digests is not possible when copying a single image from manifest list %s, copy all images instead", transports.ImageName(srcRef))
+		}
 		// This is a manifest list. Choose a single image and copy it.
 		// FIXME: Copy to destinations which support manifest lists, one image at a time.
 		instanceDigest, err := image.ChooseManifestInstanceFromManifestList(ctx, options.SourceCtx, unparsedToplevel)
@@ -170,7 +303,7 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		logrus.Debugf("Source is a manifest list; copying (only) instance %s", instanceDigest)
 		unparsedInstance := image.UnparsedInstance(rawSource, &instanceDigest)
 
-		if manifest, err = c.copyOneImage(ctx, policyContext, options, unparsedInstance); err != nil {
+		if manifest, _, err = c.copyOneImage(ctx, policyContext, options, unparsedInstance, nil, ""); err != nil {
 			return nil, err
 		}
 	}
@@ -178,55 +311,59 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 	if err := c.dest.Commit(ctx); err != nil {
 		return nil, errors.Wrap(err, "Error committing the finished image")
 	}
+	if c.resumeState != nil {
+		if err := c.resumeState.remove(); err != nil {
+			return nil, err
+		}
+	}
 
 	return manifest, nil
 }
 
-// Image copies a single (on-manifest-list) image unparsedImage, using policyContext to validate
-// source image admissibility.
-func (c *copier) copyOneImage(ctx context.Context, policyContext *signature.PolicyContext, options *Options, unparsedImage *image.UnparsedImage) (manifest []byte, retErr error) {
+// copyOneImage copies a single (non-manifest-list) image unparsedImage, using policyContext to validate
+// source image admissibility, and returns the manifest which was written and its MIME type.
+// If listDest is not nil, the image is an instance of a manifest list, and its manifest and signatures are written using listDest,
+// identified by a digest computed using instanceDigestAlgorithm.
+func (c *copier) copyOneImage(ctx context.Context, policyContext *signature.PolicyContext, options *Options, unparsedImage *image.UnparsedImage,
+	listDest types.ManifestListDestination, instanceDigestAlgorithm digest.Algorithm) (manifest []byte, manifestMIMEType string, retErr error) {
 	// The caller is handling manifest lists; this could happen only if a manifest list contains a manifest list.
 	// Make sure we fail cleanly in such cases.
 	multiImage, err := isMultiImage(ctx, unparsedImage)
 	if err != nil {
 		// FIXME FIXME: How to name a reference for the sub-image?
-		return nil, errors.Wrapf(err, "Error determining manifest MIME type for %s", transports.ImageName(unparsedImage.Reference()))
+		return nil, "", errors.Wrapf(err, "Error determining manifest MIME type for %s", transports.ImageName(unparsedImage.Reference()))
 	}
 	if multiImage {
-		return nil, fmt.Errorf("Unexpectedly received a manifest list instead of a manifest for a single image")
+		return nil, "", fmt.Errorf("Unexpectedly received a manifest list instead of a manifest for a single image")
 	}
 
 	// Please keep this policy check BEFORE reading any other information about the image.
 	// (the multiImage check above only matches the MIME type, which we have received anyway.
 	// Actual parsing of anything should be deferred.)
 	if allowed, err := policyContext.IsRunningImageAllowed(ctx, unparsedImage); !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
-		return nil, errors.Wrap(err, "Source image rejected")
+		return nil, "", errors.Wrap(err, "Source image rejected")
 	}
 	src, err := image.FromUnparsedImage(ctx, options.SourceCtx, unparsedImage)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error initializing image from source %s", transports.ImageName(c.rawSource.Reference()))
+		return nil, "", errors.Wrapf(err, "Error initializing image from source %s", transports.ImageName(c.rawSource.Reference()))
 	}
 
 	if err := checkImageDestinationForCurrentRuntimeOS(ctx, options.DestinationCtx, src, c.dest); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	var sigs [][]byte
-	if options.RemoveSignatures {
-		sigs = [][]byte{}
-	} else {
-		c.Printf("Getting image source signatures\n")
-		s, err := src.Signatures(ctx)
-		if err != nil {
-			return nil, errors.Wrap(err, "Error reading signatures")
-		}
-		sigs = s
+	sigs, err := c.sourceSignatures(ctx, src, options)
+	if err != nil {
+		return nil, "", err
 	}
-	if len(sigs) != 0 {
-		c.Printf("Checking if image destination supports signatures\n")
-		if err := c.dest.SupportsSignatures(ctx); err != nil {
-			return nil, errors.Wrap(err, "Can not copy signatures")
-		}
+
+	layersToEncrypt, err := c.layersToEncrypt(len(src.LayerInfos()))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(layersToEncrypt) != 0 && len(sigs) != 0 {
+		return nil, "", errors.Errorf("Encrypting layers of %s would invalidate existing signatures. Explicitly enable signature removal to proceed anyway",
+			transports.ImageName(c.rawSource.Reference()))
 	}
 
 	ic := imageCopier{
@@ -234,32 +371,36 @@ func (c *copier) copyOneImage(ctx context.Context, policyContext *signature.Poli
 		manifestUpdates: &types.ManifestUpdateOptions{InformationOnly: types.ManifestUpdateInformation{Destination: c.dest}},
 		src:             src,
 		// diffIDsAreNeeded is computed later
-		canModifyManifest: len(sigs) == 0,
+		canModifyManifest:       len(sigs) == 0 && !options.PreserveDigests,
+		preserveDigests:         options.PreserveDigests,
+		listDest:                listDest,
+		instanceDigestAlgorithm: instanceDigestAlgorithm,
+		layersToEncrypt:         layersToEncrypt,
 	}
 
 	if err := ic.updateEmbeddedDockerReference(); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// We compute preferredManifestMIMEType only to show it in error messages.
 	// Without having to add this context in an error message, we would be happy enough to know only that no conversion is needed.
 	preferredManifestMIMEType, otherManifestMIMETypeCandidates, err := ic.determineManifestConversion(ctx, c.dest.SupportedManifestMIMETypes(), options.ForceManifestMIMEType)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// If src.UpdatedImageNeedsLayerDiffIDs(ic.manifestUpdates) will be true, it needs to be true by the time we get here.
 	ic.diffIDsAreNeeded = src.UpdatedImageNeedsLayerDiffIDs(*ic.manifestUpdates)
 
 	if err := ic.copyLayers(ctx); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// With docker/distribution registries we do not know whether the registry accepts schema2 or schema1 only;
 	// and at least with the OpenShift registry "acceptschema2" option, there is no way to detect the support
 	// without actually trying to upload something and getting a types.ManifestTypeRejectedError.
 	// So, try the preferred manifest MIME type. If the process succeeds, fine…
-	manifest, err = ic.copyUpdatedConfigAndManifest(ctx)
+	manifest, manifestMIMEType, err = ic.copyUpdatedConfigAndManifest(ctx)
 	if err != nil {
 		logrus.Debugf("Writing manifest using preferred type %s failed: %v", preferredManifestMIMEType, err)
 		// … if it fails, _and_ the failure is because the manifest is rejected, we may have other options.
@@ -267,14 +408,14 @@ func (c *copier) copyOneImage(ctx context.Context, policyContext *signature.Poli
 			// We don’t have other options.
 			// In principle the code below would handle this as well, but the resulting  error message is fairly ugly.
 			// Don’t bother the user with MIME types if we have no choice.
-			return nil, err
+			return nil, "", err
 		}
 		// If the original MIME type is acceptable, determineManifestConversion always uses it as preferredManifestMIMEType.
 		// So if we are here, we will definitely be trying to convert the manifest.
 		// With !ic.canModifyManifest, that would just be a string of repeated failures for the same reason,
 		// so let’s bail out early and with a better error message.
 		if !ic.canModifyManifest {
-			return nil, errors.Wrap(err, "Writing manifest failed (and converting it is not possible)")
+			return nil, "", errors.Wrap(err, "Writing manifest failed (and converting it is not possible)")
 		}
 
 		// errs is a list of errors when trying various manifest types. Also serves as an "upload succeeded" flag when set to nil.
@@ -282,7 +423,7 @@ func (c *copier) copyOneImage(ctx context.Context, policyContext *signature.Poli
 		for _, manifestMIMEType := range otherManifestMIMETypeCandidates {
 			logrus.Debugf("Trying to use manifest type %s…", manifestMIMEType)
 			ic.manifestUpdates.ManifestMIMEType = manifestMIMEType
-			attemptedManifest, err := ic.copyUpdatedConfigAndManifest(ctx)
+			attemptedManifest, attemptedManifestMIMEType, err := ic.copyUpdatedConfigAndManifest(ctx)
 			if err != nil {
 				logrus.Debugf("Upload of manifest type %s failed: %v", manifestMIMEType, err)
 				errs = append(errs, fmt.Sprintf("%s(%v)", manifestMIMEType, err))
@@ -291,28 +432,69 @@ func (c *copier) copyOneImage(ctx context.Context, policyContext *signature.Poli
 
 			// We have successfully uploaded a manifest.
 			manifest = attemptedManifest
+			manifestMIMEType = attemptedManifestMIMEType
 			errs = nil // Mark this as a success so that we don't abort below.
 			break
 		}
 		if errs != nil {
-			return nil, fmt.Errorf("Uploading manifest failed, attempted the following formats: %s", strings.Join(errs, ", "))
+			return nil, "", fmt.Errorf("Uploading manifest failed, attempted the following formats: %s", strings.Join(errs, ", "))
+		}
+	}
+
+	newSigs, err := c.createSignatures(manifest, options)
+	if err != nil {
+		return nil, "", err
+	}
+	sigs = append(sigs, newSigs...)
+
+	c.Printf("Storing signatures\n")
+	if err := ic.putSignatures(ctx, sigs, manifest); err != nil {
+		return nil, "", errors.Wrap(err, "Error writing signatures")
+	}
+
+	return manifest, manifestMIMEType, nil
+}
+
+// sourceSignatures returns the signatures of unparsedImage to copy, per options, and checks that the destination can store them.
+func (c *copier) sourceSignatures(ctx context.Context, unparsedImage types.UnparsedImage, options *Options) ([][]byte, error) {
+	var sigs [][]byte
+	if options.RemoveSignatures {
+		sigs = [][]byte{}
+	} else {
+		c.Printf("Getting image source signatures\n")
+		s, err := unparsedImage.Signatures(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading signatures")
+		}
+		sigs = s
+	}
+	if len(sigs) != 0 {
+		c.Printf("Checking if image destination supports signatures\n")
+		if err := c.dest.SupportsSignatures(ctx); err != nil {
+			return nil, errors.Wrap(err, "Can not copy signatures")
 		}
 	}
+	return sigs, nil
+}
 
+// createSignatures returns the new signatures of manifestBlob requested by options, if any.
+func (c *copier) createSignatures(manifestBlob []byte, options *Options) ([][]byte, error) {
+	sigs := [][]byte{}
 	if options.SignBy != "" {
-		newSig, err := c.createSignature(manifest, options.SignBy)
+		newSig, err := c.createSignature(manifestBlob, options.SignBy, options.SignPassphrase)
 		if err != nil {
 			return nil, err
 		}
 		sigs = append(sigs, newSig)
 	}
-
-	c.Printf("Storing signatures\n")
-	if err := c.dest.PutSignatures(ctx, sigs); err != nil {
-		return nil, errors.Wrap(err, "Error writing signatures")
+	if options.SignBySigstorePrivateKeyFile != "" {
+		newSig, err := c.createSigstoreSignature(manifestBlob, options.SignBySigstorePrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, newSig)
 	}
-
-	return manifest, nil
+	return sigs, nil
 }
 
 // Printf writes a formatted string to c.reportWriter.
@@ -321,9 +503,42 @@ func (c *copier) copyOneImage(ctx context.Context, policyContext *signature.Poli
 // which have their format strings checked; for other names we would have
 // to pass a parameter to every (go tool vet) invocation.
 func (c *copier) Printf(format string, a ...interface{}) {
+	c.reportMutex.Lock()
+	defer c.reportMutex.Unlock()
 	fmt.Fprintf(c.reportWriter, format, a...)
 }
 
+// progressReportingEnabled returns true if progress events should be sent to c.progress.
+func (c *copier) progressReportingEnabled() bool {
+	return c.progress != nil && c.progressInterval > 0
+}
+
+// reportSkippedBlob reports to c.progress, if requested, that copying the blob with info was skipped.
+func (c *copier) reportSkippedBlob(info types.BlobInfo) {
+	if !c.progressReportingEnabled() {
+		return
+	}
+	p := types.ProgressProperties{Event: types.ProgressEventSkipped, Artifact: info}
+	if info.Size >= 0 {
+		p.Offset = uint64(info.Size)
+	}
+	c.progress <- p
+}
+
+// cachedDiffID returns the DiffID of the layer blob with digest blobDigest, or "" if it is not known.
+func (c *copier) cachedDiffID(blobDigest digest.Digest) digest.Digest {
+	c.cachedDiffIDsMutex.Lock()
+	defer c.cachedDiffIDsMutex.Unlock()
+	return c.cachedDiffIDs[blobDigest]
+}
+
+// cacheDiffID records diffID as the DiffID of the layer blob with digest blobDigest.
+func (c *copier) cacheDiffID(blobDigest, diffID digest.Digest) {
+	c.cachedDiffIDsMutex.Lock()
+	defer c.cachedDiffIDsMutex.Unlock()
+	c.cachedDiffIDs[blobDigest] = diffID
+}
+
 func checkImageDestinationForCurrentRuntimeOS(ctx context.Context, sys *types.SystemContext, src types.Image, dest types.ImageDestination) error {
 	if dest.MustMatchRuntimeOS() {
 		wantedOS := runtime.GOOS
@@ -357,6 +572,10 @@ func (ic *imageCopier) updateEmbeddedDockerReference() error {
 		return nil // No reference embedded in the manifest, or it matches destRef already.
 	}
 
+	if ic.preserveDigests {
+		return errors.Errorf("Copying a schema1 image with an embedded Docker reference to %s (Docker reference %s) would modify the manifest, which is not allowed when preserving digests",
+			transports.ImageName(ic.c.dest.Reference()), destRef.String())
+	}
 	if !ic.canModifyManifest {
 		return errors.Errorf("Copying a schema1 image with an embedded Docker reference to %s (Docker reference %s) would invalidate existing signatures. Explicitly enable signature removal to proceed anyway",
 			transports.ImageName(ic.c.dest.Reference()), destRef.String())
@@ -368,54 +587,128 @@ func (ic *imageCopier) updateEmbeddedDockerReference() error {
 // copyLayers copies layers from ic.src/ic.c.rawSource to dest, using and updating ic.manifestUpdates if necessary and ic.canModifyManifest.
 func (ic *imageCopier) copyLayers(ctx context.Context) error {
 	srcInfos := ic.src.LayerInfos()
-	destInfos := []types.BlobInfo{}
-	diffIDs := []digest.Digest{}
 	updatedSrcInfos, err := ic.src.LayerInfosForCopy(ctx)
 	if err != nil {
 		return err
 	}
 	srcInfosUpdated := false
 	if updatedSrcInfos != nil && !reflect.DeepEqual(srcInfos, updatedSrcInfos) {
+		if ic.preserveDigests {
+			return errors.Errorf("Copying from %s requires updating the layers in the manifest, which is not allowed when preserving digests", transports.ImageName(ic.c.rawSource.Reference()))
+		}
 		if !ic.canModifyManifest {
 			return errors.Errorf("Internal error: copyLayers() needs to use an updated manifest but that was known to be forbidden")
 		}
 		srcInfos = updatedSrcInfos
 		srcInfosUpdated = true
 	}
-	for _, srcLayer := range srcInfos {
-		var (
-			destInfo types.BlobInfo
-			diffID   digest.Digest
-			err      error
-		)
+	destInfos := make([]types.BlobInfo, len(srcInfos))
+	diffIDs := make([]digest.Digest, len(srcInfos))
+	copyOneLayer := func(ctx context.Context, index int) error {
+		srcLayer := srcInfos[index]
+		_, toEncrypt := ic.layersToEncrypt[index]
 		if ic.c.dest.AcceptsForeignLayerURLs() && len(srcLayer.URLs) != 0 {
+			if toEncrypt {
+				return errors.Errorf("Foreign layer %s can not be encrypted", srcLayer.Digest)
+			}
 			// DiffIDs are, currently, needed only when converting from schema1.
 			// In which case src.LayerInfos will not have URLs because schema1
 			// does not support them.
 			if ic.diffIDsAreNeeded {
 				return errors.New("getting DiffID for foreign layers is unimplemented")
 			}
-			destInfo = srcLayer
-			ic.c.Printf("Skipping foreign layer %q copy to %s\n", destInfo.Digest, ic.c.dest.Reference().Transport().Name())
-		} else {
-			destInfo, diffID, err = ic.copyLayer(ctx, srcLayer)
+			destInfos[index] = srcLayer
+			ic.c.Printf("Skipping foreign layer %q copy to %s\n", srcLayer.Digest, ic.c.dest.Reference().Transport().Name())
+			ic.c.reportSkippedBlob(srcLayer)
+			return nil
+		}
+		if ic.c.resumeState != nil {
+			destInfo, diffID, resumed, err := ic.resumeLayer(ctx, srcLayer)
 			if err != nil {
 				return err
 			}
+			if resumed {
+				destInfos[index] = destInfo
+				diffIDs[index] = diffID
+				return nil
+			}
 		}
-		destInfos = append(destInfos, destInfo)
-		diffIDs = append(diffIDs, diffID)
+		destInfo, diffID, err := ic.copyLayer(ctx, srcLayer, toEncrypt)
+		if err != nil {
+			return err
+		}
+		if ic.c.resumeState != nil {
+			if err := ic.c.resumeState.record(srcLayer.Digest, destInfo, diffID); err != nil {
+				return err
+			}
+		}
+		destInfos[index] = destInfo
+		diffIDs[index] = diffID
+		return nil
+	}
+	if ic.c.maxParallelUploads <= 1 || len(srcInfos) <= 1 {
+		for i := range srcInfos {
+			if err := copyOneLayer(ctx, i); err != nil {
+				return err
+			}
+		}
+	} else if err := copyInParallel(ctx, len(srcInfos), ic.c.maxParallelUploads, copyOneLayer); err != nil {
+		return err
 	}
 	ic.manifestUpdates.InformationOnly.LayerInfos = destInfos
 	if ic.diffIDsAreNeeded {
 		ic.manifestUpdates.InformationOnly.LayerDiffIDs = diffIDs
 	}
 	if srcInfosUpdated || layerDigestsDiffer(srcInfos, destInfos) {
+		if ic.preserveDigests {
+			return errors.Errorf("Copying layers to %s changed their digests, which is not allowed when preserving digests", transports.ImageName(ic.c.dest.Reference()))
+		}
 		ic.manifestUpdates.LayerInfos = destInfos
 	}
 	return nil
 }
 
+// copyInParallel calls copyOne(ctx, index) for all index values in [0, count), running at most maxParallel calls concurrently.
+// If any of the calls fails, the remaining ones are cancelled through ctx, and the first failure is returned.
+func copyInParallel(ctx context.Context, count int, maxParallel uint, copyOne func(ctx context.Context, index int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		errMutex  sync.Mutex
+		firstErr  error
+		semaphore = make(chan struct{}, maxParallel)
+	)
+	for i := 0; i < count; i++ {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if err := copyOne(ctx, index); err != nil {
+				errMutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMutex.Unlock()
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
 // layerDigestsDiffer return true iff the digests in a and b differ (ignoring sizes and possible other fields)
 func layerDigestsDiffer(a, b []types.BlobInfo) bool {
 	if len(a) != len(b) {
@@ -430,12 +723,12 @@ func layerDigestsDiffer(a, b []types.BlobInfo) bool {
 }
 
 // copyUpdatedConfigAndManifest updates the image per ic.manifestUpdates, if necessary,
-// stores the resulting config and manifest to the destination, and returns the stored manifest.
-func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context) ([]byte, error) {
+// stores the resulting config and manifest to the destination, and returns the stored manifest and its MIME type.
+func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context) ([]byte, string, error) {
 	pendingImage := ic.src
 	if !reflect.DeepEqual(*ic.manifestUpdates, types.ManifestUpdateOptions{InformationOnly: ic.manifestUpdates.InformationOnly}) {
 		if !ic.canModifyManifest {
-			return nil, errors.Errorf("Internal error: copy needs an updated manifest but that was known to be forbidden")
+			return nil, "", errors.Errorf("Internal error: copy needs an updated manifest but that was known to be forbidden")
 		}
 		if !ic.diffIDsAreNeeded && ic.src.UpdatedImageNeedsLayerDiffIDs(*ic.manifestUpdates) {
 			// We have set ic.diffIDsAreNeeded based on the preferred MIME type returned by determineManifestConversion.
@@ -444,28 +737,60 @@ func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context) ([]byte
 			// when ic.c.dest.SupportedManifestMIMETypes() includes both s1 and s2, the upload using s1 failed, and we are now trying s2.
 			// Supposedly s2-only registries do not exist or are extremely rare, so failing with this error message is good enough for now.
 			// If handling such registries turns out to be necessary, we could compute ic.diffIDsAreNeeded based on the full list of manifest MIME type candidates.
-			return nil, errors.Errorf("Can not convert image to %s, preparing DiffIDs for this case is not supported", ic.manifestUpdates.ManifestMIMEType)
+			return nil, "", errors.Errorf("Can not convert image to %s, preparing DiffIDs for this case is not supported", ic.manifestUpdates.ManifestMIMEType)
 		}
 		pi, err := ic.src.UpdatedImage(ctx, *ic.manifestUpdates)
 		if err != nil {
-			return nil, errors.Wrap(err, "Error creating an updated image manifest")
+			return nil, "", errors.Wrap(err, "Error creating an updated image manifest")
 		}
 		pendingImage = pi
 	}
-	manifest, _, err := pendingImage.Manifest(ctx)
+	manifest, manifestMIMEType, err := pendingImage.Manifest(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error reading manifest")
+		return nil, "", errors.Wrap(err, "Error reading manifest")
 	}
 
 	if err := ic.c.copyConfig(ctx, pendingImage); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	ic.c.Printf("Writing manifest to image destination\n")
-	if err := ic.c.dest.PutManifest(ctx, manifest); err != nil {
-		return nil, errors.Wrap(err, "Error writing manifest")
+	if err := ic.putManifest(ctx, manifest, manifestMIMEType); err != nil {
+		return nil, "", errors.Wrap(err, "Error writing manifest")
 	}
-	return manifest, nil
+	return manifest, manifestMIMEType, nil
+}
+
+// putManifest writes manifestBlob, with MIME type mimeType, to the destination.
+func (ic *imageCopier) putManifest(ctx context.Context, manifestBlob []byte, mimeType string) error {
+	if ic.listDest == nil {
+		return ic.c.putManifest(ctx, manifestBlob, mimeType)
+	}
+	instanceDigest, err := manifest.DigestWithAlgorithm(manifestBlob, ic.instanceDigestAlgorithm)
+	if err != nil {
+		return err
+	}
+	return ic.listDest.PutInstanceManifest(ctx, manifestBlob, mimeType, instanceDigest)
+}
+
+// putSignatures writes signatures of manifestBlob, which has already been written using ic.putManifest, to the destination.
+func (ic *imageCopier) putSignatures(ctx context.Context, signatures [][]byte, manifestBlob []byte) error {
+	if ic.listDest == nil {
+		return ic.c.dest.PutSignatures(ctx, signatures)
+	}
+	instanceDigest, err := manifest.DigestWithAlgorithm(manifestBlob, ic.instanceDigestAlgorithm)
+	if err != nil {
+		return err
+	}
+	return ic.listDest.PutInstanceSignatures(ctx, signatures, instanceDigest)
+}
+
+// putManifest writes manifestBlob, with MIME type mimeType, as the primary manifest of the destination.
+func (c *copier) putManifest(ctx context.Context, manifestBlob []byte, mimeType string) error {
+	if dest, ok := c.dest.(types.ManifestMIMETypeDestination); ok {
+		return dest.PutManifestWithMIMEType(ctx, manifestBlob, mimeType)
+	}
+	return c.dest.PutManifest(ctx, manifestBlob)
 }
 
 // copyConfig copies config.json, if any, from src to dest.
@@ -477,7 +802,7 @@ func (c *copier) copyConfig(ctx context.Context, src types.Image) error {
 		if err != nil {
 			return errors.Wrapf(err, "Error reading config blob %s", srcInfo.Digest)
 		}
-		destInfo, err := c.copyBlobFromStream(ctx, bytes.NewReader(configBlob), srcInfo, nil, false, true)
+		destInfo, err := c.copyBlobFromStream(ctx, bytes.NewReader(configBlob), srcInfo, nil, false, true, types.PreserveOriginalCrypto)
 		if err != nil {
 			return err
 		}
@@ -496,15 +821,32 @@ type diffIDResult struct {
 }
 
 // copyLayer copies a layer with srcInfo (with known Digest and possibly known Size) in src to dest, perhaps compressing it if canCompress,
-// and returns a complete blobInfo of the copied layer, and a value for LayerDiffIDs if diffIDIsNeeded
-func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo) (types.BlobInfo, digest.Digest, error) {
+// and encrypting it if toEncrypt, and returns a complete blobInfo of the copied layer, and a value for LayerDiffIDs if diffIDIsNeeded
+func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, toEncrypt bool) (types.BlobInfo, digest.Digest, error) {
+	cryptoOperation := types.PreserveOriginalCrypto
+	if layerIsEncrypted(srcInfo) {
+		if toEncrypt {
+			return types.BlobInfo{}, "", errors.Errorf("Layer %s is already encrypted", srcInfo.Digest)
+		}
+		if ic.c.ociDecryptConfig != nil && ic.canModifyManifest {
+			cryptoOperation = types.Decrypt
+		}
+	} else if toEncrypt {
+		cryptoOperation = types.Encrypt
+	}
+
 	// Check if we already have a blob with this digest
-	haveBlob, extantBlobSize, err := ic.c.dest.HasBlob(ctx, srcInfo)
-	if err != nil {
-		return types.BlobInfo{}, "", errors.Wrapf(err, "Error checking for blob %s at destination", srcInfo.Digest)
+	// (unless the layer is encrypted or decrypted, which creates a blob with a different digest).
+	haveBlob, extantBlobSize := false, int64(-1)
+	if cryptoOperation == types.PreserveOriginalCrypto {
+		var err error
+		haveBlob, extantBlobSize, err = ic.c.dest.HasBlob(ctx, srcInfo)
+		if err != nil {
+			return types.BlobInfo{}, "", errors.Wrapf(err, "Error checking for blob %s at destination", srcInfo.Digest)
+		}
 	}
 	// If we already have a cached diffID for this blob, we don't need to compute it
-	diffIDIsNeeded := ic.diffIDsAreNeeded && (ic.c.cachedDiffIDs[srcInfo.Digest] == "")
+	diffIDIsNeeded := ic.diffIDsAreNeeded && (ic.c.cachedDiffID(srcInfo.Digest) == "")
 	// If we already have the blob, and we don't need to recompute the diffID, then we might be able to avoid reading it again
 	if haveBlob && !diffIDIsNeeded {
 		// Check the blob sizes match, if we were given a size this time
@@ -518,7 +860,8 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo) (t
 			return types.BlobInfo{}, "", errors.Wrapf(err, "Error reapplying blob %s at destination", srcInfo.Digest)
 		}
 		ic.c.Printf("Skipping fetch of repeat blob %s\n", srcInfo.Digest)
-		return blobinfo, ic.c.cachedDiffIDs[srcInfo.Digest], err
+		ic.c.reportSkippedBlob(srcInfo)
+		return blobinfo, ic.c.cachedDiffID(srcInfo.Digest), err
 	}
 
 	// Fallback: copy the layer, computing the diffID if we need to do so
@@ -529,8 +872,9 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo) (t
 	}
 	defer srcStream.Close()
 
-	blobInfo, diffIDChan, err := ic.copyLayerFromStream(ctx, srcStream, types.BlobInfo{Digest: srcInfo.Digest, Size: srcBlobSize},
-		diffIDIsNeeded)
+	blobInfo, diffIDChan, err := ic.copyLayerFromStream(ctx, srcStream,
+		types.BlobInfo{Digest: srcInfo.Digest, Size: srcBlobSize, MediaType: srcInfo.MediaType, Annotations: srcInfo.Annotations},
+		diffIDIsNeeded, cryptoOperation)
 	if err != nil {
 		return types.BlobInfo{}, "", err
 	}
@@ -543,20 +887,20 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo) (t
 				return types.BlobInfo{}, "", errors.Wrap(diffIDResult.err, "Error computing layer DiffID")
 			}
 			logrus.Debugf("Computed DiffID %s for layer %s", diffIDResult.digest, srcInfo.Digest)
-			ic.c.cachedDiffIDs[srcInfo.Digest] = diffIDResult.digest
+			ic.c.cacheDiffID(srcInfo.Digest, diffIDResult.digest)
 			return blobInfo, diffIDResult.digest, nil
 		}
 	} else {
-		return blobInfo, ic.c.cachedDiffIDs[srcInfo.Digest], nil
+		return blobInfo, ic.c.cachedDiffID(srcInfo.Digest), nil
 	}
 }
 
 // copyLayerFromStream is an implementation detail of copyLayer; mostly providing a separate “defer” scope.
 // it copies a blob with srcInfo (with known Digest and possibly known Size) from srcStream to dest,
-// perhaps compressing the stream if canCompress,
+// perhaps compressing the stream if canCompress, and encrypting or decrypting it per cryptoOperation,
 // and returns a complete blobInfo of the copied blob and perhaps a <-chan diffIDResult if diffIDIsNeeded, to be read by the caller.
 func (ic *imageCopier) copyLayerFromStream(ctx context.Context, srcStream io.Reader, srcInfo types.BlobInfo,
-	diffIDIsNeeded bool) (types.BlobInfo, <-chan diffIDResult, error) {
+	diffIDIsNeeded bool, cryptoOperation types.LayerCrypto) (types.BlobInfo, <-chan diffIDResult, error) {
 	var getDiffIDRecorder func(compression.DecompressorFunc) io.Writer // = nil
 	var diffIDChan chan diffIDResult
 
@@ -580,7 +924,7 @@ func (ic *imageCopier) copyLayerFromStream(ctx context.Context, srcStream io.Rea
 			return pipeWriter
 		}
 	}
-	blobInfo, err := ic.c.copyBlobFromStream(ctx, srcStream, srcInfo, getDiffIDRecorder, ic.canModifyManifest, false) // Sets err to nil on success
+	blobInfo, err := ic.c.copyBlobFromStream(ctx, srcStream, srcInfo, getDiffIDRecorder, ic.canModifyManifest, false, cryptoOperation) // Sets err to nil on success
 	return blobInfo, diffIDChan, err
 	// We need the defer … pipeWriter.CloseWithError() to happen HERE so that the caller can block on reading from diffIDChan
 }
@@ -613,11 +957,11 @@ func computeDiffID(stream io.Reader, decompressor compression.DecompressorFunc)
 
 // copyBlobFromStream copies a blob with srcInfo (with known Digest and possibly known Size) from srcStream to dest,
 // perhaps sending a copy to an io.Writer if getOriginalLayerCopyWriter != nil,
-// perhaps compressing it if canCompress,
+// perhaps compressing it if canCompress, encrypting or decrypting it per cryptoOperation,
 // and returns a complete blobInfo of the copied blob.
 func (c *copier) copyBlobFromStream(ctx context.Context, srcStream io.Reader, srcInfo types.BlobInfo,
 	getOriginalLayerCopyWriter func(decompressor compression.DecompressorFunc) io.Writer,
-	canModifyBlob bool, isConfig bool) (types.BlobInfo, error) {
+	canModifyBlob bool, isConfig bool, cryptoOperation types.LayerCrypto) (types.BlobInfo, error) {
 	// The copying happens through a pipeline of connected io.Readers.
 	// === Input: srcStream
 
@@ -633,9 +977,27 @@ func (c *copier) copyBlobFromStream(ctx context.Context, srcStream io.Reader, sr
 	}
 	var destStream io.Reader = digestingReader
 
+	// === Decrypt the stream, if required.
+	if cryptoOperation == types.Decrypt {
+		logrus.Debugf("Blob will be decrypted")
+		s, err := c.ociDecryptConfig.DecryptLayer(destStream, imgspecv1.Descriptor{
+			MediaType:   srcInfo.MediaType,
+			Digest:      srcInfo.Digest,
+			Size:        srcInfo.Size,
+			Annotations: srcInfo.Annotations,
+		})
+		if err != nil {
+			return types.BlobInfo{}, err
+		}
+		destStream = s
+	} else if layerIsEncrypted(srcInfo) {
+		// The compression of encrypted layers can not be modified.
+		canModifyBlob = false
+	}
+
 	// === Detect compression of the input stream.
 	// This requires us to “peek ahead” into the stream to read the initial part, which requires us to chain through another io.Reader returned by DetectCompression.
-	decompressor, destStream, err := compression.DetectCompression(destStream) // We could skip this in some cases, but let's keep the code path uniform
+	compressionFormat, decompressor, destStream, err := compression.DetectCompressionFormat(destStream) // We could skip this in some cases, but let's keep the code path uniform
 	if err != nil {
 		return types.BlobInfo{}, errors.Wrapf(err, "Error reading blob %s", srcInfo.Digest)
 	}
@@ -644,6 +1006,10 @@ func (c *copier) copyBlobFromStream(ctx context.Context, srcStream io.Reader, sr
 	// === Report progress using a pb.Reader.
 	bar := pb.New(int(srcInfo.Size)).SetUnits(pb.U_BYTES)
 	bar.Output = c.reportWriter
+	if c.maxParallelUploads > 1 && !isConfig {
+		// Progress bars of concurrently copied layers would overwrite each other.
+		bar.Output = ioutil.Discard
+	}
 	bar.SetMaxWidth(80)
 	bar.ShowTimeLeft = false
 	bar.ShowPercent = false
@@ -660,19 +1026,38 @@ func (c *copier) copyBlobFromStream(ctx context.Context, srcStream io.Reader, sr
 
 	// === Deal with layer compression/decompression if necessary
 	var inputInfo types.BlobInfo
-	if canModifyBlob && c.dest.DesiredLayerCompression() == types.Compress && !isCompressed {
-		logrus.Debugf("Compressing blob on the fly")
+	compressionOperation := types.PreserveOriginal
+	desiredCompression := c.desiredLayerCompression()
+	if canModifyBlob && desiredCompression == types.Compress && !isCompressed {
+		logrus.Debugf("Compressing blob on the fly using %s", c.compressionFormat.Name())
 		pipeReader, pipeWriter := io.Pipe()
 		defer pipeReader.Close()
 
 		// If this fails while writing data, it will do pipeWriter.CloseWithError(); if it fails otherwise,
 		// e.g. because we have exited and due to pipeReader.Close() above further writing to the pipe has failed,
 		// we don’t care.
-		go compressGoroutine(pipeWriter, destStream) // Closes pipeWriter
+		go c.compressGoroutine(pipeWriter, destStream) // Closes pipeWriter
 		destStream = pipeReader
 		inputInfo.Digest = ""
 		inputInfo.Size = -1
-	} else if canModifyBlob && c.dest.DesiredLayerCompression() == types.Decompress && isCompressed {
+		compressionOperation = types.Compress
+	} else if canModifyBlob && desiredCompression == types.Compress && isCompressed &&
+		c.recompressLayers && compressionFormat.Name() != c.compressionFormat.Name() {
+		logrus.Debugf("Blob will be converted from %s to %s", compressionFormat.Name(), c.compressionFormat.Name())
+		s, err := decompressor(destStream)
+		if err != nil {
+			return types.BlobInfo{}, err
+		}
+		defer s.Close()
+		pipeReader, pipeWriter := io.Pipe()
+		defer pipeReader.Close()
+
+		go c.compressGoroutine(pipeWriter, s) // Closes pipeWriter
+		destStream = pipeReader
+		inputInfo.Digest = ""
+		inputInfo.Size = -1
+		compressionOperation = types.Compress
+	} else if canModifyBlob && desiredCompression == types.Decompress && isCompressed {
 		logrus.Debugf("Blob will be decompressed")
 		s, err := decompressor(destStream)
 		if err != nil {
@@ -682,20 +1067,38 @@ func (c *copier) copyBlobFromStream(ctx context.Context, srcStream io.Reader, sr
 		destStream = s
 		inputInfo.Digest = ""
 		inputInfo.Size = -1
+		compressionOperation = types.Decompress
 	} else {
 		logrus.Debugf("Using original blob without modification")
 		inputInfo = srcInfo
 	}
 
-	// === Report progress using the c.progress channel, if required.
-	if c.progress != nil && c.progressInterval > 0 {
-		destStream = &progressReader{
-			source:   destStream,
-			channel:  c.progress,
-			interval: c.progressInterval,
-			artifact: srcInfo,
-			lastTime: time.Now(),
+	// === Encrypt the stream, if required.
+	var encryptionAnnotations func() (map[string]string, error)
+	if cryptoOperation == types.Encrypt {
+		logrus.Debugf("Blob will be encrypted")
+		s, annotations, err := c.ociEncryptConfig.EncryptLayer(destStream, imgspecv1.Descriptor{
+			MediaType:   srcInfo.MediaType,
+			Digest:      srcInfo.Digest,
+			Size:        srcInfo.Size,
+			Annotations: srcInfo.Annotations,
+		})
+		if err != nil {
+			return types.BlobInfo{}, err
 		}
+		destStream = s
+		encryptionAnnotations = annotations
+	}
+	if cryptoOperation != types.PreserveOriginalCrypto {
+		inputInfo = types.BlobInfo{Digest: "", Size: -1}
+	}
+
+	// === Report progress using the c.progress channel, if required.
+	var progressReader *progress.Reader
+	if c.progressReportingEnabled() {
+		progressReader = progress.NewReader(destStream, c.progress, c.progressInterval, srcInfo)
+		progressReader.Report(types.ProgressEventNewArtifact)
+		destStream = progressReader
 	}
 
 	// === Finally, send the layer stream to dest.
@@ -703,6 +1106,9 @@ func (c *copier) copyBlobFromStream(ctx context.Context, srcStream io.Reader, sr
 	if err != nil {
 		return types.BlobInfo{}, errors.Wrap(err, "Error writing blob")
 	}
+	if progressReader != nil {
+		progressReader.Report(types.ProgressEventDone)
+	}
 
 	// This is fairly horrible: the writer from getOriginalLayerCopyWriter wants to consumer
 	// all of the input (to compute DiffIDs), even if dest.PutBlob does not need it.
@@ -722,18 +1128,86 @@ func (c *copier) copyBlobFromStream(ctx context.Context, srcStream io.Reader, sr
 	if inputInfo.Digest != "" && uploadedInfo.Digest != inputInfo.Digest {
 		return types.BlobInfo{}, errors.Errorf("Internal error writing blob %s, blob with digest %s saved with digest %s", srcInfo.Digest, inputInfo.Digest, uploadedInfo.Digest)
 	}
+	if !isConfig {
+		uploadedInfo.CompressionOperation = compressionOperation
+		if compressionOperation == types.Compress {
+			algorithm := c.compressionFormat
+			uploadedInfo.CompressionAlgorithm = &algorithm
+		}
+		uploadedInfo.CryptoOperation = cryptoOperation
+		switch cryptoOperation {
+		case types.Encrypt:
+			annotations, err := encryptionAnnotations()
+			if err != nil {
+				return types.BlobInfo{}, err
+			}
+			uploadedInfo.Annotations = encryption.AnnotationsWithoutEncryption(srcInfo.Annotations)
+			if uploadedInfo.Annotations == nil {
+				uploadedInfo.Annotations = map[string]string{}
+			}
+			for k, v := range annotations {
+				uploadedInfo.Annotations[k] = v
+			}
+		case types.Decrypt:
+			uploadedInfo.Annotations = encryption.AnnotationsWithoutEncryption(srcInfo.Annotations)
+		}
+	}
 	return uploadedInfo, nil
 }
 
-// compressGoroutine reads all input from src and writes its compressed equivalent to dest.
-func compressGoroutine(dest *io.PipeWriter, src io.Reader) {
+// layerIsEncrypted returns true if the layer with info is encrypted.
+func layerIsEncrypted(info types.BlobInfo) bool {
+	t, err := manifest.ClassifyLayerMediaType(info.MediaType)
+	return err == nil && t.Encrypted
+}
+
+// layersToEncrypt returns the indices of the layers of an image with layerCount layers to encrypt, per c.ociEncryptLayers.
+func (c *copier) layersToEncrypt(layerCount int) (map[int]struct{}, error) {
+	res := map[int]struct{}{}
+	if c.ociEncryptLayers == nil {
+		return res, nil
+	}
+	if len(*c.ociEncryptLayers) == 0 {
+		for i := 0; i < layerCount; i++ {
+			res[i] = struct{}{}
+		}
+		return res, nil
+	}
+	for _, index := range *c.ociEncryptLayers {
+		i := index
+		if i < 0 {
+			i += layerCount
+		}
+		if i < 0 || i >= layerCount {
+			return nil, errors.Errorf("Layer index %d to encrypt is out of range, the image has %d layers", index, layerCount)
+		}
+		res[i] = struct{}{}
+	}
+	return res, nil
+}
+
+// desiredLayerCompression returns the kind of compression to apply on layers:
+// c.dest.DesiredLayerCompression(), adjusted if the user has asked for decompressed layers.
+func (c *copier) desiredLayerCompression() types.LayerCompression {
+	res := c.dest.DesiredLayerCompression()
+	if c.decompressLayers && res == types.PreserveOriginal {
+		return types.Decompress
+	}
+	return res
+}
+
+// compressGoroutine reads all input from src and writes its compressed equivalent, using c.compressionFormat, to dest.
+func (c *copier) compressGoroutine(dest *io.PipeWriter, src io.Reader) {
 	err := errors.New("Internal error: unexpected panic in compressGoroutine")
 	defer func() { // Note that this is not the same as {defer dest.CloseWithError(err)}; we need err to be evaluated lazily.
 		dest.CloseWithError(err) // CloseWithError(nil) is equivalent to Close()
 	}()
 
-	zipper := gzip.NewWriter(dest)
-	defer zipper.Close()
+	compressor, err := compression.CompressStream(dest, c.compressionFormat, c.compressionLevel)
+	if err != nil {
+		return
+	}
+	defer compressor.Close()
 
-	_, err = io.Copy(zipper, src) // Sets err to nil, i.e. causes dest.Close()
+	_, err = io.Copy(compressor, src) // Sets err to nil, i.e. causes dest.Close()
 }
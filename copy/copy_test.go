@@ -2,15 +2,30 @@ package copy
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/containers/image/directory"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/oci/layout"
 	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/pkg/encryption"
+	"github.com/containers/image/signature"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -122,3 +137,624 @@ func TestComputeDiffID(t *testing.T) {
 	_, err = computeDiffID(reader, nil)
 	assert.Error(t, err)
 }
+
+func TestCopyInParallel(t *testing.T) {
+	// All items are copied, with at most maxParallel copies running at the same time
+	var (
+		mutex               sync.Mutex
+		running, maxRunning int
+	)
+	copied := make([]bool, 10)
+	err := copyInParallel(context.Background(), len(copied), 3, func(ctx context.Context, index int) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		copied[index] = true
+		mutex.Unlock()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true, true, true, true, true, true, true, true}, copied)
+	assert.True(t, maxRunning > 1 && maxRunning <= 3, "%d", maxRunning)
+
+	// A failure cancels the other copies, and is returned
+	started := make([]bool, 10)
+	err = copyInParallel(context.Background(), len(started), 2, func(ctx context.Context, index int) error {
+		mutex.Lock()
+		started[index] = true
+		mutex.Unlock()
+		if index == 1 {
+			return errors.New("copy failed")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.Error(t, err)
+	assert.Equal(t, "copy failed", err.Error())
+	assert.False(t, started[len(started)-1])
+
+	// Cancelling the context stops the copy
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = copyInParallel(ctx, 10, 2, func(ctx context.Context, index int) error {
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
+
+// zstdSupported returns true if this build can compress and decompress zstd streams
+// (i.e. it uses the containers_image_zstd build tag).
+func zstdSupported() bool {
+	_, err := compression.CompressStream(ioutil.Discard, compression.Zstd, nil)
+	return err == nil
+}
+
+func TestCopyBlobFromStreamCompression(t *testing.T) {
+	uncompressed, err := ioutil.ReadFile("fixtures/Hello.uncompressed")
+	require.NoError(t, err)
+	level := gzip.BestCompression
+	zstdLevel := 19
+
+	for _, c := range []struct {
+		input             string
+		compressionFormat *compression.Algorithm
+		compressionLevel  *int
+		operation         types.LayerCompression
+		outputFormat      string // "" if uncompressed
+	}{
+		{"fixtures/Hello.uncompressed", nil, nil, types.Compress, "gzip"},
+		{"fixtures/Hello.uncompressed", &compression.Gzip, &level, types.Compress, "gzip"},
+		{"fixtures/Hello.gz", nil, nil, types.PreserveOriginal, "gzip"},
+		{"fixtures/Hello.gz", &compression.Gzip, &level, types.PreserveOriginal, "gzip"},
+		{"fixtures/Hello.bz2", nil, nil, types.PreserveOriginal, "bzip2"},
+		{"fixtures/Hello.bz2", &compression.Gzip, nil, types.Compress, "gzip"},
+		{"fixtures/Hello.xz", &compression.Gzip, &level, types.Compress, "gzip"},
+		{"fixtures/Hello.uncompressed", &compression.Zstd, nil, types.Compress, "zstd"},
+		{"fixtures/Hello.gz", &compression.Zstd, &zstdLevel, types.Compress, "zstd"},
+		{"fixtures/Hello.zst", &compression.Zstd, nil, types.PreserveOriginal, "zstd"},
+		{"fixtures/Hello.zst", nil, nil, types.PreserveOriginal, "zstd"},
+		{"fixtures/Hello.zst", &compression.Gzip, nil, types.Compress, "gzip"},
+	} {
+		if !zstdSupported() && (c.input == "fixtures/Hello.zst" || c.compressionFormat == &compression.Zstd) {
+			continue
+		}
+		tmpDir, err := ioutil.TempDir("", "copy-compression")
+		require.NoError(t, err)
+		defer os.RemoveAll(tmpDir)
+		ref, err := directory.NewReference(tmpDir)
+		require.NoError(t, err)
+		dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{DirForceCompress: true})
+		require.NoError(t, err)
+		defer dest.Close()
+		cp := &copier{
+			dest:              dest,
+			reportWriter:      ioutil.Discard,
+			compressionFormat: compression.Gzip,
+			compressionLevel:  c.compressionLevel,
+		}
+		if c.compressionFormat != nil {
+			cp.compressionFormat = *c.compressionFormat
+			cp.recompressLayers = true
+		}
+
+		input, err := ioutil.ReadFile(c.input)
+		require.NoError(t, err, c.input)
+		srcInfo := types.BlobInfo{Digest: digest.FromBytes(input), Size: int64(len(input))}
+		info, err := cp.copyBlobFromStream(context.Background(), bytes.NewReader(input), srcInfo, nil, true, false, types.PreserveOriginalCrypto)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.operation, info.CompressionOperation, c.input)
+		if c.operation == types.Compress {
+			require.NotNil(t, info.CompressionAlgorithm, c.input)
+			assert.Equal(t, c.outputFormat, info.CompressionAlgorithm.Name(), c.input)
+		} else {
+			assert.Nil(t, info.CompressionAlgorithm, c.input)
+			assert.Equal(t, srcInfo.Digest, info.Digest, c.input)
+		}
+
+		output, err := ioutil.ReadFile(filepath.Join(tmpDir, info.Digest.Hex()))
+		require.NoError(t, err, c.input)
+		algo, decompressor, _, err := compression.DetectCompressionFormat(bytes.NewReader(output))
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.outputFormat, algo.Name(), c.input)
+		require.NotNil(t, decompressor, c.input)
+		s, err := decompressor(bytes.NewReader(output))
+		require.NoError(t, err, c.input)
+		decompressed, err := ioutil.ReadAll(s)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, uncompressed, decompressed, c.input)
+	}
+}
+
+func TestCopyBlobFromStreamDecompressLayers(t *testing.T) {
+	uncompressed, err := ioutil.ReadFile("fixtures/Hello.uncompressed")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		input            string
+		decompressLayers bool
+		operation        types.LayerCompression
+	}{
+		{"fixtures/Hello.uncompressed", true, types.PreserveOriginal},
+		{"fixtures/Hello.gz", true, types.Decompress},
+		{"fixtures/Hello.bz2", true, types.Decompress},
+		{"fixtures/Hello.xz", true, types.Decompress},
+		{"fixtures/Hello.zst", true, types.Decompress},
+		{"fixtures/Hello.gz", false, types.PreserveOriginal},
+	} {
+		if !zstdSupported() && c.input == "fixtures/Hello.zst" {
+			continue
+		}
+		tmpDir, err := ioutil.TempDir("", "copy-decompression")
+		require.NoError(t, err)
+		defer os.RemoveAll(tmpDir)
+		ref, err := directory.NewReference(tmpDir)
+		require.NoError(t, err)
+		dest, err := ref.NewImageDestination(context.Background(), nil)
+		require.NoError(t, err)
+		defer dest.Close()
+		cp := &copier{
+			dest:              dest,
+			reportWriter:      ioutil.Discard,
+			compressionFormat: compression.Gzip,
+			decompressLayers:  c.decompressLayers,
+		}
+
+		input, err := ioutil.ReadFile(c.input)
+		require.NoError(t, err, c.input)
+		srcInfo := types.BlobInfo{Digest: digest.FromBytes(input), Size: int64(len(input))}
+		info, err := cp.copyBlobFromStream(context.Background(), bytes.NewReader(input), srcInfo, nil, true, false, types.PreserveOriginalCrypto)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.operation, info.CompressionOperation, c.input)
+		assert.Nil(t, info.CompressionAlgorithm, c.input)
+		output, err := ioutil.ReadFile(filepath.Join(tmpDir, info.Digest.Hex()))
+		require.NoError(t, err, c.input)
+		if c.decompressLayers {
+			assert.Equal(t, digest.FromBytes(uncompressed), info.Digest, c.input)
+			assert.Equal(t, uncompressed, output, c.input)
+		} else {
+			assert.Equal(t, srcInfo.Digest, info.Digest, c.input)
+			assert.Equal(t, input, output, c.input)
+		}
+	}
+}
+
+func TestImageDecompressLayersOptions(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "copy-decompression-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	destDir, err := ioutil.TempDir("", "copy-decompression-dest")
+	require.NoError(t, err)
+	defer os.RemoveAll(destDir)
+	destRef, err := directory.NewReference(destDir)
+	require.NoError(t, err)
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}})
+	require.NoError(t, err)
+	defer policyContext.Destroy()
+
+	for _, sys := range []*types.SystemContext{
+		{DecompressLayers: true, CompressionFormat: &compression.Gzip}, // Conflicting options
+		{DecompressLayers: true, DirForceCompress: true},               // The destination requires compressed layers
+	} {
+		_, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{DestinationCtx: sys})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "compressed")
+	}
+}
+
+func TestCopyBlobFromStreamEncryptedLayer(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "copy-encrypted")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	ref, err := directory.NewReference(tmpDir)
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{DirForceCompress: true})
+	require.NoError(t, err)
+	defer dest.Close()
+	cp := &copier{
+		dest:              dest,
+		reportWriter:      ioutil.Discard,
+		compressionFormat: compression.Gzip,
+	}
+
+	// Encrypted layers are not compressed, even if the destination requires compression;
+	// (the contents do not matter, without decryption the blob is copied unmodified.)
+	input, err := ioutil.ReadFile("fixtures/Hello.uncompressed")
+	require.NoError(t, err)
+	srcInfo := types.BlobInfo{Digest: digest.FromBytes(input), Size: int64(len(input)), MediaType: imgspecv1.MediaTypeImageLayerGzip + "+encrypted"}
+	info, err := cp.copyBlobFromStream(context.Background(), bytes.NewReader(input), srcInfo, nil, true, false, types.PreserveOriginalCrypto)
+	require.NoError(t, err)
+	assert.Equal(t, types.PreserveOriginal, info.CompressionOperation)
+	assert.Equal(t, types.PreserveOriginalCrypto, info.CryptoOperation)
+	assert.Equal(t, srcInfo.Digest, info.Digest)
+}
+
+func TestLayersToEncrypt(t *testing.T) {
+	for _, c := range []struct {
+		layers   *[]int
+		expected []int // nil if an error is expected
+	}{
+		{nil, []int{}},
+		{&[]int{}, []int{0, 1, 2}},
+		{&[]int{0}, []int{0}},
+		{&[]int{-1}, []int{2}},
+		{&[]int{0, -1, 2}, []int{0, 2}},
+		{&[]int{3}, nil},
+		{&[]int{-4}, nil},
+	} {
+		c2 := &copier{ociEncryptLayers: c.layers}
+		res, err := c2.layersToEncrypt(3)
+		if c.expected == nil {
+			assert.Error(t, err, c.layers)
+			continue
+		}
+		require.NoError(t, err, c.layers)
+		expected := map[int]struct{}{}
+		for _, i := range c.expected {
+			expected[i] = struct{}{}
+		}
+		assert.Equal(t, expected, res, c.layers)
+	}
+}
+
+func TestImageEncryptionOptions(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "copy-encryption-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	putTestImage(t, srcRef, "fixtures/Hello.gz")
+	destDir, err := ioutil.TempDir("", "copy-encryption-dest")
+	require.NoError(t, err)
+	defer os.RemoveAll(destDir)
+	destRef, err := directory.NewReference(destDir)
+	require.NoError(t, err)
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}})
+	require.NoError(t, err)
+	defer policyContext.Destroy()
+
+	// The configurations are never used, all of these fail before copying any layers.
+	for _, options := range []*Options{
+		{OciEncryptConfig: &encryption.EncryptConfig{}},
+		{OciEncryptLayers: &[]int{}},
+		{OciEncryptConfig: &encryption.EncryptConfig{}, OciEncryptLayers: &[]int{}, PreserveDigests: true},
+		{OciDecryptConfig: &encryption.DecryptConfig{}, PreserveDigests: true},
+		{OciDecryptConfig: &encryption.DecryptConfig{}, ResumeStateFile: filepath.Join(destDir, "state.json")},
+		{OciEncryptConfig: &encryption.EncryptConfig{}, OciEncryptLayers: &[]int{1}}, // Out of range
+	} {
+		_, err := Image(context.Background(), policyContext, destRef, srcRef, options)
+		assert.Error(t, err)
+	}
+}
+
+func TestCopyLayerProgress(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "copy-progress")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	ref, err := directory.NewReference(tmpDir)
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	ch := make(chan types.ProgressProperties, 100)
+	ic := &imageCopier{
+		c: &copier{
+			dest:              dest,
+			reportWriter:      ioutil.Discard,
+			progressInterval:  time.Hour,
+			progress:          ch,
+			compressionFormat: compression.Gzip,
+			cachedDiffIDs:     map[digest.Digest]digest.Digest{},
+		},
+	}
+
+	input, err := ioutil.ReadFile("fixtures/Hello.gz")
+	require.NoError(t, err)
+	srcInfo := types.BlobInfo{Digest: digest.FromBytes(input), Size: int64(len(input))}
+	// A new blob is copied
+	_, err = ic.c.copyBlobFromStream(context.Background(), bytes.NewReader(input), srcInfo, nil, true, false, types.PreserveOriginalCrypto)
+	require.NoError(t, err)
+	// The same blob is skipped because it already exists at the destination
+	_, _, err = ic.copyLayer(context.Background(), srcInfo, false)
+	require.NoError(t, err)
+	close(ch)
+
+	events := []types.ProgressProperties{}
+	for p := range ch {
+		events = append(events, p)
+	}
+	assert.Equal(t, []types.ProgressProperties{
+		{Event: types.ProgressEventNewArtifact, Artifact: srcInfo},
+		{Event: types.ProgressEventRead, Artifact: srcInfo, Offset: uint64(len(input)), OffsetUpdate: uint64(len(input))},
+		{Event: types.ProgressEventDone, Artifact: srcInfo, Offset: uint64(len(input))},
+		{Event: types.ProgressEventSkipped, Artifact: srcInfo, Offset: uint64(len(input))},
+	}, events)
+}
+
+// putTestImage stores a schema2 image with a single layer from layerFile to ref, and returns its manifest.
+func putTestImage(t *testing.T, ref types.ImageReference, layerFile string) []byte {
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	m := putTestImageBlobs(t, dest, layerFile, "amd64")
+	require.NoError(t, dest.PutManifest(context.Background(), m))
+	require.NoError(t, dest.Commit(context.Background()))
+	return m
+}
+
+// putTestImageBlobs stores blobs of a schema2 image for arch with a single layer from layerFile to dest, and returns its manifest.
+func putTestImageBlobs(t *testing.T, dest types.ImageDestination, layerFile string, arch string) []byte {
+	layer, err := ioutil.ReadFile(layerFile)
+	require.NoError(t, err)
+	uncompressed, err := ioutil.ReadFile("fixtures/Hello.uncompressed")
+	require.NoError(t, err)
+	config := []byte(`{"architecture":"` + arch + `","os":"linux","rootfs":{"type":"layers","diff_ids":["` + digest.FromBytes(uncompressed).String() + `"]}}`)
+	for _, blob := range [][]byte{config, layer} {
+		_, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}, false)
+		require.NoError(t, err)
+	}
+	m := []byte(`{
+   "schemaVersion": 2,
+   "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+   "config": {
+      "mediaType": "application/vnd.docker.container.image.v1+json",
+      "size": ` + fmt.Sprint(len(config)) + `,
+      "digest": "` + digest.FromBytes(config).String() + `"
+   },
+   "layers": [
+      {
+         "mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip",
+         "size": ` + fmt.Sprint(len(layer)) + `,
+         "digest": "` + digest.FromBytes(layer).String() + `"
+      }
+   ]
+}`)
+	return m
+}
+
+func TestImagePreserveDigests(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "copy-preserve-digests-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	srcManifest := putTestImage(t, srcRef, "fixtures/Hello.gz")
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}})
+	require.NoError(t, err)
+	defer policyContext.Destroy()
+
+	// The image is copied unmodified
+	destDir, err := ioutil.TempDir("", "copy-preserve-digests-dest")
+	require.NoError(t, err)
+	defer os.RemoveAll(destDir)
+	destRef, err := directory.NewReference(destDir)
+	require.NoError(t, err)
+	m, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{PreserveDigests: true})
+	require.NoError(t, err)
+	assert.Equal(t, srcManifest, m)
+	destManifest, err := ioutil.ReadFile(filepath.Join(destDir, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, srcManifest, destManifest)
+
+	// Changes to the manifest or to layer compression are rejected
+	for _, c := range []struct {
+		options *Options
+		message string
+	}{
+		{&Options{PreserveDigests: true, ForceManifestMIMEType: imgspecv1.MediaTypeImageManifest}, "not allowed when preserving digests"},
+		{&Options{PreserveDigests: true, DestinationCtx: &types.SystemContext{CompressionFormat: &compression.Gzip}}, "compression"},
+		{&Options{PreserveDigests: true, DestinationCtx: &types.SystemContext{DecompressLayers: true}}, "compression"},
+	} {
+		_, err := Image(context.Background(), policyContext, destRef, srcRef, c.options)
+		require.Error(t, err, c.message)
+		assert.Contains(t, err.Error(), c.message)
+	}
+}
+
+// putTestList stores a schema2 manifest list referencing an image with a single layer from layerFile for each of arches to ref,
+// and returns the manifest list and the manifests of the images.
+func putTestList(t *testing.T, ref types.ImageReference, layerFile string, arches []string, algorithm digest.Algorithm) ([]byte, map[string][]byte) {
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	listDest, ok := dest.(types.ManifestListDestination)
+	require.True(t, ok)
+
+	instances := map[string][]byte{}
+	entries := []string{}
+	for _, arch := range arches {
+		m := putTestImageBlobs(t, dest, layerFile, arch)
+		md := algorithm.FromBytes(m)
+		require.NoError(t, listDest.PutInstanceManifest(context.Background(), m, manifest.DockerV2Schema2MediaType, md))
+		instances[arch] = m
+		entries = append(entries, fmt.Sprintf(`{"mediaType":"%s","size":%d,"digest":"%s","platform":{"architecture":"%s","os":"linux"}}`,
+			manifest.DockerV2Schema2MediaType, len(m), md, arch))
+	}
+	list := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[%s]}`, manifest.DockerV2ListMediaType, strings.Join(entries, ",")))
+	require.NoError(t, dest.PutManifest(context.Background(), list))
+	require.NoError(t, dest.Commit(context.Background()))
+	return list, instances
+}
+
+func TestImageMultipleImages(t *testing.T) {
+	arches := []string{"amd64", "arm64", "s390x"}
+	srcDir, err := ioutil.TempDir("", "copy-multiple-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	srcList, instances := putTestList(t, srcRef, "fixtures/Hello.gz", arches, digest.Canonical)
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}})
+	require.NoError(t, err)
+	defer policyContext.Destroy()
+
+	for _, c := range []struct {
+		name           string
+		options        *Options
+		expectedArches []string // nil if only a single image is expected to be copied
+	}{
+		{"all", &Options{ImageListSelection: CopyAllImages}, arches},
+		{"all, preserving digests", &Options{ImageListSelection: CopyAllImages, PreserveDigests: true}, arches},
+		{
+			"specific",
+			&Options{
+				ImageListSelection: CopySpecificImages,
+				Instances:          []digest.Digest{digest.FromBytes(instances["s390x"])},
+				InstancePlatforms:  []imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}},
+			},
+			[]string{"amd64", "s390x"},
+		},
+		{"system", &Options{SourceCtx: &types.SystemContext{ArchitectureChoice: "arm64", OSChoice: "linux"}}, nil},
+	} {
+		destDir, err := ioutil.TempDir("", "copy-multiple-dest")
+		require.NoError(t, err)
+		defer os.RemoveAll(destDir)
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+
+		m, err := Image(context.Background(), policyContext, destRef, srcRef, c.options)
+		require.NoError(t, err, c.name)
+
+		destSrc, err := destRef.NewImageSource(context.Background(), nil)
+		require.NoError(t, err, c.name)
+		defer destSrc.Close()
+		destManifest, mimeType, err := destSrc.GetManifest(context.Background(), nil)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, m, destManifest, c.name)
+		if c.expectedArches == nil {
+			assert.Equal(t, instances["arm64"], destManifest, c.name)
+			continue
+		}
+		assert.Equal(t, manifest.DockerV2ListMediaType, mimeType, c.name)
+		if len(c.expectedArches) == len(arches) {
+			assert.Equal(t, srcList, destManifest, c.name)
+		}
+		list, err := manifest.ListFromBlob(destManifest, mimeType)
+		require.NoError(t, err, c.name)
+		copiedArches := []string{}
+		for _, instance := range list.Instances() {
+			copiedArches = append(copiedArches, instance.Platform.Architecture)
+			instanceManifest, _, err := destSrc.GetManifest(context.Background(), &instance.Digest)
+			require.NoError(t, err, c.name)
+			assert.Equal(t, instances[instance.Platform.Architecture], instanceManifest, c.name)
+		}
+		assert.Equal(t, c.expectedArches, copiedArches, c.name)
+	}
+
+	// Selecting no images fails
+	destDir, err := ioutil.TempDir("", "copy-multiple-dest")
+	require.NoError(t, err)
+	defer os.RemoveAll(destDir)
+	destRef, err := directory.NewReference(destDir)
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		ImageListSelection: CopySpecificImages,
+		InstancePlatforms:  []imgspecv1.Platform{{OS: "windows", Architecture: "amd64"}},
+	})
+	assert.Error(t, err)
+	// Copying a single image from a list while preserving digests fails
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{PreserveDigests: true})
+	assert.Error(t, err)
+
+	// Lists using a non-default digest algorithm are preserved
+	sha512SrcDir, err := ioutil.TempDir("", "copy-multiple-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(sha512SrcDir)
+	sha512SrcRef, err := directory.NewReference(sha512SrcDir)
+	require.NoError(t, err)
+	sha512SrcList, sha512Instances := putTestList(t, sha512SrcRef, "fixtures/Hello.gz", arches, digest.SHA512)
+	sha512DestDir, err := ioutil.TempDir("", "copy-multiple-dest")
+	require.NoError(t, err)
+	defer os.RemoveAll(sha512DestDir)
+	sha512DestRef, err := directory.NewReference(sha512DestDir)
+	require.NoError(t, err)
+	m, err := Image(context.Background(), policyContext, sha512DestRef, sha512SrcRef, &Options{ImageListSelection: CopyAllImages, PreserveDigests: true})
+	require.NoError(t, err)
+	assert.Equal(t, sha512SrcList, m)
+	destSrc, err := sha512DestRef.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer destSrc.Close()
+	for _, arch := range arches {
+		instanceDigest := digest.SHA512.FromBytes(sha512Instances[arch])
+		instanceManifest, _, err := destSrc.GetManifest(context.Background(), &instanceDigest)
+		require.NoError(t, err, arch)
+		assert.Equal(t, sha512Instances[arch], instanceManifest, arch)
+	}
+}
+
+func TestImageResumeStateFile(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "copy-resume-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	srcManifest := putTestImage(t, srcRef, "fixtures/Hello.uncompressed")
+	m, err := manifest.Schema2FromManifest(srcManifest)
+	require.NoError(t, err)
+	srcLayerDigest := m.LayersDescriptors[0].Digest
+	stateDir, err := ioutil.TempDir("", "copy-resume-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+	stateFile := filepath.Join(stateDir, "state.json")
+	destDir, err := ioutil.TempDir("", "copy-resume-dest")
+	require.NoError(t, err)
+	defer os.RemoveAll(destDir)
+	destRef, err := layout.NewReference(destDir, "latest")
+	require.NoError(t, err)
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}})
+	require.NoError(t, err)
+	defer policyContext.Destroy()
+
+	// Interrupt the copy after the layer is copied, by making the config unavailable.
+	configPath := filepath.Join(srcDir, m.ConfigDescriptor.Digest.Hex())
+	config, err := ioutil.ReadFile(configPath)
+	require.NoError(t, err)
+	err = os.Remove(configPath)
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{ResumeStateFile: stateFile})
+	require.Error(t, err)
+	state, err := loadResumeState(stateFile, transports.ImageName(destRef), "gzip")
+	require.NoError(t, err)
+	recorded, ok := state.blob(srcLayerDigest)
+	require.True(t, ok)
+	assert.NotEqual(t, srcLayerDigest, recorded.Digest) // The layer was compressed
+	assert.Equal(t, types.Compress, recorded.CompressionOperation)
+
+	// The resumed copy does not copy the layer again.
+	err = ioutil.WriteFile(configPath, config, 0644)
+	require.NoError(t, err)
+	reportWriter := bytes.Buffer{}
+	destManifest, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{ResumeStateFile: stateFile, ReportWriter: &reportWriter})
+	require.NoError(t, err)
+	assert.Contains(t, reportWriter.String(), fmt.Sprintf("Skipping blob %s, already copied as %s", srcLayerDigest, recorded.Digest))
+	assert.NotContains(t, reportWriter.String(), fmt.Sprintf("Copying blob %s", srcLayerDigest))
+	dm, err := manifest.OCI1FromManifest(destManifest)
+	require.NoError(t, err)
+	require.Len(t, dm.Layers, 1)
+	assert.Equal(t, recorded.Digest, dm.Layers[0].Digest)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip, dm.Layers[0].MediaType)
+	// The state is removed after a successful copy.
+	_, err = os.Stat(stateFile)
+	assert.True(t, os.IsNotExist(err))
+
+	// State recorded with different copy settings is ignored.
+	err = state.record(srcLayerDigest, types.BlobInfo{Digest: recorded.Digest, Size: recorded.Size}, "")
+	require.NoError(t, err)
+	reportWriter.Reset()
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		ResumeStateFile: stateFile,
+		ReportWriter:    &reportWriter,
+		DestinationCtx:  &types.SystemContext{CompressionFormat: &compression.Gzip},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, reportWriter.String(), fmt.Sprintf("Copying blob %s", srcLayerDigest))
+}
@@ -0,0 +1,132 @@
+// +build containers_image_ocicrypt
+
+package copy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/directory"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/pkg/encryption"
+	"github.com/containers/image/signature"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestKeyPair generates a RSA key pair, stores it in dir as PEM files, and returns the paths of the public and private key.
+func writeTestKeyPair(t *testing.T, dir, name string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	publicPath := filepath.Join(dir, name+".pub.pem")
+	err = ioutil.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0644)
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, name+".pem")
+	err = ioutil.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	require.NoError(t, err)
+	return publicPath, privatePath
+}
+
+// readDirManifest returns the OCI manifest stored in a dir: image in dir.
+func readDirManifest(t *testing.T, dir string) *manifest.OCI1 {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	require.NoError(t, err)
+	require.Equal(t, imgspecv1.MediaTypeImageManifest, manifest.GuessMIMEType(blob))
+	m, err := manifest.OCI1FromManifest(blob)
+	require.NoError(t, err)
+	return m
+}
+
+func TestImageEncryption(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "copy-encryption")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	publicPath, privatePath := writeTestKeyPair(t, tmpDir, "key")
+	_, otherPrivatePath := writeTestKeyPair(t, tmpDir, "other")
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}})
+	require.NoError(t, err)
+	defer policyContext.Destroy()
+
+	newDirRef := func(name string) (string, types.ImageReference) {
+		dir := filepath.Join(tmpDir, name)
+		require.NoError(t, os.Mkdir(dir, 0755))
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		return dir, ref
+	}
+	_, srcRef := newDirRef("src")
+	putTestImage(t, srcRef, "fixtures/Hello.gz")
+	layer, err := ioutil.ReadFile("fixtures/Hello.gz")
+	require.NoError(t, err)
+
+	// Encryption converts the schema2 image to OCI, and records the encrypted layer.
+	encryptedDir, encryptedRef := newDirRef("encrypted")
+	ec, err := encryption.NewEncryptConfig([]string{"jwe:" + publicPath})
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, encryptedRef, srcRef, &Options{
+		OciEncryptConfig: ec,
+		OciEncryptLayers: &[]int{},
+	})
+	require.NoError(t, err)
+	m := readDirManifest(t, encryptedDir)
+	require.Len(t, m.Layers, 1)
+	encryptedLayer := m.Layers[0]
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip+"+encrypted", encryptedLayer.MediaType)
+	assert.NotEqual(t, digest.FromBytes(layer), encryptedLayer.Digest)
+	assert.Contains(t, encryptedLayer.Annotations, "org.opencontainers.image.enc.keys.jwe")
+	assert.Contains(t, encryptedLayer.Annotations, "org.opencontainers.image.enc.pubopts")
+	encryptedBlob, err := ioutil.ReadFile(filepath.Join(encryptedDir, encryptedLayer.Digest.Hex()))
+	require.NoError(t, err)
+	assert.Equal(t, encryptedLayer.Digest, digest.FromBytes(encryptedBlob))
+	assert.Equal(t, encryptedLayer.Size, int64(len(encryptedBlob)))
+
+	// Copying without a decryption configuration preserves the encrypted layer.
+	preservedDir, preservedRef := newDirRef("preserved")
+	_, err = Image(context.Background(), policyContext, preservedRef, encryptedRef, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []imgspecv1.Descriptor{encryptedLayer}, readDirManifest(t, preservedDir).Layers)
+
+	// Encrypting an encrypted layer again fails.
+	_, reencryptedRef := newDirRef("reencrypted")
+	_, err = Image(context.Background(), policyContext, reencryptedRef, encryptedRef, &Options{
+		OciEncryptConfig: ec,
+		OciEncryptLayers: &[]int{0},
+	})
+	assert.Error(t, err)
+
+	// Decrypting with a key of a different recipient fails.
+	_, failedRef := newDirRef("failed")
+	otherDC, err := encryption.NewDecryptConfig([]string{otherPrivatePath})
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, failedRef, encryptedRef, &Options{OciDecryptConfig: otherDC})
+	assert.Error(t, err)
+
+	// Decryption restores the original layer.
+	decryptedDir, decryptedRef := newDirRef("decrypted")
+	dc, err := encryption.NewDecryptConfig([]string{privatePath})
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, decryptedRef, encryptedRef, &Options{OciDecryptConfig: dc})
+	require.NoError(t, err)
+	m = readDirManifest(t, decryptedDir)
+	require.Len(t, m.Layers, 1)
+	assert.Equal(t, imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageLayerGzip,
+		Digest:    digest.FromBytes(layer),
+		Size:      int64(len(layer)),
+	}, m.Layers[0])
+	decryptedBlob, err := ioutil.ReadFile(filepath.Join(decryptedDir, m.Layers[0].Digest.Hex()))
+	require.NoError(t, err)
+	assert.Equal(t, layer, decryptedBlob)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/containers/image/manifest"
 	"github.com/containers/image/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -57,6 +58,21 @@ func (ic *imageCopier) determineManifestConversion(ctx context.Context, destSupp
 		destSupportedManifestMIMETypes = []string{forceManifestMIMEType}
 	}
 
+	if len(ic.layersToEncrypt) != 0 {
+		// Encrypted layers are only supported in OCI images.
+		ociSupported := len(destSupportedManifestMIMETypes) == 0
+		for _, t := range destSupportedManifestMIMETypes {
+			if t == imgspecv1.MediaTypeImageManifest {
+				ociSupported = true
+			}
+		}
+		if !ociSupported {
+			return "", nil, errors.Errorf("Encrypting layers requires an OCI manifest, which is not accepted by the destination (accepted types: %s)",
+				strings.Join(destSupportedManifestMIMETypes, ", "))
+		}
+		destSupportedManifestMIMETypes = []string{imgspecv1.MediaTypeImageManifest}
+	}
+
 	if len(destSupportedManifestMIMETypes) == 0 {
 		return srcType, []string{}, nil // Anything goes; just use the original as is, do not try any conversions.
 	}
@@ -78,6 +94,10 @@ func (ic *imageCopier) determineManifestConversion(ctx context.Context, destSupp
 		prioritizedTypes.append(srcType)
 	}
 	if !ic.canModifyManifest {
+		if ic.preserveDigests && len(prioritizedTypes.list) == 0 {
+			return "", nil, errors.Errorf("Manifest MIME type %s is not accepted by the destination (accepted types: %s), and converting it is not allowed when preserving digests",
+				srcType, strings.Join(destSupportedManifestMIMETypes, ", "))
+		}
 		// We could also drop the !ic.canModifyManifest check and have the caller
 		// make the choice; it is already doing that to an extent, to improve error
 		// messages.  But it is nice to hide the “if !ic.canModifyManifest, do no conversion”
@@ -74,6 +74,9 @@ func (f fakeImageSource) UpdatedImage(ctx context.Context, options types.Manifes
 func (f fakeImageSource) Size() (int64, error) {
 	panic("Unexpected call to a mock function")
 }
+func (f fakeImageSource) SizeWithContext(ctx context.Context) (int64, error) {
+	panic("Unexpected call to a mock function")
+}
 
 func TestDetermineManifestConversion(t *testing.T) {
 	supportS1S2OCI := []string{
@@ -170,6 +173,26 @@ func TestDetermineManifestConversion(t *testing.T) {
 		assert.Equal(t, []string{}, otherCandidates, c.description)
 	}
 
+	// With preserveDigests, the original is kept as is if the destination accepts it, and conversions fail
+	for _, c := range cases {
+		src := fakeImageSource(c.sourceType)
+		ic := &imageCopier{
+			manifestUpdates:   &types.ManifestUpdateOptions{},
+			src:               src,
+			canModifyManifest: false,
+			preserveDigests:   true,
+		}
+		preferredMIMEType, otherCandidates, err := ic.determineManifestConversion(context.Background(), c.destTypes, "")
+		if c.expectedUpdate != "" {
+			assert.Error(t, err, c.description)
+			continue
+		}
+		require.NoError(t, err, c.description)
+		assert.Equal(t, "", ic.manifestUpdates.ManifestMIMEType, c.description)
+		assert.Equal(t, manifest.NormalizedMIMEType(c.sourceType), preferredMIMEType, c.description)
+		assert.Equal(t, []string{}, otherCandidates, c.description)
+	}
+
 	// With forceManifestMIMEType, the output is always the forced manifest type (in this case oci manifest)
 	for _, c := range cases {
 		src := fakeImageSource(c.sourceType)
@@ -185,6 +208,41 @@ func TestDetermineManifestConversion(t *testing.T) {
 		assert.Equal(t, []string{}, otherCandidates, c.description)
 	}
 
+	// With layers to encrypt, the output is always an OCI manifest, if the destination accepts it
+	for _, c := range []struct {
+		sourceType    string
+		destTypes     []string
+		forceMIMEType string
+		expectedOK    bool
+	}{
+		{manifest.DockerV2Schema2MediaType, nil, "", true},
+		{manifest.DockerV2Schema2MediaType, supportS1S2OCI, "", true},
+		{v1.MediaTypeImageManifest, supportS1OCI, "", true},
+		{manifest.DockerV2Schema2MediaType, supportS1S2, "", false},
+		{v1.MediaTypeImageManifest, supportS1S2OCI, manifest.DockerV2Schema2MediaType, false},
+	} {
+		src := fakeImageSource(c.sourceType)
+		ic := &imageCopier{
+			manifestUpdates:   &types.ManifestUpdateOptions{},
+			src:               src,
+			canModifyManifest: true,
+			layersToEncrypt:   map[int]struct{}{0: {}},
+		}
+		preferredMIMEType, otherCandidates, err := ic.determineManifestConversion(context.Background(), c.destTypes, c.forceMIMEType)
+		if !c.expectedOK {
+			assert.Error(t, err, c.sourceType)
+			continue
+		}
+		require.NoError(t, err, c.sourceType)
+		assert.Equal(t, v1.MediaTypeImageManifest, preferredMIMEType, c.sourceType)
+		assert.Equal(t, []string{}, otherCandidates, c.sourceType)
+		if c.sourceType == v1.MediaTypeImageManifest {
+			assert.Equal(t, "", ic.manifestUpdates.ManifestMIMEType, c.sourceType)
+		} else {
+			assert.Equal(t, v1.MediaTypeImageManifest, ic.manifestUpdates.ManifestMIMEType, c.sourceType)
+		}
+	}
+
 	// Error reading the manifest — smoke test only.
 	ic := imageCopier{
 		manifestUpdates:   &types.ManifestUpdateOptions{},
@@ -0,0 +1,142 @@
+package copy
+
+import (
+	"context"
+
+	"github.com/containers/image/image"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/signature"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// copyMultipleImages copies the manifest list unparsedToplevel and the images it references, as selected by options.ImageListSelection,
+// using policyContext to validate source image admissibility, and returns the manifest list which was written to the destination.
+func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signature.PolicyContext, options *Options, unparsedToplevel *image.UnparsedImage) ([]byte, error) {
+	listDest, ok := c.dest.(types.ManifestListDestination)
+	if !ok {
+		return nil, errors.Errorf("Copying manifest lists to %s is not supported, copy only a single image instead", transports.ImageName(c.dest.Reference()))
+	}
+
+	// Please keep this policy check BEFORE reading any other information about the image.
+	if allowed, err := policyContext.IsRunningImageAllowed(ctx, unparsedToplevel); !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
+		return nil, errors.Wrap(err, "Source image rejected")
+	}
+	listBlob, listMIMEType, err := unparsedToplevel.Manifest(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading manifest list")
+	}
+	list, err := manifest.ListFromBlob(listBlob, listMIMEType)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing manifest list")
+	}
+
+	sigs, err := c.sourceSignatures(ctx, unparsedToplevel, options)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := list.Instances()
+	selected := make([]bool, len(instances))
+	selectedCount := 0
+	listModified := false
+	for i, instance := range instances {
+		selected[i] = instanceSelected(options, instance)
+		if selected[i] {
+			selectedCount++
+		} else {
+			logrus.Debugf("Skipping image %s (%d/%d) from the manifest list", instance.Digest, i+1, len(instances))
+			listModified = true
+		}
+	}
+	if selectedCount == 0 {
+		return nil, errors.New("No images from the manifest list were selected to be copied")
+	}
+
+	updates := make([]*manifest.ListUpdate, len(instances))
+	for i, instance := range instances {
+		if !selected[i] {
+			continue
+		}
+		c.Printf("Copying image %s (%d/%d)\n", instance.Digest, i+1, len(instances))
+		unparsedInstance := image.UnparsedInstance(c.rawSource, &instance.Digest)
+		// Use the digest algorithm of the original instance digest, so that the list is not unnecessarily modified.
+		instanceDigestAlgorithm := digest.Canonical
+		if instance.Digest.Validate() == nil {
+			instanceDigestAlgorithm = instance.Digest.Algorithm()
+		}
+		instanceManifest, instanceMIMEType, err := c.copyOneImage(ctx, policyContext, options, unparsedInstance, listDest, instanceDigestAlgorithm)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error copying image %s from the manifest list", instance.Digest)
+		}
+		instanceDigest, err := manifest.DigestWithAlgorithm(instanceManifest, instanceDigestAlgorithm)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error computing the digest of the copied image %s", instance.Digest)
+		}
+		if instanceMIMEType == "" {
+			instanceMIMEType = instance.MediaType
+		}
+		updates[i] = &manifest.ListUpdate{Digest: instanceDigest, Size: int64(len(instanceManifest)), MediaType: instanceMIMEType}
+		if instanceDigest != instance.Digest || updates[i].Size != instance.Size || instanceMIMEType != instance.MediaType {
+			listModified = true
+		}
+	}
+
+	if listModified {
+		switch {
+		case options.PreserveDigests:
+			return nil, errors.New("Copying the images changed the manifest list, which is not allowed when preserving digests")
+		case len(sigs) != 0:
+			return nil, errors.New("Copying the images changed the manifest list, which would invalidate its existing signatures. Explicitly enable signature removal to proceed anyway")
+		}
+		if err := list.UpdateInstances(updates); err != nil {
+			return nil, errors.Wrap(err, "Error updating the manifest list")
+		}
+		listBlob, err = list.Serialize()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error serializing the manifest list")
+		}
+		listMIMEType = list.MIMEType()
+	}
+
+	c.Printf("Writing manifest list to image destination\n")
+	if err := c.putManifest(ctx, listBlob, listMIMEType); err != nil {
+		return nil, errors.Wrap(err, "Error writing manifest list")
+	}
+
+	newSigs, err := c.createSignatures(listBlob, options)
+	if err != nil {
+		return nil, err
+	}
+	sigs = append(sigs, newSigs...)
+
+	c.Printf("Storing list signatures\n")
+	if err := c.dest.PutSignatures(ctx, sigs); err != nil {
+		return nil, errors.Wrap(err, "Error writing signatures")
+	}
+	return listBlob, nil
+}
+
+// instanceSelected returns true if instance, referenced by a manifest list, should be copied per options.
+func instanceSelected(options *Options, instance manifest.ListInstance) bool {
+	if options.ImageListSelection == CopyAllImages {
+		return true
+	}
+	for _, d := range options.Instances {
+		if d == instance.Digest {
+			return true
+		}
+	}
+	if instance.Platform != nil {
+		for _, p := range options.InstancePlatforms {
+			if p.OS == instance.Platform.OS && p.Architecture == instance.Platform.Architecture &&
+				(p.Variant == "" || p.Variant == instance.Platform.Variant) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/containers/image/manifest"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceSelected(t *testing.T) {
+	amd64 := manifest.ListInstance{Digest: digest.FromString("amd64"), Platform: &imgspecv1.Platform{OS: "linux", Architecture: "amd64"}}
+	armv7 := manifest.ListInstance{Digest: digest.FromString("armv7"), Platform: &imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}}
+	noPlatform := manifest.ListInstance{Digest: digest.FromString("noPlatform")}
+
+	for _, c := range []struct {
+		options  Options
+		instance manifest.ListInstance
+		expected bool
+	}{
+		{Options{ImageListSelection: CopyAllImages}, amd64, true},
+		{Options{ImageListSelection: CopyAllImages}, noPlatform, true},
+		{Options{ImageListSelection: CopySpecificImages}, amd64, false},
+		{Options{ImageListSelection: CopySpecificImages, Instances: []digest.Digest{armv7.Digest, amd64.Digest}}, amd64, true},
+		{Options{ImageListSelection: CopySpecificImages, Instances: []digest.Digest{armv7.Digest}}, amd64, false},
+		{Options{ImageListSelection: CopySpecificImages, Instances: []digest.Digest{noPlatform.Digest}}, noPlatform, true},
+		{Options{ImageListSelection: CopySpecificImages, InstancePlatforms: []imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}}}, amd64, true},
+		{Options{ImageListSelection: CopySpecificImages, InstancePlatforms: []imgspecv1.Platform{{OS: "windows", Architecture: "amd64"}}}, amd64, false},
+		{Options{ImageListSelection: CopySpecificImages, InstancePlatforms: []imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}}}, noPlatform, false},
+		// An empty variant matches any variant
+		{Options{ImageListSelection: CopySpecificImages, InstancePlatforms: []imgspecv1.Platform{{OS: "linux", Architecture: "arm"}}}, armv7, true},
+		{Options{ImageListSelection: CopySpecificImages, InstancePlatforms: []imgspecv1.Platform{{OS: "linux", Architecture: "arm", Variant: "v7"}}}, armv7, true},
+		{Options{ImageListSelection: CopySpecificImages, InstancePlatforms: []imgspecv1.Platform{{OS: "linux", Architecture: "arm", Variant: "v6"}}}, armv7, false},
+	} {
+		res := instanceSelected(&c.options, c.instance)
+		assert.Equal(t, c.expected, res, "%#v %s", c.options, c.instance.Digest)
+	}
+}
@@ -0,0 +1,181 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// resumeState records the layers which were copied to the destination, so that an interrupted copy can be resumed
+// without copying them again, even if their digests at the destination differ from the source (e.g. because they were compressed).
+// It is stored in Options.ResumeStateFile after every copied layer.
+// Layers may be copied concurrently, so the state is protected by a lock.
+type resumeState struct {
+	mutex sync.Mutex
+	path  string
+	data  resumeStateData
+}
+
+// resumeStateData is the format of Options.ResumeStateFile.
+type resumeStateData struct {
+	// The destination and the copy settings the blobs were copied with; the recorded blobs are only used if these match.
+	Destination string `json:"destination"`
+	Settings    string `json:"settings"`
+	// The copied blobs, indexed by their digests in the source.
+	Blobs map[digest.Digest]resumeBlob `json:"blobs"`
+}
+
+// resumeBlob records a blob which was copied to the destination.
+type resumeBlob struct {
+	Digest               digest.Digest          `json:"digest"`
+	Size                 int64                  `json:"size"`
+	MediaType            string                 `json:"mediaType,omitempty"`
+	CompressionOperation types.LayerCompression `json:"compressionOperation"`
+	CompressionAlgorithm string                 `json:"compressionAlgorithm,omitempty"` // Only set if CompressionOperation == types.Compress
+	DiffID               digest.Digest          `json:"diffID,omitempty"`               // "" if not known
+}
+
+// loadResumeState returns the state stored in path by an earlier copy to destination with settings,
+// or an empty state if path does not exist or the state was stored by a different copy.
+func loadResumeState(path, destination, settings string) (*resumeState, error) {
+	s := &resumeState{
+		path: path,
+		data: resumeStateData{
+			Destination: destination,
+			Settings:    settings,
+			Blobs:       map[digest.Digest]resumeBlob{},
+		},
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, errors.Wrapf(err, "Error reading copy state from %s", path)
+	}
+	var data resumeStateData
+	if err := json.Unmarshal(contents, &data); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing copy state in %s", path)
+	}
+	if data.Destination != destination || data.Settings != settings {
+		logrus.Debugf("Ignoring copy state in %s, recorded for %s (%s) instead of %s (%s)", path, data.Destination, data.Settings, destination, settings)
+		return s, nil
+	}
+	for srcDigest, blob := range data.Blobs {
+		s.data.Blobs[srcDigest] = blob
+	}
+	return s, nil
+}
+
+// blob returns the recorded copy of the blob with srcDigest in the source, if any.
+func (s *resumeState) blob(srcDigest digest.Digest) (resumeBlob, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	blob, ok := s.data.Blobs[srcDigest]
+	return blob, ok
+}
+
+// record records that the blob with srcDigest in the source was copied to the destination as info, with diffID (or "" if not known),
+// and stores the state.
+func (s *resumeState) record(srcDigest digest.Digest, info types.BlobInfo, diffID digest.Digest) error {
+	blob := resumeBlob{
+		Digest:               info.Digest,
+		Size:                 info.Size,
+		MediaType:            info.MediaType,
+		CompressionOperation: info.CompressionOperation,
+		DiffID:               diffID,
+	}
+	if info.CompressionAlgorithm != nil {
+		blob.CompressionAlgorithm = info.CompressionAlgorithm.Name()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Blobs[srcDigest] = blob
+	contents, err := json.Marshal(s.data)
+	if err != nil {
+		return errors.Wrap(err, "Error encoding copy state")
+	}
+	// Write to a temporary file and rename it, so that an interrupted copy does not leave a truncated state behind.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "Error storing copy state to %s", s.path)
+	}
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "Error storing copy state to %s", s.path)
+	}
+	return nil
+}
+
+// remove removes the stored state, after the copy has succeeded.
+func (s *resumeState) remove() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Error removing copy state %s", s.path)
+	}
+	return nil
+}
+
+// resumeSettings returns a description of the copy settings of c which affect how layers are copied.
+func (c *copier) resumeSettings() string {
+	settings := c.compressionFormat.Name()
+	if c.recompressLayers {
+		settings += ",recompress"
+	}
+	if c.decompressLayers {
+		settings += ",decompress"
+	}
+	return settings
+}
+
+// resumeLayer checks whether a layer with srcInfo was copied to the destination by an earlier, interrupted, copy,
+// and if so, returns a complete blobInfo of the copied layer, a value for LayerDiffIDs if diffIDsAreNeeded, and true.
+func (ic *imageCopier) resumeLayer(ctx context.Context, srcInfo types.BlobInfo) (types.BlobInfo, digest.Digest, bool, error) {
+	recorded, ok := ic.c.resumeState.blob(srcInfo.Digest)
+	if !ok || (recorded.Digest != srcInfo.Digest && !ic.canModifyManifest) ||
+		(ic.diffIDsAreNeeded && recorded.DiffID == "" && ic.c.cachedDiffID(srcInfo.Digest) == "") {
+		return types.BlobInfo{}, "", false, nil
+	}
+	haveBlob, size, err := ic.c.dest.HasBlob(ctx, types.BlobInfo{Digest: recorded.Digest, Size: recorded.Size})
+	if err != nil {
+		return types.BlobInfo{}, "", false, errors.Wrapf(err, "Error checking for blob %s at destination", recorded.Digest)
+	}
+	if !haveBlob || size != recorded.Size {
+		logrus.Debugf("Blob %s, recorded as a copy of %s, is not present at the destination", recorded.Digest, srcInfo.Digest)
+		return types.BlobInfo{}, "", false, nil
+	}
+	blobInfo, err := ic.c.dest.ReapplyBlob(ctx, types.BlobInfo{Digest: recorded.Digest, Size: size, MediaType: recorded.MediaType})
+	if err != nil {
+		return types.BlobInfo{}, "", false, errors.Wrapf(err, "Error reapplying blob %s at destination", recorded.Digest)
+	}
+	blobInfo.CompressionOperation = recorded.CompressionOperation
+	if recorded.CompressionOperation == types.Compress {
+		algorithm, err := compression.AlgorithmByName(recorded.CompressionAlgorithm)
+		if err != nil {
+			return types.BlobInfo{}, "", false, errors.Wrapf(err, "Error resuming copy of blob %s", srcInfo.Digest)
+		}
+		blobInfo.CompressionAlgorithm = &algorithm
+	}
+	if recorded.DiffID != "" {
+		ic.c.cacheDiffID(srcInfo.Digest, recorded.DiffID)
+	}
+	ic.c.Printf("Skipping blob %s, already copied as %s\n", srcInfo.Digest, recorded.Digest)
+	ic.c.reportSkippedBlob(srcInfo)
+	return blobInfo, ic.c.cachedDiffID(srcInfo.Digest), true, nil
+}
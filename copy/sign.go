@@ -1,14 +1,16 @@
 package copy
 
 import (
+	"io/ioutil"
+
 	"github.com/containers/image/signature"
 	"github.com/containers/image/transports"
 	"github.com/pkg/errors"
 )
 
-// createSignature creates a new signature of manifest using keyIdentity.
-func (c *copier) createSignature(manifest []byte, keyIdentity string) ([]byte, error) {
-	mech, err := signature.NewGPGSigningMechanism()
+// createSignature creates a new signature of manifest using keyIdentity, unlocked using passphrase if it is not empty.
+func (c *copier) createSignature(manifest []byte, keyIdentity, passphrase string) ([]byte, error) {
+	mech, err := signature.NewGPGSigningMechanismForSystemContext(c.destinationCtx)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error initializing GPG")
 	}
@@ -23,7 +25,31 @@ func (c *copier) createSignature(manifest []byte, keyIdentity string) ([]byte, e
 	}
 
 	c.Printf("Signing manifest\n")
-	newSig, err := signature.SignDockerManifest(manifest, dockerReference.String(), mech, keyIdentity)
+	newSig, err := signature.SignDockerManifestWithOptions(manifest, dockerReference.String(), mech, keyIdentity, &signature.SignOptions{Passphrase: passphrase})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating signature")
+	}
+	return newSig, nil
+}
+
+// createSigstoreSignature creates a new sigstore signature of manifest using the private key in privateKeyFile.
+func (c *copier) createSigstoreSignature(manifest []byte, privateKeyFile string) ([]byte, error) {
+	keyData, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading private key from %s", privateKeyFile)
+	}
+	privateKey, err := signature.LoadSigstorePrivateKey(keyData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error loading private key from %s", privateKeyFile)
+	}
+
+	dockerReference := c.dest.Reference().DockerReference()
+	if dockerReference == nil {
+		return nil, errors.Errorf("Cannot determine canonical Docker reference for destination %s", transports.ImageName(c.dest.Reference()))
+	}
+
+	c.Printf("Signing manifest using a sigstore signature\n")
+	newSig, err := signature.SignDockerManifestWithSigstore(manifest, dockerReference.String(), privateKey)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error creating signature")
 	}
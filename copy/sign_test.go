@@ -2,8 +2,14 @@ package copy
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/directory"
@@ -50,7 +56,7 @@ func TestCreateSignature(t *testing.T) {
 		dest:         dirDest,
 		reportWriter: ioutil.Discard,
 	}
-	_, err = c.createSignature(manifestBlob, testKeyFingerprint)
+	_, err = c.createSignature(manifestBlob, testKeyFingerprint, "")
 	assert.Error(t, err)
 
 	// Set up a docker: reference
@@ -66,17 +72,95 @@ func TestCreateSignature(t *testing.T) {
 	}
 
 	// Signing with an unknown key fails
-	_, err = c.createSignature(manifestBlob, "this key does not exist")
+	_, err = c.createSignature(manifestBlob, "this key does not exist", "")
 	assert.Error(t, err)
 
 	// Success
 	mech, err = signature.NewGPGSigningMechanism()
 	require.NoError(t, err)
 	defer mech.Close()
-	sig, err := c.createSignature(manifestBlob, testKeyFingerprint)
+	sig, err := c.createSignature(manifestBlob, testKeyFingerprint, "")
 	require.NoError(t, err)
 	verified, err := signature.VerifyDockerManifestSignature(sig, manifestBlob, "docker.io/library/busybox:latest", mech, testKeyFingerprint)
 	require.NoError(t, err)
 	assert.Equal(t, "docker.io/library/busybox:latest", verified.DockerReference)
 	assert.Equal(t, manifestDigest, verified.DockerManifestDigest)
+
+	// Success, with a passphrase
+	sig, err = c.createSignature(manifestBlob, testKeyFingerprint, "passphrase")
+	require.NoError(t, err)
+	verified, err = signature.VerifyDockerManifestSignature(sig, manifestBlob, "docker.io/library/busybox:latest", mech, testKeyFingerprint)
+	require.NoError(t, err)
+	assert.Equal(t, "docker.io/library/busybox:latest", verified.DockerReference)
+	assert.Equal(t, manifestDigest, verified.DockerManifestDigest)
+
+	// The GPG home directory can be specified in the destination SystemContext
+	emptyDir, err := ioutil.TempDir("", "signature-empty-gpg-home")
+	require.NoError(t, err)
+	defer os.RemoveAll(emptyDir)
+	c.destinationCtx = &types.SystemContext{GPGHomeDirectory: emptyDir}
+	_, err = c.createSignature(manifestBlob, testKeyFingerprint, "")
+	assert.Error(t, err)
+	os.Unsetenv("GNUPGHOME")
+	c.destinationCtx = &types.SystemContext{GPGHomeDirectory: testGPGHomeDirectory}
+	sig, err = c.createSignature(manifestBlob, testKeyFingerprint, "")
+	require.NoError(t, err)
+	verified, err = signature.VerifyDockerManifestSignature(sig, manifestBlob, "docker.io/library/busybox:latest", mech, testKeyFingerprint)
+	require.NoError(t, err)
+	assert.Equal(t, manifestDigest, verified.DockerManifestDigest)
+}
+
+func TestCreateSigstoreSignature(t *testing.T) {
+	manifestBlob := []byte("Something")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	tempDir, err := ioutil.TempDir("", "sigstore-signature")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	keyFile := filepath.Join(tempDir, "key.pem")
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	require.NoError(t, err)
+
+	// Signing a directory: reference, which does not have a DockerRefrence(), fails.
+	dirRef, err := directory.NewReference(filepath.Join(tempDir, "dir"))
+	require.NoError(t, err)
+	dirDest, err := dirRef.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dirDest.Close()
+	c := &copier{
+		dest:         dirDest,
+		reportWriter: ioutil.Discard,
+	}
+	_, err = c.createSigstoreSignature(manifestBlob, keyFile)
+	assert.Error(t, err)
+
+	// Set up a docker: reference
+	dockerRef, err := docker.ParseReference("//busybox")
+	require.NoError(t, err)
+	dockerDest, err := dockerRef.NewImageDestination(context.Background(),
+		&types.SystemContext{RegistriesDirPath: "/this/doesnt/exist", DockerPerHostCertDirPath: "/this/doesnt/exist"})
+	require.NoError(t, err)
+	defer dockerDest.Close()
+	c = &copier{
+		dest:         dockerDest,
+		reportWriter: ioutil.Discard,
+	}
+
+	// A missing or invalid key file fails
+	_, err = c.createSigstoreSignature(manifestBlob, filepath.Join(tempDir, "this/does/not/exist"))
+	assert.Error(t, err)
+	_, err = c.createSigstoreSignature(manifestBlob, "fixtures/Hello.bz2")
+	assert.Error(t, err)
+
+	// Success
+	sigBlob, err := c.createSigstoreSignature(manifestBlob, keyFile)
+	require.NoError(t, err)
+	sig, err := signature.ParseSigstoreSignature(sigBlob)
+	require.NoError(t, err)
+	assert.Equal(t, signature.SigstoreSignatureMIMEType, sig.UntrustedMIMEType)
+	assert.Contains(t, string(sig.UntrustedPayload), `"docker-reference":"docker.io/library/busybox:latest"`)
+	assert.NotEmpty(t, sig.UntrustedAnnotations[signature.SigstoreSignatureAnnotationKey])
 }
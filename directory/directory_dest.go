@@ -13,7 +13,28 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-const version = "Directory Transport Version: 1.1\n"
+// A dir: image is a directory containing:
+//  - "version": versionPrefix, the layout version and a newline (see currentLayoutVersion)
+//  - "manifest.json": the manifest
+//  - "manifest-mime-type": the MIME type of the manifest and a newline, if it was known when writing the image
+//  - a file for each blob, named by the hex part of its digest
+//  - "signature-1", "signature-2", …: the signatures, if any
+//  - if the manifest is a manifest list, for each image it references, "${hex}.manifest.json", "${hex}.manifest-mime-type",
+//    and "${hex}.signature-1", … with the same meaning as above, where ${hex} is the hex part of the digest of the image manifest
+// Directories created before the layout was versioned have no version file; they can still be read.
+const (
+	// versionPrefix is the start of the version file contents, followed by the layout version and a newline.
+	versionPrefix = "Directory Transport Version: "
+	// currentLayoutVersion is the layout version written by this implementation.
+	// Version 1.0 used a .tar suffix for blob file names; version 1.1 names blobs by the hex part of their digest only.
+	currentLayoutVersion = "1.1"
+	// legacyLayoutVersion is used for directories created before the layout was versioned, which have no version file.
+	legacyLayoutVersion = ""
+	version             = versionPrefix + currentLayoutVersion + "\n"
+)
+
+// supportedLayoutVersions are the layout versions which can be read by this implementation.
+var supportedLayoutVersions = []string{legacyLayoutVersion, "1.0", currentLayoutVersion}
 
 // ErrNotContainerImageDir indicates that the directory doesn't match the expected contents of a directory created
 // using the 'dir' transport
@@ -46,16 +67,11 @@ func newImageDestination(ref dirReference, compress bool) (types.ImageDestinatio
 			if err != nil {
 				return nil, errors.Wrapf(err, "error checking if path exists %q", d.ref.versionPath())
 			}
-			if versionExists {
-				contents, err := ioutil.ReadFile(d.ref.versionPath())
-				if err != nil {
-					return nil, err
-				}
-				// check if contents of version file is what we expect it to be
-				if string(contents) != version {
-					return nil, ErrNotContainerImageDir
-				}
-			} else {
+			if !versionExists {
+				return nil, ErrNotContainerImageDir
+			}
+			// check if contents of version file is what we expect it to be
+			if _, err := d.ref.readLayoutVersion(); err != nil {
 				return nil, ErrNotContainerImageDir
 			}
 			// delete directory contents so that only one image is in the directory at a time
@@ -124,6 +140,11 @@ func (d *dirImageDestination) IgnoresEmbeddedDockerReference() bool {
 	return false // N/A, DockerReference() returns nil.
 }
 
+// HasThreadSafePutBlob indicates whether PutBlob, HasBlob and ReapplyBlob can be called concurrently.
+func (d *dirImageDestination) HasThreadSafePutBlob() bool {
+	return true // Each blob is written to a separate temporary file, and renamed into place.
+}
+
 // PutBlob writes contents of stream and returns data representing the result (with all data filled in).
 // inputInfo.Digest can be optionally provided if known; it is not mandatory for the implementation to verify it.
 // inputInfo.Size is the expected length of stream, if known.
@@ -197,7 +218,33 @@ func (d *dirImageDestination) ReapplyBlob(ctx context.Context, info types.BlobIn
 // If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
 // but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
 func (d *dirImageDestination) PutManifest(ctx context.Context, manifest []byte) error {
-	return ioutil.WriteFile(d.ref.manifestPath(), manifest, 0644)
+	return d.PutManifestWithMIMEType(ctx, manifest, "")
+}
+
+// PutManifestWithMIMEType is like PutManifest, but also records mimeType, if not "", so that the source
+// does not have to guess it from the manifest contents.
+func (d *dirImageDestination) PutManifestWithMIMEType(ctx context.Context, manifest []byte, mimeType string) error {
+	return writeManifest(d.ref.manifestPath(), d.ref.manifestMIMETypePath(), manifest, mimeType)
+}
+
+// PutInstanceManifest writes manifest, with MIME type mimeType (which may be "" if unknown), of an image referenced by a manifest list,
+// to the destination. instanceDigest is the digest of manifest.
+func (d *dirImageDestination) PutInstanceManifest(ctx context.Context, manifest []byte, mimeType string, instanceDigest digest.Digest) error {
+	return writeManifest(d.ref.instanceManifestPath(instanceDigest), d.ref.instanceManifestMIMETypePath(instanceDigest), manifest, mimeType)
+}
+
+// writeManifest writes manifest to manifestPath, and mimeType, if not "", to mimeTypePath.
+func writeManifest(manifestPath, mimeTypePath string, manifest []byte, mimeType string) error {
+	if err := ioutil.WriteFile(manifestPath, manifest, 0644); err != nil {
+		return err
+	}
+	if mimeType == "" {
+		if err := os.Remove(mimeTypePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(mimeTypePath, []byte(mimeType+"\n"), 0644)
 }
 
 func (d *dirImageDestination) PutSignatures(ctx context.Context, signatures [][]byte) error {
@@ -209,6 +256,16 @@ func (d *dirImageDestination) PutSignatures(ctx context.Context, signatures [][]
 	return nil
 }
 
+// PutInstanceSignatures writes signatures of an image referenced by a manifest list, with manifest digest instanceDigest, to the destination.
+func (d *dirImageDestination) PutInstanceSignatures(ctx context.Context, signatures [][]byte, instanceDigest digest.Digest) error {
+	for i, sig := range signatures {
+		if err := ioutil.WriteFile(d.ref.instanceSignaturePath(instanceDigest, i), sig, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Commit marks the process of storing the image as successful and asks for the image to be persisted.
 // WARNING: This does not have any transactional semantics:
 // - Uploaded data MAY be visible to others before Commit() is called
@@ -5,21 +5,26 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/containers/image/manifest"
 	"github.com/containers/image/types"
 	"github.com/opencontainers/go-digest"
-	"github.com/pkg/errors"
 )
 
 type dirImageSource struct {
-	ref dirReference
+	ref           dirReference
+	layoutVersion string
 }
 
 // newImageSource returns an ImageSource reading from an existing directory.
 // The caller must call .Close() on the returned ImageSource.
-func newImageSource(ref dirReference) types.ImageSource {
-	return &dirImageSource{ref}
+func newImageSource(ref dirReference) (types.ImageSource, error) {
+	layoutVersion, err := ref.readLayoutVersion()
+	if err != nil {
+		return nil, err
+	}
+	return &dirImageSource{ref: ref, layoutVersion: layoutVersion}, nil
 }
 
 // Reference returns the reference used to set up this source, _as specified by the user_
@@ -38,19 +43,32 @@ func (s *dirImageSource) Close() error {
 // If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
 // this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
 func (s *dirImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	manifestPath, mimeTypePath := s.ref.manifestPath(), s.ref.manifestMIMETypePath()
 	if instanceDigest != nil {
-		return nil, "", errors.Errorf(`Getting target manifest not supported by "dir:"`)
+		manifestPath, mimeTypePath = s.ref.instanceManifestPath(*instanceDigest), s.ref.instanceManifestMIMETypePath(*instanceDigest)
 	}
-	m, err := ioutil.ReadFile(s.ref.manifestPath())
+	m, err := ioutil.ReadFile(manifestPath)
 	if err != nil {
 		return nil, "", err
 	}
-	return m, manifest.GuessMIMEType(m), err
+	mimeType, err := ioutil.ReadFile(mimeTypePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, "", err
+		}
+		return m, manifest.GuessMIMEType(m), nil
+	}
+	return m, strings.TrimSpace(string(mimeType)), nil
 }
 
 // GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
 func (s *dirImageSource) GetBlob(ctx context.Context, info types.BlobInfo) (io.ReadCloser, int64, error) {
-	r, err := os.Open(s.ref.layerPath(info.Digest))
+	path := s.ref.layerPath(info.Digest)
+	r, err := os.Open(path)
+	if err != nil && os.IsNotExist(err) && (s.layoutVersion == legacyLayoutVersion || s.layoutVersion == "1.0") {
+		// Layouts before 1.1 used a .tar suffix for blob file names.
+		r, err = os.Open(path + ".tar")
+	}
 	if err != nil {
 		return nil, -1, err
 	}
@@ -61,17 +79,36 @@ func (s *dirImageSource) GetBlob(ctx context.Context, info types.BlobInfo) (io.R
 	return r, fi.Size(), nil
 }
 
+// BlobSize returns the size of the blob with info, or -1 if it can not be determined.
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+func (s *dirImageSource) BlobSize(ctx context.Context, info types.BlobInfo) (int64, error) {
+	path := s.ref.layerPath(info.Digest)
+	fi, err := os.Stat(path)
+	if err != nil && os.IsNotExist(err) && (s.layoutVersion == legacyLayoutVersion || s.layoutVersion == "1.0") {
+		// Layouts before 1.1 used a .tar suffix for blob file names.
+		fi, err = os.Stat(path + ".tar")
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, nil
+		}
+		return -1, err
+	}
+	return fi.Size(), nil
+}
+
 // GetSignatures returns the image's signatures.  It may use a remote (= slow) service.
 // If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
 // (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
 // (e.g. if the source never returns manifest lists).
 func (s *dirImageSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
-	if instanceDigest != nil {
-		return nil, errors.Errorf(`Manifests lists are not supported by "dir:"`)
-	}
 	signatures := [][]byte{}
 	for i := 0; ; i++ {
-		signature, err := ioutil.ReadFile(s.ref.signaturePath(i))
+		path := s.ref.signaturePath(i)
+		if instanceDigest != nil {
+			path = s.ref.instanceSignaturePath(*instanceDigest, i)
+		}
+		signature, err := ioutil.ReadFile(path)
 		if err != nil {
 			if os.IsNotExist(err) {
 				break
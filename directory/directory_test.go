@@ -3,8 +3,10 @@ package directory
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/manifest"
@@ -47,13 +49,45 @@ func TestGetPutManifest(t *testing.T) {
 	assert.Equal(t, man, m)
 	assert.Equal(t, "", mt)
 
-	// Non-default instances are not supported
+	// Instances which were not written can not be read
 	md, err := manifest.Digest(man)
 	require.NoError(t, err)
 	_, _, err = src.GetManifest(context.Background(), &md)
 	assert.Error(t, err)
 }
 
+func TestGetPutManifestWithMIMEType(t *testing.T) {
+	ref, tmpDir := refToTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	man := []byte("test-manifest")
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	mimeDest, ok := dest.(types.ManifestMIMETypeDestination)
+	require.True(t, ok)
+	err = mimeDest.PutManifestWithMIMEType(context.Background(), man, manifest.DockerV2Schema2MediaType)
+	assert.NoError(t, err)
+	err = dest.Commit(context.Background())
+	assert.NoError(t, err)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	m, mt, err := src.GetManifest(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, man, m)
+	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
+
+	// Writing a manifest without a MIME type drops the recorded one
+	err = dest.PutManifest(context.Background(), man)
+	assert.NoError(t, err)
+	m, mt, err = src.GetManifest(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, man, m)
+	assert.Equal(t, "", mt)
+}
+
 func TestGetPutBlob(t *testing.T) {
 	ref, tmpDir := refToTempDir(t)
 	defer os.RemoveAll(tmpDir)
@@ -80,6 +114,116 @@ func TestGetPutBlob(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, blob, b)
 	assert.Equal(t, int64(len(blob)), size)
+
+	size, err = src.(types.BlobSizeSource).BlobSize(context.Background(), types.BlobInfo{Digest: info.Digest, Size: -1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(blob)), size)
+	size, err = src.(types.BlobSizeSource).BlobSize(context.Background(), types.BlobInfo{Digest: digest.FromString("missing"), Size: -1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), size)
+}
+
+func TestGetBlobOlderLayouts(t *testing.T) {
+	blob := []byte("test-blob")
+	blobDigest := digest.FromBytes(blob)
+	for _, c := range []struct {
+		versionFile string // "" if there should be no version file
+		suffix      string
+	}{
+		{"", ""},
+		{"", ".tar"},
+		{"Directory Transport Version: 1.0\n", ".tar"},
+		{"Directory Transport Version: 1.1\n", ""},
+	} {
+		ref, tmpDir := refToTempDir(t)
+		defer os.RemoveAll(tmpDir)
+		if c.versionFile != "" {
+			err := ioutil.WriteFile(filepath.Join(tmpDir, "version"), []byte(c.versionFile), 0644)
+			require.NoError(t, err)
+		}
+		err := ioutil.WriteFile(filepath.Join(tmpDir, blobDigest.Hex()+c.suffix), blob, 0644)
+		require.NoError(t, err)
+
+		src, err := ref.NewImageSource(context.Background(), nil)
+		require.NoError(t, err, c.versionFile)
+		rc, size, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1})
+		require.NoError(t, err, c.versionFile)
+		b, err := ioutil.ReadAll(rc)
+		assert.NoError(t, err)
+		assert.Equal(t, blob, b)
+		assert.Equal(t, int64(len(blob)), size)
+		size, err = src.(types.BlobSizeSource).BlobSize(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1})
+		require.NoError(t, err, c.versionFile)
+		assert.Equal(t, int64(len(blob)), size)
+		rc.Close()
+		src.Close()
+	}
+
+	// The .tar suffix is not used with the current layout
+	ref, tmpDir := refToTempDir(t)
+	defer os.RemoveAll(tmpDir)
+	err := ioutil.WriteFile(filepath.Join(tmpDir, "version"), []byte("Directory Transport Version: 1.1\n"), 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(tmpDir, blobDigest.Hex()+".tar"), blob, 0644)
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1})
+	assert.Error(t, err)
+}
+
+func TestNewImageSourceUnsupportedVersion(t *testing.T) {
+	for _, versionFile := range []string{
+		"Directory Transport Version: 2.0\n",
+		"Directory Transport Version: 1.1",
+		"Directory Transport Version: \n",
+		"something else\n",
+	} {
+		ref, tmpDir := refToTempDir(t)
+		defer os.RemoveAll(tmpDir)
+		err := ioutil.WriteFile(filepath.Join(tmpDir, "version"), []byte(versionFile), 0644)
+		require.NoError(t, err)
+
+		_, err = ref.NewImageSource(context.Background(), nil)
+		assert.Error(t, err, versionFile)
+		_, err = ref.NewImage(context.Background(), nil)
+		assert.Error(t, err, versionFile)
+	}
+}
+
+func TestNewImageDestinationOverwrite(t *testing.T) {
+	for _, c := range []struct {
+		versionFile string // "" if there should be no version file
+		success     bool
+	}{
+		{"", false},
+		{"Directory Transport Version: 1.0\n", true},
+		{"Directory Transport Version: 1.1\n", true},
+		{"Directory Transport Version: 2.0\n", false},
+	} {
+		ref, tmpDir := refToTempDir(t)
+		defer os.RemoveAll(tmpDir)
+		if c.versionFile != "" {
+			err := ioutil.WriteFile(filepath.Join(tmpDir, "version"), []byte(c.versionFile), 0644)
+			require.NoError(t, err)
+		}
+		err := ioutil.WriteFile(filepath.Join(tmpDir, "manifest.json"), []byte("{}"), 0644)
+		require.NoError(t, err)
+
+		dest, err := ref.NewImageDestination(context.Background(), nil)
+		if !c.success {
+			assert.Equal(t, ErrNotContainerImageDir, err, c.versionFile)
+			continue
+		}
+		require.NoError(t, err, c.versionFile)
+		dest.Close()
+		_, err = os.Stat(filepath.Join(tmpDir, "manifest.json"))
+		assert.True(t, os.IsNotExist(err), c.versionFile)
+		contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "version"))
+		require.NoError(t, err)
+		assert.Equal(t, "Directory Transport Version: 1.1\n", string(contents))
+	}
 }
 
 // readerFromFunc allows implementing Reader by any function, e.g. a closure.
@@ -160,11 +304,65 @@ func TestGetPutSignatures(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, signatures, sigs)
 
-	// Non-default instances are not supported
+	// The signatures of the primary manifest are not returned for instances
 	md, err := manifest.Digest(man)
 	require.NoError(t, err)
-	_, err = src.GetSignatures(context.Background(), &md)
-	assert.Error(t, err)
+	sigs, err = src.GetSignatures(context.Background(), &md)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{}, sigs)
+}
+
+func TestGetPutInstances(t *testing.T) {
+	ref, tmpDir := refToTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	listDest, ok := dest.(types.ManifestListDestination)
+	require.True(t, ok)
+	instances := map[digest.Digest][]byte{}
+	instanceSigs := map[digest.Digest][][]byte{}
+	for i, mimeType := range []string{manifest.DockerV2Schema2MediaType, ""} {
+		man := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","instance":%d}`, manifest.DockerV2Schema2MediaType, i))
+		md, err := manifest.Digest(man)
+		require.NoError(t, err)
+		sigs := [][]byte{[]byte(fmt.Sprintf("sig%d", i))}
+		err = listDest.PutInstanceManifest(context.Background(), man, mimeType, md)
+		require.NoError(t, err)
+		err = listDest.PutInstanceSignatures(context.Background(), sigs, md)
+		require.NoError(t, err)
+		instances[md] = man
+		instanceSigs[md] = sigs
+	}
+	list := []byte("test-list")
+	err = dest.(types.ManifestMIMETypeDestination).PutManifestWithMIMEType(context.Background(), list, manifest.DockerV2ListMediaType)
+	require.NoError(t, err)
+	listSigs := [][]byte{[]byte("list-sig")}
+	err = dest.PutSignatures(context.Background(), listSigs)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background())
+	require.NoError(t, err)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	m, mt, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, list, m)
+	assert.Equal(t, manifest.DockerV2ListMediaType, mt)
+	sigs, err := src.GetSignatures(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, listSigs, sigs)
+	for md, man := range instances {
+		m, mt, err := src.GetManifest(context.Background(), &md)
+		require.NoError(t, err)
+		assert.Equal(t, man, m)
+		assert.Equal(t, manifest.DockerV2Schema2MediaType, mt) // Either recorded, or guessed
+		sigs, err := src.GetSignatures(context.Background(), &md)
+		require.NoError(t, err)
+		assert.Equal(t, instanceSigs[md], sigs)
+	}
 }
 
 func TestSourceReference(t *testing.T) {
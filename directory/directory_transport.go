@@ -3,6 +3,8 @@ package directory
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -140,14 +142,22 @@ func (ref dirReference) PolicyConfigurationNamespaces() []string {
 // verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
 // WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
 func (ref dirReference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
-	src := newImageSource(ref)
-	return image.FromSource(ctx, sys, src)
+	src, err := newImageSource(ref)
+	if err != nil {
+		return nil, err
+	}
+	img, err := image.FromSource(ctx, sys, src)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return img, nil
 }
 
 // NewImageSource returns a types.ImageSource for this reference.
 // The caller must call .Close() on the returned ImageSource.
 func (ref dirReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
-	return newImageSource(ref), nil
+	return newImageSource(ref)
 }
 
 // NewImageDestination returns a types.ImageDestination for this reference.
@@ -170,6 +180,11 @@ func (ref dirReference) manifestPath() string {
 	return filepath.Join(ref.path, "manifest.json")
 }
 
+// manifestMIMETypePath returns a path for the file recording the manifest MIME type within a directory using our conventions.
+func (ref dirReference) manifestMIMETypePath() string {
+	return filepath.Join(ref.path, "manifest-mime-type")
+}
+
 // layerPath returns a path for a layer tarball within a directory using our conventions.
 func (ref dirReference) layerPath(digest digest.Digest) string {
 	// FIXME: Should we keep the digest identification?
@@ -181,7 +196,51 @@ func (ref dirReference) signaturePath(index int) string {
 	return filepath.Join(ref.path, fmt.Sprintf("signature-%d", index+1))
 }
 
+// instanceManifestPath returns a path for the manifest of an image referenced by a manifest list, with manifest digest instanceDigest,
+// within a directory using our conventions.
+func (ref dirReference) instanceManifestPath(instanceDigest digest.Digest) string {
+	return filepath.Join(ref.path, instanceDigest.Hex()+".manifest.json")
+}
+
+// instanceManifestMIMETypePath returns a path for the file recording the manifest MIME type of an image referenced by a manifest list,
+// with manifest digest instanceDigest, within a directory using our conventions.
+func (ref dirReference) instanceManifestMIMETypePath(instanceDigest digest.Digest) string {
+	return filepath.Join(ref.path, instanceDigest.Hex()+".manifest-mime-type")
+}
+
+// instanceSignaturePath returns a path for a signature of an image referenced by a manifest list, with manifest digest instanceDigest,
+// within a directory using our conventions.
+func (ref dirReference) instanceSignaturePath(instanceDigest digest.Digest, index int) string {
+	return filepath.Join(ref.path, fmt.Sprintf("%s.signature-%d", instanceDigest.Hex(), index+1))
+}
+
 // versionPath returns a path for the version file within a directory using our conventions.
 func (ref dirReference) versionPath() string {
 	return filepath.Join(ref.path, "version")
 }
+
+// readLayoutVersion returns the layout version recorded in the version file of the directory,
+// or legacyLayoutVersion if there is no version file.
+// It fails if the version file is invalid or the version is not one of supportedLayoutVersions.
+func (ref dirReference) readLayoutVersion() (string, error) {
+	contents, err := ioutil.ReadFile(ref.versionPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return legacyLayoutVersion, nil
+		}
+		return "", err
+	}
+	s := string(contents)
+	if !strings.HasPrefix(s, versionPrefix) || !strings.HasSuffix(s, "\n") {
+		return "", errors.Errorf("Invalid version file %s", ref.versionPath())
+	}
+	v := strings.TrimSuffix(strings.TrimPrefix(s, versionPrefix), "\n")
+	if v != legacyLayoutVersion { // A version file must not claim the legacy layout
+		for _, supported := range supportedLayoutVersions {
+			if v == supported {
+				return v, nil
+			}
+		}
+	}
+	return "", errors.Errorf("Unsupported dir: layout version %q in %s, this implementation supports at most %s", v, ref.path, currentLayoutVersion)
+}
@@ -214,6 +214,14 @@ func TestReferenceManifestPath(t *testing.T) {
 	assert.Equal(t, tmpDir+"/manifest.json", dirRef.manifestPath())
 }
 
+func TestReferenceManifestMIMETypePath(t *testing.T) {
+	ref, tmpDir := refToTempDir(t)
+	defer os.RemoveAll(tmpDir)
+	dirRef, ok := ref.(dirReference)
+	require.True(t, ok)
+	assert.Equal(t, tmpDir+"/manifest-mime-type", dirRef.manifestMIMETypePath())
+}
+
 func TestReferenceLayerPath(t *testing.T) {
 	const hex = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
 
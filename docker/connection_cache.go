@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// registryConnectionLifetime is the time a registryConnection is shared after the registry was pinged.
+const registryConnectionLifetime = 5 * time.Minute
+
+// registryConnectionKey identifies a registryConnection in registryConnectionCache: dockerClient instances share
+// a connection only if they use the same credentials and the same TLS and proxy configuration.
+type registryConnectionKey struct {
+	registry string
+	username string
+	// A digest of the password and identity token, so that connections are never shared between different credentials,
+	// without keeping the secrets in the cache; see secretsDigest.
+	secretsDigest     digest.Digest
+	certDir           string
+	clientCertificate types.DockerClientCertificate
+	insecure          bool
+	proxy             string // A description of the proxy configuration; see dockerClient.useProxy.
+}
+
+// registryConnection is the state of a dockerClient which can be shared by other dockerClient instances
+// for the same registry: the HTTP client (with its open connections), and the detected registry properties.
+type registryConnection struct {
+	client             *http.Client
+	tlsClientConfig    *tls.Config
+	scheme             string
+	challenges         []challenge
+	supportsSignatures bool
+	expiration         time.Time
+}
+
+// registryConnectionCache contains the connections set up by all dockerClient instances, so that e.g. an image source
+// and an image destination for the same registry reuse connections and ping results instead of setting up their own.
+var registryConnectionCache = struct {
+	mutex       sync.Mutex
+	connections map[registryConnectionKey]registryConnection
+}{connections: map[registryConnectionKey]registryConnection{}}
+
+// newRegistryConnectionKey returns a registryConnectionKey for a connection to hostPort using creds,
+// with the TLS configuration from certDir and sys, and the proxy configuration from sys.
+// The insecure and proxy members are later updated by dockerClient.allowInsecure and dockerClient.useProxy.
+func newRegistryConnectionKey(sys *types.SystemContext, hostPort, certDir string, creds types.DockerAuthConfig) registryConnectionKey {
+	key := registryConnectionKey{
+		registry:      hostPort,
+		username:      creds.Username,
+		secretsDigest: secretsDigest(creds.Password, creds.IdentityToken),
+		certDir:       certDir,
+	}
+	if sys != nil {
+		key.clientCertificate = sys.DockerClientCertificates[hostPort]
+		if sys.DockerProxy != nil {
+			key.proxy = fmt.Sprintf("system context: %#v", *sys.DockerProxy)
+		}
+	}
+	return key
+}
+
+// getCachedRegistryConnection returns a connection for key which has not expired at now, if any.
+func getCachedRegistryConnection(key registryConnectionKey, now time.Time) (registryConnection, bool) {
+	registryConnectionCache.mutex.Lock()
+	defer registryConnectionCache.mutex.Unlock()
+	conn, ok := registryConnectionCache.connections[key]
+	if !ok || now.After(conn.expiration) {
+		return registryConnection{}, false
+	}
+	return conn, true
+}
+
+// cacheRegistryConnection records conn for key, and drops expired connections as of now.
+func cacheRegistryConnection(key registryConnectionKey, conn registryConnection, now time.Time) {
+	registryConnectionCache.mutex.Lock()
+	defer registryConnectionCache.mutex.Unlock()
+	for k, cached := range registryConnectionCache.connections {
+		if now.After(cached.expiration) {
+			delete(registryConnectionCache.connections, k)
+			closeIdleConnections(cached.client)
+		}
+	}
+	if previous, ok := registryConnectionCache.connections[key]; ok && previous.client != conn.client {
+		closeIdleConnections(previous.client)
+	}
+	conn.expiration = now.Add(registryConnectionLifetime)
+	registryConnectionCache.connections[key] = conn
+}
+
+// isCachedRegistryClient returns true if client is shared through a registryConnection which has not expired at now.
+func isCachedRegistryClient(client *http.Client, now time.Time) bool {
+	registryConnectionCache.mutex.Lock()
+	defer registryConnectionCache.mutex.Unlock()
+	for _, conn := range registryConnectionCache.connections {
+		if conn.client == client && !now.After(conn.expiration) {
+			return true
+		}
+	}
+	return false
+}
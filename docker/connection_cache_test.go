@@ -0,0 +1,113 @@
+package docker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/image/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryConnectionCache(t *testing.T) {
+	now := time.Now()
+	creds := types.DockerAuthConfig{Username: "user", Password: "password"}
+	key := newRegistryConnectionKey(nil, "registry.example.com", "/etc/docker/certs.d/registry.example.com", creds)
+	conn := registryConnection{client: &http.Client{}, scheme: "https", challenges: []challenge{{Scheme: "bearer"}}}
+
+	_, ok := getCachedRegistryConnection(key, now)
+	assert.False(t, ok)
+	cacheRegistryConnection(key, conn, now)
+	res, ok := getCachedRegistryConnection(key, now.Add(registryConnectionLifetime-time.Second))
+	require.True(t, ok)
+	assert.True(t, res.client == conn.client)
+	assert.Equal(t, conn.scheme, res.scheme)
+	assert.Equal(t, conn.challenges, res.challenges)
+	assert.True(t, isCachedRegistryClient(conn.client, now))
+	assert.False(t, isCachedRegistryClient(&http.Client{}, now))
+	// Expired connections are not used
+	_, ok = getCachedRegistryConnection(key, now.Add(registryConnectionLifetime+time.Second))
+	assert.False(t, ok)
+	assert.False(t, isCachedRegistryClient(conn.client, now.Add(registryConnectionLifetime+time.Second)))
+
+	// Connections are not shared between different registries, credentials, or TLS and proxy configurations
+	insecure := key
+	insecure.insecure = true
+	proxied := key
+	proxied.proxy = "registry: http://proxy.example.com:3128"
+	for _, other := range []registryConnectionKey{
+		newRegistryConnectionKey(nil, "other.example.com", "/etc/docker/certs.d/registry.example.com", creds),
+		newRegistryConnectionKey(nil, "registry.example.com", "/etc/docker/certs.d/other.example.com", creds),
+		newRegistryConnectionKey(nil, "registry.example.com", "/etc/docker/certs.d/registry.example.com", types.DockerAuthConfig{Username: "other", Password: "password"}),
+		newRegistryConnectionKey(nil, "registry.example.com", "/etc/docker/certs.d/registry.example.com", types.DockerAuthConfig{Username: "user", Password: "other"}),
+		newRegistryConnectionKey(nil, "registry.example.com", "/etc/docker/certs.d/registry.example.com", types.DockerAuthConfig{IdentityToken: "identity"}),
+		newRegistryConnectionKey(&types.SystemContext{
+			DockerClientCertificates: map[string]types.DockerClientCertificate{"registry.example.com": {CertDirPath: "/path/to/certs"}},
+		}, "registry.example.com", "/etc/docker/certs.d/registry.example.com", creds),
+		newRegistryConnectionKey(&types.SystemContext{
+			DockerProxy: &types.DockerProxyConfig{HTTPSProxy: "http://proxy.example.com:3128"},
+		}, "registry.example.com", "/etc/docker/certs.d/registry.example.com", creds),
+		insecure,
+		proxied,
+	} {
+		_, ok := getCachedRegistryConnection(other, now)
+		assert.False(t, ok, "%#v", other)
+	}
+	assert.NotContains(t, string(key.secretsDigest), "password")
+
+	// Expired connections are dropped when caching new ones
+	otherKey := newRegistryConnectionKey(nil, "other.example.com", "/etc/docker/certs.d/other.example.com", creds)
+	cacheRegistryConnection(otherKey, conn, now.Add(registryConnectionLifetime+time.Second))
+	registryConnectionCache.mutex.Lock()
+	_, ok = registryConnectionCache.connections[key]
+	registryConnectionCache.mutex.Unlock()
+	assert.False(t, ok)
+}
+
+func TestDockerClientSharesRegistryConnection(t *testing.T) {
+	pings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			pings++
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "registry-connection")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	newClient := func(repo string, write bool, actions string, creds *types.DockerAuthConfig) *dockerClient {
+		sys := &types.SystemContext{
+			SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+			RegistriesDirPath:           tmpDir,
+			DockerInsecureSkipTLSVerify: true,
+			DockerAuthConfig:            creds,
+		}
+		ref, err := ParseReference("//" + server.Listener.Addr().String() + "/" + repo + ":tag")
+		require.NoError(t, err)
+		c, err := newDockerClientFromRef(sys, ref.(dockerReference), write, actions)
+		require.NoError(t, err)
+		err = c.detectProperties(context.Background())
+		require.NoError(t, err)
+		return c
+	}
+
+	// A source and a destination for the same registry share the HTTP client and ping results…
+	src := newClient("ns/src", false, "pull", nil)
+	dest := newClient("ns/dest", true, "pull,push", nil)
+	assert.Equal(t, 1, pings)
+	assert.True(t, src.client == dest.client)
+	assert.Equal(t, "http", dest.scheme)
+	assert.Equal(t, authScope{remoteName: "ns/dest", actions: "pull,push"}, dest.scope)
+	// … but not when using different credentials
+	other := newClient("ns/dest", true, "pull,push", &types.DockerAuthConfig{Username: "user", Password: "password"})
+	assert.Equal(t, 2, pings)
+	assert.False(t, src.client == other.client)
+}
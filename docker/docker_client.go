@@ -6,12 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/containers/image/docker/reference"
@@ -19,11 +22,12 @@ import (
 	"github.com/containers/image/pkg/docker/config"
 	"github.com/containers/image/pkg/tlsclientconfig"
 	"github.com/containers/image/types"
-	"github.com/docker/distribution/registry/client"
+	"github.com/containers/storage/pkg/homedir"
 	"github.com/docker/go-connections/tlsconfig"
 	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpproxy"
 )
 
 const (
@@ -34,6 +38,7 @@ const (
 	resolvedPingV2URL       = "%s://%s/v2/"
 	resolvedPingV1URL       = "%s://%s/v1/_ping"
 	tagsPath                = "/v2/%s/tags/list"
+	catalogPath             = "/v2/_catalog"
 	manifestPath            = "/v2/%s/manifests/%s"
 	blobsPath               = "/v2/%s/blobs/%s"
 	blobUploadPath          = "/v2/%s/blobs/uploads/"
@@ -41,8 +46,15 @@ const (
 
 	minimumTokenLifetimeSeconds = 60
 
+	idleConnectionTimeout = 90 * time.Second // How long an unused connection to a registry is kept open
+
+	defaultMaxRetries      = 3               // Used if types.SystemContext.DockerRegistryMaxRetries is 0
+	defaultRateLimitBudget = 1 * time.Minute // Used if types.SystemContext.DockerRegistryRateLimitBudget is 0
+
 	extensionSignatureSchemaVersion = 2        // extensionSignature.Version
 	extensionSignatureTypeAtomic    = "atomic" // extensionSignature.Type
+
+	oauth2ClientID = "containers/image" // The client_id used in OAuth2 token requests
 )
 
 var (
@@ -52,8 +64,31 @@ var (
 	// ErrUnauthorizedForCredentials is returned when the status code returned is 401
 	ErrUnauthorizedForCredentials = errors.New("unable to retrieve auth token: invalid username/password")
 	systemPerHostCertDirPaths     = [2]string{"/etc/containers/certs.d", "/etc/docker/certs.d"}
+	// userPerHostCertDirPath is relative to the user's home directory, and preferred to systemPerHostCertDirPaths
+	// (so that users without write access to /etc can configure certificates).
+	userPerHostCertDirPath = filepath.FromSlash(".config/containers/certs.d")
+
+	// retryBaseDelay is the delay before the first retry of a request; it doubles with every further retry, up to retryMaxDelay.
+	// These are variables only to allow tests to replace them.
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
 )
 
+// TooManyRequestsError is returned when a registry rate-limits requests (responding with 429 Too Many Requests),
+// and waiting for the rate limit to expire would exceed types.SystemContext.DockerRegistryRateLimitBudget.
+type TooManyRequestsError struct {
+	Registry string
+	// RetryAfter is the delay requested by the registry, or 0 if the registry did not specify it.
+	RetryAfter time.Duration
+}
+
+func (e TooManyRequestsError) Error() string {
+	if e.RetryAfter != 0 {
+		return fmt.Sprintf("too many requests to registry %s, retry after %s", e.Registry, e.RetryAfter)
+	}
+	return fmt.Sprintf("too many requests to registry %s", e.Registry)
+}
+
 // extensionSignature and extensionSignatureList come from github.com/openshift/origin/pkg/dockerregistry/server/signaturedispatcher.go:
 // signature represents a Docker image signature.
 type extensionSignature struct {
@@ -76,28 +111,49 @@ type bearerToken struct {
 }
 
 // dockerClient is configuration for dealing with a single Docker registry.
+// After it is set up, it can be used concurrently from several goroutines.
 type dockerClient struct {
 	// The following members are set by newDockerClient and do not change afterwards.
 	sys           *types.SystemContext
 	registry      string
 	username      string
 	password      string
+	identityToken string // An OAuth2 refresh token; if not "", used instead of username and password to obtain bearer tokens
 	client        *http.Client
 	signatureBase signatureStorageBase
-	scope         authScope
+	// Store sigstore signatures in the registry, attached to images; see sigstore_attachments.go.
+	useSigstoreAttachments bool
+	// Read Notation signatures attached to images in the registry; see notation_signatures.go.
+	useNotationSignatures bool
+	scope                 authScope
+	// The TLS configuration used by client; see allowInsecure.
+	tlsClientConfig *tls.Config
+	// The proxy configuration used by client and for token requests; see useProxy.
+	proxy func(*http.Request) (*url.URL, error)
+	// Identifies the state shared with other dockerClient instances through registryConnectionCache; see detectProperties.
+	// The zero value (for clients not created by newDockerClientWithDetails) means the state is not shared.
+	connectionKey registryConnectionKey
+	// Allow contacting the registry over HTTP, or HTTPS with failed TLS verification.
+	insecureSkipTLSVerify bool
+	// HTTP clients for lookaside signature storage servers, indexed by host[:port]; see signatureStorageClient.
+	signatureStorageClientsMutex sync.Mutex
+	signatureStorageClients      map[string]*http.Client
+	// Warnings from Warning response headers which have already been reported; see reportResponseWarnings.
+	reportedWarningsMutex sync.Mutex
+	reportedWarnings      map[string]struct{}
+	// Protects the detected registry properties, and client, while detectProperties() is running.
+	detectPropertiesMutex sync.Mutex
 	// The following members are detected registry properties:
 	// They are set after a successful detectProperties(), and never change afterwards.
 	scheme             string // Empty value also used to indicate detectProperties() has not yet succeeded.
 	challenges         []challenge
 	supportsSignatures bool
-	// The following members are private state for setupRequestAuth, both are valid if token != nil.
-	token           *bearerToken
-	tokenExpiration time.Time
 }
 
 type authScope struct {
-	remoteName string
-	actions    string
+	resourceType string // "repository" if empty
+	remoteName   string
+	actions      string
 }
 
 // sendAuth determines whether we need authentication for v2 or v1 endpoint.
@@ -144,6 +200,8 @@ func serverDefault() *tls.Config {
 }
 
 // dockerCertDir returns a path to a directory to be consumed by tlsclientconfig.SetupCertificates() depending on ctx and hostPort.
+// The first existing per-host directory is used, from ~/.config/containers/certs.d and then the system-wide certs.d directories.
+// If sys.RootForImplicitAbsolutePaths is set, only the system-wide directories within it are used.
 func dockerCertDir(sys *types.SystemContext, hostPort string) (string, error) {
 	if sys != nil && sys.DockerCertPath != "" {
 		return sys.DockerCertPath, nil
@@ -152,17 +210,21 @@ func dockerCertDir(sys *types.SystemContext, hostPort string) (string, error) {
 		return filepath.Join(sys.DockerPerHostCertDirPath, hostPort), nil
 	}
 
-	var (
-		hostCertDir     string
-		fullCertDirPath string
-	)
+	hostCertDirs := []string{}
+	// The home directory is outside of sys.RootForImplicitAbsolutePaths.
+	if home := homedir.Get(); home != "" && (sys == nil || sys.RootForImplicitAbsolutePaths == "") {
+		hostCertDirs = append(hostCertDirs, filepath.Join(home, userPerHostCertDirPath))
+	}
 	for _, systemPerHostCertDirPath := range systemPerHostCertDirPaths {
 		if sys != nil && sys.RootForImplicitAbsolutePaths != "" {
-			hostCertDir = filepath.Join(sys.RootForImplicitAbsolutePaths, systemPerHostCertDirPath)
+			hostCertDirs = append(hostCertDirs, filepath.Join(sys.RootForImplicitAbsolutePaths, systemPerHostCertDirPath))
 		} else {
-			hostCertDir = systemPerHostCertDirPath
+			hostCertDirs = append(hostCertDirs, systemPerHostCertDirPath)
 		}
+	}
 
+	var fullCertDirPath string
+	for _, hostCertDir := range hostCertDirs {
 		fullCertDirPath = filepath.Join(hostCertDir, hostPort)
 		_, err := os.Stat(fullCertDirPath)
 		if err == nil {
@@ -182,11 +244,68 @@ func dockerCertDir(sys *types.SystemContext, hostPort string) (string, error) {
 	return fullCertDirPath, nil
 }
 
+// setupDockerCertificates configures tlsc with the CA and client certificates used when connecting to hostPort.
+func setupDockerCertificates(sys *types.SystemContext, hostPort string, tlsc *tls.Config) error {
+	certDir, err := dockerCertDir(sys, hostPort)
+	if err != nil {
+		return err
+	}
+	if err := tlsclientconfig.SetupCertificates(certDir, tlsc); err != nil {
+		return err
+	}
+	if sys == nil {
+		return nil
+	}
+	clientCert, ok := sys.DockerClientCertificates[hostPort]
+	if !ok {
+		return nil
+	}
+	if clientCert.CertPath != "" || clientCert.KeyPath != "" {
+		if clientCert.CertPath == "" || clientCert.KeyPath == "" {
+			return errors.Errorf("Both a client certificate and a key must be specified for %s", hostPort)
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert.CertPath, clientCert.KeyPath)
+		if err != nil {
+			return errors.Wrapf(err, "error loading client certificate for %s", hostPort)
+		}
+		tlsc.Certificates = append(tlsc.Certificates, cert)
+	}
+	if clientCert.CertDirPath != "" {
+		if err := tlsclientconfig.SetupCertificates(clientCert.CertDirPath, tlsc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dockerProxyFunc returns the proxy configuration for connections to registries, from sys if set, or from the environment.
+func dockerProxyFunc(sys *types.SystemContext) func(*http.Request) (*url.URL, error) {
+	if sys == nil || sys.DockerProxy == nil {
+		return http.ProxyFromEnvironment
+	}
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  sys.DockerProxy.HTTPProxy,
+		HTTPSProxy: sys.DockerProxy.HTTPSProxy,
+		NoProxy:    sys.DockerProxy.NoProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
 // newDockerClientFromRef returns a new dockerClient instance for refHostname (a host a specified in the Docker image reference, not canonicalized to dockerRegistry)
 // “write” specifies whether the client will be used for "write" access (in particular passed to lookaside.go:toplevelFromSection)
+// The registries configuration is consulted for ref; if its registry is blocked, BlockedRegistryError is returned.
 func newDockerClientFromRef(sys *types.SystemContext, ref dockerReference, write bool, actions string) (*dockerClient, error) {
+	registryConfig, err := registriesConfEntry(sys, ref.ref.Name())
+	if err != nil {
+		return nil, err
+	}
+	if registryConfig != nil && registryConfig.Blocked {
+		return nil, BlockedRegistryError{Registry: registryConfig.URL}
+	}
 	registry := reference.Domain(ref.ref)
-	username, password, err := config.GetAuthentication(sys, reference.Domain(ref.ref))
+	creds, err := config.GetCredentials(sys, reference.Domain(ref.ref))
 	if err != nil {
 		return nil, errors.Wrapf(err, "error getting username and password")
 	}
@@ -194,58 +313,133 @@ func newDockerClientFromRef(sys *types.SystemContext, ref dockerReference, write
 	if err != nil {
 		return nil, err
 	}
+	useSigstoreAttachments, err := configuredUseSigstoreAttachments(sys, ref)
+	if err != nil {
+		return nil, err
+	}
 	remoteName := reference.Path(ref.ref)
 
-	return newDockerClientWithDetails(sys, registry, username, password, actions, sigBase, remoteName)
+	c, err := newDockerClientWithDetails(sys, registry, creds, actions, sigBase, remoteName)
+	if err != nil {
+		return nil, err
+	}
+	c.useSigstoreAttachments = useSigstoreAttachments
+	if registryConfig != nil && registryConfig.Insecure {
+		c.allowInsecure()
+	}
+	if registryConfig != nil && registryConfig.Proxy != "" {
+		if err := c.useProxy(registryConfig.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 // newDockerClientWithDetails returns a new dockerClient instance for the given parameters
-func newDockerClientWithDetails(sys *types.SystemContext, registry, username, password, actions string, sigBase signatureStorageBase, remoteName string) (*dockerClient, error) {
+func newDockerClientWithDetails(sys *types.SystemContext, registry string, creds types.DockerAuthConfig, actions string, sigBase signatureStorageBase, remoteName string) (*dockerClient, error) {
 	hostName := registry
 	if registry == dockerHostname {
 		registry = dockerRegistry
 	}
 	tr := tlsclientconfig.NewTransport()
 	tr.TLSClientConfig = serverDefault()
+	// The client may be shared with other dockerClient instances through registryConnectionCache, so keep connections open for reuse.
+	tr.DisableKeepAlives = false
+	tr.IdleConnTimeout = idleConnectionTimeout
 
 	// It is undefined whether the host[:port] string for dockerHostname should be dockerHostname or dockerRegistry,
 	// because docker/docker does not read the certs.d subdirectory at all in that case.  We use the user-visible
 	// dockerHostname here, because it is more symmetrical to read the configuration in that case as well, and because
 	// generally the UI hides the existence of the different dockerRegistry.  But note that this behavior is
 	// undocumented and may change if docker/docker changes.
-	certDir, err := dockerCertDir(sys, hostName)
-	if err != nil {
+	if err := setupDockerCertificates(sys, hostName, tr.TLSClientConfig); err != nil {
 		return nil, err
 	}
-	if err := tlsclientconfig.SetupCertificates(certDir, tr.TLSClientConfig); err != nil {
+	certDir, err := dockerCertDir(sys, hostName)
+	if err != nil {
 		return nil, err
 	}
 
-	if sys != nil && sys.DockerInsecureSkipTLSVerify {
-		tr.TLSClientConfig.InsecureSkipVerify = true
-	}
-
-	return &dockerClient{
+	c := &dockerClient{
 		sys:           sys,
 		registry:      registry,
-		username:      username,
-		password:      password,
+		username:      creds.Username,
+		password:      creds.Password,
+		identityToken: creds.IdentityToken,
 		client:        &http.Client{Transport: tr},
 		signatureBase: sigBase,
 		scope: authScope{
 			actions:    actions,
 			remoteName: remoteName,
 		},
-	}, nil
+		tlsClientConfig: tr.TLSClientConfig,
+		proxy:           dockerProxyFunc(sys),
+		connectionKey:   newRegistryConnectionKey(sys, hostName, certDir, creds),
+	}
+	// Don't refer to c in tr: the client may be shared with other dockerClient instances.
+	tr.Proxy = c.proxy
+	if sys != nil && sys.DockerInsecureSkipTLSVerify {
+		c.allowInsecure()
+	}
+	return c, nil
+}
+
+// allowInsecure allows c to contact the registry over HTTP, or HTTPS with failed TLS verification.
+// It must be called before c is used.
+func (c *dockerClient) allowInsecure() {
+	c.insecureSkipTLSVerify = true
+	c.tlsClientConfig.InsecureSkipVerify = true
+	c.connectionKey.insecure = true
+}
+
+// useProxy makes c connect to the registry, and its token servers, through proxy, ignoring the proxy configuration
+// in sys and in the environment (including NO_PROXY).
+// It must be called before c is used.
+func (c *dockerClient) useProxy(proxy string) error {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return errors.Wrapf(err, "invalid proxy URL %s", proxy)
+	}
+	c.proxy = http.ProxyURL(proxyURL)
+	if tr, ok := c.client.Transport.(*http.Transport); ok {
+		tr.Proxy = c.proxy
+	}
+	c.connectionKey.proxy = "registry: " + proxy
+	return nil
+}
+
+// Close releases the idle connections of HTTP clients used only by c.
+// The registry client is kept open while it is shared through registryConnectionCache.
+func (c *dockerClient) Close() {
+	c.detectPropertiesMutex.Lock()
+	if !isCachedRegistryClient(c.client, time.Now()) {
+		closeIdleConnections(c.client)
+	}
+	c.detectPropertiesMutex.Unlock()
+
+	c.signatureStorageClientsMutex.Lock()
+	defer c.signatureStorageClientsMutex.Unlock()
+	for _, client := range c.signatureStorageClients {
+		closeIdleConnections(client)
+	}
+	c.signatureStorageClients = nil
+}
+
+// closeIdleConnections closes the idle connections of client, if its transport supports that.
+func closeIdleConnections(client *http.Client) {
+	if tr, ok := client.Transport.(*http.Transport); ok {
+		tr.CloseIdleConnections()
+	}
 }
 
 // CheckAuth validates the credentials by attempting to log into the registry
 // returns an error if an error occcured while making the http request or the status code received was 401
 func CheckAuth(ctx context.Context, sys *types.SystemContext, username, password, registry string) error {
-	newLoginClient, err := newDockerClientWithDetails(sys, registry, username, password, "", nil, "")
+	newLoginClient, err := newDockerClientWithDetails(sys, registry, types.DockerAuthConfig{Username: username, Password: password}, "", nil, "")
 	if err != nil {
 		return errors.Wrapf(err, "error creating new docker client")
 	}
+	defer newLoginClient.Close()
 
 	resp, err := newLoginClient.makeRequest(ctx, "GET", "/v2/", nil, nil, v2Auth)
 	if err != nil {
@@ -282,19 +476,14 @@ type SearchResult struct {
 // Note: The limit value doesn't work with all registries
 // for example registry.access.redhat.com returns all the results without limiting it to the limit value
 func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, image string, limit int) ([]SearchResult, error) {
-	type V2Results struct {
-		// Repositories holds the results returned by the /v2/_catalog endpoint
-		Repositories []string `json:"repositories"`
-	}
 	type V1Results struct {
 		// Results holds the results returned by the /v1/search endpoint
 		Results []SearchResult `json:"results"`
 	}
-	v2Res := &V2Results{}
 	v1Res := &V1Results{}
 
 	// Get credentials from authfile for the underlying hostname
-	username, password, err := config.GetAuthentication(sys, registry)
+	creds, err := config.GetCredentials(sys, registry)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error getting username and password")
 	}
@@ -305,10 +494,12 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 		registry = dockerV1Hostname
 	}
 
-	client, err := newDockerClientWithDetails(sys, registry, username, password, "", nil, "")
+	client, err := newDockerClientWithDetails(sys, registry, creds, "", nil, "")
 	if err != nil {
 		return nil, errors.Wrapf(err, "error creating new docker client")
 	}
+	defer client.Close()
+	client.scope = catalogScope
 
 	// Only try the v1 search endpoint if the search query is not empty. If it is
 	// empty skip to the v2 endpoint.
@@ -340,31 +531,76 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 	}
 
 	logrus.Debugf("trying to talk to v2 search endpoint\n")
-	resp, err := client.makeRequest(ctx, "GET", "/v2/_catalog", nil, nil, v2Auth)
+	repos, err := client.getRepositories(ctx)
 	if err != nil {
 		logrus.Debugf("error getting search results from v2 endpoint %q: %v", registry, err)
-	} else {
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			logrus.Errorf("error getting search results from v2 endpoint %q, status code %d (%s)", registry, resp.StatusCode, http.StatusText(resp.StatusCode))
-		} else {
-			if err := json.NewDecoder(resp.Body).Decode(v2Res); err != nil {
-				return nil, err
-			}
-			searchRes := []SearchResult{}
-			for _, repo := range v2Res.Repositories {
-				if strings.Contains(repo, image) {
-					res := SearchResult{
-						Name: repo,
-					}
-					searchRes = append(searchRes, res)
-				}
+		return nil, errors.Wrapf(err, "couldn't search registry %q", registry)
+	}
+	searchRes := []SearchResult{}
+	for _, repo := range repos {
+		if strings.Contains(repo, image) {
+			res := SearchResult{
+				Name: repo,
 			}
-			return searchRes, nil
+			searchRes = append(searchRes, res)
 		}
 	}
+	return searchRes, nil
+}
 
-	return nil, errors.Wrapf(err, "couldn't search registry %q", registry)
+// catalogScope is the authorization scope required to list repositories of a registry.
+var catalogScope = authScope{resourceType: "registry", remoteName: "catalog", actions: "*"}
+
+// GetRepositories returns the names of all repositories in registry (a host[:port], as used in image references),
+// paging through the registry's /v2/_catalog endpoint.
+// Note that many registries, notably docker.io, do not allow listing their repositories.
+// The registries configuration is consulted for registry; if it is blocked, BlockedRegistryError is returned.
+func GetRepositories(ctx context.Context, sys *types.SystemContext, registry string) ([]string, error) {
+	registryConfig, err := registriesConfEntry(sys, registry)
+	if err != nil {
+		return nil, err
+	}
+	if registryConfig != nil && registryConfig.Blocked {
+		return nil, BlockedRegistryError{Registry: registryConfig.URL}
+	}
+	creds, err := config.GetCredentials(sys, registry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting username and password")
+	}
+	client, err := newDockerClientWithDetails(sys, registry, creds, "", nil, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create client")
+	}
+	defer client.Close()
+	client.scope = catalogScope
+	if registryConfig != nil && registryConfig.Insecure {
+		client.allowInsecure()
+	}
+	if registryConfig != nil && registryConfig.Proxy != "" {
+		if err := client.useProxy(registryConfig.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	return client.getRepositories(ctx)
+}
+
+// getRepositories returns the names of all repositories in the registry, paging through the /v2/_catalog endpoint.
+// The client must have been created with catalogScope.
+func (c *dockerClient) getRepositories(ctx context.Context) ([]string, error) {
+	repos := []string{}
+	path := catalogPath
+	for path != "" {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		var err error
+		path, err = c.getListPage(ctx, path, &page)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error listing repositories of %s", c.registry)
+		}
+		repos = append(repos, page.Repositories...)
+	}
+	return repos, nil
 }
 
 // makeRequest creates and executes a http.Request with the specified parameters, adding authentication and TLS options for the Docker client.
@@ -378,11 +614,81 @@ func (c *dockerClient) makeRequest(ctx context.Context, method, path string, hea
 	return c.makeRequestToResolvedURL(ctx, method, url, headers, stream, -1, auth)
 }
 
+// makeRetriedRequest is like makeRequest, for a request without a body which is safe to repeat;
+// the request is retried after transient failures.
+func (c *dockerClient) makeRetriedRequest(ctx context.Context, method, path string, headers map[string][]string, auth sendAuth) (*http.Response, error) {
+	if err := c.detectProperties(ctx); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s://%s%s", c.scheme, c.registry, path)
+	return c.makeRequestToResolvedURLWithRetries(ctx, method, url, headers, auth, true)
+}
+
 // makeRequestToResolvedURL creates and executes a http.Request with the specified parameters, adding authentication and TLS options for the Docker client.
 // streamLen, if not -1, specifies the length of the data expected on stream.
+// GET and HEAD requests without a body are retried after transient failures; requests without a body are repeated
+// after waiting if the registry responds with 429 Too Many Requests.
+// If the registry keeps rate-limiting the request, or if a request with a body is rate-limited, it fails with TooManyRequestsError.
 // makeRequest should generally be preferred.
 // TODO(runcom): too many arguments here, use a struct
 func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method, url string, headers map[string][]string, stream io.Reader, streamLen int64, auth sendAuth) (*http.Response, error) {
+	if stream != nil {
+		res, err := c.makeRequestToResolvedURLOnce(ctx, method, url, headers, stream, streamLen, auth)
+		if err == nil && res.StatusCode == http.StatusTooManyRequests {
+			res.Body.Close()
+			return nil, c.tooManyRequestsError(res)
+		}
+		return res, err
+	}
+	return c.makeRequestToResolvedURLWithRetries(ctx, method, url, headers, auth, method == "GET" || method == "HEAD")
+}
+
+// makeRequestToResolvedURLWithRetries is like makeRequestToResolvedURL, for a request without a body.
+// If retryTransientFailures, the request must be safe to repeat, and it is retried, with exponential backoff, after transient failures.
+func (c *dockerClient) makeRequestToResolvedURLWithRetries(ctx context.Context, method, url string, headers map[string][]string, auth sendAuth, retryTransientFailures bool) (*http.Response, error) {
+	maxRetries := 0
+	if retryTransientFailures {
+		maxRetries = c.maxRetries()
+	}
+	rateLimitBudget := c.rateLimitBudget()
+	retries := 0
+	rateLimited := 0
+	rateLimitWaited := time.Duration(0)
+	for {
+		res, err := c.makeRequestToResolvedURLOnce(ctx, method, url, headers, nil, -1, auth)
+		if err == nil && res.StatusCode == http.StatusTooManyRequests {
+			res.Body.Close()
+			rateLimited++
+			delay := retryAfterDelay(res.Header.Get("Retry-After"), time.Now(), rateLimited)
+			if rateLimitBudget <= 0 || rateLimitWaited+delay > rateLimitBudget {
+				return nil, c.tooManyRequestsError(res)
+			}
+			logrus.Debugf("%s %s was rate-limited, retrying after %s", method, url, delay)
+			if err := sleepWithContext(ctx, delay); err != nil {
+				return nil, err
+			}
+			rateLimitWaited += delay
+			continue
+		}
+		if retries >= maxRetries || !isTransientFailure(ctx, res, err) {
+			return res, err
+		}
+		if err != nil {
+			logrus.Debugf("%s %s failed, retrying: %v", method, url, err)
+		} else {
+			logrus.Debugf("%s %s failed with status %d, retrying", method, url, res.StatusCode)
+			res.Body.Close()
+		}
+		retries++
+		if err := sleepBeforeRetry(ctx, retries); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// makeRequestToResolvedURLOnce is like makeRequestToResolvedURL, but never retries the request.
+func (c *dockerClient) makeRequestToResolvedURLOnce(ctx context.Context, method, url string, headers map[string][]string, stream io.Reader, streamLen int64, auth sendAuth) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, stream)
 	if err != nil {
 		return nil, err
@@ -400,8 +706,21 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method, url
 	if c.sys != nil && c.sys.DockerRegistryUserAgent != "" {
 		req.Header.Add("User-Agent", c.sys.DockerRegistryUserAgent)
 	}
+	if c.sys != nil {
+		for n, h := range c.sys.DockerRegistryHeaders {
+			n = http.CanonicalHeaderKey(n)
+			if _, ok := req.Header[n]; ok {
+				continue
+			}
+			for _, hh := range h {
+				req.Header.Add(n, hh)
+			}
+		}
+	}
+	var token *bearerToken
 	if auth == v2Auth {
-		if err := c.setupRequestAuth(req); err != nil {
+		token, err = c.setupRequestAuth(req)
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -410,9 +729,184 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method, url
 	if err != nil {
 		return nil, err
 	}
+	if token != nil && res.StatusCode == http.StatusUnauthorized {
+		// The token may have been revoked; don't use it for further requests.
+		dropCachedBearerToken(token)
+	}
+	c.reportResponseWarnings(res)
 	return res, nil
 }
 
+// reportResponseWarnings reports warnings in the Warning headers of res which were not reported by c before.
+// Only warnings with the 299 (“Miscellaneous persistent warning”) code and no warn-agent, as used by
+// the OCI distribution specification, are reported.
+func (c *dockerClient) reportResponseWarnings(res *http.Response) {
+	for _, header := range res.Header[http.CanonicalHeaderKey("Warning")] {
+		warning, ok := parseWarningHeader(header)
+		if !ok {
+			logrus.Debugf("Ignoring Warning header %q", header)
+			continue
+		}
+		c.reportedWarningsMutex.Lock()
+		if c.reportedWarnings == nil {
+			c.reportedWarnings = map[string]struct{}{}
+		}
+		_, reported := c.reportedWarnings[warning]
+		c.reportedWarnings[warning] = struct{}{}
+		c.reportedWarningsMutex.Unlock()
+		if reported {
+			continue
+		}
+		if c.sys != nil && c.sys.DockerRegistryWarnings != nil {
+			c.sys.DockerRegistryWarnings(warning)
+		} else {
+			logrus.Warnf("Warning from registry %s: %s", c.registry, warning)
+		}
+	}
+}
+
+// parseWarningHeader returns the warn-text of a Warning header value (see RFC 7234), if it is a warning which should be reported.
+func parseWarningHeader(header string) (string, bool) {
+	code, rest := expectToken(skipSpace(header))
+	if code != "299" || !strings.HasPrefix(rest, " ") {
+		return "", false
+	}
+	agent, rest := expectToken(skipSpace(rest))
+	if agent != "-" || !strings.HasPrefix(rest, " ") {
+		return "", false
+	}
+	rest = skipSpace(rest)
+	if !strings.HasPrefix(rest, `"`) {
+		return "", false
+	}
+	text, _ := expectTokenOrQuoted(rest)
+	if text == "" {
+		return "", false
+	}
+	return text, true
+}
+
+// maxRetries returns the maximum number of retries of a request after transient failures.
+func (c *dockerClient) maxRetries() int {
+	if c.sys == nil || c.sys.DockerRegistryMaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	if c.sys.DockerRegistryMaxRetries < 0 {
+		return 0
+	}
+	return c.sys.DockerRegistryMaxRetries
+}
+
+// isTransientFailure returns true if a request which failed with err, or returned res, should be retried.
+func isTransientFailure(ctx context.Context, res *http.Response, err error) bool {
+	if err != nil {
+		// Don't retry if the caller is no longer interested.
+		return ctx.Err() == nil && isTransientNetworkError(err)
+	}
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return true
+	case res.StatusCode == http.StatusNotImplemented:
+		return false
+	default:
+		return res.StatusCode >= 500 && res.StatusCode <= 599
+	}
+}
+
+// isTransientNetworkError returns true if err is a timeout, or a connection which was refused, reset or closed unexpectedly.
+// Other failures, e.g. host names which can not be resolved or TLS certificate errors, are not transient.
+func isTransientNetworkError(err error) bool {
+	err = errors.Cause(err)
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+		if sysErr, ok := err.(*os.SyscallError); ok {
+			err = sysErr.Err
+		}
+	}
+	switch err {
+	case syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ECONNABORTED, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay returns the delay before retry number attempt (starting at 1) of a request.
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// sleepBeforeRetry waits before retry number attempt (starting at 1) of a request, or until ctx is done.
+func sleepBeforeRetry(ctx context.Context, attempt int) error {
+	return sleepWithContext(ctx, retryDelay(attempt))
+}
+
+// rateLimitBudget returns the maximum total time to wait for a rate-limited request.
+func (c *dockerClient) rateLimitBudget() time.Duration {
+	if c.sys == nil || c.sys.DockerRegistryRateLimitBudget == 0 {
+		return defaultRateLimitBudget
+	}
+	if c.sys.DockerRegistryRateLimitBudget < 0 {
+		return 0
+	}
+	return c.sys.DockerRegistryRateLimitBudget
+}
+
+// retryAfterDelay returns the delay before repeating a request rate-limited for the attempt-th time (starting at 1),
+// using the value of a Retry-After header, if any, received at now.
+func retryAfterDelay(retryAfter string, now time.Time, attempt int) time.Duration {
+	if retryAfter != "" {
+		if seconds, err := strconv.ParseInt(retryAfter, 10, 64); err == nil {
+			if seconds < 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+		if t, err := http.ParseTime(retryAfter); err == nil {
+			if delay := t.Sub(now); delay > 0 {
+				return delay
+			}
+			return 0
+		}
+		logrus.Debugf("Ignoring invalid Retry-After value %q", retryAfter)
+	}
+	return retryDelay(attempt)
+}
+
+// tooManyRequestsError returns a TooManyRequestsError for a 429 Too Many Requests response res.
+func (c *dockerClient) tooManyRequestsError(res *http.Response) error {
+	retryAfter := time.Duration(0)
+	if value := res.Header.Get("Retry-After"); value != "" {
+		retryAfter = retryAfterDelay(value, time.Now(), 1)
+	}
+	return TooManyRequestsError{Registry: c.registry, RetryAfter: retryAfter}
+}
+
+// sleepWithContext waits for delay, or until ctx is done.
+func sleepWithContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // we're using the challenges from the /v2/ ping response and not the one from the destination
 // URL in this request because:
 //
@@ -420,9 +914,11 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method, url
 // 2) gcr.io is sending 401 without a WWW-Authenticate header in the real request
 //
 // debugging: https://github.com/containers/image/pull/211#issuecomment-273426236 and follows up
-func (c *dockerClient) setupRequestAuth(req *http.Request) error {
+//
+// It returns the bearer token used for req, if any.
+func (c *dockerClient) setupRequestAuth(req *http.Request) (*bearerToken, error) {
 	if len(c.challenges) == 0 {
-		return nil
+		return nil, nil
 	}
 	schemeNames := make([]string, 0, len(c.challenges))
 	for _, challenge := range c.challenges {
@@ -430,36 +926,84 @@ func (c *dockerClient) setupRequestAuth(req *http.Request) error {
 		switch challenge.Scheme {
 		case "basic":
 			req.SetBasicAuth(c.username, c.password)
-			return nil
+			return nil, nil
 		case "bearer":
-			if c.token == nil || time.Now().After(c.tokenExpiration) {
-				realm, ok := challenge.Parameters["realm"]
-				if !ok {
-					return errors.Errorf("missing realm in bearer auth challenge")
-				}
-				service, _ := challenge.Parameters["service"] // Will be "" if not present
-				var scope string
-				if c.scope.remoteName != "" && c.scope.actions != "" {
-					scope = fmt.Sprintf("repository:%s:%s", c.scope.remoteName, c.scope.actions)
-				}
-				token, err := c.getBearerToken(req.Context(), realm, service, scope)
-				if err != nil {
-					return err
-				}
-				c.token = token
-				c.tokenExpiration = token.IssuedAt.Add(time.Duration(token.ExpiresIn) * time.Second)
+			token, err := c.obtainBearerToken(req.Context(), challenge)
+			if err != nil {
+				return nil, err
 			}
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token.Token))
-			return nil
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.Token))
+			return token, nil
 		default:
 			logrus.Debugf("no handler for %s authentication", challenge.Scheme)
 		}
 	}
 	logrus.Infof("None of the challenges sent by server (%s) are supported, trying an unauthenticated request anyway", strings.Join(schemeNames, ", "))
-	return nil
+	return nil, nil
+}
+
+// obtainBearerToken returns a bearer token for c.scope, as requested by a bearer challenge, reusing cached tokens if possible.
+func (c *dockerClient) obtainBearerToken(ctx context.Context, challenge challenge) (*bearerToken, error) {
+	realm, ok := challenge.Parameters["realm"]
+	if !ok {
+		return nil, errors.Errorf("missing realm in bearer auth challenge")
+	}
+	service, _ := challenge.Parameters["service"] // Will be "" if not present
+	var scope string
+	if c.scope.remoteName != "" && c.scope.actions != "" {
+		resourceType := c.scope.resourceType
+		if resourceType == "" {
+			resourceType = "repository"
+		}
+		scope = fmt.Sprintf("%s:%s:%s", resourceType, c.scope.remoteName, c.scope.actions)
+	}
+	key := newBearerTokenCacheKey(realm, service, scope, c.username, c.password, c.identityToken)
+	return getBearerTokenWithCache(ctx, key, func() (*bearerToken, error) {
+		return c.getBearerToken(ctx, realm, service, scope)
+	})
+}
+
+// prefetchAnonymousBearerToken starts obtaining a bearer token for c.scope in the background, if c does not use any credentials
+// and the registry is already known to require bearer tokens, so that the first request for the repository
+// does not have to wait for the token server.
+// The registry itself is not contacted; if its properties have not been recently detected, this does nothing.
+// Canceling ctx aborts the background request.
+func (c *dockerClient) prefetchAnonymousBearerToken(ctx context.Context) {
+	if c.username != "" || c.password != "" || c.identityToken != "" || c.connectionKey.registry == "" {
+		return
+	}
+	if _, ok := getCachedRegistryConnection(c.connectionKey, time.Now()); !ok {
+		return
+	}
+	go func() {
+		if err := c.detectProperties(ctx); err != nil {
+			return
+		}
+		// Use the same challenge as setupRequestAuth.
+		for _, challenge := range c.challenges {
+			switch challenge.Scheme {
+			case "basic":
+				return
+			case "bearer":
+				if _, err := c.obtainBearerToken(ctx, challenge); err != nil {
+					logrus.Debugf("Error prefetching a bearer token for %s: %v", c.registry, err)
+				}
+				return
+			}
+		}
+	}()
 }
 
+// getBearerToken obtains a bearer token for service and scope from realm.
 func (c *dockerClient) getBearerToken(ctx context.Context, realm, service, scope string) (*bearerToken, error) {
+	if c.identityToken != "" {
+		token, err := c.getBearerTokenUsingIdentityToken(ctx, realm, service, scope)
+		if err != errOAuth2NotSupported {
+			return token, err
+		}
+		logrus.Debugf("The token server %s does not support OAuth2, falling back to basic authentication", realm)
+	}
+
 	authReq, err := http.NewRequest("GET", realm, nil)
 	if err != nil {
 		return nil, err
@@ -480,11 +1024,7 @@ func (c *dockerClient) getBearerToken(ctx context.Context, realm, service, scope
 		authReq.SetBasicAuth(c.username, c.password)
 	}
 	logrus.Debugf("%s %s", authReq.Method, authReq.URL.String())
-	tr := tlsclientconfig.NewTransport()
-	// TODO(runcom): insecure for now to contact the external token service
-	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	client := &http.Client{Transport: tr}
-	res, err := client.Do(authReq)
+	res, err := c.tokenServerClient().Do(authReq)
 	if err != nil {
 		return nil, err
 	}
@@ -505,16 +1045,87 @@ func (c *dockerClient) getBearerToken(ctx context.Context, realm, service, scope
 	return newBearerTokenFromJSONBlob(tokenBlob)
 }
 
+// errOAuth2NotSupported is returned by getBearerTokenUsingIdentityToken if the token server does not support the OAuth2 flow.
+var errOAuth2NotSupported = errors.New("OAuth2 token requests are not supported")
+
+// getBearerTokenUsingIdentityToken obtains a bearer token for service and scope from realm, using
+// the OAuth2 refresh token flow with c.identityToken.
+// It returns errOAuth2NotSupported if realm does not support the flow.
+func (c *dockerClient) getBearerTokenUsingIdentityToken(ctx context.Context, realm, service, scope string) (*bearerToken, error) {
+	params := url.Values{}
+	params.Set("grant_type", "refresh_token")
+	params.Set("refresh_token", c.identityToken)
+	params.Set("client_id", oauth2ClientID)
+	if service != "" {
+		params.Set("service", service)
+	}
+	if scope != "" {
+		params.Set("scope", scope)
+	}
+	authReq, err := http.NewRequest("POST", realm, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	authReq = authReq.WithContext(ctx)
+	authReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	logrus.Debugf("%s %s", authReq.Method, authReq.URL.String())
+	res, err := c.tokenServerClient().Do(authReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusUnauthorized, http.StatusBadRequest:
+		// RFC 6749 uses 400 Bad Request for invalid_grant, i.e. an invalid or expired refresh token.
+		return nil, ErrUnauthorizedForCredentials
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, errOAuth2NotSupported
+	case http.StatusOK:
+		break
+	default:
+		return nil, errors.Errorf("unexpected http code: %d (%s), URL: %s", res.StatusCode, http.StatusText(res.StatusCode), authReq.URL)
+	}
+	tokenBlob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxAuthTokenBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBearerTokenFromJSONBlob(tokenBlob)
+}
+
+// tokenServerClient returns a http.Client for contacting token servers.
+func (c *dockerClient) tokenServerClient() *http.Client {
+	tr := tlsclientconfig.NewTransport()
+	tr.Proxy = c.proxy
+	// Token servers are verified using the TLS configuration of the registry, like the registry itself.
+	tr.TLSClientConfig = c.tlsClientConfig
+	return &http.Client{Transport: tr}
+}
+
 // detectProperties detects various properties of the registry.
 // See the dockerClient documentation for members which are affected by this.
+// If another dockerClient with the same connectionKey has recently detected the properties, its HTTP client
+// and the detected properties are reused instead.
 func (c *dockerClient) detectProperties(ctx context.Context) error {
+	c.detectPropertiesMutex.Lock()
+	defer c.detectPropertiesMutex.Unlock()
 	if c.scheme != "" {
 		return nil
 	}
+	if c.connectionKey.registry != "" {
+		if conn, ok := getCachedRegistryConnection(c.connectionKey, time.Now()); ok {
+			c.client = conn.client
+			c.tlsClientConfig = conn.tlsClientConfig
+			c.scheme = conn.scheme
+			c.challenges = conn.challenges
+			c.supportsSignatures = conn.supportsSignatures
+			return nil
+		}
+	}
 
 	ping := func(scheme string) error {
 		url := fmt.Sprintf(resolvedPingV2URL, scheme, c.registry)
-		resp, err := c.makeRequestToResolvedURL(ctx, "GET", url, nil, nil, -1, noAuth)
+		resp, err := c.makeRequestToResolvedURLOnce(ctx, "GET", url, nil, nil, -1, noAuth)
 		if err != nil {
 			logrus.Debugf("Ping %s err %s (%#v)", url, err.Error(), err)
 			return err
@@ -530,9 +1141,18 @@ func (c *dockerClient) detectProperties(ctx context.Context) error {
 		return nil
 	}
 	err := ping("https")
-	if err != nil && c.sys != nil && c.sys.DockerInsecureSkipTLSVerify {
+	if err != nil && c.insecureSkipTLSVerify {
 		err = ping("http")
 	}
+	if err == nil && c.connectionKey.registry != "" {
+		cacheRegistryConnection(c.connectionKey, registryConnection{
+			client:             c.client,
+			tlsClientConfig:    c.tlsClientConfig,
+			scheme:             c.scheme,
+			challenges:         c.challenges,
+			supportsSignatures: c.supportsSignatures,
+		}, time.Now())
+	}
 	if err != nil {
 		err = errors.Wrap(err, "pinging docker registry returned")
 		if c.sys != nil && c.sys.DockerDisableV1Ping {
@@ -541,7 +1161,7 @@ func (c *dockerClient) detectProperties(ctx context.Context) error {
 		// best effort to understand if we're talking to a V1 registry
 		pingV1 := func(scheme string) bool {
 			url := fmt.Sprintf(resolvedPingV1URL, scheme, c.registry)
-			resp, err := c.makeRequestToResolvedURL(ctx, "GET", url, nil, nil, -1, noAuth)
+			resp, err := c.makeRequestToResolvedURLOnce(ctx, "GET", url, nil, nil, -1, noAuth)
 			if err != nil {
 				logrus.Debugf("Ping %s err %s (%#v)", url, err.Error(), err)
 				return false
@@ -554,7 +1174,7 @@ func (c *dockerClient) detectProperties(ctx context.Context) error {
 			return true
 		}
 		isV1 := pingV1("https")
-		if !isV1 && c.sys != nil && c.sys.DockerInsecureSkipTLSVerify {
+		if !isV1 && c.insecureSkipTLSVerify {
 			isV1 = pingV1("http")
 		}
 		if isV1 {
@@ -564,6 +1184,71 @@ func (c *dockerClient) detectProperties(ctx context.Context) error {
 	return err
 }
 
+// getListPage reads a page of a paginated list (of tags or repositories) from path into v, and returns the path
+// of the next page, or "" if this is the last one.
+func (c *dockerClient) getListPage(ctx context.Context, path string, v interface{}) (string, error) {
+	res, err := c.makeRequest(ctx, "GET", path, nil, nil, v2Auth)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Wrapf(registryHTTPResponseToError(res), "Invalid status code returned when fetching %s", path)
+	}
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxListBodySize)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return "", err
+	}
+	return nextPagePath(res.Header)
+}
+
+// nextPagePath returns the path (with a query, if any) of the next page linked from a response with header, using
+// a RFC 5988 Link header, or "" if there is no next page.
+func nextPagePath(header http.Header) (string, error) {
+	for _, value := range header["Link"] {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				return "", errors.Errorf("Invalid Link header %q", value)
+			}
+			isNext := len(parts) == 1 // Older registries did not include a rel parameter.
+			for _, param := range parts[1:] {
+				if name, value := splitLinkParam(param); name == "rel" && value == "next" {
+					isNext = true
+				}
+			}
+			if !isNext {
+				continue
+			}
+			linkURL, err := url.Parse(target[1 : len(target)-1])
+			if err != nil {
+				return "", errors.Wrapf(err, "Invalid Link header %q", value)
+			}
+			// The link can be relative or absolute, but we only use the path; the
+			// next page is expected to be on the same registry.
+			path := linkURL.Path
+			if linkURL.RawQuery != "" {
+				path += "?" + linkURL.RawQuery
+			}
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// splitLinkParam returns the lowercase name and the unquoted value of a link-param of a RFC 5988 Link header.
+func splitLinkParam(param string) (string, string) {
+	parts := strings.SplitN(param, "=", 2)
+	if len(parts) != 2 {
+		return strings.ToLower(strings.TrimSpace(parts[0])), ""
+	}
+	return strings.ToLower(strings.TrimSpace(parts[0])), strings.Trim(strings.TrimSpace(parts[1]), `"`)
+}
+
 // getExtensionsSignatures returns signatures from the X-Registry-Supports-Signatures API extension,
 // using the original data structures.
 func (c *dockerClient) getExtensionsSignatures(ctx context.Context, ref dockerReference, manifestDigest digest.Digest) (*extensionSignatureList, error) {
@@ -574,7 +1259,7 @@ func (c *dockerClient) getExtensionsSignatures(ctx context.Context, ref dockerRe
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, errors.Wrapf(client.HandleErrorResponse(res), "Error downloading signatures for %s in %s", manifestDigest, ref.ref.Name())
+		return nil, errors.Wrapf(registryHTTPResponseToError(res), "Error downloading signatures for %s in %s", manifestDigest, ref.ref.Name())
 	}
 
 	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxSignatureListBodySize)
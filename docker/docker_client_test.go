@@ -1,13 +1,23 @@
 package docker
 
 import (
+	"bytes"
+	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -91,6 +101,136 @@ func TestDockerCertDir(t *testing.T) {
 		require.Equal(t, nil, err)
 		assert.Equal(t, c.expected, path)
 	}
+
+	// A per-host directory in the user's home directory is preferred to the system ones
+	tmpHome, err := ioutil.TempDir("", "test_docker_cert_dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpHome)
+	origHomeDir := homedir.Get()
+	os.Setenv(homedir.Key(), tmpHome)
+	defer os.Setenv(homedir.Key(), origHomeDir)
+	userResult := filepath.Join(tmpHome, ".config/containers/certs.d", registryHostPort)
+	err = os.MkdirAll(userResult, 0755)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		expected string
+	}{
+		{nil, userResult},
+		// The home directory is not used with a root prefix
+		{&types.SystemContext{RootForImplicitAbsolutePaths: rootPrefix}, filepath.Join(rootPrefix, systemPerHostResult)},
+		{&types.SystemContext{DockerCertPath: nondefaultFullPath}, nondefaultFullPath},
+		{
+			&types.SystemContext{DockerPerHostCertDirPath: nondefaultPerHostDir},
+			filepath.Join(nondefaultPerHostDir, registryHostPort),
+		},
+	} {
+		path, err := dockerCertDir(c.sys, registryHostPort)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, path)
+	}
+	path, err := dockerCertDir(nil, "other.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(systemPerHostCertDirPaths[len(systemPerHostCertDirPaths)-1], "other.example.com"), path)
+}
+
+func TestDockerProxyFunc(t *testing.T) {
+	sys := &types.SystemContext{DockerProxy: &types.DockerProxyConfig{
+		HTTPProxy:  "http://http-proxy.example.com:3128",
+		HTTPSProxy: "http://https-proxy.example.com:3128",
+		NoProxy:    "internal.example.com,10.0.0.0/8",
+	}}
+	proxyFunc := dockerProxyFunc(sys)
+	for _, c := range []struct {
+		url, expected string
+	}{
+		{"http://registry.example.com/v2/", "http://http-proxy.example.com:3128"},
+		{"https://registry.example.com/v2/", "http://https-proxy.example.com:3128"},
+		{"https://internal.example.com/v2/", ""},
+		{"https://registry.internal.example.com:5000/v2/", ""},
+		{"https://10.1.2.3/v2/", ""},
+		{"https://localhost:5000/v2/", ""},
+	} {
+		req, err := http.NewRequest("GET", c.url, nil)
+		require.NoError(t, err, c.url)
+		proxy, err := proxyFunc(req)
+		require.NoError(t, err, c.url)
+		if c.expected == "" {
+			assert.Nil(t, proxy, c.url)
+		} else {
+			require.NotNil(t, proxy, c.url)
+			assert.Equal(t, c.expected, proxy.String(), c.url)
+		}
+	}
+
+	// Without a proxy configuration in sys, the environment is used.
+	for _, sys := range []*types.SystemContext{nil, {}} {
+		assert.Equal(t, reflect.ValueOf(http.ProxyFromEnvironment).Pointer(), reflect.ValueOf(dockerProxyFunc(sys)).Pointer())
+	}
+}
+
+func TestSetupDockerCertificates(t *testing.T) {
+	const registryHostPort = "registry.example.com:5000"
+	const fixtures = "../pkg/tlsclientconfig/testdata"
+	emptyDir, err := ioutil.TempDir("", "docker-certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(emptyDir)
+
+	for _, c := range []struct {
+		clientCerts map[string]types.DockerClientCertificate
+		expected    int // Number of client certificates, or -1 for an error
+	}{
+		{nil, 0},
+		// Certificates for a different registry are ignored
+		{map[string]types.DockerClientCertificate{"other.example.com": {CertDirPath: fixtures + "/full"}}, 0},
+		{map[string]types.DockerClientCertificate{registryHostPort: {CertDirPath: fixtures + "/full"}}, 2},
+		{
+			map[string]types.DockerClientCertificate{registryHostPort: {
+				CertPath: fixtures + "/full/client-cert-1.cert",
+				KeyPath:  fixtures + "/full/client-cert-1.key",
+			}},
+			1,
+		},
+		{
+			map[string]types.DockerClientCertificate{registryHostPort: {
+				CertPath:    fixtures + "/full/client-cert-1.cert",
+				KeyPath:     fixtures + "/full/client-cert-1.key",
+				CertDirPath: fixtures + "/full",
+			}},
+			3,
+		},
+		// Invalid configurations
+		{map[string]types.DockerClientCertificate{registryHostPort: {CertPath: fixtures + "/full/client-cert-1.cert"}}, -1},
+		{map[string]types.DockerClientCertificate{registryHostPort: {KeyPath: fixtures + "/full/client-cert-1.key"}}, -1},
+		{
+			map[string]types.DockerClientCertificate{registryHostPort: {
+				CertPath: fixtures + "/full/client-cert-1.cert",
+				KeyPath:  fixtures + "/full/client-cert-2.key",
+			}},
+			-1,
+		},
+		{
+			map[string]types.DockerClientCertificate{registryHostPort: {
+				CertPath: fixtures + "/full/this-does-not-exist.cert",
+				KeyPath:  fixtures + "/full/client-cert-1.key",
+			}},
+			-1,
+		},
+		{map[string]types.DockerClientCertificate{registryHostPort: {CertDirPath: fixtures + "/missing-key"}}, -1},
+	} {
+		sys := &types.SystemContext{
+			DockerPerHostCertDirPath: emptyDir,
+			DockerClientCertificates: c.clientCerts,
+		}
+		tlsc := serverDefault()
+		err := setupDockerCertificates(sys, registryHostPort, tlsc)
+		if c.expected == -1 {
+			assert.Error(t, err, "%#v", c.clientCerts)
+		} else {
+			require.NoError(t, err, "%#v", c.clientCerts)
+			assert.Len(t, tlsc.Certificates, c.expected, "%#v", c.clientCerts)
+		}
+	}
 }
 
 func TestGetAuth(t *testing.T) {
@@ -616,3 +756,657 @@ func assertBearerTokensEqual(t *testing.T, expected, subject *bearerToken) {
 		t.Fatalf("expected [%s] to equal [%s], it did not", subject.IssuedAt, expected.IssuedAt)
 	}
 }
+
+// withRetryDelays sets retryBaseDelay and retryMaxDelay to the specified values, and returns a function restoring the original values.
+func withRetryDelays(base, max time.Duration) func() {
+	origBase, origMax := retryBaseDelay, retryMaxDelay
+	retryBaseDelay, retryMaxDelay = base, max
+	return func() {
+		retryBaseDelay, retryMaxDelay = origBase, origMax
+	}
+}
+
+func TestDockerClientMaxRetries(t *testing.T) {
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		expected int
+	}{
+		{nil, defaultMaxRetries},
+		{&types.SystemContext{}, defaultMaxRetries},
+		{&types.SystemContext{DockerRegistryMaxRetries: 7}, 7},
+		{&types.SystemContext{DockerRegistryMaxRetries: -1}, 0},
+	} {
+		c2 := &dockerClient{sys: c.sys}
+		assert.Equal(t, c.expected, c2.maxRetries(), "%#v", c.sys)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	defer withRetryDelays(time.Second, 10*time.Second)()
+	for _, c := range []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	} {
+		assert.Equal(t, c.expected, retryDelay(c.attempt), fmt.Sprintf("%d", c.attempt))
+	}
+}
+
+func TestIsTransientFailure(t *testing.T) {
+	ctx := context.Background()
+	reset := &url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}
+	assert.True(t, isTransientFailure(ctx, nil, reset))
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, isTransientFailure(cancelledCtx, nil, reset))
+	for _, c := range []struct {
+		err      error
+		expected bool
+	}{
+		{&url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true},
+		{&url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: io.EOF}, true},
+		{errors.Wrap(io.ErrUnexpectedEOF, "Error reading response"), true},
+		{&net.DNSError{Err: "i/o timeout", Name: "registry.example.com", IsTimeout: true}, true},
+		{&url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "registry.example.com"}}}, false},
+		{&url.Error{Op: "Get", URL: "https://registry.example.com/v2/", Err: x509.UnknownAuthorityError{}}, false},
+		{errors.New("connection reset"), false},
+	} {
+		assert.Equal(t, c.expected, isTransientFailure(ctx, nil, c.err), c.err.Error())
+	}
+	for status, expected := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusNotFound:            false,
+		http.StatusUnauthorized:        false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusNotImplemented:      false,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+		http.StatusInsufficientStorage: true,
+	} {
+		assert.Equal(t, expected, isTransientFailure(ctx, &http.Response{StatusCode: status}, nil), fmt.Sprintf("%d", status))
+	}
+}
+
+func TestDockerClientMakeRequestRetries(t *testing.T) {
+	defer withRetryDelays(time.Millisecond, time.Millisecond)()
+
+	failures := 0
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method]++
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	c := &dockerClient{registry: server.Listener.Addr().String(), client: server.Client(), scheme: "http"}
+
+	// GET and HEAD are retried
+	for _, method := range []string{"GET", "HEAD"} {
+		failures = 2
+		requests = map[string]int{}
+		res, err := c.makeRequest(context.Background(), method, "/v2/", nil, nil, noAuth)
+		require.NoError(t, err, method)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode, method)
+		assert.Equal(t, map[string]int{method: 3}, requests, method)
+	}
+
+	// … up to a limit, returning the last response
+	failures = defaultMaxRetries + 5
+	requests = map[string]int{}
+	res, err := c.makeRequest(context.Background(), "GET", "/v2/", nil, nil, noAuth)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, map[string]int{"GET": defaultMaxRetries + 1}, requests)
+
+	// Other methods are not retried, unless explicitly requested
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		failures = 2
+		requests = map[string]int{}
+		res, err := c.makeRequest(context.Background(), method, "/v2/", nil, nil, noAuth)
+		require.NoError(t, err, method)
+		res.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode, method)
+		assert.Equal(t, map[string]int{method: 1}, requests, method)
+	}
+	failures = 2
+	requests = map[string]int{}
+	res, err = c.makeRetriedRequest(context.Background(), "POST", "/v2/", nil, noAuth)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, map[string]int{"POST": 3}, requests)
+
+	// Retries are abandoned when the context is cancelled
+	defer withRetryDelays(time.Hour, time.Hour)()
+	failures = 2
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.makeRequest(ctx, "GET", "/v2/", nil, nil, noAuth)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	defer withRetryDelays(time.Second, 10*time.Second)()
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		value    string
+		attempt  int
+		expected time.Duration
+	}{
+		{"120", 1, 2 * time.Minute},
+		{"0", 1, 0},
+		{"-5", 1, 0},
+		{"Fri, 01 Jun 2018 12:00:30 GMT", 1, 30 * time.Second},
+		{"Fri, 01 Jun 2018 11:00:00 GMT", 1, 0},
+		{"", 1, time.Second},
+		{"", 3, 4 * time.Second},
+		{"invalid", 2, 2 * time.Second},
+	} {
+		assert.Equal(t, c.expected, retryAfterDelay(c.value, now, c.attempt), c.value)
+	}
+}
+
+func TestDockerClientRateLimitBudget(t *testing.T) {
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		expected time.Duration
+	}{
+		{nil, defaultRateLimitBudget},
+		{&types.SystemContext{}, defaultRateLimitBudget},
+		{&types.SystemContext{DockerRegistryRateLimitBudget: time.Hour}, time.Hour},
+		{&types.SystemContext{DockerRegistryRateLimitBudget: -1}, 0},
+	} {
+		c2 := &dockerClient{sys: c.sys}
+		assert.Equal(t, c.expected, c2.rateLimitBudget(), "%#v", c.sys)
+	}
+}
+
+func TestDockerClientMakeRequestRateLimited(t *testing.T) {
+	defer withRetryDelays(time.Millisecond, time.Millisecond)()
+
+	limited := 0
+	retryAfter := ""
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method]++
+		if limited > 0 {
+			limited--
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	c := &dockerClient{registry: server.Listener.Addr().String(), client: server.Client(), scheme: "http"}
+
+	// Requests without a body are repeated, regardless of the method, and regardless of DockerRegistryMaxRetries
+	c.sys = &types.SystemContext{DockerRegistryMaxRetries: -1}
+	for _, method := range []string{"GET", "HEAD", "POST", "PUT", "DELETE"} {
+		for _, ra := range []string{"", "0"} {
+			limited = defaultMaxRetries + 2
+			retryAfter = ra
+			requests = map[string]int{}
+			res, err := c.makeRequest(context.Background(), method, "/v2/", nil, nil, noAuth)
+			require.NoError(t, err, method)
+			res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode, method)
+			assert.Equal(t, map[string]int{method: defaultMaxRetries + 3}, requests, method)
+		}
+	}
+
+	// Requests with a body fail immediately
+	limited = 1
+	retryAfter = "0"
+	requests = map[string]int{}
+	_, err := c.makeRequest(context.Background(), "PATCH", "/v2/", nil, bytes.NewReader([]byte("data")), noAuth)
+	assert.Equal(t, TooManyRequestsError{Registry: c.registry}, err)
+	assert.Equal(t, map[string]int{"PATCH": 1}, requests)
+
+	// Exceeding the budget fails
+	limited = 1
+	retryAfter = "3600"
+	requests = map[string]int{}
+	_, err = c.makeRequest(context.Background(), "GET", "/v2/", nil, nil, noAuth)
+	assert.Equal(t, TooManyRequestsError{Registry: c.registry, RetryAfter: time.Hour}, err)
+	assert.Contains(t, err.Error(), "retry after 1h0m0s")
+	assert.Equal(t, map[string]int{"GET": 1}, requests)
+
+	c.sys = &types.SystemContext{DockerRegistryRateLimitBudget: 10 * time.Millisecond}
+	limited = 100
+	retryAfter = ""
+	requests = map[string]int{}
+	_, err = c.makeRequest(context.Background(), "GET", "/v2/", nil, nil, noAuth)
+	assert.Equal(t, TooManyRequestsError{Registry: c.registry}, err)
+	assert.Equal(t, "too many requests to registry "+c.registry, err.Error())
+	assert.Equal(t, map[string]int{"GET": 11}, requests)
+
+	// A negative budget disables waiting
+	c.sys = &types.SystemContext{DockerRegistryRateLimitBudget: -1}
+	limited = 1
+	retryAfter = "0"
+	requests = map[string]int{}
+	_, err = c.makeRequest(context.Background(), "GET", "/v2/", nil, nil, noAuth)
+	assert.IsType(t, TooManyRequestsError{}, err)
+	assert.Equal(t, map[string]int{"GET": 1}, requests)
+}
+
+func TestDockerClientGetBearerTokenUsingIdentityToken(t *testing.T) {
+	oauth2Supported := true
+	var requests []string
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method)
+		switch r.Method {
+		case "POST":
+			if !oauth2Supported {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+			assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+			assert.Equal(t, oauth2ClientID, r.PostForm.Get("client_id"))
+			assert.Equal(t, "registry.example.com", r.PostForm.Get("service"))
+			assert.Equal(t, "repository:ns/repo:pull", r.PostForm.Get("scope"))
+			if r.PostForm.Get("refresh_token") != "identity" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"oauth2-token","expires_in":3600}`)
+		case "GET":
+			fmt.Fprint(w, `{"token":"basic-token","expires_in":3600}`)
+		}
+	}))
+	defer authServer.Close()
+
+	c := &dockerClient{identityToken: "identity"}
+	token, err := c.getBearerToken(context.Background(), authServer.URL, "registry.example.com", "repository:ns/repo:pull")
+	require.NoError(t, err)
+	assert.Equal(t, "oauth2-token", token.Token)
+	assert.Equal(t, []string{"POST"}, requests)
+
+	// An invalid identity token is rejected
+	requests = nil
+	c = &dockerClient{identityToken: "invalid"}
+	_, err = c.getBearerToken(context.Background(), authServer.URL, "registry.example.com", "repository:ns/repo:pull")
+	assert.Equal(t, ErrUnauthorizedForCredentials, err)
+	assert.Equal(t, []string{"POST"}, requests)
+
+	// Token servers without OAuth2 support are used with a GET request
+	oauth2Supported = false
+	requests = nil
+	c = &dockerClient{identityToken: "identity"}
+	token, err = c.getBearerToken(context.Background(), authServer.URL, "registry.example.com", "repository:ns/repo:pull")
+	require.NoError(t, err)
+	assert.Equal(t, "basic-token", token.Token)
+	assert.Equal(t, []string{"POST", "GET"}, requests)
+
+	// Without an identity token, OAuth2 is not used at all
+	requests = nil
+	c = &dockerClient{username: "user", password: "password"}
+	token, err = c.getBearerToken(context.Background(), authServer.URL, "registry.example.com", "repository:ns/repo:pull")
+	require.NoError(t, err)
+	assert.Equal(t, "basic-token", token.Token)
+	assert.Equal(t, []string{"GET"}, requests)
+}
+
+func TestDockerClientTokenServerTLS(t *testing.T) {
+	authServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"oauth2-token","expires_in":3600}`)
+	}))
+	defer authServer.Close()
+
+	// The token server certificate is verified…
+	c := &dockerClient{identityToken: "identity", tlsClientConfig: serverDefault()}
+	_, err := c.getBearerToken(context.Background(), authServer.URL, "registry.example.com", "repository:ns/repo:pull")
+	assert.Error(t, err)
+	// … unless TLS verification is disabled for the registry
+	c.allowInsecure()
+	token, err := c.getBearerToken(context.Background(), authServer.URL, "registry.example.com", "repository:ns/repo:pull")
+	require.NoError(t, err)
+	assert.Equal(t, "oauth2-token", token.Token)
+}
+
+func TestNextPagePath(t *testing.T) {
+	for _, c := range []struct {
+		links    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{`</v2/ns/repo/tags/list?last=b&n=2>; rel="next"`}, "/v2/ns/repo/tags/list?last=b&n=2"},
+		{[]string{`<https://registry.example.com/v2/_catalog?last=b>; rel="next"`}, "/v2/_catalog?last=b"},
+		{[]string{`</v2/_catalog?last=b>`}, "/v2/_catalog?last=b"}, // No rel
+		{[]string{`</v2/_catalog?n=2>; rel=prev, </v2/_catalog?last=b>; rel=next`}, "/v2/_catalog?last=b"},
+		{[]string{`</v2/_catalog?n=2>; rel="prev"`, `</v2/_catalog?last=b>; Rel="next"`}, "/v2/_catalog?last=b"},
+		{[]string{`</v2/_catalog?n=2>; rel="prev"`}, ""},
+	} {
+		path, err := nextPagePath(http.Header{"Link": c.links})
+		require.NoError(t, err, "%#v", c.links)
+		assert.Equal(t, c.expected, path, "%#v", c.links)
+	}
+
+	for _, link := range []string{
+		`/v2/_catalog?last=b; rel="next"`, // Not enclosed in <>
+		`<:not a URL>; rel="next"`,
+	} {
+		_, err := nextPagePath(http.Header{"Link": []string{link}})
+		assert.Error(t, err, link)
+	}
+}
+
+func TestGetRepositoryTags(t *testing.T) {
+	pages := map[string]struct {
+		tags []string
+		link string
+	}{
+		"":  {[]string{"a", "b"}, `</v2/ns/repo/tags/list?last=b&n=2>; rel="next"`},
+		"b": {[]string{"c", "d"}, `<http://other.example.com/v2/ns/repo/tags/list?last=d&n=2>; rel="next"`},
+		"d": {[]string{"e"}, ""},
+	}
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/ns/repo/tags/list":
+			requests = append(requests, r.URL.RawQuery)
+			page, ok := pages[r.URL.Query().Get("last")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if page.link != "" {
+				w.Header().Set("Link", page.link)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "ns/repo", "tags": page.tags})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[{"code":"NAME_UNKNOWN","message":"repository name not known to registry"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "repository-tags")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+		RegistriesDirPath:           tmpDir,
+		DockerInsecureSkipTLSVerify: true,
+	}
+
+	ref, err := ParseReference("//" + server.Listener.Addr().String() + "/ns/repo:tag")
+	require.NoError(t, err)
+	tags, err := GetRepositoryTags(context.Background(), sys, ref)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, tags)
+	assert.Equal(t, []string{"", "last=b&n=2", "last=d&n=2"}, requests)
+
+	ref, err = ParseReference("//" + server.Listener.Addr().String() + "/ns/unknown:tag")
+	require.NoError(t, err)
+	_, err = GetRepositoryTags(context.Background(), sys, ref)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "name unknown")
+}
+
+func TestGetRepositories(t *testing.T) {
+	var scopes []string
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		scopes = append(scopes, r.URL.Query().Get("scope"))
+		fmt.Fprint(w, `{"token":"catalog-token"}`)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer catalog-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/_catalog" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/_catalog?last=ns%2Fb&n=2>; rel="next"`)
+			fmt.Fprint(w, `{"repositories":["ns/a","ns/b"]}`)
+		case r.URL.Path == "/v2/_catalog" && r.URL.Query().Get("last") == "ns/b":
+			fmt.Fprint(w, `{"repositories":["other/c"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tmpDir, err := ioutil.TempDir("", "repositories")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+		DockerInsecureSkipTLSVerify: true,
+	}
+
+	registry := server.Listener.Addr().String()
+	repos, err := GetRepositories(context.Background(), sys, registry)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ns/a", "ns/b", "other/c"}, repos)
+	assert.Equal(t, []string{"registry:catalog:*"}, scopes)
+
+	// SearchRegistry falls back to the catalog, and filters it
+	results, err := SearchRegistry(context.Background(), sys, registry, "ns/", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []SearchResult{{Name: "ns/a"}, {Name: "ns/b"}}, results)
+
+	// Blocked registries are not contacted
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	err = ioutil.WriteFile(sys.SystemRegistriesConfPath, []byte(fmt.Sprintf("[[registry]]\nurl = \"localhost:%d\"\nblocked = true\n", port)), 0600)
+	require.NoError(t, err)
+	_, err = GetRepositories(context.Background(), sys, fmt.Sprintf("localhost:%d", port))
+	assert.Equal(t, BlockedRegistryError{Registry: fmt.Sprintf("localhost:%d", port)}, err)
+}
+
+func TestDockerClientConcurrentDetectProperties(t *testing.T) {
+	var mutex sync.Mutex
+	pings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			mutex.Lock()
+			pings++
+			mutex.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "concurrent-detect-properties")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+		RegistriesDirPath:           tmpDir,
+		DockerInsecureSkipTLSVerify: true,
+		// Use credentials unique to this test, so that the connection is not shared with other tests.
+		DockerAuthConfig: &types.DockerAuthConfig{Username: t.Name(), Password: "password"},
+	}
+	ref, err := ParseReference("//" + server.Listener.Addr().String() + "/ns/repo:tag")
+	require.NoError(t, err)
+	c, err := newDockerClientFromRef(sys, ref.(dockerReference), true, "pull,push")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := c.makeRequest(context.Background(), "GET", "/v2/ns/repo/tags/list", nil, nil, v2Auth)
+			if assert.NoError(t, err) {
+				res.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, pings)
+	assert.Equal(t, "http", c.scheme)
+}
+
+func TestDockerClientRequestHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		expected map[string][]string
+	}{
+		{nil, map[string][]string{"User-Agent": {"Go-http-client/1.1"}, "Accept": {"application/json"}}},
+		{
+			&types.SystemContext{DockerRegistryUserAgent: "test-agent/1.0"},
+			map[string][]string{"User-Agent": {"test-agent/1.0"}},
+		},
+		{
+			&types.SystemContext{DockerRegistryHeaders: map[string][]string{"x-tenant": {"tenant1"}, "X-Multiple": {"a", "b"}}},
+			map[string][]string{"X-Tenant": {"tenant1"}, "X-Multiple": {"a", "b"}, "Accept": {"application/json"}},
+		},
+		{ // Headers set by the library take precedence
+			&types.SystemContext{
+				DockerRegistryUserAgent: "test-agent/1.0",
+				DockerRegistryHeaders:   map[string][]string{"User-Agent": {"other"}, "accept": {"text/plain"}, "X-Tenant": {"tenant1"}},
+			},
+			map[string][]string{"User-Agent": {"test-agent/1.0"}, "Accept": {"application/json"}, "X-Tenant": {"tenant1"}},
+		},
+	} {
+		c1 := &dockerClient{sys: c.sys, registry: server.Listener.Addr().String(), client: server.Client(), scheme: "http"}
+		res, err := c1.makeRequest(context.Background(), "GET", "/v2/", map[string][]string{"Accept": {"application/json"}}, nil, v2Auth)
+		require.NoError(t, err)
+		res.Body.Close()
+		for n, v := range c.expected {
+			assert.Equal(t, v, received[n], n)
+		}
+	}
+}
+
+func TestParseWarningHeader(t *testing.T) {
+	for _, c := range []struct {
+		header, expected string
+	}{
+		{`299 - "Deprecated"`, "Deprecated"},
+		{`299 - "Escaped \"quotes\""`, `Escaped "quotes"`},
+		{`299 - "With a date" "Sat, 25 Aug 2012 23:34:45 GMT"`, "With a date"},
+		{`  299   -   "Extra spaces"`, "Extra spaces"},
+		{`199 - "Other code"`, ""},
+		{`299 registry.example.com "With an agent"`, ""},
+		{`299 - Unquoted`, ""},
+		{`299 - ""`, ""},
+		{`299 - "Unterminated`, ""},
+		{`299-"No spaces"`, ""},
+		{"", ""},
+	} {
+		text, ok := parseWarningHeader(c.header)
+		if c.expected == "" {
+			assert.False(t, ok, c.header)
+		} else {
+			assert.True(t, ok, c.header)
+			assert.Equal(t, c.expected, text, c.header)
+		}
+	}
+}
+
+func TestDockerClientReportResponseWarnings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Warning", `299 - "Warning 1"`)
+		w.Header().Add("Warning", `299 - "Warning 2"`)
+		w.Header().Add("Warning", `199 - "Ignored"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var warnings []string
+	sys := &types.SystemContext{DockerRegistryWarnings: func(warning string) {
+		warnings = append(warnings, warning)
+	}}
+	c := &dockerClient{sys: sys, registry: server.Listener.Addr().String(), client: server.Client(), scheme: "http"}
+	for i := 0; i < 2; i++ {
+		res, err := c.makeRequest(context.Background(), "GET", "/v2/", nil, nil, v2Auth)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+	// Each warning is reported only once
+	assert.Equal(t, []string{"Warning 1", "Warning 2"}, warnings)
+}
+
+func TestGetDigest(t *testing.T) {
+	const manifestDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		methods = append(methods, r.Method)
+		assert.Contains(t, r.Header["Accept"], "application/vnd.docker.distribution.manifest.v2+json")
+		switch r.URL.Path {
+		case "/v2/ns/repo/manifests/tag":
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			w.WriteHeader(http.StatusOK)
+		case "/v2/ns/repo/manifests/invalid":
+			w.Header().Set("Docker-Content-Digest", "this is not a digest")
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "get-digest")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+		RegistriesDirPath:           tmpDir,
+		DockerInsecureSkipTLSVerify: true,
+	}
+	getDigest := func(refSuffix string) (string, error) {
+		ref, err := ParseReference("//" + server.Listener.Addr().String() + "/ns/repo" + refSuffix)
+		require.NoError(t, err)
+		d, err := GetDigest(context.Background(), sys, ref)
+		return d.String(), err
+	}
+
+	d, err := getDigest(":tag")
+	require.NoError(t, err)
+	assert.Equal(t, manifestDigest, d)
+	assert.Equal(t, []string{"HEAD"}, methods)
+
+	// Digested references are returned without contacting the registry
+	d, err = getDigest("@" + manifestDigest)
+	require.NoError(t, err)
+	assert.Equal(t, manifestDigest, d)
+	assert.Equal(t, []string{"HEAD"}, methods)
+
+	for _, suffix := range []string{":missing", ":invalid"} {
+		_, err = getDigest(suffix)
+		assert.Error(t, err, suffix)
+	}
+
+	// Only docker references are supported
+	_, err = GetDigest(context.Background(), sys, nil)
+	assert.Error(t, err)
+}
@@ -2,15 +2,15 @@ package docker
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strings"
 
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/image"
+	"github.com/containers/image/manifest"
 	"github.com/containers/image/types"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 )
 
@@ -25,7 +25,7 @@ type Image struct {
 // a client to the registry hosting the given image.
 // The caller must call .Close() on the returned Image.
 func newImage(ctx context.Context, sys *types.SystemContext, ref dockerReference) (types.ImageCloser, error) {
-	s, err := newImageSource(sys, ref)
+	s, err := newImageSource(ctx, sys, ref)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +41,17 @@ func (i *Image) SourceRefFullName() string {
 	return i.src.ref.ref.Name()
 }
 
+// Schema1SigningKeys returns the public keys which created the embedded JWS signatures of the image's manifest,
+// after verifying the signatures.  It fails if the manifest is not a signed Docker schema1 manifest,
+// or if any of the signatures is invalid.  It is up to the caller to decide whether the keys are trusted.
+func (i *Image) Schema1SigningKeys(ctx context.Context) ([]libtrust.PublicKey, error) {
+	manblob, _, err := i.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.VerifyV2S1Signatures(manblob)
+}
+
 // GetRepositoryTags list all tags available in the repository. The tag
 // provided inside the ImageReference will be ignored. (This is a
 // backward-compatible shim method which calls the module-level
@@ -62,46 +73,58 @@ func GetRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create client")
 	}
+	defer client.Close()
 
 	tags := make([]string, 0)
-
-	for {
-		res, err := client.makeRequest(ctx, "GET", path, nil, nil, v2Auth)
-		if err != nil {
-			return nil, err
-		}
-		defer res.Body.Close()
-		if res.StatusCode != http.StatusOK {
-			// print url also
-			return nil, errors.Errorf("Invalid status code returned when fetching tags list %d (%s)", res.StatusCode, http.StatusText(res.StatusCode))
-		}
-
+	for path != "" {
 		var tagsHolder struct {
 			Tags []string
 		}
-		if err = json.NewDecoder(res.Body).Decode(&tagsHolder); err != nil {
-			return nil, err
+		path, err = client.getListPage(ctx, path, &tagsHolder)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error fetching tags list of %s", dr.ref.Name())
 		}
 		tags = append(tags, tagsHolder.Tags...)
+	}
+	return tags, nil
+}
 
-		link := res.Header.Get("Link")
-		if link == "" {
-			break
-		}
-
-		linkURLStr := strings.Trim(strings.Split(link, ";")[0], "<>")
-		linkURL, err := url.Parse(linkURLStr)
-		if err != nil {
-			return tags, err
-		}
+// GetDigest returns the digest of the manifest ref refers to, as reported by the registry in response to a HEAD request,
+// i.e. without downloading the manifest.  This is useful e.g. to check whether a local copy of a tagged image is up to date;
+// if the manifest is going to be downloaded anyway, it is more efficient to compute the digest from it.
+// If ref contains a digest, it is returned without contacting the registry.
+// Note that this does not use any mirrors configured for ref.
+func GetDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (digest.Digest, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return "", errors.Errorf("ref must be a dockerReference")
+	}
+	if digested, ok := dr.ref.(reference.Digested); ok {
+		return digested.Digest(), nil
+	}
+	tagOrDigest, err := dr.tagOrDigest()
+	if err != nil {
+		return "", err
+	}
 
-		// can be relative or absolute, but we only want the path (and I
-		// guess we're in trouble if it forwards to a new place...)
-		path = linkURL.Path
-		if linkURL.RawQuery != "" {
-			path += "?"
-			path += linkURL.RawQuery
-		}
+	c, err := newDockerClientFromRef(sys, dr, false, "pull")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create client")
 	}
-	return tags, nil
+	defer c.Close()
+	path := fmt.Sprintf(manifestPath, reference.Path(dr.ref), tagOrDigest)
+	headers := map[string][]string{"Accept": manifest.DefaultRequestedManifestMIMETypes}
+	res, err := c.makeRequest(ctx, "HEAD", path, headers, nil, v2Auth)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Wrapf(registryHTTPResponseToError(res), "Error reading digest %s in %s", tagOrDigest, dr.ref.Name())
+	}
+	d, err := digest.Parse(res.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid Docker-Content-Digest header for %s in %s", tagOrDigest, dr.ref.Name())
+	}
+	return d, nil
 }
@@ -12,25 +12,66 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/containers/image/docker/reference"
-	"github.com/containers/image/internal/iolimits"
+	internalsig "github.com/containers/image/internal/signature"
 	"github.com/containers/image/manifest"
+	"github.com/containers/image/pkg/docker/config"
+	"github.com/containers/image/pkg/tlsclientconfig"
 	"github.com/containers/image/types"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
-	"github.com/docker/distribution/registry/client"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// BlobUploadAbortedError is returned by PutBlob when sending the data of a blob to the registry failed.
+// The upload session has been cancelled.
+type BlobUploadAbortedError struct {
+	Err error
+}
+
+func (e BlobUploadAbortedError) Error() string {
+	return fmt.Sprintf("blob upload aborted: %v", e.Err)
+}
+
+// Cause returns the underlying error, for use by errors.Cause.
+func (e BlobUploadAbortedError) Cause() error {
+	return e.Err
+}
+
+// BlobUploadCommitFailedError is returned by PutBlob when all data of a blob was sent, but the registry did not accept
+// the completed upload (e.g. because the digest did not match). The upload session has been cancelled.
+type BlobUploadCommitFailedError struct {
+	Err error
+}
+
+func (e BlobUploadCommitFailedError) Error() string {
+	return fmt.Sprintf("committing blob upload failed: %v", e.Err)
+}
+
+// Cause returns the underlying error, for use by errors.Cause.
+func (e BlobUploadCommitFailedError) Cause() error {
+	return e.Err
+}
+
+// blobUploadCancelTimeout is the maximum time spent cancelling a failed upload session.
+const blobUploadCancelTimeout = 30 * time.Second
+
 type dockerImageDestination struct {
 	ref dockerReference
 	c   *dockerClient
 	// State
-	manifestDigest digest.Digest // or "" if not yet known.
+	manifestDigest   digest.Digest // or "" if not yet known.
+	manifestMIMEType string        // Only valid if manifestDigest != ""
+	manifestSize     int64         // Only valid if manifestDigest != ""
+	// Manifests written by PutInstanceManifest, indexed by digest; nil if none were written
+	instanceManifests map[digest.Digest]imgspecv1.Descriptor
 }
 
 // newImageDestination creates a new ImageDestination for the specified image reference.
@@ -53,6 +94,7 @@ func (d *dockerImageDestination) Reference() types.ImageReference {
 
 // Close removes resources associated with an initialized ImageDestination, if any.
 func (d *dockerImageDestination) Close() error {
+	d.c.Close()
 	return nil
 }
 
@@ -62,6 +104,7 @@ func (d *dockerImageDestination) SupportedManifestMIMETypes() []string {
 		manifest.DockerV2Schema2MediaType,
 		manifest.DockerV2Schema1SignedMediaType,
 		manifest.DockerV2Schema1MediaType,
+		// Manifest lists are not listed here, they can only be written as described in types.ManifestListDestination.
 	}
 }
 
@@ -76,6 +119,8 @@ func (d *dockerImageDestination) SupportsSignatures(ctx context.Context) error {
 		return nil
 	case d.c.supportsSignatures:
 		return nil
+	case d.c.useSigstoreAttachments:
+		return nil
 	default:
 		return errors.Errorf("X-Registry-Supports-Signatures extension not supported, and lookaside is not configured")
 	}
@@ -103,6 +148,11 @@ func (d *dockerImageDestination) IgnoresEmbeddedDockerReference() bool {
 	return false // We do want the manifest updated; older registry versions refuse manifests if the embedded reference does not match.
 }
 
+// HasThreadSafePutBlob indicates whether PutBlob, HasBlob and ReapplyBlob can be called concurrently.
+func (d *dockerImageDestination) HasThreadSafePutBlob() bool {
+	return true
+}
+
 // sizeCounter is an io.Writer which only counts the total size of its input.
 type sizeCounter struct{ size int64 }
 
@@ -128,17 +178,32 @@ func (d *dockerImageDestination) PutBlob(ctx context.Context, stream io.Reader,
 		}
 	}
 
-	// FIXME? Chunked upload, progress reporting, etc.
+	stream = d.c.progressReader(stream, inputInfo)
+	if threshold := d.singleRequestUploadThreshold(); threshold > 0 && (inputInfo.Size == -1 || inputInfo.Size <= threshold) {
+		data, err := ioutil.ReadAll(io.LimitReader(stream, threshold+1))
+		if err != nil {
+			return types.BlobInfo{}, BlobUploadAbortedError{Err: err}
+		}
+		if int64(len(data)) <= threshold {
+			info, done, err := d.putBlobSingleRequest(ctx, data)
+			if err != nil || done {
+				return info, err
+			}
+		}
+		stream = io.MultiReader(bytes.NewReader(data), stream)
+	}
+
 	uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref))
 	logrus.Debugf("Uploading %s", uploadPath)
-	res, err := d.c.makeRequest(ctx, "POST", uploadPath, nil, nil, v2Auth)
+	// Starting an upload only creates an upload session, so it is safe to retry.
+	res, err := d.c.makeRetriedRequest(ctx, "POST", uploadPath, nil, v2Auth)
 	if err != nil {
 		return types.BlobInfo{}, err
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusAccepted {
 		logrus.Debugf("Error initiating layer upload, response %#v", *res)
-		return types.BlobInfo{}, errors.Wrapf(client.HandleErrorResponse(res), "Error initiating layer upload to %s in %s", uploadPath, d.c.registry)
+		return types.BlobInfo{}, errors.Wrapf(registryHTTPResponseToError(res), "Error initiating layer upload to %s in %s", uploadPath, d.c.registry)
 	}
 	uploadLocation, err := res.Location()
 	if err != nil {
@@ -148,39 +213,270 @@ func (d *dockerImageDestination) PutBlob(ctx context.Context, stream io.Reader,
 	digester := digest.Canonical.Digester()
 	sizeCounter := &sizeCounter{}
 	tee := io.TeeReader(stream, io.MultiWriter(digester.Hash(), sizeCounter))
-	res, err = d.c.makeRequestToResolvedURL(ctx, "PATCH", uploadLocation.String(), map[string][]string{"Content-Type": {"application/octet-stream"}}, tee, inputInfo.Size, v2Auth)
-	if err != nil {
-		logrus.Debugf("Error uploading layer chunked, response %#v", res)
-		return types.BlobInfo{}, err
+	if d.c.sys != nil && d.c.sys.DockerRegistryUploadChunkSize > 0 {
+		uploadLocation, err = d.uploadBlobChunks(ctx, uploadLocation, tee, d.c.sys.DockerRegistryUploadChunkSize)
+	} else {
+		uploadLocation, err = d.uploadBlobMonolithic(ctx, uploadLocation, tee, inputInfo.Size)
 	}
-	defer res.Body.Close()
-	computedDigest := digester.Digest()
-
-	uploadLocation, err = res.Location()
 	if err != nil {
-		return types.BlobInfo{}, errors.Wrap(err, "Error determining upload URL")
+		d.cancelBlobUpload(uploadLocation)
+		return types.BlobInfo{}, BlobUploadAbortedError{Err: err}
 	}
+	computedDigest := digester.Digest()
 
-	// FIXME: DELETE uploadLocation on failure
-
-	locationQuery := uploadLocation.Query()
+	commitLocation := *uploadLocation
+	locationQuery := commitLocation.Query()
 	// TODO: check inputInfo.Digest == computedDigest https://github.com/containers/image/pull/70#discussion_r77646717
 	locationQuery.Set("digest", computedDigest.String())
-	uploadLocation.RawQuery = locationQuery.Encode()
-	res, err = d.c.makeRequestToResolvedURL(ctx, "PUT", uploadLocation.String(), map[string][]string{"Content-Type": {"application/octet-stream"}}, nil, -1, v2Auth)
+	commitLocation.RawQuery = locationQuery.Encode()
+	res, err = d.c.makeRequestToResolvedURL(ctx, "PUT", commitLocation.String(), map[string][]string{"Content-Type": {"application/octet-stream"}}, nil, -1, v2Auth)
 	if err != nil {
-		return types.BlobInfo{}, err
+		d.cancelBlobUpload(uploadLocation)
+		return types.BlobInfo{}, BlobUploadCommitFailedError{Err: err}
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusCreated {
 		logrus.Debugf("Error uploading layer, response %#v", *res)
-		return types.BlobInfo{}, errors.Wrapf(client.HandleErrorResponse(res), "Error uploading layer to %s", uploadLocation)
+		err := errors.Wrapf(registryHTTPResponseToError(res), "Error uploading layer to %s", commitLocation.String())
+		d.cancelBlobUpload(uploadLocation)
+		return types.BlobInfo{}, BlobUploadCommitFailedError{Err: err}
 	}
 
 	logrus.Debugf("Upload of layer %s complete", computedDigest)
 	return types.BlobInfo{Digest: computedDigest, Size: sizeCounter.size}, nil
 }
 
+// singleRequestUploadThreshold returns the maximum size of a blob uploaded using putBlobSingleRequest, or 0 if such uploads are disabled.
+func (d *dockerImageDestination) singleRequestUploadThreshold() int64 {
+	if d.c.sys == nil || d.c.sys.DockerRegistrySingleRequestUploadThreshold < 0 {
+		return 0
+	}
+	return d.c.sys.DockerRegistrySingleRequestUploadThreshold
+}
+
+// putBlobSingleRequest uploads data using a single POST request containing the blob, instead of creating an upload session first,
+// and returns the uploaded blob.
+// Registries which do not support this may ignore the data and create an upload session anyway; the data is then sent
+// to that session in a single PUT request.
+// If the registry rejects the request, putBlobSingleRequest returns false, and the caller should upload data using an upload session.
+func (d *dockerImageDestination) putBlobSingleRequest(ctx context.Context, data []byte) (types.BlobInfo, bool, error) {
+	blobDigest := digest.FromBytes(data)
+	info := types.BlobInfo{Digest: blobDigest, Size: int64(len(data))}
+	query := url.Values{}
+	query.Set("digest", blobDigest.String())
+	uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref)) + "?" + query.Encode()
+	logrus.Debugf("Uploading %s in a single request", uploadPath)
+	res, err := d.c.makeRequest(ctx, "POST", uploadPath, map[string][]string{"Content-Type": {"application/octet-stream"}}, bytes.NewReader(data), v2Auth)
+	if err != nil {
+		return types.BlobInfo{}, false, BlobUploadAbortedError{Err: err}
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusCreated:
+		logrus.Debugf("Upload of layer %s complete", blobDigest)
+		return info, true, nil
+	case http.StatusAccepted:
+		break
+	default:
+		logrus.Debugf("Single-request upload of %s rejected, status %d; using an upload session", blobDigest, res.StatusCode)
+		return types.BlobInfo{}, false, nil
+	}
+
+	// The registry has ignored the data and created an upload session.
+	uploadLocation, err := res.Location()
+	if err != nil {
+		return types.BlobInfo{}, false, errors.Wrap(err, "Error determining upload URL")
+	}
+	commitLocation := *uploadLocation
+	locationQuery := commitLocation.Query()
+	locationQuery.Set("digest", blobDigest.String())
+	commitLocation.RawQuery = locationQuery.Encode()
+	res2, err := d.c.makeRequestToResolvedURL(ctx, "PUT", commitLocation.String(), map[string][]string{"Content-Type": {"application/octet-stream"}}, bytes.NewReader(data), int64(len(data)), v2Auth)
+	if err != nil {
+		d.cancelBlobUpload(uploadLocation)
+		return types.BlobInfo{}, false, BlobUploadAbortedError{Err: err}
+	}
+	defer res2.Body.Close()
+	if res2.StatusCode != http.StatusCreated {
+		logrus.Debugf("Error uploading layer, response %#v", *res2)
+		err := errors.Wrapf(registryHTTPResponseToError(res2), "Error uploading layer to %s", commitLocation.String())
+		d.cancelBlobUpload(uploadLocation)
+		return types.BlobInfo{}, false, BlobUploadCommitFailedError{Err: err}
+	}
+	logrus.Debugf("Upload of layer %s complete", blobDigest)
+	return info, true, nil
+}
+
+// uploadBlobMonolithic uploads stream, of size bytes (or -1 if unknown), to uploadLocation in a single request,
+// and returns the location to use for the next step of the upload.
+// If size is known, it is sent as Content-Length; chunked transfer encoding, which some registries and proxies
+// handle poorly, is only used if the size is not known.
+// On failure, it returns uploadLocation, to allow cancelling the upload.
+func (d *dockerImageDestination) uploadBlobMonolithic(ctx context.Context, uploadLocation *url.URL, stream io.Reader, size int64) (*url.URL, error) {
+	res, err := d.c.makeRequestToResolvedURL(ctx, "PATCH", uploadLocation.String(), map[string][]string{"Content-Type": {"application/octet-stream"}}, stream, size, v2Auth)
+	if err != nil {
+		return uploadLocation, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		logrus.Debugf("Error uploading layer, response %#v", *res)
+		return uploadLocation, errors.Wrapf(registryHTTPResponseToError(res), "Error uploading layer to %s", uploadLocation)
+	}
+	nextLocation, err := res.Location()
+	if err != nil {
+		return uploadLocation, errors.Wrap(err, "Error determining upload URL")
+	}
+	return nextLocation, nil
+}
+
+// cancelBlobUpload cancels the upload session at uploadLocation, so that the registry can reclaim the space
+// used by the partially uploaded data. The upload has already failed, so errors are only logged.
+func (d *dockerImageDestination) cancelBlobUpload(uploadLocation *url.URL) {
+	// The context of the upload may have been cancelled, which is a likely cause of the failure; use a new one.
+	ctx, cancel := context.WithTimeout(context.Background(), blobUploadCancelTimeout)
+	defer cancel()
+	logrus.Debugf("Cancelling upload %s", uploadLocation)
+	res, err := d.c.makeRequestToResolvedURL(ctx, "DELETE", uploadLocation.String(), nil, nil, -1, v2Auth)
+	if err != nil {
+		logrus.Debugf("Error cancelling upload %s: %v", uploadLocation, err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		logrus.Debugf("Error cancelling upload %s: %v", uploadLocation, registryHTTPResponseToError(res))
+	}
+}
+
+// uploadBlobChunks uploads stream to uploadLocation in chunks of at most chunkSize bytes,
+// and returns the location to use for the next step of the upload.
+// On failure, it returns the most recent location of the upload, to allow cancelling it.
+func (d *dockerImageDestination) uploadBlobChunks(ctx context.Context, uploadLocation *url.URL, stream io.Reader, chunkSize int64) (*url.URL, error) {
+	buf := make([]byte, chunkSize)
+	offset := int64(0)
+	for {
+		n, err := io.ReadFull(stream, buf)
+		switch err {
+		case nil, io.ErrUnexpectedEOF:
+		case io.EOF:
+			return uploadLocation, nil
+		default:
+			return uploadLocation, err
+		}
+		uploadLocation, err = d.uploadBlobChunk(ctx, uploadLocation, buf[:n], offset)
+		if err != nil {
+			return uploadLocation, err
+		}
+		offset += int64(n)
+		if n < len(buf) {
+			return uploadLocation, nil
+		}
+	}
+}
+
+// uploadBlobChunk uploads chunk, starting at offset within the blob, to uploadLocation,
+// resuming the upload from the offset reported by the registry after transient failures.
+// It returns the location to use for the next step of the upload; on failure, the most recent location of the upload.
+func (d *dockerImageDestination) uploadBlobChunk(ctx context.Context, uploadLocation *url.URL, chunk []byte, offset int64) (*url.URL, error) {
+	maxRetries := d.c.maxRetries()
+	sent := int64(0)
+	for attempt := 0; ; attempt++ {
+		nextLocation, transient, err := d.patchBlobChunk(ctx, uploadLocation, chunk[sent:], offset+sent)
+		if err == nil {
+			return nextLocation, nil
+		}
+		if !transient || attempt >= maxRetries || ctx.Err() != nil {
+			return uploadLocation, err
+		}
+		logrus.Debugf("Error uploading a chunk at offset %d, trying to resume: %v", offset+sent, err)
+		if sleepErr := sleepBeforeRetry(ctx, attempt+1); sleepErr != nil {
+			return uploadLocation, sleepErr
+		}
+
+		statusLocation, received, statusErr := d.blobUploadStatus(ctx, uploadLocation)
+		if statusErr != nil {
+			return uploadLocation, errors.Wrapf(err, "Error resuming upload (%v)", statusErr)
+		}
+		if received < offset || received > offset+int64(len(chunk)) {
+			return statusLocation, errors.Wrapf(err, "Error resuming upload: registry has received %d bytes, expected between %d and %d", received, offset, offset+int64(len(chunk)))
+		}
+		uploadLocation = statusLocation
+		sent = received - offset
+		if sent == int64(len(chunk)) {
+			return uploadLocation, nil
+		}
+	}
+}
+
+// patchBlobChunk uploads chunk, starting at offset within the blob, to uploadLocation,
+// and returns the location to use for the next step of the upload.
+// On failure, it also returns true if the failure may be transient and the upload may be resumed.
+func (d *dockerImageDestination) patchBlobChunk(ctx context.Context, uploadLocation *url.URL, chunk []byte, offset int64) (*url.URL, bool, error) {
+	headers := map[string][]string{
+		"Content-Type":  {"application/octet-stream"},
+		"Content-Range": {fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1)},
+	}
+	res, err := d.c.makeRequestToResolvedURL(ctx, "PATCH", uploadLocation.String(), headers, bytes.NewReader(chunk), int64(len(chunk)), v2Auth)
+	if err != nil {
+		return nil, isTransientFailure(ctx, nil, err), err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		logrus.Debugf("Error uploading a chunk, response %#v", *res)
+		return nil, isTransientFailure(ctx, res, nil),
+			errors.Wrapf(registryHTTPResponseToError(res), "Error uploading a chunk at offset %d to %s", offset, uploadLocation)
+	}
+	nextLocation, err := res.Location()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "Error determining upload URL")
+	}
+	return nextLocation, false, nil
+}
+
+// blobUploadStatus returns the location to use for the next step of an upload at uploadLocation,
+// and the number of bytes received by the registry so far.
+func (d *dockerImageDestination) blobUploadStatus(ctx context.Context, uploadLocation *url.URL) (*url.URL, int64, error) {
+	res, err := d.c.makeRequestToResolvedURL(ctx, "GET", uploadLocation.String(), nil, nil, -1, v2Auth)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return nil, -1, errors.Wrapf(registryHTTPResponseToError(res), "Error reading upload status of %s", uploadLocation)
+	}
+	received, err := parseUploadRange(res.Header.Get("Range"))
+	if err != nil {
+		return nil, -1, err
+	}
+	nextLocation, err := res.Location()
+	if err != nil {
+		return nil, -1, errors.Wrap(err, "Error determining upload URL")
+	}
+	return nextLocation, received, nil
+}
+
+// parseUploadRange parses a Range header value of an upload status response, "0-$end",
+// and returns the number of bytes received by the registry.
+// docker/distribution reports "0-0" both after receiving no data and after receiving a single byte;
+// we return 0 in that case, so that the data is sent again (and rejected if the registry already has it)
+// instead of being silently skipped.
+func parseUploadRange(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 || parts[0] != "0" {
+		return -1, errors.Errorf("Invalid upload Range header %q", value)
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || end < -1 {
+		return -1, errors.Errorf("Invalid upload Range header %q", value)
+	}
+	if end <= 0 {
+		return 0, nil
+	}
+	return end + 1, nil
+}
+
 // HasBlob returns true iff the image destination already contains a blob with the matching digest which can be reapplied using ReapplyBlob.
 // Unlike PutBlob, the digest can not be empty.  If HasBlob returns true, the size of the blob must also be returned.
 // If the destination does not contain the blob, or it is unknown, HasBlob ordinarily returns (false, -1, nil);
@@ -203,7 +499,7 @@ func (d *dockerImageDestination) HasBlob(ctx context.Context, info types.BlobInf
 		return true, getBlobSize(res), nil
 	case http.StatusUnauthorized:
 		logrus.Debugf("... not authorized")
-		return false, -1, errors.Wrapf(client.HandleErrorResponse(res), "Error checking whether a blob %s exists in %s", info.Digest, d.ref.ref.Name())
+		return false, -1, errors.Wrapf(registryHTTPResponseToError(res), "Error checking whether a blob %s exists in %s", info.Digest, d.ref.ref.Name())
 	case http.StatusNotFound:
 		logrus.Debugf("... not present")
 		return false, -1, nil
@@ -220,21 +516,57 @@ func (d *dockerImageDestination) ReapplyBlob(ctx context.Context, info types.Blo
 // FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
 // If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
 // but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+// m may be a manifest list, if all instances it references were written using PutInstanceManifest.
 func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte) error {
+	return d.PutManifestWithMIMEType(ctx, m, "")
+}
+
+// PutManifestWithMIMEType is like PutManifest, but uploads the manifest using mimeType, if not "",
+// instead of guessing the MIME type from the manifest contents.
+func (d *dockerImageDestination) PutManifestWithMIMEType(ctx context.Context, m []byte, mimeType string) error {
 	digest, err := manifest.Digest(m)
 	if err != nil {
 		return err
 	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
 	d.manifestDigest = digest
+	d.manifestMIMEType = mimeType
+	d.manifestSize = int64(len(m))
 
 	refTail, err := d.ref.tagOrDigest()
 	if err != nil {
 		return err
 	}
+	return d.uploadManifest(ctx, m, mimeType, refTail)
+}
+
+// PutInstanceManifest writes m, with MIME type mimeType (which may be "" if unknown), of an image referenced by a manifest list,
+// to the destination. instanceDigest is the digest of m.
+// The manifest is stored by its digest, and is not tagged.
+func (d *dockerImageDestination) PutInstanceManifest(ctx context.Context, m []byte, mimeType string, instanceDigest digest.Digest) error {
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		return errors.New("Manifest lists can not be instances of other manifest lists")
+	}
+	if err := d.uploadManifest(ctx, m, mimeType, instanceDigest.String()); err != nil {
+		return err
+	}
+	if d.instanceManifests == nil {
+		d.instanceManifests = map[digest.Digest]imgspecv1.Descriptor{}
+	}
+	d.instanceManifests[instanceDigest] = imgspecv1.Descriptor{MediaType: mimeType, Digest: instanceDigest, Size: int64(len(m))}
+	return nil
+}
+
+// uploadManifest writes m, of mimeType (or "" if unknown), to the destination as refTail.
+func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, mimeType string, refTail string) error {
 	path := fmt.Sprintf(manifestPath, reference.Path(d.ref.ref), refTail)
 
 	headers := map[string][]string{}
-	mimeType := manifest.GuessMIMEType(m)
 	if mimeType != "" {
 		headers["Content-Type"] = []string{mimeType}
 	}
@@ -244,7 +576,7 @@ func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte) erro
 	}
 	defer res.Body.Close()
 	if !successStatus(res.StatusCode) {
-		err = errors.Wrapf(client.HandleErrorResponse(res), "Error uploading manifest %s to %s", refTail, d.ref.ref.Name())
+		err = errors.Wrapf(registryHTTPResponseToError(res), "Error uploading manifest %s to %s", refTail, d.ref.ref.Name())
 		if isManifestInvalidError(errors.Cause(err)) {
 			err = types.ManifestTypeRejectedError{Err: err}
 		}
@@ -259,7 +591,7 @@ func successStatus(status int) bool {
 	return status >= 200 && status <= 399
 }
 
-// isManifestInvalidError returns true iff err from client.HandleErrorReponse is a “manifest invalid” error.
+// isManifestInvalidError returns true iff err from registryHTTPResponseToError is a “manifest invalid” error.
 func isManifestInvalidError(err error) bool {
 	errors, ok := err.(errcode.Errors)
 	if !ok || len(errors) == 0 {
@@ -280,22 +612,61 @@ func (d *dockerImageDestination) PutSignatures(ctx context.Context, signatures [
 	if len(signatures) == 0 {
 		return nil
 	}
+	if d.manifestDigest.String() == "" {
+		// This shouldn’t happen, ImageDestination users are required to call PutManifest before PutSignatures
+		return errors.Errorf("Unknown manifest digest, can't add signatures")
+	}
+	return d.putSignatures(ctx, signatures, imgspecv1.Descriptor{MediaType: d.manifestMIMEType, Digest: d.manifestDigest, Size: d.manifestSize})
+}
+
+// PutInstanceSignatures writes signatures of an image referenced by a manifest list, with manifest digest instanceDigest, to the destination.
+// The manifest must have been written using PutInstanceManifest.
+func (d *dockerImageDestination) PutInstanceSignatures(ctx context.Context, signatures [][]byte, instanceDigest digest.Digest) error {
+	if len(signatures) == 0 {
+		return nil
+	}
+	m, ok := d.instanceManifests[instanceDigest]
+	if !ok {
+		return errors.Errorf("Unknown manifest %s, can't add signatures", instanceDigest)
+	}
+	return d.putSignatures(ctx, signatures, m)
+}
+
+// putSignatures writes signatures of manifest m, which has already been written to the destination.
+func (d *dockerImageDestination) putSignatures(ctx context.Context, signatures [][]byte, m imgspecv1.Descriptor) error {
 	if err := d.c.detectProperties(ctx); err != nil {
 		return err
 	}
+	if d.c.useSigstoreAttachments {
+		var sigstoreSignatures, otherSignatures [][]byte
+		for _, sig := range signatures {
+			if internalsig.IsSigstore(sig) {
+				sigstoreSignatures = append(sigstoreSignatures, sig)
+			} else {
+				otherSignatures = append(otherSignatures, sig)
+			}
+		}
+		if err := d.putSigstoreAttachments(ctx, sigstoreSignatures, m); err != nil {
+			return err
+		}
+		if len(otherSignatures) == 0 {
+			return nil
+		}
+		signatures = otherSignatures
+	}
 	switch {
 	case d.c.signatureBase != nil:
-		return d.putSignaturesToLookaside(signatures)
+		return d.putSignaturesToLookaside(ctx, signatures, m.Digest)
 	case d.c.supportsSignatures:
-		return d.putSignaturesToAPIExtension(ctx, signatures)
+		return d.putSignaturesToAPIExtension(ctx, signatures, m.Digest)
 	default:
 		return errors.Errorf("X-Registry-Supports-Signatures extension not supported, and lookaside is not configured")
 	}
 }
 
-// putSignaturesToLookaside implements PutSignatures() from the lookaside location configured in s.c.signatureBase,
+// putSignaturesToLookaside implements putSignatures() for manifestDigest from the lookaside location configured in s.c.signatureBase,
 // which is not nil.
-func (d *dockerImageDestination) putSignaturesToLookaside(signatures [][]byte) error {
+func (d *dockerImageDestination) putSignaturesToLookaside(ctx context.Context, signatures [][]byte, manifestDigest digest.Digest) error {
 	// FIXME? This overwrites files one at a time, definitely not atomic.
 	// A failure when updating signatures with a reordered copy could lose some of them.
 
@@ -304,18 +675,18 @@ func (d *dockerImageDestination) putSignaturesToLookaside(signatures [][]byte) e
 		return nil
 	}
 
-	if d.manifestDigest.String() == "" {
+	if manifestDigest.String() == "" {
 		// This shouldn’t happen, ImageDestination users are required to call PutManifest before PutSignatures
 		return errors.Errorf("Unknown manifest digest, can't add signatures")
 	}
 
 	// NOTE: Keep this in sync with docs/signature-protocols.md!
 	for i, signature := range signatures {
-		url := signatureStorageURL(d.c.signatureBase, d.manifestDigest, i)
+		url := signatureStorageURL(d.c.signatureBase, manifestDigest, i)
 		if url == nil {
 			return errors.Errorf("Internal error: signatureStorageURL with non-nil base returned nil")
 		}
-		err := d.putOneSignature(url, signature)
+		err := d.putOneSignature(ctx, url, signature)
 		if err != nil {
 			return err
 		}
@@ -326,11 +697,11 @@ func (d *dockerImageDestination) putSignaturesToLookaside(signatures [][]byte) e
 	// is enough for dockerImageSource to stop looking for other signatures, so that
 	// is sufficient.
 	for i := len(signatures); ; i++ {
-		url := signatureStorageURL(d.c.signatureBase, d.manifestDigest, i)
+		url := signatureStorageURL(d.c.signatureBase, manifestDigest, i)
 		if url == nil {
 			return errors.Errorf("Internal error: signatureStorageURL with non-nil base returned nil")
 		}
-		missing, err := d.c.deleteOneSignature(url)
+		missing, err := d.c.deleteOneSignature(ctx, url)
 		if err != nil {
 			return err
 		}
@@ -344,7 +715,7 @@ func (d *dockerImageDestination) putSignaturesToLookaside(signatures [][]byte) e
 
 // putOneSignature stores one signature to url.
 // NOTE: Keep this in sync with docs/signature-protocols.md!
-func (d *dockerImageDestination) putOneSignature(url *url.URL, signature []byte) error {
+func (d *dockerImageDestination) putOneSignature(ctx context.Context, url *url.URL, signature []byte) error {
 	switch url.Scheme {
 	case "file":
 		logrus.Debugf("Writing to %s", url.Path)
@@ -359,7 +730,18 @@ func (d *dockerImageDestination) putOneSignature(url *url.URL, signature []byte)
 		return nil
 
 	case "http", "https":
-		return errors.Errorf("Writing directly to a %s sigstore %s is not supported. Configure a sigstore-staging: location", url.Scheme, url.String())
+		res, err := d.c.makeSignatureStorageRequest(ctx, "PUT", url, signature)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		switch res.StatusCode {
+		case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+			return nil
+		default:
+			return errors.Errorf("Error writing signature to %s: status %d (%s)", url.String(), res.StatusCode, http.StatusText(res.StatusCode))
+		}
+
 	default:
 		return errors.Errorf("Unsupported scheme when writing signature to %s", url.String())
 	}
@@ -368,7 +750,7 @@ func (d *dockerImageDestination) putOneSignature(url *url.URL, signature []byte)
 // deleteOneSignature deletes a signature from url, if it exists.
 // If it successfully determines that the signature does not exist, returns (true, nil)
 // NOTE: Keep this in sync with docs/signature-protocols.md!
-func (c *dockerClient) deleteOneSignature(url *url.URL) (missing bool, err error) {
+func (c *dockerClient) deleteOneSignature(ctx context.Context, url *url.URL) (missing bool, err error) {
 	switch url.Scheme {
 	case "file":
 		logrus.Debugf("Deleting %s", url.Path)
@@ -379,20 +761,99 @@ func (c *dockerClient) deleteOneSignature(url *url.URL) (missing bool, err error
 		return false, err
 
 	case "http", "https":
-		return false, errors.Errorf("Writing directly to a %s sigstore %s is not supported. Configure a sigstore-staging: location", url.Scheme, url.String())
+		res, err := c.makeSignatureStorageRequest(ctx, "DELETE", url, nil)
+		if err != nil {
+			return false, err
+		}
+		defer res.Body.Close()
+		switch res.StatusCode {
+		case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+			return false, nil
+		case http.StatusNotFound:
+			return true, nil
+		default:
+			return false, errors.Errorf("Error deleting signature %s: status %d (%s)", url.String(), res.StatusCode, http.StatusText(res.StatusCode))
+		}
+
 	default:
 		return false, errors.Errorf("Unsupported scheme when deleting signature from %s", url.String())
 	}
 }
 
-// putSignaturesToAPIExtension implements PutSignatures() using the X-Registry-Supports-Signatures API extension.
-func (d *dockerImageDestination) putSignaturesToAPIExtension(ctx context.Context, signatures [][]byte) error {
+// makeSignatureStorageRequest executes a http(s) request to modify a lookaside signature storage at url.
+// Like for registries, the TLS configuration is read from the certs.d subdirectory for the host of url,
+// and the credentials for the host, if any, are sent using basic authentication; credentials are only sent over https.
+// NOTE: Keep this in sync with docs/signature-protocols.md!
+func (c *dockerClient) makeSignatureStorageRequest(ctx context.Context, method string, url *url.URL, body []byte) (*http.Response, error) {
+	client, err := c.signatureStorageClient(url.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	sys := c.sys
+	// sys.DockerAuthConfig is not specific to a host; don't send the credentials intended for the registry to a different server.
+	if sys != nil && sys.DockerAuthConfig != nil && url.Host != c.registry {
+		sysWithoutAuth := *sys
+		sysWithoutAuth.DockerAuthConfig = nil
+		sys = &sysWithoutAuth
+	}
+	creds, err := config.GetCredentials(sys, url.Host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting username and password")
+	}
+
+	logrus.Debugf("%s %s", method, url.String())
+	req, err := http.NewRequest(method, url.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if creds.Username != "" {
+		if url.Scheme != "https" {
+			return nil, errors.Errorf("Refusing to send credentials for %s over %s, use https", url.Host, url.Scheme)
+		}
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	return client.Do(req)
+}
+
+// signatureStorageClient returns a HTTP client for a lookaside signature storage server at hostPort,
+// creating it on first use; the client is reused for later requests to the same server.
+func (c *dockerClient) signatureStorageClient(hostPort string) (*http.Client, error) {
+	c.signatureStorageClientsMutex.Lock()
+	defer c.signatureStorageClientsMutex.Unlock()
+	if client, ok := c.signatureStorageClients[hostPort]; ok {
+		return client, nil
+	}
+
+	tr := tlsclientconfig.NewTransport()
+	tr.TLSClientConfig = serverDefault()
+	tr.Proxy = dockerProxyFunc(c.sys)
+	if err := setupDockerCertificates(c.sys, hostPort, tr.TLSClientConfig); err != nil {
+		return nil, err
+	}
+	if c.sys != nil && c.sys.DockerInsecureSkipTLSVerify {
+		tr.TLSClientConfig.InsecureSkipVerify = true
+	}
+	client := &http.Client{Transport: tr}
+	if c.signatureStorageClients == nil {
+		c.signatureStorageClients = map[string]*http.Client{}
+	}
+	c.signatureStorageClients[hostPort] = client
+	return client, nil
+}
+
+// putSignaturesToAPIExtension implements putSignatures() for manifestDigest using the X-Registry-Supports-Signatures API extension.
+func (d *dockerImageDestination) putSignaturesToAPIExtension(ctx context.Context, signatures [][]byte, manifestDigest digest.Digest) error {
 	// Skip dealing with the manifest digest, or reading the old state, if not necessary.
 	if len(signatures) == 0 {
 		return nil
 	}
 
-	if d.manifestDigest.String() == "" {
+	if manifestDigest.String() == "" {
 		// This shouldn’t happen, ImageDestination users are required to call PutManifest before PutSignatures
 		return errors.Errorf("Unknown manifest digest, can't add signatures")
 	}
@@ -401,7 +862,7 @@ func (d *dockerImageDestination) putSignaturesToAPIExtension(ctx context.Context
 	// always adds signatures.  Eventually we should also allow removing signatures,
 	// but the X-Registry-Supports-Signatures API extension does not support that yet.
 
-	existingSignatures, err := d.c.getExtensionsSignatures(ctx, d.ref, d.manifestDigest)
+	existingSignatures, err := d.c.getExtensionsSignatures(ctx, d.ref, manifestDigest)
 	if err != nil {
 		return err
 	}
@@ -426,7 +887,7 @@ sigExists:
 			if err != nil || n != 16 {
 				return errors.Wrapf(err, "Error generating random signature len %d", n)
 			}
-			signatureName = fmt.Sprintf("%s@%032x", d.manifestDigest.String(), randBytes)
+			signatureName = fmt.Sprintf("%s@%032x", manifestDigest.String(), randBytes)
 			if _, ok := existingSigNames[signatureName]; !ok {
 				break
 			}
@@ -442,19 +903,15 @@ sigExists:
 			return err
 		}
 
-		path := fmt.Sprintf(extensionsSignaturePath, reference.Path(d.ref.ref), d.manifestDigest.String())
+		path := fmt.Sprintf(extensionsSignaturePath, reference.Path(d.ref.ref), manifestDigest.String())
 		res, err := d.c.makeRequest(ctx, "PUT", path, nil, bytes.NewReader(body), v2Auth)
 		if err != nil {
 			return err
 		}
 		defer res.Body.Close()
 		if res.StatusCode != http.StatusCreated {
-			body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxErrorBodySize)
-			if err == nil {
-				logrus.Debugf("Error body %s", string(body))
-			}
 			logrus.Debugf("Error uploading signature, status %d, %#v", res.StatusCode, res)
-			return errors.Wrapf(client.HandleErrorResponse(res), "Error uploading signature to %s in %s", path, d.c.registry)
+			return errors.Wrapf(registryHTTPResponseToError(res), "Error uploading signature to %s in %s", path, d.c.registry)
 		}
 	}
 
@@ -0,0 +1,591 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/image"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uploadRegistryMock is a minimal implementation of the registry blob upload protocol.
+type uploadRegistryMock struct {
+	mutex    sync.Mutex
+	t        *testing.T
+	received []byte
+	patches  []string // Content-Range values of PATCH requests, or "" for a monolithic PATCH
+	// Content-Length values of PATCH requests, or -1 for requests using chunked transfer encoding
+	patchLengths []int64
+	// failPatch, if not nil, is called for every PATCH request with the data received so far;
+	// if it returns a non-zero status, the request fails with that status after storing storeOnFailure bytes of its body.
+	failPatch      func(received int) int
+	storeOnFailure int
+	committed      digest.Digest
+	cancelled      []string // Paths of DELETE requests
+	// Whether POST requests with a digest complete the upload; if false, the data is ignored, as the protocol allows.
+	singleRequestUploads bool
+	requests             []string // Methods of all requests
+}
+
+func (m *uploadRegistryMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests = append(m.requests, r.Method)
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/v2/ns/repo/blobs/uploads/":
+		if d := r.URL.Query().Get("digest"); d != "" && m.singleRequestUploads {
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(m.t, err)
+			if digest.Digest(d) != digest.FromBytes(body) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			m.received = body
+			m.committed = digest.Digest(d)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Set("Location", "/upload/0")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "PATCH" && strings.HasPrefix(r.URL.Path, "/upload/"):
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(m.t, err)
+		contentRange := r.Header.Get("Content-Range")
+		m.patches = append(m.patches, contentRange)
+		m.patchLengths = append(m.patchLengths, r.ContentLength)
+		if contentRange != "" && contentRange != fmt.Sprintf("%d-%d", len(m.received), len(m.received)+len(body)-1) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if m.failPatch != nil {
+			if status := m.failPatch(len(m.received)); status != 0 {
+				stored := m.storeOnFailure
+				if stored > len(body) {
+					stored = len(body)
+				}
+				m.received = append(m.received, body[:stored]...)
+				w.WriteHeader(status)
+				return
+			}
+		}
+		m.received = append(m.received, body...)
+		w.Header().Set("Location", fmt.Sprintf("/upload/%d", len(m.patches)))
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/upload/"):
+		end := len(m.received) - 1
+		if end < 0 {
+			end = 0
+		}
+		w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+		w.Header().Set("Location", r.URL.Path+"s")
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/upload/"):
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(m.t, err)
+		m.received = append(m.received, body...)
+		d := digest.Digest(r.URL.Query().Get("digest"))
+		if d != digest.FromBytes(m.received) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.committed = d
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/upload/"):
+		m.cancelled = append(m.cancelled, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// uploadTestDestination returns a dockerImageDestination for ns/repo on server, using sys.
+func uploadTestDestination(t *testing.T, server *httptest.Server, sys *types.SystemContext) *dockerImageDestination {
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	ref, err := ParseReference("//" + u.Host + "/ns/repo:tag")
+	require.NoError(t, err)
+	return &dockerImageDestination{
+		ref: ref.(dockerReference),
+		c: &dockerClient{
+			sys:      sys,
+			registry: u.Host,
+			client:   server.Client(),
+			scheme:   "http",
+		},
+	}
+}
+
+func TestDockerImageDestinationPutBlobChunked(t *testing.T) {
+	defer withRetryDelays(time.Millisecond, time.Millisecond)()
+	blob := bytes.Repeat([]byte("0123456789"), 100)
+	blobDigest := digest.FromBytes(blob)
+
+	for _, c := range []struct {
+		name           string
+		chunkSize      int64
+		failPatch      func(received int) int
+		storeOnFailure int
+		expectedRanges []string
+	}{
+		{"monolithic", 0, nil, 0, []string{""}},
+		{"single chunk", 2000, nil, 0, []string{"0-999"}},
+		{"exact chunks", 500, nil, 0, []string{"0-499", "500-999"}},
+		{"partial last chunk", 300, nil, 0, []string{"0-299", "300-599", "600-899", "900-999"}},
+		{
+			"resumed after partial failure", 400,
+			func() func(int) int {
+				failed := false
+				return func(received int) int {
+					if received == 400 && !failed {
+						failed = true
+						return http.StatusBadGateway
+					}
+					return 0
+				}
+			}(),
+			150, []string{"0-399", "400-799", "550-799", "800-999"},
+		},
+		{
+			"resumed after failure without data", 600,
+			func() func(int) int {
+				failed := false
+				return func(received int) int {
+					if received == 0 && !failed {
+						failed = true
+						return http.StatusServiceUnavailable
+					}
+					return 0
+				}
+			}(),
+			0, []string{"0-599", "0-599", "600-999"},
+		},
+	} {
+		registry := &uploadRegistryMock{t: t, failPatch: c.failPatch, storeOnFailure: c.storeOnFailure}
+		server := httptest.NewServer(registry)
+		dest := uploadTestDestination(t, server, &types.SystemContext{DockerRegistryUploadChunkSize: c.chunkSize})
+
+		info, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: -1}, false)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, info, c.name)
+		assert.Equal(t, blob, registry.received, c.name)
+		assert.Equal(t, blobDigest, registry.committed, c.name)
+		assert.Equal(t, c.expectedRanges, registry.patches, c.name)
+		server.Close()
+	}
+
+	// An empty blob
+	registry := &uploadRegistryMock{t: t}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	dest := uploadTestDestination(t, server, &types.SystemContext{DockerRegistryUploadChunkSize: 100})
+	info, err := dest.PutBlob(context.Background(), bytes.NewReader([]byte{}), types.BlobInfo{Size: -1}, false)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: digest.FromBytes([]byte{}), Size: 0}, info)
+	assert.Empty(t, registry.patches)
+
+	// Non-transient failures are not retried
+	registry = &uploadRegistryMock{t: t, failPatch: func(int) int { return http.StatusForbidden }}
+	server2 := httptest.NewServer(registry)
+	defer server2.Close()
+	dest = uploadTestDestination(t, server2, &types.SystemContext{DockerRegistryUploadChunkSize: 100})
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: -1}, false)
+	assert.Error(t, err)
+	assert.Len(t, registry.patches, 1)
+
+	// Transient failures are retried only a limited number of times
+	registry = &uploadRegistryMock{t: t, failPatch: func(int) int { return http.StatusInternalServerError }}
+	server3 := httptest.NewServer(registry)
+	defer server3.Close()
+	dest = uploadTestDestination(t, server3, &types.SystemContext{DockerRegistryUploadChunkSize: 100})
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: -1}, false)
+	assert.Error(t, err)
+	assert.Len(t, registry.patches, defaultMaxRetries+1)
+
+	// … or as many times as configured
+	registry = &uploadRegistryMock{t: t, failPatch: func(int) int { return http.StatusInternalServerError }}
+	server4 := httptest.NewServer(registry)
+	defer server4.Close()
+	dest = uploadTestDestination(t, server4, &types.SystemContext{DockerRegistryUploadChunkSize: 100, DockerRegistryMaxRetries: -1})
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: -1}, false)
+	assert.Error(t, err)
+	assert.Len(t, registry.patches, 1)
+}
+
+func TestDockerImageDestinationPutBlobContentLength(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, c := range []struct {
+		size, expected int64
+	}{
+		{int64(len(blob)), int64(len(blob))}, // The size is known: Content-Length is sent
+		{-1, -1},                             // The size is not known: chunked transfer encoding is used
+	} {
+		registry := &uploadRegistryMock{t: t}
+		server := httptest.NewServer(registry)
+		dest := uploadTestDestination(t, server, nil)
+		// Use a reader which does not allow net/http to determine the size on its own.
+		stream := ioutil.NopCloser(bytes.NewReader(blob))
+		_, err := dest.PutBlob(context.Background(), stream, types.BlobInfo{Size: c.size}, false)
+		require.NoError(t, err)
+		assert.Equal(t, blob, registry.received)
+		assert.Equal(t, []int64{c.expected}, registry.patchLengths)
+		server.Close()
+	}
+}
+
+func TestDockerImageDestinationPutBlobSingleRequest(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), 100)
+	blobDigest := digest.FromBytes(blob)
+
+	for _, c := range []struct {
+		name                 string
+		threshold, size      int64
+		singleRequestUploads bool
+		expectedRequests     []string
+	}{
+		{"disabled", 0, -1, true, []string{"POST", "PATCH", "PUT"}},
+		{"known size", 1000, int64(len(blob)), true, []string{"POST"}},
+		{"unknown size", 1000, -1, true, []string{"POST"}},
+		{"known size over threshold", 999, int64(len(blob)), true, []string{"POST", "PATCH", "PUT"}},
+		{"unknown size over threshold", 999, -1, true, []string{"POST", "PATCH", "PUT"}},
+		{"not supported by the registry", 1000, -1, false, []string{"POST", "PUT"}},
+	} {
+		registry := &uploadRegistryMock{t: t, singleRequestUploads: c.singleRequestUploads}
+		server := httptest.NewServer(registry)
+		dest := uploadTestDestination(t, server, &types.SystemContext{DockerRegistrySingleRequestUploadThreshold: c.threshold})
+
+		info, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: c.size}, false)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, info, c.name)
+		assert.Equal(t, blob, registry.received, c.name)
+		assert.Equal(t, blobDigest, registry.committed, c.name)
+		assert.Equal(t, c.expectedRequests, registry.requests, c.name)
+		server.Close()
+	}
+}
+
+func TestDockerImageDestinationPutBlobCancel(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, c := range []struct {
+		chunkSize         int64
+		failPatch         func(received int) int
+		expectedCancelled string
+	}{
+		{0, func(int) int { return http.StatusForbidden }, "/upload/0"},
+		{300, func(received int) int {
+			if received >= 600 {
+				return http.StatusForbidden
+			}
+			return 0
+		}, "/upload/2"},
+	} {
+		registry := &uploadRegistryMock{t: t, failPatch: c.failPatch}
+		server := httptest.NewServer(registry)
+		dest := uploadTestDestination(t, server, &types.SystemContext{DockerRegistryUploadChunkSize: c.chunkSize})
+		_, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: -1}, false)
+		require.Error(t, err, c.chunkSize)
+		require.IsType(t, BlobUploadAbortedError{}, err, c.chunkSize)
+		assert.Equal(t, errors.Cause(err.(BlobUploadAbortedError).Err), errors.Cause(err), c.chunkSize)
+		assert.Equal(t, []string{c.expectedCancelled}, registry.cancelled, c.chunkSize)
+		assert.Empty(t, registry.committed, c.chunkSize)
+		server.Close()
+	}
+
+	// A failure to commit the upload
+	registry := &uploadRegistryMock{t: t}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	dest := uploadTestDestination(t, server, &types.SystemContext{})
+	// The mock rejects the upload if the digest does not match the data received so far.
+	registry.received = []byte("unexpected")
+	_, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: -1}, false)
+	require.Error(t, err)
+	require.IsType(t, BlobUploadCommitFailedError{}, err)
+	assert.Equal(t, errors.Cause(err.(BlobUploadCommitFailedError).Err), errors.Cause(err))
+	assert.Equal(t, []string{"/upload/1"}, registry.cancelled)
+	assert.Empty(t, registry.committed)
+}
+
+func TestParseUploadRange(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected int64
+	}{
+		{"", 0},
+		{"0-0", 0},
+		{"0--1", 0},
+		{"0-1", 2},
+		{"0-999", 1000},
+	} {
+		res, err := parseUploadRange(c.input)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+
+	for _, input := range []string{"1-10", "0", "0-x", "0--2", "bytes=0-10"} {
+		_, err := parseUploadRange(input)
+		assert.Error(t, err, input)
+	}
+}
+
+// manifestStoreMock is a registry which stores manifests of ns/repo, and refuses manifest lists referencing missing instances.
+type manifestStoreMock struct {
+	mutex     sync.Mutex
+	t         *testing.T
+	manifests map[string][]byte // Tag or digest → manifest
+	mimeTypes map[string]string // Tag or digest → Content-Type
+}
+
+func (m *manifestStoreMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	const prefix = "/v2/ns/repo/manifests/"
+	if r.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	refTail := strings.TrimPrefix(r.URL.Path, prefix)
+	switch r.Method {
+	case "GET":
+		man, ok := m.manifests[refTail]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", m.mimeTypes[refTail])
+		w.Write(man)
+	case "PUT":
+		man, err := ioutil.ReadAll(r.Body)
+		require.NoError(m.t, err)
+		mimeType := r.Header.Get("Content-Type")
+		if mimeType == manifest.DockerV2ListMediaType {
+			var list struct {
+				Manifests []struct {
+					Digest digest.Digest `json:"digest"`
+				} `json:"manifests"`
+			}
+			require.NoError(m.t, json.Unmarshal(man, &list))
+			for _, instance := range list.Manifests {
+				if _, ok := m.manifests[instance.Digest.String()]; !ok {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		for _, key := range []string{refTail, digest.FromBytes(man).String()} {
+			m.manifests[key] = man
+			m.mimeTypes[key] = mimeType
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestDockerImageDestinationPutManifestWithMIMEType(t *testing.T) {
+	registry := &manifestStoreMock{t: t, manifests: map[string][]byte{}, mimeTypes: map[string]string{}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	dest := uploadTestDestination(t, server, &types.SystemContext{})
+
+	// An OCI manifest without layers, which manifest.GuessMIMEType does not recognize as OCI
+	man := []byte(fmt.Sprintf(`{"schemaVersion":2,"config":{"mediaType":"%s","size":1,"digest":"%s"},"layers":[]}`,
+		imgspecv1.MediaTypeImageConfig, digest.FromString("config")))
+	guessedMIMEType := manifest.GuessMIMEType(man)
+	require.NotEqual(t, imgspecv1.MediaTypeImageManifest, guessedMIMEType)
+
+	err := dest.PutManifestWithMIMEType(context.Background(), man, imgspecv1.MediaTypeImageManifest)
+	require.NoError(t, err)
+	assert.Equal(t, man, registry.manifests["tag"])
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, registry.mimeTypes["tag"])
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, dest.manifestMIMEType)
+
+	// Without a MIME type, it is guessed
+	err = dest.PutManifestWithMIMEType(context.Background(), man, "")
+	require.NoError(t, err)
+	assert.Equal(t, guessedMIMEType, registry.mimeTypes["tag"])
+	assert.Equal(t, guessedMIMEType, dest.manifestMIMEType)
+}
+
+func TestDockerImageDestinationPutManifestList(t *testing.T) {
+	registry := &manifestStoreMock{t: t, manifests: map[string][]byte{}, mimeTypes: map[string]string{}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	dest := uploadTestDestination(t, server, &types.SystemContext{})
+	// List support is only reported through types.ManifestListDestination.
+	var _ types.ManifestListDestination = dest
+	assert.NotContains(t, dest.SupportedManifestMIMETypes(), manifest.DockerV2ListMediaType)
+	assert.NotContains(t, dest.SupportedManifestMIMETypes(), imgspecv1.MediaTypeImageIndex)
+
+	instances := map[string][]byte{}
+	listEntries := []string{}
+	for _, arch := range []string{"amd64", "arm64"} {
+		instance := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"mediaType":"%s","size":1,"digest":"%s"},"layers":[]}`,
+			manifest.DockerV2Schema2MediaType, manifest.DockerV2Schema2ConfigMediaType, digest.FromString(arch)))
+		instances[arch] = instance
+		listEntries = append(listEntries, fmt.Sprintf(`{"mediaType":"%s","size":%d,"digest":"%s","platform":{"architecture":"%s","os":"linux"}}`,
+			manifest.DockerV2Schema2MediaType, len(instance), digest.FromBytes(instance), arch))
+	}
+	list := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[%s]}`, manifest.DockerV2ListMediaType, strings.Join(listEntries, ",")))
+
+	// A list can't be written before its instances
+	err := dest.PutManifest(context.Background(), list)
+	assert.Error(t, err)
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		err := dest.PutInstanceManifest(context.Background(), instances[arch], "", digest.FromBytes(instances[arch]))
+		require.NoError(t, err, arch)
+		assert.Equal(t, instances[arch], registry.manifests[digest.FromBytes(instances[arch]).String()], arch)
+	}
+	assert.NotContains(t, registry.manifests, "tag")
+	err = dest.PutManifest(context.Background(), list)
+	require.NoError(t, err)
+	assert.Equal(t, list, registry.manifests["tag"])
+	assert.Equal(t, manifest.DockerV2ListMediaType, registry.mimeTypes["tag"])
+	assert.Equal(t, digest.FromBytes(list), dest.manifestDigest)
+
+	// Lists can't be nested
+	err = dest.PutInstanceManifest(context.Background(), list, "", digest.FromBytes(list))
+	assert.Error(t, err)
+
+	// The instance for the current platform is used when pulling the list
+	tmpDir, err := ioutil.TempDir("", "manifest-list")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	for _, arch := range []string{"amd64", "arm64"} {
+		sys := &types.SystemContext{
+			SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+			RegistriesDirPath:           tmpDir,
+			DockerInsecureSkipTLSVerify: true,
+			ArchitectureChoice:          arch,
+			OSChoice:                    "linux",
+		}
+		src, err := newImageSource(context.Background(), sys, dest.ref)
+		require.NoError(t, err, arch)
+		m, mimeType, err := src.GetManifest(context.Background(), nil)
+		require.NoError(t, err, arch)
+		assert.Equal(t, string(list), string(m), arch)
+		assert.Equal(t, manifest.DockerV2ListMediaType, mimeType, arch)
+		instanceDigest, err := image.ChooseManifestInstanceFromManifestList(context.Background(), sys, image.UnparsedInstance(src, nil))
+		require.NoError(t, err, arch)
+		assert.Equal(t, digest.FromBytes(instances[arch]), instanceDigest, arch)
+		m, mimeType, err = image.UnparsedInstance(src, &instanceDigest).Manifest(context.Background())
+		require.NoError(t, err, arch)
+		assert.Equal(t, string(instances[arch]), string(m), arch)
+		assert.Equal(t, manifest.DockerV2Schema2MediaType, mimeType, arch)
+		err = src.Close()
+		require.NoError(t, err, arch)
+	}
+}
+
+func TestPutSignaturesToLookasideHTTP(t *testing.T) {
+	var mutex sync.Mutex
+	stored := map[string]string{}
+	var authorizations []string
+	failing := false
+	sigServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		user, password, _ := r.BasicAuth()
+		authorizations = append(authorizations, user+":"+password)
+		switch r.Method {
+		case "PUT":
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			stored[r.URL.Path] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		case "DELETE":
+			if _, ok := stored[r.URL.Path]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(stored, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer sigServer.Close()
+	sigURL, err := url.Parse(sigServer.URL)
+	require.NoError(t, err)
+
+	tmpDir, err := ioutil.TempDir("", "lookaside-http")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	authFile := filepath.Join(tmpDir, "auth.json")
+	err = ioutil.WriteFile(authFile, []byte(fmt.Sprintf(`{"auths":{%q:{"auth":"c2lnOnNlY3JldA=="}}}`, sigURL.Host)), 0600) // sig:secret
+	require.NoError(t, err)
+
+	manifestDigest := digest.FromString("manifest")
+	sigPath := "/sigstore/ns/repo@" + strings.Replace(manifestDigest.String(), ":", "=", 1)
+	stored[sigPath+"/signature-3"] = "stale"
+	dest := uploadTestDestination(t, sigServer, &types.SystemContext{
+		AuthFilePath:                authFile,
+		DockerAuthConfig:            &types.DockerAuthConfig{Username: "registry-user", Password: "registry-password"},
+		DockerInsecureSkipTLSVerify: true,
+	})
+	defer dest.Close()
+	dest.c.registry = "registry.example.com"
+
+	// Credentials are never sent over http
+	dest.c.signatureBase = &url.URL{Scheme: "http", Host: sigURL.Host, Path: "/sigstore/ns/repo"}
+	err = dest.putSignaturesToLookaside(context.Background(), [][]byte{[]byte("sig1"), []byte("sig2")}, manifestDigest)
+	assert.Error(t, err)
+	assert.Empty(t, authorizations)
+
+	dest.c.signatureBase = &url.URL{Scheme: "https", Host: sigURL.Host, Path: "/sigstore/ns/repo"}
+	err = dest.putSignaturesToLookaside(context.Background(), [][]byte{[]byte("sig1"), []byte("sig2")}, manifestDigest)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		sigPath + "/signature-1": "sig1",
+		sigPath + "/signature-2": "sig2",
+	}, stored)
+	// Credentials for the signature storage host are used, not sys.DockerAuthConfig intended for the registry.
+	assert.Equal(t, []string{"sig:secret", "sig:secret", "sig:secret", "sig:secret"}, authorizations)
+	// A single HTTP client is used for all requests to the server.
+	assert.Len(t, dest.c.signatureStorageClients, 1)
+
+	// Deleting all signatures
+	missing, err := dest.c.deleteOneSignature(context.Background(), &url.URL{Scheme: "https", Host: sigURL.Host, Path: sigPath + "/signature-1"})
+	require.NoError(t, err)
+	assert.False(t, missing)
+	missing, err = dest.c.deleteOneSignature(context.Background(), &url.URL{Scheme: "https", Host: sigURL.Host, Path: sigPath + "/signature-1"})
+	require.NoError(t, err)
+	assert.True(t, missing)
+
+	// Server failures are reported
+	mutex.Lock()
+	failing = true
+	mutex.Unlock()
+	err = dest.putOneSignature(context.Background(), &url.URL{Scheme: "https", Host: sigURL.Host, Path: sigPath + "/signature-1"}, []byte("sig"))
+	assert.Error(t, err)
+	_, err = dest.c.deleteOneSignature(context.Background(), &url.URL{Scheme: "https", Host: sigURL.Host, Path: sigPath + "/signature-2"})
+	assert.Error(t, err)
+}
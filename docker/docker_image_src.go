@@ -10,35 +10,124 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/internal/iolimits"
 	"github.com/containers/image/manifest"
+	"github.com/containers/image/pkg/docker/config"
+	"github.com/containers/image/pkg/sysregistriesv2"
 	"github.com/containers/image/types"
-	"github.com/docker/distribution/registry/client"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 type dockerImageSource struct {
-	ref dockerReference
-	c   *dockerClient
+	ref         dockerReference // The reference the user requested, used for signature identity
+	physicalRef dockerReference // The reference actually pulled from, in the registry or a mirror
+	c           *dockerClient
+	// Cancels a background request started by dockerClient.prefetchAnonymousBearerToken, if any.
+	cancelPrefetch context.CancelFunc
 	// State
 	cachedManifest         []byte // nil if not loaded yet
 	cachedManifestMIMEType string // Only valid if cachedManifest != nil
 }
 
 // newImageSource creates a new ImageSource for the specified image reference.
+// If mirrors are configured for ref, the first one which contains the image is used, falling back to the registry of ref.
 // The caller must call .Close() on the returned ImageSource.
-func newImageSource(sys *types.SystemContext, ref dockerReference) (*dockerImageSource, error) {
-	c, err := newDockerClientFromRef(sys, ref, false, "pull")
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerReference) (*dockerImageSource, error) {
+	sources, err := pullSources(sys, ref.ref)
 	if err != nil {
 		return nil, err
 	}
+	if len(sources) == 1 {
+		// Without mirrors, there is nothing to choose from, so don't contact the registry until necessary.
+		s, err := newImageSourceFromPullSource(sys, ref, sources[0])
+		if err != nil {
+			return nil, err
+		}
+		// The token server may be contacted, though, so that the manifest request need not wait for it.
+		var prefetchCtx context.Context
+		prefetchCtx, s.cancelPrefetch = context.WithCancel(context.Background())
+		s.c.prefetchAnonymousBearerToken(prefetchCtx)
+		return s, nil
+	}
+
+	// Check which of the locations contains the image; it is then used for all further operations,
+	// so that the manifest and blobs are consistent.
+	var lastErr error
+	mirrorErrors := []string{}
+	for i, source := range sources {
+		s, err := newImageSourceFromPullSource(sys, ref, source)
+		if err == nil {
+			err = s.ensureManifestIsLoaded(ctx)
+			if err == nil {
+				return s, nil
+			}
+			s.Close()
+		}
+		logrus.Debugf("Error trying to pull %s: %v", source.Reference.String(), err)
+		if i < len(sources)-1 {
+			mirrorErrors = append(mirrorErrors, fmt.Sprintf("[%s: %v]", source.Reference.String(), err))
+		}
+		lastErr = err
+	}
+	return nil, errors.Wrapf(lastErr, "error pulling %s (mirrors also failed: %s)", sources[len(sources)-1].Reference.String(), strings.Join(mirrorErrors, ", "))
+}
+
+// newImageSourceFromPullSource creates a new dockerImageSource for ref, pulling from source.
+func newImageSourceFromPullSource(sys *types.SystemContext, ref dockerReference, source sysregistriesv2.PullSource) (*dockerImageSource, error) {
+	physicalRef, err := NewReference(source.Reference)
+	if err != nil {
+		return nil, err
+	}
+	registry := reference.Domain(physicalRef.(dockerReference).ref)
+	endpointSys := sys
+	// sys.DockerAuthConfig is not specific to a registry; don't send the credentials intended for ref to a mirror on a different host.
+	if sys != nil && sys.DockerAuthConfig != nil && registry != reference.Domain(ref.ref) {
+		copy := *sys
+		copy.DockerAuthConfig = nil
+		endpointSys = &copy
+	}
+	creds, err := config.GetCredentials(endpointSys, registry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting username and password")
+	}
+	// Signatures are looked up for the image as referenced by the user, not in the mirror.
+	sigBase, err := configuredSignatureStorageBase(sys, ref, false)
+	if err != nil {
+		return nil, err
+	}
+	useSigstoreAttachments, err := configuredUseSigstoreAttachments(sys, ref)
+	if err != nil {
+		return nil, err
+	}
+	useNotationSignatures, err := configuredUseNotationSignatures(sys, ref)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newDockerClientWithDetails(endpointSys, registry, creds, "pull", sigBase, reference.Path(physicalRef.(dockerReference).ref))
+	if err != nil {
+		return nil, err
+	}
+	c.useSigstoreAttachments = useSigstoreAttachments
+	c.useNotationSignatures = useNotationSignatures
+	if source.Endpoint.Insecure {
+		c.allowInsecure()
+	}
+	if source.Endpoint.Proxy != "" {
+		if err := c.useProxy(source.Endpoint.Proxy); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
 	return &dockerImageSource{
-		ref: ref,
-		c:   c,
+		ref:         ref,
+		physicalRef: physicalRef.(dockerReference),
+		c:           c,
 	}, nil
 }
 
@@ -50,6 +139,10 @@ func (s *dockerImageSource) Reference() types.ImageReference {
 
 // Close removes resources associated with an initialized ImageSource, if any.
 func (s *dockerImageSource) Close() error {
+	if s.cancelPrefetch != nil {
+		s.cancelPrefetch()
+	}
+	s.c.Close()
 	return nil
 }
 
@@ -87,7 +180,7 @@ func (s *dockerImageSource) GetManifest(ctx context.Context, instanceDigest *dig
 }
 
 func (s *dockerImageSource) fetchManifest(ctx context.Context, tagOrDigest string) ([]byte, string, error) {
-	path := fmt.Sprintf(manifestPath, reference.Path(s.ref.ref), tagOrDigest)
+	path := fmt.Sprintf(manifestPath, reference.Path(s.physicalRef.ref), tagOrDigest)
 	headers := make(map[string][]string)
 	headers["Accept"] = manifest.DefaultRequestedManifestMIMETypes
 	res, err := s.c.makeRequest(ctx, "GET", path, headers, nil, v2Auth)
@@ -96,14 +189,38 @@ func (s *dockerImageSource) fetchManifest(ctx context.Context, tagOrDigest strin
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, "", errors.Wrapf(client.HandleErrorResponse(res), "Error reading manifest %s in %s", tagOrDigest, s.ref.ref.Name())
+		return nil, "", errors.Wrapf(registryHTTPResponseToError(res), "Error reading manifest %s in %s", tagOrDigest, s.physicalRef.ref.Name())
 	}
 
 	manblob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
 	if err != nil {
 		return nil, "", err
 	}
-	return manblob, simplifyContentType(res.Header.Get("Content-Type")), nil
+	if s.c.sys != nil && s.c.sys.DockerVerifySchema1Signatures && manifest.GuessMIMEType(manblob) == manifest.DockerV2Schema1SignedMediaType {
+		if _, err := manifest.VerifyV2S1Signatures(manblob); err != nil {
+			return nil, "", errors.Wrapf(err, "Error verifying manifest %s in %s", tagOrDigest, s.physicalRef.ref.Name())
+		}
+	}
+	return manblob, manifestMIMEType(res.Header.Get("Content-Type"), manblob), nil
+}
+
+// manifestMIMEType returns the MIME type of manblob, returned by a registry with contentType.
+// Some registries (or content distribution networks in front of them) ignore the Accept header and return a generic
+// or missing Content-Type; in that case the MIME type is determined from the manifest contents, if possible,
+// so that e.g. decisions whether to convert the manifest use the actual format.
+func manifestMIMEType(contentType string, manblob []byte) string {
+	mt := simplifyContentType(contentType)
+	switch mt {
+	case manifest.DockerV2Schema1MediaType, manifest.DockerV2Schema1SignedMediaType,
+		manifest.DockerV2Schema2MediaType, manifest.DockerV2ListMediaType,
+		imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageIndex:
+		return mt
+	}
+	if guessed := manifest.GuessMIMEType(manblob); guessed != "" {
+		logrus.Debugf("Registry returned Content-Type %q for a manifest, using %q based on the contents", contentType, guessed)
+		return guessed
+	}
+	return mt
 }
 
 // ensureManifestIsLoaded sets s.cachedManifest and s.cachedManifestMIMEType
@@ -118,7 +235,7 @@ func (s *dockerImageSource) ensureManifestIsLoaded(ctx context.Context) error {
 		return nil
 	}
 
-	reference, err := s.ref.tagOrDigest()
+	reference, err := s.physicalRef.tagOrDigest()
 	if err != nil {
 		return err
 	}
@@ -166,10 +283,14 @@ func getBlobSize(resp *http.Response) int64 {
 // GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
 func (s *dockerImageSource) GetBlob(ctx context.Context, info types.BlobInfo) (io.ReadCloser, int64, error) {
 	if len(info.URLs) != 0 {
-		return s.getExternalBlob(ctx, info.URLs)
+		stream, size, err := s.getExternalBlob(ctx, info.URLs)
+		if err != nil {
+			return nil, 0, err
+		}
+		return s.c.progressReadCloser(stream, info), size, nil
 	}
 
-	path := fmt.Sprintf(blobsPath, reference.Path(s.ref.ref), info.Digest.String())
+	path := fmt.Sprintf(blobsPath, reference.Path(s.physicalRef.ref), info.Digest.String())
 	logrus.Debugf("Downloading %s", path)
 	res, err := s.c.makeRequest(ctx, "GET", path, nil, nil, v2Auth)
 	if err != nil {
@@ -179,7 +300,32 @@ func (s *dockerImageSource) GetBlob(ctx context.Context, info types.BlobInfo) (i
 		// print url also
 		return nil, 0, errors.Errorf("Invalid status code returned when fetching blob %d (%s)", res.StatusCode, http.StatusText(res.StatusCode))
 	}
-	return res.Body, getBlobSize(res), nil
+	return s.c.progressReadCloser(res.Body, info), getBlobSize(res), nil
+}
+
+// BlobSize returns the size of the blob with info, or -1 if it can not be determined.
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+func (s *dockerImageSource) BlobSize(ctx context.Context, info types.BlobInfo) (int64, error) {
+	if len(info.URLs) != 0 {
+		// Foreign layers are not stored in the registry.
+		return -1, nil
+	}
+
+	path := fmt.Sprintf(blobsPath, reference.Path(s.physicalRef.ref), info.Digest.String())
+	logrus.Debugf("Checking size of %s", path)
+	res, err := s.c.makeRequest(ctx, "HEAD", path, nil, nil, v2Auth)
+	if err != nil {
+		return -1, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return getBlobSize(res), nil
+	case http.StatusNotFound:
+		return -1, nil
+	default:
+		return -1, errors.Errorf("Invalid status code returned when checking blob %s: %d (%s)", info.Digest, res.StatusCode, http.StatusText(res.StatusCode))
+	}
 }
 
 // GetSignatures returns the image's signatures.  It may use a remote (= slow) service.
@@ -190,14 +336,40 @@ func (s *dockerImageSource) GetSignatures(ctx context.Context, instanceDigest *d
 	if err := s.c.detectProperties(ctx); err != nil {
 		return nil, err
 	}
+	var signatures [][]byte
+	var err error
 	switch {
 	case s.c.signatureBase != nil:
-		return s.getSignaturesFromLookaside(ctx, instanceDigest)
+		signatures, err = s.getSignaturesFromLookaside(ctx, instanceDigest)
 	case s.c.supportsSignatures:
-		return s.getSignaturesFromAPIExtension(ctx, instanceDigest)
+		signatures, err = s.getSignaturesFromAPIExtension(ctx, instanceDigest)
 	default:
-		return [][]byte{}, nil
+		signatures = [][]byte{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.c.useSigstoreAttachments || s.c.useNotationSignatures {
+		manifestDigest, err := s.manifestDigest(ctx, instanceDigest)
+		if err != nil {
+			return nil, err
+		}
+		if s.c.useSigstoreAttachments {
+			attached, err := s.c.getSigstoreAttachments(ctx, s.physicalRef, manifestDigest)
+			if err != nil {
+				return nil, err
+			}
+			signatures = append(signatures, attached...)
+		}
+		if s.c.useNotationSignatures {
+			notation, err := s.c.getNotationSignatures(ctx, s.physicalRef, manifestDigest)
+			if err != nil {
+				return nil, err
+			}
+			signatures = append(signatures, notation...)
+		}
 	}
+	return signatures, nil
 }
 
 // manifestDigest returns a digest of the manifest, from instanceDigest if non-nil; or from the supplied reference,
@@ -296,7 +468,7 @@ func (s *dockerImageSource) getSignaturesFromAPIExtension(ctx context.Context, i
 		return nil, err
 	}
 
-	parsedBody, err := s.c.getExtensionsSignatures(ctx, s.ref, manifestDigest)
+	parsedBody, err := s.c.getExtensionsSignatures(ctx, s.physicalRef, manifestDigest)
 	if err != nil {
 		return nil, err
 	}
@@ -323,12 +495,13 @@ func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerRefere
 	if err != nil {
 		return err
 	}
+	defer c.Close()
 
-	// When retrieving the digest from a registry >= 2.3 use the following header:
-	//   "Accept": "application/vnd.docker.distribution.manifest.v2+json"
-	headers := make(map[string][]string)
-	headers["Accept"] = []string{manifest.DockerV2Schema2MediaType}
-
+	// Resolve the reference to the digest of the manifest stored in the registry; accept all manifest types,
+	// so that the registry does not convert the manifest to a different one, with a different digest.
+	headers := map[string][]string{
+		"Accept": manifest.DefaultRequestedManifestMIMETypes,
+	}
 	refTail, err := ref.tagOrDigest()
 	if err != nil {
 		return err
@@ -339,49 +512,52 @@ func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerRefere
 		return err
 	}
 	defer get.Body.Close()
-	manifestBody, err := iolimits.ReadAtMost(get.Body, iolimits.MaxManifestBodySize)
-	if err != nil {
-		return err
-	}
 	switch get.StatusCode {
 	case http.StatusOK:
 	case http.StatusNotFound:
 		return errors.Errorf("Unable to delete %v. Image may not exist or is not stored with a v2 Schema in a v2 registry", ref.ref)
 	default:
-		return errors.Errorf("Failed to delete %v: %s (%v)", ref.ref, manifestBody, get.Status)
+		return errors.Wrapf(registryHTTPResponseToError(get), "Failed to delete %v", ref.ref)
 	}
-
-	digest := get.Header.Get("Docker-Content-Digest")
-	deletePath := fmt.Sprintf(manifestPath, reference.Path(ref.ref), digest)
-
-	// When retrieving the digest from a registry >= 2.3 use the following header:
-	//   "Accept": "application/vnd.docker.distribution.manifest.v2+json"
-	delete, err := c.makeRequest(ctx, "DELETE", deletePath, headers, nil, v2Auth)
+	manifestBody, err := iolimits.ReadAtMost(get.Body, iolimits.MaxManifestBodySize)
 	if err != nil {
 		return err
 	}
-	defer delete.Body.Close()
+	manifestDigest, err := manifest.Digest(manifestBody)
+	if err != nil {
+		return err
+	}
+	// Prefer the digest computed by the registry, it is the one the registry uses to identify the manifest.
+	deleteDigest := manifestDigest
+	if header := get.Header.Get("Docker-Content-Digest"); header != "" {
+		deleteDigest, err = digest.Parse(header)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid Docker-Content-Digest %q returned for %v", header, ref.ref)
+		}
+	}
 
-	body, err := iolimits.ReadAtMost(delete.Body, iolimits.MaxErrorBodySize)
+	deletePath := fmt.Sprintf(manifestPath, reference.Path(ref.ref), deleteDigest.String())
+	delete, err := c.makeRequest(ctx, "DELETE", deletePath, headers, nil, v2Auth)
 	if err != nil {
 		return err
 	}
-	if delete.StatusCode != http.StatusAccepted {
-		return errors.Errorf("Failed to delete %v: %s (%v)", deletePath, string(body), delete.Status)
+	defer delete.Body.Close()
+	switch delete.StatusCode {
+	case http.StatusAccepted:
+	case http.StatusMethodNotAllowed:
+		// docker/distribution returns this if deleting images is not enabled.
+		return errors.Wrapf(registryHTTPResponseToError(delete), "Failed to delete %v: deleting images is not supported by the registry", ref.ref)
+	default:
+		return errors.Wrapf(registryHTTPResponseToError(delete), "Failed to delete %v", deletePath)
 	}
 
 	if c.signatureBase != nil {
-		manifestDigest, err := manifest.Digest(manifestBody)
-		if err != nil {
-			return err
-		}
-
 		for i := 0; ; i++ {
 			url := signatureStorageURL(c.signatureBase, manifestDigest, i)
 			if url == nil {
 				return errors.Errorf("Internal error: signatureStorageURL with non-nil base returned nil")
 			}
-			missing, err := c.deleteOneSignature(url)
+			missing, err := c.deleteOneSignature(ctx, url)
 			if err != nil {
 				return err
 			}
@@ -1,9 +1,24 @@
 package docker
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSimplifyContentType(t *testing.T) {
@@ -22,3 +37,345 @@ func TestSimplifyContentType(t *testing.T) {
 		assert.Equal(t, c.expected, out, c.input)
 	}
 }
+
+func TestManifestMIMEType(t *testing.T) {
+	const schema2 = `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`
+	const schema1 = `{"schemaVersion":1,"name":"ns/repo","tag":"tag"}`
+	for _, c := range []struct{ contentType, manifest, expected string }{
+		// Recognized Content-Type values are used as is
+		{manifest.DockerV2Schema2MediaType, schema2, manifest.DockerV2Schema2MediaType},
+		{manifest.DockerV2Schema2MediaType + "; charset=utf-8", schema2, manifest.DockerV2Schema2MediaType},
+		{imgspecv1.MediaTypeImageIndex, `{"schemaVersion":2,"manifests":[]}`, imgspecv1.MediaTypeImageIndex},
+		// Missing or generic values are replaced by the type of the contents, if known
+		{"", schema2, manifest.DockerV2Schema2MediaType},
+		{"application/json", schema2, manifest.DockerV2Schema2MediaType},
+		{"text/plain; charset=utf-8", schema1, manifest.DockerV2Schema1MediaType},
+		{"application/octet-stream", "not a manifest", "application/octet-stream"},
+		{"application/json", "not a manifest", "application/json"},
+	} {
+		mt := manifestMIMEType(c.contentType, []byte(c.manifest))
+		assert.Equal(t, c.expected, mt, c.contentType)
+	}
+}
+
+// manifestRegistryMock is a registry which contains a manifest for the specified repositories.
+type manifestRegistryMock struct {
+	repos    map[string]bool // Repository path → whether it contains the image
+	requests []string
+}
+
+func (m *manifestRegistryMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.requests = append(m.requests, r.URL.Path)
+	if r.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	for repo, present := range m.repos {
+		if present && r.URL.Path == "/v2/"+repo+"/manifests/tag" {
+			w.Header().Set("Content-Type", manifest.DockerV2Schema2MediaType)
+			fmt.Fprint(w, `{"schemaVersion":2}`)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestNewImageSourceMirrors(t *testing.T) {
+	upstream := &manifestRegistryMock{repos: map[string]bool{"ns/repo": true}}
+	upstreamServer := httptest.NewServer(upstream)
+	defer upstreamServer.Close()
+	mirror1 := &manifestRegistryMock{}
+	mirror1Server := httptest.NewServer(mirror1)
+	defer mirror1Server.Close()
+	mirror2 := &manifestRegistryMock{repos: map[string]bool{"mirrored/ns/repo": true}}
+	mirror2Server := httptest.NewServer(mirror2)
+	defer mirror2Server.Close()
+	upstreamHost := upstreamServer.Listener.Addr().String()
+	mirror1Host := mirror1Server.Listener.Addr().String()
+	mirror2Host := mirror2Server.Listener.Addr().String()
+
+	tmpDir, err := ioutil.TempDir("", "mirrors")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+		RegistriesDirPath:           tmpDir,
+		DockerInsecureSkipTLSVerify: true,
+		DockerRegistryMirrors: map[string][]string{
+			upstreamHost: {mirror1Host, mirror2Host + "/mirrored"},
+		},
+	}
+	ref, err := ParseReference("//" + upstreamHost + "/ns/repo:tag")
+	require.NoError(t, err)
+
+	// The first mirror which contains the image is used
+	src, err := newImageSource(context.Background(), sys, ref.(dockerReference))
+	require.NoError(t, err)
+	assert.Equal(t, ref, src.Reference())
+	assert.Equal(t, mirror2Host+"/mirrored/ns/repo:tag", src.physicalRef.ref.String())
+	m, mimeType, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, `{"schemaVersion":2}`, string(m))
+	assert.Equal(t, manifest.DockerV2Schema2MediaType, mimeType)
+	assert.Contains(t, mirror1.requests, "/v2/ns/repo/manifests/tag")
+	assert.Empty(t, upstream.requests)
+
+	// The registry itself is used if no mirror contains the image
+	mirror2.repos = nil
+	src, err = newImageSource(context.Background(), sys, ref.(dockerReference))
+	require.NoError(t, err)
+	assert.Equal(t, ref, src.Reference())
+	assert.Equal(t, upstreamHost+"/ns/repo:tag", src.physicalRef.ref.String())
+
+	// If all locations fail, the error refers to all of them
+	upstream.repos = nil
+	_, err = newImageSource(context.Background(), sys, ref.(dockerReference))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), upstreamHost+"/ns/repo:tag")
+	assert.Contains(t, err.Error(), mirror1Host+"/ns/repo:tag")
+	assert.Contains(t, err.Error(), mirror2Host+"/mirrored/ns/repo:tag")
+
+	// Without mirrors, the registry is not contacted until necessary
+	upstream.requests = nil
+	sys.DockerRegistryMirrors = nil
+	src, err = newImageSource(context.Background(), sys, ref.(dockerReference))
+	require.NoError(t, err)
+	assert.Equal(t, ref, src.physicalRef)
+	assert.Empty(t, upstream.requests)
+}
+
+func TestNewImageSourcePrefetchAnonymousBearerToken(t *testing.T) {
+	tokenRequests := make(chan string, 10)
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests <- r.URL.Query().Get("scope")
+		fmt.Fprint(w, `{"token":"token","expires_in":3600}`)
+	}))
+	defer authServer.Close()
+	registryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, authServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", manifest.DockerV2Schema2MediaType)
+		fmt.Fprint(w, `{"schemaVersion":2}`)
+	}))
+	defer registryServer.Close()
+
+	tmpDir, err := ioutil.TempDir("", "prefetch-token")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+		RegistriesDirPath:           tmpDir,
+		DockerInsecureSkipTLSVerify: true,
+	}
+	newSource := func(repo string) *dockerImageSource {
+		ref, err := ParseReference("//" + registryServer.Listener.Addr().String() + "/" + repo + ":tag")
+		require.NoError(t, err)
+		src, err := newImageSource(context.Background(), sys, ref.(dockerReference))
+		require.NoError(t, err)
+		return src
+	}
+
+	// Without a recent ping, nothing is prefetched, and the token is obtained when necessary
+	src := newSource("ns/repo")
+	defer src.Close()
+	assert.Len(t, tokenRequests, 0)
+	_, _, err = src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "repository:ns/repo:pull", <-tokenRequests)
+
+	// With a recent ping, the token for another repository is obtained before the manifest is requested
+	src = newSource("ns/other")
+	defer src.Close()
+	select {
+	case scope := <-tokenRequests:
+		assert.Equal(t, "repository:ns/other:pull", scope)
+	case <-time.After(10 * time.Second):
+		t.Fatal("The token was not prefetched")
+	}
+	_, _, err = src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, tokenRequests, 0)
+}
+
+func TestDockerImageSourceFetchManifestAccept(t *testing.T) {
+	var accepted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header["Accept"]
+		w.Header().Set("Content-Type", imgspecv1.MediaTypeImageIndex)
+		fmt.Fprint(w, `{"schemaVersion":2,"manifests":[]}`)
+	}))
+	defer server.Close()
+	ref, err := ParseReference("//" + server.Listener.Addr().String() + "/ns/repo:tag")
+	require.NoError(t, err)
+	src := &dockerImageSource{
+		ref:         ref.(dockerReference),
+		physicalRef: ref.(dockerReference),
+		c:           &dockerClient{registry: server.Listener.Addr().String(), client: server.Client(), scheme: "http"},
+	}
+
+	_, mimeType, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageIndex, mimeType)
+	for _, mt := range []string{imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageIndex, manifest.DockerV2Schema2MediaType, manifest.DockerV2ListMediaType} {
+		assert.Contains(t, accepted, mt)
+	}
+	// Schema1 is only accepted as a last resort
+	assert.Equal(t, manifest.DockerV2Schema2MediaType, accepted[0])
+	assert.Equal(t, manifest.DockerV2Schema1MediaType, accepted[len(accepted)-1])
+}
+
+func TestDockerImageSourceBlobSize(t *testing.T) {
+	blobDigest := digest.FromString("blob")
+	failingDigest := digest.FromString("failing")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/ns/repo/blobs/"+failingDigest.String() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Method != "HEAD" || r.URL.Path != "/v2/ns/repo/blobs/"+blobDigest.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "1234")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	ref, err := ParseReference("//" + server.Listener.Addr().String() + "/ns/repo:tag")
+	require.NoError(t, err)
+	src := &dockerImageSource{
+		ref:         ref.(dockerReference),
+		physicalRef: ref.(dockerReference),
+		c:           &dockerClient{registry: server.Listener.Addr().String(), client: server.Client(), scheme: "http"},
+	}
+
+	size, err := src.BlobSize(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), size)
+	// Missing blobs have an unknown size
+	size, err = src.BlobSize(context.Background(), types.BlobInfo{Digest: digest.FromString("missing"), Size: -1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), size)
+	_, err = src.BlobSize(context.Background(), types.BlobInfo{Digest: failingDigest, Size: -1})
+	assert.Error(t, err)
+	// Foreign layers are not looked up in the registry
+	size, err = src.BlobSize(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1, URLs: []string{"https://example.com/blob"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), size)
+}
+
+func TestDockerImageSourceVerifySchema1Signatures(t *testing.T) {
+	var manblob []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", manifest.DockerV2Schema1SignedMediaType)
+		w.Write(manblob)
+	}))
+	defer server.Close()
+	ref, err := ParseReference("//" + server.Listener.Addr().String() + "/ns/repo:tag")
+	require.NoError(t, err)
+	valid, err := ioutil.ReadFile("../manifest/fixtures/v2s1.manifest.json")
+	require.NoError(t, err)
+	invalid, err := ioutil.ReadFile("../manifest/fixtures/v2s1-invalid-signatures.manifest.json")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		manifest []byte
+		verify   bool
+		success  bool
+	}{
+		{valid, false, true},
+		{valid, true, true},
+		{invalid, false, true},
+		{invalid, true, false},
+	} {
+		manblob = c.manifest
+		src := &dockerImageSource{
+			ref:         ref.(dockerReference),
+			physicalRef: ref.(dockerReference),
+			c: &dockerClient{registry: server.Listener.Addr().String(), client: server.Client(), scheme: "http",
+				sys: &types.SystemContext{DockerVerifySchema1Signatures: c.verify}},
+		}
+		res, _, err := src.GetManifest(context.Background(), nil)
+		if c.success {
+			require.NoError(t, err)
+			assert.Equal(t, c.manifest, res)
+		} else {
+			assert.Error(t, err)
+		}
+	}
+}
+
+func TestDeleteImage(t *testing.T) {
+	const manifestBlob = `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`
+	manifestDigest := digest.FromString(manifestBlob)
+	deleteStatus := http.StatusAccepted
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.Method == "GET" && r.URL.Path == "/v2/ns/repo/manifests/tag":
+			assert.Contains(t, r.Header["Accept"], imgspecv1.MediaTypeImageIndex)
+			w.Header().Set("Content-Type", manifest.DockerV2Schema2MediaType)
+			w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+			fmt.Fprint(w, manifestBlob)
+		case r.Method == "DELETE" && r.URL.Path == "/v2/ns/repo/manifests/"+manifestDigest.String():
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(deleteStatus)
+			if deleteStatus == http.StatusMethodNotAllowed {
+				fmt.Fprint(w, `{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "delete-image")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	registriesDir := filepath.Join(tmpDir, "registries.d")
+	require.NoError(t, os.Mkdir(registriesDir, 0700))
+	err = ioutil.WriteFile(filepath.Join(registriesDir, "default.yaml"), []byte("default-docker:\n  sigstore: file://"+filepath.Join(tmpDir, "sigstore")+"\n"), 0600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    filepath.Join(tmpDir, "registries.conf"), // Does not exist
+		RegistriesDirPath:           registriesDir,
+		DockerInsecureSkipTLSVerify: true,
+	}
+	ref, err := ParseReference("//" + server.Listener.Addr().String() + "/ns/repo:tag")
+	require.NoError(t, err)
+
+	// The image and its signatures are deleted
+	sigBase, err := configuredSignatureStorageBase(sys, ref.(dockerReference), true)
+	require.NoError(t, err)
+	var sigPaths []string
+	for i := 0; i < 2; i++ {
+		path := signatureStorageURL(sigBase, manifestDigest, i).Path
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte("signature"), 0600))
+		sigPaths = append(sigPaths, path)
+	}
+	err = ref.DeleteImage(context.Background(), sys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/v2/ns/repo/manifests/" + manifestDigest.String()}, deleted)
+	for _, path := range sigPaths {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+
+	// Registry errors are reported
+	deleteStatus = http.StatusMethodNotAllowed
+	err = ref.DeleteImage(context.Background(), sys)
+	require.Error(t, err)
+	assert.IsType(t, errcode.Errors{}, errors.Cause(err))
+	assert.Contains(t, err.Error(), "not supported by the registry")
+
+	// Missing images are reported
+	missingRef, err := ParseReference("//" + server.Listener.Addr().String() + "/ns/repo:missing")
+	require.NoError(t, err)
+	err = missingRef.DeleteImage(context.Background(), sys)
+	assert.Error(t, err)
+}
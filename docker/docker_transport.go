@@ -38,6 +38,29 @@ func (t dockerTransport) ValidatePolicyConfigurationScope(scope string) error {
 	// FIXME? We could be verifying the various character set and length restrictions
 	// from docker/distribution/reference.regexp.go, but other than that there
 	// are few semantically invalid strings.
+	if strings.Contains(scope, "*") {
+		return validateWildcardScope(scope)
+	}
+	return nil
+}
+
+// validateWildcardScope checks that a scope containing "*" uses one of the supported wildcard forms:
+// "*.example.com", matching any subdomain of a registry host name, or "host[/namespace…]/*", matching anything within a namespace.
+func validateWildcardScope(scope string) error {
+	switch {
+	case strings.HasPrefix(scope, "*."):
+		rest := scope[len("*."):]
+		if rest == "" || strings.ContainsAny(rest, "*/") {
+			return errors.Errorf("Invalid scope %s: a host name wildcard must have the form *.example.com", scope)
+		}
+	case strings.HasSuffix(scope, "/*"):
+		rest := scope[:len(scope)-len("/*")]
+		if rest == "" || strings.Contains(rest, "*") {
+			return errors.Errorf("Invalid scope %s: a namespace wildcard must have the form host/namespace/*", scope)
+		}
+	default:
+		return errors.Errorf("Invalid scope %s: wildcards are only supported as *.example.com or host/namespace/*", scope)
+	}
 	return nil
 }
 
@@ -135,7 +158,7 @@ func (ref dockerReference) NewImage(ctx context.Context, sys *types.SystemContex
 // NewImageSource returns a types.ImageSource for this reference.
 // The caller must call .Close() on the returned ImageSource.
 func (ref dockerReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
-	return newImageSource(sys, ref)
+	return newImageSource(ctx, sys, ref)
 }
 
 // NewImageDestination returns a types.ImageDestination for this reference.
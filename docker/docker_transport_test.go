@@ -30,10 +30,29 @@ func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
 		"docker.io/library/busybox",
 		"docker.io/library",
 		"docker.io",
+		"*.example.com",
+		"*.example.com:5000",
+		"registry.example.com/team/*",
+		"registry.example.com/*",
 	} {
 		err := Transport.ValidatePolicyConfigurationScope(scope)
 		assert.NoError(t, err, scope)
 	}
+
+	for _, scope := range []string{
+		"*",
+		"*.",
+		"*example.com",
+		"*.example.com/repo",
+		"*.*.example.com",
+		"/*",
+		"registry.example.com/*/repo",
+		"registry.example.com/team*",
+		"registry.example.com/repo:*",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
 }
 
 func TestParseReference(t *testing.T) {
@@ -0,0 +1,119 @@
+package docker
+
+// Based on github.com/docker/distribution/registry/client/errors.go, primarily limiting the amount of data read from the registry.
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/containers/image/internal/iolimits"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/client"
+)
+
+// maxErrorResponseTextSize is the maximum size of an unparseable error response body included in the returned error.
+const maxErrorResponseTextSize = 1024
+
+// registryHTTPResponseToError returns an error describing an unsuccessful HTTP response res from a registry.
+// Unlike client.HandleErrorResponse, it reads at most iolimits.MaxErrorBodySize bytes of the response body,
+// and includes at most maxErrorResponseTextSize bytes of it in the error if the body can not be parsed.
+func registryHTTPResponseToError(res *http.Response) error {
+	if res.StatusCode < 400 || res.StatusCode >= 500 {
+		return &client.UnexpectedHTTPStatusError{Status: res.Status}
+	}
+
+	// Check for OAuth errors within the WWW-Authenticate header first.
+	// See https://tools.ietf.org/html/rfc6750#section-3
+	for _, c := range parseAuthHeader(res.Header) {
+		if c.Scheme != "bearer" {
+			continue
+		}
+		var err errcode.Error
+		// Codes defined at https://tools.ietf.org/html/rfc6750#section-3.1
+		switch c.Parameters["error"] {
+		case "invalid_token":
+			err.Code = errcode.ErrorCodeUnauthorized
+		case "insufficient_scope":
+			err.Code = errcode.ErrorCodeDenied
+		default:
+			continue
+		}
+		if description := c.Parameters["error_description"]; description != "" {
+			err.Message = description
+		} else {
+			err.Message = err.Code.Message()
+		}
+		return mergeErrors(err, parseHTTPErrorResponse(res.StatusCode, res.Body))
+	}
+
+	err := parseHTTPErrorResponse(res.StatusCode, res.Body)
+	if uErr, ok := err.(*client.UnexpectedHTTPResponseError); ok && res.StatusCode == http.StatusUnauthorized {
+		return errcode.ErrorCodeUnauthorized.WithDetail(uErr.Response)
+	}
+	return err
+}
+
+// parseHTTPErrorResponse parses an error response body from r, received with statusCode.
+func parseHTTPErrorResponse(statusCode int, r io.Reader) error {
+	body, err := ioutil.ReadAll(io.LimitReader(r, iolimits.MaxErrorBodySize))
+	if err != nil {
+		return err
+	}
+
+	// For backward compatibility, handle irregularly formatted
+	// messages that contain a "details" field.
+	var detailsErr struct {
+		Details string `json:"details"`
+	}
+	if err := json.Unmarshal(body, &detailsErr); err == nil && detailsErr.Details != "" {
+		switch statusCode {
+		case http.StatusUnauthorized:
+			return errcode.ErrorCodeUnauthorized.WithMessage(detailsErr.Details)
+		case http.StatusTooManyRequests:
+			return errcode.ErrorCodeTooManyRequests.WithMessage(detailsErr.Details)
+		default:
+			return errcode.ErrorCodeUnknown.WithMessage(detailsErr.Details)
+		}
+	}
+
+	var errors errcode.Errors
+	if err := json.Unmarshal(body, &errors); err != nil {
+		return &client.UnexpectedHTTPResponseError{
+			ParseErr:   err,
+			StatusCode: statusCode,
+			Response:   truncateErrorResponse(body),
+		}
+	}
+	if len(errors) == 0 {
+		// If there was no error specified in the body, return UnexpectedHTTPResponseError.
+		return &client.UnexpectedHTTPResponseError{
+			ParseErr:   client.ErrNoErrorsInBody,
+			StatusCode: statusCode,
+			Response:   truncateErrorResponse(body),
+		}
+	}
+	return errors
+}
+
+// truncateErrorResponse returns body, truncated to at most maxErrorResponseTextSize bytes.
+func truncateErrorResponse(body []byte) []byte {
+	if len(body) > maxErrorResponseTextSize {
+		return body[:maxErrorResponseTextSize]
+	}
+	return body
+}
+
+// mergeErrors returns an errcode.Errors containing all errors in err1 and err2.
+func mergeErrors(err1, err2 error) error {
+	return errcode.Errors(append(makeErrorList(err1), makeErrorList(err2)...))
+}
+
+// makeErrorList returns err as a list of errors.
+func makeErrorList(err error) []error {
+	if errL, ok := err.(errcode.Errors); ok {
+		return []error(errL)
+	}
+	return []error{err}
+}
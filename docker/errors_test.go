@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/internal/iolimits"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorResponse returns a HTTP response with statusCode, header and body.
+func errorResponse(statusCode int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:     http.StatusText(statusCode),
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestRegistryHTTPResponseToError(t *testing.T) {
+	// Unexpected status codes
+	err := registryHTTPResponseToError(errorResponse(http.StatusInternalServerError, nil, "error"))
+	assert.IsType(t, &client.UnexpectedHTTPStatusError{}, err)
+
+	// A distribution error response
+	err = registryHTTPResponseToError(errorResponse(http.StatusNotFound, nil,
+		`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"no such manifest"}]}`))
+	require.IsType(t, errcode.Errors{}, err)
+	errs := err.(errcode.Errors)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "no such manifest", errs[0].(errcode.Error).Message)
+
+	// A "details" response
+	err = registryHTTPResponseToError(errorResponse(http.StatusTooManyRequests, nil, `{"details":"slow down"}`))
+	require.IsType(t, errcode.Error{}, err)
+	assert.Equal(t, errcode.ErrorCodeTooManyRequests, err.(errcode.Error).Code)
+	assert.Equal(t, "slow down", err.(errcode.Error).Message)
+
+	// An OAuth error in WWW-Authenticate
+	err = registryHTTPResponseToError(errorResponse(http.StatusForbidden,
+		http.Header{"Www-Authenticate": {`Bearer realm="https://auth.example.com/token",error="insufficient_scope"`}},
+		`{"errors":[{"code":"DENIED","message":"denied"}]}`))
+	require.IsType(t, errcode.Errors{}, err)
+	errs = err.(errcode.Errors)
+	require.Len(t, errs, 2)
+	assert.Equal(t, errcode.ErrorCodeDenied, errs[0].(errcode.Error).Code)
+
+	// Unparseable responses
+	err = registryHTTPResponseToError(errorResponse(http.StatusUnauthorized, nil, "go away"))
+	require.IsType(t, errcode.Error{}, err)
+	assert.Equal(t, errcode.ErrorCodeUnauthorized, err.(errcode.Error).Code)
+	err = registryHTTPResponseToError(errorResponse(http.StatusBadRequest, nil, `{"errors":[]}`))
+	require.IsType(t, &client.UnexpectedHTTPResponseError{}, err)
+	assert.Equal(t, client.ErrNoErrorsInBody, err.(*client.UnexpectedHTTPResponseError).ParseErr)
+
+	// A huge response body is not read completely, and is truncated in the error.
+	body := &countingReader{reader: bytes.NewReader(bytes.Repeat([]byte("x"), 2*iolimits.MaxErrorBodySize))}
+	err = registryHTTPResponseToError(&http.Response{
+		Status:     http.StatusText(http.StatusBadRequest),
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(body),
+	})
+	require.IsType(t, &client.UnexpectedHTTPResponseError{}, err)
+	assert.Equal(t, bytes.Repeat([]byte("x"), maxErrorResponseTextSize), err.(*client.UnexpectedHTTPResponseError).Response)
+	assert.True(t, body.count <= iolimits.MaxErrorBodySize)
+}
+
+// countingReader is an io.Reader which records the number of bytes read from reader.
+type countingReader struct {
+	reader *bytes.Reader
+	count  int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += n
+	return n, err
+}
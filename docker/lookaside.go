@@ -38,6 +38,12 @@ type registryConfiguration struct {
 type registryNamespace struct {
 	SigStore        string `json:"sigstore"`         // For reading, and if SigStoreStaging is not present, for writing.
 	SigStoreStaging string `json:"sigstore-staging"` // For writing only.
+	// UseSigstoreAttachments, if set, specifies whether sigstore signatures are stored in the registry, attached to images;
+	// nil means the value is inherited from a more general scope.
+	UseSigstoreAttachments *bool `json:"use-sigstore-attachments,omitempty"`
+	// UseNotationSignatures, if set, specifies whether Notation signatures attached to images in the registry are read;
+	// nil means the value is inherited from a more general scope.
+	UseNotationSignatures *bool `json:"use-notation-signatures,omitempty"`
 }
 
 // signatureStorageBase is an "opaque" type representing a lookaside Docker signature storage.
@@ -73,6 +79,26 @@ func configuredSignatureStorageBase(sys *types.SystemContext, ref dockerReferenc
 	return url, nil
 }
 
+// configuredUseSigstoreAttachments reads configuration to determine whether sigstore signatures of ref
+// are stored in the registry, attached to the images.
+func configuredUseSigstoreAttachments(sys *types.SystemContext, ref dockerReference) (bool, error) {
+	config, err := loadAndMergeConfig(registriesDirPath(sys))
+	if err != nil {
+		return false, err
+	}
+	return config.useSigstoreAttachments(ref), nil
+}
+
+// configuredUseNotationSignatures reads configuration to determine whether Notation signatures of ref,
+// attached to the images in the registry, are read.
+func configuredUseNotationSignatures(sys *types.SystemContext, ref dockerReference) (bool, error) {
+	config, err := loadAndMergeConfig(registriesDirPath(sys))
+	if err != nil {
+		return false, err
+	}
+	return config.useNotationSignatures(ref), nil
+}
+
 // registriesDirPath returns a path to registries.d
 func registriesDirPath(sys *types.SystemContext) string {
 	if sys != nil {
@@ -175,6 +201,35 @@ func (config *registryConfiguration) signatureTopLevel(ref dockerReference, writ
 	return ""
 }
 
+// config.useSigstoreAttachments returns whether sigstore signatures of ref are stored in the registry,
+// as configured by the most specific namespace which sets use-sigstore-attachments.
+func (config *registryConfiguration) useSigstoreAttachments(ref dockerReference) bool {
+	return config.namespaceFlag(ref, func(ns registryNamespace) *bool { return ns.UseSigstoreAttachments })
+}
+
+// config.useNotationSignatures returns whether Notation signatures of ref are read from the registry,
+// as configured by the most specific namespace which sets use-notation-signatures.
+func (config *registryConfiguration) useNotationSignatures(ref dockerReference) bool {
+	return config.namespaceFlag(ref, func(ns registryNamespace) *bool { return ns.UseNotationSignatures })
+}
+
+// config.namespaceFlag returns the value of a boolean option, returned by flag, for ref,
+// as configured by the most specific namespace which sets it, or false if it is not set at all.
+func (config *registryConfiguration) namespaceFlag(ref dockerReference, flag func(registryNamespace) *bool) bool {
+	if config.Docker != nil {
+		names := append([]string{ref.PolicyConfigurationIdentity()}, ref.PolicyConfigurationNamespaces()...)
+		for _, name := range names {
+			if ns, ok := config.Docker[name]; ok && flag(ns) != nil {
+				return *flag(ns)
+			}
+		}
+	}
+	if config.DefaultDocker != nil && flag(*config.DefaultDocker) != nil {
+		return *flag(*config.DefaultDocker)
+	}
+	return false
+}
+
 // ns.signatureTopLevel returns an URL string configured in ns for ref, for write access if “write”.
 // or "" if nothing has been configured.
 func (ns registryNamespace) signatureTopLevel(write bool) string {
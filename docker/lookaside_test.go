@@ -231,6 +231,33 @@ func TestRegistryConfigurationSignaureTopLevel(t *testing.T) {
 	assert.Equal(t, "", res)
 }
 
+func TestRegistryConfigurationUseNotationSignatures(t *testing.T) {
+	yes, no := true, false
+	config := registryConfiguration{
+		DefaultDocker: &registryNamespace{UseNotationSignatures: &yes},
+		Docker: map[string]registryNamespace{
+			"example.com":          {UseNotationSignatures: &no},
+			"example.com/ns1":      {SigStore: "https://sigstore.example.com"}, // Does not set the value, so it is inherited
+			"example.com/ns1/repo": {UseNotationSignatures: &yes, UseSigstoreAttachments: &yes},
+		},
+	}
+	for _, c := range []struct {
+		input              string
+		notation, sigstore bool
+	}{
+		{"example.com/ns1/repo:tag", true, true},
+		{"example.com/ns1/other:tag", false, false},
+		{"example.com/ns2/repo:tag", false, false},
+		{"other.example.com/repo:tag", true, false},
+	} {
+		dr := dockerRefFromString(t, "//"+c.input)
+		assert.Equal(t, c.notation, config.useNotationSignatures(dr), c.input)
+		assert.Equal(t, c.sigstore, config.useSigstoreAttachments(dr), c.input)
+	}
+
+	assert.False(t, (&registryConfiguration{}).useNotationSignatures(dockerRefFromString(t, "//example.com/repo:tag")))
+}
+
 func TestRegistryNamespaceSignatureTopLevel(t *testing.T) {
 	for _, c := range []struct {
 		ns         registryNamespace
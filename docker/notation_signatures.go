@@ -0,0 +1,64 @@
+package docker
+
+import (
+	"context"
+
+	internalsig "github.com/containers/image/internal/signature"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// Notation (Notary v2) signatures are stored in the registry as OCI manifests with notationSignatureArtifactType,
+// which refer to the signed image as their subject, and contain a signature envelope as their only layer.
+// They are found using the OCI referrers API, or the referrers tag schema if the registry does not support the API.
+// Only reading the signatures is supported; they are created by the notation tool.
+// NOTE: Keep this in sync with docs/signature-protocols.md!
+
+const (
+	// notationSignatureArtifactType is the artifact type of manifests containing Notation signatures.
+	notationSignatureArtifactType = "application/vnd.cncf.notary.signature"
+	// notationJWSMediaType and notationCOSEMediaType are the media types of layers containing Notation signature envelopes.
+	notationJWSMediaType  = "application/jose+json"
+	notationCOSEMediaType = "application/cose"
+)
+
+// getNotationSignatures returns the Notation signatures of manifestDigest stored in ref, serialized as Notation signature blobs.
+func (c *dockerClient) getNotationSignatures(ctx context.Context, ref dockerReference, manifestDigest digest.Digest) ([][]byte, error) {
+	manifestDigests, err := c.getReferrers(ctx, ref, manifestDigest, notationSignatureArtifactType)
+	if err != nil {
+		return nil, err
+	}
+	signatures := [][]byte{}
+	for _, d := range manifestDigests {
+		m, _, err := c.getAttachmentManifest(ctx, ref, d.String())
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+		if m.Subject == nil || m.Subject.Digest != manifestDigest {
+			logrus.Debugf("Ignoring Notation signature manifest %s which does not refer to %s", d, manifestDigest)
+			continue
+		}
+		for _, layer := range m.Layers {
+			if layer.MediaType != notationJWSMediaType && layer.MediaType != notationCOSEMediaType {
+				logrus.Debugf("Ignoring a Notation signature layer with media type %s", layer.MediaType)
+				continue
+			}
+			envelope, err := c.getAttachmentBlob(ctx, ref, layer)
+			if err != nil {
+				return nil, err
+			}
+			sig, err := internalsig.Notation{
+				MediaType: layer.MediaType,
+				Envelope:  envelope,
+			}.Blob()
+			if err != nil {
+				return nil, err
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+	return signatures, nil
+}
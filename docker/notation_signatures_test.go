@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	internalsig "github.com/containers/image/internal/signature"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addNotationTestSignature adds a Notation signature manifest for subject, containing a layer with mediaType and envelope, to registry,
+// and returns the digest of the manifest.
+func addNotationTestSignature(t *testing.T, registry *attachmentRegistryMock, subject imgspecv1.Descriptor, mediaType string, envelope []byte) digest.Digest {
+	registry.blobs[digest.FromBytes(envelope)] = envelope
+	m, err := json.Marshal(attachmentManifest{
+		SchemaVersion: 2,
+		MediaType:     imgspecv1.MediaTypeImageManifest,
+		ArtifactType:  notationSignatureArtifactType,
+		Config:        imgspecv1.Descriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: digest.FromString("{}"), Size: 2},
+		Layers:        []imgspecv1.Descriptor{{MediaType: mediaType, Digest: digest.FromBytes(envelope), Size: int64(len(envelope))}},
+		Subject:       &subject,
+	})
+	require.NoError(t, err)
+	registry.manifests[digest.FromBytes(m).String()] = m
+	return digest.FromBytes(m)
+}
+
+func TestNotationSignatures(t *testing.T) {
+	imageManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`)
+	imageDigest := digest.FromBytes(imageManifest)
+	subject := imgspecv1.Descriptor{MediaType: "application/vnd.docker.distribution.manifest.v2+json", Digest: imageDigest, Size: int64(len(imageManifest))}
+	otherSubject := imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: digest.FromString("other"), Size: 5}
+
+	for _, referrers := range []bool{false, true} {
+		registry := newAttachmentRegistryMock(t, referrers)
+		server := httptest.NewServer(registry)
+
+		dest := uploadTestDestination(t, server, &types.SystemContext{})
+		src := &dockerImageSource{ref: dest.ref, physicalRef: dest.ref, c: dest.c}
+		src.c.useNotationSignatures = true
+
+		// No signatures
+		sigs, err := src.GetSignatures(context.Background(), &imageDigest)
+		require.NoError(t, err)
+		assert.Empty(t, sigs)
+
+		jws := addNotationTestSignature(t, registry, subject, notationJWSMediaType, []byte(`{"payload":"jws"}`))
+		cose := addNotationTestSignature(t, registry, subject, notationCOSEMediaType, []byte("cose"))
+		unknown := addNotationTestSignature(t, registry, subject, "application/unknown", []byte("unknown"))
+		other := addNotationTestSignature(t, registry, otherSubject, notationJWSMediaType, []byte(`{"payload":"other"}`))
+		if !referrers {
+			// The referrers tag schema; this includes a stale entry referring to a different image.
+			index, err := json.Marshal(map[string]interface{}{
+				"schemaVersion": 2,
+				"mediaType":     imgspecv1.MediaTypeImageIndex,
+				"manifests": []map[string]interface{}{
+					{"mediaType": imgspecv1.MediaTypeImageManifest, "digest": jws, "artifactType": notationSignatureArtifactType},
+					{"mediaType": imgspecv1.MediaTypeImageManifest, "digest": cose, "artifactType": notationSignatureArtifactType},
+					{"mediaType": imgspecv1.MediaTypeImageManifest, "digest": unknown, "artifactType": notationSignatureArtifactType},
+					{"mediaType": imgspecv1.MediaTypeImageManifest, "digest": other, "artifactType": notationSignatureArtifactType},
+					{"mediaType": imgspecv1.MediaTypeImageManifest, "digest": digest.FromString("sigstore"), "artifactType": sigstoreSignatureArtifactType},
+				},
+			})
+			require.NoError(t, err)
+			registry.manifests[strings.Replace(imageDigest.String(), ":", "-", 1)] = index
+		}
+
+		sigs, err = src.GetSignatures(context.Background(), &imageDigest)
+		require.NoError(t, err)
+		require.Len(t, sigs, 2)
+		expected := map[string]string{notationJWSMediaType: `{"payload":"jws"}`, notationCOSEMediaType: "cose"}
+		for _, blob := range sigs {
+			sig, err := internalsig.NotationFromBlob(blob)
+			require.NoError(t, err)
+			assert.Equal(t, expected[sig.MediaType], string(sig.Envelope))
+			delete(expected, sig.MediaType)
+		}
+
+		// Notation signatures are only read if configured
+		src.c.useNotationSignatures = false
+		sigs, err = src.GetSignatures(context.Background(), &imageDigest)
+		require.NoError(t, err)
+		assert.Empty(t, sigs)
+
+		server.Close()
+	}
+}
@@ -10,19 +10,19 @@ import (
 // DockerReferenceIdentity returns a string representation of the reference, suitable for policy lookup,
 // as a backend for ImageReference.PolicyConfigurationIdentity.
 // The reference must satisfy !reference.IsNameOnly().
+// A reference with both a tag and a digest is identified by the digest, which determines the image;
+// the tag is used only by DockerReferenceNamespaces.
 func DockerReferenceIdentity(ref reference.Named) (string, error) {
 	res := ref.Name()
 	tagged, isTagged := ref.(reference.NamedTagged)
 	digested, isDigested := ref.(reference.Canonical)
 	switch {
-	case isTagged && isDigested: // Note that this CAN actually happen.
-		return "", errors.Errorf("Unexpected Docker reference %s with both a name and a digest", reference.FamiliarString(ref))
 	case !isTagged && !isDigested: // This should not happen, the caller is expected to ensure !reference.IsNameOnly()
 		return "", errors.Errorf("Internal inconsistency: Docker reference %s with neither a tag nor a digest", reference.FamiliarString(ref))
+	case isDigested: // Includes the case when ref has both a tag and a digest; note that this CAN actually happen.
+		res = res + "@" + digested.Digest().String()
 	case isTagged:
 		res = res + ":" + tagged.Tag()
-	case isDigested:
-		res = res + "@" + digested.Digest().String()
 	default: // Coverage: The above was supposed to be exhaustive.
 		return "", errors.New("Internal inconsistency, unexpected default branch")
 	}
@@ -42,6 +42,12 @@ func DockerReferenceNamespaces(ref reference.Named) []string {
 	// ref.FullName() == ref.Hostname() + "/" + ref.RemoteName(), so the last
 	// iteration matches the host name (for any namespace).
 	res := []string{}
+	// For a reference with both a tag and a digest, the identity uses the digest, so look for a match of the tag first.
+	if tagged, isTagged := ref.(reference.NamedTagged); isTagged {
+		if _, isDigested := ref.(reference.Canonical); isDigested {
+			res = append(res, ref.Name()+":"+tagged.Tag())
+		}
+	}
 	name := ref.Name()
 	for {
 		res = append(res, name)
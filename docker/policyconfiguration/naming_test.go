@@ -66,14 +66,22 @@ func TestDockerReferenceIdentity(t *testing.T) {
 	assert.Equal(t, "", id)
 	assert.Error(t, err)
 
+}
+
+func TestDockerReferenceWithTagAndDigest(t *testing.T) {
+	const sha256Digest = "@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
 	// A github.com/distribution/reference value can have a tag and a digest at the same time!
-	parsed, err = reference.ParseNormalizedNamed("busybox:notlatest@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	parsed, err := reference.ParseNormalizedNamed("example.com/ns/repo:notlatest" + sha256Digest)
 	require.NoError(t, err)
 	_, ok := parsed.(reference.Canonical)
 	require.True(t, ok)
 	_, ok = parsed.(reference.NamedTagged)
 	require.True(t, ok)
-	id, err = DockerReferenceIdentity(parsed)
-	assert.Equal(t, "", id)
-	assert.Error(t, err)
+
+	id, err := DockerReferenceIdentity(parsed)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/ns/repo"+sha256Digest, id)
+
+	ns := DockerReferenceNamespaces(parsed)
+	assert.Equal(t, []string{"example.com/ns/repo:notlatest", "example.com/ns/repo", "example.com/ns", "example.com"}, ns)
 }
@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"io"
+
+	"github.com/containers/image/internal/progress"
+	"github.com/containers/image/types"
+)
+
+// progressReadCloser is a progress.Reader which also closes the underlying stream.
+type progressReadCloser struct {
+	*progress.Reader
+	closer io.Closer
+}
+
+func (r progressReadCloser) Close() error {
+	return r.closer.Close()
+}
+
+// progressReader returns a reader of stream, reporting progress of a transfer of artifact if requested by c.sys.
+// Reports are sent synchronously, so reading blocks until c.sys.DockerRegistryProgress is read.
+func (c *dockerClient) progressReader(stream io.Reader, artifact types.BlobInfo) io.Reader {
+	if c.sys == nil || c.sys.DockerRegistryProgress == nil {
+		return stream
+	}
+	return progress.NewReader(stream, c.sys.DockerRegistryProgress, c.sys.DockerRegistryProgressInterval, artifact)
+}
+
+// progressReadCloser is like progressReader, for an io.ReadCloser.
+func (c *dockerClient) progressReadCloser(stream io.ReadCloser, artifact types.BlobInfo) io.ReadCloser {
+	r, ok := c.progressReader(stream, artifact).(*progress.Reader)
+	if !ok {
+		return stream
+	}
+	return progressReadCloser{Reader: r, closer: stream}
+}
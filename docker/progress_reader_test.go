@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/containers/image/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorCloser is an io.Closer which fails.
+type errorCloser struct{}
+
+func (errorCloser) Read(p []byte) (int, error) { return 0, nil }
+func (errorCloser) Close() error               { return assert.AnError }
+
+func TestDockerClientProgressReader(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 1000)
+	artifact := types.BlobInfo{Digest: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", Size: 1000}
+
+	// Nothing is wrapped if progress is not requested
+	for _, sys := range []*types.SystemContext{nil, {}} {
+		c := &dockerClient{sys: sys}
+		stream := bytes.NewReader(data)
+		assert.True(t, c.progressReader(stream, artifact) == stream)
+		closer := ioutil.NopCloser(stream)
+		assert.Equal(t, closer, c.progressReadCloser(closer, artifact))
+	}
+
+	// Every read is reported with a zero interval, as well as the end of the data
+	ch := make(chan types.ProgressProperties, 100)
+	c := &dockerClient{sys: &types.SystemContext{DockerRegistryProgress: ch}}
+	r := c.progressReader(bytes.NewReader(data), artifact)
+	buf := make([]byte, 300)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			break
+		}
+	}
+	close(ch)
+	var offsets, offsetUpdates []uint64
+	for p := range ch {
+		assert.Equal(t, types.ProgressEventRead, p.Event)
+		assert.Equal(t, artifact, p.Artifact)
+		offsets = append(offsets, p.Offset)
+		offsetUpdates = append(offsetUpdates, p.OffsetUpdate)
+	}
+	assert.Equal(t, []uint64{300, 600, 900, 1000}, offsets)
+	assert.Equal(t, []uint64{300, 300, 300, 100}, offsetUpdates)
+
+	// With a long interval, only the end of the data is reported
+	ch = make(chan types.ProgressProperties, 100)
+	c = &dockerClient{sys: &types.SystemContext{DockerRegistryProgress: ch, DockerRegistryProgressInterval: time.Hour}}
+	rc := c.progressReadCloser(ioutil.NopCloser(bytes.NewReader(data)), artifact)
+	for {
+		if _, err := rc.Read(buf); err != nil {
+			break
+		}
+	}
+	err := rc.Close()
+	assert.NoError(t, err)
+	close(ch)
+	offsets = nil
+	for p := range ch {
+		offsets = append(offsets, p.Offset)
+	}
+	assert.Equal(t, []uint64{1000}, offsets)
+
+	// Close errors are reported
+	rc = c.progressReadCloser(errorCloser{}, artifact)
+	assert.Equal(t, assert.AnError, rc.Close())
+}
+
+func TestDockerImageDestinationPutBlobProgress(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789"), 100)
+	registry := &uploadRegistryMock{t: t}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	ch := make(chan types.ProgressProperties, 100)
+	dest := uploadTestDestination(t, server, &types.SystemContext{
+		DockerRegistryUploadChunkSize: 400,
+		DockerRegistryProgress:        ch,
+	})
+
+	inputInfo := types.BlobInfo{Size: int64(len(blob))}
+	_, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), inputInfo, false)
+	require.NoError(t, err)
+	close(ch)
+	var last types.ProgressProperties
+	for p := range ch {
+		assert.Equal(t, inputInfo, p.Artifact)
+		assert.True(t, p.Offset >= last.Offset)
+		last = p
+	}
+	assert.Equal(t, uint64(len(blob)), last.Offset)
+}
@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/pkg/sysregistriesv2"
+	"github.com/containers/image/types"
+	"github.com/pkg/errors"
+)
+
+// BlockedRegistryError is returned when pulling from, or pushing to, a registry which is blocked in the registries configuration.
+type BlockedRegistryError struct {
+	Registry string // The blocked registry, as specified in the registries configuration
+}
+
+func (e BlockedRegistryError) Error() string {
+	return fmt.Sprintf("registry %s is blocked in the registries configuration", e.Registry)
+}
+
+// registriesConfEntry returns the registries.conf entry applicable to name (a repository, or a registry host[:port]),
+// or nil if there is none.
+// A missing registries.conf, or invalid entries in it which don't apply to name, are not an error.
+func registriesConfEntry(sys *types.SystemContext, name string) (*sysregistriesv2.Registry, error) {
+	registry, err := sysregistriesv2.LookupRegistry(sys, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error loading registries configuration")
+	}
+	return registry, nil
+}
+
+// pullSources returns the locations to try, in order, when pulling ref: the configured mirrors, if any,
+// followed by the registry itself.
+// If the registry of ref is blocked, BlockedRegistryError is returned.
+func pullSources(sys *types.SystemContext, ref reference.Named) ([]sysregistriesv2.PullSource, error) {
+	registry, err := registriesConfEntry(sys, ref.Name())
+	if err != nil {
+		return nil, err
+	}
+	if registry != nil && registry.Blocked {
+		return nil, BlockedRegistryError{Registry: registry.URL}
+	}
+	if registry == nil {
+		registry = &sysregistriesv2.Registry{URL: ref.Name(), Prefix: ref.Name()}
+	}
+	sources, err := registry.PullSourcesFromReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	if sys == nil || sys.DockerRegistryMirrors == nil {
+		return sources, nil
+	}
+
+	// sys.DockerRegistryMirrors replaces the mirrors from registries.conf, but not the registry location.
+	upstream := sources[len(sources)-1]
+	mirrors := sysregistriesv2.Registry{}
+	for prefix, locations := range sys.DockerRegistryMirrors {
+		if refMatchesPrefix(ref.Name(), prefix) && len(prefix) > len(mirrors.Prefix) {
+			mirrors.URL = prefix
+			mirrors.Prefix = prefix
+			mirrors.Mirrors = []sysregistriesv2.Mirror{}
+			for _, location := range locations {
+				mirrors.Mirrors = append(mirrors.Mirrors, sysregistriesv2.Mirror{URL: location})
+			}
+		}
+	}
+	if mirrors.Prefix == "" {
+		return []sysregistriesv2.PullSource{upstream}, nil
+	}
+	sources, err = mirrors.PullSourcesFromReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	return append(sources[:len(sources)-1], upstream), nil
+}
+
+// refMatchesPrefix returns true if name, a repository name, is prefix or within the namespace prefix.
+func refMatchesPrefix(name, prefix string) bool {
+	return name == prefix || strings.HasPrefix(name, prefix+"/")
+}
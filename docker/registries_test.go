@@ -0,0 +1,250 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registriesConfFixture writes contents to a registries.conf in a new temporary directory, and returns its path.
+func registriesConfFixture(t *testing.T, contents string) (string, func()) {
+	tmpDir, err := ioutil.TempDir("", "registries-conf")
+	require.NoError(t, err)
+	path := filepath.Join(tmpDir, "registries.conf")
+	err = ioutil.WriteFile(path, []byte(contents), 0600)
+	require.NoError(t, err)
+	return path, func() { os.RemoveAll(tmpDir) }
+}
+
+func TestPullSources(t *testing.T) {
+	confPath, cleanup := registriesConfFixture(t, `
+[[registry]]
+url = "registry.example.com/upstream"
+prefix = "example.com/ns"
+
+[[registry.mirror]]
+url = "conf-mirror.example.com"
+`)
+	defer cleanup()
+	missingConfPath := filepath.Join(filepath.Dir(confPath), "this-does-not-exist")
+
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		input    string
+		expected []string
+	}{
+		// No configuration
+		{&types.SystemContext{SystemRegistriesConfPath: missingConfPath}, "example.com/ns/repo:tag", []string{"example.com/ns/repo:tag"}},
+		// registries.conf
+		{&types.SystemContext{SystemRegistriesConfPath: confPath}, "example.com/ns/repo:tag",
+			[]string{"conf-mirror.example.com/repo:tag", "registry.example.com/upstream/repo:tag"}},
+		{&types.SystemContext{SystemRegistriesConfPath: confPath}, "example.com/other/repo:tag", []string{"example.com/other/repo:tag"}},
+		// DockerRegistryMirrors replaces the mirrors from registries.conf
+		{
+			&types.SystemContext{SystemRegistriesConfPath: confPath, DockerRegistryMirrors: map[string][]string{
+				"example.com":         {"m1.example.com"},
+				"example.com/ns":      {"m2.example.com/ns", "m3.example.com"},
+				"example.com/ns/repo": {}, // Does not match example.com/ns/repo2
+			}},
+			"example.com/ns/repo2:tag",
+			[]string{"m2.example.com/ns/repo2:tag", "m3.example.com/repo2:tag", "registry.example.com/upstream/repo2:tag"},
+		},
+		{
+			&types.SystemContext{SystemRegistriesConfPath: confPath, DockerRegistryMirrors: map[string][]string{"example.com/ns/repo": {}}},
+			"example.com/ns/repo:tag",
+			[]string{"registry.example.com/upstream/repo:tag"},
+		},
+		{
+			&types.SystemContext{SystemRegistriesConfPath: missingConfPath, DockerRegistryMirrors: map[string][]string{"docker.io": {"mirror.example.com:5000"}}},
+			"busybox:latest",
+			[]string{"mirror.example.com:5000/library/busybox:latest", "docker.io/library/busybox:latest"},
+		},
+		{
+			&types.SystemContext{SystemRegistriesConfPath: missingConfPath, DockerRegistryMirrors: map[string][]string{}},
+			"example.com/ns/repo:tag",
+			[]string{"example.com/ns/repo:tag"},
+		},
+	} {
+		ref, err := reference.ParseNormalizedNamed(c.input)
+		require.NoError(t, err, c.input)
+		sources, err := pullSources(c.sys, ref)
+		require.NoError(t, err, c.input)
+		res := []string{}
+		for _, s := range sources {
+			res = append(res, s.Reference.String())
+		}
+		assert.Equal(t, c.expected, res, c.input)
+	}
+
+	// Blocked registries are rejected
+	blockedConfPath, cleanup3 := registriesConfFixture(t, `
+[[registry]]
+url = "blocked.example.com"
+blocked = true
+`)
+	defer cleanup3()
+	ref, err := reference.ParseNormalizedNamed("blocked.example.com/ns/repo:tag")
+	require.NoError(t, err)
+	_, err = pullSources(&types.SystemContext{SystemRegistriesConfPath: blockedConfPath}, ref)
+	assert.Equal(t, BlockedRegistryError{Registry: "blocked.example.com"}, err)
+
+	// An invalid registries.conf is an error
+	invalidConfPath, cleanup2 := registriesConfFixture(t, "this is not valid TOML")
+	defer cleanup2()
+	ref, err = reference.ParseNormalizedNamed("example.com/ns/repo:tag")
+	require.NoError(t, err)
+	_, err = pullSources(&types.SystemContext{SystemRegistriesConfPath: invalidConfPath}, ref)
+	assert.Error(t, err)
+
+	// An invalid registries.conf entry is only an error for references it applies to
+	invalidEntryConfPath, cleanup4 := registriesConfFixture(t, `
+[[registry]]
+url = "invalid.example.com"
+[[registry.mirror]]
+url = "https://mirror.example.com"
+`)
+	defer cleanup4()
+	sys := &types.SystemContext{SystemRegistriesConfPath: invalidEntryConfPath}
+	sources, err := pullSources(sys, ref)
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, "example.com/ns/repo:tag", sources[0].Reference.String())
+	ref, err = reference.ParseNormalizedNamed("invalid.example.com/ns/repo:tag")
+	require.NoError(t, err)
+	_, err = pullSources(sys, ref)
+	assert.Error(t, err)
+}
+
+func TestNewDockerClientFromRefRegistriesConf(t *testing.T) {
+	confPath, cleanup := registriesConfFixture(t, `
+[[registry]]
+url = "blocked.example.com"
+blocked = true
+
+[[registry]]
+url = "insecure.example.com"
+insecure = true
+
+[[registry]]
+url = "proxied.example.com"
+proxy = "http://registry-proxy.example.com:3128"
+`)
+	defer cleanup()
+	tmpDir := filepath.Dir(confPath)
+
+	for _, c := range []struct {
+		input            string
+		sysInsecure      bool
+		expectedInsecure bool
+	}{
+		{"insecure.example.com/ns/repo:tag", false, true},
+		{"secure.example.com/ns/repo:tag", false, false},
+		{"secure.example.com/ns/repo:tag", true, true},
+	} {
+		ref, err := ParseReference("//" + c.input)
+		require.NoError(t, err, c.input)
+		sys := &types.SystemContext{SystemRegistriesConfPath: confPath, RegistriesDirPath: tmpDir, DockerInsecureSkipTLSVerify: c.sysInsecure}
+		client, err := newDockerClientFromRef(sys, ref.(dockerReference), false, "pull")
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expectedInsecure, client.insecureSkipTLSVerify, c.input)
+		assert.Equal(t, c.expectedInsecure, client.tlsClientConfig.InsecureSkipVerify, c.input)
+	}
+
+	// A proxy in registries.conf takes precedence over the one in SystemContext, including NoProxy
+	sysProxy := &types.DockerProxyConfig{HTTPSProxy: "http://sys-proxy.example.com:3128", NoProxy: "proxied.example.com"}
+	for _, c := range []struct {
+		input, expected string
+	}{
+		{"proxied.example.com/ns/repo:tag", "http://registry-proxy.example.com:3128"},
+		{"other.example.com/ns/repo:tag", "http://sys-proxy.example.com:3128"},
+	} {
+		ref, err := ParseReference("//" + c.input)
+		require.NoError(t, err, c.input)
+		sys := &types.SystemContext{SystemRegistriesConfPath: confPath, RegistriesDirPath: tmpDir, DockerProxy: sysProxy}
+		client, err := newDockerClientFromRef(sys, ref.(dockerReference), false, "pull")
+		require.NoError(t, err, c.input)
+		req, err := http.NewRequest("GET", "https://"+reference.Domain(ref.DockerReference())+"/v2/", nil)
+		require.NoError(t, err)
+		proxy, err := client.proxy(req)
+		require.NoError(t, err, c.input)
+		require.NotNil(t, proxy, c.input)
+		assert.Equal(t, c.expected, proxy.String(), c.input)
+		// The transport uses the same configuration
+		tr, ok := client.client.Transport.(*http.Transport)
+		require.True(t, ok, c.input)
+		proxy, err = tr.Proxy(req)
+		require.NoError(t, err, c.input)
+		require.NotNil(t, proxy, c.input)
+		assert.Equal(t, c.expected, proxy.String(), c.input)
+	}
+
+	ref, err := ParseReference("//blocked.example.com/ns/repo:tag")
+	require.NoError(t, err)
+	_, err = newDockerClientFromRef(&types.SystemContext{SystemRegistriesConfPath: confPath, RegistriesDirPath: tmpDir}, ref.(dockerReference), true, "pull,push")
+	assert.Equal(t, BlockedRegistryError{Registry: "blocked.example.com"}, err)
+	assert.Equal(t, "registry blocked.example.com is blocked in the registries configuration", err.Error())
+	_, err = newImageSource(context.Background(), &types.SystemContext{SystemRegistriesConfPath: confPath, RegistriesDirPath: tmpDir}, ref.(dockerReference))
+	assert.Equal(t, BlockedRegistryError{Registry: "blocked.example.com"}, err)
+}
+
+func TestNewImageSourceInsecureMirror(t *testing.T) {
+	upstream := &manifestRegistryMock{}
+	upstreamServer := httptest.NewServer(upstream)
+	defer upstreamServer.Close()
+	mirror := &manifestRegistryMock{repos: map[string]bool{"ns/repo": true}}
+	mirrorServer := httptest.NewServer(mirror)
+	defer mirrorServer.Close()
+	// sysregistriesv2 does not accept IP addresses with a port.
+	upstreamHost := fmt.Sprintf("localhost:%d", upstreamServer.Listener.Addr().(*net.TCPAddr).Port)
+	mirrorHost := fmt.Sprintf("localhost:%d", mirrorServer.Listener.Addr().(*net.TCPAddr).Port)
+
+	// The mirror is only contacted over HTTP if it is configured as insecure.
+	for _, insecure := range []bool{false, true} {
+		confPath, cleanup := registriesConfFixture(t, fmt.Sprintf(`
+[[registry]]
+url = "%s"
+
+[[registry.mirror]]
+url = "%s"
+insecure = %v
+`, upstreamHost, mirrorHost, insecure))
+		defer cleanup()
+		sys := &types.SystemContext{SystemRegistriesConfPath: confPath, RegistriesDirPath: filepath.Dir(confPath)}
+		ref, err := ParseReference("//" + upstreamHost + "/ns/repo:tag")
+		require.NoError(t, err)
+		src, err := newImageSource(context.Background(), sys, ref.(dockerReference))
+		if insecure {
+			require.NoError(t, err)
+			assert.Equal(t, mirrorHost+"/ns/repo:tag", src.physicalRef.ref.String())
+		} else {
+			assert.Error(t, err)
+		}
+	}
+}
+
+func TestRefMatchesPrefix(t *testing.T) {
+	for _, c := range []struct {
+		name, prefix string
+		expected     bool
+	}{
+		{"example.com/ns/repo", "example.com", true},
+		{"example.com/ns/repo", "example.com/ns", true},
+		{"example.com/ns/repo", "example.com/ns/repo", true},
+		{"example.com/ns/repo", "example.com/n", false},
+		{"example.com/ns/repo", "example.co", false},
+		{"example.com/ns/repo", "example.com/ns/repo/sub", false},
+	} {
+		assert.Equal(t, c.expected, refMatchesPrefix(c.name, c.prefix), "%s %s", c.name, c.prefix)
+	}
+}
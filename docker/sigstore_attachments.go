@@ -0,0 +1,341 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/internal/iolimits"
+	internalsig "github.com/containers/image/internal/signature"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Sigstore signatures can be stored in the registry itself, “attached” to the signed image:
+// all signatures of an image are layers of a single OCI manifest, stored using the tag returned by sigstoreAttachmentTag
+// (the scheme used by cosign).  The manifest also refers to the signed image as its subject, so registries which
+// implement the OCI referrers API make it discoverable that way as well.
+// NOTE: Keep this in sync with docs/signature-protocols.md!
+
+const (
+	// sigstoreSignatureArtifactType is the artifact type of manifests containing sigstore signatures.
+	sigstoreSignatureArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	// sigstoreSignatureMIMEType is the media type of layers containing sigstore signature payloads.
+	sigstoreSignatureMIMEType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	referrersPath = "/v2/%s/referrers/%s"
+)
+
+// attachmentManifest is an OCI image manifest containing signatures attached to an image, e.g. sigstore or Notation signatures.
+// It includes the artifactType and subject fields of newer versions of the OCI image specification.
+type attachmentManifest struct {
+	SchemaVersion int                    `json:"schemaVersion"`
+	MediaType     string                 `json:"mediaType"`
+	ArtifactType  string                 `json:"artifactType,omitempty"`
+	Config        imgspecv1.Descriptor   `json:"config"`
+	Layers        []imgspecv1.Descriptor `json:"layers"`
+	Subject       *imgspecv1.Descriptor  `json:"subject,omitempty"`
+}
+
+// sigstoreAttachmentConfig is the image configuration of an attachmentManifest containing sigstore signatures.
+// It exists only to make the manifest a valid image, for registries which accept nothing else.
+type sigstoreAttachmentConfig struct {
+	Architecture string           `json:"architecture"`
+	OS           string           `json:"os"`
+	Config       struct{}         `json:"config"`
+	RootFS       imgspecv1.RootFS `json:"rootfs"`
+}
+
+// referrersIndex is the subset of a response of the OCI referrers API (or of the referrers tag schema) we use.
+type referrersIndex struct {
+	Manifests []struct {
+		Digest       digest.Digest `json:"digest"`
+		ArtifactType string        `json:"artifactType"`
+	} `json:"manifests"`
+}
+
+// sigstoreAttachmentTag returns the tag used for the sigstore signatures of manifestDigest.
+func sigstoreAttachmentTag(manifestDigest digest.Digest) (string, error) {
+	if err := manifestDigest.Validate(); err != nil { // Make sure manifestDigest.String() does not contain any unexpected characters
+		return "", err
+	}
+	return strings.Replace(manifestDigest.String(), ":", "-", 1) + ".sig", nil
+}
+
+// getSigstoreAttachments returns the sigstore signatures of manifestDigest stored in ref, serialized as sigstore signature blobs.
+// Signatures are found using the OCI referrers API, if the registry supports it, and using sigstoreAttachmentTag.
+func (c *dockerClient) getSigstoreAttachments(ctx context.Context, ref dockerReference, manifestDigest digest.Digest) ([][]byte, error) {
+	manifestDigests, err := c.getReferrers(ctx, ref, manifestDigest, sigstoreSignatureArtifactType)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := sigstoreAttachmentTag(manifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	manifests := []*attachmentManifest{}
+	tagged, taggedDigest, err := c.getAttachmentManifest(ctx, ref, tag)
+	if err != nil {
+		return nil, err
+	}
+	if tagged != nil {
+		manifests = append(manifests, tagged)
+	}
+	for _, d := range manifestDigests {
+		if d == taggedDigest {
+			continue
+		}
+		m, _, err := c.getAttachmentManifest(ctx, ref, d.String())
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			manifests = append(manifests, m)
+		}
+	}
+
+	// Older versions of the tagged manifest remain in the registry, and are still returned by the referrers API;
+	// so, return every signature only once.
+	signatures := [][]byte{}
+	seen := map[string]struct{}{}
+	for _, m := range manifests {
+		for _, layer := range m.Layers {
+			if layer.MediaType != sigstoreSignatureMIMEType {
+				logrus.Debugf("Ignoring a sigstore attachment layer with media type %s", layer.MediaType)
+				continue
+			}
+			payload, err := c.getAttachmentBlob(ctx, ref, layer)
+			if err != nil {
+				return nil, err
+			}
+			sig, err := internalsig.Sigstore{
+				MIMEType:    layer.MediaType,
+				Payload:     payload,
+				Annotations: layer.Annotations,
+			}.Blob()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := seen[string(sig)]; ok {
+				continue
+			}
+			seen[string(sig)] = struct{}{}
+			signatures = append(signatures, sig)
+		}
+	}
+	return signatures, nil
+}
+
+// getReferrers returns the digests of manifests with artifactType which refer to manifestDigest in ref,
+// using the OCI referrers API, or the referrers tag schema if the registry does not support the API.
+func (c *dockerClient) getReferrers(ctx context.Context, ref dockerReference, manifestDigest digest.Digest, artifactType string) ([]digest.Digest, error) {
+	path := fmt.Sprintf(referrersPath, reference.Path(ref.ref), manifestDigest.String()) + "?artifactType=" + url.QueryEscape(artifactType)
+	res, err := c.makeRequest(ctx, "GET", path, nil, nil, v2Auth)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusBadRequest:
+		logrus.Debugf("Referrers API not supported by %s, status %d", c.registry, res.StatusCode)
+		return c.getReferrersFromTag(ctx, ref, manifestDigest, artifactType)
+	default:
+		return nil, errors.Wrapf(registryHTTPResponseToError(res), "Error listing referrers of %s in %s", manifestDigest, ref.ref.Name())
+	}
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
+	if err != nil {
+		return nil, err
+	}
+	return referrersWithArtifactType(body, manifestDigest, artifactType)
+}
+
+// getReferrersFromTag returns the digests of manifests with artifactType which refer to manifestDigest in ref,
+// as recorded in an image index using the referrers tag schema of the OCI distribution specification.
+func (c *dockerClient) getReferrersFromTag(ctx context.Context, ref dockerReference, manifestDigest digest.Digest, artifactType string) ([]digest.Digest, error) {
+	if err := manifestDigest.Validate(); err != nil { // Make sure manifestDigest.String() does not contain any unexpected characters
+		return nil, err
+	}
+	tag := strings.Replace(manifestDigest.String(), ":", "-", 1)
+	path := fmt.Sprintf(manifestPath, reference.Path(ref.ref), tag)
+	headers := map[string][]string{"Accept": {imgspecv1.MediaTypeImageIndex}}
+	res, err := c.makeRequest(ctx, "GET", path, headers, nil, v2Auth)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrapf(registryHTTPResponseToError(res), "Error reading referrers of %s in %s", manifestDigest, ref.ref.Name())
+	}
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
+	if err != nil {
+		return nil, err
+	}
+	return referrersWithArtifactType(body, manifestDigest, artifactType)
+}
+
+// referrersWithArtifactType returns the digests of manifests with artifactType in a referrersIndex of manifestDigest.
+func referrersWithArtifactType(indexBlob []byte, manifestDigest digest.Digest, artifactType string) ([]digest.Digest, error) {
+	var index referrersIndex
+	if err := json.Unmarshal(indexBlob, &index); err != nil {
+		return nil, errors.Wrapf(err, "Error parsing referrers of %s", manifestDigest)
+	}
+	digests := []digest.Digest{}
+	for _, m := range index.Manifests {
+		// Registries are not required to support filtering by artifactType.
+		if m.ArtifactType == artifactType {
+			digests = append(digests, m.Digest)
+		}
+	}
+	return digests, nil
+}
+
+// getAttachmentManifest returns the attachment manifest at tagOrDigest in ref, and its digest, or nil if it does not exist.
+func (c *dockerClient) getAttachmentManifest(ctx context.Context, ref dockerReference, tagOrDigest string) (*attachmentManifest, digest.Digest, error) {
+	path := fmt.Sprintf(manifestPath, reference.Path(ref.ref), tagOrDigest)
+	headers := map[string][]string{"Accept": {imgspecv1.MediaTypeImageManifest}}
+	res, err := c.makeRequest(ctx, "GET", path, headers, nil, v2Auth)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, "", nil
+	default:
+		return nil, "", errors.Wrapf(registryHTTPResponseToError(res), "Error reading signatures %s in %s", tagOrDigest, ref.ref.Name())
+	}
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
+	if err != nil {
+		return nil, "", err
+	}
+	var m attachmentManifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, "", errors.Wrapf(err, "Error parsing signatures %s in %s", tagOrDigest, ref.ref.Name())
+	}
+	return &m, digest.FromBytes(body), nil
+}
+
+// getAttachmentBlob returns the contents of layer of an attachmentManifest in ref.
+func (c *dockerClient) getAttachmentBlob(ctx context.Context, ref dockerReference, layer imgspecv1.Descriptor) ([]byte, error) {
+	if err := layer.Digest.Validate(); err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf(blobsPath, reference.Path(ref.ref), layer.Digest.String())
+	res, err := c.makeRequest(ctx, "GET", path, nil, nil, v2Auth)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(registryHTTPResponseToError(res), "Error reading signature %s in %s", layer.Digest, ref.ref.Name())
+	}
+	payload, err := iolimits.ReadAtMost(res.Body, iolimits.MaxSignatureBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if actual := layer.Digest.Algorithm().FromBytes(payload); actual != layer.Digest {
+		return nil, errors.Errorf("Signature %s in %s has unexpected digest %s", layer.Digest, ref.ref.Name(), actual)
+	}
+	return payload, nil
+}
+
+// putSigstoreAttachments adds signatures, serialized sigstore signature blobs, to the sigstore signatures
+// attached to subject, a manifest already written to the destination.
+func (d *dockerImageDestination) putSigstoreAttachments(ctx context.Context, signatures [][]byte, subject imgspecv1.Descriptor) error {
+	if len(signatures) == 0 {
+		return nil
+	}
+	tag, err := sigstoreAttachmentTag(subject.Digest)
+	if err != nil {
+		return err
+	}
+
+	m, _, err := d.c.getAttachmentManifest(ctx, d.ref, tag)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = &attachmentManifest{Layers: []imgspecv1.Descriptor{}}
+	}
+	modified := false
+	for _, blob := range signatures {
+		sig, err := internalsig.SigstoreFromBlob(blob)
+		if err != nil {
+			return err
+		}
+		layer := imgspecv1.Descriptor{
+			MediaType:   sig.MIMEType,
+			Digest:      digest.FromBytes(sig.Payload),
+			Size:        int64(len(sig.Payload)),
+			Annotations: sig.Annotations,
+		}
+		if sigstoreAttachmentLayersContain(m.Layers, layer) {
+			continue
+		}
+		if _, err := d.PutBlob(ctx, bytes.NewReader(sig.Payload), types.BlobInfo{Digest: layer.Digest, Size: layer.Size}, false); err != nil {
+			return err
+		}
+		m.Layers = append(m.Layers, layer)
+		modified = true
+	}
+	if !modified {
+		return nil
+	}
+
+	config := sigstoreAttachmentConfig{RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{}}}
+	for _, layer := range m.Layers {
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, layer.Digest)
+	}
+	configBlob, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	configInfo, err := d.PutBlob(ctx, bytes.NewReader(configBlob), types.BlobInfo{Digest: digest.FromBytes(configBlob), Size: int64(len(configBlob))}, true)
+	if err != nil {
+		return err
+	}
+	m.SchemaVersion = 2
+	m.MediaType = imgspecv1.MediaTypeImageManifest
+	m.ArtifactType = sigstoreSignatureArtifactType
+	m.Config = imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configInfo.Digest, Size: configInfo.Size}
+	m.Subject = &subject
+	manifestBlob, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return d.uploadManifest(ctx, manifestBlob, imgspecv1.MediaTypeImageManifest, tag)
+}
+
+// sigstoreAttachmentLayersContain returns true if layers already contain a signature equal to layer.
+func sigstoreAttachmentLayersContain(layers []imgspecv1.Descriptor, layer imgspecv1.Descriptor) bool {
+	for _, l := range layers {
+		if l.MediaType != layer.MediaType || l.Digest != layer.Digest || len(l.Annotations) != len(layer.Annotations) {
+			continue
+		}
+		equal := true
+		for k, v := range layer.Annotations {
+			if lv, ok := l.Annotations[k]; !ok || lv != v {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	internalsig "github.com/containers/image/internal/signature"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attachmentRegistryMock is a registry which stores blobs and manifests of ns/repo, and optionally implements the referrers API.
+type attachmentRegistryMock struct {
+	mutex     sync.Mutex
+	t         *testing.T
+	referrers bool
+	uploads   map[string][]byte
+	blobs     map[digest.Digest][]byte
+	manifests map[string][]byte // Tag or digest → manifest
+}
+
+func newAttachmentRegistryMock(t *testing.T, referrers bool) *attachmentRegistryMock {
+	return &attachmentRegistryMock{
+		t:         t,
+		referrers: referrers,
+		uploads:   map[string][]byte{},
+		blobs:     map[digest.Digest][]byte{},
+		manifests: map[string][]byte{},
+	}
+}
+
+func (m *attachmentRegistryMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	const blobsPrefix, manifestsPrefix, referrersPrefix = "/v2/ns/repo/blobs/", "/v2/ns/repo/manifests/", "/v2/ns/repo/referrers/"
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/v2/ns/repo/blobs/uploads/":
+		location := fmt.Sprintf("/upload/%d", len(m.uploads))
+		m.uploads[location] = []byte{}
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "PATCH" && strings.HasPrefix(r.URL.Path, "/upload/"):
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(m.t, err)
+		m.uploads[r.URL.Path] = append(m.uploads[r.URL.Path], body...)
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/upload/"):
+		data := m.uploads[r.URL.Path]
+		if d := digest.Digest(r.URL.Query().Get("digest")); d != digest.FromBytes(data) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.blobs[digest.FromBytes(data)] = data
+		w.WriteHeader(http.StatusCreated)
+	case (r.Method == "HEAD" || r.Method == "GET") && strings.HasPrefix(r.URL.Path, blobsPrefix):
+		data, ok := m.blobs[digest.Digest(strings.TrimPrefix(r.URL.Path, blobsPrefix))]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == "GET" {
+			w.Write(data)
+		}
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, manifestsPrefix):
+		man, ok := m.manifests[strings.TrimPrefix(r.URL.Path, manifestsPrefix)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+		w.Write(man)
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, manifestsPrefix):
+		man, err := ioutil.ReadAll(r.Body)
+		require.NoError(m.t, err)
+		m.manifests[strings.TrimPrefix(r.URL.Path, manifestsPrefix)] = man
+		m.manifests[digest.FromBytes(man).String()] = man
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "GET" && m.referrers && strings.HasPrefix(r.URL.Path, referrersPrefix):
+		artifactType := r.URL.Query().Get("artifactType")
+		subject := strings.TrimPrefix(r.URL.Path, referrersPrefix)
+		type referrer struct {
+			imgspecv1.Descriptor
+			ArtifactType string `json:"artifactType"`
+		}
+		referrers := []referrer{}
+		for key, man := range m.manifests {
+			var parsed attachmentManifest
+			if json.Unmarshal(man, &parsed) == nil && parsed.Subject != nil && parsed.Subject.Digest.String() == subject && key == digest.FromBytes(man).String() &&
+				(artifactType == "" || parsed.ArtifactType == artifactType) {
+				referrers = append(referrers, referrer{
+					Descriptor:   imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: digest.FromBytes(man), Size: int64(len(man))},
+					ArtifactType: parsed.ArtifactType,
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"schemaVersion": 2, "manifests": referrers})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// sigstoreTestSignature returns a serialized sigstore signature containing payload.
+func sigstoreTestSignature(t *testing.T, payload string) []byte {
+	sig, err := internalsig.Sigstore{
+		MIMEType:    sigstoreSignatureMIMEType,
+		Payload:     []byte(payload),
+		Annotations: map[string]string{"dev.cosignproject.cosign/signature": "signature of " + payload},
+	}.Blob()
+	require.NoError(t, err)
+	return sig
+}
+
+func TestSigstoreAttachmentTag(t *testing.T) {
+	tag, err := sigstoreAttachmentTag(digest.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	assert.Equal(t, "sha256-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.sig", tag)
+
+	_, err = sigstoreAttachmentTag(digest.Digest("sha256:../../../evil"))
+	assert.Error(t, err)
+}
+
+func TestSigstoreAttachments(t *testing.T) {
+	for _, referrers := range []bool{false, true} {
+		registry := newAttachmentRegistryMock(t, referrers)
+		server := httptest.NewServer(registry)
+
+		dest := uploadTestDestination(t, server, &types.SystemContext{})
+		dest.c.useSigstoreAttachments = true
+		imageManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`)
+		imageDigest := digest.FromBytes(imageManifest)
+		err := dest.PutManifest(context.Background(), imageManifest)
+		require.NoError(t, err)
+
+		sig1, sig2, sig3 := sigstoreTestSignature(t, "payload1"), sigstoreTestSignature(t, "payload2"), sigstoreTestSignature(t, "payload3")
+		err = dest.PutSignatures(context.Background(), [][]byte{sig1, sig2})
+		require.NoError(t, err)
+		// Existing signatures are kept, and not duplicated
+		err = dest.PutSignatures(context.Background(), [][]byte{sig2, sig3})
+		require.NoError(t, err)
+
+		tag, err := sigstoreAttachmentTag(imageDigest)
+		require.NoError(t, err)
+		var m attachmentManifest
+		err = json.Unmarshal(registry.manifests[tag], &m)
+		require.NoError(t, err)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, m.MediaType)
+		assert.Equal(t, sigstoreSignatureArtifactType, m.ArtifactType)
+		assert.Equal(t, &imgspecv1.Descriptor{MediaType: "application/vnd.docker.distribution.manifest.v2+json", Digest: imageDigest, Size: int64(len(imageManifest))}, m.Subject)
+		require.Len(t, m.Layers, 3)
+		assert.Contains(t, registry.blobs, m.Config.Digest)
+		for i, payload := range []string{"payload1", "payload2", "payload3"} {
+			assert.Equal(t, digest.FromString(payload), m.Layers[i].Digest)
+			assert.Equal(t, []byte(payload), registry.blobs[m.Layers[i].Digest])
+		}
+
+		src := &dockerImageSource{ref: dest.ref, physicalRef: dest.ref, c: dest.c}
+		sigs, err := src.GetSignatures(context.Background(), &imageDigest)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{sig1, sig2, sig3}, sigs)
+
+		// A signature manifest which is not tagged is only found using the referrers API
+		sig4 := sigstoreTestSignature(t, "payload4")
+		registry.blobs[digest.FromString("payload4")] = []byte("payload4")
+		untagged, err := json.Marshal(attachmentManifest{
+			SchemaVersion: 2,
+			MediaType:     imgspecv1.MediaTypeImageManifest,
+			ArtifactType:  sigstoreSignatureArtifactType,
+			Config:        m.Config,
+			Layers: []imgspecv1.Descriptor{{
+				MediaType:   sigstoreSignatureMIMEType,
+				Digest:      digest.FromString("payload4"),
+				Size:        int64(len("payload4")),
+				Annotations: map[string]string{"dev.cosignproject.cosign/signature": "signature of payload4"},
+			}},
+			Subject: m.Subject,
+		})
+		require.NoError(t, err)
+		registry.manifests[digest.FromBytes(untagged).String()] = untagged
+		sigs, err = src.GetSignatures(context.Background(), &imageDigest)
+		require.NoError(t, err)
+		if referrers {
+			assert.Equal(t, [][]byte{sig1, sig2, sig3, sig4}, sigs)
+		} else {
+			assert.Equal(t, [][]byte{sig1, sig2, sig3}, sigs)
+		}
+
+		// No signatures
+		otherDigest := digest.FromString("other")
+		sigs, err = src.GetSignatures(context.Background(), &otherDigest)
+		require.NoError(t, err)
+		assert.Empty(t, sigs)
+
+		// Simple signing signatures can not be stored in the registry
+		err = dest.PutSignatures(context.Background(), [][]byte{[]byte("simple signing signature")})
+		assert.Error(t, err)
+
+		server.Close()
+	}
+}
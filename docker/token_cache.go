@@ -0,0 +1,164 @@
+package docker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// bearerTokenCacheKey identifies a bearer token in bearerTokenCache.
+type bearerTokenCacheKey struct {
+	realm    string
+	service  string
+	scope    string
+	username string
+	// A digest of the password and identity token, so that tokens are never shared between different credentials,
+	// without keeping the secrets in the cache; see secretsDigest.
+	secretsDigest digest.Digest
+}
+
+// secretsDigestKey is a random key, different in every process, used by secretsDigest.
+var secretsDigestKey = func() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic("Error generating a random key: " + err.Error())
+	}
+	return key
+}()
+
+// secretsDigest returns a digest identifying password and identityToken within this process.
+// It is a HMAC using secretsDigestKey, not a plain hash, so that the secrets can not be recovered
+// from the digest by guessing likely values.
+func secretsDigest(password, identityToken string) digest.Digest {
+	mac := hmac.New(sha256.New, secretsDigestKey)
+	mac.Write([]byte(password + "\x00" + identityToken))
+	return digest.NewDigest(digest.SHA256, mac)
+}
+
+// cachedBearerToken is a bearer token in bearerTokenCache.
+type cachedBearerToken struct {
+	token      *bearerToken
+	expiration time.Time
+}
+
+// bearerTokenRequest is a request for a bearer token in progress, in bearerTokenCache.
+type bearerTokenRequest struct {
+	done  chan struct{} // Closed when token and err are set
+	token *bearerToken
+	err   error
+}
+
+// bearerTokenCache contains bearer tokens obtained by all dockerClient instances, so that each token
+// is reused until it expires, instead of re-authenticating for every image source or destination.
+var bearerTokenCache = struct {
+	mutex    sync.Mutex
+	tokens   map[bearerTokenCacheKey]cachedBearerToken
+	requests map[bearerTokenCacheKey]*bearerTokenRequest // Requests in progress; see getBearerTokenWithCache.
+}{
+	tokens:   map[bearerTokenCacheKey]cachedBearerToken{},
+	requests: map[bearerTokenCacheKey]*bearerTokenRequest{},
+}
+
+// newBearerTokenCacheKey returns a bearerTokenCacheKey for a token obtained from realm for service and scope,
+// using username and password, or identityToken.
+func newBearerTokenCacheKey(realm, service, scope, username, password, identityToken string) bearerTokenCacheKey {
+	return bearerTokenCacheKey{
+		realm:         realm,
+		service:       service,
+		scope:         scope,
+		username:      username,
+		secretsDigest: secretsDigest(password, identityToken),
+	}
+}
+
+// getCachedBearerToken returns a token for key which has not expired at now, if any.
+func getCachedBearerToken(key bearerTokenCacheKey, now time.Time) (*bearerToken, bool) {
+	bearerTokenCache.mutex.Lock()
+	defer bearerTokenCache.mutex.Unlock()
+	return getCachedBearerTokenLocked(key, now)
+}
+
+// getCachedBearerTokenLocked is getCachedBearerToken, with bearerTokenCache.mutex already held by the caller.
+func getCachedBearerTokenLocked(key bearerTokenCacheKey, now time.Time) (*bearerToken, bool) {
+	cached, ok := bearerTokenCache.tokens[key]
+	if !ok || now.After(cached.expiration) {
+		return nil, false
+	}
+	return cached.token, true
+}
+
+// cacheBearerToken records token for key, and drops expired tokens as of now.
+func cacheBearerToken(key bearerTokenCacheKey, token *bearerToken, now time.Time) {
+	bearerTokenCache.mutex.Lock()
+	defer bearerTokenCache.mutex.Unlock()
+	cacheBearerTokenLocked(key, token, now)
+}
+
+// cacheBearerTokenLocked is cacheBearerToken, with bearerTokenCache.mutex already held by the caller.
+func cacheBearerTokenLocked(key bearerTokenCacheKey, token *bearerToken, now time.Time) {
+	for k, cached := range bearerTokenCache.tokens {
+		if now.After(cached.expiration) {
+			delete(bearerTokenCache.tokens, k)
+		}
+	}
+	bearerTokenCache.tokens[key] = cachedBearerToken{
+		token:      token,
+		expiration: token.IssuedAt.Add(time.Duration(token.ExpiresIn) * time.Second),
+	}
+}
+
+// dropCachedBearerToken removes token from the cache, e.g. after it was rejected by the registry.
+func dropCachedBearerToken(token *bearerToken) {
+	bearerTokenCache.mutex.Lock()
+	defer bearerTokenCache.mutex.Unlock()
+	for k, cached := range bearerTokenCache.tokens {
+		if cached.token == token {
+			delete(bearerTokenCache.tokens, k)
+		}
+	}
+}
+
+// getBearerTokenWithCache returns a token for key which has not expired, either from the cache, or obtained using fetch.
+// If a token for key is already being obtained, e.g. by dockerClient.prefetchAnonymousBearerToken or by a concurrent
+// request of another goroutine, this waits for that request instead of calling fetch.
+func getBearerTokenWithCache(ctx context.Context, key bearerTokenCacheKey, fetch func() (*bearerToken, error)) (*bearerToken, error) {
+	for {
+		bearerTokenCache.mutex.Lock()
+		if token, ok := getCachedBearerTokenLocked(key, time.Now()); ok {
+			bearerTokenCache.mutex.Unlock()
+			return token, nil
+		}
+		req, ok := bearerTokenCache.requests[key]
+		if !ok {
+			req = &bearerTokenRequest{done: make(chan struct{})}
+			bearerTokenCache.requests[key] = req
+			bearerTokenCache.mutex.Unlock()
+
+			req.token, req.err = fetch()
+			bearerTokenCache.mutex.Lock()
+			delete(bearerTokenCache.requests, key)
+			if req.err == nil {
+				cacheBearerTokenLocked(key, req.token, time.Now())
+			}
+			bearerTokenCache.mutex.Unlock()
+			close(req.done)
+			return req.token, req.err
+		}
+		bearerTokenCache.mutex.Unlock()
+
+		select {
+		case <-req.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if req.err == nil {
+			return req.token, nil
+		}
+		// The other request may have failed only because its context was canceled; try again ourselves.
+	}
+}
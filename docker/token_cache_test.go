@@ -0,0 +1,207 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerTokenCache(t *testing.T) {
+	now := time.Now()
+	key := newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/repo:pull", "user", "password", "")
+	token := &bearerToken{Token: "token1", ExpiresIn: 60, IssuedAt: now}
+
+	_, ok := getCachedBearerToken(key, now)
+	assert.False(t, ok)
+	cacheBearerToken(key, token, now)
+	res, ok := getCachedBearerToken(key, now.Add(59*time.Second))
+	require.True(t, ok)
+	assert.Equal(t, token, res)
+	// Expired tokens are not used
+	_, ok = getCachedBearerToken(key, now.Add(61*time.Second))
+	assert.False(t, ok)
+
+	// Tokens are not shared between different scopes or credentials
+	for _, other := range []bearerTokenCacheKey{
+		newBearerTokenCacheKey("https://auth.example.com/other", "registry.example.com", "repository:ns/repo:pull", "user", "password", ""),
+		newBearerTokenCacheKey("https://auth.example.com/token", "other.example.com", "repository:ns/repo:pull", "user", "password", ""),
+		newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/repo:pull,push", "user", "password", ""),
+		newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/repo:pull", "other", "password", ""),
+		newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/repo:pull", "user", "other", ""),
+	} {
+		_, ok := getCachedBearerToken(other, now)
+		assert.False(t, ok, "%#v", other)
+	}
+	_, ok = getCachedBearerToken(newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/repo:pull", "user", "password", "identity"), now)
+	assert.False(t, ok)
+	assert.NotEqual(t, "password", string(key.secretsDigest))
+	assert.NotEqual(t, digest.FromString("password\x00"), key.secretsDigest)
+	assert.Equal(t, key, newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/repo:pull", "user", "password", ""))
+
+	// Dropped tokens are not used
+	cacheBearerToken(key, token, now)
+	dropCachedBearerToken(token)
+	_, ok = getCachedBearerToken(key, now)
+	assert.False(t, ok)
+
+	// Expired tokens are dropped when caching new ones
+	otherKey := newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/other:pull", "user", "password", "")
+	cacheBearerToken(otherKey, &bearerToken{Token: "token2", ExpiresIn: 60, IssuedAt: now}, now.Add(120*time.Second))
+	bearerTokenCache.mutex.Lock()
+	_, ok = bearerTokenCache.tokens[key]
+	bearerTokenCache.mutex.Unlock()
+	assert.False(t, ok)
+}
+
+func TestGetBearerTokenWithCache(t *testing.T) {
+	key := newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/repo:pull", t.Name(), "", "")
+
+	// Concurrent callers share a single request
+	var mutex sync.Mutex
+	fetches := 0
+	release := make(chan struct{})
+	fetch := func() (*bearerToken, error) {
+		mutex.Lock()
+		fetches++
+		mutex.Unlock()
+		<-release
+		return &bearerToken{Token: "token1", ExpiresIn: 60, IssuedAt: time.Now()}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := getBearerTokenWithCache(context.Background(), key, fetch)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "token1", token.Token)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 1, fetches)
+	// … and the token is cached afterwards
+	token, err := getBearerTokenWithCache(context.Background(), key, func() (*bearerToken, error) {
+		return nil, errors.New("Unexpected token request")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "token1", token.Token)
+
+	// Failures are not cached, and callers waiting for a failed request try again
+	key = newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/other:pull", t.Name(), "", "")
+	started := make(chan struct{})
+	fail := make(chan struct{})
+	failed := make(chan error)
+	go func() {
+		_, err := getBearerTokenWithCache(context.Background(), key, func() (*bearerToken, error) {
+			close(started)
+			<-fail
+			return nil, errors.New("token request failed")
+		})
+		failed <- err
+	}()
+	<-started
+	waiterDone := make(chan *bearerToken)
+	go func() {
+		token, err := getBearerTokenWithCache(context.Background(), key, func() (*bearerToken, error) {
+			return &bearerToken{Token: "token2", ExpiresIn: 60, IssuedAt: time.Now()}, nil
+		})
+		assert.NoError(t, err)
+		waiterDone <- token
+	}()
+	close(fail)
+	assert.Error(t, <-failed)
+	token = <-waiterDone
+	require.NotNil(t, token)
+	assert.Equal(t, "token2", token.Token)
+
+	// Waiting is aborted when the context is canceled
+	key = newBearerTokenCacheKey("https://auth.example.com/token", "registry.example.com", "repository:ns/canceled:pull", t.Name(), "", "")
+	started = make(chan struct{})
+	block := make(chan struct{})
+	defer close(block)
+	go func() {
+		_, _ = getBearerTokenWithCache(context.Background(), key, func() (*bearerToken, error) {
+			close(started)
+			<-block
+			return nil, errors.New("token request failed")
+		})
+	}()
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = getBearerTokenWithCache(ctx, key, func() (*bearerToken, error) {
+		return nil, errors.New("Unexpected token request")
+	})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestDockerClientBearerTokenReuse(t *testing.T) {
+	tokenRequests := 0
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		fmt.Fprintf(w, `{"token":"token%d","expires_in":3600}`, tokenRequests)
+	}))
+	defer authServer.Close()
+	var authorizations []string
+	rejectedToken := ""
+	registryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer "+rejectedToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer registryServer.Close()
+
+	newClient := func(remoteName, username string) *dockerClient {
+		return &dockerClient{
+			registry: registryServer.Listener.Addr().String(),
+			username: username,
+			password: "password",
+			client:   registryServer.Client(),
+			scope:    authScope{remoteName: remoteName, actions: "pull"},
+			scheme:   "http",
+			challenges: []challenge{{
+				Scheme:     "bearer",
+				Parameters: map[string]string{"realm": authServer.URL + "/token", "service": t.Name()},
+			}},
+		}
+	}
+	request := func(c *dockerClient) {
+		res, err := c.makeRequest(context.Background(), "GET", "/v2/", nil, nil, v2Auth)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	// A token is reused by further requests, and by other clients for the same scope and credentials
+	c1 := newClient("ns/repo", "user")
+	request(c1)
+	request(c1)
+	request(newClient("ns/repo", "user"))
+	assert.Equal(t, 1, tokenRequests)
+	// … but not for different scopes or credentials
+	request(newClient("ns/other", "user"))
+	request(newClient("ns/repo", "other"))
+	assert.Equal(t, 3, tokenRequests)
+	assert.Equal(t, []string{"Bearer token1", "Bearer token1", "Bearer token1", "Bearer token2", "Bearer token3"}, authorizations)
+
+	// A token rejected by the registry is not used again
+	rejectedToken = "token1"
+	authorizations = nil
+	request(c1)
+	request(c1)
+	assert.Equal(t, 4, tokenRequests)
+	assert.Equal(t, []string{"Bearer token1", "Bearer token4"}, authorizations)
+}
@@ -2,9 +2,7 @@ package image
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"runtime"
 
 	"github.com/containers/image/manifest"
 	"github.com/containers/image/types"
@@ -12,53 +10,18 @@ import (
 	"github.com/pkg/errors"
 )
 
-type platformSpec struct {
-	Architecture string   `json:"architecture"`
-	OS           string   `json:"os"`
-	OSVersion    string   `json:"os.version,omitempty"`
-	OSFeatures   []string `json:"os.features,omitempty"`
-	Variant      string   `json:"variant,omitempty"`
-	Features     []string `json:"features,omitempty"` // removed in OCI
-}
-
-// A manifestDescriptor references a platform-specific manifest.
-type manifestDescriptor struct {
-	manifest.Schema2Descriptor
-	Platform platformSpec `json:"platform"`
-}
-
-type manifestList struct {
-	SchemaVersion int                  `json:"schemaVersion"`
-	MediaType     string               `json:"mediaType"`
-	Manifests     []manifestDescriptor `json:"manifests"`
-}
-
-// chooseDigestFromManifestList parses blob as a schema2 manifest list,
+// chooseDigestFromManifestList parses blob as a manifest list with mimeType,
 // and returns the digest of the image appropriate for the current environment.
-func chooseDigestFromManifestList(sys *types.SystemContext, blob []byte) (digest.Digest, error) {
-	wantedArch := runtime.GOARCH
-	if sys != nil && sys.ArchitectureChoice != "" {
-		wantedArch = sys.ArchitectureChoice
-	}
-	wantedOS := runtime.GOOS
-	if sys != nil && sys.OSChoice != "" {
-		wantedOS = sys.OSChoice
-	}
-
-	list := manifestList{}
-	if err := json.Unmarshal(blob, &list); err != nil {
+func chooseDigestFromManifestList(sys *types.SystemContext, blob []byte, mimeType string) (digest.Digest, error) {
+	list, err := manifest.ListFromBlob(blob, mimeType)
+	if err != nil {
 		return "", err
 	}
-	for _, d := range list.Manifests {
-		if d.Platform.Architecture == wantedArch && d.Platform.OS == wantedOS {
-			return d.Digest, nil
-		}
-	}
-	return "", fmt.Errorf("no image found in manifest list for architecture %s, OS %s", wantedArch, wantedOS)
+	return list.ChooseInstance(sys)
 }
 
-func manifestSchema2FromManifestList(ctx context.Context, sys *types.SystemContext, src types.ImageSource, manblob []byte) (genericManifest, error) {
-	targetManifestDigest, err := chooseDigestFromManifestList(sys, manblob)
+func manifestSchema2FromManifestList(ctx context.Context, sys *types.SystemContext, src types.ImageSource, manblob []byte, mimeType string) (genericManifest, error) {
+	targetManifestDigest, err := chooseDigestFromManifestList(sys, manblob, mimeType)
 	if err != nil {
 		return nil, err
 	}
@@ -81,14 +44,12 @@ func manifestSchema2FromManifestList(ctx context.Context, sys *types.SystemConte
 // ChooseManifestInstanceFromManifestList returns a digest of a manifest appropriate
 // for the current system from the manifest available from src.
 func ChooseManifestInstanceFromManifestList(ctx context.Context, sys *types.SystemContext, src types.UnparsedImage) (digest.Digest, error) {
-	// For now this only handles manifest.DockerV2ListMediaType; we can generalize it later,
-	// probably along with manifest list editing.
 	blob, mt, err := src.Manifest(ctx)
 	if err != nil {
 		return "", err
 	}
-	if mt != manifest.DockerV2ListMediaType {
+	if !manifest.MIMETypeIsMultiImage(mt) {
 		return "", fmt.Errorf("Internal error: Trying to select an image from a non-manifest-list manifest type %s", mt)
 	}
-	return chooseDigestFromManifestList(sys, blob)
+	return chooseDigestFromManifestList(sys, blob, mt)
 }
@@ -6,14 +6,16 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/manifest"
 	"github.com/containers/image/types"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestChooseDigestFromManifestList(t *testing.T) {
-	manifest, err := ioutil.ReadFile(filepath.Join("fixtures", "schema2list.json"))
+	list, err := ioutil.ReadFile(filepath.Join("fixtures", "schema2list.json"))
 	require.NoError(t, err)
 
 	// Match found
@@ -27,7 +29,22 @@ func TestChooseDigestFromManifestList(t *testing.T) {
 		digest, err := chooseDigestFromManifestList(&types.SystemContext{
 			ArchitectureChoice: arch,
 			OSChoice:           "linux",
-		}, manifest)
+		}, list, manifest.DockerV2ListMediaType)
+		require.NoError(t, err, arch)
+		assert.Equal(t, expected, digest)
+	}
+
+	// OCI image indexes use the same structure
+	index, err := ioutil.ReadFile(filepath.Join("fixtures", "oci1index.json"))
+	require.NoError(t, err)
+	for arch, expected := range map[string]digest.Digest{
+		"amd64":   "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		"ppc64le": "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+	} {
+		digest, err := chooseDigestFromManifestList(&types.SystemContext{
+			ArchitectureChoice: arch,
+			OSChoice:           "linux",
+		}, index, imgspecv1.MediaTypeImageIndex)
 		require.NoError(t, err, arch)
 		assert.Equal(t, expected, digest)
 	}
@@ -35,10 +52,10 @@ func TestChooseDigestFromManifestList(t *testing.T) {
 	// Invalid manifest list
 	_, err = chooseDigestFromManifestList(&types.SystemContext{
 		ArchitectureChoice: "amd64", OSChoice: "linux",
-	}, bytes.Join([][]byte{manifest, []byte("!INVALID")}, nil))
+	}, bytes.Join([][]byte{list, []byte("!INVALID")}, nil), manifest.DockerV2ListMediaType)
 	assert.Error(t, err)
 
 	// Not found
-	_, err = chooseDigestFromManifestList(&types.SystemContext{OSChoice: "Unmatched"}, manifest)
+	_, err = chooseDigestFromManifestList(&types.SystemContext{OSChoice: "Unmatched"}, list, manifest.DockerV2ListMediaType)
 	assert.Error(t, err)
 }
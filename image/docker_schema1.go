@@ -106,6 +106,12 @@ func (m *manifestSchema1) UpdatedImageNeedsLayerDiffIDs(options types.ManifestUp
 // UpdatedImage returns a types.Image modified according to options.
 // This does not change the state of the original Image object.
 func (m *manifestSchema1) UpdatedImage(ctx context.Context, options types.ManifestUpdateOptions) (types.Image, error) {
+	if options.ConfigBlob != nil {
+		return nil, errors.Errorf("Replacing the config of %s images is not supported", manifest.DockerV2Schema1SignedMediaType)
+	}
+	if len(options.SetAnnotations) != 0 || len(options.RemoveAnnotations) != 0 {
+		return nil, errors.Errorf("Setting or removing annotations in %s images is not supported", manifest.DockerV2Schema1SignedMediaType)
+	}
 	copy := manifestSchema1{m: manifest.Schema1Clone(m.m)}
 	if options.LayerInfos != nil {
 		if err := copy.m.UpdateLayerInfos(options.LayerInfos); err != nil {
@@ -149,54 +155,12 @@ func (m *manifestSchema1) UpdatedImage(ctx context.Context, options types.Manife
 	return memoryImageFromManifest(&copy), nil
 }
 
-// Based on github.com/docker/docker/distribution/pull_v2.go
+// convertToManifestSchema2 returns a genericManifest implementation converted to manifest.DockerV2Schema2MediaType.
+// See manifest.Schema1.ToSchema2 for the semantics of the parameters.
 func (m *manifestSchema1) convertToManifestSchema2(uploadedLayerInfos []types.BlobInfo, layerDiffIDs []digest.Digest) (genericManifest, error) {
-	if len(m.m.ExtractedV1Compatibility) == 0 {
-		// What would this even mean?! Anyhow, the rest of the code depends on FSLayers[0] and ExtractedV1Compatibility[0] existing.
-		return nil, errors.Errorf("Cannot convert an image with 0 history entries to %s", manifest.DockerV2Schema2MediaType)
-	}
-	if len(m.m.ExtractedV1Compatibility) != len(m.m.FSLayers) {
-		return nil, errors.Errorf("Inconsistent schema 1 manifest: %d history entries, %d fsLayers entries", len(m.m.ExtractedV1Compatibility), len(m.m.FSLayers))
-	}
-	if uploadedLayerInfos != nil && len(uploadedLayerInfos) != len(m.m.FSLayers) {
-		return nil, errors.Errorf("Internal error: uploaded %d blobs, but schema1 manifest has %d fsLayers", len(uploadedLayerInfos), len(m.m.FSLayers))
-	}
-	if layerDiffIDs != nil && len(layerDiffIDs) != len(m.m.FSLayers) {
-		return nil, errors.Errorf("Internal error: collected %d DiffID values, but schema1 manifest has %d fsLayers", len(layerDiffIDs), len(m.m.FSLayers))
-	}
-
-	// Build a list of the diffIDs for the non-empty layers.
-	diffIDs := []digest.Digest{}
-	var layers []manifest.Schema2Descriptor
-	for v1Index := len(m.m.ExtractedV1Compatibility) - 1; v1Index >= 0; v1Index-- {
-		v2Index := (len(m.m.ExtractedV1Compatibility) - 1) - v1Index
-
-		if !m.m.ExtractedV1Compatibility[v1Index].ThrowAway {
-			var size int64
-			if uploadedLayerInfos != nil {
-				size = uploadedLayerInfos[v2Index].Size
-			}
-			var d digest.Digest
-			if layerDiffIDs != nil {
-				d = layerDiffIDs[v2Index]
-			}
-			layers = append(layers, manifest.Schema2Descriptor{
-				MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip",
-				Size:      size,
-				Digest:    m.m.FSLayers[v1Index].BlobSum,
-			})
-			diffIDs = append(diffIDs, d)
-		}
-	}
-	configJSON, err := m.m.ToSchema2Config(diffIDs)
+	m2, configJSON, err := m.m.ToSchema2(uploadedLayerInfos, layerDiffIDs)
 	if err != nil {
 		return nil, err
 	}
-	configDescriptor := manifest.Schema2Descriptor{
-		MediaType: "application/vnd.docker.container.image.v1+json",
-		Size:      int64(len(configJSON)),
-		Digest:    digest.FromBytes(configJSON),
-	}
-
-	return manifestSchema2FromComponents(configDescriptor, nil, configJSON, layers), nil
+	return manifestSchema2FromComponents(m2.ConfigDescriptor, nil, configJSON, m2.LayersDescriptors), nil
 }
@@ -153,16 +153,26 @@ func (m *manifestSchema2) UpdatedImageNeedsLayerDiffIDs(options types.ManifestUp
 // UpdatedImage returns a types.Image modified according to options.
 // This does not change the state of the original Image object.
 func (m *manifestSchema2) UpdatedImage(ctx context.Context, options types.ManifestUpdateOptions) (types.Image, error) {
+	if len(options.SetAnnotations) != 0 || len(options.RemoveAnnotations) != 0 {
+		return nil, errors.Errorf("Setting or removing annotations in %s images is not supported", manifest.DockerV2Schema2MediaType)
+	}
 	copy := manifestSchema2{ // NOTE: This is not a deep copy, it still shares slices etc.
 		src:        m.src,
 		configBlob: m.configBlob,
 		m:          manifest.Schema2Clone(m.m),
 	}
-	if options.LayerInfos != nil {
+	// When converting to OCI, the layers are updated only after the conversion, because they may use features
+	// which are only supported in OCI, e.g. encryption.
+	if options.LayerInfos != nil && options.ManifestMIMEType != imgspecv1.MediaTypeImageManifest {
 		if err := copy.m.UpdateLayerInfos(options.LayerInfos); err != nil {
 			return nil, err
 		}
 	}
+	if options.ConfigBlob != nil {
+		copy.configBlob = options.ConfigBlob
+		copy.m.ConfigDescriptor.Digest = digest.FromBytes(options.ConfigBlob)
+		copy.m.ConfigDescriptor.Size = int64(len(options.ConfigBlob))
+	}
 	// Ignore options.EmbeddedDockerReference: it may be set when converting from schema1 to schema2, but we really don't care.
 
 	switch options.ManifestMIMEType {
@@ -170,7 +180,14 @@ func (m *manifestSchema2) UpdatedImage(ctx context.Context, options types.Manife
 	case manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema1MediaType:
 		return copy.convertToManifestSchema1(ctx, options.InformationOnly.Destination)
 	case imgspecv1.MediaTypeImageManifest:
-		return copy.convertToManifestOCI1(ctx)
+		oci, err := copy.convertToManifestOCI1(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if options.LayerInfos == nil {
+			return oci, nil
+		}
+		return oci.UpdatedImage(ctx, types.ManifestUpdateOptions{LayerInfos: options.LayerInfos})
 	default:
 		return nil, errors.Errorf("Conversion of image manifest from %s to %s is not implemented", manifest.DockerV2Schema2MediaType, options.ManifestMIMEType)
 	}
@@ -178,45 +195,16 @@ func (m *manifestSchema2) UpdatedImage(ctx context.Context, options types.Manife
 	return memoryImageFromManifest(&copy), nil
 }
 
-func oci1DescriptorFromSchema2Descriptor(d manifest.Schema2Descriptor) imgspecv1.Descriptor {
-	return imgspecv1.Descriptor{
-		MediaType: d.MediaType,
-		Size:      d.Size,
-		Digest:    d.Digest,
-		URLs:      d.URLs,
-	}
-}
-
 func (m *manifestSchema2) convertToManifestOCI1(ctx context.Context) (types.Image, error) {
-	configOCI, err := m.OCIConfig(ctx)
+	configBlob, err := m.ConfigBlob(ctx)
 	if err != nil {
 		return nil, err
 	}
-	configOCIBytes, err := json.Marshal(configOCI)
+	m1, configOCIBytes, err := m.m.ToOCI1(configBlob)
 	if err != nil {
 		return nil, err
 	}
-
-	config := imgspecv1.Descriptor{
-		MediaType: imgspecv1.MediaTypeImageConfig,
-		Size:      int64(len(configOCIBytes)),
-		Digest:    digest.FromBytes(configOCIBytes),
-	}
-
-	layers := make([]imgspecv1.Descriptor, len(m.m.LayersDescriptors))
-	for idx := range layers {
-		layers[idx] = oci1DescriptorFromSchema2Descriptor(m.m.LayersDescriptors[idx])
-		if m.m.LayersDescriptors[idx].MediaType == manifest.DockerV2Schema2ForeignLayerMediaType {
-			layers[idx].MediaType = imgspecv1.MediaTypeImageLayerNonDistributable
-		} else {
-			// we assume layers are gzip'ed because docker v2s2 only deals with
-			// gzip'ed layers. However, OCI has non-gzip'ed layers as well.
-			layers[idx].MediaType = imgspecv1.MediaTypeImageLayerGzip
-		}
-	}
-
-	m1 := manifestOCI1FromComponents(config, m.src, configOCIBytes, layers)
-	return memoryImageFromManifest(m1), nil
+	return memoryImageFromManifest(manifestOCI1FromComponents(m1.Config, m.src, configOCIBytes, m1.Layers)), nil
 }
 
 // Based on docker/distribution/manifest/schema1/config_builder.go
@@ -12,6 +12,7 @@ import (
 
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/manifest"
+	"github.com/containers/image/pkg/compression"
 	"github.com/containers/image/types"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -285,6 +286,15 @@ func TestManifestSchema2Inspect(t *testing.T) {
 			"sha256:bbd6b22eb11afce63cc76f6bc41042d99f10d6024c96b655dafba930b8d25909",
 			"sha256:960e52ecf8200cbd84e70eb2ad8678f4367e50d14357021872c10fa3fc5935fa",
 		},
+		Env: []string{
+			"PATH=/usr/local/apache2/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+			"HTTPD_PREFIX=/usr/local/apache2",
+			"HTTPD_VERSION=2.4.23",
+			"HTTPD_SHA1=5101be34ac4a509b245adb70a56690a84fcc4e7f",
+			"HTTPD_BZ2_URL=https://www.apache.org/dyn/closer.cgi?action=download&filename=httpd/httpd-2.4.23.tar.bz2",
+			"HTTPD_ASC_URL=https://www.apache.org/dist/httpd/httpd-2.4.23.tar.bz2.asc",
+		},
+		Cmd: []string{"httpd-foreground"},
 	}, *ii)
 
 	// nil configBlob will trigger an error in m.ConfigBlob()
@@ -395,6 +405,9 @@ func (d *memoryImageDest) MustMatchRuntimeOS() bool {
 func (d *memoryImageDest) IgnoresEmbeddedDockerReference() bool {
 	panic("Unexpected call to a mock function")
 }
+func (d *memoryImageDest) HasThreadSafePutBlob() bool {
+	panic("Unexpected call to a mock function")
+}
 func (d *memoryImageDest) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, isConfig bool) (types.BlobInfo, error) {
 	if d.storedBlobs == nil {
 		d.storedBlobs = make(map[digest.Digest][]byte)
@@ -441,6 +454,106 @@ func TestManifestSchema2UpdatedImage(t *testing.T) {
 	})
 	assert.Error(t, err)
 
+	// LayerInfos with changed compression:
+	for _, c := range []struct {
+		operation types.LayerCompression
+		algorithm *compression.Algorithm
+		mimeType  string // "" if an error is expected
+	}{
+		{types.PreserveOriginal, nil, manifest.DockerV2Schema2LayerMediaType},
+		// Decompress used to keep manifest.DockerV2Schema2LayerMediaType, now the layers are recorded as uncompressed.
+		{types.Decompress, nil, manifest.DockerV2SchemaLayerMediaTypeUncompressed},
+		{types.Compress, &compression.Gzip, manifest.DockerV2Schema2LayerMediaType},
+		{types.Compress, &compression.Zstd, ""}, // zstd is not supported in schema2
+		{types.Compress, nil, ""},
+		{types.Compress, &compression.Bzip2, ""},
+	} {
+		layerInfos := original.LayerInfos()
+		for i := range layerInfos {
+			layerInfos[i].CompressionOperation = c.operation
+			layerInfos[i].CompressionAlgorithm = c.algorithm
+		}
+		res, err := original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+			LayerInfos: layerInfos,
+		})
+		if c.mimeType == "" {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		for _, info := range res.LayerInfos() {
+			assert.Equal(t, c.mimeType, info.MediaType)
+		}
+		// Compressing the decompressed layers again restores the original MIME type
+		if c.operation == types.Decompress {
+			layerInfos := res.LayerInfos()
+			for i := range layerInfos {
+				layerInfos[i].CompressionOperation = types.Compress
+				layerInfos[i].CompressionAlgorithm = &compression.Gzip
+			}
+			res, err = res.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+				LayerInfos: layerInfos,
+			})
+			require.NoError(t, err)
+			for _, info := range res.LayerInfos() {
+				assert.Equal(t, manifest.DockerV2Schema2LayerMediaType, info.MediaType)
+			}
+		}
+	}
+
+	// LayerInfos with encryption:
+	// … is not supported in schema2
+	layerInfos = original.LayerInfos()
+	for i := range layerInfos {
+		layerInfos[i].CryptoOperation = types.Encrypt
+		layerInfos[i].Annotations = map[string]string{"org.opencontainers.image.enc.pubopts": "e30="}
+	}
+	_, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		LayerInfos: layerInfos,
+	})
+	assert.Error(t, err)
+	// … but it is supported when converting to OCI
+	res, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		LayerInfos:       layerInfos,
+		ManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+	})
+	require.NoError(t, err)
+	for _, info := range res.LayerInfos() {
+		assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip+"+encrypted", info.MediaType)
+		assert.Equal(t, map[string]string{"org.opencontainers.image.enc.pubopts": "e30="}, info.Annotations)
+	}
+
+	// ConfigBlob:
+	newConfig := []byte(`{"architecture":"arm64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	for _, mime := range []string{"", imgspecv1.MediaTypeImageManifest} {
+		res, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+			ConfigBlob:       newConfig,
+			ManifestMIMEType: mime,
+		})
+		require.NoError(t, err, mime)
+		if mime == "" { // Conversions may reformat the config
+			configInfo := res.ConfigInfo()
+			assert.Equal(t, digest.FromBytes(newConfig), configInfo.Digest)
+			assert.Equal(t, int64(len(newConfig)), configInfo.Size)
+			configBlob, err := res.ConfigBlob(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, newConfig, configBlob)
+		}
+		ociConfig, err := res.OCIConfig(context.Background())
+		require.NoError(t, err, mime)
+		assert.Equal(t, "arm64", ociConfig.Architecture, mime)
+	}
+
+	// SetAnnotations, RemoveAnnotations:
+	_, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		SetAnnotations: map[string]string{"key": "value"},
+	})
+	assert.Error(t, err)
+	_, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		RemoveAnnotations: []string{"key"},
+	})
+	assert.Error(t, err)
+
 	// EmbeddedDockerReference:
 	// … is ignored
 	embeddedRef, err := reference.ParseNormalizedNamed("busybox")
@@ -56,13 +56,22 @@ func manifestInstanceFromBlob(ctx context.Context, sys *types.SystemContext, src
 		return manifestOCI1FromManifest(src, manblob)
 	case manifest.DockerV2Schema2MediaType:
 		return manifestSchema2FromManifest(src, manblob)
-	case manifest.DockerV2ListMediaType:
-		return manifestSchema2FromManifestList(ctx, sys, src, manblob)
+	case manifest.DockerV2ListMediaType, imgspecv1.MediaTypeImageIndex:
+		return manifestSchema2FromManifestList(ctx, sys, src, manblob, mt)
 	default: // Note that this may not be reachable, manifest.NormalizedMIMEType has a default for unknown values.
 		return nil, fmt.Errorf("Unimplemented manifest MIME type %s", mt)
 	}
 }
 
+// updatedImage implements types.Image.UpdatedImage for img, which uses m.
+// If options would not modify m, img itself is returned, so that its manifest, and the manifest digest, are preserved.
+func updatedImage(ctx context.Context, img types.Image, m genericManifest, options types.ManifestUpdateOptions) (types.Image, error) {
+	if oci, ok := m.(*manifestOCI1); ok && oci.updatedImageIsUnmodified(options) {
+		return img, nil
+	}
+	return m.UpdatedImage(ctx, options)
+}
+
 // manifestLayerInfosToBlobInfos extracts a []types.BlobInfo from a []manifest.LayerInfo.
 func manifestLayerInfosToBlobInfos(layers []manifest.LayerInfo) []types.BlobInfo {
 	blobs := make([]types.BlobInfo, len(layers))
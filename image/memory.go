@@ -38,6 +38,11 @@ func (i *memoryImage) Size() (int64, error) {
 	return -1, nil
 }
 
+// SizeWithContext returns the size of the image as stored, if known, or -1 if not.
+func (i *memoryImage) SizeWithContext(ctx context.Context) (int64, error) {
+	return i.Size()
+}
+
 // Manifest is like ImageSource.GetManifest, but the result is cached; it is OK to call this however often you need.
 func (i *memoryImage) Manifest(ctx context.Context) ([]byte, string, error) {
 	if i.serializedManifest == nil {
@@ -50,6 +55,12 @@ func (i *memoryImage) Manifest(ctx context.Context) ([]byte, string, error) {
 	return i.serializedManifest, i.genericManifest.manifestMIMEType(), nil
 }
 
+// UpdatedImage returns a types.Image modified according to options.
+// This does not change the state of the original Image object.
+func (i *memoryImage) UpdatedImage(ctx context.Context, options types.ManifestUpdateOptions) (types.Image, error) {
+	return updatedImage(ctx, i, i.genericManifest, options)
+}
+
 // Signatures is like ImageSource.GetSignatures, but the result is cached; it is OK to call this however often you need.
 func (i *memoryImage) Signatures(ctx context.Context) ([][]byte, error) {
 	// Modifying an image invalidates signatures; a caller asking the updated image for signatures
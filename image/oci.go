@@ -133,6 +133,9 @@ func (m *manifestOCI1) UpdatedImageNeedsLayerDiffIDs(options types.ManifestUpdat
 // UpdatedImage returns a types.Image modified according to options.
 // This does not change the state of the original Image object.
 func (m *manifestOCI1) UpdatedImage(ctx context.Context, options types.ManifestUpdateOptions) (types.Image, error) {
+	if (len(options.SetAnnotations) != 0 || len(options.RemoveAnnotations) != 0) && options.ManifestMIMEType != "" {
+		return nil, errors.Errorf("Setting or removing annotations is not supported when converting an image to %s", options.ManifestMIMEType)
+	}
 	copy := manifestOCI1{ // NOTE: This is not a deep copy, it still shares slices etc.
 		src:        m.src,
 		configBlob: m.configBlob,
@@ -143,6 +146,12 @@ func (m *manifestOCI1) UpdatedImage(ctx context.Context, options types.ManifestU
 			return nil, err
 		}
 	}
+	if options.ConfigBlob != nil {
+		copy.configBlob = options.ConfigBlob
+		copy.m.Config.Digest = digest.FromBytes(options.ConfigBlob)
+		copy.m.Config.Size = int64(len(options.ConfigBlob))
+	}
+	copy.m.UpdateAnnotations(options.SetAnnotations, options.RemoveAnnotations)
 	// Ignore options.EmbeddedDockerReference: it may be set when converting from schema1, but we really don't care.
 
 	switch options.ManifestMIMEType {
@@ -166,32 +175,26 @@ func (m *manifestOCI1) UpdatedImage(ctx context.Context, options types.ManifestU
 	return memoryImageFromManifest(&copy), nil
 }
 
-func schema2DescriptorFromOCI1Descriptor(d imgspecv1.Descriptor) manifest.Schema2Descriptor {
-	return manifest.Schema2Descriptor{
-		MediaType: d.MediaType,
-		Size:      d.Size,
-		Digest:    d.Digest,
-		URLs:      d.URLs,
+// updatedImageIsUnmodified returns true if UpdatedImage(options) would only modify annotations, and they are already as requested;
+// the original manifest, with its original digest, can then be used.
+func (m *manifestOCI1) updatedImageIsUnmodified(options types.ManifestUpdateOptions) bool {
+	if len(options.SetAnnotations) == 0 && len(options.RemoveAnnotations) == 0 {
+		return false
 	}
+	if options.LayerInfos != nil || options.ConfigBlob != nil || options.ManifestMIMEType != "" {
+		return false
+	}
+	return !manifest.OCI1Clone(m.m).UpdateAnnotations(options.SetAnnotations, options.RemoveAnnotations)
 }
 
 func (m *manifestOCI1) convertToManifestSchema2() (types.Image, error) {
-	// Create a copy of the descriptor.
-	config := schema2DescriptorFromOCI1Descriptor(m.m.Config)
-
-	// The only difference between OCI and DockerSchema2 is the mediatypes. The
-	// media type of the manifest is handled by manifestSchema2FromComponents.
-	config.MediaType = manifest.DockerV2Schema2ConfigMediaType
-
-	layers := make([]manifest.Schema2Descriptor, len(m.m.Layers))
-	for idx := range layers {
-		layers[idx] = schema2DescriptorFromOCI1Descriptor(m.m.Layers[idx])
-		layers[idx].MediaType = manifest.DockerV2Schema2LayerMediaType
+	m2, err := m.m.ToSchema2()
+	if err != nil {
+		return nil, err
 	}
-
 	// Rather than copying the ConfigBlob now, we just pass m.src to the
 	// translated manifest, since the only difference is the mediatype of
 	// descriptors there is no change to any blob stored in m.src.
-	m1 := manifestSchema2FromComponents(config, m.src, nil, layers)
-	return memoryImageFromManifest(m1), nil
+	// (m.configBlob is passed along as well, in case it was replaced by UpdatedImage and does not exist in m.src.)
+	return memoryImageFromManifest(manifestSchema2FromComponents(m2.ConfigDescriptor, m.src, m.configBlob, m2.LayersDescriptors)), nil
 }
@@ -12,6 +12,7 @@ import (
 
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/manifest"
+	"github.com/containers/image/pkg/compression"
 	"github.com/containers/image/types"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -268,6 +269,15 @@ func TestManifestOCI1Inspect(t *testing.T) {
 			"sha256:bbd6b22eb11afce63cc76f6bc41042d99f10d6024c96b655dafba930b8d25909",
 			"sha256:960e52ecf8200cbd84e70eb2ad8678f4367e50d14357021872c10fa3fc5935fa",
 		},
+		Env: []string{
+			"PATH=/usr/local/apache2/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+			"HTTPD_PREFIX=/usr/local/apache2",
+			"HTTPD_VERSION=2.4.23",
+			"HTTPD_SHA1=5101be34ac4a509b245adb70a56690a84fcc4e7f",
+			"HTTPD_BZ2_URL=https://www.apache.org/dyn/closer.cgi?action=download&filename=httpd/httpd-2.4.23.tar.bz2",
+			"HTTPD_ASC_URL=https://www.apache.org/dist/httpd/httpd-2.4.23.tar.bz2.asc",
+		},
+		Cmd: []string{"httpd-foreground"},
 	}, *ii)
 
 	// nil configBlob will trigger an error in m.ConfigBlob()
@@ -334,6 +344,120 @@ func TestManifestOCI1UpdatedImage(t *testing.T) {
 	})
 	assert.Error(t, err)
 
+	// LayerInfos with changed compression:
+	for _, c := range []struct {
+		operation types.LayerCompression
+		algorithm *compression.Algorithm
+		mimeType  string // "" if an error is expected
+	}{
+		{types.Decompress, nil, imgspecv1.MediaTypeImageLayer},
+		{types.Compress, &compression.Gzip, imgspecv1.MediaTypeImageLayerGzip},
+		{types.Compress, &compression.Zstd, manifest.OCI1LayerMediaTypeZstd},
+		{types.Compress, nil, ""},
+		{types.Compress, &compression.Bzip2, ""},
+	} {
+		layerInfos := original.LayerInfos()
+		for i := range layerInfos {
+			layerInfos[i].CompressionOperation = c.operation
+			layerInfos[i].CompressionAlgorithm = c.algorithm
+		}
+		res, err := original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+			LayerInfos: layerInfos,
+		})
+		if c.mimeType == "" {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		for _, info := range res.LayerInfos() {
+			assert.Equal(t, c.mimeType, info.MediaType)
+		}
+		// Compressing the decompressed layers again restores the original MIME type
+		if c.operation == types.Decompress {
+			layerInfos := res.LayerInfos()
+			for i := range layerInfos {
+				layerInfos[i].CompressionOperation = types.Compress
+				layerInfos[i].CompressionAlgorithm = &compression.Gzip
+			}
+			res, err = res.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+				LayerInfos: layerInfos,
+			})
+			require.NoError(t, err)
+			for _, info := range res.LayerInfos() {
+				assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip, info.MediaType)
+			}
+		}
+	}
+
+	// ConfigBlob:
+	newConfig := []byte(`{"architecture":"arm64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	for _, mime := range []string{"", manifest.DockerV2Schema2MediaType} {
+		res, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+			ConfigBlob:       newConfig,
+			ManifestMIMEType: mime,
+		})
+		require.NoError(t, err, mime)
+		if mime == "" { // Conversions may reformat the config
+			configInfo := res.ConfigInfo()
+			assert.Equal(t, digest.FromBytes(newConfig), configInfo.Digest)
+			assert.Equal(t, int64(len(newConfig)), configInfo.Size)
+			configBlob, err := res.ConfigBlob(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, newConfig, configBlob)
+		}
+		ociConfig, err := res.OCIConfig(context.Background())
+		require.NoError(t, err, mime)
+		assert.Equal(t, "arm64", ociConfig.Architecture, mime)
+	}
+
+	// SetAnnotations, RemoveAnnotations:
+	res, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		SetAnnotations: map[string]string{"key1": "value1", "key2": "value2"},
+	})
+	require.NoError(t, err)
+	res, err = res.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		SetAnnotations:    map[string]string{"key1": "updated"},
+		RemoveAnnotations: []string{"key2"},
+	})
+	require.NoError(t, err)
+	manifestBlob, _, err := res.Manifest(context.Background())
+	require.NoError(t, err)
+	updated, err := manifest.OCI1FromManifest(manifestBlob)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"key1": "updated"}, updated.Annotations)
+	// … if nothing changes, the manifest is preserved
+	unmodified, err := res.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		SetAnnotations:    map[string]string{"key1": "updated"},
+		RemoveAnnotations: []string{"key2"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, res, unmodified)
+	manifestBlob, err = ioutil.ReadFile(filepath.Join("fixtures", "oci1.json"))
+	require.NoError(t, err)
+	img, err := FromUnparsedImage(context.Background(), nil,
+		UnparsedInstance(manifestImageSource{manifest: manifestBlob, mimeType: imgspecv1.MediaTypeImageManifest}, nil))
+	require.NoError(t, err)
+	unmodified, err = img.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		RemoveAnnotations: []string{"this-annotation-does-not-exist"},
+	})
+	require.NoError(t, err)
+	unmodifiedBlob, _, err := unmodified.Manifest(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, manifestBlob, unmodifiedBlob)
+	// … annotations can not be set or removed when converting to formats which do not support them
+	for _, mime := range []string{manifest.DockerV2Schema2MediaType, manifest.DockerV2Schema1SignedMediaType} {
+		_, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+			SetAnnotations:   map[string]string{"key": "value"},
+			ManifestMIMEType: mime,
+		})
+		assert.Error(t, err, mime)
+		_, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+			RemoveAnnotations: []string{"key"},
+			ManifestMIMEType:  mime,
+		})
+		assert.Error(t, err, mime)
+	}
+
 	// EmbeddedDockerReference:
 	// … is ignored
 	embeddedRef, err := reference.ParseNormalizedNamed("busybox")
@@ -5,7 +5,10 @@ package image
 
 import (
 	"context"
+
 	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
 )
 
 // imageCloser implements types.ImageCloser, perhaps allowing simple users
@@ -89,8 +92,45 @@ func FromUnparsedImage(ctx context.Context, sys *types.SystemContext, unparsed *
 }
 
 // Size returns the size of the image as stored, if it's known, or -1 if it isn't.
+// This is the sum of the sizes of the manifest, the config and the layers (each distinct blob counted once);
+// sizes which are not recorded in the manifest are determined using types.BlobSizeSource, if the source implements it.
 func (i *sourcedImage) Size() (int64, error) {
-	return -1, nil
+	return i.SizeWithContext(context.TODO())
+}
+
+// SizeWithContext is like Size, but uses ctx to determine blob sizes using the source.
+func (i *sourcedImage) SizeWithContext(ctx context.Context) (int64, error) {
+	sizeSource, _ := i.src.(types.BlobSizeSource)
+
+	blobs := []types.BlobInfo{}
+	if config := i.ConfigInfo(); config.Digest != "" {
+		blobs = append(blobs, config)
+	}
+	blobs = append(blobs, i.LayerInfos()...)
+	size := int64(len(i.manifestBlob))
+	seen := map[digest.Digest]struct{}{}
+	for _, info := range blobs {
+		if _, ok := seen[info.Digest]; ok {
+			continue
+		}
+		seen[info.Digest] = struct{}{}
+		blobSize := info.Size
+		if blobSize == -1 {
+			if sizeSource == nil {
+				return -1, nil
+			}
+			s, err := sizeSource.BlobSize(ctx, info)
+			if err != nil {
+				return -1, errors.Wrapf(err, "Error determining the size of blob %s", info.Digest)
+			}
+			if s == -1 {
+				return -1, nil
+			}
+			blobSize = s
+		}
+		size += blobSize
+	}
+	return size, nil
 }
 
 // Manifest overrides the UnparsedImage.Manifest to always use the fields which we have already fetched.
@@ -98,6 +138,12 @@ func (i *sourcedImage) Manifest(ctx context.Context) ([]byte, string, error) {
 	return i.manifestBlob, i.manifestMIMEType, nil
 }
 
+// UpdatedImage returns a types.Image modified according to options.
+// This does not change the state of the original Image object.
+func (i *sourcedImage) UpdatedImage(ctx context.Context, options types.ManifestUpdateOptions) (types.Image, error) {
+	return updatedImage(ctx, i, i.genericManifest, options)
+}
+
 func (i *sourcedImage) LayerInfosForCopy(ctx context.Context) ([]types.BlobInfo, error) {
 	return i.UnparsedImage.src.LayerInfosForCopy(ctx)
 }
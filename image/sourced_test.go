@@ -0,0 +1,121 @@
+package image
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestImageSource is a mock of types.ImageSource which only returns a manifest.
+type manifestImageSource struct {
+	unusedImageSource // We inherit almost all of the methods, which just panic()
+	manifest          []byte
+	mimeType          string
+}
+
+func (s manifestImageSource) Reference() types.ImageReference {
+	return refImageReferenceMock{nil}
+}
+
+func (s manifestImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest != nil {
+		panic("Unexpected instanceDigest in GetManifest")
+	}
+	return s.manifest, s.mimeType, nil
+}
+
+// blobSizeImageSource is a manifestImageSource which also implements types.BlobSizeSource.
+type blobSizeImageSource struct {
+	manifestImageSource
+	sizes map[digest.Digest]int64
+}
+
+func (s blobSizeImageSource) BlobSize(ctx context.Context, info types.BlobInfo) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+	size, ok := s.sizes[info.Digest]
+	if !ok {
+		return -1, errors.Errorf("Unexpected blob %s", info.Digest)
+	}
+	return size, nil
+}
+
+func TestSourcedImageSize(t *testing.T) {
+	// All sizes are recorded in the manifest
+	schema2, err := ioutil.ReadFile(filepath.Join("fixtures", "schema2.json"))
+	require.NoError(t, err)
+	m2, err := manifest.Schema2FromManifest(schema2)
+	require.NoError(t, err)
+	expected := int64(len(schema2)) + m2.ConfigDescriptor.Size
+	for _, layer := range m2.LayersDescriptors {
+		expected += layer.Size
+	}
+	img, err := FromUnparsedImage(context.Background(), nil,
+		UnparsedInstance(manifestImageSource{manifest: schema2, mimeType: manifest.DockerV2Schema2MediaType}, nil))
+	require.NoError(t, err)
+	size, err := img.Size()
+	require.NoError(t, err)
+	assert.Equal(t, expected, size)
+
+	// Sizes are not recorded in the manifest
+	schema1, err := ioutil.ReadFile(filepath.Join("fixtures", "schema1.json"))
+	require.NoError(t, err)
+	m1, err := manifest.Schema1FromManifest(schema1)
+	require.NoError(t, err)
+	// … and the source can not determine them
+	img, err = FromUnparsedImage(context.Background(), nil,
+		UnparsedInstance(manifestImageSource{manifest: schema1, mimeType: manifest.DockerV2Schema1SignedMediaType}, nil))
+	require.NoError(t, err)
+	size, err = img.Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), size)
+	// … and the source determines them; each distinct blob is counted once
+	sizes := map[digest.Digest]int64{}
+	expected = int64(len(schema1))
+	for i, layer := range m1.FSLayers {
+		if _, ok := sizes[layer.BlobSum]; !ok {
+			sizes[layer.BlobSum] = int64(1000 + i)
+			expected += int64(1000 + i)
+		}
+	}
+	img, err = FromUnparsedImage(context.Background(), nil,
+		UnparsedInstance(blobSizeImageSource{
+			manifestImageSource: manifestImageSource{manifest: schema1, mimeType: manifest.DockerV2Schema1SignedMediaType},
+			sizes:               sizes,
+		}, nil))
+	require.NoError(t, err)
+	size, err = img.Size()
+	require.NoError(t, err)
+	assert.Equal(t, expected, size)
+	size, err = img.SizeWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, expected, size)
+	// … using a cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = img.SizeWithContext(ctx)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+	// … and the source can not determine the size of a blob
+	sizes[m1.FSLayers[0].BlobSum] = -1
+	size, err = img.Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), size)
+	// … and the source fails
+	img, err = FromUnparsedImage(context.Background(), nil,
+		UnparsedInstance(blobSizeImageSource{
+			manifestImageSource: manifestImageSource{manifest: schema1, mimeType: manifest.DockerV2Schema1SignedMediaType},
+			sizes:               map[digest.Digest]int64{},
+		}, nil))
+	require.NoError(t, err)
+	_, err = img.Size()
+	assert.Error(t, err)
+}
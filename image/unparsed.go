@@ -82,6 +82,15 @@ func (i *UnparsedImage) expectedManifestDigest() (digest.Digest, bool) {
 	return "", false
 }
 
+// ManifestList returns an UnparsedImage for the manifest list from which this instance was selected,
+// or nil if this UnparsedImage does not represent an instance selected from a manifest list.
+func (i *UnparsedImage) ManifestList() types.UnparsedImage {
+	if i.instanceDigest == nil {
+		return nil
+	}
+	return UnparsedInstance(i.src, nil)
+}
+
 // Signatures is like ImageSource.GetSignatures, but the result is cached; it is OK to call this however often you need.
 func (i *UnparsedImage) Signatures(ctx context.Context) ([][]byte, error) {
 	if i.cachedSignatures == nil {
@@ -41,6 +41,9 @@ const (
 	// MaxTarFileManifestSize is the maximum allowed size of a (docker save)-like manifest (which may contain multiple images)
 	// The limit of 1 MB is considered to be greatly sufficient.
 	MaxTarFileManifestSize = megaByte
+	// MaxListBodySize is the maximum allowed size of a single page of a registry's tag or repository list.
+	// The limit of 4 MB is considered to be greatly sufficient.
+	MaxListBodySize = 4 * megaByte
 )
 
 // ReadAtMost reads from reader and errors out if the specified limit (in bytes) is exceeded.
@@ -0,0 +1,55 @@
+// Package progress implements reporting of the progress of blob transfers to a types.ProgressProperties channel.
+package progress
+
+import (
+	"io"
+	"time"
+
+	"github.com/containers/image/types"
+)
+
+// Reader is a reader that reports its progress to a channel, at most once per interval, and when the end of the data is reached.
+// Reports are sent synchronously: the channel must be read, or reading from Reader blocks.
+type Reader struct {
+	source   io.Reader
+	channel  chan<- types.ProgressProperties
+	interval time.Duration
+	artifact types.BlobInfo
+	lastTime time.Time
+	offset   uint64
+	reported uint64 // The offset included in the last report to channel
+}
+
+// NewReader returns a Reader reading from source, and reporting the progress of a transfer of artifact to channel.
+// If interval is <= 0, every read is reported.
+func NewReader(source io.Reader, channel chan<- types.ProgressProperties, interval time.Duration, artifact types.BlobInfo) *Reader {
+	return &Reader{
+		source:   source,
+		channel:  channel,
+		interval: interval,
+		artifact: artifact,
+		lastTime: time.Now(),
+	}
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	r.offset += uint64(n)
+	if (err == io.EOF && r.offset != r.reported) || (n > 0 && time.Since(r.lastTime) >= r.interval) {
+		r.Report(types.ProgressEventRead)
+		r.lastTime = time.Now()
+	}
+	return n, err
+}
+
+// Report sends event, with the current offset, to the channel.
+func (r *Reader) Report(event types.ProgressEvent) {
+	r.channel <- types.ProgressProperties{
+		Event:        event,
+		Artifact:     r.artifact,
+		Offset:       r.offset,
+		OffsetUpdate: r.offset - r.reported,
+	}
+	r.reported = r.offset
+}
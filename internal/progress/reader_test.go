@@ -0,0 +1,54 @@
+package progress
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/containers/image/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 1000)
+	artifact := types.BlobInfo{Digest: "sha256:0000000000000000000000000000000000000000000000000000000000000000", Size: int64(len(data))}
+
+	for _, c := range []struct {
+		interval time.Duration
+		events   []types.ProgressProperties
+	}{
+		{ // A zero interval reports every read
+			0, []types.ProgressProperties{
+				{Event: types.ProgressEventNewArtifact, Artifact: artifact},
+				{Event: types.ProgressEventRead, Artifact: artifact, Offset: 400, OffsetUpdate: 400},
+				{Event: types.ProgressEventRead, Artifact: artifact, Offset: 800, OffsetUpdate: 400},
+				{Event: types.ProgressEventRead, Artifact: artifact, Offset: 1000, OffsetUpdate: 200},
+				{Event: types.ProgressEventDone, Artifact: artifact, Offset: 1000, OffsetUpdate: 0},
+			},
+		},
+		{ // With a long interval, only the end of the data is reported
+			time.Hour, []types.ProgressProperties{
+				{Event: types.ProgressEventNewArtifact, Artifact: artifact},
+				{Event: types.ProgressEventRead, Artifact: artifact, Offset: 1000, OffsetUpdate: 1000},
+				{Event: types.ProgressEventDone, Artifact: artifact, Offset: 1000, OffsetUpdate: 0},
+			},
+		},
+	} {
+		ch := make(chan types.ProgressProperties, 100)
+		r := NewReader(bytes.NewReader(data), ch, c.interval, artifact)
+		r.Report(types.ProgressEventNewArtifact)
+		buf := make([]byte, 400)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				break
+			}
+		}
+		r.Report(types.ProgressEventDone)
+		close(ch)
+		events := []types.ProgressProperties{}
+		for p := range ch {
+			events = append(events, p)
+		}
+		assert.Equal(t, c.events, events, c.interval.String())
+	}
+}
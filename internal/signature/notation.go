@@ -0,0 +1,45 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// NotationPrefix is the prefix of a serialized Notation signature blob; the rest of the blob is a JSON-encoded Notation.
+const NotationPrefix = "\x00notation-json"
+
+// Notation is a Notation (Notary v2) signature envelope, as stored in the signature storage of a transport.
+// All of the contents are UNTRUSTED until verified by the notationSigned policy requirement.
+type Notation struct {
+	MediaType string `json:"mediaType"` // The media type of the envelope, e.g. "application/jose+json"
+	Envelope  []byte `json:"envelope"`
+}
+
+// IsNotation returns true if blob is a serialized Notation signature.
+func IsNotation(blob []byte) bool {
+	return bytes.HasPrefix(blob, []byte(NotationPrefix))
+}
+
+// Blob returns a serialized form of n, usable in the signature storage of a transport.
+func (n Notation) Blob() ([]byte, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(NotationPrefix), data...), nil
+}
+
+// NotationFromBlob parses a blob returned by Notation.Blob.
+// This does not validate the contents in any way; the signature package parses the blobs strictly before verifying them.
+func NotationFromBlob(blob []byte) (*Notation, error) {
+	if !IsNotation(blob) {
+		return nil, errors.New("Not a Notation signature")
+	}
+	var res Notation
+	if err := json.Unmarshal(blob[len(NotationPrefix):], &res); err != nil {
+		return nil, errors.Wrap(err, "Error parsing Notation signature")
+	}
+	return &res, nil
+}
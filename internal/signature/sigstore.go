@@ -0,0 +1,50 @@
+// Package signature contains the serialized signature formats shared by the signature package and the transports,
+// which can not import each other.
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// SigstorePrefix is the prefix of a serialized sigstore signature blob; the rest of the blob is a JSON-encoded Sigstore.
+// Simple signing signatures are OpenPGP messages, which never start with a zero byte,
+// so this is sufficient to distinguish the two formats.
+const SigstorePrefix = "\x00sigstore-json"
+
+// Sigstore is a sigstore (cosign-style) signature, as stored in the signature storage of a transport.
+// All of the contents are UNTRUSTED until verified by the sigstoreSigned policy requirement.
+type Sigstore struct {
+	MIMEType    string            `json:"mimeType"`
+	Payload     []byte            `json:"payload"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// IsSigstore returns true if blob is a serialized sigstore signature.
+func IsSigstore(blob []byte) bool {
+	return bytes.HasPrefix(blob, []byte(SigstorePrefix))
+}
+
+// Blob returns a serialized form of s, usable in the signature storage of a transport.
+func (s Sigstore) Blob() ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(SigstorePrefix), data...), nil
+}
+
+// SigstoreFromBlob parses a blob returned by Sigstore.Blob.
+// This does not validate the contents in any way; the signature package parses the blobs strictly before verifying them.
+func SigstoreFromBlob(blob []byte) (*Sigstore, error) {
+	if !IsSigstore(blob) {
+		return nil, errors.New("Not a sigstore signature")
+	}
+	var res Sigstore
+	if err := json.Unmarshal(blob[len(SigstorePrefix):], &res); err != nil {
+		return nil, errors.Wrap(err, "Error parsing sigstore signature")
+	}
+	return &res, nil
+}
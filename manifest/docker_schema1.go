@@ -140,6 +140,11 @@ func (m *Schema1) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	if len(m.FSLayers) != len(layerInfos) {
 		return errors.Errorf("Error preparing updated manifest: layer count changed from %d to %d", len(m.FSLayers), len(layerInfos))
 	}
+	for _, info := range layerInfos {
+		if info.CryptoOperation != types.PreserveOriginalCrypto {
+			return errors.Errorf("Error preparing updated manifest: encrypted layers are not supported in %s images", DockerV2Schema1SignedMediaType)
+		}
+	}
 	m.FSLayers = make([]Schema1FSLayers, len(layerInfos))
 	for i, info := range layerInfos {
 		// (docker push) sets up m.ExtractedV1Compatibility[].{Id,Parent} based on values of info.Digest,
@@ -226,6 +231,9 @@ func (m *Schema1) Inspect(_ func(types.BlobInfo) ([]byte, error)) (*types.ImageI
 	}
 	if s1.Config != nil {
 		i.Labels = s1.Config.Labels
+		i.Env = s1.Config.Env
+		i.Entrypoint = s1.Config.Entrypoint
+		i.Cmd = s1.Config.Cmd
 	}
 	return i, nil
 }
@@ -305,6 +313,60 @@ func (m *Schema1) ToSchema2Config(diffIDs []digest.Digest) ([]byte, error) {
 	return config, nil
 }
 
+// ToSchema2 builds a schema2 manifest, and the corresponding config blob, equivalent to m.
+// uploadedLayerInfos, if not nil, provides the sizes of the layer blobs, and layerDiffIDs, if not nil, their DiffIDs,
+// in the order of LayerInfos() (the root layer first); otherwise the sizes are set to 0, and the DiffIDs are empty.
+// Based on github.com/docker/docker/distribution/pull_v2.go
+func (m *Schema1) ToSchema2(uploadedLayerInfos []types.BlobInfo, layerDiffIDs []digest.Digest) (*Schema2, []byte, error) {
+	if len(m.ExtractedV1Compatibility) == 0 {
+		// What would this even mean?! Anyhow, the rest of the code depends on FSLayers[0] and ExtractedV1Compatibility[0] existing.
+		return nil, nil, errors.Errorf("Cannot convert an image with 0 history entries to %s", DockerV2Schema2MediaType)
+	}
+	if len(m.ExtractedV1Compatibility) != len(m.FSLayers) {
+		return nil, nil, errors.Errorf("Inconsistent schema 1 manifest: %d history entries, %d fsLayers entries", len(m.ExtractedV1Compatibility), len(m.FSLayers))
+	}
+	if uploadedLayerInfos != nil && len(uploadedLayerInfos) != len(m.FSLayers) {
+		return nil, nil, errors.Errorf("Internal error: uploaded %d blobs, but schema1 manifest has %d fsLayers", len(uploadedLayerInfos), len(m.FSLayers))
+	}
+	if layerDiffIDs != nil && len(layerDiffIDs) != len(m.FSLayers) {
+		return nil, nil, errors.Errorf("Internal error: collected %d DiffID values, but schema1 manifest has %d fsLayers", len(layerDiffIDs), len(m.FSLayers))
+	}
+
+	// Build a list of the diffIDs for the non-empty layers.
+	diffIDs := []digest.Digest{}
+	var layers []Schema2Descriptor
+	for v1Index := len(m.ExtractedV1Compatibility) - 1; v1Index >= 0; v1Index-- {
+		v2Index := (len(m.ExtractedV1Compatibility) - 1) - v1Index
+
+		if !m.ExtractedV1Compatibility[v1Index].ThrowAway {
+			var size int64
+			if uploadedLayerInfos != nil {
+				size = uploadedLayerInfos[v2Index].Size
+			}
+			var d digest.Digest
+			if layerDiffIDs != nil {
+				d = layerDiffIDs[v2Index]
+			}
+			layers = append(layers, Schema2Descriptor{
+				MediaType: DockerV2Schema2LayerMediaType,
+				Size:      size,
+				Digest:    m.FSLayers[v1Index].BlobSum,
+			})
+			diffIDs = append(diffIDs, d)
+		}
+	}
+	configJSON, err := m.ToSchema2Config(diffIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	configDescriptor := Schema2Descriptor{
+		MediaType: DockerV2Schema2ConfigMediaType,
+		Size:      int64(len(configJSON)),
+		Digest:    digest.FromBytes(configJSON),
+	}
+	return Schema2FromComponents(configDescriptor, layers), configJSON, nil
+}
+
 // ImageID computes an ID which can uniquely identify this image by its contents.
 func (m *Schema1) ImageID(diffIDs []digest.Digest) (string, error) {
 	image, err := m.ToSchema2Config(diffIDs)
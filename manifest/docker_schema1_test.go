@@ -1,12 +1,15 @@
 package manifest
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -140,3 +143,74 @@ func TestSchema1LayerInfos(t *testing.T) {
 		{BlobInfo: types.BlobInfo{Digest: "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4", Size: -1}, EmptyLayer: true},
 	}, m.LayerInfos())
 }
+
+func TestSchema1UpdateLayerInfos(t *testing.T) {
+	m := manifestSchema1FromFixture(t, "schema2-to-schema1-by-docker.json")
+	original := m.FSLayers
+	layerInfos := []types.BlobInfo{}
+	for _, info := range m.LayerInfos() {
+		layerInfos = append(layerInfos, info.BlobInfo)
+	}
+
+	// Encrypted layers are not supported
+	layerInfos[0].CryptoOperation = types.Encrypt
+	err := m.UpdateLayerInfos(layerInfos)
+	assert.Error(t, err)
+	assert.Equal(t, original, m.FSLayers)
+
+	layerInfos[0].CryptoOperation = types.PreserveOriginalCrypto
+	layerInfos[0].Digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	err = m.UpdateLayerInfos(layerInfos)
+	require.NoError(t, err)
+	assert.Equal(t, layerInfos[0].Digest, m.LayerInfos()[0].Digest)
+}
+
+func TestSchema1ToSchema2(t *testing.T) {
+	m := manifestSchema1FromFixture(t, "schema2-to-schema1-by-docker.json")
+	layerInfos := m.LayerInfos()
+	uploadedLayerInfos := make([]types.BlobInfo, len(layerInfos))
+	layerDiffIDs := make([]digest.Digest, len(layerInfos))
+	expectedLayers := []Schema2Descriptor{}
+	expectedDiffIDs := []digest.Digest{}
+	for i, info := range layerInfos {
+		uploadedLayerInfos[i] = types.BlobInfo{Digest: info.Digest, Size: int64(1000 + i)}
+		layerDiffIDs[i] = digest.FromString(fmt.Sprintf("layer %d", i))
+		if !info.EmptyLayer {
+			expectedLayers = append(expectedLayers, Schema2Descriptor{
+				MediaType: DockerV2Schema2LayerMediaType,
+				Size:      int64(1000 + i),
+				Digest:    info.Digest,
+			})
+			expectedDiffIDs = append(expectedDiffIDs, layerDiffIDs[i])
+		}
+	}
+
+	m2, configJSON, err := m.ToSchema2(uploadedLayerInfos, layerDiffIDs)
+	require.NoError(t, err)
+	assert.Equal(t, DockerV2Schema2MediaType, m2.MediaType)
+	assert.Equal(t, expectedLayers, m2.LayersDescriptors)
+	assert.Equal(t, Schema2Descriptor{
+		MediaType: DockerV2Schema2ConfigMediaType,
+		Size:      int64(len(configJSON)),
+		Digest:    digest.FromBytes(configJSON),
+	}, m2.ConfigDescriptor)
+	config := Schema2Image{}
+	err = json.Unmarshal(configJSON, &config)
+	require.NoError(t, err)
+	assert.Equal(t, "amd64", config.Architecture)
+	assert.Equal(t, expectedDiffIDs, config.RootFS.DiffIDs)
+	assert.Len(t, config.History, len(layerInfos))
+
+	// Without layer information
+	m2, _, err = m.ToSchema2(nil, nil)
+	require.NoError(t, err)
+	for _, layer := range m2.LayersDescriptors {
+		assert.Equal(t, int64(0), layer.Size)
+	}
+
+	// Mismatched layer information
+	_, _, err = m.ToSchema2(uploadedLayerInfos[1:], layerDiffIDs)
+	assert.Error(t, err)
+	_, _, err = m.ToSchema2(uploadedLayerInfos, layerDiffIDs[1:])
+	assert.Error(t, err)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/containers/image/pkg/strslice"
 	"github.com/containers/image/types"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 )
 
@@ -207,7 +208,11 @@ func (m *Schema2) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	original := m.LayersDescriptors
 	m.LayersDescriptors = make([]Schema2Descriptor, len(layerInfos))
 	for i, info := range layerInfos {
-		m.LayersDescriptors[i].MediaType = original[i].MediaType
+		mimeType, err := updatedSchema2LayerMIMEType(original[i].MediaType, info)
+		if err != nil {
+			return err
+		}
+		m.LayersDescriptors[i].MediaType = mimeType
 		m.LayersDescriptors[i].Digest = info.Digest
 		m.LayersDescriptors[i].Size = info.Size
 		m.LayersDescriptors[i].URLs = info.URLs
@@ -215,6 +220,22 @@ func (m *Schema2) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	return nil
 }
 
+// updatedSchema2LayerMIMEType returns the MIME type of a layer originally of mimeType, after the compression and encryption operations recorded in info.
+func updatedSchema2LayerMIMEType(mimeType string, info types.BlobInfo) (string, error) {
+	if info.CompressionOperation == types.PreserveOriginal && info.CryptoOperation == types.PreserveOriginalCrypto {
+		return mimeType, nil
+	}
+	t, err := updatedLayerMediaType(mimeType, info)
+	if err != nil {
+		return "", err
+	}
+	res, err := t.Schema2MIMEType()
+	if err != nil {
+		return "", errors.Wrap(err, "Error preparing updated manifest")
+	}
+	return res, nil
+}
+
 // Serialize returns the manifest in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
 func (m *Schema2) Serialize() ([]byte, error) {
@@ -241,10 +262,60 @@ func (m *Schema2) Inspect(configGetter func(types.BlobInfo) ([]byte, error)) (*t
 	}
 	if s2.Config != nil {
 		i.Labels = s2.Config.Labels
+		i.Env = s2.Config.Env
+		i.Entrypoint = s2.Config.Entrypoint
+		i.Cmd = s2.Config.Cmd
 	}
 	return i, nil
 }
 
+// ToOCI1 returns an OCI manifest equivalent to m, and an OCI config blob converted from configBlob, the config of m.
+func (m *Schema2) ToOCI1(configBlob []byte) (*OCI1, []byte, error) {
+	// docker v2s2 and OCI v1 are mostly compatible but v2s2 contains more fields
+	// than OCI v1. This unmarshal makes sure we drop docker v2s2
+	// fields that aren't needed in OCI v1.
+	configOCI := imgspecv1.Image{}
+	if err := json.Unmarshal(configBlob, &configOCI); err != nil {
+		return nil, nil, errors.Wrap(err, "Error parsing schema2 config")
+	}
+	configOCIBytes, err := json.Marshal(configOCI)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error encoding OCI config")
+	}
+	config := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Size:      int64(len(configOCIBytes)),
+		Digest:    digest.FromBytes(configOCIBytes),
+	}
+
+	layers := make([]imgspecv1.Descriptor, len(m.LayersDescriptors))
+	for i, d := range m.LayersDescriptors {
+		layers[i] = imgspecv1.Descriptor{
+			MediaType: oci1LayerMediaTypeFromSchema2(d.MediaType),
+			Size:      d.Size,
+			Digest:    d.Digest,
+			URLs:      d.URLs,
+		}
+	}
+	return OCI1FromComponents(config, layers), configOCIBytes, nil
+}
+
+// oci1LayerMediaTypeFromSchema2 returns the OCI media type corresponding to a schema2 layer mediaType.
+func oci1LayerMediaTypeFromSchema2(mediaType string) string {
+	switch mediaType {
+	case DockerV2Schema2ForeignLayerMediaType:
+		return imgspecv1.MediaTypeImageLayerNonDistributableGzip
+	case DockerV2Schema2ForeignLayerMediaTypeUncompressed:
+		return imgspecv1.MediaTypeImageLayerNonDistributable
+	case DockerV2SchemaLayerMediaTypeUncompressed:
+		return imgspecv1.MediaTypeImageLayer
+	default:
+		// we assume other layers are gzip'ed because docker v2s2 only deals with
+		// gzip'ed layers, apart from the uncompressed ones above.
+		return imgspecv1.MediaTypeImageLayerGzip
+	}
+}
+
 // ImageID computes an ID which can uniquely identify this image by its contents.
 func (m *Schema2) ImageID([]digest.Digest) (string, error) {
 	if err := m.ConfigDescriptor.Digest.Validate(); err != nil {
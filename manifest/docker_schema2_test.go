@@ -0,0 +1,54 @@
+package manifest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema2ToOCI1(t *testing.T) {
+	layers := []Schema2Descriptor{}
+	expectedLayers := []imgspecv1.Descriptor{}
+	for i, c := range []struct{ schema2, oci string }{
+		{DockerV2Schema2LayerMediaType, imgspecv1.MediaTypeImageLayerGzip},
+		{DockerV2SchemaLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayer},
+		{DockerV2Schema2ForeignLayerMediaType, imgspecv1.MediaTypeImageLayerNonDistributableGzip},
+		{DockerV2Schema2ForeignLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayerNonDistributable},
+	} {
+		d := digest.FromString(c.schema2)
+		urls := []string{}
+		if c.oci == imgspecv1.MediaTypeImageLayerNonDistributableGzip || c.oci == imgspecv1.MediaTypeImageLayerNonDistributable {
+			urls = []string{"https://example.com/" + d.Hex()}
+		}
+		layers = append(layers, Schema2Descriptor{MediaType: c.schema2, Size: int64(i), Digest: d, URLs: urls})
+		expectedLayers = append(expectedLayers, imgspecv1.Descriptor{MediaType: c.oci, Size: int64(i), Digest: d, URLs: urls})
+	}
+	configBlob := []byte(`{"architecture":"amd64","os":"linux","container":"abcdef","rootfs":{"type":"layers","diff_ids":[]}}`)
+	m := Schema2FromComponents(Schema2Descriptor{
+		MediaType: DockerV2Schema2ConfigMediaType,
+		Size:      int64(len(configBlob)),
+		Digest:    digest.FromBytes(configBlob),
+	}, layers)
+
+	m1, configOCIBytes, err := m.ToOCI1(configBlob)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Size:      int64(len(configOCIBytes)),
+		Digest:    digest.FromBytes(configOCIBytes),
+	}, m1.Config)
+	assert.Equal(t, expectedLayers, m1.Layers)
+	config := map[string]interface{}{}
+	err = json.Unmarshal(configOCIBytes, &config)
+	require.NoError(t, err)
+	assert.Equal(t, "amd64", config["architecture"])
+	assert.NotContains(t, config, "container") // Not a part of the OCI config
+
+	// Invalid config
+	_, _, err = m.ToOCI1([]byte("&"))
+	assert.Error(t, err)
+}
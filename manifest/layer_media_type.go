@@ -0,0 +1,149 @@
+package manifest
+
+import (
+	"strings"
+
+	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// OCI1LayerMediaTypeZstd is the OCI media type of zstd-compressed layers.
+	// It is not defined by the version of the image-spec used here.
+	OCI1LayerMediaTypeZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
+	// OCI1LayerMediaTypeNonDistributableZstd is the OCI media type of zstd-compressed non-distributable layers.
+	OCI1LayerMediaTypeNonDistributableZstd = "application/vnd.oci.image.layer.nondistributable.v1.tar+zstd"
+
+	// ociEncryptedSuffix is the MIME type suffix of encrypted OCI layers, following the suffix of the compression algorithm, if any.
+	ociEncryptedSuffix = "+encrypted"
+)
+
+// LayerMediaType describes the properties of a layer which are recorded in its MIME type.
+type LayerMediaType struct {
+	// Compression is the name of the compression algorithm (compression.Gzip.Name() or compression.Zstd.Name()),
+	// or "" if the layer is not compressed.
+	Compression string
+	// NonDistributable is true for layers which should not be uploaded to other locations
+	// (Docker schema2 foreign layers, OCI non-distributable layers).
+	NonDistributable bool
+	// Encrypted is true for encrypted (OCI) layers; their compression can not be modified.
+	Encrypted bool
+}
+
+// ClassifyLayerMediaType returns the properties of a layer with mimeType, as used in Docker schema2 or OCI manifests.
+func ClassifyLayerMediaType(mimeType string) (LayerMediaType, error) {
+	switch mimeType {
+	case DockerV2Schema2LayerMediaType:
+		return LayerMediaType{Compression: compression.Gzip.Name()}, nil
+	case DockerV2SchemaLayerMediaTypeUncompressed:
+		return LayerMediaType{}, nil
+	case DockerV2Schema2ForeignLayerMediaType:
+		return LayerMediaType{Compression: compression.Gzip.Name(), NonDistributable: true}, nil
+	case DockerV2Schema2ForeignLayerMediaTypeUncompressed:
+		return LayerMediaType{NonDistributable: true}, nil
+	}
+
+	res := LayerMediaType{}
+	base := mimeType
+	if strings.HasSuffix(base, ociEncryptedSuffix) {
+		res.Encrypted = true
+		base = strings.TrimSuffix(base, ociEncryptedSuffix)
+	}
+	for _, algorithm := range []string{compression.Gzip.Name(), compression.Zstd.Name()} {
+		if strings.HasSuffix(base, "+"+algorithm) {
+			res.Compression = algorithm
+			base = strings.TrimSuffix(base, "+"+algorithm)
+			break
+		}
+	}
+	switch base {
+	case imgspecv1.MediaTypeImageLayer:
+	case imgspecv1.MediaTypeImageLayerNonDistributable:
+		res.NonDistributable = true
+	default:
+		return LayerMediaType{}, errors.Errorf("Unknown layer MIME type %q", mimeType)
+	}
+	return res, nil
+}
+
+// Schema2MIMEType returns the Docker schema2 MIME type of a layer with the properties in t.
+func (t LayerMediaType) Schema2MIMEType() (string, error) {
+	if t.Encrypted {
+		return "", errors.Errorf("Encrypted layers are not supported in %s images", DockerV2Schema2MediaType)
+	}
+	switch t.Compression {
+	case "":
+		if t.NonDistributable {
+			return DockerV2Schema2ForeignLayerMediaTypeUncompressed, nil
+		}
+		return DockerV2SchemaLayerMediaTypeUncompressed, nil
+	case compression.Gzip.Name():
+		if t.NonDistributable {
+			return DockerV2Schema2ForeignLayerMediaType, nil
+		}
+		return DockerV2Schema2LayerMediaType, nil
+	default:
+		return "", errors.Errorf("%s compression is not supported in %s images", t.Compression, DockerV2Schema2MediaType)
+	}
+}
+
+// OCI1MIMEType returns the OCI MIME type of a layer with the properties in t.
+func (t LayerMediaType) OCI1MIMEType() (string, error) {
+	res := imgspecv1.MediaTypeImageLayer
+	if t.NonDistributable {
+		res = imgspecv1.MediaTypeImageLayerNonDistributable
+	}
+	switch t.Compression {
+	case "":
+	case compression.Gzip.Name(), compression.Zstd.Name():
+		res += "+" + t.Compression
+	default:
+		return "", errors.Errorf("%s compression is not supported in %s images", t.Compression, imgspecv1.MediaTypeImageManifest)
+	}
+	if t.Encrypted {
+		res += ociEncryptedSuffix
+	}
+	return res, nil
+}
+
+// updatedLayerMediaType returns the properties of a layer originally of mimeType, after the compression and encryption operations recorded in info.
+func updatedLayerMediaType(mimeType string, info types.BlobInfo) (LayerMediaType, error) {
+	t, err := ClassifyLayerMediaType(mimeType)
+	if err != nil {
+		return LayerMediaType{}, errors.Wrap(err, "Error preparing updated manifest")
+	}
+	switch info.CryptoOperation {
+	case types.PreserveOriginalCrypto, types.Encrypt: // Encrypt is handled below, after the compression operation
+	case types.Decrypt:
+		if !t.Encrypted {
+			return LayerMediaType{}, errors.Errorf("Error preparing updated manifest: layer %s is not encrypted, it can not be decrypted", info.Digest)
+		}
+		t.Encrypted = false
+	default:
+		return LayerMediaType{}, errors.Errorf("Error preparing updated manifest: unknown crypto operation %d", info.CryptoOperation)
+	}
+	switch info.CompressionOperation {
+	case types.PreserveOriginal:
+	case types.Decompress:
+		t.Compression = ""
+	case types.Compress:
+		if info.CompressionAlgorithm == nil {
+			return LayerMediaType{}, errors.Errorf("Error preparing updated manifest: unknown compression algorithm of layer %s", info.Digest)
+		}
+		t.Compression = info.CompressionAlgorithm.Name()
+	default:
+		return LayerMediaType{}, errors.Errorf("Error preparing updated manifest: unknown compression operation %d", info.CompressionOperation)
+	}
+	if t.Encrypted && info.CompressionOperation != types.PreserveOriginal {
+		return LayerMediaType{}, errors.Errorf("Error preparing updated manifest: the compression of encrypted layer %s can not be modified", info.Digest)
+	}
+	if info.CryptoOperation == types.Encrypt {
+		if t.Encrypted {
+			return LayerMediaType{}, errors.Errorf("Error preparing updated manifest: layer %s is already encrypted", info.Digest)
+		}
+		t.Encrypted = true
+	}
+	return t, nil
+}
@@ -0,0 +1,158 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyLayerMediaType(t *testing.T) {
+	gzip := compression.Gzip.Name()
+	zstd := compression.Zstd.Name()
+	for _, c := range []struct {
+		mimeType string
+		expected LayerMediaType
+		schema2  string // "" if not representable in schema2
+		oci      string
+	}{
+		{DockerV2Schema2LayerMediaType, LayerMediaType{Compression: gzip}, DockerV2Schema2LayerMediaType, imgspecv1.MediaTypeImageLayerGzip},
+		{DockerV2SchemaLayerMediaTypeUncompressed, LayerMediaType{}, DockerV2SchemaLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayer},
+		{DockerV2Schema2ForeignLayerMediaType, LayerMediaType{Compression: gzip, NonDistributable: true}, DockerV2Schema2ForeignLayerMediaType, imgspecv1.MediaTypeImageLayerNonDistributableGzip},
+		{DockerV2Schema2ForeignLayerMediaTypeUncompressed, LayerMediaType{NonDistributable: true}, DockerV2Schema2ForeignLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayerNonDistributable},
+		{imgspecv1.MediaTypeImageLayer, LayerMediaType{}, DockerV2SchemaLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayer},
+		{imgspecv1.MediaTypeImageLayerGzip, LayerMediaType{Compression: gzip}, DockerV2Schema2LayerMediaType, imgspecv1.MediaTypeImageLayerGzip},
+		{OCI1LayerMediaTypeZstd, LayerMediaType{Compression: zstd}, "", OCI1LayerMediaTypeZstd},
+		{imgspecv1.MediaTypeImageLayerNonDistributable, LayerMediaType{NonDistributable: true}, DockerV2Schema2ForeignLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayerNonDistributable},
+		{imgspecv1.MediaTypeImageLayerNonDistributableGzip, LayerMediaType{Compression: gzip, NonDistributable: true}, DockerV2Schema2ForeignLayerMediaType, imgspecv1.MediaTypeImageLayerNonDistributableGzip},
+		{OCI1LayerMediaTypeNonDistributableZstd, LayerMediaType{Compression: zstd, NonDistributable: true}, "", OCI1LayerMediaTypeNonDistributableZstd},
+		{imgspecv1.MediaTypeImageLayerGzip + "+encrypted", LayerMediaType{Compression: gzip, Encrypted: true}, "", imgspecv1.MediaTypeImageLayerGzip + "+encrypted"},
+		{imgspecv1.MediaTypeImageLayer + "+encrypted", LayerMediaType{Encrypted: true}, "", imgspecv1.MediaTypeImageLayer + "+encrypted"},
+	} {
+		res, err := ClassifyLayerMediaType(c.mimeType)
+		require.NoError(t, err, c.mimeType)
+		assert.Equal(t, c.expected, res, c.mimeType)
+
+		schema2, err := res.Schema2MIMEType()
+		if c.schema2 == "" {
+			assert.Error(t, err, c.mimeType)
+		} else {
+			require.NoError(t, err, c.mimeType)
+			assert.Equal(t, c.schema2, schema2, c.mimeType)
+		}
+		oci, err := res.OCI1MIMEType()
+		require.NoError(t, err, c.mimeType)
+		assert.Equal(t, c.oci, oci, c.mimeType)
+	}
+
+	for _, mimeType := range []string{
+		"",
+		DockerV2Schema2ConfigMediaType,
+		imgspecv1.MediaTypeImageConfig,
+		imgspecv1.MediaTypeImageLayer + "+bzip2",
+		imgspecv1.MediaTypeImageLayerGzip + "+gzip",
+		"application/vnd.example.unknown+gzip",
+	} {
+		_, err := ClassifyLayerMediaType(mimeType)
+		assert.Error(t, err, mimeType)
+	}
+
+	_, err := LayerMediaType{Compression: compression.Xz.Name()}.OCI1MIMEType()
+	assert.Error(t, err)
+}
+
+func TestUpdatedLayerMIMEType(t *testing.T) {
+	for _, c := range []struct {
+		mimeType  string
+		operation types.LayerCompression
+		schema2   string // "" if an error is expected
+		oci       string // "" if an error is expected
+	}{
+		{DockerV2Schema2LayerMediaType, types.Decompress, DockerV2SchemaLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayer},
+		{DockerV2SchemaLayerMediaTypeUncompressed, types.Compress, DockerV2Schema2LayerMediaType, imgspecv1.MediaTypeImageLayerGzip},
+		{DockerV2Schema2ForeignLayerMediaType, types.Decompress, DockerV2Schema2ForeignLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayerNonDistributable},
+		{DockerV2Schema2ForeignLayerMediaTypeUncompressed, types.Compress, DockerV2Schema2ForeignLayerMediaType, imgspecv1.MediaTypeImageLayerNonDistributableGzip},
+		{imgspecv1.MediaTypeImageLayerGzip, types.Decompress, DockerV2SchemaLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayer},
+		{imgspecv1.MediaTypeImageLayer, types.Compress, DockerV2Schema2LayerMediaType, imgspecv1.MediaTypeImageLayerGzip},
+		{OCI1LayerMediaTypeZstd, types.Decompress, DockerV2SchemaLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayer},
+		{OCI1LayerMediaTypeZstd, types.Compress, DockerV2Schema2LayerMediaType, imgspecv1.MediaTypeImageLayerGzip},
+		{OCI1LayerMediaTypeNonDistributableZstd, types.Compress, DockerV2Schema2ForeignLayerMediaType, imgspecv1.MediaTypeImageLayerNonDistributableGzip},
+		// The compression of encrypted layers can not be modified
+		{imgspecv1.MediaTypeImageLayerGzip + "+encrypted", types.Decompress, "", ""},
+		{imgspecv1.MediaTypeImageLayer + "+encrypted", types.Compress, "", ""},
+		// Unknown MIME types can only be preserved
+		{"application/vnd.example.unknown", types.Decompress, "", ""},
+		{"application/vnd.example.unknown", types.Compress, "", ""},
+		{"application/vnd.example.unknown", types.PreserveOriginal, "application/vnd.example.unknown", "application/vnd.example.unknown"},
+		// Invalid compression operation
+		{imgspecv1.MediaTypeImageLayerGzip, types.LayerCompression(42), "", ""},
+	} {
+		info := types.BlobInfo{CompressionOperation: c.operation}
+		if c.operation == types.Compress {
+			info.CompressionAlgorithm = &compression.Gzip
+		}
+		schema2, err := updatedSchema2LayerMIMEType(c.mimeType, info)
+		if c.schema2 == "" {
+			assert.Error(t, err, c.mimeType)
+		} else {
+			require.NoError(t, err, c.mimeType)
+			assert.Equal(t, c.schema2, schema2, c.mimeType)
+		}
+		oci, err := updatedOCI1LayerMIMEType(c.mimeType, info)
+		if c.oci == "" {
+			assert.Error(t, err, c.mimeType)
+		} else {
+			require.NoError(t, err, c.mimeType)
+			assert.Equal(t, c.oci, oci, c.mimeType)
+		}
+	}
+
+	// zstd compression is only supported in OCI
+	zstdInfo := types.BlobInfo{CompressionOperation: types.Compress, CompressionAlgorithm: &compression.Zstd}
+	oci, err := updatedOCI1LayerMIMEType(imgspecv1.MediaTypeImageLayer, zstdInfo)
+	require.NoError(t, err)
+	assert.Equal(t, OCI1LayerMediaTypeZstd, oci)
+	_, err = updatedSchema2LayerMIMEType(DockerV2SchemaLayerMediaTypeUncompressed, zstdInfo)
+	assert.Error(t, err)
+
+	// Compression using an unknown or unsupported algorithm
+	_, err = updatedOCI1LayerMIMEType(imgspecv1.MediaTypeImageLayer, types.BlobInfo{CompressionOperation: types.Compress})
+	assert.Error(t, err)
+	_, err = updatedOCI1LayerMIMEType(imgspecv1.MediaTypeImageLayer, types.BlobInfo{CompressionOperation: types.Compress, CompressionAlgorithm: &compression.Xz})
+	assert.Error(t, err)
+	_, err = updatedSchema2LayerMIMEType(DockerV2SchemaLayerMediaTypeUncompressed, types.BlobInfo{CompressionOperation: types.Compress, CompressionAlgorithm: &compression.Xz})
+	assert.Error(t, err)
+
+	// Encryption and decryption
+	gzipEncrypted := imgspecv1.MediaTypeImageLayerGzip + "+encrypted"
+	for _, c := range []struct {
+		mimeType string
+		info     types.BlobInfo
+		oci      string // "" if an error is expected
+	}{
+		{imgspecv1.MediaTypeImageLayerGzip, types.BlobInfo{CryptoOperation: types.Encrypt}, gzipEncrypted},
+		{imgspecv1.MediaTypeImageLayer, types.BlobInfo{CompressionOperation: types.Compress, CompressionAlgorithm: &compression.Gzip, CryptoOperation: types.Encrypt}, gzipEncrypted},
+		{gzipEncrypted, types.BlobInfo{CryptoOperation: types.Decrypt}, imgspecv1.MediaTypeImageLayerGzip},
+		{gzipEncrypted, types.BlobInfo{CompressionOperation: types.Decompress, CryptoOperation: types.Decrypt}, imgspecv1.MediaTypeImageLayer},
+		// Already encrypted
+		{gzipEncrypted, types.BlobInfo{CryptoOperation: types.Encrypt}, ""},
+		// Not encrypted
+		{imgspecv1.MediaTypeImageLayerGzip, types.BlobInfo{CryptoOperation: types.Decrypt}, ""},
+		// Invalid crypto operation
+		{imgspecv1.MediaTypeImageLayerGzip, types.BlobInfo{CryptoOperation: types.LayerCrypto(42)}, ""},
+	} {
+		oci, err := updatedOCI1LayerMIMEType(c.mimeType, c.info)
+		if c.oci == "" {
+			assert.Error(t, err, c.mimeType)
+		} else {
+			require.NoError(t, err, c.mimeType)
+			assert.Equal(t, c.oci, oci, c.mimeType)
+		}
+	}
+	// Encrypted layers are not supported in schema2
+	_, err = updatedSchema2LayerMIMEType(DockerV2Schema2LayerMediaType, types.BlobInfo{CryptoOperation: types.Encrypt})
+	assert.Error(t, err)
+}
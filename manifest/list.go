@@ -0,0 +1,238 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// List is an interface for parsing and modifying lists of image manifests
+// (Docker schema2 manifest lists and OCI image indexes).
+// Callers can either use this abstract interface without understanding the details of the formats,
+// or instantiate a specific implementation (e.g. manifest.OCI1Index) and access the public members
+// directly.
+type List interface {
+	// MIMEType returns the MIME type of this particular manifest list.
+	MIMEType() string
+	// Instances returns a list of the manifests this list references, in order.
+	Instances() []ListInstance
+	// UpdateInstances updates the digests, sizes and MIME types of the referenced manifests, and removes
+	// the manifests for which the corresponding element of updates is nil.
+	// updates must contain exactly one element for each of Instances(), in the same order.
+	UpdateInstances(updates []*ListUpdate) error
+	// ChooseInstance returns the digest of the manifest appropriate for the platform described by sys
+	// (or the current system, for values not set in sys).
+	ChooseInstance(sys *types.SystemContext) (digest.Digest, error)
+	// Serialize returns the list in a blob format.
+	// NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
+	Serialize() ([]byte, error)
+}
+
+// ListInstance describes a manifest referenced by a List.
+type ListInstance struct {
+	Digest    digest.Digest
+	Size      int64
+	MediaType string
+	Platform  *imgspecv1.Platform // nil if the list does not say which platform the manifest is for.
+}
+
+// ListUpdate is an update of a manifest referenced by a List; see List.UpdateInstances.
+type ListUpdate struct {
+	Digest    digest.Digest
+	Size      int64
+	MediaType string
+}
+
+// chooseInstance returns the digest of the first of instances appropriate for the platform described by sys
+// (or the current system, for values not set in sys).
+func chooseInstance(instances []ListInstance, sys *types.SystemContext) (digest.Digest, error) {
+	wantedArch := runtime.GOARCH
+	if sys != nil && sys.ArchitectureChoice != "" {
+		wantedArch = sys.ArchitectureChoice
+	}
+	wantedOS := runtime.GOOS
+	if sys != nil && sys.OSChoice != "" {
+		wantedOS = sys.OSChoice
+	}
+
+	for _, instance := range instances {
+		if instance.Platform != nil && instance.Platform.Architecture == wantedArch && instance.Platform.OS == wantedOS {
+			return instance.Digest, nil
+		}
+	}
+	return "", fmt.Errorf("no image found in manifest list for architecture %s, OS %s", wantedArch, wantedOS)
+}
+
+// Schema2PlatformSpec describes the platform which a particular manifest in a Schema2List is specialized for.
+type Schema2PlatformSpec struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+	Features     []string `json:"features,omitempty"` // removed in OCI
+}
+
+// Schema2ManifestDescriptor references a platform-specific manifest in a Schema2List.
+type Schema2ManifestDescriptor struct {
+	Schema2Descriptor
+	Platform Schema2PlatformSpec `json:"platform"`
+}
+
+// Schema2List is a list of platform-specific manifests in docker/distribution schema 2.
+type Schema2List struct {
+	SchemaVersion int                         `json:"schemaVersion"`
+	MediaType     string                      `json:"mediaType"`
+	Manifests     []Schema2ManifestDescriptor `json:"manifests"`
+}
+
+// Schema2ListFromManifest creates a Schema2List instance from a manifest list blob.
+func Schema2ListFromManifest(manifest []byte) (*Schema2List, error) {
+	list := Schema2List{}
+	if err := json.Unmarshal(manifest, &list); err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling Schema2List")
+	}
+	return &list, nil
+}
+
+// MIMEType returns the MIME type of this particular manifest list.
+func (list *Schema2List) MIMEType() string {
+	return DockerV2ListMediaType
+}
+
+// Instances returns a list of the manifests this list references, in order.
+func (list *Schema2List) Instances() []ListInstance {
+	res := make([]ListInstance, 0, len(list.Manifests))
+	for _, m := range list.Manifests {
+		res = append(res, ListInstance{
+			Digest:    m.Digest,
+			Size:      m.Size,
+			MediaType: m.MediaType,
+			Platform: &imgspecv1.Platform{
+				Architecture: m.Platform.Architecture,
+				OS:           m.Platform.OS,
+				OSVersion:    m.Platform.OSVersion,
+				OSFeatures:   m.Platform.OSFeatures,
+				Variant:      m.Platform.Variant,
+			},
+		})
+	}
+	return res
+}
+
+// UpdateInstances updates the digests, sizes and MIME types of the referenced manifests, and removes
+// the manifests for which the corresponding element of updates is nil.
+func (list *Schema2List) UpdateInstances(updates []*ListUpdate) error {
+	if len(updates) != len(list.Manifests) {
+		return errors.Errorf("incorrect number of update entries passed to Schema2List.UpdateInstances: expected %d, got %d", len(list.Manifests), len(updates))
+	}
+	manifests := []Schema2ManifestDescriptor{}
+	for i, update := range updates {
+		if update == nil {
+			continue
+		}
+		m := list.Manifests[i]
+		m.Digest = update.Digest
+		m.Size = update.Size
+		m.MediaType = update.MediaType
+		manifests = append(manifests, m)
+	}
+	list.Manifests = manifests
+	return nil
+}
+
+// ChooseInstance returns the digest of the manifest appropriate for the platform described by sys
+// (or the current system, for values not set in sys).
+func (list *Schema2List) ChooseInstance(sys *types.SystemContext) (digest.Digest, error) {
+	return chooseInstance(list.Instances(), sys)
+}
+
+// Serialize returns the list in a blob format.
+func (list *Schema2List) Serialize() ([]byte, error) {
+	return json.Marshal(*list)
+}
+
+// OCI1Index is a List implementation for OCI image indexes.
+// The underlying data from imgspecv1.Index is also available.
+type OCI1Index struct {
+	imgspecv1.Index
+}
+
+// OCI1IndexFromManifest creates an OCI1Index instance from an image index blob.
+func OCI1IndexFromManifest(manifest []byte) (*OCI1Index, error) {
+	index := OCI1Index{}
+	if err := json.Unmarshal(manifest, &index); err != nil {
+		return nil, errors.Wrap(err, "Error unmarshaling OCI1Index")
+	}
+	return &index, nil
+}
+
+// MIMEType returns the MIME type of this particular manifest list.
+func (index *OCI1Index) MIMEType() string {
+	return imgspecv1.MediaTypeImageIndex
+}
+
+// Instances returns a list of the manifests this list references, in order.
+func (index *OCI1Index) Instances() []ListInstance {
+	res := make([]ListInstance, 0, len(index.Manifests))
+	for _, m := range index.Manifests {
+		res = append(res, ListInstance{
+			Digest:    m.Digest,
+			Size:      m.Size,
+			MediaType: m.MediaType,
+			Platform:  m.Platform,
+		})
+	}
+	return res
+}
+
+// UpdateInstances updates the digests, sizes and MIME types of the referenced manifests, and removes
+// the manifests for which the corresponding element of updates is nil.
+func (index *OCI1Index) UpdateInstances(updates []*ListUpdate) error {
+	if len(updates) != len(index.Manifests) {
+		return errors.Errorf("incorrect number of update entries passed to OCI1Index.UpdateInstances: expected %d, got %d", len(index.Manifests), len(updates))
+	}
+	manifests := []imgspecv1.Descriptor{}
+	for i, update := range updates {
+		if update == nil {
+			continue
+		}
+		m := index.Manifests[i]
+		m.Digest = update.Digest
+		m.Size = update.Size
+		m.MediaType = update.MediaType
+		manifests = append(manifests, m)
+	}
+	index.Manifests = manifests
+	return nil
+}
+
+// ChooseInstance returns the digest of the manifest appropriate for the platform described by sys
+// (or the current system, for values not set in sys).
+func (index *OCI1Index) ChooseInstance(sys *types.SystemContext) (digest.Digest, error) {
+	return chooseInstance(index.Instances(), sys)
+}
+
+// Serialize returns the list in a blob format.
+func (index *OCI1Index) Serialize() ([]byte, error) {
+	return json.Marshal(*index)
+}
+
+// ListFromBlob returns a List instance for the specified manifest list blob and the corresponding MIME type.
+func ListFromBlob(manblob []byte, mt string) (List, error) {
+	switch NormalizedMIMEType(mt) {
+	case DockerV2ListMediaType:
+		return Schema2ListFromManifest(manblob)
+	case imgspecv1.MediaTypeImageIndex:
+		return OCI1IndexFromManifest(manblob)
+	case DockerV2Schema1MediaType, DockerV2Schema1SignedMediaType, imgspecv1.MediaTypeImageManifest, DockerV2Schema2MediaType:
+		return nil, fmt.Errorf("Treating single images as manifest lists is not implemented")
+	default: // Note that this may not be reachable, NormalizedMIMEType has a default for unknown values.
+		return nil, fmt.Errorf("Unimplemented manifest list MIME type %s", mt)
+	}
+}
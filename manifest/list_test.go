@@ -0,0 +1,138 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListFromBlob(t *testing.T) {
+	for _, c := range []struct {
+		path      string
+		mimeType  string
+		instances []ListInstance
+	}{
+		{
+			"v2list.manifest.json", DockerV2ListMediaType, []ListInstance{
+				{
+					Digest: "sha256:7820f9a86d4ad15a2c4f0c0e5479298df2aa7c2f6871288e2ef8546f3e7b6783", Size: 2094, MediaType: DockerV2Schema1MediaType,
+					Platform: &imgspecv1.Platform{Architecture: "ppc64le", OS: "linux"},
+				},
+				{
+					Digest: "sha256:ae1b0e06e8ade3a11267564a26e750585ba2259c0ecab59ab165ad1af41d1bdd", Size: 1922, MediaType: DockerV2Schema1MediaType,
+					Platform: &imgspecv1.Platform{Architecture: "amd64", OS: "linux"},
+				},
+				{
+					Digest: "sha256:e4c0df75810b953d6717b8f8f28298d73870e8aa2a0d5e77b8391f16fdfbbbe2", Size: 2084, MediaType: DockerV2Schema1MediaType,
+					Platform: &imgspecv1.Platform{Architecture: "s390x", OS: "linux"},
+				},
+				{
+					Digest: "sha256:07ebe243465ef4a667b78154ae6c3ea46fdb1582936aac3ac899ea311a701b40", Size: 2084, MediaType: DockerV2Schema1MediaType,
+					Platform: &imgspecv1.Platform{Architecture: "arm", OS: "linux", Variant: "armv7"},
+				},
+				{
+					Digest: "sha256:fb2fc0707b86dafa9959fe3d29e66af8787aee4d9a23581714be65db4265ad8a", Size: 2090, MediaType: DockerV2Schema1MediaType,
+					Platform: &imgspecv1.Platform{Architecture: "arm64", OS: "linux", Variant: "armv8"},
+				},
+			},
+		},
+		{
+			"ociv1.image.index.json", imgspecv1.MediaTypeImageIndex, []ListInstance{
+				{
+					Digest: "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f", Size: 7143, MediaType: imgspecv1.MediaTypeImageManifest,
+					Platform: &imgspecv1.Platform{Architecture: "ppc64le", OS: "linux"},
+				},
+				{
+					Digest: "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270", Size: 7682, MediaType: imgspecv1.MediaTypeImageManifest,
+					Platform: &imgspecv1.Platform{Architecture: "amd64", OS: "linux", OSFeatures: []string{"sse4"}},
+				},
+			},
+		},
+	} {
+		blob, err := ioutil.ReadFile(filepath.Join("fixtures", c.path))
+		require.NoError(t, err, c.path)
+		list, err := ListFromBlob(blob, c.mimeType)
+		require.NoError(t, err, c.path)
+		assert.Equal(t, c.mimeType, list.MIMEType(), c.path)
+		assert.Equal(t, c.instances, list.Instances(), c.path)
+
+		// Serialization round-trips
+		serialized, err := list.Serialize()
+		require.NoError(t, err, c.path)
+		list2, err := ListFromBlob(serialized, c.mimeType)
+		require.NoError(t, err, c.path)
+		assert.Equal(t, list, list2, c.path)
+
+		// Updating and removing instances
+		err = list.UpdateInstances(make([]*ListUpdate, len(c.instances)-1))
+		assert.Error(t, err, c.path)
+		updates := make([]*ListUpdate, len(c.instances))
+		updated := ListUpdate{Digest: digest.FromString("updated"), Size: 42, MediaType: "application/x-updated"}
+		updates[1] = &updated
+		err = list.UpdateInstances(updates)
+		require.NoError(t, err, c.path)
+		expected := c.instances[1]
+		expected.Digest, expected.Size, expected.MediaType = updated.Digest, updated.Size, updated.MediaType
+		assert.Equal(t, []ListInstance{expected}, list.Instances(), c.path)
+	}
+
+	// Single images are not lists
+	blob, err := ioutil.ReadFile(filepath.Join("fixtures", "v2s2.manifest.json"))
+	require.NoError(t, err)
+	_, err = ListFromBlob(blob, DockerV2Schema2MediaType)
+	assert.Error(t, err)
+	// Invalid JSON
+	_, err = ListFromBlob([]byte("&"), DockerV2ListMediaType)
+	assert.Error(t, err)
+	_, err = ListFromBlob([]byte("&"), imgspecv1.MediaTypeImageIndex)
+	assert.Error(t, err)
+}
+
+func TestListChooseInstance(t *testing.T) {
+	for _, c := range []struct {
+		path      string
+		mimeType  string
+		matches   map[string]digest.Digest
+		unmatched []string
+	}{
+		{
+			"v2list.manifest.json", DockerV2ListMediaType,
+			map[string]digest.Digest{
+				"amd64": "sha256:ae1b0e06e8ade3a11267564a26e750585ba2259c0ecab59ab165ad1af41d1bdd",
+				"s390x": "sha256:e4c0df75810b953d6717b8f8f28298d73870e8aa2a0d5e77b8391f16fdfbbbe2",
+				"arm":   "sha256:07ebe243465ef4a667b78154ae6c3ea46fdb1582936aac3ac899ea311a701b40",
+			},
+			[]string{"unmatched"},
+		},
+		{
+			"ociv1.image.index.json", imgspecv1.MediaTypeImageIndex,
+			map[string]digest.Digest{
+				"amd64":   "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+				"ppc64le": "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+			},
+			[]string{"unmatched", "s390x"},
+		},
+	} {
+		blob, err := ioutil.ReadFile(filepath.Join("fixtures", c.path))
+		require.NoError(t, err, c.path)
+		list, err := ListFromBlob(blob, c.mimeType)
+		require.NoError(t, err, c.path)
+		for arch, expected := range c.matches {
+			d, err := list.ChooseInstance(&types.SystemContext{ArchitectureChoice: arch, OSChoice: "linux"})
+			require.NoError(t, err, arch)
+			assert.Equal(t, expected, d, arch)
+		}
+		for _, arch := range c.unmatched {
+			_, err := list.ChooseInstance(&types.SystemContext{ArchitectureChoice: arch, OSChoice: "linux"})
+			assert.Error(t, err, arch)
+		}
+		_, err = list.ChooseInstance(&types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "unmatched"})
+		assert.Error(t, err, c.path)
+	}
+}
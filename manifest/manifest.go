@@ -1,6 +1,7 @@
 package manifest
 
 import (
+	_ "crypto/sha512" // Make digest.SHA384 and digest.SHA512 available.
 	"encoding/json"
 	"fmt"
 
@@ -28,16 +29,22 @@ const (
 	DockerV2ListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
 	// DockerV2Schema2ForeignLayerMediaType is the MIME type used for schema 2 foreign layers.
 	DockerV2Schema2ForeignLayerMediaType = "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"
+	// DockerV2SchemaLayerMediaTypeUncompressed is the MIME type used for uncompressed schema 2 layers.
+	DockerV2SchemaLayerMediaTypeUncompressed = "application/vnd.docker.image.rootfs.diff.tar"
+	// DockerV2Schema2ForeignLayerMediaTypeUncompressed is the MIME type used for uncompressed schema 2 foreign layers.
+	DockerV2Schema2ForeignLayerMediaTypeUncompressed = "application/vnd.docker.image.rootfs.foreign.diff.tar"
 )
 
 // DefaultRequestedManifestMIMETypes is a list of MIME types a types.ImageSource
-// should request from the backend unless directed otherwise.
+// should request from the backend unless directed otherwise, in order of preference.
+// Registries are free to ignore the list (or the order), so the MIME type of the returned manifest must always be checked.
 var DefaultRequestedManifestMIMETypes = []string{
-	imgspecv1.MediaTypeImageManifest,
 	DockerV2Schema2MediaType,
+	imgspecv1.MediaTypeImageManifest,
+	DockerV2ListMediaType,
+	imgspecv1.MediaTypeImageIndex,
 	DockerV2Schema1SignedMediaType,
 	DockerV2Schema1MediaType,
-	DockerV2ListMediaType,
 }
 
 // Manifest is an interface for parsing, modifying image manifests in isolation.
@@ -137,6 +144,15 @@ func GuessMIMEType(manifest []byte) string {
 
 // Digest returns the a digest of a docker manifest, with any necessary implied transformations like stripping v1s1 signatures.
 func Digest(manifest []byte) (digest.Digest, error) {
+	return DigestWithAlgorithm(manifest, digest.Canonical)
+}
+
+// DigestWithAlgorithm returns a digest of a docker manifest, with any necessary implied transformations like stripping v1s1 signatures,
+// using the specified digest algorithm.
+func DigestWithAlgorithm(manifest []byte, algorithm digest.Algorithm) (digest.Digest, error) {
+	if !algorithm.Available() {
+		return "", fmt.Errorf("Digest algorithm %q is not available", algorithm)
+	}
 	if GuessMIMEType(manifest) == DockerV2Schema1SignedMediaType {
 		sig, err := libtrust.ParsePrettySignature(manifest, "signatures")
 		if err != nil {
@@ -150,7 +166,7 @@ func Digest(manifest []byte) (digest.Digest, error) {
 		}
 	}
 
-	return digest.FromBytes(manifest), nil
+	return algorithm.FromBytes(manifest), nil
 }
 
 // MatchesDigest returns true iff the manifest matches expectedDigest.
@@ -158,8 +174,11 @@ func Digest(manifest []byte) (digest.Digest, error) {
 // Note that this is not doing ConstantTimeCompare; by the time we get here, the cryptographic signature must already have been verified,
 // or we are not using a cryptographic channel and the attacker can modify the digest along with the manifest blob.
 func MatchesDigest(manifest []byte, expectedDigest digest.Digest) (bool, error) {
-	// This should eventually support various digest types.
-	actualDigest, err := Digest(manifest)
+	// A digest in an invalid format, or using an unsupported algorithm, can never match.
+	if err := expectedDigest.Validate(); err != nil {
+		return false, nil
+	}
+	actualDigest, err := DigestWithAlgorithm(manifest, expectedDigest.Algorithm())
 	if err != nil {
 		return false, err
 	}
@@ -184,9 +203,27 @@ func AddDummyV2S1Signature(manifest []byte) ([]byte, error) {
 	return js.PrettySignature("signatures")
 }
 
+// VerifyV2S1Signatures verifies the embedded JWS signatures of a signed v2s1 manifest, and returns the public keys
+// which created them.  It fails if the manifest is not signed, or if any of the signatures is invalid.
+// Note that this only checks that the signatures are valid; it is up to the caller to decide whether the keys are trusted.
+func VerifyV2S1Signatures(manifest []byte) ([]libtrust.PublicKey, error) {
+	if GuessMIMEType(manifest) != DockerV2Schema1SignedMediaType {
+		return nil, fmt.Errorf("Manifest is not a signed Docker schema1 manifest")
+	}
+	sig, err := libtrust.ParsePrettySignature(manifest, "signatures")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := sig.Verify()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid JWS signature of a Docker schema1 manifest: %v", err)
+	}
+	return keys, nil
+}
+
 // MIMETypeIsMultiImage returns true if mimeType is a list of images
 func MIMETypeIsMultiImage(mimeType string) bool {
-	return mimeType == DockerV2ListMediaType
+	return mimeType == DockerV2ListMediaType || mimeType == imgspecv1.MediaTypeImageIndex
 }
 
 // NormalizedMIMEType returns the effective MIME type of a manifest MIME type returned by a server,
@@ -200,6 +237,7 @@ func NormalizedMIMEType(input string) string {
 		return DockerV2Schema1SignedMediaType
 	case DockerV2Schema1MediaType, DockerV2Schema1SignedMediaType,
 		imgspecv1.MediaTypeImageManifest,
+		imgspecv1.MediaTypeImageIndex,
 		DockerV2Schema2MediaType,
 		DockerV2ListMediaType:
 		return input
@@ -226,7 +264,7 @@ func FromBlob(manblob []byte, mt string) (Manifest, error) {
 		return OCI1FromManifest(manblob)
 	case DockerV2Schema2MediaType:
 		return Schema2FromManifest(manblob)
-	case DockerV2ListMediaType:
+	case DockerV2ListMediaType, imgspecv1.MediaTypeImageIndex:
 		return nil, fmt.Errorf("Treating manifest lists as individual manifests is not implemented")
 	default: // Note that this may not be reachable, NormalizedMIMEType has a default for unknown values.
 		return nil, fmt.Errorf("Unimplemented manifest MIME type %s", mt)
@@ -1,6 +1,7 @@
 package manifest
 
 import (
+	"bytes"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
@@ -69,7 +70,42 @@ func TestDigest(t *testing.T) {
 	assert.Equal(t, digest.Digest(digestSha256EmptyTar), actualDigest)
 }
 
+func TestDigestWithAlgorithm(t *testing.T) {
+	for _, algo := range []digest.Algorithm{digest.SHA256, digest.SHA384, digest.SHA512} {
+		for _, path := range []string{"v2s2.manifest.json", "v2s1-unsigned.manifest.json"} {
+			manifest, err := ioutil.ReadFile(filepath.Join("fixtures", path))
+			require.NoError(t, err)
+			actualDigest, err := DigestWithAlgorithm(manifest, algo)
+			require.NoError(t, err)
+			assert.Equal(t, algo.FromBytes(manifest), actualDigest)
+		}
+
+		// The JSON signature is stripped from signed schema1 manifests
+		manifest, err := ioutil.ReadFile("fixtures/v2s1.manifest.json")
+		require.NoError(t, err)
+		unsignedManifest, err := ioutil.ReadFile("fixtures/v2s1-unsigned.manifest.json")
+		require.NoError(t, err)
+		actualDigest, err := DigestWithAlgorithm(manifest, algo)
+		require.NoError(t, err)
+		assert.Equal(t, algo.FromBytes(unsignedManifest), actualDigest)
+	}
+
+	// Unavailable algorithm
+	_, err := DigestWithAlgorithm([]byte{}, digest.Algorithm("md5"))
+	assert.Error(t, err)
+
+	manifest, err := ioutil.ReadFile("fixtures/v2s1-invalid-signatures.manifest.json")
+	require.NoError(t, err)
+	_, err = DigestWithAlgorithm(manifest, digest.SHA512)
+	assert.Error(t, err)
+}
+
 func TestMatchesDigest(t *testing.T) {
+	v2s2Manifest, err := ioutil.ReadFile("fixtures/v2s2.manifest.json")
+	require.NoError(t, err)
+	v2s1UnsignedManifest, err := ioutil.ReadFile("fixtures/v2s1-unsigned.manifest.json")
+	require.NoError(t, err)
+
 	cases := []struct {
 		path           string
 		expectedDigest digest.Digest
@@ -81,6 +117,10 @@ func TestMatchesDigest(t *testing.T) {
 		// No match (switched s1/s2)
 		{"v2s2.manifest.json", TestDockerV2S1ManifestDigest, false},
 		{"v2s1.manifest.json", TestDockerV2S2ManifestDigest, false},
+		// Other algorithms
+		{"v2s2.manifest.json", digest.SHA512.FromBytes(v2s2Manifest), true},
+		{"v2s1.manifest.json", digest.SHA384.FromBytes(v2s1UnsignedManifest), true},
+		{"v2s1.manifest.json", digest.SHA512.FromBytes(v2s2Manifest), false},
 		// Unrecognized algorithm
 		{"v2s2.manifest.json", digest.Digest("md5:2872f31c5c1f62a694fbd20c1e85257c"), false},
 		// Mangled format
@@ -125,15 +165,44 @@ func TestAddDummyV2S1Signature(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestVerifyV2S1Signatures(t *testing.T) {
+	manifest, err := ioutil.ReadFile("fixtures/v2s1.manifest.json")
+	require.NoError(t, err)
+	keys, err := VerifyV2S1Signatures(manifest)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	unsigned, err := ioutil.ReadFile("fixtures/v2s1-unsigned.manifest.json")
+	require.NoError(t, err)
+	signed, err := AddDummyV2S1Signature(unsigned)
+	require.NoError(t, err)
+	keys, err = VerifyV2S1Signatures(signed)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "EC", keys[0].KeyType())
+
+	// Unsigned or tampered-with manifests, or other manifest types, are rejected
+	for _, m := range [][]byte{
+		unsigned,
+		bytes.Replace(signed, []byte(`"architecture": "amd64"`), []byte(`"architecture": "arm64"`), 1),
+		[]byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`),
+	} {
+		_, err := VerifyV2S1Signatures(m)
+		assert.Error(t, err, string(m))
+	}
+}
+
 func TestMIMETypeIsMultiImage(t *testing.T) {
 	for _, c := range []struct {
 		mt       string
 		expected bool
 	}{
 		{DockerV2ListMediaType, true},
+		{imgspecv1.MediaTypeImageIndex, true},
 		{DockerV2Schema1MediaType, false},
 		{DockerV2Schema1SignedMediaType, false},
 		{DockerV2Schema2MediaType, false},
+		{imgspecv1.MediaTypeImageManifest, false},
 	} {
 		res := MIMETypeIsMultiImage(c.mt)
 		assert.Equal(t, c.expected, res, c.mt)
@@ -147,6 +216,7 @@ func TestNormalizedMIMEType(t *testing.T) {
 		DockerV2Schema2MediaType,
 		DockerV2ListMediaType,
 		imgspecv1.MediaTypeImageManifest,
+		imgspecv1.MediaTypeImageIndex,
 	} {
 		res := NormalizedMIMEType(c)
 		assert.Equal(t, c, res, c)
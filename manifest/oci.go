@@ -81,7 +81,11 @@ func (m *OCI1) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	original := m.Layers
 	m.Layers = make([]imgspecv1.Descriptor, len(layerInfos))
 	for i, info := range layerInfos {
-		m.Layers[i].MediaType = original[i].MediaType
+		mimeType, err := updatedOCI1LayerMIMEType(original[i].MediaType, info)
+		if err != nil {
+			return err
+		}
+		m.Layers[i].MediaType = mimeType
 		m.Layers[i].Digest = info.Digest
 		m.Layers[i].Size = info.Size
 		m.Layers[i].Annotations = info.Annotations
@@ -90,6 +94,84 @@ func (m *OCI1) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	return nil
 }
 
+// UpdateAnnotations removes the manifest annotations with keys in remove, and then sets the annotations in set,
+// replacing existing values. It returns true iff the annotations were modified; if not, the manifest
+// can be used in its original form, with the original digest.
+func (m *OCI1) UpdateAnnotations(set map[string]string, remove []string) bool {
+	annotations, changed := updatedAnnotations(m.Annotations, set, remove)
+	m.Annotations = annotations
+	return changed
+}
+
+// UpdateLayerAnnotations is like UpdateAnnotations, but updates the annotations of the layer with index.
+func (m *OCI1) UpdateLayerAnnotations(index int, set map[string]string, remove []string) (bool, error) {
+	if index < 0 || index >= len(m.Layers) {
+		return false, errors.Errorf("Layer index %d out of range, the manifest has %d layers", index, len(m.Layers))
+	}
+	annotations, changed := updatedAnnotations(m.Layers[index].Annotations, set, remove)
+	if changed {
+		// m.Layers may be shared with a clone of m; see OCI1Clone.
+		layers := make([]imgspecv1.Descriptor, len(m.Layers))
+		copy(layers, m.Layers)
+		layers[index].Annotations = annotations
+		m.Layers = layers
+	}
+	return changed, nil
+}
+
+// updatedAnnotations returns original with the annotations with keys in remove removed and the annotations in set set,
+// and true if that differs from original.
+// original is never modified, it may be shared with other manifest objects.
+func updatedAnnotations(original map[string]string, set map[string]string, remove []string) (map[string]string, bool) {
+	changed := false
+	for _, k := range remove {
+		_, present := original[k]
+		_, reset := set[k] // Handled below
+		if present && !reset {
+			changed = true
+		}
+	}
+	for k, v := range set {
+		if current, ok := original[k]; !ok || current != v {
+			changed = true
+		}
+	}
+	if !changed {
+		return original, false
+	}
+
+	res := map[string]string{}
+	for k, v := range original {
+		res[k] = v
+	}
+	for _, k := range remove {
+		delete(res, k)
+	}
+	for k, v := range set {
+		res[k] = v
+	}
+	if len(res) == 0 {
+		res = nil
+	}
+	return res, true
+}
+
+// updatedOCI1LayerMIMEType returns the MIME type of a layer originally of mimeType, after the compression and encryption operations recorded in info.
+func updatedOCI1LayerMIMEType(mimeType string, info types.BlobInfo) (string, error) {
+	if info.CompressionOperation == types.PreserveOriginal && info.CryptoOperation == types.PreserveOriginalCrypto {
+		return mimeType, nil
+	}
+	t, err := updatedLayerMediaType(mimeType, info)
+	if err != nil {
+		return "", err
+	}
+	res, err := t.OCI1MIMEType()
+	if err != nil {
+		return "", errors.Wrap(err, "Error preparing updated manifest")
+	}
+	return res, nil
+}
+
 // Serialize returns the manifest in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
 func (m *OCI1) Serialize() ([]byte, error) {
@@ -116,10 +198,48 @@ func (m *OCI1) Inspect(configGetter func(types.BlobInfo) ([]byte, error)) (*type
 		Architecture:  v1.Architecture,
 		Os:            v1.OS,
 		Layers:        layerInfosToStrings(m.LayerInfos()),
+		Env:           v1.Config.Env,
+		Entrypoint:    v1.Config.Entrypoint,
+		Cmd:           v1.Config.Cmd,
 	}
 	return i, nil
 }
 
+// ToSchema2 returns a schema2 manifest equivalent to m. The OCI config blob can be used unmodified as the schema2 config.
+// Annotations, which can not be represented in schema2, are dropped.
+func (m *OCI1) ToSchema2() (*Schema2, error) {
+	config := Schema2Descriptor{
+		MediaType: DockerV2Schema2ConfigMediaType,
+		Size:      m.Config.Size,
+		Digest:    m.Config.Digest,
+		URLs:      m.Config.URLs,
+	}
+
+	layers := make([]Schema2Descriptor, len(m.Layers))
+	for i, d := range m.Layers {
+		mediaType, err := schema2LayerMediaTypeFromOCI1(d.MediaType)
+		if err != nil {
+			return nil, err
+		}
+		layers[i] = Schema2Descriptor{
+			MediaType: mediaType,
+			Size:      d.Size,
+			Digest:    d.Digest,
+			URLs:      d.URLs,
+		}
+	}
+	return Schema2FromComponents(config, layers), nil
+}
+
+// schema2LayerMediaTypeFromOCI1 returns the schema2 media type corresponding to an OCI layer mediaType.
+func schema2LayerMediaTypeFromOCI1(mediaType string) (string, error) {
+	t, err := ClassifyLayerMediaType(mediaType)
+	if err != nil {
+		return "", err
+	}
+	return t.Schema2MIMEType()
+}
+
 // ImageID computes an ID which can uniquely identify this image by its contents.
 func (m *OCI1) ImageID([]digest.Digest) (string, error) {
 	if err := m.Config.Digest.Validate(); err != nil {
@@ -0,0 +1,100 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOCI1ToSchema2(t *testing.T) {
+	layers := []imgspecv1.Descriptor{}
+	expectedLayers := []Schema2Descriptor{}
+	for i, c := range []struct{ oci, schema2 string }{
+		{imgspecv1.MediaTypeImageLayerGzip, DockerV2Schema2LayerMediaType},
+		{imgspecv1.MediaTypeImageLayer, DockerV2SchemaLayerMediaTypeUncompressed},
+		{imgspecv1.MediaTypeImageLayerNonDistributableGzip, DockerV2Schema2ForeignLayerMediaType},
+		{imgspecv1.MediaTypeImageLayerNonDistributable, DockerV2Schema2ForeignLayerMediaTypeUncompressed},
+	} {
+		d := digest.FromString(c.oci)
+		layers = append(layers, imgspecv1.Descriptor{
+			MediaType:   c.oci,
+			Size:        int64(i),
+			Digest:      d,
+			URLs:        []string{"https://example.com/" + d.Hex()},
+			Annotations: map[string]string{"com.example.key": "value"},
+		})
+		expectedLayers = append(expectedLayers, Schema2Descriptor{
+			MediaType: c.schema2,
+			Size:      int64(i),
+			Digest:    d,
+			URLs:      []string{"https://example.com/" + d.Hex()},
+		})
+	}
+	config := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Size:      7023,
+		Digest:    "sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7",
+	}
+	m := OCI1FromComponents(config, layers)
+
+	m2, err := m.ToSchema2()
+	require.NoError(t, err)
+	assert.Equal(t, DockerV2Schema2MediaType, m2.MediaType)
+	assert.Equal(t, Schema2Descriptor{
+		MediaType: DockerV2Schema2ConfigMediaType,
+		Size:      config.Size,
+		Digest:    config.Digest,
+	}, m2.ConfigDescriptor)
+	assert.Equal(t, expectedLayers, m2.LayersDescriptors)
+
+	// Unknown layer media type
+	m.Layers[0].MediaType = "application/vnd.example.unknown"
+	_, err = m.ToSchema2()
+	assert.Error(t, err)
+}
+
+func TestOCI1UpdateAnnotations(t *testing.T) {
+	original := OCI1FromComponents(imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig}, []imgspecv1.Descriptor{
+		{MediaType: imgspecv1.MediaTypeImageLayerGzip, Annotations: map[string]string{"layer": "0"}},
+		{MediaType: imgspecv1.MediaTypeImageLayerGzip},
+	})
+	original.Annotations = map[string]string{"a": "1", "b": "2"}
+
+	for _, c := range []struct {
+		set      map[string]string
+		remove   []string
+		expected map[string]string
+		changed  bool
+	}{
+		{nil, nil, map[string]string{"a": "1", "b": "2"}, false},
+		{map[string]string{"a": "1"}, []string{"nonexistent"}, map[string]string{"a": "1", "b": "2"}, false},
+		{map[string]string{"a": "1"}, []string{"a"}, map[string]string{"a": "1", "b": "2"}, false},
+		{map[string]string{"a": "3", "c": "4"}, nil, map[string]string{"a": "3", "b": "2", "c": "4"}, true},
+		{nil, []string{"b"}, map[string]string{"a": "1"}, true},
+		{nil, []string{"a", "b"}, nil, true},
+	} {
+		m := OCI1Clone(original)
+		changed := m.UpdateAnnotations(c.set, c.remove)
+		assert.Equal(t, c.changed, changed)
+		assert.Equal(t, c.expected, m.Annotations)
+	}
+	// The original is not modified
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, original.Annotations)
+
+	m := OCI1Clone(original)
+	changed, err := m.UpdateLayerAnnotations(0, map[string]string{"layer": "0"}, nil)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = m.UpdateLayerAnnotations(1, map[string]string{"layer": "1"}, nil)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]string{"layer": "1"}, m.Layers[1].Annotations)
+	assert.Nil(t, original.Layers[1].Annotations)
+	_, err = m.UpdateLayerAnnotations(2, map[string]string{"layer": "2"}, nil)
+	assert.Error(t, err)
+	_, err = m.UpdateLayerAnnotations(-1, map[string]string{"layer": "-1"}, nil)
+	assert.Error(t, err)
+}
@@ -376,6 +376,11 @@ func (d *openshiftImageDestination) IgnoresEmbeddedDockerReference() bool {
 	return d.docker.IgnoresEmbeddedDockerReference()
 }
 
+// HasThreadSafePutBlob indicates whether PutBlob, HasBlob and ReapplyBlob can be called concurrently.
+func (d *openshiftImageDestination) HasThreadSafePutBlob() bool {
+	return d.docker.HasThreadSafePutBlob()
+}
+
 // PutBlob writes contents of stream and returns data representing the result (with all data filled in).
 // inputInfo.Digest can be optionally provided if known; it is not mandatory for the implementation to verify it.
 // inputInfo.Size is the expected length of stream, if known.
@@ -403,12 +408,20 @@ func (d *openshiftImageDestination) ReapplyBlob(ctx context.Context, info types.
 // If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
 // but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
 func (d *openshiftImageDestination) PutManifest(ctx context.Context, m []byte) error {
+	return d.PutManifestWithMIMEType(ctx, m, "")
+}
+
+// PutManifestWithMIMEType is like PutManifest, but also receives the MIME type of m, or "" if unknown.
+func (d *openshiftImageDestination) PutManifestWithMIMEType(ctx context.Context, m []byte, mimeType string) error {
 	manifestDigest, err := manifest.Digest(m)
 	if err != nil {
 		return err
 	}
 	d.imageStreamImageName = manifestDigest.String()
 
+	if dest, ok := d.docker.(types.ManifestMIMETypeDestination); ok {
+		return dest.PutManifestWithMIMEType(ctx, m, mimeType)
+	}
 	return d.docker.PutManifest(ctx, m)
 }
 
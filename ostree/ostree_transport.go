@@ -178,6 +178,10 @@ func (s *ostreeImageCloser) Size() (int64, error) {
 	return s.size, nil
 }
 
+func (s *ostreeImageCloser) SizeWithContext(ctx context.Context) (int64, error) {
+	return s.size, nil
+}
+
 // NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
 // The caller must call .Close() on the returned ImageCloser.
 // NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 
+	"github.com/containers/image/pkg/compression/types"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/ulikunitz/xz"
@@ -14,7 +15,7 @@ import (
 
 // DecompressorFunc returns the decompressed stream, given a compressed stream.
 // The caller must call Close() on the decompressed stream (even if the compressed input stream does not need closing!).
-type DecompressorFunc func(io.Reader) (io.ReadCloser, error)
+type DecompressorFunc = types.DecompressorFunc
 
 // GzipDecompressor is a DecompressorFunc for the gzip compression algorithm.
 func GzipDecompressor(r io.Reader) (io.ReadCloser, error) {
@@ -35,33 +36,72 @@ func XzDecompressor(r io.Reader) (io.ReadCloser, error) {
 	return ioutil.NopCloser(r), nil
 }
 
-// compressionAlgos is an internal implementation detail of DetectCompression
-var compressionAlgos = map[string]struct {
-	prefix       []byte
-	decompressor DecompressorFunc
-}{
-	"gzip":  {[]byte{0x1F, 0x8B, 0x08}, GzipDecompressor},                 // gzip (RFC 1952)
-	"bzip2": {[]byte{0x42, 0x5A, 0x68}, Bzip2Decompressor},                // bzip2 (decompress.c:BZ2_decompress)
-	"xz":    {[]byte{0xFD, 0x37, 0x7A, 0x58, 0x5A, 0x00}, XzDecompressor}, // xz (/usr/share/doc/xz/xz-file-format.txt)
+// gzipCompressor is a types.CompressorFunc for the gzip compression algorithm.
+func gzipCompressor(w io.Writer, level *int) (io.WriteCloser, error) {
+	if level != nil {
+		return gzip.NewWriterLevel(w, *level)
+	}
+	return gzip.NewWriter(w), nil
 }
 
-// DetectCompression returns a DecompressorFunc if the input is recognized as a compressed format, nil otherwise.
+// Algorithm is a compression algorithm that can be used for DetectCompressionFormat and, if it supports compression, CompressStream.
+type Algorithm = types.Algorithm
+
+var (
+	// Gzip compression.
+	Gzip = types.NewAlgorithm("gzip", []byte{0x1F, 0x8B, 0x08}, GzipDecompressor, gzipCompressor) // gzip (RFC 1952)
+	// Bzip2 compression; only decompression is supported.
+	Bzip2 = types.NewAlgorithm("bzip2", []byte{0x42, 0x5A, 0x68}, Bzip2Decompressor, nil) // bzip2 (decompress.c:BZ2_decompress)
+	// Xz compression; only decompression is supported.
+	Xz = types.NewAlgorithm("xz", []byte{0xFD, 0x37, 0x7A, 0x58, 0x5A, 0x00}, XzDecompressor, nil) // xz (/usr/share/doc/xz/xz-file-format.txt)
+	// Zstd compression; only supported if built with the containers_image_zstd build tag.
+	Zstd = types.NewAlgorithm("zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}, ZstdDecompressor, zstdCompressor) // zstd (RFC 8878)
+
+	// compressionAlgos is an internal implementation detail of DetectCompressionFormat and AlgorithmByName
+	compressionAlgos = []Algorithm{Gzip, Bzip2, Xz, Zstd}
+)
+
+// AlgorithmByName returns the compressor by its name
+func AlgorithmByName(name string) (Algorithm, error) {
+	for _, algo := range compressionAlgos {
+		if algo.Name() == name {
+			return algo, nil
+		}
+	}
+	return Algorithm{}, errors.Errorf("cannot find compressor for %q", name)
+}
+
+// CompressStream returns a stream which compresses the data written to it using algo, and writes the result to dest.
+// level is the compression level to use, or nil for the default.
+// The caller must call Close() on the returned stream.
+func CompressStream(dest io.Writer, algo Algorithm, level *int) (io.WriteCloser, error) {
+	compressor := algo.Compressor()
+	if compressor == nil {
+		return nil, errors.Errorf("compression using %q is not supported", algo.Name())
+	}
+	return compressor(dest, level)
+}
+
+// DetectCompressionFormat returns a DecompressorFunc and the Algorithm if the input is recognized as a compressed format,
+// an invalid Algorithm and nil otherwise.
 // Because it consumes the start of input, other consumers must use the returned io.Reader instead to also read from the beginning.
-func DetectCompression(input io.Reader) (DecompressorFunc, io.Reader, error) {
+func DetectCompressionFormat(input io.Reader) (Algorithm, DecompressorFunc, io.Reader, error) {
 	buffer := [8]byte{}
 
 	n, err := io.ReadAtLeast(input, buffer[:], len(buffer))
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		// This is a “real” error. We could just ignore it this time, process the data we have, and hope that the source will report the same error again.
 		// Instead, fail immediately with the original error cause instead of a possibly secondary/misleading error returned later.
-		return nil, nil, err
+		return Algorithm{}, nil, nil, err
 	}
 
+	var retAlgo Algorithm
 	var decompressor DecompressorFunc
-	for name, algo := range compressionAlgos {
-		if bytes.HasPrefix(buffer[:n], algo.prefix) {
-			logrus.Debugf("Detected compression format %s", name)
-			decompressor = algo.decompressor
+	for _, algo := range compressionAlgos {
+		if bytes.HasPrefix(buffer[:n], algo.Prefix()) {
+			logrus.Debugf("Detected compression format %s", algo.Name())
+			retAlgo = algo
+			decompressor = algo.Decompressor()
 			break
 		}
 	}
@@ -69,7 +109,14 @@ func DetectCompression(input io.Reader) (DecompressorFunc, io.Reader, error) {
 		logrus.Debugf("No compression detected")
 	}
 
-	return decompressor, io.MultiReader(bytes.NewReader(buffer[:n]), input), nil
+	return retAlgo, decompressor, io.MultiReader(bytes.NewReader(buffer[:n]), input), nil
+}
+
+// DetectCompression returns a DecompressorFunc if the input is recognized as a compressed format, nil otherwise.
+// Because it consumes the start of input, other consumers must use the returned io.Reader instead to also read from the beginning.
+func DetectCompression(input io.Reader) (DecompressorFunc, io.Reader, error) {
+	_, d, r, e := DetectCompressionFormat(input)
+	return d, r, e
 }
 
 // AutoDecompress takes a stream and returns an uncompressed version of the
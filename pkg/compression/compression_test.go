@@ -2,6 +2,8 @@ package compression
 
 import (
 	"bytes"
+	"compress/gzip"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -22,7 +24,7 @@ func TestDetectCompression(t *testing.T) {
 	}
 
 	// The original stream is preserved.
-	for _, c := range cases {
+	for _, c := range append(cases, "fixtures/Hello.zst") {
 		originalContents, err := ioutil.ReadFile(c)
 		require.NoError(t, err, c)
 
@@ -39,6 +41,7 @@ func TestDetectCompression(t *testing.T) {
 	}
 
 	// The correct decompressor is chosen, and the result is as expected.
+	// (zstd is tested in TestZstd, because decompressing it requires the containers_image_zstd build tag.)
 	for _, c := range cases {
 		stream, err := os.Open(c)
 		require.NoError(t, err, c)
@@ -78,6 +81,99 @@ func TestDetectCompression(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDetectCompressionFormat(t *testing.T) {
+	for _, c := range []struct {
+		filename string
+		name     string // "" if uncompressed
+	}{
+		{"fixtures/Hello.uncompressed", ""},
+		{"fixtures/Hello.gz", "gzip"},
+		{"fixtures/Hello.bz2", "bzip2"},
+		{"fixtures/Hello.xz", "xz"},
+		{"fixtures/Hello.zst", "zstd"},
+	} {
+		originalContents, err := ioutil.ReadFile(c.filename)
+		require.NoError(t, err, c.filename)
+
+		algo, decompressor, updatedStream, err := DetectCompressionFormat(bytes.NewReader(originalContents))
+		require.NoError(t, err, c.filename)
+		assert.Equal(t, c.name, algo.Name(), c.filename)
+		assert.Equal(t, c.name != "", decompressor != nil, c.filename)
+		updatedContents, err := ioutil.ReadAll(updatedStream)
+		require.NoError(t, err, c.filename)
+		assert.Equal(t, originalContents, updatedContents, c.filename)
+	}
+
+	// Error reading input
+	reader, writer := io.Pipe()
+	defer reader.Close()
+	writer.CloseWithError(errors.New("Expected error reading input in DetectCompressionFormat"))
+	_, _, _, err := DetectCompressionFormat(reader)
+	assert.Error(t, err)
+}
+
+func TestAlgorithmByName(t *testing.T) {
+	for _, name := range []string{"gzip", "bzip2", "xz", "zstd"} {
+		algo, err := AlgorithmByName(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, name, algo.Name(), name)
+	}
+	for _, name := range []string{"", "zst", "GZIP"} {
+		_, err := AlgorithmByName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+	bestSpeed, bestCompression := gzip.BestSpeed, gzip.BestCompression
+	for _, c := range []struct {
+		algo  Algorithm
+		level *int
+	}{
+		{Gzip, nil},
+		{Gzip, &bestSpeed},
+		{Gzip, &bestCompression},
+	} {
+		dest := bytes.Buffer{}
+		compressor, err := CompressStream(&dest, c.algo, c.level)
+		require.NoError(t, err, c.algo.Name())
+		_, err = compressor.Write([]byte("Hello"))
+		require.NoError(t, err, c.algo.Name())
+		err = compressor.Close()
+		require.NoError(t, err, c.algo.Name())
+
+		algo, decompressor, stream, err := DetectCompressionFormat(&dest)
+		require.NoError(t, err, c.algo.Name())
+		assert.Equal(t, c.algo.Name(), algo.Name())
+		require.NotNil(t, decompressor, c.algo.Name())
+		uncompressedStream, err := decompressor(stream)
+		require.NoError(t, err, c.algo.Name())
+		uncompressedContents, err := ioutil.ReadAll(uncompressedStream)
+		require.NoError(t, err, c.algo.Name())
+		assert.Equal(t, []byte("Hello"), uncompressedContents, c.algo.Name())
+		err = uncompressedStream.Close()
+		assert.NoError(t, err, c.algo.Name())
+	}
+
+	// Invalid compression level
+	for _, c := range []struct {
+		algo  Algorithm
+		level int
+	}{
+		{Gzip, 42},
+	} {
+		level := c.level
+		_, err := CompressStream(ioutil.Discard, c.algo, &level)
+		assert.Error(t, err, fmt.Sprintf("%s %d", c.algo.Name(), c.level))
+	}
+
+	// Algorithms which only support decompression
+	for _, algo := range []Algorithm{Bzip2, Xz} {
+		_, err := CompressStream(ioutil.Discard, algo, nil)
+		assert.Error(t, err, algo.Name())
+	}
+}
+
 func TestAutoDecompress(t *testing.T) {
 	cases := []struct {
 		filename     string
@@ -0,0 +1,57 @@
+// Package types contains the compression.Algorithm type, separately from the implementations of the algorithms
+// in the parent package, so that github.com/containers/image/types can refer to it without depending on them.
+package types
+
+import (
+	"io"
+)
+
+// DecompressorFunc returns the decompressed stream, given a compressed stream.
+// The caller must call Close() on the decompressed stream (even if the compressed input stream does not need closing!).
+type DecompressorFunc func(io.Reader) (io.ReadCloser, error)
+
+// CompressorFunc writes the compressed stream to the given writer using the specified compression level (or the default if nil).
+// The caller must call Close() on the stream (even if the input stream does not need closing!).
+type CompressorFunc func(io.Writer, *int) (io.WriteCloser, error)
+
+// Algorithm is a compression algorithm provided and supported by pkg/compression.
+type Algorithm struct {
+	name         string
+	prefix       []byte
+	decompressor DecompressorFunc
+	compressor   CompressorFunc // nil if compression is not supported
+}
+
+// NewAlgorithm creates an Algorithm instance; it is used by pkg/compression to define the supported algorithms.
+// compressor may be nil if the algorithm only supports decompression.
+func NewAlgorithm(name string, prefix []byte, decompressor DecompressorFunc, compressor CompressorFunc) Algorithm {
+	return Algorithm{
+		name:         name,
+		prefix:       prefix,
+		decompressor: decompressor,
+		compressor:   compressor,
+	}
+}
+
+// Name returns the name for the compression algorithm.
+func (c Algorithm) Name() string {
+	return c.name
+}
+
+// Prefix returns the data prefix identifying a stream compressed using the algorithm.
+// This is an implementation detail of pkg/compression.
+func (c Algorithm) Prefix() []byte {
+	return c.prefix
+}
+
+// Decompressor returns the DecompressorFunc of the algorithm.
+// This is an implementation detail of pkg/compression, callers should use compression.DetectCompressionFormat instead.
+func (c Algorithm) Decompressor() DecompressorFunc {
+	return c.decompressor
+}
+
+// Compressor returns the CompressorFunc of the algorithm, or nil if compression is not supported.
+// This is an implementation detail of pkg/compression, callers should use compression.CompressStream instead.
+func (c Algorithm) Compressor() CompressorFunc {
+	return c.compressor
+}
@@ -0,0 +1,34 @@
+// +build containers_image_zstd
+
+// This file uses github.com/klauspost/compress/zstd, which is not in vendor.conf; builds using the containers_image_zstd
+// build tag must provide it separately.
+
+package compression
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// ZstdDecompressor is a DecompressorFunc for the zstd compression algorithm.
+func ZstdDecompressor(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+// zstdCompressor is a types.CompressorFunc for the zstd compression algorithm.
+// level uses the levels of the zstd command-line tool (1 to 22); it is mapped to the closest level supported by the implementation.
+func zstdCompressor(w io.Writer, level *int) (io.WriteCloser, error) {
+	if level == nil {
+		return zstd.NewWriter(w)
+	}
+	if *level < 1 || *level > 22 {
+		return nil, errors.Errorf("invalid zstd compression level %d, must be between 1 and 22", *level)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(*level)))
+}
@@ -0,0 +1,24 @@
+// +build !containers_image_zstd
+
+package compression
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// errZstdNotSupported is returned when using zstd without the containers_image_zstd build tag.
+var errZstdNotSupported = errors.New("zstd compression is only supported in github.com/containers/image built with the containers_image_zstd build tag")
+
+// ZstdDecompressor is a DecompressorFunc for the zstd compression algorithm.
+// In this build, it always fails.
+func ZstdDecompressor(r io.Reader) (io.ReadCloser, error) {
+	return nil, errZstdNotSupported
+}
+
+// zstdCompressor is a types.CompressorFunc for the zstd compression algorithm.
+// In this build, it always fails.
+func zstdCompressor(w io.Writer, level *int) (io.WriteCloser, error) {
+	return nil, errZstdNotSupported
+}
@@ -0,0 +1,29 @@
+// +build !containers_image_zstd
+
+package compression
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZstd(t *testing.T) {
+	// zstd streams are detected, but can not be decompressed
+	stream, err := os.Open("fixtures/Hello.zst")
+	require.NoError(t, err)
+	defer stream.Close()
+	algo, _, _, err := DetectCompressionFormat(stream)
+	require.NoError(t, err)
+	assert.Equal(t, Zstd.Name(), algo.Name())
+	_, err = stream.Seek(0, os.SEEK_SET)
+	require.NoError(t, err)
+	_, _, err = AutoDecompress(stream)
+	assert.Error(t, err)
+
+	_, err = CompressStream(ioutil.Discard, Zstd, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+// +build containers_image_zstd
+
+package compression
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZstd(t *testing.T) {
+	// Decompression
+	stream, err := os.Open("fixtures/Hello.zst")
+	require.NoError(t, err)
+	defer stream.Close()
+	uncompressedStream, isCompressed, err := AutoDecompress(stream)
+	require.NoError(t, err)
+	defer uncompressedStream.Close()
+	assert.True(t, isCompressed)
+	uncompressedContents, err := ioutil.ReadAll(uncompressedStream)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("Hello"), uncompressedContents)
+
+	// Compression
+	zstdFastest, zstdBest := 1, 22
+	for _, level := range []*int{nil, &zstdFastest, &zstdBest} {
+		dest := bytes.Buffer{}
+		compressor, err := CompressStream(&dest, Zstd, level)
+		require.NoError(t, err)
+		_, err = compressor.Write([]byte("Hello"))
+		require.NoError(t, err)
+		err = compressor.Close()
+		require.NoError(t, err)
+
+		algo, decompressor, stream, err := DetectCompressionFormat(&dest)
+		require.NoError(t, err)
+		assert.Equal(t, Zstd.Name(), algo.Name())
+		uncompressedStream, err := decompressor(stream)
+		require.NoError(t, err)
+		uncompressedContents, err := ioutil.ReadAll(uncompressedStream)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("Hello"), uncompressedContents)
+		err = uncompressedStream.Close()
+		assert.NoError(t, err)
+	}
+
+	// Invalid compression level
+	for _, level := range []int{0, 23} {
+		_, err := CompressStream(ioutil.Discard, Zstd, &level)
+		assert.Error(t, err, level)
+	}
+}
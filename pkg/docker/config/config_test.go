@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/types"
@@ -57,3 +58,45 @@ func TestGetPathToAuth(t *testing.T) {
 		}
 	}
 }
+
+func TestGetCredentials(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestGetCredentials")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	authFile := filepath.Join(tmpDir, "auth.json")
+	err = ioutil.WriteFile(authFile, []byte(`{"auths": {
+		"password.example.com": {"auth": "dXNlcjpwYXNzd29yZA=="},
+		"token.example.com": {"identitytoken": "identity"},
+		"both.example.com": {"auth": "dXNlcjpwYXNzd29yZA==", "identitytoken": "identity"}
+	}}`), 0600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{AuthFilePath: authFile}
+
+	for _, c := range []struct {
+		registry string
+		expected types.DockerAuthConfig
+	}{
+		{"password.example.com", types.DockerAuthConfig{Username: "user", Password: "password"}},
+		{"token.example.com", types.DockerAuthConfig{IdentityToken: "identity"}},
+		{"both.example.com", types.DockerAuthConfig{Username: "user", Password: "password", IdentityToken: "identity"}},
+		{"unknown.example.com", types.DockerAuthConfig{}},
+	} {
+		creds, err := GetCredentials(sys, c.registry)
+		require.NoError(t, err, c.registry)
+		assert.Equal(t, c.expected, creds, c.registry)
+	}
+
+	// GetAuthentication ignores identity tokens
+	username, password, err := GetAuthentication(sys, "token.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "", username)
+	assert.Equal(t, "", password)
+
+	// SystemContext.DockerAuthConfig overrides the files
+	creds, err := GetCredentials(&types.SystemContext{
+		AuthFilePath:     authFile,
+		DockerAuthConfig: &types.DockerAuthConfig{IdentityToken: "override"},
+	}, "token.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{IdentityToken: "override"}, creds)
+}
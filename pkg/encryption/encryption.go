@@ -0,0 +1,38 @@
+// Package encryption supports encrypting and decrypting OCI image layers, in the format
+// implemented by github.com/containers/ocicrypt: the layers use MIME types with a "+encrypted" suffix,
+// and the keys needed to decrypt them are recorded in org.opencontainers.image.enc.* layer annotations.
+//
+// Encryption and decryption are only supported if built with the containers_image_ocicrypt build tag;
+// otherwise NewEncryptConfig and NewDecryptConfig fail.
+package encryption
+
+import "strings"
+
+const (
+	// annotationPrefix is the prefix of all layer annotations used to record how a layer is encrypted.
+	annotationPrefix = "org.opencontainers.image.enc."
+	// wrappedKeysAnnotationPrefix is the prefix of the layer annotations which contain the layer key, wrapped for a set of recipients.
+	wrappedKeysAnnotationPrefix = annotationPrefix + "keys."
+)
+
+// IsEncryptionAnnotation returns true if key is a layer annotation used to record how a layer is encrypted.
+func IsEncryptionAnnotation(key string) bool {
+	return strings.HasPrefix(key, annotationPrefix)
+}
+
+// AnnotationsWithoutEncryption returns annotations without the annotations used to record how a layer is encrypted,
+// or nil if no other annotations are present.
+// annotations is never modified, it may be shared with other objects.
+func AnnotationsWithoutEncryption(annotations map[string]string) map[string]string {
+	var res map[string]string
+	for k, v := range annotations {
+		if IsEncryptionAnnotation(k) {
+			continue
+		}
+		if res == nil {
+			res = map[string]string{}
+		}
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,46 @@
+package encryption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsEncryptionAnnotation(t *testing.T) {
+	for _, c := range []struct {
+		key      string
+		expected bool
+	}{
+		{"org.opencontainers.image.enc.keys.jwe", true},
+		{"org.opencontainers.image.enc.pubopts", true},
+		{"org.opencontainers.image.title", false},
+		{"com.example.enc.keys", false},
+	} {
+		assert.Equal(t, c.expected, IsEncryptionAnnotation(c.key), c.key)
+	}
+}
+
+func TestAnnotationsWithoutEncryption(t *testing.T) {
+	for _, c := range []struct {
+		input, expected map[string]string
+	}{
+		{nil, nil},
+		{map[string]string{}, nil},
+		{map[string]string{"org.opencontainers.image.enc.pubopts": "e30="}, nil},
+		{
+			map[string]string{"org.opencontainers.image.enc.pubopts": "e30=", "org.opencontainers.image.enc.keys.jwe": "x", "com.example.key": "value"},
+			map[string]string{"com.example.key": "value"},
+		},
+		{map[string]string{"com.example.key": "value"}, map[string]string{"com.example.key": "value"}},
+	} {
+		original := map[string]string{}
+		for k, v := range c.input {
+			original[k] = v
+		}
+		res := AnnotationsWithoutEncryption(c.input)
+		assert.Equal(t, c.expected, res)
+		if c.input != nil {
+			assert.Equal(t, original, c.input) // The input is not modified
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// +build containers_image_ocicrypt
+
+// This file uses github.com/containers/ocicrypt, which is not in vendor.conf; builds using the containers_image_ocicrypt
+// build tag must provide it separately.
+
+package encryption
+
+import (
+	"io"
+	"strings"
+
+	"github.com/containers/ocicrypt"
+	encconfig "github.com/containers/ocicrypt/config"
+	"github.com/containers/ocicrypt/helpers"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// EncryptConfig contains the recipients which will be able to decrypt the layers encrypted using it.
+type EncryptConfig struct {
+	config *encconfig.EncryptConfig
+}
+
+// NewEncryptConfig returns an EncryptConfig for recipients, each of which is one of
+// "jwe:" followed by a path of a PEM-encoded public key file,
+// "pkcs7:" followed by a path of a PEM-encoded X.509 certificate file,
+// or "pgp:" followed by an e-mail address or name of a key in the user's GPG public keyring.
+func NewEncryptConfig(recipients []string) (*EncryptConfig, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("No recipients specified for layer encryption")
+	}
+	cc, err := helpers.CreateCryptoConfig(recipients, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error preparing layer encryption for recipients %s", strings.Join(recipients, ", "))
+	}
+	if cc.EncryptConfig == nil { // Coverage: This should never happen, CreateCryptoConfig always sets it when recipients are provided.
+		return nil, errors.New("Internal error: no layer encryption configuration prepared")
+	}
+	return &EncryptConfig{config: cc.EncryptConfig}, nil
+}
+
+// EncryptLayer returns a stream of the layer in stream, described by desc, encrypted for the recipients of ec,
+// and a function which, after the returned stream has been fully consumed, returns the annotations to add to the encrypted layer.
+func (ec *EncryptConfig) EncryptLayer(stream io.Reader, desc imgspecv1.Descriptor) (io.Reader, func() (map[string]string, error), error) {
+	encrypted, finalizer, err := ocicrypt.EncryptLayer(ec.config, stream, desc)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error encrypting layer %s", desc.Digest)
+	}
+	annotations := func() (map[string]string, error) {
+		res, err := finalizer()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error encrypting layer %s", desc.Digest)
+		}
+		for k := range res {
+			if strings.HasPrefix(k, wrappedKeysAnnotationPrefix) {
+				return res, nil
+			}
+		}
+		// E.g. if all recipients were GPG keys, and GPG is not installed.
+		return nil, errors.Errorf("Error encrypting layer %s: the layer key could not be wrapped for any of the recipients", desc.Digest)
+	}
+	return encrypted, annotations, nil
+}
+
+// DecryptConfig contains the private keys used to decrypt layers.
+type DecryptConfig struct {
+	config *encconfig.DecryptConfig
+}
+
+// NewDecryptConfig returns a DecryptConfig for keys, each of which is a path of a private key
+// (PEM or DER-encoded, or a GPG secret keyring) or X.509 certificate file, optionally followed by ":" and a password
+// (as "pass=password", "file=password-file", "fd=file-descriptor", or just the password).
+func NewDecryptConfig(keys []string) (*DecryptConfig, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("No keys specified for layer decryption")
+	}
+	cc, err := helpers.CreateDecryptCryptoConfig(keys, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error preparing layer decryption")
+	}
+	if cc.DecryptConfig == nil { // Coverage: This should never happen, CreateDecryptCryptoConfig always sets it.
+		return nil, errors.New("Internal error: no layer decryption configuration prepared")
+	}
+	return &DecryptConfig{config: cc.DecryptConfig}, nil
+}
+
+// DecryptLayer returns a stream of the layer in stream, described by desc, decrypted using the keys of dc.
+// The returned stream fails when reading its end if the layer has been modified.
+func (dc *DecryptConfig) DecryptLayer(stream io.Reader, desc imgspecv1.Descriptor) (io.Reader, error) {
+	decrypted, _, err := ocicrypt.DecryptLayer(dc.config, stream, desc, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error decrypting layer %s", desc.Digest)
+	}
+	return decrypted, nil
+}
@@ -0,0 +1,44 @@
+// +build !containers_image_ocicrypt
+
+package encryption
+
+import (
+	"io"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// errEncryptionNotSupported is returned when encrypting or decrypting layers without the containers_image_ocicrypt build tag.
+var errEncryptionNotSupported = errors.New("Layer encryption is only supported in github.com/containers/image built with the containers_image_ocicrypt build tag")
+
+// EncryptConfig contains the recipients which will be able to decrypt the layers encrypted using it.
+type EncryptConfig struct{}
+
+// NewEncryptConfig returns an EncryptConfig for recipients.
+// In this build, it always fails.
+func NewEncryptConfig(recipients []string) (*EncryptConfig, error) {
+	return nil, errEncryptionNotSupported
+}
+
+// EncryptLayer returns a stream of the layer in stream, described by desc, encrypted for the recipients of ec,
+// and a function which, after the returned stream has been fully consumed, returns the annotations to add to the encrypted layer.
+// In this build, it always fails.
+func (ec *EncryptConfig) EncryptLayer(stream io.Reader, desc imgspecv1.Descriptor) (io.Reader, func() (map[string]string, error), error) {
+	return nil, nil, errEncryptionNotSupported
+}
+
+// DecryptConfig contains the private keys used to decrypt layers.
+type DecryptConfig struct{}
+
+// NewDecryptConfig returns a DecryptConfig for keys.
+// In this build, it always fails.
+func NewDecryptConfig(keys []string) (*DecryptConfig, error) {
+	return nil, errEncryptionNotSupported
+}
+
+// DecryptLayer returns a stream of the layer in stream, described by desc, decrypted using the keys of dc.
+// In this build, it always fails.
+func (dc *DecryptConfig) DecryptLayer(stream io.Reader, desc imgspecv1.Descriptor) (io.Reader, error) {
+	return nil, errEncryptionNotSupported
+}
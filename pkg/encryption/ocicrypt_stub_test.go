@@ -0,0 +1,19 @@
+// +build !containers_image_ocicrypt
+
+package encryption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEncryptConfig(t *testing.T) {
+	_, err := NewEncryptConfig([]string{"jwe:/dev/null"})
+	assert.Error(t, err)
+}
+
+func TestNewDecryptConfig(t *testing.T) {
+	_, err := NewDecryptConfig([]string{"/dev/null"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+// +build containers_image_ocicrypt
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestKeyPair generates a RSA key pair, stores it in dir as PEM files, and returns the paths of the public and private key.
+func writeTestKeyPair(t *testing.T, dir, name string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	publicPath := filepath.Join(dir, name+".pub.pem")
+	err = ioutil.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0644)
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, name+".pem")
+	err = ioutil.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	require.NoError(t, err)
+	return publicPath, privatePath
+}
+
+func TestNewEncryptConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encryption")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	publicPath, privatePath := writeTestKeyPair(t, tmpDir, "key")
+
+	_, err = NewEncryptConfig([]string{"jwe:" + publicPath})
+	assert.NoError(t, err)
+
+	for _, recipients := range [][]string{
+		nil,
+		{},
+		{publicPath},              // No protocol
+		{"unknown:" + publicPath}, // Unknown protocol
+		{"jwe:" + filepath.Join(tmpDir, "does-not-exist")}, // Missing file
+		{"jwe:" + privatePath},                             // Not a public key
+	} {
+		_, err := NewEncryptConfig(recipients)
+		assert.Error(t, err, recipients)
+	}
+}
+
+func TestNewDecryptConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encryption")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	_, privatePath := writeTestKeyPair(t, tmpDir, "key")
+
+	_, err = NewDecryptConfig([]string{privatePath})
+	assert.NoError(t, err)
+
+	for _, keys := range [][]string{
+		nil,
+		{},
+		{filepath.Join(tmpDir, "does-not-exist")},
+	} {
+		_, err := NewDecryptConfig(keys)
+		assert.Error(t, err, keys)
+	}
+}
+
+func TestEncryptDecryptLayer(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encryption")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	publicPath, privatePath := writeTestKeyPair(t, tmpDir, "key")
+	_, otherPrivatePath := writeTestKeyPair(t, tmpDir, "other")
+
+	ec, err := NewEncryptConfig([]string{"jwe:" + publicPath})
+	require.NoError(t, err)
+	layer := []byte("Hello")
+	desc := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(layer),
+		Size:      int64(len(layer)),
+	}
+	stream, annotationsFn, err := ec.EncryptLayer(bytes.NewReader(layer), desc)
+	require.NoError(t, err)
+	encrypted, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.NotEqual(t, layer, encrypted)
+	annotations, err := annotationsFn()
+	require.NoError(t, err)
+	assert.Contains(t, annotations, "org.opencontainers.image.enc.keys.jwe")
+	assert.Contains(t, annotations, "org.opencontainers.image.enc.pubopts")
+	for k := range annotations {
+		assert.True(t, IsEncryptionAnnotation(k), k)
+	}
+
+	encryptedDesc := imgspecv1.Descriptor{
+		MediaType:   imgspecv1.MediaTypeImageLayer + "+encrypted",
+		Digest:      digest.FromBytes(encrypted),
+		Size:        int64(len(encrypted)),
+		Annotations: annotations,
+	}
+	dc, err := NewDecryptConfig([]string{privatePath})
+	require.NoError(t, err)
+	stream, err = dc.DecryptLayer(bytes.NewReader(encrypted), encryptedDesc)
+	require.NoError(t, err)
+	decrypted, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, layer, decrypted)
+
+	// Modified data is detected
+	modified := append([]byte{}, encrypted...)
+	modified[0] ^= 1
+	stream, err = dc.DecryptLayer(bytes.NewReader(modified), encryptedDesc)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(stream)
+	assert.Error(t, err)
+
+	// A key of a different recipient can not be used
+	otherDC, err := NewDecryptConfig([]string{otherPrivatePath})
+	require.NoError(t, err)
+	_, err = otherDC.DecryptLayer(bytes.NewReader(encrypted), encryptedDesc)
+	assert.Error(t, err)
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/BurntSushi/toml"
+	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/types"
 )
 
@@ -30,6 +31,9 @@ type Mirror struct {
 	// If true, certs verification will be skipped and HTTP (non-TLS)
 	// connections will be allowed.
 	Insecure bool `toml:"insecure"`
+	// If not empty, the URL of a proxy used for all connections to the
+	// mirror, regardless of the proxy environment variables.
+	Proxy string `toml:"proxy"`
 }
 
 // Registry represents a registry.
@@ -43,6 +47,9 @@ type Registry struct {
 	// If true, certs verification will be skipped and HTTP (non-TLS)
 	// connections will be allowed.
 	Insecure bool `toml:"insecure"`
+	// If not empty, the URL of a proxy used for all connections to the
+	// registry, regardless of the proxy environment variables.
+	Proxy string `toml:"proxy"`
 	// If true, the registry can be used when pulling an unqualified image.
 	Search bool `toml:"unqualified-search"`
 	// Prefix is used for matching images, and to translate one namespace to
@@ -137,6 +144,22 @@ func parseURL(input string) (string, error) {
 	return trimmed, nil
 }
 
+// validateProxy returns an error if proxy is neither empty nor a valid proxy URL,
+// e.g. http://proxy.example.com:3128.
+func validateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	uri, err := url.Parse(proxy)
+	if err != nil {
+		return &InvalidRegistries{s: fmt.Sprintf("invalid proxy URL '%s': %v", proxy, err)}
+	}
+	if uri.Scheme == "" || uri.Host == "" {
+		return &InvalidRegistries{s: fmt.Sprintf("invalid proxy URL '%s': a scheme and a host are required", proxy)}
+	}
+	return nil
+}
+
 // getV1Registries transforms v1 registries in the config into an array of v2
 // registries of type Registry.
 func getV1Registries(config *tomlConfig) ([]Registry, error) {
@@ -197,37 +220,39 @@ func getV1Registries(config *tomlConfig) ([]Registry, error) {
 	return registries, nil
 }
 
+// invalidRegistry is a registry in the config which is invalid, or in conflict with another one.
+type invalidRegistry struct {
+	// The prefix the registry would apply to, or "" if it is not known.
+	prefix string
+	err    error
+}
+
 // postProcessRegistries checks the consistency of all registries (e.g., set
 // the Prefix to URL if not set) and applies conflict checks.  It returns an
 // array of cleaned registries and error in case of conflicts.
 func postProcessRegistries(regs []Registry) ([]Registry, error) {
+	registries, invalid := processRegistries(regs)
+	if len(invalid) > 0 {
+		return nil, invalid[0].err
+	}
+	return registries, nil
+}
+
+// processRegistries is like postProcessRegistries, but instead of failing on the
+// first invalid registry, it returns the valid registries, and all invalid ones.
+func processRegistries(regs []Registry) ([]Registry, []invalidRegistry) {
 	var registries []Registry
+	var invalid []invalidRegistry
 	regMap := make(map[string][]Registry)
 
 	for _, reg := range regs {
-		var err error
-
-		// make sure URL and Prefix are valid
-		reg.URL, err = parseURL(reg.URL)
-		if err != nil {
-			return nil, err
-		}
-
-		if reg.Prefix == "" {
-			reg.Prefix = reg.URL
-		} else {
-			reg.Prefix, err = parseURL(reg.Prefix)
-			if err != nil {
-				return nil, err
-			}
+		prefix := reg.Prefix // Before processRegistry modifies reg.
+		if prefix == "" {
+			prefix = reg.URL
 		}
-
-		// make sure mirrors are valid
-		for _, mir := range reg.Mirrors {
-			mir.URL, err = parseURL(mir.URL)
-			if err != nil {
-				return nil, err
-			}
+		if err := processRegistry(&reg); err != nil {
+			invalid = append(invalid, invalidRegistry{prefix: strings.TrimRight(prefix, "/"), err: err})
+			continue
 		}
 		registries = append(registries, reg)
 		regMap[reg.URL] = append(regMap[reg.URL], reg)
@@ -239,22 +264,76 @@ func postProcessRegistries(regs []Registry) ([]Registry, error) {
 	//
 	// Note: we need to iterate over the registries array to ensure a
 	// deterministic behavior which is not guaranteed by maps.
+	valid := []Registry{}
 	for _, reg := range registries {
-		others, _ := regMap[reg.URL]
-		for _, other := range others {
-			if reg.Insecure != other.Insecure {
-				msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'insecure' setting", reg.URL)
+		if err := registryConflict(reg, regMap[reg.URL]); err != nil {
+			invalid = append(invalid, invalidRegistry{prefix: reg.Prefix, err: err})
+			continue
+		}
+		valid = append(valid, reg)
+	}
 
-				return nil, &InvalidRegistries{s: msg}
-			}
-			if reg.Blocked != other.Blocked {
-				msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'blocked' setting", reg.URL)
-				return nil, &InvalidRegistries{s: msg}
-			}
+	return valid, invalid
+}
+
+// processRegistry sanitizes the URLs in reg (e.g., sets the Prefix to URL if
+// not set), and returns an error if reg is invalid.
+func processRegistry(reg *Registry) error {
+	var err error
+
+	// make sure URL and Prefix are valid
+	reg.URL, err = parseURL(reg.URL)
+	if err != nil {
+		return err
+	}
+
+	if reg.Prefix == "" {
+		reg.Prefix = reg.URL
+	} else {
+		reg.Prefix, err = parseURL(reg.Prefix)
+		if err != nil {
+			return err
 		}
 	}
 
-	return registries, nil
+	if err := validateProxy(reg.Proxy); err != nil {
+		return err
+	}
+
+	// make sure mirrors are valid
+	mirrors := make([]Mirror, 0, len(reg.Mirrors))
+	for _, mir := range reg.Mirrors {
+		mir.URL, err = parseURL(mir.URL)
+		if err != nil {
+			return err
+		}
+		if err := validateProxy(mir.Proxy); err != nil {
+			return err
+		}
+		mirrors = append(mirrors, mir)
+	}
+	reg.Mirrors = mirrors
+	return nil
+}
+
+// registryConflict returns an error if reg conflicts with any of others, which use the same URL.
+func registryConflict(reg Registry, others []Registry) error {
+	for _, other := range others {
+		if reg.Insecure != other.Insecure {
+			msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'insecure' setting", reg.URL)
+
+			return &InvalidRegistries{s: msg}
+		}
+		if reg.Blocked != other.Blocked {
+			msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'blocked' setting", reg.URL)
+			return &InvalidRegistries{s: msg}
+		}
+		if reg.Proxy != other.Proxy {
+			msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'proxy' setting", reg.URL)
+			return &InvalidRegistries{s: msg}
+		}
+	}
+	return nil
 }
 
 // getConfigPath returns the system-registries config path if specified.
@@ -281,19 +360,51 @@ var configCache = make(map[string][]Registry)
 
 // GetRegistries loads and returns the registries specified in the config.
 func GetRegistries(ctx *types.SystemContext) ([]Registry, error) {
+	registries, invalid, err := loadRegistries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(invalid) > 0 {
+		return nil, invalid[0].err
+	}
+	return registries, nil
+}
+
+// LookupRegistry returns the Registry with the longest prefix for ref in the config, like
+// FindRegistry(ref, GetRegistries(ctx)), or nil if no Registry prefixes ref.
+// Unlike GetRegistries, an invalid registry in the config only causes an error if it might apply to ref.
+func LookupRegistry(ctx *types.SystemContext, ref string) (*Registry, error) {
+	registries, invalid, err := loadRegistries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reg := FindRegistry(ref, registries)
+	for _, i := range invalid {
+		// If the prefix is not known, the registry might apply to any ref.
+		if i.prefix == "" ||
+			(strings.HasPrefix(ref, i.prefix) && (reg == nil || len(i.prefix) >= len(reg.Prefix))) {
+			return nil, i.err
+		}
+	}
+	return reg, nil
+}
+
+// loadRegistries loads the config, and returns the valid and invalid registries specified in it.
+// If any registry is invalid, the config is not cached.
+func loadRegistries(ctx *types.SystemContext) ([]Registry, []invalidRegistry, error) {
 	configPath := getConfigPath(ctx)
 
 	configMutex.Lock()
 	defer configMutex.Unlock()
 	// if the config has already been loaded, return the cached registries
 	if registries, inCache := configCache[configPath]; inCache {
-		return registries, nil
+		return registries, nil, nil
 	}
 
 	// load the config
 	config, err := loadRegistryConf(configPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	registries := config.Registries
@@ -301,24 +412,24 @@ func GetRegistries(ctx *types.SystemContext) ([]Registry, error) {
 	// backwards compatibility for v1 configs
 	v1Registries, err := getV1Registries(config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(v1Registries) > 0 {
 		if len(registries) > 0 {
-			return nil, &InvalidRegistries{s: "mixing sysregistry v1/v2 is not supported"}
+			return nil, nil, &InvalidRegistries{s: "mixing sysregistry v1/v2 is not supported"}
 		}
 		registries = v1Registries
 	}
 
-	registries, err = postProcessRegistries(registries)
-	if err != nil {
-		return nil, err
+	registries, invalid := processRegistries(registries)
+	if len(invalid) > 0 {
+		return registries, invalid, nil
 	}
 
 	// populate the cache
 	configCache[configPath] = registries
 
-	return registries, err
+	return registries, nil, nil
 }
 
 // FindUnqualifiedSearchRegistries returns all registries that are configured
@@ -353,6 +464,43 @@ func FindRegistry(ref string, registries []Registry) *Registry {
 	return nil
 }
 
+// PullSource is a location, either a mirror or the registry itself, an image can be pulled from.
+type PullSource struct {
+	// The mirror, or the registry (using its URL, Insecure and Proxy values).
+	Endpoint Mirror
+	// The reference to pull from Endpoint.
+	Reference reference.Named
+}
+
+// PullSourcesFromReference returns the locations ref, which must match r.Prefix, can be pulled from,
+// in the order they should be tried: the mirrors of r in the configured order, followed by r itself.
+func (r *Registry) PullSourcesFromReference(ref reference.Named) ([]PullSource, error) {
+	endpoints := append(append([]Mirror{}, r.Mirrors...), Mirror{URL: r.URL, Insecure: r.Insecure, Proxy: r.Proxy})
+	sources := make([]PullSource, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		rewritten, err := rewriteReference(ref, r.Prefix, endpoint.URL)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, PullSource{Endpoint: endpoint, Reference: rewritten})
+	}
+	return sources, nil
+}
+
+// rewriteReference returns ref with prefix replaced by location.
+func rewriteReference(ref reference.Named, prefix, location string) (reference.Named, error) {
+	refString := ref.String()
+	if !strings.HasPrefix(refString, prefix) {
+		return nil, fmt.Errorf("invalid prefix '%s' for reference '%s'", prefix, refString)
+	}
+	newRefString := location + refString[len(prefix):]
+	newRef, err := reference.ParseNormalizedNamed(newRefString)
+	if err != nil {
+		return nil, fmt.Errorf("error rewriting reference '%s' to '%s': %v", refString, newRefString, err)
+	}
+	return newRef, nil
+}
+
 // Reads the global registry file from the filesystem. Returns a byte array.
 func readRegistryConf(configPath string) ([]byte, error) {
 	configBytes, err := ioutil.ReadFile(configPath)
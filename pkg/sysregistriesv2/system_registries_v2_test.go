@@ -1,10 +1,13 @@
 package sysregistriesv2
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var testConfig = []byte("")
@@ -86,6 +89,62 @@ blocked = true`)
 	assert.True(t, reg.Mirrors[1].Insecure)
 }
 
+func TestPullSourcesFromReference(t *testing.T) {
+	testConfig = []byte(`
+[[registry]]
+url = "registry.com/upstream"
+prefix = "example.com/ns"
+insecure = true
+
+[[registry.mirror]]
+url = "mirror-1.registry.com"
+
+[[registry.mirror]]
+url = "mirror-2.registry.com:5000/mirrored"
+insecure = true`)
+
+	configCache = make(map[string][]Registry)
+	registries, err := GetRegistries(nil)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		input    string
+		expected []string
+	}{
+		{"example.com/ns/image:tag", []string{"mirror-1.registry.com/image:tag", "mirror-2.registry.com:5000/mirrored/image:tag", "registry.com/upstream/image:tag"}},
+		{
+			"example.com/ns/repo/image@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			[]string{
+				"mirror-1.registry.com/repo/image@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+				"mirror-2.registry.com:5000/mirrored/repo/image@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+				"registry.com/upstream/repo/image@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			},
+		},
+	} {
+		ref, err := reference.ParseNormalizedNamed(c.input)
+		require.NoError(t, err, c.input)
+		reg := FindRegistry(ref.String(), registries)
+		require.NotNil(t, reg, c.input)
+		sources, err := reg.PullSourcesFromReference(ref)
+		require.NoError(t, err, c.input)
+		res := []string{}
+		for _, s := range sources {
+			res = append(res, s.Reference.String())
+		}
+		assert.Equal(t, c.expected, res, c.input)
+		require.Len(t, sources, 3)
+		assert.False(t, sources[0].Endpoint.Insecure)
+		assert.True(t, sources[1].Endpoint.Insecure)
+		assert.Equal(t, Mirror{URL: "registry.com/upstream", Insecure: true}, sources[2].Endpoint)
+	}
+
+	// A reference which does not match the prefix is rejected
+	ref, err := reference.ParseNormalizedNamed("other.com/ns/image:tag")
+	require.NoError(t, err)
+	_, err = registries[0].PullSourcesFromReference(ref)
+	assert.Error(t, err)
+}
+
 func TestMissingRegistryURL(t *testing.T) {
 	testConfig = []byte(`
 [[registry]]
@@ -169,6 +228,89 @@ prefix = ""`)
 	assert.Equal(t, "empty-prefix.com", reg.URL)
 }
 
+func TestLookupRegistry(t *testing.T) {
+	testConfig = []byte(`
+[[registry]]
+url = "registry.com"
+
+[[registry]]
+url = "registry.com"
+prefix = "registry.com/ns"
+
+[[registry]]
+url = "invalid-mirror.com"
+[[registry.mirror]]
+url = "https://mirror.com"
+
+[[registry]]
+url = "conflict.com"
+prefix = "conflict.com/a"
+insecure = true
+
+[[registry]]
+url = "conflict.com"
+prefix = "conflict.com/b"
+
+[[registry]]
+url = "registry.com"
+prefix = "registry.com/ns/invalid-proxy"
+proxy = "invalid"
+`)
+	configCache = make(map[string][]Registry)
+	_, err := GetRegistries(nil)
+	assert.Error(t, err)
+
+	for _, c := range []struct{ ref, prefix string }{
+		{"registry.com/image:tag", "registry.com"},
+		{"registry.com/ns/image:tag", "registry.com/ns"},
+		{"unknown.com/image:tag", ""},
+	} {
+		reg, err := LookupRegistry(nil, c.ref)
+		require.NoError(t, err, c.ref)
+		if c.prefix == "" {
+			assert.Nil(t, reg, c.ref)
+		} else {
+			require.NotNil(t, reg, c.ref)
+			assert.Equal(t, c.prefix, reg.Prefix, c.ref)
+		}
+	}
+	for _, ref := range []string{
+		"invalid-mirror.com/image:tag",
+		"conflict.com/a/image:tag",
+		"conflict.com/b/image:tag",
+		"registry.com/ns/invalid-proxy/image:tag",
+	} {
+		_, err := LookupRegistry(nil, ref)
+		assert.Error(t, err, ref)
+	}
+
+	// A registry with an unknown prefix might apply to any reference
+	testConfig = []byte(`
+[[registry]]
+url = "registry.com"
+
+[[registry]]
+insecure = true
+`)
+	configCache = make(map[string][]Registry)
+	_, err = LookupRegistry(nil, "registry.com/image:tag")
+	assert.Error(t, err)
+
+	// Without invalid registries, LookupRegistry is consistent with FindRegistry
+	testConfig = []byte(`
+[[registry]]
+url = "registry.com/"
+[[registry.mirror]]
+url = "mirror.com/"
+`)
+	configCache = make(map[string][]Registry)
+	reg, err := LookupRegistry(nil, "registry.com/image:tag")
+	require.NoError(t, err)
+	require.NotNil(t, reg)
+	assert.Equal(t, "registry.com", reg.Prefix)
+	assert.Equal(t, []Mirror{{URL: "mirror.com"}}, reg.Mirrors)
+}
+
 func assertSearchRegistryURLsEqual(t *testing.T, expected []string, regs []Registry) {
 	// verify the expected registries and their order
 	names := []string{}
@@ -253,6 +395,71 @@ blocked = true
 	assert.Contains(t, err.Error(), "registry 'registry.com' is defined multiple times with conflicting 'blocked' setting")
 }
 
+func TestProxyConfig(t *testing.T) {
+	testConfig = []byte(`
+[[registry]]
+url = "registry.com"
+proxy = "http://proxy.example.com:3128"
+
+[[registry.mirror]]
+url = "mirror-1.registry.com"
+
+[[registry.mirror]]
+url = "mirror-2.registry.com"
+proxy = "socks5://mirror-proxy.example.com"
+`)
+
+	configCache = make(map[string][]Registry)
+	registries, err := GetRegistries(nil)
+	require.NoError(t, err)
+	ref, err := reference.ParseNormalizedNamed("registry.com/image:tag")
+	require.NoError(t, err)
+	sources, err := registries[0].PullSourcesFromReference(ref)
+	require.NoError(t, err)
+	require.Len(t, sources, 3)
+	assert.Equal(t, "", sources[0].Endpoint.Proxy)
+	assert.Equal(t, "socks5://mirror-proxy.example.com", sources[1].Endpoint.Proxy)
+	assert.Equal(t, "http://proxy.example.com:3128", sources[2].Endpoint.Proxy)
+
+	for _, proxy := range []string{"proxy.example.com:3128", "http://", "http://[invalid"} {
+		testConfig = []byte(fmt.Sprintf(`
+[[registry]]
+url = "registry.com"
+proxy = "%s"
+`, proxy))
+		configCache = make(map[string][]Registry)
+		_, err = GetRegistries(nil)
+		assert.Error(t, err, proxy)
+		testConfig = []byte(fmt.Sprintf(`
+[[registry]]
+url = "registry.com"
+
+[[registry.mirror]]
+url = "mirror.registry.com"
+proxy = "%s"
+`, proxy))
+		configCache = make(map[string][]Registry)
+		_, err = GetRegistries(nil)
+		assert.Error(t, err, proxy)
+	}
+
+	testConfig = []byte(`
+[[registry]]
+url = "registry.com"
+prefix = "example.com/a"
+proxy = "http://proxy.example.com:3128"
+
+[[registry]]
+url = "registry.com"
+prefix = "example.com/b"
+`)
+	configCache = make(map[string][]Registry)
+	registries, err = GetRegistries(nil)
+	assert.Nil(t, registries)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "registry 'registry.com' is defined multiple times with conflicting 'proxy' setting")
+}
+
 func TestUnmarshalConfig(t *testing.T) {
 	testConfig = []byte(`
 [[registry]]
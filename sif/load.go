@@ -0,0 +1,230 @@
+package sif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements just enough of the Singularity Image Format (SIF) to find the root filesystem of an image.
+// See https://github.com/sylabs/sif for the format definition.
+
+const (
+	sifMagic      = "SIF_MAGIC"
+	sifVersion    = "01"
+	hdrLaunchLen  = 32
+	hdrMagicLen   = 10
+	hdrVersionLen = 3
+	hdrArchLen    = 3
+	descrNameLen  = 128
+	descrExtraLen = 384
+)
+
+// sifDataType is the type of a SIF data object.
+type sifDataType int32
+
+const (
+	sifDataDeffile   sifDataType = 0x4001 // The definition file used to build the image
+	sifDataPartition sifDataType = 0x4004 // A file system partition
+)
+
+// Values of sifPartition.FsType and sifPartition.PartType.
+const (
+	sifFsSquash    int32 = 1
+	sifPartPrimSys int32 = 2
+)
+
+// sifArchitectures maps SIF architecture codes to GOARCH values.
+var sifArchitectures = map[string]string{
+	"01": "386",
+	"02": "amd64",
+	"03": "arm",
+	"04": "arm64",
+	"05": "ppc64",
+	"06": "ppc64le",
+	"07": "mips",
+	"08": "mipsle",
+	"09": "mips64",
+	"10": "mips64le",
+	"11": "s390x",
+	"12": "riscv64",
+}
+
+// sifHeader is the global header of a SIF file, as stored on disk (little-endian).
+type sifHeader struct {
+	Launch           [hdrLaunchLen]byte
+	Magic            [hdrMagicLen]byte
+	Version          [hdrVersionLen]byte
+	Arch             [hdrArchLen]byte
+	ID               [16]byte
+	CreatedAt        int64
+	ModifiedAt       int64
+	DescriptorsFree  int64
+	DescriptorsTotal int64
+	DescriptorsOff   int64
+	DescriptorsLen   int64
+	DataOff          int64
+	DataLen          int64
+}
+
+// sifDescriptor is a descriptor of a data object in a SIF file, as stored on disk (little-endian).
+type sifDescriptor struct {
+	DataType   sifDataType
+	Used       bool
+	ID         uint32
+	GroupID    uint32
+	LinkedID   uint32
+	Offset     int64
+	Size       int64
+	StoredSize int64
+	CreatedAt  int64
+	ModifiedAt int64
+	UID        int64
+	GID        int64
+	Name       [descrNameLen]byte
+	Extra      [descrExtraLen]byte
+}
+
+// sifPartition is the contents of sifDescriptor.Extra for sifDataPartition objects.
+type sifPartition struct {
+	FsType   int32
+	PartType int32
+	Arch     [hdrArchLen]byte
+}
+
+// sifImage is a parsed SIF file.
+type sifImage struct {
+	header      sifHeader
+	descriptors []sifDescriptor // Only the used ones
+}
+
+// loadSIF parses the header and the descriptors of a SIF file from r.
+func loadSIF(r io.ReaderAt) (*sifImage, error) {
+	var header sifHeader
+	if err := binary.Read(io.NewSectionReader(r, 0, int64(binary.Size(header))), binary.LittleEndian, &header); err != nil {
+		return nil, errors.Wrap(err, "Error reading SIF header")
+	}
+	if cString(header.Magic[:]) != sifMagic {
+		return nil, errors.New("Not a SIF file: invalid magic value")
+	}
+	if v := cString(header.Version[:]); v != sifVersion {
+		return nil, errors.Errorf("Unsupported SIF version %q", v)
+	}
+
+	descriptorSize := int64(binary.Size(sifDescriptor{}))
+	if header.DescriptorsTotal < 0 || header.DescriptorsTotal > header.DescriptorsLen/descriptorSize {
+		return nil, errors.Errorf("Invalid number of SIF descriptors %d", header.DescriptorsTotal)
+	}
+	descriptorsReader := io.NewSectionReader(r, header.DescriptorsOff, header.DescriptorsTotal*descriptorSize)
+	res := &sifImage{header: header}
+	for i := int64(0); i < header.DescriptorsTotal; i++ {
+		var d sifDescriptor
+		if err := binary.Read(descriptorsReader, binary.LittleEndian, &d); err != nil {
+			return nil, errors.Wrap(err, "Error reading SIF descriptors")
+		}
+		if d.Used {
+			res.descriptors = append(res.descriptors, d)
+		}
+	}
+	return res, nil
+}
+
+// architecture returns the GOARCH value corresponding to the architecture of the primary partition of img.
+func (img *sifImage) architecture() (string, error) {
+	code := cString(img.header.Arch[:])
+	arch, ok := sifArchitectures[code]
+	if !ok {
+		return "", errors.Errorf("Unknown SIF architecture %q", code)
+	}
+	return arch, nil
+}
+
+// primaryPartition returns the descriptor of the primary system partition of img, which must be a SquashFS file system.
+func (img *sifImage) primaryPartition() (sifDescriptor, error) {
+	for _, d := range img.descriptors {
+		if d.DataType != sifDataPartition {
+			continue
+		}
+		var p sifPartition
+		if err := binary.Read(bytes.NewReader(d.Extra[:]), binary.LittleEndian, &p); err != nil {
+			return sifDescriptor{}, errors.Wrap(err, "Error parsing SIF partition descriptor")
+		}
+		if p.PartType != sifPartPrimSys {
+			continue
+		}
+		if p.FsType != sifFsSquash {
+			return sifDescriptor{}, errors.Errorf("Unsupported file system type %d of the SIF primary partition, only SquashFS is supported", p.FsType)
+		}
+		return d, nil
+	}
+	return sifDescriptor{}, errors.New("No primary partition found in SIF file")
+}
+
+// descriptorOfType returns the first descriptor of dataType in img, if any.
+func (img *sifImage) descriptorOfType(dataType sifDataType) (sifDescriptor, bool) {
+	for _, d := range img.descriptors {
+		if d.DataType == dataType {
+			return d, true
+		}
+	}
+	return sifDescriptor{}, false
+}
+
+// cString returns the contents of a NUL-terminated string in b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// parseDefFile parses a SIF definition file from reader,
+// and returns non-trivial contents of the %environment and %runscript sections.
+func parseDefFile(reader io.Reader) ([]string, []string, error) {
+	type parserState int
+	const (
+		parsingOther parserState = iota
+		parsingEnvironment
+		parsingRunscript
+	)
+
+	environment := []string{}
+	runscript := []string{}
+
+	state := parsingOther
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		s := strings.TrimSpace(scanner.Text())
+		switch {
+		case s == `%environment`:
+			state = parsingEnvironment
+		case s == `%runscript`:
+			state = parsingRunscript
+		case strings.HasPrefix(s, "%"):
+			state = parsingOther
+		case state == parsingEnvironment:
+			if s != "" && !strings.HasPrefix(s, "#") {
+				environment = append(environment, s)
+			}
+		case state == parsingRunscript:
+			runscript = append(runscript, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "Error reading the SIF definition file")
+	}
+	return environment, runscript, nil
+}
+
+// generateInjectedScript generates a shell script based on
+// SIF definition file %environment and %runscript data, and returns it.
+func generateInjectedScript(environment []string, runscript []string) []byte {
+	return []byte(fmt.Sprintf("#!/bin/bash\n"+
+		"%s\n"+
+		"%s\n", strings.Join(environment, "\n"), strings.Join(runscript, "\n")))
+}
@@ -0,0 +1,172 @@
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sifTestObject is a data object in a SIF file created by sifTestFile.
+type sifTestObject struct {
+	dataType  sifDataType
+	partition *sifPartition // Only for sifDataPartition
+	data      []byte
+}
+
+// sifTestFile returns a SIF file with arch and objects.
+func sifTestFile(t *testing.T, arch string, objects []sifTestObject) []byte {
+	header := sifHeader{
+		DescriptorsTotal: int64(len(objects)),
+		DescriptorsOff:   int64(binary.Size(sifHeader{})),
+		DescriptorsLen:   int64(len(objects) * binary.Size(sifDescriptor{})),
+		ModifiedAt:       1500000000,
+	}
+	copy(header.Magic[:], sifMagic)
+	copy(header.Version[:], sifVersion)
+	copy(header.Arch[:], arch)
+	header.DataOff = header.DescriptorsOff + header.DescriptorsLen
+
+	descriptors := bytes.Buffer{}
+	data := bytes.Buffer{}
+	for i, o := range objects {
+		d := sifDescriptor{
+			DataType: o.dataType,
+			Used:     true,
+			ID:       uint32(i + 1),
+			Offset:   header.DataOff + int64(data.Len()),
+			Size:     int64(len(o.data)),
+		}
+		if o.partition != nil {
+			extra := bytes.Buffer{}
+			require.NoError(t, binary.Write(&extra, binary.LittleEndian, o.partition))
+			copy(d.Extra[:], extra.Bytes())
+		}
+		require.NoError(t, binary.Write(&descriptors, binary.LittleEndian, &d))
+		data.Write(o.data)
+	}
+	header.DataLen = int64(data.Len())
+
+	res := bytes.Buffer{}
+	require.NoError(t, binary.Write(&res, binary.LittleEndian, &header))
+	res.Write(descriptors.Bytes())
+	res.Write(data.Bytes())
+	return res.Bytes()
+}
+
+func TestLoadSIF(t *testing.T) {
+	primary := sifTestObject{sifDataPartition, &sifPartition{FsType: sifFsSquash, PartType: sifPartPrimSys}, []byte("squashfs data")}
+	file := sifTestFile(t, "02", []sifTestObject{
+		{sifDataDeffile, nil, []byte("Bootstrap: docker\n")},
+		{sifDataPartition, &sifPartition{FsType: sifFsSquash, PartType: 3}, []byte("data partition")},
+		primary,
+	})
+	img, err := loadSIF(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Len(t, img.descriptors, 3)
+	arch, err := img.architecture()
+	require.NoError(t, err)
+	assert.Equal(t, "amd64", arch)
+	d, err := img.primaryPartition()
+	require.NoError(t, err)
+	assert.Equal(t, primary.data, file[d.Offset:d.Offset+d.Size])
+	d, ok := img.descriptorOfType(sifDataDeffile)
+	require.True(t, ok)
+	assert.Equal(t, "Bootstrap: docker\n", string(file[d.Offset:d.Offset+d.Size]))
+
+	// No primary partition
+	img, err = loadSIF(bytes.NewReader(sifTestFile(t, "02", []sifTestObject{{sifDataDeffile, nil, []byte("")}})))
+	require.NoError(t, err)
+	_, err = img.primaryPartition()
+	assert.Error(t, err)
+	_, ok = img.descriptorOfType(sifDataPartition)
+	assert.False(t, ok)
+
+	// Unsupported primary partition file system
+	img, err = loadSIF(bytes.NewReader(sifTestFile(t, "02", []sifTestObject{
+		{sifDataPartition, &sifPartition{FsType: 2, PartType: sifPartPrimSys}, []byte("ext3")},
+	})))
+	require.NoError(t, err)
+	_, err = img.primaryPartition()
+	assert.Error(t, err)
+
+	// Unknown architecture
+	img, err = loadSIF(bytes.NewReader(sifTestFile(t, "99", []sifTestObject{primary})))
+	require.NoError(t, err)
+	_, err = img.architecture()
+	assert.Error(t, err)
+
+	// Invalid files
+	valid := sifTestFile(t, "02", []sifTestObject{primary})
+	for _, invalid := range [][]byte{
+		{},
+		valid[:100],
+		append(append([]byte{}, valid[:hdrLaunchLen]...), append([]byte("NOT_MAGIC"), valid[hdrLaunchLen+len("NOT_MAGIC"):]...)...),
+		append(append([]byte{}, valid[:hdrLaunchLen+hdrMagicLen]...), append([]byte("99"), valid[hdrLaunchLen+hdrMagicLen+2:]...)...),
+		valid[:binary.Size(sifHeader{})+10], // Truncated descriptors
+	} {
+		_, err := loadSIF(bytes.NewReader(invalid))
+		assert.Error(t, err)
+	}
+}
+
+func TestParseDefFile(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		input       string
+		environment []string
+		runscript   []string
+	}{
+		{"Empty input", "", []string{}, []string{}},
+		{
+			name: "Basic smoke test",
+			input: "Bootstrap: library\n" +
+				"%environment\n" +
+				"  export FOO=world\n" +
+				"  export BAR=baz\n" +
+				"%runscript\n" +
+				`  echo "Hello $FOO"` + "\n" +
+				"  sleep 5\n" +
+				"%help\n" +
+				"  Abandon all hope.\n",
+			environment: []string{"export FOO=world", "export BAR=baz"},
+			runscript:   []string{`echo "Hello $FOO"`, "sleep 5"},
+		},
+		{
+			name: "Trailing section marker",
+			input: "Bootstrap: library\n" +
+				"%environment\n" +
+				"  export FOO=world\n" +
+				"%runscript",
+			environment: []string{"export FOO=world"},
+			runscript:   []string{},
+		},
+		{
+			name: "Comments and empty lines in environment",
+			input: "%environment\n" +
+				"\n" +
+				"  # A comment\n" +
+				"  export FOO=world\n",
+			environment: []string{"export FOO=world"},
+			runscript:   []string{},
+		},
+	} {
+		env, rs, err := parseDefFile(strings.NewReader(c.input))
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.environment, env, c.name)
+		assert.Equal(t, c.runscript, rs, c.name)
+	}
+}
+
+func TestGenerateInjectedScript(t *testing.T) {
+	res := generateInjectedScript([]string{"export FOO=world", "export BAR=baz"},
+		[]string{`echo "Hello $FOO"`, "sleep 5"})
+	assert.Equal(t, "#!/bin/bash\n"+
+		"export FOO=world\n"+
+		"export BAR=baz\n"+
+		`echo "Hello $FOO"`+"\n"+
+		"sleep 5\n", string(res))
+}
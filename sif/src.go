@@ -0,0 +1,264 @@
+package sif
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/containers/image/internal/tmpdir"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// injectedScriptTargetPath is the path, within the root filesystem of the image, of a script
+// which runs the %runscript section of the SIF definition file, in its %environment.
+const injectedScriptTargetPath = "/podman/runscript"
+
+type sifImageSource struct {
+	ref          sifReference
+	workDir      string
+	layerDigest  digest.Digest
+	layerSize    int64
+	layerFile    string
+	config       []byte
+	configDigest digest.Digest
+	manifest     []byte
+}
+
+// newImageSource returns an ImageSource for reading from an existing SIF file.
+// The root filesystem is extracted from the SIF file into a temporary directory, and converted into a single uncompressed layer,
+// using the external unsquashfs and tar tools.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref sifReference) (types.ImageSource, error) {
+	file, err := os.Open(ref.file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error opening %s", ref.file)
+	}
+	defer file.Close()
+	img, err := loadSIF(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error loading SIF file %s", ref.file)
+	}
+	arch, err := img.architecture()
+	if err != nil {
+		return nil, err
+	}
+	partition, err := img.primaryPartition()
+	if err != nil {
+		return nil, err
+	}
+	environment, runscript := []string{}, []string{}
+	if d, ok := img.descriptorOfType(sifDataDeffile); ok {
+		environment, runscript, err = parseDefFile(io.NewSectionReader(file, d.Offset, d.Size))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	workDir, err := ioutil.TempDir(tmpdir.TemporaryDirectoryForBigFiles(), "sif")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating a temporary directory")
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			os.RemoveAll(workDir)
+		}
+	}()
+
+	layerFile, err := convertSIFToLayer(ctx, io.NewSectionReader(file, partition.Offset, partition.Size), workDir,
+		generateInjectedScript(environment, runscript))
+	if err != nil {
+		return nil, err
+	}
+	layerDigest, layerSize, err := digestFile(layerFile)
+	if err != nil {
+		return nil, err
+	}
+
+	created := time.Unix(img.header.ModifiedAt, 0).UTC()
+	config := imgspecv1.Image{
+		Created:      &created,
+		Architecture: arch,
+		OS:           "linux",
+		Config: imgspecv1.ImageConfig{
+			Cmd: []string{"bash", injectedScriptTargetPath},
+		},
+		RootFS: imgspecv1.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{layerDigest},
+		},
+		History: []imgspecv1.History{
+			{
+				Created:   &created,
+				CreatedBy: fmt.Sprintf("/bin/sh -c #(nop) ADD file:%s in %c", layerDigest.Hex(), os.PathSeparator),
+				Comment:   fmt.Sprintf("imported from SIF, uuid: %x", img.header.ID),
+			},
+			{
+				Created:    &created,
+				CreatedBy:  fmt.Sprintf(`/bin/sh -c #(nop) CMD ["bash", "%s"]`, injectedScriptTargetPath),
+				EmptyLayer: true,
+			},
+		},
+	}
+	configBytes, err := json.Marshal(&config)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating configuration blob")
+	}
+	configDigest := digest.Canonical.FromBytes(configBytes)
+
+	m := imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		Config: imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(configBytes)),
+		},
+		Layers: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageLayer,
+			Digest:    layerDigest,
+			Size:      layerSize,
+		}},
+	}
+	manifestBytes, err := json.Marshal(&m)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating manifest")
+	}
+
+	succeeded = true
+	return &sifImageSource{
+		ref:          ref,
+		workDir:      workDir,
+		layerDigest:  layerDigest,
+		layerSize:    layerSize,
+		layerFile:    layerFile,
+		config:       configBytes,
+		configDigest: configDigest,
+		manifest:     manifestBytes,
+	}, nil
+}
+
+// convertSIFToLayer extracts the SquashFS root filesystem in squashFS into workDir, adds injectedScript
+// at injectedScriptTargetPath, and returns a path to an uncompressed tar archive of the result.
+func convertSIFToLayer(ctx context.Context, squashFS io.Reader, workDir string, injectedScript []byte) (string, error) {
+	squashFSPath := filepath.Join(workDir, "rootfs.squashfs")
+	rootFSDir := filepath.Join(workDir, "rootfs")
+	layerPath := filepath.Join(workDir, "rootfs.tar")
+
+	squashFSFile, err := os.OpenFile(squashFSPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(squashFSFile, squashFS)
+	if closeErr := squashFSFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Error copying the SIF root filesystem")
+	}
+
+	logrus.Debugf("Extracting the SIF root filesystem to %s", rootFSDir)
+	if output, err := exec.CommandContext(ctx, "unsquashfs", "-d", rootFSDir, squashFSPath).CombinedOutput(); err != nil {
+		return "", errors.Wrapf(err, "Error extracting the SIF root filesystem: %s", string(output))
+	}
+	// The SquashFS copy is no longer needed; free the space early.
+	if err := os.Remove(squashFSPath); err != nil {
+		return "", err
+	}
+
+	scriptPath := filepath.Join(rootFSDir, injectedScriptTargetPath)
+	if err := os.MkdirAll(filepath.Dir(scriptPath), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(scriptPath, injectedScript, 0755); err != nil {
+		return "", err
+	}
+
+	logrus.Debugf("Creating a layer from %s", rootFSDir)
+	if output, err := exec.CommandContext(ctx, "tar", "--acls", "--xattrs", "-C", rootFSDir, "-cpf", layerPath, "./").CombinedOutput(); err != nil {
+		return "", errors.Wrapf(err, "Error creating a layer from the SIF root filesystem: %s", string(output))
+	}
+	if err := os.RemoveAll(rootFSDir); err != nil {
+		return "", err
+	}
+	return layerPath, nil
+}
+
+// digestFile returns the digest and size of the file at path.
+func digestFile(path string) (digest.Digest, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", -1, err
+	}
+	defer file.Close()
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(digester.Hash(), file)
+	if err != nil {
+		return "", -1, err
+	}
+	return digester.Digest(), size, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *sifImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *sifImageSource) Close() error {
+	return os.RemoveAll(s.workDir)
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *sifImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest != nil {
+		return nil, "", errors.New("manifest lists are not supported by the sif transport")
+	}
+	return s.manifest, imgspecv1.MediaTypeImageManifest, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+func (s *sifImageSource) GetBlob(ctx context.Context, info types.BlobInfo) (io.ReadCloser, int64, error) {
+	switch info.Digest {
+	case s.configDigest:
+		return ioutil.NopCloser(bytes.NewReader(s.config)), int64(len(s.config)), nil
+	case s.layerDigest:
+		reader, err := os.Open(s.layerFile)
+		if err != nil {
+			return nil, -1, errors.Wrapf(err, "Error opening %s", s.layerFile)
+		}
+		return reader, s.layerSize, nil
+	default:
+		return nil, -1, errors.Errorf("no blob with digest %s found", info.Digest.String())
+	}
+}
+
+// GetSignatures returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *sifImageSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	// SIF signatures sign the SIF data objects, not the image converted by this transport, so they are not returned.
+	return [][]byte{}, nil
+}
+
+// LayerInfosForCopy returns either nil (meaning the values in the manifest are fine), or updated values for the layer blobsums that are listed in the image's manifest.
+// The Digest field is guaranteed to be provided; Size may be -1.
+// WARNING: The list may contain duplicates, and they are semantically relevant.
+func (s *sifImageSource) LayerInfosForCopy(ctx context.Context) ([]types.BlobInfo, error) {
+	return nil, nil
+}
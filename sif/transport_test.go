@@ -0,0 +1,69 @@
+package sif
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "sif", Transport.Name())
+}
+
+func TestTransportParseReference(t *testing.T) {
+	ref, err := Transport.ParseReference("/usr/share/../share/image.sif")
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/share/../share/image.sif", ref.StringWithinTransport())
+	assert.Equal(t, "/usr/share/image.sif", ref.PolicyConfigurationIdentity())
+}
+
+func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"/etc",
+		"/this/does/not/exist",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"relative/path",
+		"/double//slashes",
+		"/has/./dot",
+		"/has/dot/../dot",
+		"/trailing/slash/",
+		"/",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestReferenceTransport(t *testing.T) {
+	ref, err := NewReference("/usr/share/image.sif")
+	require.NoError(t, err)
+	assert.Equal(t, Transport, ref.Transport())
+	assert.Nil(t, ref.DockerReference())
+}
+
+func TestReferencePolicyConfigurationNamespaces(t *testing.T) {
+	ref, err := NewReference("/usr/share/image.sif")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/usr/share", "/usr"}, ref.PolicyConfigurationNamespaces())
+}
+
+func TestReferenceNewImageDestination(t *testing.T) {
+	ref, err := NewReference("/usr/share/image.sif")
+	require.NoError(t, err)
+	_, err = ref.NewImageDestination(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+func TestReferenceDeleteImage(t *testing.T) {
+	ref, err := NewReference("/usr/share/image.sif")
+	require.NoError(t, err)
+	err = ref.DeleteImage(context.Background(), nil)
+	assert.Error(t, err)
+}
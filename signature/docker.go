@@ -4,37 +4,115 @@ package signature
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/manifest"
 	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
 )
 
 // SignDockerManifest returns a signature for manifest as the specified dockerReference,
 // using mech and keyIdentity.
 func SignDockerManifest(m []byte, dockerReference string, mech SigningMechanism, keyIdentity string) ([]byte, error) {
-	manifestDigest, err := manifest.Digest(m)
+	return SignDockerManifestWithOptions(m, dockerReference, mech, keyIdentity, nil)
+}
+
+// SignOptions are optional parameters of SignDockerManifestWithOptions.
+// The zero value of each member uses the default behavior of SignDockerManifest.
+type SignOptions struct {
+	// CreatorID is recorded in the signature instead of this implementation, if not "".
+	CreatorID string
+	// Timestamp is recorded in the signature instead of the current time, if not zero.
+	Timestamp time.Time
+	// Expiration, if not zero, is recorded in the signature; policies may be configured to reject the signature afterwards.
+	Expiration time.Time
+	// DigestAlgorithm is used to identify the manifest instead of digest.Canonical, if not "".
+	DigestAlgorithm digest.Algorithm
+	// Passphrase, if not "", is used to unlock the private key without any user interaction.
+	// mech must be a SigningMechanismWithPassphrase.
+	Passphrase string
+}
+
+// SignDockerManifestWithOptions returns a signature for manifest as the specified dockerReference,
+// using mech and keyIdentity, as specified by options (which may be nil).
+func SignDockerManifestWithOptions(m []byte, dockerReference string, mech SigningMechanism, keyIdentity string, options *SignOptions) ([]byte, error) {
+	if options == nil {
+		options = &SignOptions{}
+	}
+	algorithm := options.DigestAlgorithm
+	if algorithm == "" {
+		algorithm = digest.Canonical
+	}
+	manifestDigest, err := manifest.DigestWithAlgorithm(m, algorithm)
 	if err != nil {
 		return nil, err
 	}
 	sig := newUntrustedSignature(manifestDigest, dockerReference)
+	if options.CreatorID != "" {
+		creatorID := options.CreatorID
+		sig.UntrustedCreatorID = &creatorID
+	}
+	if !options.Timestamp.IsZero() {
+		timestamp := options.Timestamp.Unix()
+		sig.UntrustedTimestamp = &timestamp
+	}
+	if !options.Expiration.IsZero() {
+		expiration := options.Expiration.Unix()
+		sig.UntrustedExpiration = &expiration
+	}
+	if options.Passphrase != "" {
+		passphraseMech, ok := mech.(SigningMechanismWithPassphrase)
+		if !ok {
+			return nil, errors.New("Signing with a passphrase is not supported by the signing mechanism")
+		}
+		return sig.signWithPassphrase(passphraseMech, keyIdentity, options.Passphrase)
+	}
 	return sig.sign(mech, keyIdentity)
 }
 
 // VerifyDockerManifestSignature checks that unverifiedSignature uses expectedKeyIdentity to sign unverifiedManifest as expectedDockerReference,
 // using mech.
+// Unrecognized optional fields in the signature are ignored.
 func VerifyDockerManifestSignature(unverifiedSignature, unverifiedManifest []byte,
 	expectedDockerReference string, mech SigningMechanism, expectedKeyIdentity string) (*Signature, error) {
+	return verifyDockerManifestSignature(unverifiedSignature, unverifiedManifest, expectedDockerReference, mech, []string{expectedKeyIdentity}, false)
+}
+
+// VerifyDockerManifestSignatureUsingKeyIdentityList checks that unverifiedSignature uses one of expectedKeyIdentities
+// to sign unverifiedManifest as expectedDockerReference, using mech.
+// This allows verifying signatures against a set of trusted keys without constructing a Policy.
+// Unrecognized optional fields in the signature are ignored.
+func VerifyDockerManifestSignatureUsingKeyIdentityList(unverifiedSignature, unverifiedManifest []byte,
+	expectedDockerReference string, mech SigningMechanism, expectedKeyIdentities []string) (*Signature, error) {
+	return verifyDockerManifestSignature(unverifiedSignature, unverifiedManifest, expectedDockerReference, mech, expectedKeyIdentities, false)
+}
+
+// VerifyDockerManifestSignatureStrict is like VerifyDockerManifestSignature, but it also rejects signatures
+// which contain unrecognized optional fields, or which use a newer format version than this implementation supports.
+func VerifyDockerManifestSignatureStrict(unverifiedSignature, unverifiedManifest []byte,
+	expectedDockerReference string, mech SigningMechanism, expectedKeyIdentity string) (*Signature, error) {
+	return verifyDockerManifestSignature(unverifiedSignature, unverifiedManifest, expectedDockerReference, mech, []string{expectedKeyIdentity}, true)
+}
+
+// verifyDockerManifestSignature implements VerifyDockerManifestSignature and its variants.
+func verifyDockerManifestSignature(unverifiedSignature, unverifiedManifest []byte,
+	expectedDockerReference string, mech SigningMechanism, expectedKeyIdentities []string, rejectUnknownFields bool) (*Signature, error) {
 	expectedRef, err := reference.ParseNormalizedNamed(expectedDockerReference)
 	if err != nil {
 		return nil, err
 	}
 	sig, err := verifyAndExtractSignature(mech, unverifiedSignature, signatureAcceptanceRules{
 		validateKeyIdentity: func(keyIdentity string) error {
-			if keyIdentity != expectedKeyIdentity {
-				return InvalidSignatureError{msg: fmt.Sprintf("Signature by %s does not match expected fingerprint %s", keyIdentity, expectedKeyIdentity)}
+			for _, expectedKeyIdentity := range expectedKeyIdentities {
+				if keyIdentity == expectedKeyIdentity {
+					return nil
+				}
 			}
-			return nil
+			if len(expectedKeyIdentities) == 1 {
+				return InvalidSignatureError{msg: fmt.Sprintf("Signature by %s does not match expected fingerprint %s", keyIdentity, expectedKeyIdentities[0])}
+			}
+			return InvalidSignatureError{msg: fmt.Sprintf("Signature by %s does not match any of the expected fingerprints %v", keyIdentity, expectedKeyIdentities)}
 		},
 		validateSignedDockerReference: func(signedDockerReference string) error {
 			signedRef, err := reference.ParseNormalizedNamed(signedDockerReference)
@@ -57,6 +135,7 @@ func VerifyDockerManifestSignature(unverifiedSignature, unverifiedManifest []byt
 			}
 			return nil
 		},
+		rejectUnknownFields: rejectUnknownFields,
 	})
 	if err != nil {
 		return nil, err
@@ -3,7 +3,9 @@ package signature
 import (
 	"io/ioutil"
 	"testing"
+	"time"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -44,6 +46,178 @@ func TestSignDockerManifest(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestSignDockerManifestWithOptions(t *testing.T) {
+	mech, err := newGPGSigningMechanismInDirectory(testGPGHomeDirectory)
+	require.NoError(t, err)
+	defer mech.Close()
+
+	if err := mech.SupportsSigning(); err != nil {
+		t.Skipf("Signing not supported: %v", err)
+	}
+
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	expiration := time.Unix(1516219104, 0)
+
+	// Successful signing
+	for _, options := range []*SignOptions{
+		nil,
+		{},
+		{Passphrase: "passphrase"},
+		{Expiration: expiration},
+		{DigestAlgorithm: digest.SHA256},
+		{DigestAlgorithm: digest.SHA512},
+	} {
+		signature, err := SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, TestKeyFingerprint, options)
+		require.NoError(t, err, "%#v", options)
+
+		verified, err := VerifyDockerManifestSignature(signature, manifest, TestImageSignatureReference, mech, TestKeyFingerprint)
+		assert.NoError(t, err, "%#v", options)
+		assert.Equal(t, TestImageSignatureReference, verified.DockerReference, "%#v", options)
+		if options != nil && options.DigestAlgorithm != "" {
+			assert.Equal(t, options.DigestAlgorithm.FromBytes(manifest), verified.DockerManifestDigest, "%#v", options)
+		} else {
+			assert.Equal(t, TestImageManifestDigest, verified.DockerManifestDigest, "%#v", options)
+		}
+		info, err := GetUntrustedSignatureInformationWithoutVerifying(signature)
+		require.NoError(t, err, "%#v", options)
+		if options != nil && !options.Expiration.IsZero() {
+			require.NotNil(t, info.UntrustedExpiration, "%#v", options)
+			assert.Equal(t, expiration, *info.UntrustedExpiration, "%#v", options)
+		} else {
+			assert.Nil(t, info.UntrustedExpiration, "%#v", options)
+		}
+	}
+
+	// Unavailable algorithm
+	_, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, TestKeyFingerprint, &SignOptions{DigestAlgorithm: digest.Algorithm("md5")})
+	assert.Error(t, err)
+
+	// Error computing Docker manifest
+	invalidManifest, err := ioutil.ReadFile("fixtures/v2s1-invalid-signatures.manifest.json")
+	require.NoError(t, err)
+	_, err = SignDockerManifestWithOptions(invalidManifest, TestImageSignatureReference, mech, TestKeyFingerprint, &SignOptions{Passphrase: "passphrase"})
+	assert.Error(t, err)
+
+	// Error signing
+	for _, options := range []*SignOptions{{}, {Passphrase: "passphrase"}} {
+		_, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, "this fingerprint doesn't exist", options)
+		assert.Error(t, err, "%#v", options)
+	}
+}
+
+func TestSignDockerManifestWithOptionsMetadata(t *testing.T) {
+	mech, _, err := newKeyListMechanismMock([][]byte{[]byte("A")})
+	require.NoError(t, err)
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	timestamp := time.Unix(1484683104, 0)
+	options := &SignOptions{CreatorID: "test creator", Timestamp: timestamp}
+
+	// Successful signing
+	signature, err := SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, "A", options)
+	require.NoError(t, err)
+
+	verified, err := VerifyDockerManifestSignature(signature, manifest, TestImageSignatureReference, mech, "A")
+	require.NoError(t, err)
+	assert.Equal(t, TestImageSignatureReference, verified.DockerReference)
+	assert.Equal(t, TestImageManifestDigest, verified.DockerManifestDigest)
+	assert.Equal(t, "test creator", verified.CreatorID)
+	assert.Equal(t, timestamp, verified.Timestamp)
+
+	// Error computing Docker manifest
+	invalidManifest, err := ioutil.ReadFile("fixtures/v2s1-invalid-signatures.manifest.json")
+	require.NoError(t, err)
+	_, err = SignDockerManifestWithOptions(invalidManifest, TestImageSignatureReference, mech, "A", options)
+	assert.Error(t, err)
+
+	// Error signing
+	_, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, "this key doesn't exist", options)
+	assert.Error(t, err)
+
+	// A passphrase requires a SigningMechanismWithPassphrase
+	_, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, "A", &SignOptions{Passphrase: "passphrase"})
+	assert.Error(t, err)
+}
+
+func TestVerifyDockerManifestSignatureStrict(t *testing.T) {
+	mech, _, err := newKeyListMechanismMock([][]byte{[]byte("A")})
+	require.NoError(t, err)
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	validSig := newUntrustedSignature(TestImageManifestDigest, TestImageSignatureReference)
+	validJSON, err := validSig.MarshalJSON()
+	require.NoError(t, err)
+
+	// Successful verification
+	sig, err := VerifyDockerManifestSignatureStrict(append([]byte("A\n"), validJSON...), manifest, TestImageSignatureReference, mech, "A")
+	require.NoError(t, err)
+	assert.Equal(t, TestImageSignatureReference, sig.DockerReference)
+	assert.Equal(t, TestImageManifestDigest, sig.DockerManifestDigest)
+
+	// Unrecognized optional fields are accepted by VerifyDockerManifestSignature, but rejected by VerifyDockerManifestSignatureStrict
+	for _, fn := range []func(mSI){
+		func(v mSI) { x(v, "optional")["unexpected"] = 1 },
+		func(v mSI) { x(v, "optional")["format-version"] = signatureFormatVersion + 1 },
+	} {
+		signature := append([]byte("A\n"), modifiedUntrustedSignatureJSON(t, validJSON, fn)...)
+		sig, err := VerifyDockerManifestSignature(signature, manifest, TestImageSignatureReference, mech, "A")
+		require.NoError(t, err)
+		assert.Equal(t, TestImageManifestDigest, sig.DockerManifestDigest)
+
+		sig, err = VerifyDockerManifestSignatureStrict(signature, manifest, TestImageSignatureReference, mech, "A")
+		assert.Error(t, err)
+		assert.Nil(t, sig)
+	}
+
+	// Other verification failures are reported as usual
+	sig, err = VerifyDockerManifestSignatureStrict(append([]byte("A\n"), validJSON...), manifest, "example.com/doesnt/match", mech, "A")
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+}
+
+func TestVerifyDockerManifestSignatureUsingKeyIdentityList(t *testing.T) {
+	mech, err := newGPGSigningMechanismInDirectory(testGPGHomeDirectory)
+	require.NoError(t, err)
+	defer mech.Close()
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	signature, err := ioutil.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+
+	// Successful verification
+	for _, keyIdentities := range [][]string{
+		{TestKeyFingerprint},
+		{"unexpected fingerprint", TestKeyFingerprint},
+	} {
+		sig, err := VerifyDockerManifestSignatureUsingKeyIdentityList(signature, manifest, TestImageSignatureReference, mech, keyIdentities)
+		require.NoError(t, err)
+		assert.Equal(t, TestImageSignatureReference, sig.DockerReference)
+		assert.Equal(t, TestImageManifestDigest, sig.DockerManifestDigest)
+	}
+
+	// Key fingerprint mismatch
+	for _, keyIdentities := range [][]string{
+		{},
+		{"unexpected fingerprint"},
+		{"unexpected fingerprint", "another unexpected fingerprint"},
+	} {
+		sig, err := VerifyDockerManifestSignatureUsingKeyIdentityList(signature, manifest, TestImageSignatureReference, mech, keyIdentities)
+		assert.Error(t, err)
+		assert.Nil(t, sig)
+	}
+
+	// Docker reference mismatch
+	sig, err := VerifyDockerManifestSignatureUsingKeyIdentityList(signature, manifest, "example.com/doesnt/match", mech, []string{TestKeyFingerprint})
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+
+	// Docker manifest digest mismatch
+	sig, err = VerifyDockerManifestSignatureUsingKeyIdentityList(signature, []byte("unexpected manifest"), TestImageSignatureReference, mech, []string{TestKeyFingerprint})
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+}
+
 func TestVerifyDockerManifestSignature(t *testing.T) {
 	mech, err := newGPGSigningMechanismInDirectory(testGPGHomeDirectory)
 	require.NoError(t, err)
@@ -11,4 +11,10 @@ const (
 	TestKeyFingerprint = "1D8230F6CDB6A06716E414C1DB72F2188BB46CC8"
 	// TestKeyShortID is the short ID of the private key in this directory.
 	TestKeyShortID = "DB72F2188BB46CC8"
+	// TestDirImageSignatureCreatorID is the creator recorded in "dir-img-*/signature-1"
+	TestDirImageSignatureCreatorID = "atomic 0.1.13-dev"
+	// TestDirImageSignatureTimestamp is the timestamp recorded in "dir-img-*/signature-1"
+	TestDirImageSignatureTimestamp = 1464398954
+	// TestDirImageSignature2Timestamp is the timestamp recorded in "dir-img-valid-2/signature-2"
+	TestDirImageSignature2Timestamp = 1464640051
 )
@@ -0,0 +1,63 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+package signature
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+)
+
+// oidFulcioOIDCIssuer is the Fulcio certificate extension containing the OIDC issuer of the signing identity.
+var oidFulcioOIDCIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+
+// fulcioTrustRoot contains the trusted CA certificates and the required identity for validating Fulcio-issued certificates.
+type fulcioTrustRoot struct {
+	caCertificates *x509.CertPool
+	oidcIssuer     string
+	subjectEmail   string
+}
+
+// verifyFulcioCertificate verifies that the PEM-encoded untrustedCertificatePEM, possibly using intermediate certificates
+// from untrustedIntermediateChainPEM, was issued by f.caCertificates at verificationTime, for the identity required by f.
+// It returns the public key certified by the certificate.
+func (f *fulcioTrustRoot) verifyFulcioCertificate(untrustedCertificatePEM, untrustedIntermediateChainPEM []byte, verificationTime time.Time) (crypto.PublicKey, error) {
+	cert, err := verifyX509CertificateChain(f.caCertificates, untrustedCertificatePEM, untrustedIntermediateChainPEM, verificationTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// The certificate is now trusted, and so are the identity claims in it.
+	// (x509.ParseCertificate rejects certificates with duplicate extensions.)
+	gotOIDCIssuer := false
+	var oidcIssuer string
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidFulcioOIDCIssuer) {
+			gotOIDCIssuer = true
+			// The value of this extension is the raw issuer URL, not an ASN.1-encoded value.
+			oidcIssuer = string(ext.Value)
+			break
+		}
+	}
+	if !gotOIDCIssuer {
+		return nil, InvalidSignatureError{msg: "Fulcio certificate is missing the OIDC issuer extension"}
+	}
+	if oidcIssuer != f.oidcIssuer {
+		return nil, newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, fmt.Sprintf("Required OIDC issuer %q, but the certificate was issued for %q", f.oidcIssuer, oidcIssuer))
+	}
+
+	emailMatches := false
+	for _, email := range cert.EmailAddresses {
+		if email == f.subjectEmail {
+			emailMatches = true
+			break
+		}
+	}
+	if !emailMatches {
+		return nil, newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, fmt.Sprintf("Required email %q not found in the certificate (got %q)", f.subjectEmail, cert.EmailAddresses))
+	}
+
+	return cert.PublicKey, nil
+}
@@ -0,0 +1,71 @@
+package signature
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fulcioTestLeafTemplate returns a template for a Fulcio-like code signing certificate for oidcIssuer and email.
+// If oidcIssuer is "", the OIDC issuer extension is not included.
+func fulcioTestLeafTemplate(oidcIssuer, email string) *x509.Certificate {
+	template := x509TestLeafTemplate("")
+	template.EmailAddresses = []string{email}
+	if oidcIssuer != "" {
+		template.ExtraExtensions = []pkix.Extension{{Id: oidFulcioOIDCIssuer, Value: []byte(oidcIssuer)}}
+	}
+	return template
+}
+
+func TestFulcioTrustRootVerifyFulcioCertificate(t *testing.T) {
+	const testIssuer = "https://issuer.example.com"
+	const testEmail = "user@example.com"
+	caCert, caKey, caPEM := x509TestCertificate(t, x509TestCATemplate("Fulcio CA"), nil, nil)
+	intermediateCert, intermediateKey, intermediatePEM := x509TestCertificate(t, x509TestCATemplate("Fulcio intermediate"), caCert, caKey)
+	caCertificates, err := newX509CertPool([][]byte{caPEM})
+	require.NoError(t, err)
+	trustRoot := fulcioTrustRoot{
+		caCertificates: caCertificates,
+		oidcIssuer:     testIssuer,
+		subjectEmail:   testEmail,
+	}
+
+	// Success
+	leafCert, _, leafPEM := x509TestCertificate(t, fulcioTestLeafTemplate(testIssuer, testEmail), intermediateCert, intermediateKey)
+	publicKey, err := trustRoot.verifyFulcioCertificate(leafPEM, intermediatePEM, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, leafCert.PublicKey, publicKey)
+
+	// Missing intermediate certificate
+	_, err = trustRoot.verifyFulcioCertificate(leafPEM, nil, time.Now())
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+
+	// Certificate not valid at verificationTime
+	_, err = trustRoot.verifyFulcioCertificate(leafPEM, intermediatePEM, time.Now().Add(2*time.Hour))
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+
+	// Issued by an unknown CA
+	otherCACert, otherCAKey, _ := x509TestCertificate(t, x509TestCATemplate("Other CA"), nil, nil)
+	_, _, otherLeafPEM := x509TestCertificate(t, fulcioTestLeafTemplate(testIssuer, testEmail), otherCACert, otherCAKey)
+	_, err = trustRoot.verifyFulcioCertificate(otherLeafPEM, nil, time.Now())
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+
+	// Missing OIDC issuer extension
+	_, _, noIssuerPEM := x509TestCertificate(t, fulcioTestLeafTemplate("", testEmail), caCert, caKey)
+	_, err = trustRoot.verifyFulcioCertificate(noIssuerPEM, nil, time.Now())
+	assert.IsType(t, InvalidSignatureError{}, err)
+
+	// Unexpected OIDC issuer
+	_, _, otherIssuerPEM := x509TestCertificate(t, fulcioTestLeafTemplate("https://other.example.com", testEmail), caCert, caKey)
+	_, err = trustRoot.verifyFulcioCertificate(otherIssuerPEM, nil, time.Now())
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+
+	// Unexpected email
+	_, _, otherEmailPEM := x509TestCertificate(t, fulcioTestLeafTemplate(testIssuer, "other@example.com"), caCert, caKey)
+	_, err = trustRoot.verifyFulcioCertificate(otherEmailPEM, nil, time.Now())
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+}
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"time"
 
+	"github.com/containers/image/types"
 	"golang.org/x/crypto/openpgp"
 )
 
@@ -34,6 +36,26 @@ type SigningMechanism interface {
 	UntrustedSignatureContents(untrustedSignature []byte) (untrustedContents []byte, shortKeyIdentifier string, err error)
 }
 
+// SigningMechanismWithPassphrase is a SigningMechanism which can also use a passphrase-protected private key for signing.
+// Use a type assertion to determine whether a SigningMechanism supports this.
+type SigningMechanismWithPassphrase interface {
+	SigningMechanism
+	// SignWithPassphrase creates a (non-detached) signature of input using keyIdentity,
+	// unlocking the private key using passphrase, without any user interaction.
+	// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+	SignWithPassphrase(input []byte, keyIdentity, passphrase string) ([]byte, error)
+}
+
+// SigningMechanismWithSingleKey is a SigningMechanism which signs using a single, fixed, key (e.g. one held in a hardware token).
+// Use a type assertion to determine whether a SigningMechanism supports this.
+type SigningMechanismWithSingleKey interface {
+	SigningMechanism
+	// KeyIdentity returns the identity of the signing key, to be used as the keyIdentity parameter of Sign.
+	KeyIdentity() string
+	// PublicKey returns the public key in the binary OpenPGP format, e.g. to be trusted by a "signedBy" policy requirement.
+	PublicKey() []byte
+}
+
 // SigningNotSupportedError is returned when trying to sign using a mechanism which does not support that.
 type SigningNotSupportedError string
 
@@ -41,6 +63,13 @@ func (err SigningNotSupportedError) Error() string {
 	return string(err)
 }
 
+// SigningMechanismFactory returns a new SigningMechanism which recognizes _only_ public keys from the
+// supplied blobs (each of which may contain any number of keys), and returns the identities of these keys.
+// It allows users to replace the default GPG implementation used when evaluating "signedBy" policy requirements,
+// see PolicyContext.SigningMechanismFactory.
+// The caller must call .Close() on the returned SigningMechanism.
+type SigningMechanismFactory func(keyBlobs [][]byte) (SigningMechanism, []string, error)
+
 // NewGPGSigningMechanism returns a new GPG/OpenPGP signing mechanism for the user’s default
 // GPG configuration ($GNUPGHOME / ~/.gnupg)
 // The caller must call .Close() on the returned SigningMechanism.
@@ -48,12 +77,56 @@ func NewGPGSigningMechanism() (SigningMechanism, error) {
 	return newGPGSigningMechanismInDirectory("")
 }
 
+// NewGPGSigningMechanismInDirectory returns a new GPG/OpenPGP signing mechanism using the GPG configuration in dir,
+// or the user’s default GPG configuration ($GNUPGHOME / ~/.gnupg) if dir is "".
+// The caller must call .Close() on the returned SigningMechanism.
+func NewGPGSigningMechanismInDirectory(dir string) (SigningMechanism, error) {
+	return newGPGSigningMechanismInDirectory(dir)
+}
+
+// NewGPGSigningMechanismForSystemContext returns a new GPG/OpenPGP signing mechanism using the GPG configuration
+// specified by sys.GPGHomeDirectory, or the user’s default GPG configuration ($GNUPGHOME / ~/.gnupg) if that is not set.
+// sys may be nil.
+// The caller must call .Close() on the returned SigningMechanism.
+func NewGPGSigningMechanismForSystemContext(sys *types.SystemContext) (SigningMechanism, error) {
+	dir := ""
+	if sys != nil {
+		dir = sys.GPGHomeDirectory
+	}
+	return newGPGSigningMechanismInDirectory(dir)
+}
+
 // NewEphemeralGPGSigningMechanism returns a new GPG/OpenPGP signing mechanism which
 // recognizes _only_ public keys from the supplied blob, and returns the identities
 // of these keys.
 // The caller must call .Close() on the returned SigningMechanism.
 func NewEphemeralGPGSigningMechanism(blob []byte) (SigningMechanism, []string, error) {
-	return newEphemeralGPGSigningMechanism(blob)
+	return newEphemeralGPGSigningMechanism([][]byte{blob})
+}
+
+// PKCS11SigningMechanismOptions configures NewPKCS11SigningMechanism.
+type PKCS11SigningMechanismOptions struct {
+	// URI is a PKCS#11 URI (RFC 7512) identifying the token and the private key, e.g.
+	// "pkcs11:token=release;object=signing-key?module-path=/usr/lib64/pkcs11/opensc-pkcs11.so".
+	// The "module-path" query attribute is required.
+	URI string
+	// PINCallback, if not nil, is called to obtain the user PIN of the token, unless URI contains a "pin-value" attribute.
+	// If neither is available, the token is used without logging in.
+	PINCallback func() (string, error)
+	// KeyCreationTime is used as the creation time of the OpenPGP key; it affects the key identity,
+	// so it must be the same every time the key is used.  Defaults to the Unix epoch.
+	KeyCreationTime time.Time
+	// UserID is the OpenPGP user ID of the key.  Defaults to the "object" attribute of URI.
+	UserID string
+}
+
+// NewPKCS11SigningMechanism returns a new GPG/OpenPGP signing mechanism which signs using a private key held
+// in a PKCS#11 token (e.g. a smartcard or an HSM), so that the private key is never available on disk or in memory.
+// The signatures can be verified by other signing mechanisms using the OpenPGP public key returned by .PublicKey().
+// PKCS#11 signing is only supported when built with the containers_image_pkcs11 build tag.
+// The caller must call .Close() on the returned SigningMechanism.
+func NewPKCS11SigningMechanism(options *PKCS11SigningMechanismOptions) (SigningMechanismWithSingleKey, error) {
+	return newPKCS11SigningMechanism(options)
 }
 
 // gpgUntrustedSignatureContents returns UNTRUSTED contents of the signature WITHOUT ANY VERIFICATION,
@@ -9,11 +9,13 @@ import (
 	"os"
 
 	"github.com/mtrmac/gpgme"
+	"github.com/pkg/errors"
 )
 
 // A GPG/OpenPGP signing mechanism, implemented using gpgme.
 type gpgmeSigningMechanism struct {
 	ctx          *gpgme.Context
+	dir          string // The GPG home directory used by ctx, or "" for the default one
 	ephemeralDir string // If not "", a directory to be removed on Close()
 }
 
@@ -26,15 +28,16 @@ func newGPGSigningMechanismInDirectory(optionalDir string) (SigningMechanism, er
 	}
 	return &gpgmeSigningMechanism{
 		ctx:          ctx,
+		dir:          optionalDir,
 		ephemeralDir: "",
 	}, nil
 }
 
 // newEphemeralGPGSigningMechanism returns a new GPG/OpenPGP signing mechanism which
-// recognizes _only_ public keys from the supplied blob, and returns the identities
+// recognizes _only_ public keys from the supplied blobs, and returns the identities
 // of these keys.
 // The caller must call .Close() on the returned SigningMechanism.
-func newEphemeralGPGSigningMechanism(blob []byte) (SigningMechanism, []string, error) {
+func newEphemeralGPGSigningMechanism(blobs [][]byte) (SigningMechanism, []string, error) {
 	dir, err := ioutil.TempDir("", "containers-ephemeral-gpg-")
 	if err != nil {
 		return nil, nil, err
@@ -51,11 +54,16 @@ func newEphemeralGPGSigningMechanism(blob []byte) (SigningMechanism, []string, e
 	}
 	mech := &gpgmeSigningMechanism{
 		ctx:          ctx,
+		dir:          dir,
 		ephemeralDir: dir,
 	}
-	keyIdentities, err := mech.importKeysFromBytes(blob)
-	if err != nil {
-		return nil, nil, err
+	keyIdentities := []string{}
+	for _, blob := range blobs {
+		ki, err := mech.importKeysFromBytes(blob)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyIdentities = append(keyIdentities, ki...)
 	}
 
 	removeDir = false
@@ -119,7 +127,39 @@ func (m *gpgmeSigningMechanism) SupportsSigning() error {
 // Sign creates a (non-detached) signature of input using keyIdentity.
 // Fails with a SigningNotSupportedError if the mechanism does not support signing.
 func (m *gpgmeSigningMechanism) Sign(input []byte, keyIdentity string) ([]byte, error) {
-	key, err := m.ctx.GetKey(keyIdentity, true)
+	return gpgmeSign(m.ctx, input, keyIdentity)
+}
+
+// SignWithPassphrase creates a (non-detached) signature of input using keyIdentity,
+// unlocking the private key using passphrase, without any user interaction.
+// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+func (m *gpgmeSigningMechanism) SignWithPassphrase(input []byte, keyIdentity, passphrase string) ([]byte, error) {
+	// Use a separate context, so that the passphrase configuration does not affect concurrent users of m.ctx.
+	ctx, err := newGPGMEContext(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Release()
+	// Reply to passphrase requests directly instead of asking gpg-agent to prompt the user (which requires GnuPG ≥ 2.1,
+	// and "allow-loopback-pinentry" in gpg-agent.conf for older 2.1.x versions).
+	if err := ctx.SetCallback(func(uidHint string, prevWasBad bool, f *os.File) error {
+		if prevWasBad {
+			return errors.New("Invalid passphrase")
+		}
+		_, err := f.WriteString(passphrase + "\n")
+		return err
+	}); err != nil {
+		return nil, errors.Wrap(err, "Error setting a GPG passphrase callback")
+	}
+	if err := ctx.SetPinEntryMode(gpgme.PinEntryLoopback); err != nil {
+		return nil, errors.Wrap(err, "Error setting GPG pinentry mode")
+	}
+	return gpgmeSign(ctx, input, keyIdentity)
+}
+
+// gpgmeSign creates a (non-detached) signature of input using keyIdentity and ctx.
+func gpgmeSign(ctx *gpgme.Context, input []byte, keyIdentity string) ([]byte, error) {
+	key, err := ctx.GetKey(keyIdentity, true)
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +172,7 @@ func (m *gpgmeSigningMechanism) Sign(input []byte, keyIdentity string) ([]byte,
 	if err != nil {
 		return nil, err
 	}
-	if err = m.ctx.Sign([]*gpgme.Key{key}, inputData, sigData, gpgme.SigModeNormal); err != nil {
+	if err = ctx.Sign([]*gpgme.Key{key}, inputData, sigData, gpgme.SigModeNormal); err != nil {
 		return nil, err
 	}
 	return sigBuffer.Bytes(), nil
@@ -0,0 +1,442 @@
+// +build containers_image_pkcs11
+
+// This file uses github.com/miekg/pkcs11, which is not in vendor.conf; builds using the containers_image_pkcs11
+// build tag must provide it separately.
+
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
+)
+
+// pkcs11URI contains the attributes of a PKCS#11 URI (RFC 7512) used to locate a signing key.
+type pkcs11URI struct {
+	modulePath string
+	// Token attributes; "" means any value.
+	token        string
+	manufacturer string
+	serial       string
+	model        string
+	slotID       *uint
+	// Object attributes; "" or nil means any value.
+	object string
+	id     []byte
+	pin    *string
+}
+
+// parsePKCS11URI parses a PKCS#11 URI (RFC 7512).
+func parsePKCS11URI(uri string) (*pkcs11URI, error) {
+	const prefix = "pkcs11:"
+	if !strings.HasPrefix(uri, prefix) {
+		return nil, errors.Errorf("Invalid PKCS#11 URI %q: missing %q prefix", uri, prefix)
+	}
+	pathAttributes, queryAttributes := uri[len(prefix):], ""
+	if i := strings.IndexByte(pathAttributes, '?'); i != -1 {
+		pathAttributes, queryAttributes = pathAttributes[:i], pathAttributes[i+1:]
+	}
+
+	res := pkcs11URI{}
+	seen := map[string]struct{}{}
+	parseAttributes := func(attributes, separator string, handle func(name, value string) error) error {
+		if attributes == "" {
+			return nil
+		}
+		for _, attribute := range strings.Split(attributes, separator) {
+			parts := strings.SplitN(attribute, "=", 2)
+			if len(parts) != 2 {
+				return errors.Errorf("Invalid PKCS#11 URI %q: attribute %q has no value", uri, attribute)
+			}
+			name := parts[0]
+			value, err := url.PathUnescape(parts[1])
+			if err != nil {
+				return errors.Wrapf(err, "Invalid PKCS#11 URI %q", uri)
+			}
+			if _, ok := seen[name]; ok {
+				return errors.Errorf("Invalid PKCS#11 URI %q: duplicate attribute %q", uri, name)
+			}
+			seen[name] = struct{}{}
+			if err := handle(name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := parseAttributes(pathAttributes, ";", func(name, value string) error {
+		switch name {
+		case "token":
+			res.token = value
+		case "manufacturer":
+			res.manufacturer = value
+		case "serial":
+			res.serial = value
+		case "model":
+			res.model = value
+		case "slot-id":
+			slotID, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return errors.Wrapf(err, "Invalid PKCS#11 URI %q: invalid slot-id", uri)
+			}
+			s := uint(slotID)
+			res.slotID = &s
+		case "object":
+			res.object = value
+		case "id":
+			res.id = []byte(value)
+		case "type":
+			if value != "private" {
+				return errors.Errorf("Invalid PKCS#11 URI %q: object type %q is not a private key", uri, value)
+			}
+		default:
+			return errors.Errorf("Unsupported attribute %q in PKCS#11 URI %q", name, uri)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := parseAttributes(queryAttributes, "&", func(name, value string) error {
+		switch name {
+		case "module-path":
+			res.modulePath = value
+		case "pin-value":
+			pin := value
+			res.pin = &pin
+		default:
+			return errors.Errorf("Unsupported attribute %q in PKCS#11 URI %q", name, uri)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if res.modulePath == "" {
+		return nil, errors.Errorf("PKCS#11 URI %q does not specify a module-path", uri)
+	}
+	return &res, nil
+}
+
+// newPKCS11SigningMechanism returns a new GPG/OpenPGP signing mechanism using a key in a PKCS#11 token, configured by options.
+// The caller must call .Close() on the returned SigningMechanism.
+func newPKCS11SigningMechanism(options *PKCS11SigningMechanismOptions) (SigningMechanismWithSingleKey, error) {
+	uri, err := parsePKCS11URI(options.URI)
+	if err != nil {
+		return nil, err
+	}
+	creationTime := options.KeyCreationTime
+	if creationTime.IsZero() {
+		creationTime = time.Unix(0, 0)
+	}
+	userID := options.UserID
+	if userID == "" {
+		userID = uri.object
+	}
+
+	signer, err := openPKCS11Signer(uri, options.PINCallback)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newCryptoSignerSigningMechanism(signer, creationTime, userID, signer.close)
+	if err != nil {
+		signer.close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// pkcs11Signer is a crypto.Signer using a private key in a PKCS#11 token.
+type pkcs11Signer struct {
+	ctx         *pkcs11.Ctx
+	session     pkcs11.SessionHandle
+	sessionOpen bool
+	loggedIn    bool
+	privateKey  pkcs11.ObjectHandle
+	publicKey   crypto.PublicKey
+	mutex       sync.Mutex // Serializes operations using session
+}
+
+// openPKCS11Signer returns a pkcs11Signer for the key identified by uri, obtaining the PIN from pinCallback if necessary.
+// The caller must call .close() on the returned signer.
+func openPKCS11Signer(uri *pkcs11URI, pinCallback func() (string, error)) (*pkcs11Signer, error) {
+	ctx := pkcs11.New(uri.modulePath)
+	if ctx == nil {
+		return nil, errors.Errorf("Error loading PKCS#11 module %s", uri.modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, errors.Wrapf(err, "Error initializing PKCS#11 module %s", uri.modulePath)
+	}
+	s := &pkcs11Signer{ctx: ctx}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			s.close()
+		}
+	}()
+
+	slot, err := findPKCS11Slot(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error opening a PKCS#11 session")
+	}
+	s.session = session
+	s.sessionOpen = true
+
+	var pin *string
+	if uri.pin != nil {
+		pin = uri.pin
+	} else if pinCallback != nil {
+		p, err := pinCallback()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error obtaining the PKCS#11 token PIN")
+		}
+		pin = &p
+	}
+	if pin != nil {
+		if err := ctx.Login(session, pkcs11.CKU_USER, *pin); err != nil {
+			if e, ok := err.(pkcs11.Error); !ok || e != pkcs11.CKR_USER_ALREADY_LOGGED_IN {
+				return nil, errors.Wrap(err, "Error logging in to the PKCS#11 token")
+			}
+		} else {
+			s.loggedIn = true
+		}
+	}
+
+	s.privateKey, err = findPKCS11Object(ctx, session, pkcs11.CKO_PRIVATE_KEY, uri)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyObject, err := findPKCS11Object(ctx, session, pkcs11.CKO_PUBLIC_KEY, uri)
+	if err != nil {
+		return nil, err
+	}
+	s.publicKey, err = pkcs11PublicKey(ctx, session, publicKeyObject)
+	if err != nil {
+		return nil, err
+	}
+	succeeded = true
+	return s, nil
+}
+
+// findPKCS11Slot returns the slot containing the token identified by uri.
+func findPKCS11Slot(ctx *pkcs11.Ctx, uri *pkcs11URI) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error listing PKCS#11 slots")
+	}
+	for _, slot := range slots {
+		if uri.slotID != nil && slot != *uri.slotID {
+			continue
+		}
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, errors.Wrapf(err, "Error reading information about the PKCS#11 token in slot %d", slot)
+		}
+		if (uri.token == "" || info.Label == uri.token) &&
+			(uri.manufacturer == "" || info.ManufacturerID == uri.manufacturer) &&
+			(uri.serial == "" || info.SerialNumber == uri.serial) &&
+			(uri.model == "" || info.Model == uri.model) {
+			return slot, nil
+		}
+	}
+	return 0, errors.New("No matching PKCS#11 token found")
+}
+
+// findPKCS11Object returns the single object of class identified by uri.
+func findPKCS11Object(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, uri *pkcs11URI) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if uri.object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, uri.object))
+	}
+	if uri.id != nil {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, uri.id))
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, errors.Wrap(err, "Error searching for PKCS#11 objects")
+	}
+	objects, _, err := ctx.FindObjects(session, 2)
+	if err2 := ctx.FindObjectsFinal(session); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "Error searching for PKCS#11 objects")
+	}
+	kind := "public"
+	if class == pkcs11.CKO_PRIVATE_KEY {
+		kind = "private"
+	}
+	switch len(objects) {
+	case 0:
+		return 0, errors.Errorf("No matching PKCS#11 %s key found", kind)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, errors.Errorf("More than one matching PKCS#11 %s key found", kind)
+	}
+}
+
+// pkcs11ECCurves maps DER-encoded CKA_EC_PARAMS values to the supported curves.
+var pkcs11ECCurves = map[string]elliptic.Curve{
+	"\x06\x08\x2a\x86\x48\xce\x3d\x03\x01\x07": elliptic.P256(), // 1.2.840.10045.3.1.7
+	"\x06\x05\x2b\x81\x04\x00\x22":             elliptic.P384(), // 1.3.132.0.34
+	"\x06\x05\x2b\x81\x04\x00\x23":             elliptic.P521(), // 1.3.132.0.35
+}
+
+// pkcs11PublicKey returns the public key in the PKCS#11 object.
+func pkcs11PublicKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, object pkcs11.ObjectHandle) (crypto.PublicKey, error) {
+	attrs, err := ctx.GetAttributeValue(session, object, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil)})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading the PKCS#11 public key type")
+	}
+	keyType := attrs[0].Value
+	switch {
+	case pkcs11AttributeHasUintValue(keyType, pkcs11.CKK_RSA):
+		attrs, err := ctx.GetAttributeValue(session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading the PKCS#11 RSA public key")
+		}
+		exponent := new(big.Int).SetBytes(attrs[1].Value)
+		if !exponent.IsInt64() || exponent.Int64() > int64(^uint32(0)>>1) {
+			return nil, errors.New("Unsupported PKCS#11 RSA public key exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(exponent.Int64()),
+		}, nil
+
+	case pkcs11AttributeHasUintValue(keyType, pkcs11.CKK_EC):
+		attrs, err := ctx.GetAttributeValue(session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading the PKCS#11 EC public key")
+		}
+		return pkcs11ECDSAPublicKey(attrs[0].Value, attrs[1].Value)
+
+	default:
+		return nil, errors.Errorf("Unsupported PKCS#11 key type %x", keyType)
+	}
+}
+
+// pkcs11ECDSAPublicKey returns an ECDSA public key from the CKA_EC_PARAMS and CKA_EC_POINT attribute values.
+func pkcs11ECDSAPublicKey(params, point []byte) (*ecdsa.PublicKey, error) {
+	curve, ok := pkcs11ECCurves[string(params)]
+	if !ok {
+		return nil, errors.Errorf("Unsupported PKCS#11 EC curve parameters %x", params)
+	}
+	// CKA_EC_POINT should be a DER-encoded OCTET STRING, but some tokens return the raw point.
+	var rawPoint []byte
+	if rest, err := asn1.Unmarshal(point, &rawPoint); err != nil || len(rest) != 0 {
+		rawPoint = point
+	}
+	x, y := elliptic.Unmarshal(curve, rawPoint)
+	if x == nil {
+		return nil, errors.New("Invalid PKCS#11 EC public key point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// pkcs11AttributeHasUintValue returns true if the value of a CK_ULONG attribute, as returned by GetAttributeValue, is expected.
+func pkcs11AttributeHasUintValue(value []byte, expected uint) bool {
+	return bytes.Equal(value, pkcs11.NewAttribute(0, expected).Value)
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// pkcs1DigestInfoPrefixes contains the DER-encoded DigestInfo prefixes used in PKCS#1 v1.5 signatures, indexed by hash.
+var pkcs1DigestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// Sign implements crypto.Signer.  For ECDSA keys, the signature is ASN.1-encoded, as with ecdsa.PrivateKey.
+func (s *pkcs11Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mechanism uint
+	var input []byte
+	switch s.publicKey.(type) {
+	case *rsa.PublicKey:
+		prefix, ok := pkcs1DigestInfoPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, errors.Errorf("Unsupported hash function %v", opts.HashFunc())
+		}
+		if len(digest) != opts.HashFunc().Size() {
+			return nil, errors.Errorf("Unexpected digest length %d", len(digest))
+		}
+		mechanism = pkcs11.CKM_RSA_PKCS
+		input = append(append([]byte{}, prefix...), digest...)
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.CKM_ECDSA
+		input = digest
+	default: // Coverage: This should never happen, pkcs11PublicKey only returns the above types.
+		return nil, errors.Errorf("Unsupported public key type %T", s.publicKey)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, s.privateKey); err != nil {
+		return nil, errors.Wrap(err, "Error signing using the PKCS#11 token")
+	}
+	sig, err := s.ctx.Sign(s.session, input)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error signing using the PKCS#11 token")
+	}
+	if mechanism == pkcs11.CKM_ECDSA {
+		return pkcs11ECDSASignatureToASN1(sig)
+	}
+	return sig, nil
+}
+
+// pkcs11ECDSASignatureToASN1 converts a CKM_ECDSA signature (r || s) to the ASN.1 format used by crypto.Signer.
+func pkcs11ECDSASignatureToASN1(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, fmt.Errorf("Invalid PKCS#11 ECDSA signature length %d", len(sig))
+	}
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(sig[:len(sig)/2]),
+		S: new(big.Int).SetBytes(sig[len(sig)/2:]),
+	})
+}
+
+// close releases all resources associated with s.
+func (s *pkcs11Signer) close() error {
+	var err error
+	if s.loggedIn {
+		err = s.ctx.Logout(s.session)
+		s.loggedIn = false
+	}
+	if s.sessionOpen {
+		if err2 := s.ctx.CloseSession(s.session); err == nil {
+			err = err2
+		}
+		s.sessionOpen = false
+	}
+	if err2 := s.ctx.Finalize(); err == nil {
+		err = err2
+	}
+	s.ctx.Destroy()
+	return err
+}
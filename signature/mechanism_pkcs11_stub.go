@@ -0,0 +1,9 @@
+// +build !containers_image_pkcs11
+
+package signature
+
+// newPKCS11SigningMechanism returns a new GPG/OpenPGP signing mechanism using a key in a PKCS#11 token, configured by options.
+// The caller must call .Close() on the returned SigningMechanism.
+func newPKCS11SigningMechanism(options *PKCS11SigningMechanismOptions) (SigningMechanismWithSingleKey, error) {
+	return nil, SigningNotSupportedError("PKCS#11 signing is only supported in github.com/containers/image built with the containers_image_pkcs11 build tag")
+}
@@ -0,0 +1,117 @@
+// +build containers_image_pkcs11
+
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	slotID := uint(3)
+	pin := "12 34"
+	for _, c := range []struct {
+		uri      string
+		expected pkcs11URI
+	}{
+		{"pkcs11:?module-path=/usr/lib/p11.so", pkcs11URI{modulePath: "/usr/lib/p11.so"}},
+		{
+			"pkcs11:token=release;object=signing-key?module-path=/usr/lib/p11.so",
+			pkcs11URI{modulePath: "/usr/lib/p11.so", token: "release", object: "signing-key"},
+		},
+		{
+			"pkcs11:token=My%20token;manufacturer=ACME;serial=0123;model=HSM;slot-id=3;id=%01%02;type=private" +
+				"?module-path=/usr/lib/p11.so&pin-value=12%2034",
+			pkcs11URI{
+				modulePath:   "/usr/lib/p11.so",
+				token:        "My token",
+				manufacturer: "ACME",
+				serial:       "0123",
+				model:        "HSM",
+				slotID:       &slotID,
+				id:           []byte{1, 2},
+				pin:          &pin,
+			},
+		},
+	} {
+		res, err := parsePKCS11URI(c.uri)
+		require.NoError(t, err, c.uri)
+		assert.Equal(t, &c.expected, res, c.uri)
+	}
+
+	for _, uri := range []string{
+		"",
+		"/usr/lib/p11.so",                   // Not a URI
+		"file:?module-path=/usr/lib/p11.so", // Not a PKCS#11 URI
+		"pkcs11:token=release",              // No module-path
+		"pkcs11:token?module-path=/usr/lib/p11.so",                // No attribute value
+		"pkcs11:token=%zz?module-path=/usr/lib/p11.so",            // Invalid percent-encoding
+		"pkcs11:token=a;token=b?module-path=/usr/lib/p11.so",      // Duplicate attribute
+		"pkcs11:slot-id=x?module-path=/usr/lib/p11.so",            // Invalid slot-id
+		"pkcs11:type=public?module-path=/usr/lib/p11.so",          // Not a private key
+		"pkcs11:unknown=1?module-path=/usr/lib/p11.so",            // Unknown path attribute
+		"pkcs11:?module-path=/usr/lib/p11.so&pin-source=/pinfile", // Unknown query attribute
+	} {
+		_, err := parsePKCS11URI(uri)
+		assert.Error(t, err, uri)
+	}
+}
+
+func TestNewPKCS11SigningMechanism(t *testing.T) {
+	for _, uri := range []string{
+		"this is not a URI",
+		"pkcs11:token=release?module-path=/this/does/not/exist",
+	} {
+		_, err := NewPKCS11SigningMechanism(&PKCS11SigningMechanismOptions{URI: uri})
+		assert.Error(t, err, uri)
+	}
+}
+
+func TestPKCS11ECDSAPublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	params, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	require.NoError(t, err)
+	rawPoint := elliptic.Marshal(elliptic.P256(), key.X, key.Y)
+	derPoint, err := asn1.Marshal(rawPoint)
+	require.NoError(t, err)
+
+	// Both DER-encoded and raw points are accepted
+	for _, point := range [][]byte{derPoint, rawPoint} {
+		res, err := pkcs11ECDSAPublicKey(params, point)
+		require.NoError(t, err)
+		assert.Equal(t, &key.PublicKey, res)
+	}
+
+	// Unsupported curve
+	otherParams, err := asn1.Marshal(asn1.ObjectIdentifier{1, 3, 132, 0, 10})
+	require.NoError(t, err)
+	_, err = pkcs11ECDSAPublicKey(otherParams, derPoint)
+	assert.Error(t, err)
+	// Invalid point
+	_, err = pkcs11ECDSAPublicKey(params, []byte{4, 1, 2, 3})
+	assert.Error(t, err)
+}
+
+func TestPKCS11ECDSASignatureToASN1(t *testing.T) {
+	res, err := pkcs11ECDSASignatureToASN1([]byte{0, 1, 2, 3, 4, 5})
+	require.NoError(t, err)
+	var sig ecdsaSignature
+	rest, err := asn1.Unmarshal(res, &sig)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+	assert.Equal(t, big.NewInt(0x000102), sig.R)
+	assert.Equal(t, big.NewInt(0x030405), sig.S)
+
+	for _, input := range [][]byte{{}, {1, 2, 3}} {
+		_, err := pkcs11ECDSASignatureToASN1(input)
+		assert.Error(t, err)
+	}
+}
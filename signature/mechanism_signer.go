@@ -0,0 +1,151 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// A GPG/OpenPGP signing mechanism which signs using a single crypto.Signer (e.g. a key held in a hardware token),
+// implemented using x/crypto/openpgp.
+// Signatures are verified using the default GPG/OpenPGP implementation, trusting only the signing key.
+type cryptoSignerSigningMechanism struct {
+	entity      *openpgp.Entity
+	keyIdentity string
+	publicKey   []byte           // entity.Serialize() output
+	verifier    SigningMechanism // Trusts only publicKey
+	close       func() error     // Releases resources associated with the crypto.Signer, or nil
+}
+
+// newCryptoSignerSigningMechanism returns a new GPG/OpenPGP signing mechanism using signer, which must be
+// an RSA or ECDSA key.  The OpenPGP public key is created with creationTime and userID; creationTime affects
+// the key identity, so it must be the same every time the key is used.
+// closeSigner, if not nil, is called when the mechanism is closed.
+// The caller must call .Close() on the returned SigningMechanism.
+func newCryptoSignerSigningMechanism(signer crypto.Signer, creationTime time.Time, userID string, closeSigner func() error) (*cryptoSignerSigningMechanism, error) {
+	switch signer.Public().(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, errors.Errorf("Unsupported public key type %T", signer.Public())
+	}
+	privateKey := packet.NewSignerPrivateKey(creationTime, signer)
+	uid := &packet.UserId{Id: userID}
+	isPrimaryID := true
+	selfSignature := &packet.Signature{
+		SigType:      packet.SigTypePositiveCert,
+		PubKeyAlgo:   privateKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: creationTime,
+		IssuerKeyId:  &privateKey.KeyId,
+		IsPrimaryId:  &isPrimaryID,
+		FlagsValid:   true,
+		FlagSign:     true,
+		FlagCertify:  true,
+		// 8 is SHA256 in RFC 4880.
+		PreferredHash: []uint8{8},
+	}
+	if err := selfSignature.SignUserId(uid.Id, &privateKey.PublicKey, privateKey, nil); err != nil {
+		return nil, errors.Wrap(err, "Error creating a self-signature")
+	}
+	entity := &openpgp.Entity{
+		PrimaryKey: &privateKey.PublicKey,
+		PrivateKey: privateKey,
+		Identities: map[string]*openpgp.Identity{
+			uid.Id: {
+				Name:          uid.Id,
+				UserId:        uid,
+				SelfSignature: selfSignature,
+			},
+		},
+	}
+
+	var publicKey bytes.Buffer
+	if err := entity.Serialize(&publicKey); err != nil {
+		return nil, err
+	}
+	verifier, keyIdentities, err := newEphemeralGPGSigningMechanism([][]byte{publicKey.Bytes()})
+	if err != nil {
+		return nil, err
+	}
+	keyIdentity := strings.ToUpper(fmt.Sprintf("%x", privateKey.Fingerprint))
+	if len(keyIdentities) != 1 || keyIdentities[0] != keyIdentity {
+		verifier.Close()
+		return nil, errors.Errorf("Internal error: unexpected key identities %v of public key %s", keyIdentities, keyIdentity)
+	}
+	return &cryptoSignerSigningMechanism{
+		entity:      entity,
+		keyIdentity: keyIdentity,
+		publicKey:   publicKey.Bytes(),
+		verifier:    verifier,
+		close:       closeSigner,
+	}, nil
+}
+
+func (m *cryptoSignerSigningMechanism) Close() error {
+	err := m.verifier.Close()
+	if m.close != nil {
+		if err2 := m.close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// SupportsSigning returns nil if the mechanism supports signing, or a SigningNotSupportedError.
+func (m *cryptoSignerSigningMechanism) SupportsSigning() error {
+	return nil
+}
+
+// Sign creates a (non-detached) signature of input using keyIdentity.
+// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+func (m *cryptoSignerSigningMechanism) Sign(input []byte, keyIdentity string) ([]byte, error) {
+	if keyIdentity != m.keyIdentity {
+		return nil, errors.Errorf("Key %s is not available, only %s can be used for signing", keyIdentity, m.keyIdentity)
+	}
+	var sigBuffer bytes.Buffer
+	w, err := openpgp.Sign(&sigBuffer, m.entity, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(input); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return sigBuffer.Bytes(), nil
+}
+
+// Verify parses unverifiedSignature and returns the content and the signer's identity
+func (m *cryptoSignerSigningMechanism) Verify(unverifiedSignature []byte) (contents []byte, keyIdentity string, err error) {
+	return m.verifier.Verify(unverifiedSignature)
+}
+
+// UntrustedSignatureContents returns UNTRUSTED contents of the signature WITHOUT ANY VERIFICATION,
+// along with a short identifier of the key used for signing.
+// WARNING: The short key identifier (which correponds to "Key ID" for OpenPGP keys)
+// is NOT the same as a "key identity" used in other calls ot this interface, and
+// the values may have no recognizable relationship if the public key is not available.
+func (m *cryptoSignerSigningMechanism) UntrustedSignatureContents(untrustedSignature []byte) (untrustedContents []byte, shortKeyIdentifier string, err error) {
+	return gpgUntrustedSignatureContents(untrustedSignature)
+}
+
+// KeyIdentity returns the identity of the signing key, to be used as the keyIdentity parameter of Sign.
+func (m *cryptoSignerSigningMechanism) KeyIdentity() string {
+	return m.keyIdentity
+}
+
+// PublicKey returns the public key in the binary OpenPGP format, e.g. to be trusted by a "signedBy" policy requirement.
+func (m *cryptoSignerSigningMechanism) PublicKey() []byte {
+	return m.publicKey
+}
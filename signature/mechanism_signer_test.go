@@ -0,0 +1,142 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unsupportedCryptoSigner is a crypto.Signer with an unsupported public key type.
+type unsupportedCryptoSigner struct{}
+
+func (s unsupportedCryptoSigner) Public() crypto.PublicKey {
+	return "this is not a public key"
+}
+func (s unsupportedCryptoSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("unexpected call to Sign")
+}
+
+func TestNewCryptoSignerSigningMechanism(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	creationTime := time.Unix(1500000000, 0)
+
+	for _, signer := range []crypto.Signer{ecdsaKey, rsaKey} {
+		m, err := newCryptoSignerSigningMechanism(signer, creationTime, "Release signing <release@example.com>", nil)
+		require.NoError(t, err)
+		defer m.Close()
+
+		// The key identity depends only on the key and creationTime
+		m2, err := newCryptoSignerSigningMechanism(signer, creationTime, "Other user ID", nil)
+		require.NoError(t, err)
+		defer m2.Close()
+		assert.Equal(t, m.KeyIdentity(), m2.KeyIdentity())
+		m3, err := newCryptoSignerSigningMechanism(signer, creationTime.Add(time.Second), "Release signing <release@example.com>", nil)
+		require.NoError(t, err)
+		defer m3.Close()
+		assert.NotEqual(t, m.KeyIdentity(), m3.KeyIdentity())
+
+		// The public key is usable by other mechanisms
+		ephemeral, keyIdentities, err := NewEphemeralGPGSigningMechanism(m.PublicKey())
+		require.NoError(t, err)
+		defer ephemeral.Close()
+		assert.Equal(t, []string{m.KeyIdentity()}, keyIdentities)
+	}
+
+	// Unsupported key type
+	_, err = newCryptoSignerSigningMechanism(unsupportedCryptoSigner{}, creationTime, "user", nil)
+	assert.Error(t, err)
+}
+
+func TestCryptoSignerSigningMechanismClose(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	closed := false
+	m, err := newCryptoSignerSigningMechanism(key, time.Unix(0, 0), "user", func() error {
+		closed = true
+		return nil
+	})
+	require.NoError(t, err)
+	err = m.Close()
+	assert.NoError(t, err)
+	assert.True(t, closed)
+
+	m, err = newCryptoSignerSigningMechanism(key, time.Unix(0, 0), "user", func() error { return errors.New("close failed") })
+	require.NoError(t, err)
+	err = m.Close()
+	assert.Error(t, err)
+}
+
+func TestCryptoSignerSigningMechanismSign(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	input := []byte("This is not JSON")
+
+	for _, signer := range []crypto.Signer{ecdsaKey, rsaKey} {
+		m, err := newCryptoSignerSigningMechanism(signer, time.Unix(1500000000, 0), "user", nil)
+		require.NoError(t, err)
+		defer m.Close()
+		assert.NoError(t, m.SupportsSigning())
+
+		// Successful signing, verifiable both by the mechanism itself and by an ephemeral mechanism trusting the key
+		sig, err := m.Sign(input, m.KeyIdentity())
+		require.NoError(t, err)
+		content, signingFingerprint, err := m.Verify(sig)
+		require.NoError(t, err)
+		assert.Equal(t, input, content)
+		assert.Equal(t, m.KeyIdentity(), signingFingerprint)
+
+		ephemeral, _, err := NewEphemeralGPGSigningMechanism(m.PublicKey())
+		require.NoError(t, err)
+		defer ephemeral.Close()
+		content, signingFingerprint, err = ephemeral.Verify(sig)
+		require.NoError(t, err)
+		assert.Equal(t, input, content)
+		assert.Equal(t, m.KeyIdentity(), signingFingerprint)
+
+		content, shortKeyID, err := m.UntrustedSignatureContents(sig)
+		require.NoError(t, err)
+		assert.Equal(t, input, content)
+		assert.Equal(t, m.KeyIdentity()[len(m.KeyIdentity())-16:], shortKeyID)
+
+		// A signature can be used with the Docker manifest signature functions
+		manifest := []byte(`{"schemaVersion":2}`)
+		sig, err = SignDockerManifest(manifest, "example.com/ns/repo:tag", m, m.KeyIdentity())
+		require.NoError(t, err)
+		parsed, err := VerifyDockerManifestSignature(sig, manifest, "example.com/ns/repo:tag", ephemeral, m.KeyIdentity())
+		require.NoError(t, err)
+		assert.Equal(t, "example.com/ns/repo:tag", parsed.DockerReference)
+
+		// An unknown key identity
+		_, err = m.Sign(input, TestKeyFingerprint)
+		assert.Error(t, err)
+	}
+
+	// A signature by a different key is rejected
+	m, err := newCryptoSignerSigningMechanism(ecdsaKey, time.Unix(0, 0), "user", nil)
+	require.NoError(t, err)
+	defer m.Close()
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := newCryptoSignerSigningMechanism(otherKey, time.Unix(0, 0), "user", nil)
+	require.NoError(t, err)
+	defer other.Close()
+	sig, err := other.Sign(input, other.KeyIdentity())
+	require.NoError(t, err)
+	_, _, err = m.Verify(sig)
+	assert.Error(t, err)
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -43,6 +44,38 @@ func TestNewGPGSigningMechanism(t *testing.T) {
 	mech.Close()
 }
 
+func TestNewGPGSigningMechanismForSystemContext(t *testing.T) {
+	signatures := fixtureVariants(t, "./fixtures/invalid-blob.signature")
+
+	// The directory specified in SystemContext is used
+	for _, mechFn := range []func() (SigningMechanism, error){
+		func() (SigningMechanism, error) { return NewGPGSigningMechanismInDirectory(testGPGHomeDirectory) },
+		func() (SigningMechanism, error) {
+			return NewGPGSigningMechanismForSystemContext(&types.SystemContext{GPGHomeDirectory: testGPGHomeDirectory})
+		},
+	} {
+		mech, err := mechFn()
+		require.NoError(t, err)
+		defer mech.Close()
+		for version, signature := range signatures {
+			_, _, err := mech.Verify(signature)
+			assert.NoError(t, err, version)
+		}
+	}
+
+	// Without an override, the default directory is used, so TestKeyFingerprint is not available
+	// (see TestNewGPGSigningMechanismInDirectory).
+	for _, sys := range []*types.SystemContext{nil, {}} {
+		mech, err := NewGPGSigningMechanismForSystemContext(sys)
+		require.NoError(t, err)
+		defer mech.Close()
+		for version, signature := range signatures {
+			_, _, err := mech.Verify(signature)
+			assert.Error(t, err, version)
+		}
+	}
+}
+
 func TestNewGPGSigningMechanismInDirectory(t *testing.T) {
 	// A dumb test just for code coverage.
 	mech, err := newGPGSigningMechanismInDirectory(testGPGHomeDirectory)
@@ -200,6 +233,38 @@ func TestGPGSigningMechanismSign(t *testing.T) {
 	// The various GPG/GPGME failures cases are not obviously easy to reach.
 }
 
+func TestGPGSigningMechanismSignWithPassphrase(t *testing.T) {
+	m, err := newGPGSigningMechanismInDirectory(testGPGHomeDirectory)
+	require.NoError(t, err)
+	defer m.Close()
+	mech, ok := m.(SigningMechanismWithPassphrase)
+	require.True(t, ok)
+
+	if err := mech.SupportsSigning(); err != nil {
+		t.Skipf("Signing not supported: %v", err)
+	}
+
+	// Successful signing; the test key is not protected by a passphrase, so any value is accepted.
+	content := []byte("content")
+	signature, err := mech.SignWithPassphrase(content, TestKeyFingerprint, "passphrase")
+	require.NoError(t, err)
+
+	signedContent, signingFingerprint, err := mech.Verify(signature)
+	require.NoError(t, err)
+	assert.EqualValues(t, content, signedContent)
+	assert.Equal(t, TestKeyFingerprint, signingFingerprint)
+
+	// The passphrase does not leak into later Sign calls
+	signature, err = mech.Sign(content, TestKeyFingerprint)
+	require.NoError(t, err)
+	_, _, err = mech.Verify(signature)
+	require.NoError(t, err)
+
+	// Error signing
+	_, err = mech.SignWithPassphrase(content, "this fingerprint doesn't exist", "passphrase")
+	assert.Error(t, err)
+}
+
 func assertSigningError(t *testing.T, content []byte, fingerprint string, err error, msgAndArgs ...interface{}) {
 	assert.Error(t, err, msgAndArgs...)
 	assert.Nil(t, content, msgAndArgs...)
@@ -0,0 +1,104 @@
+// +build containers_image_notary
+
+// This file uses github.com/theupdateframework/notary, which is not in vendor.conf; builds using the containers_image_notary
+// build tag must provide it separately.
+
+package signature
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/pkg/docker/config"
+	"github.com/containers/image/types"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/pkg/errors"
+	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// notarySupported is true if prNotarySigned requirements can be evaluated.
+const notarySupported = true
+
+// notaryReleasesRole is the delegation role used by "docker trust" to sign tags; it is preferred over the targets role.
+const notaryReleasesRole data.RoleName = "targets/releases"
+
+// notaryLookupTarget is the default value of lookupNotaryTarget.
+func notaryLookupTarget(ctx context.Context, sys *types.SystemContext, server, trustDir string, repo reference.Named, tag string) (*notaryTarget, error) {
+	rt, err := notaryTransport(ctx, sys, server, repo)
+	if err != nil {
+		return nil, err
+	}
+	notaryRepo, err := client.NewFileCachedRepository(trustDir, data.GUN(repo.Name()), server, rt, nil, trustpinning.TrustPinConfig{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error initializing Notary repository for %s", repo.Name())
+	}
+	target, err := notaryRepo.GetTargetByName(tag, notaryReleasesRole, data.CanonicalTargetsRole)
+	if err != nil {
+		switch err.(type) {
+		case client.ErrNoSuchTarget, client.ErrRepositoryNotExist:
+			return nil, newPolicyRequirementError(PolicyRejectionReasonNoSignatures, fmt.Sprintf("No Notary trust data for %s:%s: %v", repo.Name(), tag, err))
+		}
+		return nil, errors.Wrapf(err, "Error looking up %s:%s using Notary server %s", repo.Name(), tag, server)
+	}
+	return &notaryTarget{hashes: target.Hashes, length: target.Length}, nil
+}
+
+// notaryTransport returns a http.RoundTripper for accessing the Notary server for repo,
+// authenticating using the credentials for the registry of repo in sys.
+func notaryTransport(ctx context.Context, sys *types.SystemContext, server string, repo reference.Named) (http.RoundTripper, error) {
+	base := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	// Ask the server which authentication it requires.
+	req, err := http.NewRequest("GET", strings.TrimSuffix(server, "/")+"/v2/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	res, err := (&http.Client{Transport: base, Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error contacting Notary server %s", server)
+	}
+	defer res.Body.Close()
+	challenges := challenge.NewSimpleManager()
+	if err := challenges.AddResponse(res); err != nil {
+		return nil, err
+	}
+
+	username, password, err := config.GetAuthentication(sys, reference.Domain(repo))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading registry credentials")
+	}
+	creds := notaryCredentials{username: username, password: password}
+	authorizer := auth.NewAuthorizer(challenges,
+		auth.NewTokenHandler(base, creds, repo.Name(), "pull"),
+		auth.NewBasicHandler(creds))
+	return transport.NewTransport(base, authorizer), nil
+}
+
+// notaryCredentials is an auth.CredentialStore providing the registry credentials to a Notary server.
+type notaryCredentials struct {
+	username, password string
+}
+
+func (c notaryCredentials) Basic(*url.URL) (string, string) {
+	return c.username, c.password
+}
+
+func (c notaryCredentials) RefreshToken(*url.URL, string) string {
+	return ""
+}
+
+func (c notaryCredentials) SetRefreshToken(*url.URL, string, string) {
+}
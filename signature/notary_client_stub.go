@@ -0,0 +1,19 @@
+// +build !containers_image_notary
+
+package signature
+
+import (
+	"context"
+
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/types"
+	"github.com/pkg/errors"
+)
+
+// notarySupported is true if prNotarySigned requirements can be evaluated.
+const notarySupported = false
+
+// notaryLookupTarget is the default value of lookupNotaryTarget.
+func notaryLookupTarget(ctx context.Context, sys *types.SystemContext, server, trustDir string, repo reference.Named, tag string) (*notaryTarget, error) {
+	return nil, errors.New("Notary verification is only supported in github.com/containers/image built with the containers_image_notary build tag")
+}
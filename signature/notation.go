@@ -0,0 +1,440 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+// NOTE: Keep this in sync with docs/containers-policy.json.md!
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	internalsig "github.com/containers/image/internal/signature"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+const (
+	// notationSignaturePrefix is the prefix of a serialized NotationSignature blob.
+	notationSignaturePrefix = internalsig.NotationPrefix
+
+	// NotationSignatureMediaTypeJWS is the media type of a Notation signature envelope using JWS.
+	NotationSignatureMediaTypeJWS = "application/jose+json"
+	// NotationSignatureMediaTypeCOSE is the media type of a Notation signature envelope using COSE. Such signatures can not be verified.
+	NotationSignatureMediaTypeCOSE = "application/cose"
+
+	// notationPayloadContentType is the content type of the payload of a Notation signature.
+	notationPayloadContentType = "application/vnd.cncf.notary.payload.v1+json"
+	// notationSigningSchemeX509 is the only supported signing scheme, in which the signing certificate is verified at the current time.
+	notationSigningSchemeX509 = "notary.x509"
+
+	notationHeaderSigningScheme = "io.cncf.notary.signingScheme"
+	notationHeaderSigningTime   = "io.cncf.notary.signingTime"
+	notationHeaderExpiry        = "io.cncf.notary.expiry"
+
+	// notationX509SubjectPrefix is the prefix of a trusted identity which specifies the subject of the signing certificate.
+	notationX509SubjectPrefix = "x509.subject:"
+)
+
+// NotationSignature is a Notation (Notary v2) signature, as stored in the signature storage of a transport.
+// All of the contents are UNTRUSTED until verified by the notationSigned policy requirement.
+type NotationSignature struct {
+	UntrustedMediaType string `json:"mediaType"`
+	UntrustedEnvelope  []byte `json:"envelope"`
+}
+
+// IsNotationSignature returns true if blob is a serialized NotationSignature
+// (and not e.g. a simple signing signature).
+func IsNotationSignature(blob []byte) bool {
+	return internalsig.IsNotation(blob)
+}
+
+// Blob returns a serialized form of s, usable in the signature storage of a transport.
+func (s NotationSignature) Blob() ([]byte, error) {
+	return internalsig.Notation{
+		MediaType: s.UntrustedMediaType,
+		Envelope:  s.UntrustedEnvelope,
+	}.Blob()
+}
+
+// ParseNotationSignature parses a blob returned by NotationSignature.Blob.
+func ParseNotationSignature(blob []byte) (*NotationSignature, error) {
+	if !IsNotationSignature(blob) {
+		return nil, InvalidSignatureError{msg: "Not a Notation signature"}
+	}
+	var res NotationSignature
+	if err := paranoidUnmarshalJSONObjectExactFields(blob[len(notationSignaturePrefix):], map[string]interface{}{
+		"mediaType": &res.UntrustedMediaType,
+		"envelope":  &res.UntrustedEnvelope,
+	}); err != nil {
+		return nil, InvalidSignatureError{msg: err.Error()}
+	}
+	return &res, nil
+}
+
+// notationTargetArtifact is the descriptor of the signed artifact in the payload of a Notation signature.
+type notationTargetArtifact struct {
+	MediaType string        `json:"mediaType"`
+	Digest    digest.Digest `json:"digest"`
+	Size      int64         `json:"size"`
+}
+
+// notationTrustRoot contains the trusted CA certificates and the accepted identities for validating Notation signatures.
+type notationTrustRoot struct {
+	trustStore        *x509.CertPool
+	trustedIdentities []notationX509Subject // nil if any identity certified by trustStore is accepted
+}
+
+// notationX509Subject is a set of attributes an accepted signing certificate must contain in its subject.
+type notationX509Subject []notationX509Attribute
+
+// notationX509Attribute is a single attribute of notationX509Subject.
+type notationX509Attribute struct {
+	oid   asn1.ObjectIdentifier
+	value string
+}
+
+// notationX509AttributeTypes are the attribute types supported in trusted identities.
+var notationX509AttributeTypes = map[string]asn1.ObjectIdentifier{
+	"C":            {2, 5, 4, 6},
+	"ST":           {2, 5, 4, 8},
+	"L":            {2, 5, 4, 7},
+	"O":            {2, 5, 4, 10},
+	"OU":           {2, 5, 4, 11},
+	"CN":           {2, 5, 4, 3},
+	"SERIALNUMBER": {2, 5, 4, 5},
+	"EMAILADDRESS": {1, 2, 840, 113549, 1, 9, 1},
+}
+
+// parseNotationTrustedIdentities parses the trusted identities of a notationSigned requirement.
+// It returns nil if any identity is accepted.
+func parseNotationTrustedIdentities(identities []string) ([]notationX509Subject, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("trustedIdentities must not be empty")
+	}
+	res := []notationX509Subject{}
+	for _, identity := range identities {
+		if identity == "*" {
+			if len(identities) != 1 {
+				return nil, errors.New(`The "*" trusted identity can not be combined with other values`)
+			}
+			return nil, nil
+		}
+		if !strings.HasPrefix(identity, notationX509SubjectPrefix) {
+			return nil, errors.Errorf("Unsupported trusted identity %q, expected %q followed by a distinguished name", identity, notationX509SubjectPrefix)
+		}
+		subject, err := parseNotationX509Subject(strings.TrimPrefix(identity, notationX509SubjectPrefix))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid trusted identity %q", identity)
+		}
+		res = append(res, subject)
+	}
+	return res, nil
+}
+
+// parseNotationX509Subject parses a distinguished name in the RFC 4514 string format, e.g. "C=US, O=Example, CN=Signer".
+func parseNotationX509Subject(dn string) (notationX509Subject, error) {
+	res := notationX509Subject{}
+	var current strings.Builder
+	parts := []string{}
+	escaped := false
+	for _, c := range dn {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',' || c == '+':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	if escaped {
+		return nil, errors.New("Unterminated escape sequence")
+	}
+	parts = append(parts, current.String())
+	for _, part := range parts {
+		i := strings.IndexByte(part, '=')
+		if i == -1 {
+			return nil, errors.Errorf("Invalid attribute %q, expected TYPE=value", strings.TrimSpace(part))
+		}
+		attributeType, value := strings.ToUpper(strings.TrimSpace(part[:i])), strings.TrimSpace(part[i+1:])
+		oid, ok := notationX509AttributeTypes[attributeType]
+		if !ok {
+			return nil, errors.Errorf("Unsupported attribute type %q", attributeType)
+		}
+		if value == "" {
+			return nil, errors.Errorf("Empty value of attribute %q", attributeType)
+		}
+		res = append(res, notationX509Attribute{oid: oid, value: value})
+	}
+	return res, nil
+}
+
+// matches returns true if the subject of cert contains all attributes of s.
+func (s notationX509Subject) matches(cert *x509.Certificate) bool {
+	for _, attr := range s {
+		found := false
+		for _, certAttr := range cert.Subject.Names {
+			if certAttr.Type.Equal(attr.oid) {
+				if value, ok := certAttr.Value.(string); ok && value == attr.value {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// notationJWSEnvelope is a Notation signature envelope in the flattened JWS JSON serialization.
+type notationJWSEnvelope struct {
+	payload   string
+	protected string
+	header    struct {
+		x5c []string // Base64-encoded DER certificates, starting with the signing certificate
+	}
+	signature string
+}
+
+// parseNotationJWSEnvelope parses an UNTRUSTED Notation JWS envelope.
+func parseNotationJWSEnvelope(untrustedEnvelope []byte) (*notationJWSEnvelope, error) {
+	var res notationJWSEnvelope
+	var header json.RawMessage
+	if err := paranoidUnmarshalJSONObjectExactFields(untrustedEnvelope, map[string]interface{}{
+		"payload":   &res.payload,
+		"protected": &res.protected,
+		"header":    &header,
+		"signature": &res.signature,
+	}); err != nil {
+		return nil, err
+	}
+	gotX5C := false
+	if err := paranoidUnmarshalJSONObject(header, func(key string) interface{} {
+		if key == "x5c" {
+			gotX5C = true
+			return &res.header.x5c
+		}
+		return &json.RawMessage{} // Other unprotected headers, e.g. io.cncf.notary.signingAgent, are informational.
+	}); err != nil {
+		return nil, err
+	}
+	if !gotX5C || len(res.header.x5c) == 0 {
+		return nil, errors.New("Missing x5c header")
+	}
+	return &res, nil
+}
+
+// notationJWSProtectedHeader contains the values of the protected header of a Notation JWS envelope which we use.
+type notationJWSProtectedHeader struct {
+	alg           string
+	cty           string
+	crit          []string
+	signingScheme string
+	signingTime   time.Time
+	expiry        *time.Time
+}
+
+// parseNotationJWSProtectedHeader parses an UNTRUSTED base64url-encoded protected header of a Notation JWS envelope.
+func parseNotationJWSProtectedHeader(untrustedBase64Header string) (*notationJWSProtectedHeader, error) {
+	untrustedHeader, err := base64.RawURLEncoding.DecodeString(untrustedBase64Header)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid protected header encoding")
+	}
+	var res notationJWSProtectedHeader
+	var gotAlg, gotCty, gotCrit, gotSigningScheme, gotSigningTime bool
+	var expiry time.Time
+	if err := paranoidUnmarshalJSONObject(untrustedHeader, func(key string) interface{} {
+		switch key {
+		case "alg":
+			gotAlg = true
+			return &res.alg
+		case "cty":
+			gotCty = true
+			return &res.cty
+		case "crit":
+			gotCrit = true
+			return &res.crit
+		case notationHeaderSigningScheme:
+			gotSigningScheme = true
+			return &res.signingScheme
+		case notationHeaderSigningTime:
+			gotSigningTime = true
+			return &res.signingTime
+		case notationHeaderExpiry:
+			res.expiry = &expiry
+			return &expiry
+		default:
+			return &json.RawMessage{} // Unknown headers are ignored, unless they are listed in "crit" (checked below).
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if !gotAlg || !gotCty || !gotCrit || !gotSigningScheme || !gotSigningTime {
+		return nil, errors.New("Missing required protected header")
+	}
+	if res.cty != notationPayloadContentType {
+		return nil, errors.Errorf("Unexpected payload content type %q", res.cty)
+	}
+	if res.signingScheme != notationSigningSchemeX509 {
+		return nil, errors.Errorf("Unsupported signing scheme %q", res.signingScheme)
+	}
+	// Every critical header must be understood, and the headers which affect the verification must be critical.
+	critical := map[string]bool{}
+	for _, name := range res.crit {
+		if name != notationHeaderSigningScheme && name != notationHeaderExpiry {
+			return nil, errors.Errorf("Unsupported critical header %q", name)
+		}
+		critical[name] = true
+	}
+	if !critical[notationHeaderSigningScheme] || (res.expiry != nil && !critical[notationHeaderExpiry]) || (res.expiry == nil && critical[notationHeaderExpiry]) {
+		return nil, errors.New(`Inconsistent "crit" header`)
+	}
+	return &res, nil
+}
+
+// verifyNotationJWSSignature returns nil if the base64url-encoded untrustedSignature is a valid signature of signingInput
+// by publicKey, using the JWS algorithm alg.
+func verifyNotationJWSSignature(alg string, publicKey crypto.PublicKey, signingInput []byte, untrustedBase64Signature string) error {
+	signature, err := base64.RawURLEncoding.DecodeString(untrustedBase64Signature)
+	if err != nil {
+		return InvalidSignatureError{msg: fmt.Sprintf("Invalid signature encoding: %v", err)}
+	}
+	var hash crypto.Hash
+	var curve elliptic.Curve
+	switch alg {
+	case "PS256":
+		hash = crypto.SHA256
+	case "PS384":
+		hash = crypto.SHA384
+	case "PS512":
+		hash = crypto.SHA512
+	case "ES256":
+		hash, curve = crypto.SHA256, elliptic.P256()
+	case "ES384":
+		hash, curve = crypto.SHA384, elliptic.P384()
+	case "ES512":
+		hash, curve = crypto.SHA512, elliptic.P521()
+	default:
+		return InvalidSignatureError{msg: fmt.Sprintf("Unsupported signature algorithm %q", alg)}
+	}
+	h := hash.New()
+	h.Write(signingInput)
+	signingInputDigest := h.Sum(nil)
+
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		if curve != nil {
+			return InvalidSignatureError{msg: fmt.Sprintf("Signature algorithm %q does not match an RSA key", alg)}
+		}
+		if k.N.BitLen() < 2048 {
+			return InvalidSignatureError{msg: fmt.Sprintf("RSA key size %d is too small", k.N.BitLen())}
+		}
+		if err := rsa.VerifyPSS(k, hash, signingInputDigest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+			return InvalidSignatureError{msg: fmt.Sprintf("Cryptographic signature verification failed: %v", err)}
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if curve == nil || k.Curve != curve {
+			return InvalidSignatureError{msg: fmt.Sprintf("Signature algorithm %q does not match the ECDSA key", alg)}
+		}
+		// JWS ECDSA signatures are the fixed-size concatenation of R and S, not ASN.1.
+		size := (curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return InvalidSignatureError{msg: "Invalid ECDSA signature format"}
+		}
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, signingInputDigest, r, s) {
+			return InvalidSignatureError{msg: "Cryptographic signature verification failed"}
+		}
+		return nil
+	default:
+		return InvalidSignatureError{msg: fmt.Sprintf("Unsupported public key type %T", publicKey)}
+	}
+}
+
+// verifyNotationSignature verifies that untrustedSig is a valid Notation signature made, at verificationTime,
+// using a certificate issued by r.trustStore to an identity accepted by r, and returns the signed artifact.
+func (r *notationTrustRoot) verifyNotationSignature(untrustedSig *NotationSignature, verificationTime time.Time) (*notationTargetArtifact, error) {
+	if untrustedSig.UntrustedMediaType != NotationSignatureMediaTypeJWS {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Unsupported Notation signature envelope type %q", untrustedSig.UntrustedMediaType)}
+	}
+	untrustedEnvelope, err := parseNotationJWSEnvelope(untrustedSig.UntrustedEnvelope)
+	if err != nil {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid Notation signature envelope: %v", err)}
+	}
+	untrustedHeader, err := parseNotationJWSProtectedHeader(untrustedEnvelope.protected)
+	if err != nil {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid Notation signature envelope: %v", err)}
+	}
+
+	untrustedCerts := []*x509.Certificate{}
+	for _, untrustedBase64Cert := range untrustedEnvelope.header.x5c {
+		der, err := base64.StdEncoding.DecodeString(untrustedBase64Cert)
+		if err != nil {
+			return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid x5c certificate encoding: %v", err)}
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid x5c certificate: %v", err)}
+		}
+		untrustedCerts = append(untrustedCerts, cert)
+	}
+	if err := verifyX509Certificates(r.trustStore, untrustedCerts[0], untrustedCerts[1:], verificationTime); err != nil {
+		return nil, err
+	}
+	// The certificate is now trusted, and so is its subject.
+	leafCert := untrustedCerts[0]
+	if r.trustedIdentities != nil {
+		accepted := false
+		for _, identity := range r.trustedIdentities {
+			if identity.matches(leafCert) {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return nil, newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, fmt.Sprintf("Signing certificate subject %q is not a trusted identity", leafCert.Subject.String()))
+		}
+	}
+
+	if err := verifyNotationJWSSignature(untrustedHeader.alg, leafCert.PublicKey, []byte(untrustedEnvelope.protected+"."+untrustedEnvelope.payload), untrustedEnvelope.signature); err != nil {
+		return nil, err
+	}
+	// The protected header and the payload are now authenticated.
+	if untrustedHeader.expiry != nil && verificationTime.After(*untrustedHeader.expiry) {
+		return nil, newPolicyRequirementError(PolicyRejectionReasonSignatureExpired, fmt.Sprintf("Signature expired at %s", untrustedHeader.expiry.UTC().Format(time.RFC3339)))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(untrustedEnvelope.payload)
+	if err != nil {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid payload encoding: %v", err)}
+	}
+	var parsedPayload struct {
+		TargetArtifact *notationTargetArtifact `json:"targetArtifact"`
+	}
+	if err := json.Unmarshal(payload, &parsedPayload); err != nil {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid payload: %v", err)}
+	}
+	if parsedPayload.TargetArtifact == nil {
+		return nil, InvalidSignatureError{msg: "Payload does not contain targetArtifact"}
+	}
+	if err := parsedPayload.TargetArtifact.Digest.Validate(); err != nil {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid target artifact digest: %v", err)}
+	}
+	return parsedPayload.TargetArtifact, nil
+}
@@ -0,0 +1,346 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notationTestProtectedHeader returns a valid protected header of a Notation JWS envelope using alg.
+func notationTestProtectedHeader(alg string) map[string]interface{} {
+	return map[string]interface{}{
+		"alg":                       alg,
+		"cty":                       notationPayloadContentType,
+		"crit":                      []string{notationHeaderSigningScheme},
+		notationHeaderSigningScheme: notationSigningSchemeX509,
+		notationHeaderSigningTime:   time.Now().Format(time.RFC3339),
+	}
+}
+
+// notationTestEnvelope returns a Notation JWS envelope with protectedHeader and payload, signed by key, with the certificate chain certs.
+func notationTestEnvelope(t *testing.T, key crypto.Signer, protectedHeader map[string]interface{}, payload []byte, certs []*x509.Certificate) []byte {
+	headerJSON, err := json.Marshal(protectedHeader)
+	require.NoError(t, err)
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+
+	signingInput := []byte(protected + "." + encodedPayload)
+	var signature []byte
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		hash := map[int]crypto.Hash{256: crypto.SHA256, 384: crypto.SHA384, 521: crypto.SHA512}[k.Curve.Params().BitSize]
+		h := hash.New()
+		h.Write(signingInput)
+		r, s, err := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		require.NoError(t, err)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		rBytes, sBytes := r.Bytes(), s.Bytes()
+		copy(signature[size-len(rBytes):size], rBytes)
+		copy(signature[2*size-len(sBytes):], sBytes)
+	case *rsa.PrivateKey:
+		h := crypto.SHA256.New()
+		h.Write(signingInput)
+		signature, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, h.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		require.NoError(t, err)
+	default:
+		t.Fatalf("Unexpected key type %T", key)
+	}
+
+	x5c := []string{}
+	for _, cert := range certs {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	envelope, err := json.Marshal(map[string]interface{}{
+		"payload":   encodedPayload,
+		"protected": protected,
+		"header":    map[string]interface{}{"x5c": x5c, "io.cncf.notary.signingAgent": "test"},
+		"signature": base64.RawURLEncoding.EncodeToString(signature),
+	})
+	require.NoError(t, err)
+	return envelope
+}
+
+// notationTestPayload returns a Notation signature payload for an artifact with manifestDigest and size.
+func notationTestPayload(t *testing.T, manifestDigest digest.Digest, size int64) []byte {
+	payload, err := json.Marshal(map[string]interface{}{
+		"targetArtifact": map[string]interface{}{
+			"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+			"digest":    manifestDigest,
+			"size":      size,
+		},
+	})
+	require.NoError(t, err)
+	return payload
+}
+
+// notationTestSignature returns a serialized Notation signature of an artifact with manifestDigest and size by key, with the certificate chain certs.
+func notationTestSignature(t *testing.T, key crypto.Signer, certs []*x509.Certificate, manifestDigest digest.Digest, size int64) []byte {
+	alg := "ES256"
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		alg = "PS256"
+	}
+	blob, err := NotationSignature{
+		UntrustedMediaType: NotationSignatureMediaTypeJWS,
+		UntrustedEnvelope:  notationTestEnvelope(t, key, notationTestProtectedHeader(alg), notationTestPayload(t, manifestDigest, size), certs),
+	}.Blob()
+	require.NoError(t, err)
+	return blob
+}
+
+// notationTestLeafTemplate returns a template for a code signing certificate with subject.
+func notationTestLeafTemplate(subject pkix.Name) *x509.Certificate {
+	template := x509TestLeafTemplate("")
+	template.Subject = subject
+	return template
+}
+
+func TestNotationSignatureBlob(t *testing.T) {
+	sig := NotationSignature{
+		UntrustedMediaType: NotationSignatureMediaTypeJWS,
+		UntrustedEnvelope:  []byte(`{"payload":""}`),
+	}
+	blob, err := sig.Blob()
+	require.NoError(t, err)
+	assert.True(t, IsNotationSignature(blob))
+	assert.False(t, IsSigstoreSignature(blob))
+	parsed, err := ParseNotationSignature(blob)
+	require.NoError(t, err)
+	assert.Equal(t, &sig, parsed)
+
+	for _, invalid := range [][]byte{
+		[]byte("not a Notation signature"),
+		[]byte(notationSignaturePrefix + "not JSON"),
+		[]byte(notationSignaturePrefix + `{"mediaType":"application/jose+json"}`),
+		[]byte(notationSignaturePrefix + `{"mediaType":"application/jose+json","envelope":"","unknown":1}`),
+	} {
+		_, err := ParseNotationSignature(invalid)
+		assert.Error(t, err, string(invalid))
+	}
+}
+
+func TestParseNotationTrustedIdentities(t *testing.T) {
+	identities, err := parseNotationTrustedIdentities([]string{"*"})
+	require.NoError(t, err)
+	assert.Nil(t, identities)
+
+	identities, err = parseNotationTrustedIdentities([]string{`x509.subject: C=US, O=Example\, Inc.+OU=Signing`, "x509.subject:cn=Signer"})
+	require.NoError(t, err)
+	assert.Equal(t, []notationX509Subject{
+		{
+			{oid: notationX509AttributeTypes["C"], value: "US"},
+			{oid: notationX509AttributeTypes["O"], value: "Example, Inc."},
+			{oid: notationX509AttributeTypes["OU"], value: "Signing"},
+		},
+		{{oid: notationX509AttributeTypes["CN"], value: "Signer"}},
+	}, identities)
+
+	for _, invalid := range [][]string{
+		nil,
+		{},
+		{"*", "x509.subject: CN=Signer"},
+		{"x509.subject: CN=Signer", "*"},
+		{"CN=Signer"},
+		{"x509.subject: CN"},
+		{"x509.subject: CN=Signer, "},
+		{"x509.subject: UNKNOWN=Signer"},
+		{`x509.subject: CN=Signer\`},
+	} {
+		_, err := parseNotationTrustedIdentities(invalid)
+		assert.Error(t, err, "%#v", invalid)
+	}
+}
+
+func TestNotationX509SubjectMatches(t *testing.T) {
+	cert, _, _ := x509TestCertificate(t, notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Example, Inc."}, CommonName: "Signer"}), nil, nil)
+	for _, c := range []struct {
+		dn      string
+		matches bool
+	}{
+		{"C=US", true},
+		{`CN=Signer, O=Example\, Inc., C=US`, true},
+		{"CN=Other", false},
+		{"C=US, CN=Other", false},
+		{"C=US, OU=Signing", false},
+	} {
+		subject, err := parseNotationX509Subject(c.dn)
+		require.NoError(t, err)
+		assert.Equal(t, c.matches, subject.matches(cert), c.dn)
+	}
+}
+
+func TestNotationTrustRootVerifyNotationSignature(t *testing.T) {
+	manifestDigest := digest.FromString("manifest")
+	caCert, caKey, caPEM := x509TestCertificate(t, x509TestCATemplate("Notation CA"), nil, nil)
+	intermediateCert, intermediateKey, _ := x509TestCertificate(t, x509TestCATemplate("Notation intermediate"), caCert, caKey)
+	leafCert, leafKey, _ := x509TestCertificate(t, notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Example"}, CommonName: "Signer"}),
+		intermediateCert, intermediateKey)
+	chain := []*x509.Certificate{leafCert, intermediateCert}
+	trustStore, err := newX509CertPool([][]byte{caPEM})
+	require.NoError(t, err)
+	trustedIdentities, err := parseNotationTrustedIdentities([]string{"x509.subject: C=US, O=Example"})
+	require.NoError(t, err)
+	trustRoot := notationTrustRoot{trustStore: trustStore, trustedIdentities: trustedIdentities}
+	verify := func(mediaType string, envelope []byte) (*notationTargetArtifact, error) {
+		return trustRoot.verifyNotationSignature(&NotationSignature{UntrustedMediaType: mediaType, UntrustedEnvelope: envelope}, time.Now())
+	}
+	payload := notationTestPayload(t, manifestDigest, 1234)
+
+	// Success
+	target, err := verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, leafKey, notationTestProtectedHeader("ES256"), payload, chain))
+	require.NoError(t, err)
+	assert.Equal(t, &notationTargetArtifact{MediaType: "application/vnd.docker.distribution.manifest.v2+json", Digest: manifestDigest, Size: 1234}, target)
+	// Success, with an expiration time in the future
+	header := notationTestProtectedHeader("ES256")
+	header[notationHeaderExpiry] = time.Now().Add(time.Hour).Format(time.RFC3339)
+	header["crit"] = []string{notationHeaderSigningScheme, notationHeaderExpiry}
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, leafKey, header, payload, chain))
+	require.NoError(t, err)
+	// Success, with any identity accepted
+	anyIdentity := notationTrustRoot{trustStore: trustStore}
+	_, err = anyIdentity.verifyNotationSignature(&NotationSignature{
+		UntrustedMediaType: NotationSignatureMediaTypeJWS,
+		UntrustedEnvelope:  notationTestEnvelope(t, leafKey, notationTestProtectedHeader("ES256"), payload, chain),
+	}, time.Now())
+	require.NoError(t, err)
+
+	// Success, with an RSA key
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaDER, err := x509.CreateCertificate(rand.Reader, notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Example"}}), caCert, rsaKey.Public(), caKey)
+	require.NoError(t, err)
+	rsaCert, err := x509.ParseCertificate(rsaDER)
+	require.NoError(t, err)
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, rsaKey, notationTestProtectedHeader("PS256"), payload, []*x509.Certificate{rsaCert}))
+	require.NoError(t, err)
+	// … but the algorithm must match the key type
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, rsaKey, notationTestProtectedHeader("ES256"), payload, []*x509.Certificate{rsaCert}))
+	assert.IsType(t, InvalidSignatureError{}, err)
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, leafKey, notationTestProtectedHeader("PS256"), payload, chain))
+	assert.IsType(t, InvalidSignatureError{}, err)
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, leafKey, notationTestProtectedHeader("ES384"), payload, chain))
+	assert.IsType(t, InvalidSignatureError{}, err)
+
+	// COSE envelopes are not supported
+	_, err = verify(NotationSignatureMediaTypeCOSE, []byte("cose"))
+	assert.IsType(t, InvalidSignatureError{}, err)
+
+	// Invalid envelopes
+	validEnvelope := notationTestEnvelope(t, leafKey, notationTestProtectedHeader("ES256"), payload, chain)
+	for _, fn := range []func(mSI){
+		func(v mSI) { delete(v, "payload") },
+		func(v mSI) { delete(v, "protected") },
+		func(v mSI) { delete(v, "signature") },
+		func(v mSI) { delete(v, "header") },
+		func(v mSI) { v["unexpected"] = 1 },
+		func(v mSI) { v["header"] = map[string]interface{}{} },
+		func(v mSI) { v["header"] = map[string]interface{}{"x5c": []string{}} },
+		func(v mSI) { v["header"] = map[string]interface{}{"x5c": []string{"!!!"}} },
+		func(v mSI) {
+			v["header"] = map[string]interface{}{"x5c": []string{base64.StdEncoding.EncodeToString([]byte("not a certificate"))}}
+		},
+		func(v mSI) { v["protected"] = "!!!" },
+		func(v mSI) { v["signature"] = "!!!" },
+		// A signature of a different payload
+		func(v mSI) {
+			v["payload"] = base64.RawURLEncoding.EncodeToString(notationTestPayload(t, digest.FromString("other"), 1234))
+		},
+	} {
+		var tmp mSI
+		err := json.Unmarshal(validEnvelope, &tmp)
+		require.NoError(t, err)
+		fn(tmp)
+		envelope, err := json.Marshal(tmp)
+		require.NoError(t, err)
+		_, err = verify(NotationSignatureMediaTypeJWS, envelope)
+		assert.IsType(t, InvalidSignatureError{}, err, string(envelope))
+	}
+
+	// Invalid protected headers
+	for _, fn := range []func(mSI){
+		func(v mSI) { delete(v, "alg") },
+		func(v mSI) { v["alg"] = "none" },
+		func(v mSI) { v["alg"] = "HS256" },
+		func(v mSI) { delete(v, "cty") },
+		func(v mSI) { v["cty"] = "application/json" },
+		func(v mSI) { delete(v, "crit") },
+		func(v mSI) { v["crit"] = []string{} },
+		func(v mSI) { v["crit"] = []string{notationHeaderSigningScheme, "io.cncf.notary.verificationPlugin"} },
+		func(v mSI) { v["crit"] = []string{notationHeaderSigningScheme, notationHeaderExpiry} },
+		func(v mSI) { v[notationHeaderExpiry] = time.Now().Add(time.Hour).Format(time.RFC3339) },
+		func(v mSI) { delete(v, notationHeaderSigningScheme) },
+		func(v mSI) { v[notationHeaderSigningScheme] = "notary.x509.signingAuthority" },
+		func(v mSI) { delete(v, notationHeaderSigningTime) },
+		func(v mSI) { v[notationHeaderSigningTime] = "yesterday" },
+	} {
+		header := notationTestProtectedHeader("ES256")
+		fn(header)
+		_, err := verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, leafKey, header, payload, chain))
+		assert.IsType(t, InvalidSignatureError{}, err, "%#v", header)
+	}
+
+	// Invalid payloads
+	for _, invalid := range []string{
+		"not JSON",
+		`{}`,
+		`{"targetArtifact":{"digest":"sha256:../../../evil"}}`,
+	} {
+		_, err := verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, leafKey, notationTestProtectedHeader("ES256"), []byte(invalid), chain))
+		assert.IsType(t, InvalidSignatureError{}, err, invalid)
+	}
+
+	// Expired signature
+	header = notationTestProtectedHeader("ES256")
+	header[notationHeaderExpiry] = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	header["crit"] = []string{notationHeaderSigningScheme, notationHeaderExpiry}
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, leafKey, header, payload, chain))
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonSignatureExpired, err)
+
+	// Missing intermediate certificate
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, leafKey, notationTestProtectedHeader("ES256"), payload, []*x509.Certificate{leafCert}))
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+	// A certificate issued by an untrusted CA
+	otherCACert, otherCAKey, _ := x509TestCertificate(t, x509TestCATemplate("Other CA"), nil, nil)
+	otherLeafCert, otherLeafKey, _ := x509TestCertificate(t, notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Example"}}), otherCACert, otherCAKey)
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, otherLeafKey, notationTestProtectedHeader("ES256"), payload, []*x509.Certificate{otherLeafCert, otherCACert}))
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+	// A certificate for an untrusted identity
+	untrustedCert, untrustedKey, _ := x509TestCertificate(t, notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Other"}}), caCert, caKey)
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, untrustedKey, notationTestProtectedHeader("ES256"), payload, []*x509.Certificate{untrustedCert}))
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+	// A signature by a key other than the one in the certificate
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, untrustedKey, notationTestProtectedHeader("ES256"), payload, chain))
+	assert.IsType(t, InvalidSignatureError{}, err)
+	// An expired certificate
+	template := notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Example"}})
+	template.NotAfter = time.Now().Add(-time.Minute)
+	expiredCert, expiredKey, _ := x509TestCertificate(t, template, caCert, caKey)
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, expiredKey, notationTestProtectedHeader("ES256"), payload, []*x509.Certificate{expiredCert}))
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+	// A certificate which is not valid for code signing
+	template = notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Example"}})
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	serverCert, serverKey, _ := x509TestCertificate(t, template, caCert, caKey)
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, serverKey, notationTestProtectedHeader("ES256"), payload, []*x509.Certificate{serverCert}))
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+	// A small RSA key
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	smallDER, err := x509.CreateCertificate(rand.Reader, notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Example"}}), caCert, smallKey.Public(), caKey)
+	require.NoError(t, err)
+	smallCert, err := x509.ParseCertificate(smallDER)
+	require.NoError(t, err)
+	_, err = verify(NotationSignatureMediaTypeJWS, notationTestEnvelope(t, smallKey, notationTestProtectedHeader("PS256"), payload, []*x509.Certificate{smallCert}))
+	assert.IsType(t, InvalidSignatureError{}, err)
+}
@@ -17,7 +17,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/transports"
@@ -34,6 +37,15 @@ var systemDefaultPolicyPath = builtinDefaultPolicyPath
 // DO NOT change this, instead see systemDefaultPolicyPath above.
 const builtinDefaultPolicyPath = "/etc/containers/policy.json"
 
+// systemDefaultPolicyFragmentsPath is the directory of policy fragments used for DefaultPolicy().
+// You can override this at build time with
+// -ldflags '-X github.com/containers/image/signature.systemDefaultPolicyFragmentsPath=$your_path'
+var systemDefaultPolicyFragmentsPath = builtinDefaultPolicyFragmentsPath
+
+// builtinDefaultPolicyFragmentsPath is the directory of policy fragments used for DefaultPolicy().
+// DO NOT change this, instead see systemDefaultPolicyFragmentsPath above.
+const builtinDefaultPolicyFragmentsPath = "/etc/containers/policy.d"
+
 // InvalidPolicyFormatError is returned when parsing an invalid policy configuration.
 type InvalidPolicyFormatError string
 
@@ -47,8 +59,22 @@ func (err InvalidPolicyFormatError) Error() string {
 // sys should usually be nil, can be set to override the default.
 // NOTE: When this function returns an error, report it to the user and abort.
 // DO NOT hard-code fallback policies in your application.
+// If the policy sets AllowFragments, and sys.SignaturePolicyPath is not set, policy fragments
+// in the system policy fragment directory are merged into the policy, see NewPolicyFromFileWithFragments.
 func DefaultPolicy(sys *types.SystemContext) (*Policy, error) {
-	return NewPolicyFromFile(defaultPolicyPath(sys))
+	fileName := defaultPolicyPath(sys)
+	policy, err := NewPolicyFromFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	fragmentsDir := defaultPolicyFragmentsPath(sys)
+	if fragmentsDir == "" || !policy.AllowFragments {
+		return policy, nil
+	}
+	if err := mergePolicyFragments(policy, fileName, fragmentsDir); err != nil {
+		return nil, err
+	}
+	return policy, nil
 }
 
 // defaultPolicyPath returns a path to the default policy of the system.
@@ -64,6 +90,19 @@ func defaultPolicyPath(sys *types.SystemContext) string {
 	return systemDefaultPolicyPath
 }
 
+// defaultPolicyFragmentsPath returns a path to the directory of policy fragments of the system, or "" if fragments should not be used.
+func defaultPolicyFragmentsPath(sys *types.SystemContext) string {
+	if sys != nil {
+		if sys.SignaturePolicyPath != "" {
+			return ""
+		}
+		if sys.RootForImplicitAbsolutePaths != "" {
+			return filepath.Join(sys.RootForImplicitAbsolutePaths, systemDefaultPolicyFragmentsPath)
+		}
+	}
+	return systemDefaultPolicyFragmentsPath
+}
+
 // NewPolicyFromFile returns a policy configured in the specified file.
 func NewPolicyFromFile(fileName string) (*Policy, error) {
 	contents, err := ioutil.ReadFile(fileName)
@@ -77,8 +116,97 @@ func NewPolicyFromFile(fileName string) (*Policy, error) {
 	return policy, nil
 }
 
+// NewPolicyFromFileWithFragments returns a policy configured in the specified file, merged with policy fragments
+// in the *.json files of fragmentsDir; a missing fragmentsDir is treated as an empty directory.
+// A policy fragment uses the same format as a policy, but it can only contain the "transports" section.
+// The fragments are processed in lexicographical order of their file names; each transport scope may be defined
+// in at most one of the files, it is an error if several files define the same scope.
+// The most specific scope matching an image is then used, as usual, regardless of which file defines it.
+// The fragments are merged regardless of Policy.AllowFragments, which only affects DefaultPolicy.
+func NewPolicyFromFileWithFragments(fileName, fragmentsDir string) (*Policy, error) {
+	policy, err := NewPolicyFromFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := mergePolicyFragments(policy, fileName, fragmentsDir); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// mergePolicyFragments merges policy fragments in fragmentsDir into policy, read from fileName,
+// as described in NewPolicyFromFileWithFragments.
+func mergePolicyFragments(policy *Policy, fileName, fragmentsDir string) error {
+	entries, err := ioutil.ReadDir(fragmentsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if policy.Transports == nil {
+		policy.Transports = map[string]PolicyTransportScopes{}
+	}
+	// scopeSources[transport][scope] is the file which defines that scope, for error messages.
+	scopeSources := map[string]map[string]string{}
+	for transportName, scopes := range policy.Transports {
+		scopeSources[transportName] = map[string]string{}
+		for scope := range scopes {
+			scopeSources[transportName][scope] = fileName
+		}
+	}
+	for _, entry := range entries { // ioutil.ReadDir returns the entries sorted by name.
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		fragmentPath := filepath.Join(fragmentsDir, entry.Name())
+		contents, err := ioutil.ReadFile(fragmentPath)
+		if err != nil {
+			return err
+		}
+		fragment, err := newPolicyFragmentFromBytes(contents)
+		if err != nil {
+			return errors.Wrapf(err, "invalid policy fragment in %q", fragmentPath)
+		}
+		for transportName, scopes := range fragment {
+			if _, ok := policy.Transports[transportName]; !ok {
+				policy.Transports[transportName] = PolicyTransportScopes{}
+				scopeSources[transportName] = map[string]string{}
+			}
+			for scope, reqs := range scopes {
+				if source, ok := scopeSources[transportName][scope]; ok {
+					return InvalidPolicyFormatError(fmt.Sprintf("Scope %q of transport %q is defined in both %q and %q",
+						scope, transportName, source, fragmentPath))
+				}
+				policy.Transports[transportName][scope] = reqs
+				scopeSources[transportName][scope] = fragmentPath
+			}
+		}
+	}
+	return nil
+}
+
+// newPolicyFragmentFromBytes returns the transport scopes of a policy fragment parsed from the specified blob.
+// Any error is an InvalidPolicyFormatError.
+func newPolicyFragmentFromBytes(data []byte) (map[string]PolicyTransportScopes, error) {
+	transports := policyTransportsMap{}
+	if err := paranoidUnmarshalJSONObject(data, func(key string) interface{} {
+		switch key {
+		case "transports":
+			return &transports
+		default:
+			return nil
+		}
+	}); err != nil {
+		return nil, InvalidPolicyFormatError(err.Error())
+	}
+	return map[string]PolicyTransportScopes(transports), nil
+}
+
 // NewPolicyFromBytes returns a policy parsed from the specified blob.
 // Use this function instead of calling json.Unmarshal directly.
+// Any error is an InvalidPolicyFormatError; errors within a transport scope include the name of that scope.
 func NewPolicyFromBytes(data []byte) (*Policy, error) {
 	p := Policy{}
 	if err := json.Unmarshal(data, &p); err != nil {
@@ -100,6 +228,8 @@ func (p *Policy) UnmarshalJSON(data []byte) error {
 			return &p.Default
 		case "transports":
 			return &transports
+		case "allowFragments":
+			return &p.AllowFragments
 		default:
 			return nil
 		}
@@ -114,6 +244,27 @@ func (p *Policy) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Compile-time check that Policy implements json.Marshaler.
+var _ json.Marshaler = (*Policy)(nil)
+
+// MarshalJSON implements the json.Marshaler interface.
+// Unlike the default encoding, a nil Transports map is represented as an empty object, so that the result can be parsed again.
+func (p Policy) MarshalJSON() ([]byte, error) {
+	transports := p.Transports
+	if transports == nil {
+		transports = map[string]PolicyTransportScopes{}
+	}
+	return json.Marshal(struct {
+		Default        PolicyRequirements               `json:"default"`
+		Transports     map[string]PolicyTransportScopes `json:"transports"`
+		AllowFragments bool                             `json:"allowFragments,omitempty"`
+	}{
+		Default:        p.Default,
+		Transports:     transports,
+		AllowFragments: p.AllowFragments,
+	})
+}
+
 // policyTransportsMap is a specialization of this map type for the strict JSON parsing semantics appropriate for the Policy.Transports member.
 type policyTransportsMap map[string]PolicyTransportScopes
 
@@ -133,8 +284,9 @@ func (m *policyTransportsMap) UnmarshalJSON(data []byte) error {
 			return nil
 		}
 		ptsWithTransport := policyTransportScopesWithTransport{
-			transport: transport,
-			dest:      &PolicyTransportScopes{}, // This allocates a new instance on each call.
+			transportName: key,
+			transport:     transport,
+			dest:          &PolicyTransportScopes{}, // This allocates a new instance on each call.
 		}
 		tmpMap[key] = ptsWithTransport.dest
 		return &ptsWithTransport
@@ -156,11 +308,24 @@ func (m *PolicyTransportScopes) UnmarshalJSON(data []byte) error {
 	return errors.New("Do not try to unmarshal PolicyTransportScopes directly")
 }
 
+// Compile-time check that PolicyTransportScopes implements json.Marshaler.
+var _ json.Marshaler = (*PolicyTransportScopes)(nil)
+
+// MarshalJSON implements the json.Marshaler interface.
+// A nil PolicyTransportScopes is represented as an empty object, so that the result can be parsed again.
+func (m PolicyTransportScopes) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]PolicyRequirements(m))
+}
+
 // policyTransportScopesWithTransport is a way to unmarshal a PolicyTransportScopes
 // while validating using a specific ImageTransport if not nil.
 type policyTransportScopesWithTransport struct {
-	transport types.ImageTransport
-	dest      *PolicyTransportScopes
+	transportName string // Used only for error messages
+	transport     types.ImageTransport
+	dest          *PolicyTransportScopes
 }
 
 // Compile-time check that policyTransportScopesWithTransport implements json.Unmarshaler.
@@ -171,6 +336,7 @@ func (m *policyTransportScopesWithTransport) UnmarshalJSON(data []byte) error {
 	// We can't unmarshal directly into map values because it is not possible to take an address of a map value.
 	// So, use a temporary map of pointers-to-slices and convert.
 	tmpMap := map[string]*PolicyRequirements{}
+	var scopeErr error // The reason why a scope was rejected, if any
 	if err := paranoidUnmarshalJSONObject(data, func(key string) interface{} {
 		// paranoidUnmarshalJSONObject detects key duplication for us, check just to be safe.
 		if _, ok := tmpMap[key]; ok {
@@ -178,13 +344,21 @@ func (m *policyTransportScopesWithTransport) UnmarshalJSON(data []byte) error {
 		}
 		if key != "" && m.transport != nil {
 			if err := m.transport.ValidatePolicyConfigurationScope(key); err != nil {
+				scopeErr = InvalidPolicyFormatError(fmt.Sprintf("Invalid policy scope %q for transport %q: %v", key, m.transportName, err))
 				return nil
 			}
 		}
 		ptr := &PolicyRequirements{} // This allocates a new instance on each call.
 		tmpMap[key] = ptr
-		return ptr
+		return &policyRequirementsWithScope{
+			transportName: m.transportName,
+			scope:         key,
+			dest:          ptr,
+		}
 	}); err != nil {
+		if scopeErr != nil {
+			return scopeErr
+		}
 		return err
 	}
 	for key, ptr := range tmpMap {
@@ -193,6 +367,38 @@ func (m *policyTransportScopesWithTransport) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// policyRequirementsWithScope is a way to unmarshal PolicyRequirements
+// while reporting the scope they apply to in error messages.
+type policyRequirementsWithScope struct {
+	transportName string
+	scope         string
+	dest          *PolicyRequirements
+}
+
+// Compile-time check that policyRequirementsWithScope implements json.Unmarshaler.
+var _ json.Unmarshaler = (*policyRequirementsWithScope)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (m *policyRequirementsWithScope) UnmarshalJSON(data []byte) error {
+	if err := m.dest.UnmarshalJSON(data); err != nil {
+		return InvalidPolicyFormatError(fmt.Sprintf("Invalid policy for scope %q of transport %q: %v", m.scope, m.transportName, err))
+	}
+	return nil
+}
+
+// Compile-time check that PolicyRequirements implements json.Marshaler.
+var _ json.Marshaler = (*PolicyRequirements)(nil)
+
+// MarshalJSON implements the json.Marshaler interface.
+// The individual requirements are marshaled using the JSON tags of their (private) types.
+// Note that an empty PolicyRequirements, although representable, is rejected when parsing.
+func (m PolicyRequirements) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]PolicyRequirement(m))
+}
+
 // Compile-time check that PolicyRequirements implements json.Unmarshaler.
 var _ json.Unmarshaler = (*PolicyRequirements)(nil)
 
@@ -233,6 +439,14 @@ func newPolicyRequirementFromJSON(data []byte) (PolicyRequirement, error) {
 		res = &prSignedBy{}
 	case prTypeSignedBaseLayer:
 		res = &prSignedBaseLayer{}
+	case prTypeSigstoreSigned:
+		res = &prSigstoreSigned{}
+	case prTypeSignedByThreshold:
+		res = &prSignedByThreshold{}
+	case prTypeNotationSigned:
+		res = &prNotationSigned{}
+	case prTypeNotarySigned:
+		res = &prNotarySigned{}
 	default:
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("Unknown policy requirement type \"%s\"", typeField.Type))
 	}
@@ -303,12 +517,35 @@ func (pr *prReject) UnmarshalJSON(data []byte) error {
 }
 
 // newPRSignedBy returns a new prSignedBy if parameters are valid.
-func newPRSignedBy(keyType sbKeyType, keyPath string, keyData []byte, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
+func newPRSignedBy(keyType sbKeyType, keyPath string, keyPaths []string, keyData []byte, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
 	if !keyType.IsValid() {
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid keyType \"%s\"", keyType))
 	}
-	if len(keyPath) > 0 && len(keyData) > 0 {
-		return nil, InvalidPolicyFormatError("keyType and keyData cannot be used simultaneously")
+	keySources := 0
+	if len(keyPath) > 0 {
+		keySources++
+	}
+	if keyPaths != nil {
+		keySources++
+	}
+	if len(keyData) > 0 {
+		keySources++
+	}
+	if keySources > 1 {
+		return nil, InvalidPolicyFormatError("at most one of keyPath, keyPaths and keyData can be used")
+	}
+	if keySources == 0 && keyData == nil { // An empty, but non-nil, keyData is valid, and contains no keys.
+		return nil, InvalidPolicyFormatError("one of keyPath, keyPaths and keyData must be specified")
+	}
+	if keyPaths != nil {
+		if len(keyPaths) == 0 {
+			return nil, InvalidPolicyFormatError("keyPaths must not be empty")
+		}
+		for _, p := range keyPaths {
+			if p == "" {
+				return nil, InvalidPolicyFormatError("keyPaths must not contain empty values")
+			}
+		}
 	}
 	if signedIdentity == nil {
 		return nil, InvalidPolicyFormatError("signedIdentity not specified")
@@ -317,6 +554,7 @@ func newPRSignedBy(keyType sbKeyType, keyPath string, keyData []byte, signedIden
 		prCommon:       prCommon{Type: prTypeSignedBy},
 		KeyType:        keyType,
 		KeyPath:        keyPath,
+		KeyPaths:       keyPaths,
 		KeyData:        keyData,
 		SignedIdentity: signedIdentity,
 	}, nil
@@ -324,7 +562,7 @@ func newPRSignedBy(keyType sbKeyType, keyPath string, keyData []byte, signedIden
 
 // newPRSignedByKeyPath is NewPRSignedByKeyPath, except it returns the private type.
 func newPRSignedByKeyPath(keyType sbKeyType, keyPath string, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
-	return newPRSignedBy(keyType, keyPath, nil, signedIdentity)
+	return newPRSignedBy(keyType, keyPath, nil, nil, signedIdentity)
 }
 
 // NewPRSignedByKeyPath returns a new "signedBy" PolicyRequirement using a KeyPath
@@ -332,9 +570,22 @@ func NewPRSignedByKeyPath(keyType sbKeyType, keyPath string, signedIdentity Poli
 	return newPRSignedByKeyPath(keyType, keyPath, signedIdentity)
 }
 
+// newPRSignedByKeyPaths is NewPRSignedByKeyPaths, except it returns the private type.
+func newPRSignedByKeyPaths(keyType sbKeyType, keyPaths []string, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
+	if keyPaths == nil {
+		keyPaths = []string{} // Make sure newPRSignedBy sees keyPaths as specified, and rejects the empty set.
+	}
+	return newPRSignedBy(keyType, "", keyPaths, nil, signedIdentity)
+}
+
+// NewPRSignedByKeyPaths returns a new "signedBy" PolicyRequirement using KeyPaths
+func NewPRSignedByKeyPaths(keyType sbKeyType, keyPaths []string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
+	return newPRSignedByKeyPaths(keyType, keyPaths, signedIdentity)
+}
+
 // newPRSignedByKeyData is NewPRSignedByKeyData, except it returns the private type.
 func newPRSignedByKeyData(keyType sbKeyType, keyData []byte, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
-	return newPRSignedBy(keyType, "", keyData, signedIdentity)
+	return newPRSignedBy(keyType, "", nil, keyData, signedIdentity)
 }
 
 // NewPRSignedByKeyData returns a new "signedBy" PolicyRequirement using a KeyData
@@ -349,7 +600,8 @@ var _ json.Unmarshaler = (*prSignedBy)(nil)
 func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 	*pr = prSignedBy{}
 	var tmp prSignedBy
-	var gotKeyPath, gotKeyData = false, false
+	var gotKeyPath, gotKeyPaths, gotKeyData, gotKeyFingerprints = false, false, false, false
+	var maxSignatureAgeSeconds float64
 	var signedIdentity json.RawMessage
 	if err := paranoidUnmarshalJSONObject(data, func(key string) interface{} {
 		switch key {
@@ -360,11 +612,21 @@ func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 		case "keyPath":
 			gotKeyPath = true
 			return &tmp.KeyPath
+		case "keyPaths":
+			gotKeyPaths = true
+			return &tmp.KeyPaths
 		case "keyData":
 			gotKeyData = true
 			return &tmp.KeyData
 		case "signedIdentity":
 			return &signedIdentity
+		case "keyFingerprints":
+			gotKeyFingerprints = true
+			return &tmp.KeyFingerprints
+		case "maxSignatureAgeSeconds":
+			return &maxSignatureAgeSeconds
+		case "rejectExpiredSignatures":
+			return &tmp.RejectExpiredSignatures
 		default:
 			return nil
 		}
@@ -388,25 +650,66 @@ func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 	var res *prSignedBy
 	var err error
 	switch {
-	case gotKeyPath && gotKeyData:
-		return InvalidPolicyFormatError("keyPath and keyData cannot be used simultaneously")
-	case gotKeyPath && !gotKeyData:
+	case gotKeyPath && !gotKeyPaths && !gotKeyData:
 		res, err = newPRSignedByKeyPath(tmp.KeyType, tmp.KeyPath, tmp.SignedIdentity)
-	case !gotKeyPath && gotKeyData:
+	case !gotKeyPath && gotKeyPaths && !gotKeyData:
+		res, err = newPRSignedByKeyPaths(tmp.KeyType, tmp.KeyPaths, tmp.SignedIdentity)
+	case !gotKeyPath && !gotKeyPaths && gotKeyData:
 		res, err = newPRSignedByKeyData(tmp.KeyType, tmp.KeyData, tmp.SignedIdentity)
-	case !gotKeyPath && !gotKeyData:
-		return InvalidPolicyFormatError("At least one of keyPath and keyData mus be specified")
-	default: // Coverage: This should never happen
-		return errors.Errorf("Impossible keyPath/keyData presence combination!?")
+	case !gotKeyPath && !gotKeyPaths && !gotKeyData:
+		return InvalidPolicyFormatError("At least one of keyPath, keyPaths and keyData must be specified")
+	default:
+		return InvalidPolicyFormatError("keyPath, keyPaths and keyData cannot be used simultaneously")
 	}
 	if err != nil {
 		return err
 	}
+
+	if gotKeyFingerprints {
+		if res.KeyType != SBKeyTypeGPGKeys {
+			return InvalidPolicyFormatError(fmt.Sprintf("keyFingerprints is not supported with keyType \"%s\"", res.KeyType))
+		}
+		if len(tmp.KeyFingerprints) == 0 {
+			return InvalidPolicyFormatError("keyFingerprints must not be empty")
+		}
+		for _, fingerprint := range tmp.KeyFingerprints {
+			if !isValidKeyFingerprint(fingerprint) {
+				return InvalidPolicyFormatError(fmt.Sprintf("Invalid key fingerprint \"%s\"", fingerprint))
+			}
+		}
+		res.KeyFingerprints = tmp.KeyFingerprints
+	}
+
+	res.MaxSignatureAgeSeconds = int64(maxSignatureAgeSeconds)
+	if float64(res.MaxSignatureAgeSeconds) != maxSignatureAgeSeconds {
+		return InvalidPolicyFormatError(fmt.Sprintf("maxSignatureAgeSeconds %v is not an integer", maxSignatureAgeSeconds))
+	}
+	if res.MaxSignatureAgeSeconds < 0 {
+		return InvalidPolicyFormatError(fmt.Sprintf("maxSignatureAgeSeconds must not be negative, not %d", res.MaxSignatureAgeSeconds))
+	}
+	res.RejectExpiredSignatures = tmp.RejectExpiredSignatures
+	if (res.MaxSignatureAgeSeconds != 0 || res.RejectExpiredSignatures) && res.KeyType != SBKeyTypeGPGKeys {
+		return InvalidPolicyFormatError(fmt.Sprintf("maxSignatureAgeSeconds and rejectExpiredSignatures are not supported with keyType \"%s\"", res.KeyType))
+	}
 	*pr = *res
 
 	return nil
 }
 
+// isValidKeyFingerprint returns true iff fingerprint is syntactically valid as a full GPG key fingerprint:
+// a hexadecimal string of 40 (V4 keys) or 64 (V5 keys) characters. Shorter key IDs are rejected, they are too easy to forge.
+func isValidKeyFingerprint(fingerprint string) bool {
+	if len(fingerprint) != 40 && len(fingerprint) != 64 {
+		return false
+	}
+	for _, c := range fingerprint {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
 // IsValid returns true iff kt is a recognized value
 func (kt sbKeyType) IsValid() bool {
 	switch kt {
@@ -482,6 +785,493 @@ func (pr *prSignedBaseLayer) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// newPRSigstoreSigned returns a new prSigstoreSigned if parameters are valid.
+func newPRSigstoreSigned(keyPath string, keyData []byte, keyURI string, fulcio *prSigstoreSignedFulcio, rekorPublicKeyPath string, signedIdentity PolicyReferenceMatch) (*prSigstoreSigned, error) {
+	sources := 0
+	if len(keyPath) > 0 {
+		sources++
+	}
+	if len(keyData) > 0 {
+		sources++
+	}
+	if len(keyURI) > 0 {
+		sources++
+		if _, err := sigstoreKeyURIScheme(keyURI); err != nil {
+			return nil, InvalidPolicyFormatError(err.Error())
+		}
+	}
+	if fulcio != nil {
+		sources++
+	}
+	if sources > 1 {
+		return nil, InvalidPolicyFormatError("at most one of keyPath, keyData, keyURI and fulcio can be used")
+	}
+	if fulcio != nil && rekorPublicKeyPath == "" {
+		return nil, InvalidPolicyFormatError("rekorPublicKeyPath must be specified when using fulcio")
+	}
+	if signedIdentity == nil {
+		return nil, InvalidPolicyFormatError("signedIdentity not specified")
+	}
+	return &prSigstoreSigned{
+		prCommon:           prCommon{Type: prTypeSigstoreSigned},
+		KeyPath:            keyPath,
+		KeyData:            keyData,
+		KeyURI:             keyURI,
+		Fulcio:             fulcio,
+		RekorPublicKeyPath: rekorPublicKeyPath,
+		SignedIdentity:     signedIdentity,
+	}, nil
+}
+
+// newPRSigstoreSignedKeyPath is NewPRSigstoreSignedKeyPath, except it returns the private type.
+func newPRSigstoreSignedKeyPath(keyPath string, signedIdentity PolicyReferenceMatch) (*prSigstoreSigned, error) {
+	return newPRSigstoreSigned(keyPath, nil, "", nil, "", signedIdentity)
+}
+
+// NewPRSigstoreSignedKeyPath returns a new "sigstoreSigned" PolicyRequirement using a KeyPath
+func NewPRSigstoreSignedKeyPath(keyPath string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
+	return newPRSigstoreSignedKeyPath(keyPath, signedIdentity)
+}
+
+// newPRSigstoreSignedKeyData is NewPRSigstoreSignedKeyData, except it returns the private type.
+func newPRSigstoreSignedKeyData(keyData []byte, signedIdentity PolicyReferenceMatch) (*prSigstoreSigned, error) {
+	return newPRSigstoreSigned("", keyData, "", nil, "", signedIdentity)
+}
+
+// NewPRSigstoreSignedKeyData returns a new "sigstoreSigned" PolicyRequirement using a KeyData
+func NewPRSigstoreSignedKeyData(keyData []byte, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
+	return newPRSigstoreSignedKeyData(keyData, signedIdentity)
+}
+
+// newPRSigstoreSignedKeyURI is NewPRSigstoreSignedKeyURI, except it returns the private type.
+func newPRSigstoreSignedKeyURI(keyURI string, signedIdentity PolicyReferenceMatch) (*prSigstoreSigned, error) {
+	return newPRSigstoreSigned("", nil, keyURI, nil, "", signedIdentity)
+}
+
+// NewPRSigstoreSignedKeyURI returns a new "sigstoreSigned" PolicyRequirement using a KeyURI
+func NewPRSigstoreSignedKeyURI(keyURI string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
+	return newPRSigstoreSignedKeyURI(keyURI, signedIdentity)
+}
+
+// newPRSigstoreSignedFulcioCAPath is NewPRSigstoreSignedFulcioCAPath, except it returns the private type.
+func newPRSigstoreSignedFulcioCAPath(caPath, oidcIssuer, subjectEmail, rekorPublicKeyPath string, signedIdentity PolicyReferenceMatch) (*prSigstoreSigned, error) {
+	fulcio, err := newPRSigstoreSignedFulcio(caPath, nil, oidcIssuer, subjectEmail)
+	if err != nil {
+		return nil, err
+	}
+	return newPRSigstoreSigned("", nil, "", fulcio, rekorPublicKeyPath, signedIdentity)
+}
+
+// NewPRSigstoreSignedFulcioCAPath returns a new "sigstoreSigned" PolicyRequirement accepting keys certified by Fulcio,
+// using a CAPath, and requiring a Rekor SET signed by the key in rekorPublicKeyPath
+func NewPRSigstoreSignedFulcioCAPath(caPath, oidcIssuer, subjectEmail, rekorPublicKeyPath string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
+	return newPRSigstoreSignedFulcioCAPath(caPath, oidcIssuer, subjectEmail, rekorPublicKeyPath, signedIdentity)
+}
+
+// newPRSigstoreSignedFulcioCAData is NewPRSigstoreSignedFulcioCAData, except it returns the private type.
+func newPRSigstoreSignedFulcioCAData(caData []byte, oidcIssuer, subjectEmail, rekorPublicKeyPath string, signedIdentity PolicyReferenceMatch) (*prSigstoreSigned, error) {
+	fulcio, err := newPRSigstoreSignedFulcio("", caData, oidcIssuer, subjectEmail)
+	if err != nil {
+		return nil, err
+	}
+	return newPRSigstoreSigned("", nil, "", fulcio, rekorPublicKeyPath, signedIdentity)
+}
+
+// NewPRSigstoreSignedFulcioCAData returns a new "sigstoreSigned" PolicyRequirement accepting keys certified by Fulcio,
+// using a CAData, and requiring a Rekor SET signed by the key in rekorPublicKeyPath
+func NewPRSigstoreSignedFulcioCAData(caData []byte, oidcIssuer, subjectEmail, rekorPublicKeyPath string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
+	return newPRSigstoreSignedFulcioCAData(caData, oidcIssuer, subjectEmail, rekorPublicKeyPath, signedIdentity)
+}
+
+// Compile-time check that prSigstoreSigned implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prSigstoreSigned)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
+	*pr = prSigstoreSigned{}
+	var tmp prSigstoreSigned
+	var gotKeyPath, gotKeyData, gotKeyURI, gotFulcio = false, false, false, false
+	var fulcio prSigstoreSignedFulcio
+	var signedIdentity json.RawMessage
+	if err := paranoidUnmarshalJSONObject(data, func(key string) interface{} {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "keyPath":
+			gotKeyPath = true
+			return &tmp.KeyPath
+		case "keyData":
+			gotKeyData = true
+			return &tmp.KeyData
+		case "keyURI":
+			gotKeyURI = true
+			return &tmp.KeyURI
+		case "fulcio":
+			gotFulcio = true
+			return &fulcio
+		case "rekorPublicKeyPath":
+			return &tmp.RekorPublicKeyPath
+		case "signedIdentity":
+			return &signedIdentity
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeSigstoreSigned {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+	if signedIdentity == nil {
+		tmp.SignedIdentity = NewPRMMatchRepoDigestOrExact()
+	} else {
+		si, err := newPolicyReferenceMatchFromJSON(signedIdentity)
+		if err != nil {
+			return err
+		}
+		tmp.SignedIdentity = si
+	}
+
+	var res *prSigstoreSigned
+	var err error
+	switch {
+	case gotKeyPath && !gotKeyData && !gotKeyURI && !gotFulcio:
+		res, err = newPRSigstoreSigned(tmp.KeyPath, nil, "", nil, tmp.RekorPublicKeyPath, tmp.SignedIdentity)
+	case !gotKeyPath && gotKeyData && !gotKeyURI && !gotFulcio:
+		res, err = newPRSigstoreSigned("", tmp.KeyData, "", nil, tmp.RekorPublicKeyPath, tmp.SignedIdentity)
+	case !gotKeyPath && !gotKeyData && gotKeyURI && !gotFulcio:
+		res, err = newPRSigstoreSigned("", nil, tmp.KeyURI, nil, tmp.RekorPublicKeyPath, tmp.SignedIdentity)
+	case !gotKeyPath && !gotKeyData && !gotKeyURI && gotFulcio:
+		res, err = newPRSigstoreSigned("", nil, "", &fulcio, tmp.RekorPublicKeyPath, tmp.SignedIdentity)
+	case !gotKeyPath && !gotKeyData && !gotKeyURI && !gotFulcio:
+		return InvalidPolicyFormatError("At least one of keyPath, keyData, keyURI and fulcio must be specified")
+	default:
+		return InvalidPolicyFormatError("keyPath, keyData, keyURI and fulcio cannot be used simultaneously")
+	}
+	if err != nil {
+		return err
+	}
+	*pr = *res
+
+	return nil
+}
+
+// newPRSigstoreSignedFulcio returns a new prSigstoreSignedFulcio if parameters are valid.
+func newPRSigstoreSignedFulcio(caPath string, caData []byte, oidcIssuer, subjectEmail string) (*prSigstoreSignedFulcio, error) {
+	if len(caPath) > 0 && len(caData) > 0 {
+		return nil, InvalidPolicyFormatError("caPath and caData cannot be used simultaneously")
+	}
+	if len(caPath) == 0 && len(caData) == 0 {
+		return nil, InvalidPolicyFormatError("At least one of caPath and caData must be specified")
+	}
+	if oidcIssuer == "" {
+		return nil, InvalidPolicyFormatError("oidcIssuer not specified")
+	}
+	if subjectEmail == "" {
+		return nil, InvalidPolicyFormatError("subjectEmail not specified")
+	}
+	return &prSigstoreSignedFulcio{
+		CAPath:       caPath,
+		CAData:       caData,
+		OIDCIssuer:   oidcIssuer,
+		SubjectEmail: subjectEmail,
+	}, nil
+}
+
+// Compile-time check that prSigstoreSignedFulcio implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prSigstoreSignedFulcio)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (f *prSigstoreSignedFulcio) UnmarshalJSON(data []byte) error {
+	*f = prSigstoreSignedFulcio{}
+	var tmp prSigstoreSignedFulcio
+	var gotCAPath, gotCAData, gotOIDCIssuer, gotSubjectEmail = false, false, false, false
+	if err := paranoidUnmarshalJSONObject(data, func(key string) interface{} {
+		switch key {
+		case "caPath":
+			gotCAPath = true
+			return &tmp.CAPath
+		case "caData":
+			gotCAData = true
+			return &tmp.CAData
+		case "oidcIssuer":
+			gotOIDCIssuer = true
+			return &tmp.OIDCIssuer
+		case "subjectEmail":
+			gotSubjectEmail = true
+			return &tmp.SubjectEmail
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if gotCAPath && gotCAData {
+		return InvalidPolicyFormatError("caPath and caData cannot be used simultaneously")
+	}
+	if !gotCAPath && !gotCAData {
+		return InvalidPolicyFormatError("At least one of caPath and caData must be specified")
+	}
+	if !gotOIDCIssuer {
+		return InvalidPolicyFormatError("oidcIssuer not specified")
+	}
+	if !gotSubjectEmail {
+		return InvalidPolicyFormatError("subjectEmail not specified")
+	}
+	res, err := newPRSigstoreSignedFulcio(tmp.CAPath, tmp.CAData, tmp.OIDCIssuer, tmp.SubjectEmail)
+	if err != nil {
+		return err
+	}
+	*f = *res
+	return nil
+}
+
+// newPRSignedByThreshold is NewPRSignedByThreshold, except it returns the private type.
+func newPRSignedByThreshold(threshold int, keyPaths []string, signedIdentity PolicyReferenceMatch) (*prSignedByThreshold, error) {
+	if threshold < 1 {
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("threshold must be at least 1, not %d", threshold))
+	}
+	if len(keyPaths) == 0 {
+		return nil, InvalidPolicyFormatError("keyPaths must not be empty")
+	}
+	for _, p := range keyPaths {
+		if p == "" {
+			return nil, InvalidPolicyFormatError("keyPaths must not contain empty values")
+		}
+	}
+	if signedIdentity == nil {
+		return nil, InvalidPolicyFormatError("signedIdentity not specified")
+	}
+	return &prSignedByThreshold{
+		prCommon:       prCommon{Type: prTypeSignedByThreshold},
+		Threshold:      threshold,
+		KeyPaths:       keyPaths,
+		SignedIdentity: signedIdentity,
+	}, nil
+}
+
+// NewPRSignedByThreshold returns a new "signedByThreshold" PolicyRequirement, accepting images signed
+// by at least threshold different GPG keys from keyPaths.
+func NewPRSignedByThreshold(threshold int, keyPaths []string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
+	return newPRSignedByThreshold(threshold, keyPaths, signedIdentity)
+}
+
+// Compile-time check that prSignedByThreshold implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prSignedByThreshold)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prSignedByThreshold) UnmarshalJSON(data []byte) error {
+	*pr = prSignedByThreshold{}
+	var tmp prSignedByThreshold
+	var threshold float64
+	var gotThreshold, gotKeyPaths = false, false
+	var signedIdentity json.RawMessage
+	if err := paranoidUnmarshalJSONObject(data, func(key string) interface{} {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "threshold":
+			gotThreshold = true
+			return &threshold
+		case "keyPaths":
+			gotKeyPaths = true
+			return &tmp.KeyPaths
+		case "signedIdentity":
+			return &signedIdentity
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeSignedByThreshold {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+	if !gotThreshold {
+		return InvalidPolicyFormatError("threshold not specified")
+	}
+	tmp.Threshold = int(threshold)
+	if float64(tmp.Threshold) != threshold {
+		return InvalidPolicyFormatError(fmt.Sprintf("threshold %v is not an integer", threshold))
+	}
+	if !gotKeyPaths {
+		return InvalidPolicyFormatError("keyPaths not specified")
+	}
+	if signedIdentity == nil {
+		tmp.SignedIdentity = NewPRMMatchRepoDigestOrExact()
+	} else {
+		si, err := newPolicyReferenceMatchFromJSON(signedIdentity)
+		if err != nil {
+			return err
+		}
+		tmp.SignedIdentity = si
+	}
+
+	res, err := newPRSignedByThreshold(tmp.Threshold, tmp.KeyPaths, tmp.SignedIdentity)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
+// newPRNotationSigned returns a new prNotationSigned if parameters are valid.
+func newPRNotationSigned(trustStorePath string, trustStoreData []byte, trustedIdentities []string) (*prNotationSigned, error) {
+	if len(trustStorePath) > 0 && len(trustStoreData) > 0 {
+		return nil, InvalidPolicyFormatError("trustStorePath and trustStoreData cannot be used simultaneously")
+	}
+	if len(trustStorePath) == 0 && len(trustStoreData) == 0 {
+		return nil, InvalidPolicyFormatError("At least one of trustStorePath and trustStoreData must be specified")
+	}
+	if _, err := parseNotationTrustedIdentities(trustedIdentities); err != nil {
+		return nil, InvalidPolicyFormatError(err.Error())
+	}
+	return &prNotationSigned{
+		prCommon:          prCommon{Type: prTypeNotationSigned},
+		TrustStorePath:    trustStorePath,
+		TrustStoreData:    trustStoreData,
+		TrustedIdentities: trustedIdentities,
+	}, nil
+}
+
+// newPRNotationSignedTrustStorePath is NewPRNotationSignedTrustStorePath, except it returns the private type.
+func newPRNotationSignedTrustStorePath(trustStorePath string, trustedIdentities []string) (*prNotationSigned, error) {
+	return newPRNotationSigned(trustStorePath, nil, trustedIdentities)
+}
+
+// NewPRNotationSignedTrustStorePath returns a new "notationSigned" PolicyRequirement using a TrustStorePath
+func NewPRNotationSignedTrustStorePath(trustStorePath string, trustedIdentities []string) (PolicyRequirement, error) {
+	return newPRNotationSignedTrustStorePath(trustStorePath, trustedIdentities)
+}
+
+// newPRNotationSignedTrustStoreData is NewPRNotationSignedTrustStoreData, except it returns the private type.
+func newPRNotationSignedTrustStoreData(trustStoreData []byte, trustedIdentities []string) (*prNotationSigned, error) {
+	return newPRNotationSigned("", trustStoreData, trustedIdentities)
+}
+
+// NewPRNotationSignedTrustStoreData returns a new "notationSigned" PolicyRequirement using a TrustStoreData
+func NewPRNotationSignedTrustStoreData(trustStoreData []byte, trustedIdentities []string) (PolicyRequirement, error) {
+	return newPRNotationSignedTrustStoreData(trustStoreData, trustedIdentities)
+}
+
+// Compile-time check that prNotationSigned implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prNotationSigned)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prNotationSigned) UnmarshalJSON(data []byte) error {
+	*pr = prNotationSigned{}
+	var tmp prNotationSigned
+	var gotTrustStorePath, gotTrustStoreData, gotTrustedIdentities = false, false, false
+	if err := paranoidUnmarshalJSONObject(data, func(key string) interface{} {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "trustStorePath":
+			gotTrustStorePath = true
+			return &tmp.TrustStorePath
+		case "trustStoreData":
+			gotTrustStoreData = true
+			return &tmp.TrustStoreData
+		case "trustedIdentities":
+			gotTrustedIdentities = true
+			return &tmp.TrustedIdentities
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeNotationSigned {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+	if gotTrustStorePath && gotTrustStoreData {
+		return InvalidPolicyFormatError("trustStorePath and trustStoreData cannot be used simultaneously")
+	}
+	if !gotTrustStorePath && !gotTrustStoreData {
+		return InvalidPolicyFormatError("At least one of trustStorePath and trustStoreData must be specified")
+	}
+	if !gotTrustedIdentities {
+		return InvalidPolicyFormatError("trustedIdentities not specified")
+	}
+
+	res, err := newPRNotationSigned(tmp.TrustStorePath, tmp.TrustStoreData, tmp.TrustedIdentities)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
+// newPRNotarySigned is NewPRNotarySigned, except it returns the private type.
+func newPRNotarySigned(server, trustDir string) (*prNotarySigned, error) {
+	if server != "" {
+		u, err := url.Parse(server)
+		if err != nil {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("Invalid Notary server URL %q: %v", server, err))
+		}
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("Invalid Notary server URL %q, expected an http or https URL", server))
+		}
+	}
+	if trustDir == "" {
+		return nil, InvalidPolicyFormatError("trustDir must be specified")
+	}
+	return &prNotarySigned{
+		prCommon: prCommon{Type: prTypeNotarySigned},
+		Server:   server,
+		TrustDir: trustDir,
+	}, nil
+}
+
+// NewPRNotarySigned returns a new "notarySigned" PolicyRequirement, using the Notary server at server
+// (or a default one if server is ""), and storing TUF metadata in trustDir.
+func NewPRNotarySigned(server, trustDir string) (PolicyRequirement, error) {
+	return newPRNotarySigned(server, trustDir)
+}
+
+// Compile-time check that prNotarySigned implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prNotarySigned)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prNotarySigned) UnmarshalJSON(data []byte) error {
+	*pr = prNotarySigned{}
+	var tmp prNotarySigned
+	var gotTrustDir = false
+	if err := paranoidUnmarshalJSONObject(data, func(key string) interface{} {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "server":
+			return &tmp.Server
+		case "trustDir":
+			gotTrustDir = true
+			return &tmp.TrustDir
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeNotarySigned {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+	if !gotTrustDir {
+		return InvalidPolicyFormatError("trustDir not specified")
+	}
+
+	res, err := newPRNotarySigned(tmp.Server, tmp.TrustDir)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
 // newPolicyReferenceMatchFromJSON parses JSON data into a PolicyReferenceMatch implementation.
 func newPolicyReferenceMatchFromJSON(data []byte) (PolicyReferenceMatch, error) {
 	var typeField prmCommon
@@ -500,6 +1290,8 @@ func newPolicyReferenceMatchFromJSON(data []byte) (PolicyReferenceMatch, error)
 		res = &prmExactReference{}
 	case prmTypeExactRepository:
 		res = &prmExactRepository{}
+	case prmTypeRemapIdentity:
+		res = &prmRemapIdentity{}
 	default:
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("Unknown policy reference match type \"%s\"", typeField.Type))
 	}
@@ -686,3 +1478,69 @@ func (prm *prmExactRepository) UnmarshalJSON(data []byte) error {
 	*prm = *res
 	return nil
 }
+
+// validateIdentityRemappingPrefix returns an InvalidPolicyFormatError if s is detected to be invalid
+// for the Prefix or SignedPrefix values of prmRemapIdentity.
+// Note that it may not recognize _all_ invalid values.
+func validateIdentityRemappingPrefix(s string) error {
+	if !strings.Contains(s, "/") {
+		// A host[:port] value; reference.ParseNormalizedNamed does not accept that on its own, so check it as a part of a repository name.
+		ref, err := reference.ParseNormalizedNamed(s + "/repo")
+		if err == nil && reference.Domain(ref) == s {
+			return nil
+		}
+	} else if ref, err := reference.ParseNormalizedNamed(s); err == nil && reference.IsNameOnly(ref) && strings.HasPrefix(ref.Name(), s) {
+		// The prefix check rejects values which are not in the fully-qualified form, e.g. "library/busybox";
+		// matching is done against reference.Named.Name(), so those would never match anything.
+		// Note that "docker.io/library" is accepted even though it is normalized to "docker.io/library/library".
+		return nil
+	}
+	return InvalidPolicyFormatError(fmt.Sprintf("prefix %s is not valid", s))
+}
+
+// newPRMRemapIdentity is NewPRMRemapIdentity, except it returns the private type.
+func newPRMRemapIdentity(prefix, signedPrefix string) (*prmRemapIdentity, error) {
+	if err := validateIdentityRemappingPrefix(prefix); err != nil {
+		return nil, err
+	}
+	if err := validateIdentityRemappingPrefix(signedPrefix); err != nil {
+		return nil, err
+	}
+	return &prmRemapIdentity{
+		prmCommon:    prmCommon{Type: prmTypeRemapIdentity},
+		Prefix:       prefix,
+		SignedPrefix: signedPrefix,
+	}, nil
+}
+
+// NewPRMRemapIdentity returns a new "remapIdentity" PolicyRepositoryMatch.
+func NewPRMRemapIdentity(prefix, signedPrefix string) (PolicyReferenceMatch, error) {
+	return newPRMRemapIdentity(prefix, signedPrefix)
+}
+
+// Compile-time check that prmRemapIdentity implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prmRemapIdentity)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (prm *prmRemapIdentity) UnmarshalJSON(data []byte) error {
+	*prm = prmRemapIdentity{}
+	var tmp prmRemapIdentity
+	if err := paranoidUnmarshalJSONObjectExactFields(data, map[string]interface{}{
+		"type":         &tmp.Type,
+		"prefix":       &tmp.Prefix,
+		"signedPrefix": &tmp.SignedPrefix,
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prmTypeRemapIdentity {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+
+	res, err := newPRMRemapIdentity(tmp.Prefix, tmp.SignedPrefix)
+	if err != nil {
+		return err
+	}
+	*prm = *res
+	return nil
+}
@@ -3,7 +3,9 @@ package signature
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -55,6 +57,17 @@ var policyFixtureContents = &Policy{
 					"/keys/RH-key-signing-key-gpg-keyring",
 					NewPRMMatchRepoDigestOrExact()),
 			},
+			"example.com/sigstore": {
+				xNewPRSigstoreSignedKeyPath("/keys/sigstore-public-key.pem",
+					NewPRMMatchRepository()),
+			},
+			"example.com/notation": {
+				xNewPRNotationSignedTrustStorePath("/keys/notation-ca.pem",
+					[]string{"x509.subject: C=US, O=Example"}),
+			},
+			"example.com/notary": {
+				xNewPRNotarySigned("https://notary.example.com", "/var/lib/notary"),
+			},
 			"bogus/key-data-example": {
 				xNewPRSignedByKeyData(SBKeyTypeSignedByGPGKeys,
 					[]byte("nonsense"),
@@ -124,6 +137,39 @@ func TestDefaultPolicyPath(t *testing.T) {
 	}
 }
 
+func TestDefaultPolicyFragmentsPath(t *testing.T) {
+	const nondefaultPath = "/this/is/not/the/default/path.json"
+	const rootPrefix = "/root/prefix"
+
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		expected string
+	}{
+		// The common case
+		{nil, systemDefaultPolicyFragmentsPath},
+		// There is a context, but it does not override the path.
+		{&types.SystemContext{}, systemDefaultPolicyFragmentsPath},
+		// Policy path overridden: no fragments
+		{&types.SystemContext{SignaturePolicyPath: nondefaultPath}, ""},
+		// Root overridden
+		{
+			&types.SystemContext{RootForImplicitAbsolutePaths: rootPrefix},
+			filepath.Join(rootPrefix, systemDefaultPolicyFragmentsPath),
+		},
+		// Root and path overrides present simultaneously,
+		{
+			&types.SystemContext{
+				RootForImplicitAbsolutePaths: rootPrefix,
+				SignaturePolicyPath:          nondefaultPath,
+			},
+			"",
+		},
+	} {
+		path := defaultPolicyFragmentsPath(c.sys)
+		assert.Equal(t, c.expected, path)
+	}
+}
+
 func TestNewPolicyFromFile(t *testing.T) {
 	// Success
 	policy, err := NewPolicyFromFile("./fixtures/policy.json")
@@ -140,6 +186,105 @@ func TestNewPolicyFromFile(t *testing.T) {
 	assert.IsType(t, InvalidPolicyFormatError(""), errors.Cause(err))
 }
 
+func TestNewPolicyFromFileWithFragments(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "policy-fragments")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	writeFragments := func(name string, fragments map[string]string) string {
+		dir := filepath.Join(tmpDir, name)
+		err := os.Mkdir(dir, 0755)
+		require.NoError(t, err)
+		for fileName, contents := range fragments {
+			err := ioutil.WriteFile(filepath.Join(dir, fileName), []byte(contents), 0644)
+			require.NoError(t, err)
+		}
+		return dir
+	}
+
+	// Missing or empty fragment directory
+	for _, dir := range []string{
+		filepath.Join(tmpDir, "this/doesnt/exist"),
+		writeFragments("empty", map[string]string{}),
+	} {
+		policy, err := NewPolicyFromFileWithFragments("./fixtures/policy.json", dir)
+		require.NoError(t, err)
+		assert.Equal(t, policyFixtureContents, policy)
+	}
+
+	// Success
+	dir := writeFragments("valid", map[string]string{
+		"10-example.json": `{"transports":{"docker":{"registry.example.com":[{"type":"reject"}]}}}`,
+		"20-atomic.json":  `{"transports":{"atomic":{"registry.example.com/ns":[{"type":"insecureAcceptAnything"}]},"docker":{"registry.example.com/more/specific":[{"type":"insecureAcceptAnything"}]}}}`,
+		"empty.json":      `{}`,
+		"ignored.txt":     `this is not a fragment`,
+	})
+	err = os.Mkdir(filepath.Join(dir, "subdir.json"), 0755)
+	require.NoError(t, err)
+	policy, err := NewPolicyFromFileWithFragments("./fixtures/policy.json", dir)
+	require.NoError(t, err)
+	assert.Equal(t, PolicyRequirements{NewPRReject()}, policy.Transports["docker"]["registry.example.com"])
+	assert.Equal(t, PolicyRequirements{NewPRInsecureAcceptAnything()}, policy.Transports["docker"]["registry.example.com/more/specific"])
+	assert.Equal(t, PolicyRequirements{NewPRInsecureAcceptAnything()}, policy.Transports["atomic"]["registry.example.com/ns"])
+	for transportName, scopes := range policyFixtureContents.Transports {
+		for scope, reqs := range scopes {
+			assert.Equal(t, reqs, policy.Transports[transportName][scope])
+		}
+	}
+
+	// Error reading the main policy
+	_, err = NewPolicyFromFileWithFragments("/this/doesnt/exist", dir)
+	assert.Error(t, err)
+
+	// Invalid fragments
+	for i, fragments := range []map[string]string{
+		{"invalid.json": `this is not JSON`},
+		{"default.json": `{"default":[{"type":"reject"}]}`},
+		{"unknown.json": `{"transports":{},"unknown":1}`},
+		{"invalid-scope.json": `{"transports":{"dir":{"relative/path":[{"type":"reject"}]}}}`},
+		// A conflict with the main policy
+		{"conflict.json": `{"transports":{"docker":{"example.com/playground":[{"type":"reject"}]}}}`},
+		// A conflict between fragments
+		{
+			"a.json": `{"transports":{"docker":{"registry.example.com":[{"type":"reject"}]}}}`,
+			"b.json": `{"transports":{"docker":{"registry.example.com":[{"type":"insecureAcceptAnything"}]}}}`,
+		},
+	} {
+		dir := writeFragments(fmt.Sprintf("invalid-%d", i), fragments)
+		_, err := NewPolicyFromFileWithFragments("./fixtures/policy.json", dir)
+		require.Error(t, err, fmt.Sprintf("%#v", fragments))
+		assert.IsType(t, InvalidPolicyFormatError(""), errors.Cause(err))
+	}
+
+	// DefaultPolicy ignores the fragments in the system directory unless the policy allows them
+	root := filepath.Join(tmpDir, "root")
+	err = os.MkdirAll(filepath.Join(root, systemDefaultPolicyFragmentsPath), 0755)
+	require.NoError(t, err)
+	policyBlob, err := ioutil.ReadFile("./fixtures/policy.json")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(root, systemDefaultPolicyPath), policyBlob, 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(root, systemDefaultPolicyFragmentsPath, "fragment.json"),
+		[]byte(`{"transports":{"docker":{"registry.example.com":[{"type":"reject"}]}}}`), 0644)
+	require.NoError(t, err)
+	policy, err = DefaultPolicy(&types.SystemContext{RootForImplicitAbsolutePaths: root})
+	require.NoError(t, err)
+	assert.Equal(t, policyFixtureContents, policy)
+
+	// DefaultPolicy uses the fragments in the system directory if the policy allows them
+	err = ioutil.WriteFile(filepath.Join(root, systemDefaultPolicyPath),
+		[]byte(`{"default":[{"type":"insecureAcceptAnything"}],"allowFragments":true}`), 0644)
+	require.NoError(t, err)
+	policy, err = DefaultPolicy(&types.SystemContext{RootForImplicitAbsolutePaths: root})
+	require.NoError(t, err)
+	assert.True(t, policy.AllowFragments)
+	assert.Equal(t, PolicyRequirements{NewPRReject()}, policy.Transports["docker"]["registry.example.com"])
+
+	// SignaturePolicyPath disables the fragments even if the policy allows them
+	policy, err = DefaultPolicy(&types.SystemContext{SignaturePolicyPath: filepath.Join(root, systemDefaultPolicyPath)})
+	require.NoError(t, err)
+	assert.Empty(t, policy.Transports["docker"])
+}
+
 func TestNewPolicyFromBytes(t *testing.T) {
 	// Success
 	bytes, err := ioutil.ReadFile("./fixtures/policy.json")
@@ -152,6 +297,31 @@ func TestNewPolicyFromBytes(t *testing.T) {
 	_, err = NewPolicyFromBytes([]byte(""))
 	require.Error(t, err)
 	assert.IsType(t, InvalidPolicyFormatError(""), err)
+
+	// Errors in a scope mention the scope
+	for _, c := range []struct{ input, scope string }{
+		{ // Invalid scope
+			`{"default":[{"type":"reject"}],"transports":{"dir":{"relative/path":[{"type":"reject"}]}}}`,
+			"relative/path",
+		},
+		{ // Empty requirement list
+			`{"default":[{"type":"reject"}],"transports":{"docker":{"example.com/empty":[]}}}`,
+			"example.com/empty",
+		},
+		{ // Unknown requirement type
+			`{"default":[{"type":"reject"}],"transports":{"docker":{"example.com/unknown":[{"type":"this is invalid"}]}}}`,
+			"example.com/unknown",
+		},
+		{ // Invalid requirement contents
+			`{"default":[{"type":"reject"}],"transports":{"dir":{"/invalid/signedBy":[{"type":"signedBy","keyType":"GPGKeys"}]}}}`,
+			"/invalid/signedBy",
+		},
+	} {
+		_, err = NewPolicyFromBytes([]byte(c.input))
+		require.Error(t, err, c.input)
+		assert.IsType(t, InvalidPolicyFormatError(""), err, c.input)
+		assert.Contains(t, err.Error(), fmt.Sprintf("%q", c.scope), c.input)
+	}
 }
 
 // FIXME? There is quite a bit of duplication below. Factor some of it out?
@@ -223,6 +393,33 @@ func xNewPRSignedByKeyData(keyType sbKeyType, keyData []byte, signedIdentity Pol
 	return pr
 }
 
+// xNewPRSigstoreSignedKeyPath is like NewPRSigstoreSignedKeyPath, except it must not fail.
+func xNewPRSigstoreSignedKeyPath(keyPath string, signedIdentity PolicyReferenceMatch) PolicyRequirement {
+	pr, err := NewPRSigstoreSignedKeyPath(keyPath, signedIdentity)
+	if err != nil {
+		panic("xNewPRSigstoreSignedKeyPath failed")
+	}
+	return pr
+}
+
+// xNewPRNotationSignedTrustStorePath is like NewPRNotationSignedTrustStorePath, except it must not fail.
+func xNewPRNotationSignedTrustStorePath(trustStorePath string, trustedIdentities []string) PolicyRequirement {
+	pr, err := NewPRNotationSignedTrustStorePath(trustStorePath, trustedIdentities)
+	if err != nil {
+		panic("xNewPRNotationSignedTrustStorePath failed")
+	}
+	return pr
+}
+
+// xNewPRNotarySigned is like NewPRNotarySigned, except it must not fail.
+func xNewPRNotarySigned(server, trustDir string) PolicyRequirement {
+	pr, err := NewPRNotarySigned(server, trustDir)
+	if err != nil {
+		panic("xNewPRNotarySigned failed")
+	}
+	return pr
+}
+
 func TestPolicyUnmarshalJSON(t *testing.T) {
 	var p Policy
 
@@ -277,6 +474,9 @@ func TestPolicyUnmarshalJSON(t *testing.T) {
 		func(v mSI) { v["transports"] = []string{} },
 		// "default" is an invalid PolicyRequirements
 		func(v mSI) { v["default"] = PolicyRequirements{} },
+		// "allowFragments" not a bool
+		func(v mSI) { v["allowFragments"] = 1 },
+		func(v mSI) { v["allowFragments"] = "true" },
 	}
 	for _, fn := range breakFns {
 		err = tryUnmarshalModifiedPolicy(t, &p, validJSON, fn)
@@ -284,7 +484,10 @@ func TestPolicyUnmarshalJSON(t *testing.T) {
 	}
 
 	// Duplicated fields
-	for _, field := range []string{"default", "transports"} {
+	validPolicy.AllowFragments = true
+	validJSON, err = json.Marshal(validPolicy)
+	require.NoError(t, err)
+	for _, field := range []string{"default", "transports", "allowFragments"} {
 		var tmp mSI
 		err := json.Unmarshal(validJSON, &tmp)
 		require.NoError(t, err)
@@ -302,6 +505,9 @@ func TestPolicyUnmarshalJSON(t *testing.T) {
 		func(v mSI) { delete(v, "transports") },
 		// Use an empty map of transport-specific scopes
 		func(v mSI) { v["transports"] = map[string]PolicyTransportScopes{} },
+		// Set or delete "allowFragments"
+		func(v mSI) { v["allowFragments"] = false },
+		func(v mSI) { delete(v, "allowFragments") },
 	}
 	for _, fn := range allowedModificationFns {
 		err = tryUnmarshalModifiedPolicy(t, &p, validJSON, fn)
@@ -309,6 +515,70 @@ func TestPolicyUnmarshalJSON(t *testing.T) {
 	}
 }
 
+func TestPolicyMarshalJSON(t *testing.T) {
+	remapPRM, err := NewPRMRemapIdentity("example.com/mirror", "example.com/origin")
+	require.NoError(t, err)
+	keyPathsPR, err := NewPRSignedByKeyPaths(SBKeyTypeGPGKeys, []string{"/keys/a", "/keys/b"}, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	sigstoreKeyDataPR, err := NewPRSigstoreSignedKeyData([]byte("PEM"), NewPRMMatchExact())
+	require.NoError(t, err)
+
+	for _, policy := range []*Policy{
+		policyFixtureContents,
+		// Every requirement and reference match type
+		{
+			Default: PolicyRequirements{NewPRReject()},
+			Transports: map[string]PolicyTransportScopes{
+				"docker": {
+					"":                      PolicyRequirements{NewPRInsecureAcceptAnything()},
+					"example.com/key-paths": PolicyRequirements{keyPathsPR},
+					"example.com/remap": PolicyRequirements{
+						xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/keys/a", remapPRM),
+					},
+					"example.com/sigstore": PolicyRequirements{sigstoreKeyDataPR},
+					"example.com/base-layer": PolicyRequirements{
+						xNewPRSignedBaseLayer(xNewPRMExactRepository("example.com/base")),
+						xNewPRSignedByKeyData(SBKeyTypeSignedByGPGKeys, []byte("abc"), xNewPRMExactReference("example.com/ref:tag")),
+					},
+				},
+			},
+		},
+		// Fragments allowed
+		{
+			Default:        PolicyRequirements{NewPRReject()},
+			Transports:     map[string]PolicyTransportScopes{},
+			AllowFragments: true,
+		},
+	} {
+		policyJSON, err := json.Marshal(policy)
+		require.NoError(t, err)
+		parsed, err := NewPolicyFromBytes(policyJSON)
+		require.NoError(t, err, string(policyJSON))
+		assert.Equal(t, policy, parsed)
+	}
+
+	// A nil Transports map, or nil scopes, are marshaled as empty objects.
+	policyJSON, err := json.Marshal(Policy{Default: PolicyRequirements{NewPRReject()}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"default":[{"type":"reject"}],"transports":{}}`, string(policyJSON))
+	_, err = NewPolicyFromBytes(policyJSON)
+	assert.NoError(t, err)
+
+	policyJSON, err = json.Marshal(Policy{
+		Default:    PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{"docker": nil},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"default":[{"type":"reject"}],"transports":{"docker":{}}}`, string(policyJSON))
+	_, err = NewPolicyFromBytes(policyJSON)
+	assert.NoError(t, err)
+
+	// A nil PolicyRequirements is marshaled as an empty array (which is then rejected when parsing).
+	reqsJSON, err := json.Marshal(PolicyRequirements(nil))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("[]"), reqsJSON)
+}
+
 func TestPolicyTransportScopesUnmarshalJSON(t *testing.T) {
 	var pts PolicyTransportScopes
 
@@ -636,41 +906,74 @@ func TestPRRejectUnmarshalJSON(t *testing.T) {
 
 func TestNewPRSignedBy(t *testing.T) {
 	const testPath = "/foo/bar"
+	testPaths := []string{"/path/1", "/path/2"}
 	testData := []byte("abc")
 	testIdentity := NewPRMMatchRepoDigestOrExact()
 
 	// Success
-	pr, err := newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, testIdentity)
+	pr, err := newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, testIdentity)
 	require.NoError(t, err)
 	assert.Equal(t, &prSignedBy{
 		prCommon:       prCommon{prTypeSignedBy},
 		KeyType:        SBKeyTypeGPGKeys,
 		KeyPath:        testPath,
+		KeyPaths:       nil,
+		KeyData:        nil,
+		SignedIdentity: testIdentity,
+	}, pr)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", testPaths, nil, testIdentity)
+	require.NoError(t, err)
+	assert.Equal(t, &prSignedBy{
+		prCommon:       prCommon{prTypeSignedBy},
+		KeyType:        SBKeyTypeGPGKeys,
+		KeyPath:        "",
+		KeyPaths:       testPaths,
 		KeyData:        nil,
 		SignedIdentity: testIdentity,
 	}, pr)
-	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", testData, testIdentity)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", nil, testData, testIdentity)
 	require.NoError(t, err)
 	assert.Equal(t, &prSignedBy{
 		prCommon:       prCommon{prTypeSignedBy},
 		KeyType:        SBKeyTypeGPGKeys,
 		KeyPath:        "",
+		KeyPaths:       nil,
 		KeyData:        testData,
 		SignedIdentity: testIdentity,
 	}, pr)
 
 	// Invalid keyType
-	pr, err = newPRSignedBy(sbKeyType(""), testPath, nil, testIdentity)
+	pr, err = newPRSignedBy(sbKeyType(""), testPath, nil, nil, testIdentity)
+	assert.Error(t, err)
+	pr, err = newPRSignedBy(sbKeyType("this is invalid"), testPath, nil, nil, testIdentity)
+	assert.Error(t, err)
+
+	// More than one of keyPath, keyPaths and keyData specified
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, testPaths, nil, testIdentity)
+	assert.Error(t, err)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, testData, testIdentity)
+	assert.Error(t, err)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", testPaths, testData, testIdentity)
+	assert.Error(t, err)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, testPaths, testData, testIdentity)
 	assert.Error(t, err)
-	pr, err = newPRSignedBy(sbKeyType("this is invalid"), testPath, nil, testIdentity)
+
+	// None of keyPath, keyPaths and keyData specified
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", nil, nil, testIdentity)
+	assert.Error(t, err)
+	_, err = NewPRSignedByKeyPath(SBKeyTypeGPGKeys, "", testIdentity)
+	assert.Error(t, err)
+	_, err = NewPRSignedByKeyData(SBKeyTypeGPGKeys, nil, testIdentity)
 	assert.Error(t, err)
 
-	// Both keyPath and keyData specified
-	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, testData, testIdentity)
+	// Invalid keyPaths
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", []string{}, nil, testIdentity)
+	assert.Error(t, err)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", []string{"/path/1", ""}, nil, testIdentity)
 	assert.Error(t, err)
 
 	// Invalid signedIdentity
-	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, nil)
 	assert.Error(t, err)
 }
 
@@ -684,6 +987,20 @@ func TestNewPRSignedByKeyPath(t *testing.T) {
 	// Failure cases tested in TestNewPRSignedBy.
 }
 
+func TestNewPRSignedByKeyPaths(t *testing.T) {
+	testPaths := []string{"/path/1", "/path/2"}
+	_pr, err := NewPRSignedByKeyPaths(SBKeyTypeGPGKeys, testPaths, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	pr, ok := _pr.(*prSignedBy)
+	require.True(t, ok)
+	assert.Equal(t, testPaths, pr.KeyPaths)
+
+	// nil keyPaths is rejected, the same as an empty set
+	_, err = NewPRSignedByKeyPaths(SBKeyTypeGPGKeys, nil, NewPRMMatchRepoDigestOrExact())
+	assert.Error(t, err)
+	// Other failure cases tested in TestNewPRSignedBy.
+}
+
 func TestNewPRSignedByKeyData(t *testing.T) {
 	testData := []byte("abc")
 	_pr, err := NewPRSignedByKeyData(SBKeyTypeGPGKeys, testData, NewPRMMatchRepoDigestOrExact())
@@ -736,6 +1053,16 @@ func TestPRSignedByUnmarshalJSON(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, kpPR, &pr)
 
+	// Success with KeyPaths
+	kpsPR, err := NewPRSignedByKeyPaths(SBKeyTypeGPGKeys, []string{"/path/1", "/path/2"}, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	testJSON, err = json.Marshal(kpsPR)
+	require.NoError(t, err)
+	pr = prSignedBy{}
+	err = json.Unmarshal(testJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, kpsPR, &pr)
+
 	// newPolicyRequirementFromJSON recognizes this type
 	_pr, err := newPolicyRequirementFromJSON(validJSON)
 	require.NoError(t, err)
@@ -754,13 +1081,21 @@ func TestPRSignedByUnmarshalJSON(t *testing.T) {
 		func(v mSI) { delete(v, "keyType") },
 		// Invalid "keyType" field
 		func(v mSI) { v["keyType"] = "this is invalid" },
-		// Both "keyPath" and "keyData" is missing
+		// All of "keyPath", "keyPaths" and "keyData" are missing
 		func(v mSI) { delete(v, "keyData") },
-		// Both "keyPath" and "keyData" is present
+		// More than one of "keyPath", "keyPaths" and "keyData" is present
 		func(v mSI) { v["keyPath"] = "/foo/bar" },
+		func(v mSI) { v["keyPaths"] = []string{"/path/1"} },
+		func(v mSI) { delete(v, "keyData"); v["keyPath"] = "/foo/bar"; v["keyPaths"] = []string{"/path/1"} },
 		// Invalid "keyPath" field
 		func(v mSI) { delete(v, "keyData"); v["keyPath"] = 1 },
 		func(v mSI) { v["type"] = "this is invalid" },
+		// Invalid "keyPaths" field
+		func(v mSI) { delete(v, "keyData"); v["keyPaths"] = 1 },
+		func(v mSI) { delete(v, "keyData"); v["keyPaths"] = []int{1} },
+		func(v mSI) { delete(v, "keyData"); v["keyPaths"] = []string{} },
+		func(v mSI) { delete(v, "keyData"); v["keyPaths"] = nil },
+		func(v mSI) { delete(v, "keyData"); v["keyPaths"] = []string{""} },
 		// Invalid "keyData" field
 		func(v mSI) { v["keyData"] = 1 },
 		func(v mSI) { v["keyData"] = "this is invalid base64" },
@@ -768,6 +1103,29 @@ func TestPRSignedByUnmarshalJSON(t *testing.T) {
 		func(v mSI) { v["signedIdentity"] = "this is invalid" },
 		// "signedIdentity" an explicit nil
 		func(v mSI) { v["signedIdentity"] = nil },
+		// Invalid "keyFingerprints" field
+		func(v mSI) { v["keyFingerprints"] = 1 },
+		func(v mSI) { v["keyFingerprints"] = []string{} },
+		func(v mSI) { v["keyFingerprints"] = nil },
+		func(v mSI) { v["keyFingerprints"] = []string{""} },
+		func(v mSI) { v["keyFingerprints"] = []string{"this is not a fingerprint"} },
+		// Short key IDs, and other lengths, are not accepted
+		func(v mSI) { v["keyFingerprints"] = []string{"abcdef0123"} },
+		func(v mSI) { v["keyFingerprints"] = []string{"8BB46CC8"} },
+		func(v mSI) { v["keyFingerprints"] = []string{"DB72F2188BB46CC8"} },
+		func(v mSI) { v["keyFingerprints"] = []string{"1D8230F6CDB6A06716E414C1DB72F2188BB46CC"} },
+		func(v mSI) { v["keyFingerprints"] = []string{"1D8230F6CDB6A06716E414C1DB72F2188BB46CC8A"} },
+		func(v mSI) { v["keyFingerprints"] = []string{"1D8230F6CDB6A06716E414C1DB72F2188BB46CCX"} },
+		func(v mSI) { v["keyType"] = string(SBKeyTypeSignedByX509CAs); v["keyFingerprints"] = []string{"ABCD"} },
+		// Invalid "maxSignatureAgeSeconds" field
+		func(v mSI) { v["maxSignatureAgeSeconds"] = "3600" },
+		func(v mSI) { v["maxSignatureAgeSeconds"] = 0.5 },
+		func(v mSI) { v["maxSignatureAgeSeconds"] = -1 },
+		// Invalid "rejectExpiredSignatures" field
+		func(v mSI) { v["rejectExpiredSignatures"] = "true" },
+		// Signature times are only supported with GPGKeys
+		func(v mSI) { v["keyType"] = string(SBKeyTypeSignedByX509CAs); v["maxSignatureAgeSeconds"] = 3600 },
+		func(v mSI) { v["keyType"] = string(SBKeyTypeSignedByX509CAs); v["rejectExpiredSignatures"] = true },
 	}
 	for _, fn := range breakFns {
 		err = tryUnmarshalModifiedSignedBy(t, &pr, validJSON, fn)
@@ -795,6 +1153,15 @@ func TestPRSignedByUnmarshalJSON(t *testing.T) {
 	pr = prSignedBy{}
 	err = json.Unmarshal(testJSON, &pr)
 	assert.Error(t, err)
+	// Similarly "keyPaths"
+	pathsPR, err := NewPRSignedByKeyPaths(SBKeyTypeGPGKeys, []string{"/path/1"}, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	testJSON, err = json.Marshal(pathsPR)
+	require.NoError(t, err)
+	testJSON = addExtraJSONMember(t, testJSON, "keyPaths", []string{"/path/2"})
+	pr = prSignedBy{}
+	err = json.Unmarshal(testJSON, &pr)
+	assert.Error(t, err)
 
 	// Various allowed modifications to the requirement
 	allowedModificationFns := []func(mSI){
@@ -818,6 +1185,32 @@ func TestPRSignedByUnmarshalJSON(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, NewPRMMatchRepoDigestOrExact(), pr.SignedIdentity)
 	}
+
+	// Key fingerprints and signature time options
+	err = tryUnmarshalModifiedSignedBy(t, &pr, validJSON, func(v mSI) {
+		v["keyFingerprints"] = []string{"1D8230F6CDB6A06716E414C1DB72F2188BB46CC8", "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"}
+		v["maxSignatureAgeSeconds"] = 3600
+		v["rejectExpiredSignatures"] = true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1D8230F6CDB6A06716E414C1DB72F2188BB46CC8", "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"}, pr.KeyFingerprints)
+	assert.Equal(t, int64(3600), pr.MaxSignatureAgeSeconds)
+	assert.True(t, pr.RejectExpiredSignatures)
+	testJSON, err = json.Marshal(&pr)
+	require.NoError(t, err)
+	var roundTrip prSignedBy
+	err = json.Unmarshal(testJSON, &roundTrip)
+	require.NoError(t, err)
+	assert.Equal(t, pr, roundTrip)
+	for _, field := range []string{"keyFingerprints", "maxSignatureAgeSeconds", "rejectExpiredSignatures"} {
+		var tmp mSI
+		err := json.Unmarshal(testJSON, &tmp)
+		require.NoError(t, err)
+
+		pr = prSignedBy{}
+		err = json.Unmarshal(addExtraJSONMember(t, testJSON, field, tmp[field]), &pr)
+		assert.Error(t, err)
+	}
 }
 
 func TestSBKeyTypeIsValid(t *testing.T) {
@@ -960,67 +1353,833 @@ func TestPRSignedBaseLayerUnmarshalJSON(t *testing.T) {
 	}
 }
 
-func TestNewPolicyReferenceMatchFromJSON(t *testing.T) {
-	// Sample success. Others tested in the individual PolicyReferenceMatch.UnmarshalJSON implementations.
-	validPRM := NewPRMMatchRepoDigestOrExact()
-	validJSON, err := json.Marshal(validPRM)
+func TestNewPRSigstoreSigned(t *testing.T) {
+	const testPath = "/foo/bar"
+	testData := []byte("abc")
+	const testURI = "awskms:///arn:aws:kms:us-east-1:123456789012:key/abc"
+	testIdentity := NewPRMMatchRepoDigestOrExact()
+
+	const testRekorPath = "/rekor/key"
+	testFulcio := &prSigstoreSignedFulcio{
+		CAPath:       "/fulcio/ca",
+		OIDCIssuer:   "https://issuer.example.com",
+		SubjectEmail: "user@example.com",
+	}
+
+	// Success
+	pr, err := newPRSigstoreSigned(testPath, nil, "", nil, "", testIdentity)
 	require.NoError(t, err)
-	prm, err := newPolicyReferenceMatchFromJSON(validJSON)
+	assert.Equal(t, &prSigstoreSigned{
+		prCommon:       prCommon{prTypeSigstoreSigned},
+		KeyPath:        testPath,
+		KeyData:        nil,
+		SignedIdentity: testIdentity,
+	}, pr)
+	pr, err = newPRSigstoreSigned("", testData, "", nil, "", testIdentity)
 	require.NoError(t, err)
-	assert.Equal(t, validPRM, prm)
+	assert.Equal(t, &prSigstoreSigned{
+		prCommon:       prCommon{prTypeSigstoreSigned},
+		KeyPath:        "",
+		KeyData:        testData,
+		SignedIdentity: testIdentity,
+	}, pr)
+	pr, err = newPRSigstoreSigned("", nil, testURI, nil, "", testIdentity)
+	require.NoError(t, err)
+	assert.Equal(t, &prSigstoreSigned{
+		prCommon:       prCommon{prTypeSigstoreSigned},
+		KeyURI:         testURI,
+		SignedIdentity: testIdentity,
+	}, pr)
+	pr, err = newPRSigstoreSigned("", nil, "", testFulcio, testRekorPath, testIdentity)
+	require.NoError(t, err)
+	assert.Equal(t, &prSigstoreSigned{
+		prCommon:           prCommon{prTypeSigstoreSigned},
+		Fulcio:             testFulcio,
+		RekorPublicKeyPath: testRekorPath,
+		SignedIdentity:     testIdentity,
+	}, pr)
+	pr, err = newPRSigstoreSigned(testPath, nil, "", nil, testRekorPath, testIdentity)
+	require.NoError(t, err)
+	assert.Equal(t, &prSigstoreSigned{
+		prCommon:           prCommon{prTypeSigstoreSigned},
+		KeyPath:            testPath,
+		RekorPublicKeyPath: testRekorPath,
+		SignedIdentity:     testIdentity,
+	}, pr)
 
-	// Invalid
-	for _, invalid := range []interface{}{
-		// Not an object
-		1,
-		// Missing type
-		prmCommon{},
-		// Invalid type
-		prmCommon{Type: "this is invalid"},
-		// Valid type but invalid contents
-		prmExactReference{
-			prmCommon:       prmCommon{Type: prmTypeExactReference},
-			DockerReference: "",
-		},
+	// More than one of keyPath, keyData, keyURI and fulcio specified
+	for _, c := range []struct {
+		keyPath string
+		keyData []byte
+		keyURI  string
+		fulcio  *prSigstoreSignedFulcio
+	}{
+		{testPath, testData, "", nil},
+		{testPath, nil, "", testFulcio},
+		{"", testData, "", testFulcio},
+		{testPath, testData, "", testFulcio},
+		{testPath, nil, testURI, nil},
+		{"", testData, testURI, nil},
+		{"", nil, testURI, testFulcio},
 	} {
-		testJSON, err := json.Marshal(invalid)
-		require.NoError(t, err)
+		_, err = newPRSigstoreSigned(c.keyPath, c.keyData, c.keyURI, c.fulcio, testRekorPath, testIdentity)
+		assert.Error(t, err)
+	}
 
-		_, err = newPolicyReferenceMatchFromJSON(testJSON)
-		assert.Error(t, err, string(testJSON))
+	// Invalid keyURI
+	for _, uri := range []string{"no-scheme", "%invalid://"} {
+		_, err = newPRSigstoreSigned("", nil, uri, nil, "", testIdentity)
+		assert.Error(t, err, uri)
 	}
+
+	// fulcio without rekorPublicKeyPath
+	_, err = newPRSigstoreSigned("", nil, "", testFulcio, "", testIdentity)
+	assert.Error(t, err)
+
+	// Invalid signedIdentity
+	_, err = newPRSigstoreSigned(testPath, nil, "", nil, "", nil)
+	assert.Error(t, err)
 }
 
-func TestNewPRMMatchExact(t *testing.T) {
-	_prm := NewPRMMatchExact()
-	prm, ok := _prm.(*prmMatchExact)
+func TestNewPRSigstoreSignedKeyPath(t *testing.T) {
+	const testPath = "/foo/bar"
+	_pr, err := NewPRSigstoreSignedKeyPath(testPath, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	pr, ok := _pr.(*prSigstoreSigned)
 	require.True(t, ok)
-	assert.Equal(t, &prmMatchExact{prmCommon{prmTypeMatchExact}}, prm)
+	assert.Equal(t, testPath, pr.KeyPath)
+	// Failure cases tested in TestNewPRSigstoreSigned.
 }
 
-func TestPRMMatchExactUnmarshalJSON(t *testing.T) {
-	var prm prmMatchExact
+func TestNewPRSigstoreSignedKeyData(t *testing.T) {
+	testData := []byte("abc")
+	_pr, err := NewPRSigstoreSignedKeyData(testData, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	pr, ok := _pr.(*prSigstoreSigned)
+	require.True(t, ok)
+	assert.Equal(t, testData, pr.KeyData)
+	// Failure cases tested in TestNewPRSigstoreSigned.
+}
 
-	testInvalidJSONInput(t, &prm)
+func TestNewPRSigstoreSignedKeyURI(t *testing.T) {
+	const testURI = "pkcs11:token=release;object=signing-key"
+	_pr, err := NewPRSigstoreSignedKeyURI(testURI, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	pr, ok := _pr.(*prSigstoreSigned)
+	require.True(t, ok)
+	assert.Equal(t, testURI, pr.KeyURI)
+	// Failure cases tested in TestNewPRSigstoreSigned.
+}
 
-	// Start with a valid JSON.
-	validPR := NewPRMMatchExact()
-	validJSON, err := json.Marshal(validPR)
+func TestNewPRSigstoreSignedFulcioCAPath(t *testing.T) {
+	_pr, err := NewPRSigstoreSignedFulcioCAPath("/fulcio/ca", "https://issuer.example.com", "user@example.com", "/rekor/key", NewPRMMatchRepoDigestOrExact())
 	require.NoError(t, err)
+	pr, ok := _pr.(*prSigstoreSigned)
+	require.True(t, ok)
+	assert.Equal(t, &prSigstoreSignedFulcio{
+		CAPath:       "/fulcio/ca",
+		OIDCIssuer:   "https://issuer.example.com",
+		SubjectEmail: "user@example.com",
+	}, pr.Fulcio)
+	assert.Equal(t, "/rekor/key", pr.RekorPublicKeyPath)
+
+	// Invalid Fulcio parameters
+	_, err = NewPRSigstoreSignedFulcioCAPath("", "https://issuer.example.com", "user@example.com", "/rekor/key", NewPRMMatchRepoDigestOrExact())
+	assert.Error(t, err)
+	// Other failure cases tested in TestNewPRSigstoreSigned and TestNewPRSigstoreSignedFulcio.
+}
 
-	// Success
-	prm = prmMatchExact{}
-	err = json.Unmarshal(validJSON, &prm)
+func TestNewPRSigstoreSignedFulcioCAData(t *testing.T) {
+	testData := []byte("abc")
+	_pr, err := NewPRSigstoreSignedFulcioCAData(testData, "https://issuer.example.com", "user@example.com", "/rekor/key", NewPRMMatchRepoDigestOrExact())
 	require.NoError(t, err)
-	assert.Equal(t, validPR, &prm)
+	pr, ok := _pr.(*prSigstoreSigned)
+	require.True(t, ok)
+	assert.Equal(t, &prSigstoreSignedFulcio{
+		CAData:       testData,
+		OIDCIssuer:   "https://issuer.example.com",
+		SubjectEmail: "user@example.com",
+	}, pr.Fulcio)
+	assert.Equal(t, "/rekor/key", pr.RekorPublicKeyPath)
+
+	// Invalid Fulcio parameters
+	_, err = NewPRSigstoreSignedFulcioCAData(testData, "", "user@example.com", "/rekor/key", NewPRMMatchRepoDigestOrExact())
+	assert.Error(t, err)
+	// Other failure cases tested in TestNewPRSigstoreSigned and TestNewPRSigstoreSignedFulcio.
+}
 
-	// newPolicyReferenceMatchFromJSON recognizes this type
-	_pr, err := newPolicyReferenceMatchFromJSON(validJSON)
+func TestNewPRSigstoreSignedFulcio(t *testing.T) {
+	const testPath = "/fulcio/ca"
+	testData := []byte("abc")
+	const testIssuer = "https://issuer.example.com"
+	const testEmail = "user@example.com"
+
+	// Success
+	f, err := newPRSigstoreSignedFulcio(testPath, nil, testIssuer, testEmail)
+	require.NoError(t, err)
+	assert.Equal(t, &prSigstoreSignedFulcio{
+		CAPath:       testPath,
+		OIDCIssuer:   testIssuer,
+		SubjectEmail: testEmail,
+	}, f)
+	f, err = newPRSigstoreSignedFulcio("", testData, testIssuer, testEmail)
+	require.NoError(t, err)
+	assert.Equal(t, &prSigstoreSignedFulcio{
+		CAData:       testData,
+		OIDCIssuer:   testIssuer,
+		SubjectEmail: testEmail,
+	}, f)
+
+	// Both caPath and caData specified
+	_, err = newPRSigstoreSignedFulcio(testPath, testData, testIssuer, testEmail)
+	assert.Error(t, err)
+	// Neither caPath nor caData specified
+	_, err = newPRSigstoreSignedFulcio("", nil, testIssuer, testEmail)
+	assert.Error(t, err)
+	// Missing oidcIssuer
+	_, err = newPRSigstoreSignedFulcio(testPath, nil, "", testEmail)
+	assert.Error(t, err)
+	// Missing subjectEmail
+	_, err = newPRSigstoreSignedFulcio(testPath, nil, testIssuer, "")
+	assert.Error(t, err)
+}
+
+// Return the result of modifying validJSON with fn and unmarshaling it into *pr
+func tryUnmarshalModifiedSigstoreSigned(t *testing.T, pr *prSigstoreSigned, validJSON []byte, modifyFn func(mSI)) error {
+	var tmp mSI
+	err := json.Unmarshal(validJSON, &tmp)
 	require.NoError(t, err)
-	assert.Equal(t, validPR, _pr)
 
-	for _, invalid := range []mSI{
-		// Missing "type" field
+	modifyFn(tmp)
+
+	testJSON, err := json.Marshal(tmp)
+	require.NoError(t, err)
+
+	*pr = prSigstoreSigned{}
+	return json.Unmarshal(testJSON, &pr)
+}
+
+func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
+	var pr prSigstoreSigned
+
+	testInvalidJSONInput(t, &pr)
+
+	// Start with a valid JSON.
+	validPR, err := NewPRSigstoreSignedKeyData([]byte("abc"), NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	validJSON, err := json.Marshal(validPR)
+	require.NoError(t, err)
+
+	// Success with KeyData
+	pr = prSigstoreSigned{}
+	err = json.Unmarshal(validJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &pr)
+
+	// Success with KeyPath
+	kpPR, err := NewPRSigstoreSignedKeyPath("/foo/bar", NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	testJSON, err := json.Marshal(kpPR)
+	require.NoError(t, err)
+	pr = prSigstoreSigned{}
+	err = json.Unmarshal(testJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, kpPR, &pr)
+
+	// Success with KeyURI
+	kuPR, err := NewPRSigstoreSignedKeyURI("gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k", NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	testJSON, err = json.Marshal(kuPR)
+	require.NoError(t, err)
+	pr = prSigstoreSigned{}
+	err = json.Unmarshal(testJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, kuPR, &pr)
+
+	// newPolicyRequirementFromJSON recognizes this type
+	_pr, err := newPolicyRequirementFromJSON(validJSON)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, _pr)
+
+	// Various ways to corrupt the JSON
+	breakFns := []func(mSI){
+		// The "type" field is missing
+		func(v mSI) { delete(v, "type") },
+		// Wrong "type" field
+		func(v mSI) { v["type"] = 1 },
+		func(v mSI) { v["type"] = "this is invalid" },
+		func(v mSI) { v["type"] = string(prTypeSignedBy) },
+		// Extra top-level sub-object
+		func(v mSI) { v["unexpected"] = 1 },
+		// "keyType" is not accepted
+		func(v mSI) { v["keyType"] = string(SBKeyTypeGPGKeys) },
+		// Both "keyPath" and "keyData" is missing
+		func(v mSI) { delete(v, "keyData") },
+		// Both "keyPath" and "keyData" is present
+		func(v mSI) { v["keyPath"] = "/foo/bar" },
+		// Invalid "keyPath" field
+		func(v mSI) { delete(v, "keyData"); v["keyPath"] = 1 },
+		// Invalid "keyData" field
+		func(v mSI) { v["keyData"] = 1 },
+		func(v mSI) { v["keyData"] = "this is invalid base64" },
+		// Both "keyURI" and "keyData" is present
+		func(v mSI) { v["keyURI"] = "hashivault://key" },
+		// Invalid "keyURI" field
+		func(v mSI) { delete(v, "keyData"); v["keyURI"] = 1 },
+		func(v mSI) { delete(v, "keyData"); v["keyURI"] = "no-scheme" },
+		// Invalid "signedIdentity" field
+		func(v mSI) { v["signedIdentity"] = "this is invalid" },
+		// "signedIdentity" an explicit nil
+		func(v mSI) { v["signedIdentity"] = nil },
+	}
+	for _, fn := range breakFns {
+		err = tryUnmarshalModifiedSigstoreSigned(t, &pr, validJSON, fn)
+		assert.Error(t, err)
+	}
+
+	// Duplicated fields
+	for _, field := range []string{"type", "keyData", "signedIdentity"} {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		testJSON := addExtraJSONMember(t, validJSON, field, tmp[field])
+
+		pr = prSigstoreSigned{}
+		err = json.Unmarshal(testJSON, &pr)
+		assert.Error(t, err)
+	}
+	// Handle "keyPath", which is not in validJSON, specially
+	testJSON, err = json.Marshal(kpPR)
+	require.NoError(t, err)
+	testJSON = addExtraJSONMember(t, testJSON, "keyPath", "/foo/bar")
+	pr = prSigstoreSigned{}
+	err = json.Unmarshal(testJSON, &pr)
+	assert.Error(t, err)
+
+	// A missing "signedIdentity" defaults to matchRepoDigestOrExact
+	err = tryUnmarshalModifiedSigstoreSigned(t, &pr, validJSON, func(v mSI) { delete(v, "signedIdentity") })
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &pr)
+
+	// Other identity matching types are accepted
+	err = tryUnmarshalModifiedSigstoreSigned(t, &pr, validJSON, func(v mSI) {
+		v["signedIdentity"] = map[string]interface{}{"type": "matchRepository"}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, NewPRMMatchRepository(), pr.SignedIdentity)
+
+	// Success with a Rekor public key
+	err = tryUnmarshalModifiedSigstoreSigned(t, &pr, validJSON, func(v mSI) { v["rekorPublicKeyPath"] = "/rekor/key" })
+	require.NoError(t, err)
+	assert.Equal(t, "/rekor/key", pr.RekorPublicKeyPath)
+	assert.Equal(t, []byte("abc"), pr.KeyData)
+
+	// Success with Fulcio
+	fulcioPR, err := NewPRSigstoreSignedFulcioCAData([]byte("abc"), "https://issuer.example.com", "user@example.com", "/rekor/key", NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	fulcioJSON, err := json.Marshal(fulcioPR)
+	require.NoError(t, err)
+	pr = prSigstoreSigned{}
+	err = json.Unmarshal(fulcioJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, fulcioPR, &pr)
+
+	// Various ways to corrupt the JSON with Fulcio
+	for _, fn := range []func(mSI){
+		// "fulcio" combined with "keyPath", "keyData" or "keyURI"
+		func(v mSI) { v["keyPath"] = "/foo/bar" },
+		func(v mSI) { v["keyData"] = "" },
+		func(v mSI) { v["keyURI"] = "hashivault://key" },
+		// Invalid "fulcio" field
+		func(v mSI) { v["fulcio"] = 1 },
+		func(v mSI) { v["fulcio"] = nil },
+		// Extra field in "fulcio"
+		func(v mSI) { x(v, "fulcio")["unexpected"] = 1 },
+		// Both "caPath" and "caData" are missing, or present
+		func(v mSI) { delete(x(v, "fulcio"), "caData") },
+		func(v mSI) { x(v, "fulcio")["caPath"] = "/foo/bar" },
+		// Invalid "caPath" and "caData" fields
+		func(v mSI) { delete(x(v, "fulcio"), "caData"); x(v, "fulcio")["caPath"] = 1 },
+		func(v mSI) { x(v, "fulcio")["caData"] = 1 },
+		func(v mSI) { x(v, "fulcio")["caData"] = "this is invalid base64" },
+		// Missing or invalid "rekorPublicKeyPath"
+		func(v mSI) { delete(v, "rekorPublicKeyPath") },
+		func(v mSI) { v["rekorPublicKeyPath"] = 1 },
+		// Missing or invalid "oidcIssuer" and "subjectEmail"
+		func(v mSI) { delete(x(v, "fulcio"), "oidcIssuer") },
+		func(v mSI) { x(v, "fulcio")["oidcIssuer"] = 1 },
+		func(v mSI) { x(v, "fulcio")["oidcIssuer"] = "" },
+		func(v mSI) { delete(x(v, "fulcio"), "subjectEmail") },
+		func(v mSI) { x(v, "fulcio")["subjectEmail"] = 1 },
+		func(v mSI) { x(v, "fulcio")["subjectEmail"] = "" },
+	} {
+		err = tryUnmarshalModifiedSigstoreSigned(t, &pr, fulcioJSON, fn)
+		assert.Error(t, err)
+	}
+
+	// Duplicated fields in "fulcio"
+	for _, field := range []string{"caData", "oidcIssuer", "subjectEmail"} {
+		var tmp mSI
+		err := json.Unmarshal(fulcioJSON, &tmp)
+		require.NoError(t, err)
+		fulcioObjectJSON, err := json.Marshal(tmp["fulcio"])
+		require.NoError(t, err)
+		var fulcioObject mSI
+		err = json.Unmarshal(fulcioObjectJSON, &fulcioObject)
+		require.NoError(t, err)
+
+		var f prSigstoreSignedFulcio
+		err = json.Unmarshal(addExtraJSONMember(t, fulcioObjectJSON, field, fulcioObject[field]), &f)
+		assert.Error(t, err)
+	}
+}
+
+func TestNewPRSignedByThreshold(t *testing.T) {
+	const testThreshold = 2
+	testKeyPaths := []string{"/foo/bar", "/foo/baz"}
+	testIdentity := NewPRMMatchRepoDigestOrExact()
+
+	// Success
+	_pr, err := NewPRSignedByThreshold(testThreshold, testKeyPaths, testIdentity)
+	require.NoError(t, err)
+	pr, ok := _pr.(*prSignedByThreshold)
+	require.True(t, ok)
+	assert.Equal(t, &prSignedByThreshold{
+		prCommon:       prCommon{prTypeSignedByThreshold},
+		Threshold:      testThreshold,
+		KeyPaths:       testKeyPaths,
+		SignedIdentity: testIdentity,
+	}, pr)
+
+	// Invalid threshold
+	for _, threshold := range []int{0, -1} {
+		_, err = NewPRSignedByThreshold(threshold, testKeyPaths, testIdentity)
+		assert.Error(t, err)
+	}
+	// Invalid keyPaths
+	for _, keyPaths := range [][]string{nil, {}, {"/foo/bar", ""}} {
+		_, err = NewPRSignedByThreshold(testThreshold, keyPaths, testIdentity)
+		assert.Error(t, err)
+	}
+	// Invalid signedIdentity
+	_, err = NewPRSignedByThreshold(testThreshold, testKeyPaths, nil)
+	assert.Error(t, err)
+}
+
+func TestPRSignedByThresholdUnmarshalJSON(t *testing.T) {
+	var pr prSignedByThreshold
+
+	testInvalidJSONInput(t, &pr)
+
+	// Start with a valid JSON.
+	validPR, err := NewPRSignedByThreshold(2, []string{"/foo/bar", "/foo/baz"}, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	validJSON, err := json.Marshal(validPR)
+	require.NoError(t, err)
+
+	// Success
+	pr = prSignedByThreshold{}
+	err = json.Unmarshal(validJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &pr)
+
+	// newPolicyRequirementFromJSON recognizes this type
+	_pr, err := newPolicyRequirementFromJSON(validJSON)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, _pr)
+
+	// Various ways to corrupt the JSON
+	breakFns := []func(mSI){
+		// The "type" field is missing
+		func(v mSI) { delete(v, "type") },
+		// Wrong "type" field
+		func(v mSI) { v["type"] = 1 },
+		func(v mSI) { v["type"] = "this is invalid" },
+		func(v mSI) { v["type"] = string(prTypeSignedBy) },
+		// Extra top-level sub-object
+		func(v mSI) { v["unexpected"] = 1 },
+		// "keyType" is not accepted
+		func(v mSI) { v["keyType"] = string(SBKeyTypeGPGKeys) },
+		// The "threshold" field is missing
+		func(v mSI) { delete(v, "threshold") },
+		// Invalid "threshold" field
+		func(v mSI) { v["threshold"] = "2" },
+		func(v mSI) { v["threshold"] = 1.5 },
+		func(v mSI) { v["threshold"] = 0 },
+		func(v mSI) { v["threshold"] = -1 },
+		// The "keyPaths" field is missing
+		func(v mSI) { delete(v, "keyPaths") },
+		// Invalid "keyPaths" field
+		func(v mSI) { v["keyPaths"] = 1 },
+		func(v mSI) { v["keyPaths"] = "/foo/bar" },
+		func(v mSI) { v["keyPaths"] = []string{} },
+		func(v mSI) { v["keyPaths"] = []string{"/foo/bar", ""} },
+		// Invalid "signedIdentity" field
+		func(v mSI) { v["signedIdentity"] = "this is invalid" },
+		// "signedIdentity" an explicit nil
+		func(v mSI) { v["signedIdentity"] = nil },
+	}
+	for _, fn := range breakFns {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		fn(tmp)
+
+		testJSON, err := json.Marshal(tmp)
+		require.NoError(t, err)
+
+		pr = prSignedByThreshold{}
+		err = json.Unmarshal(testJSON, &pr)
+		assert.Error(t, err)
+	}
+
+	// Duplicated fields
+	for _, field := range []string{"type", "threshold", "keyPaths", "signedIdentity"} {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		testJSON := addExtraJSONMember(t, validJSON, field, tmp[field])
+
+		pr = prSignedByThreshold{}
+		err = json.Unmarshal(testJSON, &pr)
+		assert.Error(t, err)
+	}
+
+	// A missing "signedIdentity" defaults to matchRepoDigestOrExact
+	var tmp mSI
+	err = json.Unmarshal(validJSON, &tmp)
+	require.NoError(t, err)
+	delete(tmp, "signedIdentity")
+	testJSON, err := json.Marshal(tmp)
+	require.NoError(t, err)
+	pr = prSignedByThreshold{}
+	err = json.Unmarshal(testJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &pr)
+}
+
+func TestNewPRNotationSigned(t *testing.T) {
+	const testPath = "/foo/bar"
+	testData := []byte("abc")
+	testIdentities := []string{"x509.subject: C=US, O=Example", "x509.subject: CN=Signer"}
+
+	// Success
+	pr, err := newPRNotationSigned(testPath, nil, testIdentities)
+	require.NoError(t, err)
+	assert.Equal(t, &prNotationSigned{
+		prCommon:          prCommon{prTypeNotationSigned},
+		TrustStorePath:    testPath,
+		TrustedIdentities: testIdentities,
+	}, pr)
+	pr, err = newPRNotationSigned("", testData, []string{"*"})
+	require.NoError(t, err)
+	assert.Equal(t, &prNotationSigned{
+		prCommon:          prCommon{prTypeNotationSigned},
+		TrustStoreData:    testData,
+		TrustedIdentities: []string{"*"},
+	}, pr)
+
+	// Both or neither of trustStorePath and trustStoreData
+	_, err = newPRNotationSigned(testPath, testData, testIdentities)
+	assert.IsType(t, InvalidPolicyFormatError(""), err)
+	_, err = newPRNotationSigned("", nil, testIdentities)
+	assert.IsType(t, InvalidPolicyFormatError(""), err)
+	// Invalid trustedIdentities
+	for _, identities := range [][]string{
+		nil,
+		{},
+		{"*", "x509.subject: CN=Signer"},
+		{"CN=Signer"},
+		{"x509.subject: "},
+		{"x509.subject: CN"},
+		{"x509.subject: CN="},
+		{"x509.subject: UNKNOWN=value"},
+		{"x509.subject: CN=Signer\\"},
+	} {
+		_, err = newPRNotationSigned(testPath, nil, identities)
+		assert.IsType(t, InvalidPolicyFormatError(""), err)
+	}
+}
+
+func TestNewPRNotationSignedTrustStorePath(t *testing.T) {
+	const testPath = "/foo/bar"
+	_pr, err := NewPRNotationSignedTrustStorePath(testPath, []string{"*"})
+	require.NoError(t, err)
+	pr, ok := _pr.(*prNotationSigned)
+	require.True(t, ok)
+	assert.Equal(t, testPath, pr.TrustStorePath)
+	// Failure cases tested in TestNewPRNotationSigned.
+}
+
+func TestNewPRNotationSignedTrustStoreData(t *testing.T) {
+	testData := []byte("abc")
+	_pr, err := NewPRNotationSignedTrustStoreData(testData, []string{"*"})
+	require.NoError(t, err)
+	pr, ok := _pr.(*prNotationSigned)
+	require.True(t, ok)
+	assert.Equal(t, testData, pr.TrustStoreData)
+	// Failure cases tested in TestNewPRNotationSigned.
+}
+
+func TestPRNotationSignedUnmarshalJSON(t *testing.T) {
+	var pr prNotationSigned
+
+	testInvalidJSONInput(t, &pr)
+
+	// Start with a valid JSON.
+	validPR, err := NewPRNotationSignedTrustStoreData([]byte("abc"), []string{"x509.subject: C=US, O=Example"})
+	require.NoError(t, err)
+	validJSON, err := json.Marshal(validPR)
+	require.NoError(t, err)
+
+	// Success
+	pr = prNotationSigned{}
+	err = json.Unmarshal(validJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &pr)
+
+	// newPolicyRequirementFromJSON recognizes this type
+	_pr, err := newPolicyRequirementFromJSON(validJSON)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, _pr)
+
+	// Various ways to corrupt the JSON
+	breakFns := []func(mSI){
+		// The "type" field is missing
+		func(v mSI) { delete(v, "type") },
+		// Wrong "type" field
+		func(v mSI) { v["type"] = 1 },
+		func(v mSI) { v["type"] = "this is invalid" },
+		func(v mSI) { v["type"] = string(prTypeSigstoreSigned) },
+		// Extra top-level sub-object
+		func(v mSI) { v["unexpected"] = 1 },
+		// Both "trustStorePath" and "trustStoreData" are present
+		func(v mSI) { v["trustStorePath"] = "/foo/bar" },
+		// Neither "trustStorePath" nor "trustStoreData" are present
+		func(v mSI) { delete(v, "trustStoreData") },
+		// Invalid "trustStorePath" field
+		func(v mSI) { delete(v, "trustStoreData"); v["trustStorePath"] = 1 },
+		// Invalid "trustStoreData" field
+		func(v mSI) { v["trustStoreData"] = 1 },
+		func(v mSI) { v["trustStoreData"] = "this is invalid base64" },
+		// The "trustedIdentities" field is missing
+		func(v mSI) { delete(v, "trustedIdentities") },
+		// Invalid "trustedIdentities" field
+		func(v mSI) { v["trustedIdentities"] = 1 },
+		func(v mSI) { v["trustedIdentities"] = "*" },
+		func(v mSI) { v["trustedIdentities"] = []string{} },
+		func(v mSI) { v["trustedIdentities"] = []string{"CN=Signer"} },
+	}
+	for _, fn := range breakFns {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		fn(tmp)
+
+		testJSON, err := json.Marshal(tmp)
+		require.NoError(t, err)
+
+		pr = prNotationSigned{}
+		err = json.Unmarshal(testJSON, &pr)
+		assert.Error(t, err)
+	}
+
+	// Duplicated fields
+	for _, field := range []string{"type", "trustStoreData", "trustedIdentities"} {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		testJSON := addExtraJSONMember(t, validJSON, field, tmp[field])
+
+		pr = prNotationSigned{}
+		err = json.Unmarshal(testJSON, &pr)
+		assert.Error(t, err)
+	}
+
+	// A trustStorePath is accepted as well
+	validPR, err = NewPRNotationSignedTrustStorePath("/foo/bar", []string{"*"})
+	require.NoError(t, err)
+	validJSON, err = json.Marshal(validPR)
+	require.NoError(t, err)
+	pr = prNotationSigned{}
+	err = json.Unmarshal(validJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &pr)
+}
+
+func TestNewPRNotarySigned(t *testing.T) {
+	const testTrustDir = "/var/lib/notary"
+
+	// Success
+	for _, server := range []string{"", "https://notary.example.com", "http://localhost:4443/"} {
+		_pr, err := NewPRNotarySigned(server, testTrustDir)
+		require.NoError(t, err, server)
+		pr, ok := _pr.(*prNotarySigned)
+		require.True(t, ok, server)
+		assert.Equal(t, &prNotarySigned{
+			prCommon: prCommon{prTypeNotarySigned},
+			Server:   server,
+			TrustDir: testTrustDir,
+		}, pr, server)
+	}
+
+	// Invalid server
+	for _, server := range []string{"notary.example.com", "ftp://notary.example.com", "https://", ":"} {
+		_, err := newPRNotarySigned(server, testTrustDir)
+		assert.IsType(t, InvalidPolicyFormatError(""), err, server)
+	}
+	// Missing trustDir
+	_, err := newPRNotarySigned("https://notary.example.com", "")
+	assert.IsType(t, InvalidPolicyFormatError(""), err)
+}
+
+func TestPRNotarySignedUnmarshalJSON(t *testing.T) {
+	var pr prNotarySigned
+
+	testInvalidJSONInput(t, &pr)
+
+	// Start with a valid JSON.
+	validPR, err := NewPRNotarySigned("https://notary.example.com", "/var/lib/notary")
+	require.NoError(t, err)
+	validJSON, err := json.Marshal(validPR)
+	require.NoError(t, err)
+
+	// Success
+	pr = prNotarySigned{}
+	err = json.Unmarshal(validJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &pr)
+
+	// newPolicyRequirementFromJSON recognizes this type
+	_pr, err := newPolicyRequirementFromJSON(validJSON)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, _pr)
+
+	// Various ways to corrupt the JSON
+	breakFns := []func(mSI){
+		// The "type" field is missing
+		func(v mSI) { delete(v, "type") },
+		// Wrong "type" field
+		func(v mSI) { v["type"] = 1 },
+		func(v mSI) { v["type"] = "this is invalid" },
+		func(v mSI) { v["type"] = string(prTypeNotationSigned) },
+		// Extra top-level sub-object
+		func(v mSI) { v["unexpected"] = 1 },
+		// Invalid "server" field
+		func(v mSI) { v["server"] = 1 },
+		func(v mSI) { v["server"] = "notary.example.com" },
+		// The "trustDir" field is missing
+		func(v mSI) { delete(v, "trustDir") },
+		// Invalid "trustDir" field
+		func(v mSI) { v["trustDir"] = 1 },
+		func(v mSI) { v["trustDir"] = "" },
+	}
+	for _, fn := range breakFns {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		fn(tmp)
+
+		testJSON, err := json.Marshal(tmp)
+		require.NoError(t, err)
+
+		pr = prNotarySigned{}
+		err = json.Unmarshal(testJSON, &pr)
+		assert.Error(t, err)
+	}
+
+	// Duplicated fields
+	for _, field := range []string{"type", "server", "trustDir"} {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		testJSON := addExtraJSONMember(t, validJSON, field, tmp[field])
+
+		pr = prNotarySigned{}
+		err = json.Unmarshal(testJSON, &pr)
+		assert.Error(t, err)
+	}
+
+	// "server" is optional
+	validPR, err = NewPRNotarySigned("", "/var/lib/notary")
+	require.NoError(t, err)
+	validJSON, err = json.Marshal(validPR)
+	require.NoError(t, err)
+	assert.NotContains(t, string(validJSON), "server")
+	pr = prNotarySigned{}
+	err = json.Unmarshal(validJSON, &pr)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &pr)
+}
+
+func TestNewPolicyReferenceMatchFromJSON(t *testing.T) {
+	// Sample success. Others tested in the individual PolicyReferenceMatch.UnmarshalJSON implementations.
+	validPRM := NewPRMMatchRepoDigestOrExact()
+	validJSON, err := json.Marshal(validPRM)
+	require.NoError(t, err)
+	prm, err := newPolicyReferenceMatchFromJSON(validJSON)
+	require.NoError(t, err)
+	assert.Equal(t, validPRM, prm)
+
+	// Invalid
+	for _, invalid := range []interface{}{
+		// Not an object
+		1,
+		// Missing type
+		prmCommon{},
+		// Invalid type
+		prmCommon{Type: "this is invalid"},
+		// Valid type but invalid contents
+		prmExactReference{
+			prmCommon:       prmCommon{Type: prmTypeExactReference},
+			DockerReference: "",
+		},
+	} {
+		testJSON, err := json.Marshal(invalid)
+		require.NoError(t, err)
+
+		_, err = newPolicyReferenceMatchFromJSON(testJSON)
+		assert.Error(t, err, string(testJSON))
+	}
+}
+
+func TestNewPRMMatchExact(t *testing.T) {
+	_prm := NewPRMMatchExact()
+	prm, ok := _prm.(*prmMatchExact)
+	require.True(t, ok)
+	assert.Equal(t, &prmMatchExact{prmCommon{prmTypeMatchExact}}, prm)
+}
+
+func TestPRMMatchExactUnmarshalJSON(t *testing.T) {
+	var prm prmMatchExact
+
+	testInvalidJSONInput(t, &prm)
+
+	// Start with a valid JSON.
+	validPR := NewPRMMatchExact()
+	validJSON, err := json.Marshal(validPR)
+	require.NoError(t, err)
+
+	// Success
+	prm = prmMatchExact{}
+	err = json.Unmarshal(validJSON, &prm)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, &prm)
+
+	// newPolicyReferenceMatchFromJSON recognizes this type
+	_pr, err := newPolicyReferenceMatchFromJSON(validJSON)
+	require.NoError(t, err)
+	assert.Equal(t, validPR, _pr)
+
+	for _, invalid := range []mSI{
+		// Missing "type" field
 		{},
 		// Wrong "type" field
 		{"type": 1},
@@ -1369,3 +2528,133 @@ func TestPRMExactRepositoryUnmarshalJSON(t *testing.T) {
 		assert.Error(t, err)
 	}
 }
+
+func TestValidateIdentityRemappingPrefix(t *testing.T) {
+	for _, s := range []string{
+		"localhost",
+		"example.com",
+		"example.com:80",
+		"example.com/repo",
+		"example.com/ns1/ns2/ns3/repo.with.dots-dashes_underscores",
+		"example.com:80/ns1/ns2/ns3/repo.with.dots-dashes_underscores",
+		"docker.io/library",
+	} {
+		err := validateIdentityRemappingPrefix(s)
+		assert.NoError(t, err, s)
+	}
+
+	for _, s := range []string{
+		"",
+		"repo_with_underscores", // Not a valid DNS name, at least per docker/reference
+		"shortname",             // Not a host name
+		"ns/shortname",          // Not in the canonical form
+		"library/busybox",       // Not in the canonical form
+		"example.com/",
+		"example.com/UPPERCASEISINVALID",
+		"example.com/repo/",
+		"example.com/repo:tag",
+		"example.com/repo" + digestSuffix,
+		"example.com/repo:tag" + digestSuffix,
+	} {
+		err := validateIdentityRemappingPrefix(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestNewPRMRemapIdentity(t *testing.T) {
+	const testPrefix = "example.com/docker-library"
+	const testSignedPrefix = "docker.io/library"
+
+	// Success
+	_prm, err := NewPRMRemapIdentity(testPrefix, testSignedPrefix)
+	require.NoError(t, err)
+	prm, ok := _prm.(*prmRemapIdentity)
+	require.True(t, ok)
+	assert.Equal(t, &prmRemapIdentity{
+		prmCommon:    prmCommon{prmTypeRemapIdentity},
+		Prefix:       testPrefix,
+		SignedPrefix: testSignedPrefix,
+	}, prm)
+
+	// Invalid prefix
+	_, err = NewPRMRemapIdentity("", testSignedPrefix)
+	assert.Error(t, err)
+	_, err = NewPRMRemapIdentity("example.com/UPPERCASEISINVALID", testSignedPrefix)
+	assert.Error(t, err)
+	// Invalid signedPrefix
+	_, err = NewPRMRemapIdentity(testPrefix, "")
+	assert.Error(t, err)
+	_, err = NewPRMRemapIdentity(testPrefix, "example.com/UPPERCASEISINVALID")
+	assert.Error(t, err)
+}
+
+func TestPRMRemapIdentityUnmarshalJSON(t *testing.T) {
+	var prm prmRemapIdentity
+
+	testInvalidJSONInput(t, &prm)
+
+	// Start with a valid JSON.
+	validPRM, err := NewPRMRemapIdentity("example.com/docker-library", "docker.io/library")
+	require.NoError(t, err)
+	validJSON, err := json.Marshal(validPRM)
+	require.NoError(t, err)
+
+	// Success
+	prm = prmRemapIdentity{}
+	err = json.Unmarshal(validJSON, &prm)
+	require.NoError(t, err)
+	assert.Equal(t, validPRM, &prm)
+
+	// newPolicyReferenceMatchFromJSON recognizes this type
+	_prm, err := newPolicyReferenceMatchFromJSON(validJSON)
+	require.NoError(t, err)
+	assert.Equal(t, validPRM, _prm)
+
+	// Various ways to corrupt the JSON
+	breakFns := []func(mSI){
+		// The "type" field is missing
+		func(v mSI) { delete(v, "type") },
+		// Wrong "type" field
+		func(v mSI) { v["type"] = 1 },
+		func(v mSI) { v["type"] = "this is invalid" },
+		// Extra top-level sub-object
+		func(v mSI) { v["unexpected"] = 1 },
+		// The "prefix" field is missing
+		func(v mSI) { delete(v, "prefix") },
+		// Invalid "prefix" field
+		func(v mSI) { v["prefix"] = 1 },
+		func(v mSI) { v["prefix"] = "this is invalid" },
+		// The "signedPrefix" field is missing
+		func(v mSI) { delete(v, "signedPrefix") },
+		// Invalid "signedPrefix" field
+		func(v mSI) { v["signedPrefix"] = 1 },
+		func(v mSI) { v["signedPrefix"] = "this is invalid" },
+	}
+	for _, fn := range breakFns {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		fn(tmp)
+
+		testJSON, err := json.Marshal(tmp)
+		require.NoError(t, err)
+
+		prm = prmRemapIdentity{}
+		err = json.Unmarshal(testJSON, &prm)
+		assert.Error(t, err)
+	}
+
+	// Duplicated fields
+	for _, field := range []string{"type", "prefix", "signedPrefix"} {
+		var tmp mSI
+		err := json.Unmarshal(validJSON, &tmp)
+		require.NoError(t, err)
+
+		testJSON := addExtraJSONMember(t, validJSON, field, tmp[field])
+
+		prm = prmRemapIdentity{}
+		err = json.Unmarshal(testJSON, &prm)
+		assert.Error(t, err)
+	}
+}
@@ -7,6 +7,9 @@ package signature
 
 import (
 	"context"
+	"crypto"
+	"strings"
+	"sync"
 
 	"github.com/containers/image/types"
 	"github.com/pkg/errors"
@@ -20,6 +23,101 @@ func (err PolicyRequirementError) Error() string {
 	return string(err)
 }
 
+// PolicyRejectionReason classifies why a policy requirement rejected an image or a signature.
+type PolicyRejectionReason string
+
+const (
+	// PolicyRejectionReasonUnknown means the reason is not known, or does not fit any of the other values.
+	PolicyRejectionReasonUnknown PolicyRejectionReason = ""
+	// PolicyRejectionReasonRejectedByPolicy means the policy rejects the image regardless of its signatures.
+	PolicyRejectionReasonRejectedByPolicy PolicyRejectionReason = "rejectedByPolicy"
+	// PolicyRejectionReasonNoSignatures means a signature was required, but the image has none.
+	PolicyRejectionReasonNoSignatures PolicyRejectionReason = "noSignatures"
+	// PolicyRejectionReasonInvalidSignature means a signature is malformed or cryptographically invalid.
+	PolicyRejectionReasonInvalidSignature PolicyRejectionReason = "invalidSignature"
+	// PolicyRejectionReasonUntrustedKey means a signature was not made by a trusted key or signer.
+	PolicyRejectionReasonUntrustedKey PolicyRejectionReason = "untrustedKey"
+	// PolicyRejectionReasonIdentityMismatch means a signature was made for a different image identity or manifest.
+	PolicyRejectionReasonIdentityMismatch PolicyRejectionReason = "identityMismatch"
+	// PolicyRejectionReasonSignatureExpired means a signature is too old, or past its expiration time.
+	PolicyRejectionReasonSignatureExpired PolicyRejectionReason = "signatureExpired"
+)
+
+// policyRequirementReasonError is a PolicyRequirementError with a known PolicyRejectionReason.
+type policyRequirementReasonError struct {
+	PolicyRequirementError
+	reason PolicyRejectionReason
+}
+
+// Cause returns the underlying PolicyRequirementError, for use with github.com/pkg/errors.Cause.
+func (err policyRequirementReasonError) Cause() error {
+	return err.PolicyRequirementError
+}
+
+// newPolicyRequirementError returns a PolicyRequirementError-like error with msg, recording reason.
+func newPolicyRequirementError(reason PolicyRejectionReason, msg string) error {
+	return policyRequirementReasonError{PolicyRequirementError: PolicyRequirementError(msg), reason: reason}
+}
+
+// policyRejectionReason returns the PolicyRejectionReason corresponding to err.
+func policyRejectionReason(err error) PolicyRejectionReason {
+	for err != nil {
+		switch e := err.(type) {
+		case policyRequirementReasonError:
+			return e.reason
+		case PolicyRejectionError:
+			return e.Reason
+		case InvalidSignatureError:
+			return PolicyRejectionReasonInvalidSignature
+		}
+		// Like errors.Cause, but stopping at policyRequirementReasonError, which has a Cause method itself.
+		causer, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			break
+		}
+		err = causer.Cause()
+	}
+	return PolicyRejectionReasonUnknown
+}
+
+// policyRequirementType returns the "type" of req, as used in policy.json, or "" if it is not known.
+func policyRequirementType(req PolicyRequirement) string {
+	if r, ok := req.(interface {
+		requirementType() prTypeIdentifier
+	}); ok {
+		return string(r.requirementType())
+	}
+	return ""
+}
+
+// PolicyRejectionError is returned by PolicyContext.IsRunningImageAllowed when a policy requirement rejects an image.
+// Its Error() text is the same as the text of the underlying error.
+type PolicyRejectionError struct {
+	// RequirementType is the "type" of the rejecting requirement, as used in policy.json (e.g. "signedBy"),
+	// or "" if the image was rejected because no requirements apply to it.
+	RequirementType string
+	// ScopeTransport and Scope identify the section of the policy which applies to the image: Scope within
+	// Policy.Transports[ScopeTransport]. ScopeTransport is "" if Policy.Default was used.
+	ScopeTransport string
+	Scope          string
+	// Reason classifies the cause of the rejection.
+	Reason PolicyRejectionReason
+	// Err is the underlying error, usually a PolicyRequirementError; errors.Cause returns a PolicyRequirementError
+	// whenever a requirement rejected the image (as opposed to evaluation failing).
+	Err error
+}
+
+func (err PolicyRejectionError) Error() string {
+	return err.Err.Error()
+}
+
+// Cause returns the underlying error, for use with github.com/pkg/errors.Cause.
+func (err PolicyRejectionError) Cause() error {
+	return err.Err
+}
+
 // signatureAcceptanceResult is the principal value returned by isSignatureAuthorAccepted.
 type signatureAcceptanceResult string
 
@@ -76,9 +174,63 @@ type PolicyReferenceMatch interface {
 
 // PolicyContext encapsulates a policy and possible cached state
 // for speeding up its evaluation.
+// A single PolicyContext can be used to evaluate several images concurrently, from multiple goroutines.
+// Signatures accepted by a requirement are remembered per manifest digest, so that evaluating the same image again
+// does not verify them again; acceptances which depend on the current time, or use a custom SigningMechanismFactory,
+// are not remembered.
 type PolicyContext struct {
 	Policy *Policy
-	state  policyContextState // Internal consistency checking
+	// SigningMechanismFactory, if not nil, is used instead of the default GPG implementation to create
+	// the mechanisms verifying signatures for "signedBy" requirements.
+	// It must not be modified while the context is in use.
+	SigningMechanismFactory SigningMechanismFactory
+	// SystemContext, if not nil, is used when accessing base images for "signedBaseLayer" requirements.
+	SystemContext *types.SystemContext
+
+	sigstoreKeyURIKeysLock sync.Mutex                  // Protects sigstoreKeyURIKeys
+	sigstoreKeyURIKeys     map[string]crypto.PublicKey // Keys for "sigstoreSigned" keyURI values, resolved when first used, or nil
+
+	acceptedSignaturesLock sync.Mutex                               // Protects acceptedSignatures
+	acceptedSignatures     map[acceptedSignatureCacheKey]*Signature // Signatures accepted by previous evaluations, or nil
+
+	stateLock  sync.Mutex         // Protects state and inUseCount
+	state      policyContextState // Internal consistency checking
+	inUseCount int                // Number of evaluations in progress; non-zero iff state == pcInUse
+}
+
+// signingMechanismFactoryKey is the context.Context key used to pass PolicyContext.SigningMechanismFactory
+// to PolicyRequirement implementations.
+type signingMechanismFactoryKey struct{}
+
+// policyContextKey is the context.Context key used to pass the evaluating PolicyContext to PolicyRequirement implementations.
+type policyContextKey struct{}
+
+// evaluationContext returns a context.Context to use when evaluating requirements within pc.
+func (pc *PolicyContext) evaluationContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, policyContextKey{}, pc)
+	if pc.SigningMechanismFactory == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, signingMechanismFactoryKey{}, pc.SigningMechanismFactory)
+}
+
+// policyContextFromContext returns the PolicyContext evaluating requirements in ctx, or nil if there is none.
+func policyContextFromContext(ctx context.Context) *PolicyContext {
+	if ctx == nil {
+		return nil
+	}
+	pc, _ := ctx.Value(policyContextKey{}).(*PolicyContext)
+	return pc
+}
+
+// signingMechanismFactoryFromContext returns the SigningMechanismFactory to use for evaluation in ctx.
+func signingMechanismFactoryFromContext(ctx context.Context) SigningMechanismFactory {
+	if ctx != nil {
+		if factory, ok := ctx.Value(signingMechanismFactoryKey{}).(SigningMechanismFactory); ok && factory != nil {
+			return factory
+		}
+	}
+	return newEphemeralGPGSigningMechanism
 }
 
 // policyContextState is used internally to verify the users are not misusing a PolicyContext.
@@ -95,6 +247,9 @@ const (
 
 // changeContextState changes pc.state, or fails if the state is unexpected
 func (pc *PolicyContext) changeState(expected, new policyContextState) error {
+	pc.stateLock.Lock()
+	defer pc.stateLock.Unlock()
+
 	if pc.state != expected {
 		return errors.Errorf(`"Invalid PolicyContext state, expected "%s", found "%s"`, expected, pc.state)
 	}
@@ -102,10 +257,64 @@ func (pc *PolicyContext) changeState(expected, new policyContextState) error {
 	return nil
 }
 
+// startEvaluation records that an evaluation using pc has started, or fails if pc is not usable.
+// Each successful call must be paired with a call to pc.finishEvaluation.
+func (pc *PolicyContext) startEvaluation() error {
+	pc.stateLock.Lock()
+	defer pc.stateLock.Unlock()
+
+	switch pc.state {
+	case pcReady:
+		pc.state = pcInUse
+		pc.inUseCount = 1
+	case pcInUse:
+		pc.inUseCount++
+	default:
+		return errors.Errorf(`Invalid PolicyContext state, expected "%s" or "%s", found "%s"`, pcReady, pcInUse, pc.state)
+	}
+	return nil
+}
+
+// finishEvaluation records that an evaluation started by pc.startEvaluation has finished.
+func (pc *PolicyContext) finishEvaluation() error {
+	pc.stateLock.Lock()
+	defer pc.stateLock.Unlock()
+
+	if pc.state != pcInUse || pc.inUseCount <= 0 {
+		return errors.Errorf(`Invalid PolicyContext state, expected "%s", found "%s" with %d evaluations in progress`, pcInUse, pc.state, pc.inUseCount)
+	}
+	pc.inUseCount--
+	if pc.inUseCount == 0 {
+		pc.state = pcReady
+	}
+	return nil
+}
+
+// PolicyContextOptions contains options for NewPolicyContextWithOptions.
+type PolicyContextOptions struct {
+	// RejectUnimplementedRequirements, if true, causes the context creation to fail if the policy contains
+	// requirements or identity matches this implementation can not evaluate, instead of rejecting images
+	// only when the requirement is evaluated.
+	RejectUnimplementedRequirements bool
+}
+
 // NewPolicyContext sets up and initializes a context for the specified policy.
 // The policy must not be modified while the context exists. FIXME: make a deep copy?
 // If this function succeeds, the caller should call PolicyContext.Destroy() when done.
 func NewPolicyContext(policy *Policy) (*PolicyContext, error) {
+	return NewPolicyContextWithOptions(policy, nil)
+}
+
+// NewPolicyContextWithOptions is like NewPolicyContext, with additional options; options may be nil.
+func NewPolicyContextWithOptions(policy *Policy, options *PolicyContextOptions) (*PolicyContext, error) {
+	if options == nil {
+		options = &PolicyContextOptions{}
+	}
+	if options.RejectUnimplementedRequirements {
+		if err := checkPolicyImplemented(policy); err != nil {
+			return nil, err
+		}
+	}
 	pc := &PolicyContext{Policy: policy, state: pcInitializing}
 	// FIXME: initialize
 	if err := pc.changeState(pcInitializing, pcReady); err != nil {
@@ -117,11 +326,15 @@ func NewPolicyContext(policy *Policy) (*PolicyContext, error) {
 }
 
 // Destroy should be called when the user of the context is done with it.
+// It fails if any evaluations using the context are still in progress.
 func (pc *PolicyContext) Destroy() error {
 	if err := pc.changeState(pcReady, pcDestroying); err != nil {
 		return err
 	}
 	// FIXME: destroy
+	pc.acceptedSignaturesLock.Lock()
+	pc.acceptedSignatures = nil
+	pc.acceptedSignaturesLock.Unlock()
 	return pc.changeState(pcDestroying, pcDestroyed)
 }
 
@@ -132,7 +345,8 @@ func policyIdentityLogName(ref types.ImageReference) string {
 }
 
 // requirementsForImageRef selects the appropriate requirements for ref.
-func (pc *PolicyContext) requirementsForImageRef(ref types.ImageReference) PolicyRequirements {
+// It also returns the transport and scope of the selected policy section; scopeTransport is "" if Policy.Default was selected.
+func (pc *PolicyContext) requirementsForImageRef(ref types.ImageReference) (reqs PolicyRequirements, scopeTransport, scope string) {
 	// Do we have a PolicyTransportScopes for this transport?
 	transportName := ref.Transport().Name()
 	if transportScopes, ok := pc.Policy.Transports[transportName]; ok {
@@ -140,31 +354,137 @@ func (pc *PolicyContext) requirementsForImageRef(ref types.ImageReference) Polic
 		identity := ref.PolicyConfigurationIdentity()
 		if req, ok := transportScopes[identity]; ok {
 			logrus.Debugf(` Using transport "%s" policy section %s`, transportName, identity)
-			return req
+			return req, transportName, identity
 		}
 
 		// Look for a match of the possible parent namespaces.
 		for _, name := range ref.PolicyConfigurationNamespaces() {
 			if req, ok := transportScopes[name]; ok {
 				logrus.Debugf(` Using transport "%s" specific policy section %s`, transportName, name)
-				return req
+				return req, transportName, name
 			}
 		}
 
+		// Look for a wildcard match.
+		if name, ok := bestWildcardScopeMatch(transportScopes, identity, ref.PolicyConfigurationNamespaces()); ok {
+			logrus.Debugf(` Using transport "%s" wildcard policy section %s`, transportName, name)
+			return transportScopes[name], transportName, name
+		}
+
 		// Look for a default match for the transport.
 		if req, ok := transportScopes[""]; ok {
 			logrus.Debugf(` Using transport "%s" policy section ""`, transportName)
-			return req
+			return req, transportName, ""
 		}
 	}
 
 	logrus.Debugf(" Using default policy section")
-	return pc.Policy.Default
+	return pc.Policy.Default, "", ""
+}
+
+// PolicyScopeForImage returns the section of the policy which applies to ref: scope within
+// Policy.Transports[scopeTransport]; scopeTransport is "" if Policy.Default applies.
+// This does not evaluate any requirements; it is intended e.g. for debugging which policy entries apply to an image.
+func (pc *PolicyContext) PolicyScopeForImage(ref types.ImageReference) (scopeTransport, scope string, finalErr error) {
+	if err := pc.startEvaluation(); err != nil {
+		return "", "", err
+	}
+	defer func() {
+		if err := pc.finishEvaluation(); err != nil {
+			scopeTransport = ""
+			scope = ""
+			finalErr = err
+		}
+	}()
+
+	_, scopeTransport, scope = pc.requirementsForImageRef(ref)
+	return scopeTransport, scope, nil
+}
+
+// bestWildcardScopeMatch returns the most specific (i.e. longest) wildcard scope in transportScopes
+// which matches identity or any of namespaces, if any.
+func bestWildcardScopeMatch(transportScopes PolicyTransportScopes, identity string, namespaces []string) (string, bool) {
+	best := ""
+	found := false
+	for scope := range transportScopes {
+		if !strings.Contains(scope, "*") {
+			continue
+		}
+		if found && (len(scope) < len(best) || (len(scope) == len(best) && scope > best)) {
+			continue
+		}
+		if wildcardScopeMatches(scope, identity) || wildcardScopeMatchesAny(scope, namespaces) {
+			best = scope
+			found = true
+		}
+	}
+	return best, found
+}
+
+// wildcardScopeMatchesAny returns true if the wildcard scope matches any of values.
+func wildcardScopeMatchesAny(scope string, values []string) bool {
+	for _, v := range values {
+		if wildcardScopeMatches(scope, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardScopeMatches returns true if the wildcard scope matches value, which is a PolicyConfigurationIdentity or
+// a PolicyConfigurationNamespaces element.
+// Two forms of wildcard scopes are recognized:
+// - "*.example.com" matches any subdomain of example.com (but not example.com itself), used as the first component of value;
+// - "prefix/*" matches any value starting with "prefix/".
+// Transports decide, in ValidatePolicyConfigurationScope, which of these forms they accept.
+func wildcardScopeMatches(scope, value string) bool {
+	switch {
+	case strings.HasPrefix(scope, "*."):
+		suffix := scope[1:] // ".example.com"
+		return strings.HasSuffix(value, suffix) && len(value) > len(suffix) &&
+			!strings.Contains(value[:len(value)-len(suffix)], "/")
+	case strings.HasSuffix(scope, "/*"):
+		return strings.HasPrefix(value, scope[:len(scope)-1])
+	default:
+		return false
+	}
+}
+
+// SignatureRequirementResult is the outcome of evaluating a single signature against a single PolicyRequirement.
+type SignatureRequirementResult string
+
+const (
+	// SignatureRequirementAccepted means the signature has been verified against the appropriate public key.
+	SignatureRequirementAccepted SignatureRequirementResult = "accepted"
+	// SignatureRequirementRejected means the signature has not been verified.
+	SignatureRequirementRejected SignatureRequirementResult = "rejected"
+	// SignatureRequirementUnknown means the requirement does not deal with signatures.
+	SignatureRequirementUnknown SignatureRequirementResult = "unknown"
+)
+
+// SignatureRequirementEvaluation describes how a single PolicyRequirement evaluated a signature.
+type SignatureRequirementEvaluation struct {
+	RequirementIndex int                        // The index of Requirement in the PolicyRequirements applicable to the image
+	Requirement      PolicyRequirement          // The evaluated requirement
+	Result           SignatureRequirementResult // The outcome of the evaluation
+	Err              error                      // The reason for rejection, non-nil iff Result == SignatureRequirementRejected
+}
+
+// SignatureEvaluation describes how the policy evaluated a single signature of an image.
+type SignatureEvaluation struct {
+	// Accepted is true iff the policy accepts the author of the signature, and the signature has been successfully verified.
+	Accepted bool
+	// Signature is the verified contents of the signature; it is non-nil iff Accepted is true.
+	Signature *Signature
+	// Requirements lists the evaluations of the individual requirements, in order.
+	// The evaluation stops at the first requirement which rejects the signature, so this may not include all requirements.
+	Requirements []SignatureRequirementEvaluation
 }
 
 // GetSignaturesWithAcceptedAuthor returns those signatures from an image
 // for which the policy accepts the author (and which have been successfully
 // verified).
+// Evaluation is aborted, with ctx.Err(), if ctx is cancelled or times out.
 // NOTE: This may legitimately return an empty list and no error, if the image
 // has no signatures or only invalid signatures.
 // WARNING: This makes the signature contents acceptable for futher processing,
@@ -175,111 +495,190 @@ func (pc *PolicyContext) requirementsForImageRef(ref types.ImageReference) Polic
 //   a container based on this image; use IsRunningImageAllowed instead.
 // - Just because a signature is accepted does not automatically mean the contents of the
 //   signature are authorized to run code as root, or to affect system or cluster configuration.
-func (pc *PolicyContext) GetSignaturesWithAcceptedAuthor(ctx context.Context, image types.UnparsedImage) (sigs []*Signature, finalErr error) {
-	if err := pc.changeState(pcReady, pcInUse); err != nil {
+func (pc *PolicyContext) GetSignaturesWithAcceptedAuthor(ctx context.Context, image types.UnparsedImage) ([]*Signature, error) {
+	evaluations, err := pc.EvaluateSignatures(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Signature, 0, len(evaluations))
+	for _, evaluation := range evaluations {
+		if evaluation.Accepted {
+			res = append(res, evaluation.Signature)
+		}
+	}
+	return res, nil
+}
+
+// EvaluateSignatures evaluates all signatures of an image, and returns a detailed
+// description of the evaluation of each of them, in the order of image.Signatures().
+// This is intended for auditing and for explaining policy decisions to users; the
+// result for each signature is the same as in GetSignaturesWithAcceptedAuthor, and
+// the same WARNING applies to the accepted signatures.
+// Evaluation is aborted, with ctx.Err(), if ctx is cancelled or times out.
+func (pc *PolicyContext) EvaluateSignatures(ctx context.Context, image types.UnparsedImage) (evaluations []SignatureEvaluation, finalErr error) {
+	if err := pc.startEvaluation(); err != nil {
 		return nil, err
 	}
 	defer func() {
-		if err := pc.changeState(pcInUse, pcReady); err != nil {
-			sigs = nil
+		if err := pc.finishEvaluation(); err != nil {
+			evaluations = nil
 			finalErr = err
 		}
 	}()
 
-	logrus.Debugf("GetSignaturesWithAcceptedAuthor for image %s", policyIdentityLogName(image.Reference()))
-	reqs := pc.requirementsForImageRef(image.Reference())
+	logrus.Debugf("EvaluateSignatures for image %s", policyIdentityLogName(image.Reference()))
+	ctx = pc.evaluationContext(ctx)
+	reqs, _, _ := pc.requirementsForImageRef(image.Reference())
 
 	// FIXME: rename Signatures to UnverifiedSignatures
-	// FIXME: pass context.Context
 	unverifiedSignatures, err := image.Signatures(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	res := make([]*Signature, 0, len(unverifiedSignatures))
+	res := make([]SignatureEvaluation, 0, len(unverifiedSignatures))
 	for sigNumber, sig := range unverifiedSignatures {
-		var acceptedSig *Signature // non-nil if accepted
-		rejected := false
+		// Verifying a signature may be expensive; stop early if the caller is no longer interested.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		// FIXME? Say more about the contents of the signature, i.e. parse it even before verification?!
 		logrus.Debugf("Evaluating signature %d:", sigNumber)
-	interpretingReqs:
-		for reqNumber, req := range reqs {
-			// FIXME: Log the requirement itself? For now, we use just the number.
-			// FIXME: supply state
-			switch res, as, err := req.isSignatureAuthorAccepted(ctx, image, sig); res {
-			case sarAccepted:
-				if as == nil { // Coverage: this should never happen
-					logrus.Debugf(" Requirement %d: internal inconsistency: sarAccepted but no parsed contents", reqNumber)
-					rejected = true
-					break interpretingReqs
-				}
-				logrus.Debugf(" Requirement %d: signature accepted", reqNumber)
-				if acceptedSig == nil {
-					acceptedSig = as
-				} else if *as != *acceptedSig { // Coverage: this should never happen
-					// Huh?! Two ways of verifying the same signature blob resulted in two different parses of its already accepted contents?
-					logrus.Debugf(" Requirement %d: internal inconsistency: sarAccepted but different parsed contents", reqNumber)
-					rejected = true
-					acceptedSig = nil
-					break interpretingReqs
-				}
-			case sarRejected:
-				logrus.Debugf(" Requirement %d: signature rejected: %s", reqNumber, err.Error())
-				rejected = true
+		res = append(res, evaluateSignature(ctx, reqs, image, sig))
+	}
+	return res, nil
+}
+
+// evaluateSignature evaluates a single signature of image against reqs.
+func evaluateSignature(ctx context.Context, reqs PolicyRequirements, image types.UnparsedImage, sig []byte) SignatureEvaluation {
+	var acceptedSig *Signature // non-nil if accepted
+	rejected := false
+	reqEvaluations := []SignatureRequirementEvaluation{}
+	// reject records a rejection of the signature by reqs[reqNumber].
+	reject := func(reqNumber int, err error) {
+		rejected = true
+		reqEvaluations = append(reqEvaluations, SignatureRequirementEvaluation{
+			RequirementIndex: reqNumber,
+			Requirement:      reqs[reqNumber],
+			Result:           SignatureRequirementRejected,
+			Err:              err,
+		})
+	}
+interpretingReqs:
+	for reqNumber, req := range reqs {
+		// FIXME: Log the requirement itself? For now, we use just the number.
+		// FIXME: supply state
+		switch res, as, err := isSignatureAuthorAcceptedCached(ctx, req, image, sig); res {
+		case sarAccepted:
+			if as == nil { // Coverage: this should never happen
+				logrus.Debugf(" Requirement %d: internal inconsistency: sarAccepted but no parsed contents", reqNumber)
+				reject(reqNumber, errors.New("Internal inconsistency: signature accepted but no parsed contents"))
 				break interpretingReqs
-			case sarUnknown:
-				if err != nil { // Coverage: this should never happen
-					logrus.Debugf(" Requirement %d: internal inconsistency: sarUnknown but an error message %s", reqNumber, err.Error())
-					rejected = true
-					break interpretingReqs
-				}
-				logrus.Debugf(" Requirement %d: signature state unknown, continuing", reqNumber)
-			default: // Coverage: this should never happen
-				logrus.Debugf(" Requirement %d: internal inconsistency: unknown result %#v", reqNumber, string(res))
-				rejected = true
+			}
+			logrus.Debugf(" Requirement %d: signature accepted", reqNumber)
+			if acceptedSig == nil {
+				acceptedSig = as
+			} else if !as.equal(acceptedSig) { // Coverage: this should never happen
+				// Huh?! Two ways of verifying the same signature blob resulted in two different parses of its already accepted contents?
+				logrus.Debugf(" Requirement %d: internal inconsistency: sarAccepted but different parsed contents", reqNumber)
+				acceptedSig = nil
+				reject(reqNumber, errors.New("Internal inconsistency: signature accepted but with different parsed contents"))
 				break interpretingReqs
 			}
-		}
-		// This also handles the (invalid) case of empty reqs, by rejecting the signature.
-		if acceptedSig != nil && !rejected {
-			logrus.Debugf(" Overall: OK, signature accepted")
-			res = append(res, acceptedSig)
-		} else {
-			logrus.Debugf(" Overall: Signature not accepted")
+			reqEvaluations = append(reqEvaluations, SignatureRequirementEvaluation{
+				RequirementIndex: reqNumber,
+				Requirement:      req,
+				Result:           SignatureRequirementAccepted,
+			})
+		case sarRejected:
+			logrus.Debugf(" Requirement %d: signature rejected: %s", reqNumber, err.Error())
+			reject(reqNumber, err)
+			break interpretingReqs
+		case sarUnknown:
+			if err != nil { // Coverage: this should never happen
+				logrus.Debugf(" Requirement %d: internal inconsistency: sarUnknown but an error message %s", reqNumber, err.Error())
+				reject(reqNumber, errors.Wrap(err, "Internal inconsistency: signature state unknown but an error reported"))
+				break interpretingReqs
+			}
+			logrus.Debugf(" Requirement %d: signature state unknown, continuing", reqNumber)
+			reqEvaluations = append(reqEvaluations, SignatureRequirementEvaluation{
+				RequirementIndex: reqNumber,
+				Requirement:      req,
+				Result:           SignatureRequirementUnknown,
+			})
+		default: // Coverage: this should never happen
+			logrus.Debugf(" Requirement %d: internal inconsistency: unknown result %#v", reqNumber, string(res))
+			reject(reqNumber, errors.Errorf("Internal inconsistency: unknown result %#v", string(res)))
+			break interpretingReqs
 		}
 	}
-	return res, nil
+	// This also handles the (invalid) case of empty reqs, by rejecting the signature.
+	if acceptedSig != nil && !rejected {
+		logrus.Debugf(" Overall: OK, signature accepted")
+		return SignatureEvaluation{Accepted: true, Signature: acceptedSig, Requirements: reqEvaluations}
+	}
+	logrus.Debugf(" Overall: Signature not accepted")
+	return SignatureEvaluation{Accepted: false, Signature: nil, Requirements: reqEvaluations}
 }
 
 // IsRunningImageAllowed returns true iff the policy allows running the image.
-// If it returns false, err must be non-nil, and should be an PolicyRequirementError if evaluation
+// If it returns false, err must be non-nil, and is a PolicyRejectionError if evaluation
 // succeeded but the result was rejection.
+// Evaluation is aborted, with ctx.Err(), if ctx is cancelled or times out.
 // WARNING: This validates signatures and the manifest, but does not download or validate the
 // layers. Users must validate that the layers match their expected digests.
 func (pc *PolicyContext) IsRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (res bool, finalErr error) {
-	if err := pc.changeState(pcReady, pcInUse); err != nil {
+	if err := pc.startEvaluation(); err != nil {
 		return false, err
 	}
 	defer func() {
-		if err := pc.changeState(pcInUse, pcReady); err != nil {
+		if err := pc.finishEvaluation(); err != nil {
 			res = false
 			finalErr = err
 		}
 	}()
 
 	logrus.Debugf("IsRunningImageAllowed for image %s", policyIdentityLogName(image.Reference()))
-	reqs := pc.requirementsForImageRef(image.Reference())
+	return pc.isRunningImageAllowed(pc.evaluationContext(ctx), image)
+}
+
+// isRunningImageAllowed implements IsRunningImageAllowed, within an evaluation already started by the caller,
+// using ctx returned by pc.evaluationContext.
+func (pc *PolicyContext) isRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (bool, error) {
+	reqs, scopeTransport, scope := pc.requirementsForImageRef(image.Reference())
 
 	if len(reqs) == 0 {
-		return false, PolicyRequirementError("List of verification policy requirements must not be empty")
+		return false, PolicyRejectionError{
+			ScopeTransport: scopeTransport,
+			Scope:          scope,
+			Reason:         PolicyRejectionReasonRejectedByPolicy,
+			Err:            PolicyRequirementError("List of verification policy requirements must not be empty"),
+		}
 	}
 
 	for reqNumber, req := range reqs {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
 		// FIXME: supply state
 		allowed, err := req.isRunningImageAllowed(ctx, image)
 		if !allowed {
 			logrus.Debugf("Requirement %d: denied, done", reqNumber)
-			return false, err
+			if err == nil { // Coverage: this should never happen
+				err = errors.New("Internal error: requirement denied the image without an error")
+			}
+			reason := policyRejectionReason(err)
+			if e, ok := err.(policyRequirementReasonError); ok {
+				err = e.PolicyRequirementError // The reason is recorded in PolicyRejectionError.Reason
+			}
+			return false, PolicyRejectionError{
+				RequirementType: policyRequirementType(req),
+				ScopeTransport:  scopeTransport,
+				Scope:           scope,
+				Reason:          reason,
+				Err:             err,
+			}
 		}
 		logrus.Debugf(" Requirement %d: allowed", reqNumber)
 	}
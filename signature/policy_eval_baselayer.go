@@ -4,17 +4,156 @@ package signature
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/image"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/transports"
 	"github.com/containers/image/types"
-	"github.com/sirupsen/logrus"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
 )
 
+// maxBaseLayerDepth is the maximum number of nested signedBaseLayer evaluations,
+// to prevent infinite recursion if base images are configured to (indirectly) require themselves.
+const maxBaseLayerDepth = 8
+
+// baseLayerDepthKey is the context.Context key used to record the current nesting depth of signedBaseLayer evaluations.
+type baseLayerDepthKey struct{}
+
+// openBaseLayerImageSource returns an ImageSource for ref, using sys.
+// This is a variable only to allow tests to replace it.
+var openBaseLayerImageSource = func(ctx context.Context, sys *types.SystemContext, ref reference.Named) (types.ImageSource, error) {
+	transport := transports.Get("docker")
+	if transport == nil {
+		return nil, errors.New(`The "docker" transport is not available`)
+	}
+	imageRef, err := transport.ParseReference("//" + ref.String())
+	if err != nil {
+		return nil, err
+	}
+	return imageRef.NewImageSource(ctx, sys)
+}
+
 func (pr *prSignedBaseLayer) isSignatureAuthorAccepted(ctx context.Context, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
 	return sarUnknown, nil, nil
 }
 
 func (pr *prSignedBaseLayer) isRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (bool, error) {
-	// FIXME? Reject this at policy parsing time already?
-	logrus.Errorf("signedBaseLayer not implemented yet!")
-	return false, PolicyRequirementError("signedBaseLayer not implemented yet!")
+	pc := policyContextFromContext(ctx)
+	if pc == nil {
+		return false, PolicyRequirementError("signedBaseLayer can only be evaluated using a PolicyContext")
+	}
+	depth, _ := ctx.Value(baseLayerDepthKey{}).(int)
+	if depth >= maxBaseLayerDepth {
+		return false, PolicyRequirementError(fmt.Sprintf("Too many nested signedBaseLayer requirements (more than %d)", maxBaseLayerDepth))
+	}
+	baseRef, err := pr.baseImageReference()
+	if err != nil {
+		return false, err
+	}
+
+	baseSrc, baseImage, err := openBaseLayerImage(ctx, pc.SystemContext, baseRef)
+	if err != nil {
+		return false, errors.Wrapf(err, "Error opening base image %s", baseRef.String())
+	}
+	defer baseSrc.Close()
+
+	// The base image must be acceptable on its own, per the policy for its own identity.
+	if allowed, err := pc.isRunningImageAllowed(context.WithValue(ctx, baseLayerDepthKey{}, depth+1), baseImage); !allowed {
+		if err == nil { // Coverage: this should never happen
+			err = errors.New("Internal error: base image denied without an error")
+		}
+		return false, newPolicyRequirementError(policyRejectionReason(err), fmt.Sprintf("Base image %s is rejected: %v", baseRef.String(), err))
+	}
+
+	baseInstance, err := baseLayerImageInstance(ctx, pc.SystemContext, baseSrc, baseImage)
+	if err != nil {
+		return false, errors.Wrapf(err, "Error choosing an image from base image %s", baseRef.String())
+	}
+	baseLayers, err := nonEmptyLayerDigests(ctx, baseInstance)
+	if err != nil {
+		return false, errors.Wrapf(err, "Error reading layers of base image %s", baseRef.String())
+	}
+	if len(baseLayers) == 0 {
+		return false, PolicyRequirementError(fmt.Sprintf("Base image %s has no layers", baseRef.String()))
+	}
+	layers, err := nonEmptyLayerDigests(ctx, image)
+	if err != nil {
+		return false, errors.Wrapf(err, "Error reading layers of image %s", transports.ImageName(image.Reference()))
+	}
+	if len(layers) < len(baseLayers) {
+		return false, newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch,
+			fmt.Sprintf("Image %s is not based on %s: it has fewer layers", transports.ImageName(image.Reference()), baseRef.String()))
+	}
+	for i, baseLayer := range baseLayers {
+		if layers[i] != baseLayer {
+			return false, newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch,
+				fmt.Sprintf("Image %s is not based on %s: layer %d is %s, expected %s", transports.ImageName(image.Reference()), baseRef.String(), i, layers[i], baseLayer))
+		}
+	}
+	return true, nil
+}
+
+// baseImageReference returns the base image reference specified by pr.BaseLayerIdentity.
+func (pr *prSignedBaseLayer) baseImageReference() (reference.Named, error) {
+	prm, ok := pr.BaseLayerIdentity.(*prmExactReference)
+	if !ok {
+		return nil, PolicyRequirementError(fmt.Sprintf("signedBaseLayer requires an %s baseLayerIdentity to locate the base image", prmTypeExactReference))
+	}
+	ref, err := reference.ParseNormalizedNamed(prm.DockerReference)
+	if err != nil {
+		return nil, err
+	}
+	if reference.IsNameOnly(ref) {
+		return nil, PolicyRequirementError(fmt.Sprintf("signedBaseLayer base image %s does not include a tag or digest", prm.DockerReference))
+	}
+	return ref, nil
+}
+
+// openBaseLayerImage returns an ImageSource for ref, which the caller must close, and an UnparsedImage for its primary manifest.
+func openBaseLayerImage(ctx context.Context, sys *types.SystemContext, ref reference.Named) (types.ImageSource, types.UnparsedImage, error) {
+	src, err := openBaseLayerImageSource(ctx, sys, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, image.UnparsedInstance(src, nil), nil
+}
+
+// baseLayerImageInstance returns the single image in src whose layers should be compared with the evaluated image:
+// img (the primary manifest of src) itself, or, if img is a manifest list, the instance appropriate for sys.
+// The policy for the base image is evaluated on img, so signatures of the manifest list also cover the chosen instance.
+func baseLayerImageInstance(ctx context.Context, sys *types.SystemContext, src types.ImageSource, img types.UnparsedImage) (types.UnparsedImage, error) {
+	_, manifestMIMEType, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !manifest.MIMETypeIsMultiImage(manifestMIMEType) {
+		return img, nil
+	}
+	instanceDigest, err := image.ChooseManifestInstanceFromManifestList(ctx, sys, img)
+	if err != nil {
+		return nil, err
+	}
+	return image.UnparsedInstance(src, &instanceDigest), nil
+}
+
+// nonEmptyLayerDigests returns digests of the layers of img, in order, ignoring “empty”/“throwaway” layers.
+func nonEmptyLayerDigests(ctx context.Context, img types.UnparsedImage) ([]digest.Digest, error) {
+	manifestBlob, manifestMIMEType, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.FromBlob(manifestBlob, manifestMIMEType)
+	if err != nil {
+		return nil, err
+	}
+	res := []digest.Digest{}
+	for _, layer := range m.LayerInfos() {
+		if !layer.EmptyLayer {
+			res = append(res, layer.Digest)
+		}
+	}
+	return res, nil
 }
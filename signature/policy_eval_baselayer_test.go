@@ -2,11 +2,76 @@ package signature
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/containers/image/directory"
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// baseLayerImageMock is a types.UnparsedImage with a specified schema2 manifest and no signatures.
+type baseLayerImageMock struct {
+	ref      types.ImageReference
+	manifest []byte
+}
+
+func (img baseLayerImageMock) Reference() types.ImageReference {
+	return img.ref
+}
+func (img baseLayerImageMock) Manifest(ctx context.Context) ([]byte, string, error) {
+	return img.manifest, manifest.DockerV2Schema2MediaType, nil
+}
+func (img baseLayerImageMock) Signatures(ctx context.Context) ([][]byte, error) {
+	return nil, nil
+}
+
+// baseLayerImageMockWithLayers returns a baseLayerImageMock for dockerReference, based on the manifest in fixtures/dir-img-valid,
+// with its layers replaced by layers.
+func baseLayerImageMockWithLayers(t *testing.T, dockerReference string, layers []digest.Digest) types.UnparsedImage {
+	ref, err := reference.ParseNormalizedNamed(dockerReference)
+	require.NoError(t, err)
+	manifestBlob, err := ioutil.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	m, err := manifest.Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	m.LayersDescriptors = []manifest.Schema2Descriptor{}
+	for _, layer := range layers {
+		m.LayersDescriptors = append(m.LayersDescriptors, manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2LayerMediaType,
+			Size:      1,
+			Digest:    layer,
+		})
+	}
+	manifestBlob, err = json.Marshal(m)
+	require.NoError(t, err)
+	return baseLayerImageMock{ref: pcImageReferenceMock{"docker", ref}, manifest: manifestBlob}
+}
+
+// withBaseLayerImageDirs replaces openBaseLayerImageSource to use directories in dirs for the specified references,
+// and returns a function restoring the original value.
+func withBaseLayerImageDirs(t *testing.T, dirs map[string]string) func() {
+	original := openBaseLayerImageSource
+	openBaseLayerImageSource = func(ctx context.Context, sys *types.SystemContext, ref reference.Named) (types.ImageSource, error) {
+		dir, ok := dirs[ref.String()]
+		require.True(t, ok, ref.String())
+		srcRef, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		src, err := srcRef.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		return &dirImageSourceMock{ImageSource: src, ref: pcImageReferenceMock{"docker", ref}}, nil
+	}
+	return func() { openBaseLayerImageSource = original }
+}
+
 func TestPRSignedBaseLayerIsSignatureAuthorAccepted(t *testing.T) {
 	pr, err := NewPRSignedBaseLayer(NewPRMMatchRepository())
 	require.NoError(t, err)
@@ -16,10 +81,178 @@ func TestPRSignedBaseLayerIsSignatureAuthorAccepted(t *testing.T) {
 }
 
 func TestPRSignedBaseLayerIsRunningImageAllowed(t *testing.T) {
-	// This will obviously need to change after signedBaseLayer is implemented.
+	// Evaluation outside of a PolicyContext is rejected.
 	pr, err := NewPRSignedBaseLayer(NewPRMMatchRepository())
 	require.NoError(t, err)
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
 	res, err := pr.isRunningImageAllowed(context.Background(), nil)
 	assertRunningRejectedPolicyRequirement(t, res, err)
+
+	defer withBaseLayerImageDirs(t, map[string]string{
+		"docker.io/testing/manifest:latest":  "fixtures/dir-img-valid",
+		"docker.io/testing/unsigned:latest":  "fixtures/dir-img-unsigned",
+		"docker.io/testing/recursive:latest": "fixtures/dir-img-valid",
+	})()
+	baseManifestBlob, err := ioutil.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	baseManifest, err := manifest.Schema2FromManifest(baseManifestBlob)
+	require.NoError(t, err)
+	baseLayers := []digest.Digest{}
+	for _, layer := range baseManifest.LayerInfos() {
+		baseLayers = append(baseLayers, layer.Digest)
+	}
+	const extraLayer = digest.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+				},
+				"docker.io/testing/unsigned:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+				},
+				"docker.io/testing/recursive": {
+					xNewPRSignedBaseLayer(xNewPRMExactReference("docker.io/testing/recursive:latest")),
+				},
+				"docker.io/testing/derived:valid": {
+					xNewPRSignedBaseLayer(xNewPRMExactReference("docker.io/testing/manifest:latest")),
+				},
+				"docker.io/testing/derived:unsigned": {
+					xNewPRSignedBaseLayer(xNewPRMExactReference("docker.io/testing/unsigned:latest")),
+				},
+				"docker.io/testing/derived:recursive": {
+					xNewPRSignedBaseLayer(xNewPRMExactReference("docker.io/testing/recursive:latest")),
+				},
+				"docker.io/testing/derived:repository": {
+					xNewPRSignedBaseLayer(xNewPRMExactRepository("docker.io/testing/manifest")),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer pc.Destroy()
+
+	// Success
+	for _, layers := range [][]digest.Digest{
+		append(append([]digest.Digest{}, baseLayers...), extraLayer),
+		baseLayers,
+	} {
+		img := baseLayerImageMockWithLayers(t, "testing/derived:valid", layers)
+		res, err := pc.IsRunningImageAllowed(context.Background(), img)
+		assertRunningAllowed(t, res, err)
+	}
+
+	// Not based on the base image
+	for _, layers := range [][]digest.Digest{
+		{extraLayer},
+		append([]digest.Digest{extraLayer}, baseLayers...),
+		baseLayers[:len(baseLayers)-1],
+	} {
+		img := baseLayerImageMockWithLayers(t, "testing/derived:valid", layers)
+		res, err := pc.IsRunningImageAllowed(context.Background(), img)
+		assertRunningRejectedPolicyRequirement(t, res, err)
+		assert.Equal(t, PolicyRejectionReasonIdentityMismatch, policyRejectionReason(err))
+	}
+
+	// Base image rejected by policy
+	img := baseLayerImageMockWithLayers(t, "testing/derived:unsigned", baseLayers)
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assert.Equal(t, PolicyRejectionReasonNoSignatures, policyRejectionReason(err))
+
+	// Base image requiring itself
+	img = baseLayerImageMockWithLayers(t, "testing/derived:recursive", baseLayers)
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+
+	// baseLayerIdentity which does not identify a single base image
+	img = baseLayerImageMockWithLayers(t, "testing/derived:repository", baseLayers)
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+}
+
+func TestPRSignedBaseLayerManifestList(t *testing.T) {
+	baseInstance := baseLayerImageMockWithLayers(t, "testing/list:latest", []digest.Digest{
+		"sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		"sha256:2222222222222222222222222222222222222222222222222222222222222222",
+	})
+	otherInstance := baseLayerImageMockWithLayers(t, "testing/list:latest", []digest.Digest{
+		"sha256:3333333333333333333333333333333333333333333333333333333333333333",
+	})
+	listEntries := []string{}
+	listDir, err := ioutil.TempDir("", "baselayer-list")
+	require.NoError(t, err)
+	defer os.RemoveAll(listDir)
+	listRef, err := directory.NewReference(listDir)
+	require.NoError(t, err)
+	dest, err := listRef.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	for arch, img := range map[string]types.UnparsedImage{"arm64": baseInstance, "amd64": otherInstance} {
+		m, _, err := img.Manifest(context.Background())
+		require.NoError(t, err)
+		err = dest.(types.ManifestListDestination).PutInstanceManifest(context.Background(), m, manifest.DockerV2Schema2MediaType, digest.FromBytes(m))
+		require.NoError(t, err)
+		listEntries = append(listEntries, fmt.Sprintf(`{"mediaType":"%s","size":%d,"digest":"%s","platform":{"architecture":"%s","os":"linux"}}`,
+			manifest.DockerV2Schema2MediaType, len(m), digest.FromBytes(m), arch))
+	}
+	list := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[%s]}`, manifest.DockerV2ListMediaType, strings.Join(listEntries, ","))
+	err = dest.(types.ManifestMIMETypeDestination).PutManifestWithMIMEType(context.Background(), []byte(list), manifest.DockerV2ListMediaType)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background())
+	require.NoError(t, err)
+
+	defer withBaseLayerImageDirs(t, map[string]string{"docker.io/testing/list:latest": listDir})()
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/list:latest": {NewPRInsecureAcceptAnything()},
+				"docker.io/testing/derived": {
+					xNewPRSignedBaseLayer(xNewPRMExactReference("docker.io/testing/list:latest")),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer pc.Destroy()
+
+	// The layers of the instance for the platform in PolicyContext.SystemContext are used.
+	baseManifest, _, err := baseInstance.Manifest(context.Background())
+	require.NoError(t, err)
+	otherManifest, _, err := otherInstance.Manifest(context.Background())
+	require.NoError(t, err)
+	for _, c := range []struct {
+		arch          string
+		layersFrom    []byte
+		shouldSucceed bool
+	}{
+		{"arm64", baseManifest, true},
+		{"arm64", otherManifest, false},
+		{"amd64", otherManifest, true},
+		{"amd64", baseManifest, false},
+	} {
+		pc.SystemContext = &types.SystemContext{ArchitectureChoice: c.arch, OSChoice: "linux"}
+		m, err := manifest.Schema2FromManifest(c.layersFrom)
+		require.NoError(t, err)
+		layers := []digest.Digest{}
+		for _, layer := range m.LayerInfos() {
+			layers = append(layers, layer.Digest)
+		}
+		img := baseLayerImageMockWithLayers(t, "testing/derived:latest", append(layers, "sha256:4444444444444444444444444444444444444444444444444444444444444444"))
+		res, err := pc.IsRunningImageAllowed(context.Background(), img)
+		if c.shouldSucceed {
+			assertRunningAllowed(t, res, err)
+		} else {
+			assertRunningRejectedPolicyRequirement(t, res, err)
+		}
+	}
+
+	// No instance for the platform
+	pc.SystemContext = &types.SystemContext{ArchitectureChoice: "s390x", OSChoice: "linux"}
+	img := baseLayerImageMockWithLayers(t, "testing/derived:latest", []digest.Digest{"sha256:1111111111111111111111111111111111111111111111111111111111111111"})
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejected(t, res, err)
 }
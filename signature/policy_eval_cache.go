@@ -0,0 +1,103 @@
+// Caching of accepted signatures within a PolicyContext.
+
+package signature
+
+import (
+	"context"
+
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// maxAcceptedSignatureCacheEntries is the maximum number of entries in PolicyContext.acceptedSignatures;
+// when it is reached, the cache is emptied.
+const maxAcceptedSignatureCacheEntries = 1024
+
+// acceptedSignatureCacheKey identifies a signature accepted by a requirement in PolicyContext.acceptedSignatures.
+// The requirement identifies the policy scope as well; a PolicyContext’s Policy must not be modified while the context is in use.
+// The acceptance depends on the identity of the image (e.g. via signedIdentity), so it is a part of the key as well.
+type acceptedSignatureCacheKey struct {
+	requirement     PolicyRequirement
+	imageIdentity   string
+	manifestDigest  digest.Digest
+	signatureDigest digest.Digest
+}
+
+// cacheImageIdentity returns a string identifying ref, for use in acceptedSignatureCacheKey.
+func cacheImageIdentity(ref types.ImageReference) string {
+	res := transports.ImageName(ref)
+	if dockerRef := ref.DockerReference(); dockerRef != nil {
+		res += " " + dockerRef.String()
+	}
+	return res
+}
+
+// signatureAcceptanceIsCacheable returns true if an acceptance of a signature by req can be reused for later
+// evaluations of the same signature and manifest, i.e. if it does not depend on the current time.
+func signatureAcceptanceIsCacheable(req PolicyRequirement) bool {
+	switch pr := req.(type) {
+	case *prSignedBy:
+		// X.509 certificates are verified at the current time.
+		return pr.KeyType != SBKeyTypeSignedByX509CAs && pr.MaxSignatureAgeSeconds == 0 && !pr.RejectExpiredSignatures
+	case *prSignedByThreshold, *prSigstoreSigned:
+		return true
+	default:
+		return false
+	}
+}
+
+// isSignatureAuthorAcceptedCached returns the result of req.isSignatureAuthorAccepted(ctx, image, sig), reusing
+// a previous acceptance of the same signature of the same manifest by req, within the PolicyContext evaluating ctx, if any.
+// Nothing is cached when a custom SigningMechanismFactory is used, because it may change between evaluations.
+func isSignatureAuthorAcceptedCached(ctx context.Context, req PolicyRequirement, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	pc := policyContextFromContext(ctx)
+	if pc == nil || ctx.Value(signingMechanismFactoryKey{}) != nil || !signatureAcceptanceIsCacheable(req) {
+		return req.isSignatureAuthorAccepted(ctx, image, sig)
+	}
+	manifest, _, err := image.Manifest(ctx)
+	if err != nil {
+		// Let the requirement report the error.
+		return req.isSignatureAuthorAccepted(ctx, image, sig)
+	}
+	key := acceptedSignatureCacheKey{
+		requirement:     req,
+		imageIdentity:   cacheImageIdentity(image.Reference()),
+		manifestDigest:  digest.FromBytes(manifest),
+		signatureDigest: digest.FromBytes(sig),
+	}
+
+	if cached := pc.cachedAcceptedSignature(key); cached != nil {
+		logrus.Debugf(" Using a cached acceptance of signature %s", key.signatureDigest)
+		return sarAccepted, cached, nil
+	}
+	res, signature, err := req.isSignatureAuthorAccepted(ctx, image, sig)
+	if res == sarAccepted && signature != nil {
+		pc.cacheAcceptedSignature(key, signature)
+	}
+	return res, signature, err
+}
+
+// cachedAcceptedSignature returns a copy of the signature recorded for key, or nil if there is none.
+func (pc *PolicyContext) cachedAcceptedSignature(key acceptedSignatureCacheKey) *Signature {
+	pc.acceptedSignaturesLock.Lock()
+	defer pc.acceptedSignaturesLock.Unlock()
+	signature, ok := pc.acceptedSignatures[key]
+	if !ok {
+		return nil
+	}
+	res := *signature // Don't let callers modify the cached value.
+	return &res
+}
+
+// cacheAcceptedSignature records that signature was accepted for key.
+func (pc *PolicyContext) cacheAcceptedSignature(key acceptedSignatureCacheKey, signature *Signature) {
+	pc.acceptedSignaturesLock.Lock()
+	defer pc.acceptedSignaturesLock.Unlock()
+	if pc.acceptedSignatures == nil || len(pc.acceptedSignatures) >= maxAcceptedSignatureCacheEntries {
+		pc.acceptedSignatures = map[acceptedSignatureCacheKey]*Signature{}
+	}
+	s := *signature
+	pc.acceptedSignatures[key] = &s
+}
@@ -0,0 +1,152 @@
+package signature
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureAcceptanceIsCacheable(t *testing.T) {
+	signedBy := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact())
+	withMaxAge := *signedBy.(*prSignedBy)
+	withMaxAge.MaxSignatureAgeSeconds = 3600
+	withRejectExpired := *signedBy.(*prSignedBy)
+	withRejectExpired.RejectExpiredSignatures = true
+	threshold, err := NewPRSignedByThreshold(1, []string{"fixtures/public-key.gpg"}, NewPRMMatchExact())
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		req      PolicyRequirement
+		expected bool
+	}{
+		{signedBy, true},
+		{&withMaxAge, false},
+		{&withRejectExpired, false},
+		{xNewPRSignedByKeyPath(SBKeyTypeSignedByX509CAs, "/path/to/ca.pem", NewPRMMatchExact()), false},
+		{threshold, true},
+		{xNewPRSigstoreSignedKeyPath("/path/to/cosign.pub", NewPRMMatchExact()), true},
+		{NewPRInsecureAcceptAnything(), false},
+		{NewPRReject(), false},
+	} {
+		assert.Equal(t, c.expected, signatureAcceptanceIsCacheable(c.req), "%#v", c.req)
+	}
+}
+
+func TestPolicyContextAcceptedSignatureCache(t *testing.T) {
+	signedBy := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact())
+	withMaxAge := *signedBy.(*prSignedBy)
+	withMaxAge.MaxSignatureAgeSeconds = 100 * 365 * 24 * 3600
+	withMaxAge.SignedIdentity = NewPRMMatchRepository()
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {signedBy},
+				"docker.io/testing/manifest:maxAge": {&withMaxAge},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer pc.Destroy()
+
+	img, closer := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	require.Len(t, pc.acceptedSignatures, 1)
+	var key acceptedSignatureCacheKey
+	for k := range pc.acceptedSignatures {
+		key = k
+	}
+	assert.Equal(t, signedBy, key.requirement)
+	assert.Equal(t, "docker:== StringWithinTransport mock docker.io/testing/manifest:latest", key.imageIdentity)
+	assert.Equal(t, TestImageManifestDigest, key.manifestDigest)
+
+	// A cached acceptance is used instead of verifying the signature again;
+	// the returned value is a copy of the cached one.
+	pc.acceptedSignatures[key].DockerReference = "cached/reference:latest"
+	sigs, err := pc.GetSignaturesWithAcceptedAuthor(context.Background(), img)
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	assert.Equal(t, "cached/reference:latest", sigs[0].DockerReference)
+	sigs[0].DockerReference = "modified/by:caller"
+	assert.Equal(t, "cached/reference:latest", pc.acceptedSignatures[key].DockerReference)
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	assert.Len(t, pc.acceptedSignatures, 1)
+
+	// Acceptances which depend on the current time are not cached
+	img2, closer2 := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:maxAge")
+	defer closer2()
+	sigs, err = pc.GetSignaturesWithAcceptedAuthor(context.Background(), img2)
+	require.NoError(t, err)
+	assert.Len(t, sigs, 1)
+	assert.Len(t, pc.acceptedSignatures, 1)
+
+	// Nothing is cached when using a custom SigningMechanismFactory
+	pc.acceptedSignatures = nil
+	pc.SigningMechanismFactory = newEphemeralGPGSigningMechanism
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	assert.Empty(t, pc.acceptedSignatures)
+	pc.SigningMechanismFactory = nil
+
+	// Rejections are not cached
+	img3, closer3 := pcImageMock(t, "fixtures/dir-img-modified-manifest", "testing/manifest:latest")
+	defer closer3()
+	res, err = pc.IsRunningImageAllowed(context.Background(), img3)
+	assertRunningRejected(t, res, err)
+	assert.Empty(t, pc.acceptedSignatures)
+}
+
+func TestPolicyContextAcceptedSignatureCacheImageIdentity(t *testing.T) {
+	// The same requirement applies to two references with the same manifest; the signature only matches one of them.
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact())},
+	})
+	require.NoError(t, err)
+	defer pc.Destroy()
+
+	img, closer := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	otherImg, otherCloser := pcImageMock(t, "fixtures/dir-img-valid", "attacker/repo:latest")
+	defer otherCloser()
+
+	res, err := pc.IsRunningImageAllowed(context.Background(), otherImg)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	assert.Len(t, pc.acceptedSignatures, 1)
+	// The acceptance for img is not reused for otherImg.
+	res, err = pc.IsRunningImageAllowed(context.Background(), otherImg)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+}
+
+func TestPolicyContextCacheAcceptedSignature(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}})
+	require.NoError(t, err)
+	req := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact())
+
+	// The cache is emptied when it is full
+	for i := 0; i < maxAcceptedSignatureCacheEntries; i++ {
+		pc.cacheAcceptedSignature(acceptedSignatureCacheKey{
+			requirement:     req,
+			manifestDigest:  TestImageManifestDigest,
+			signatureDigest: digest.FromBytes([]byte{byte(i), byte(i >> 8)}),
+		}, &Signature{DockerManifestDigest: TestImageManifestDigest})
+	}
+	assert.Len(t, pc.acceptedSignatures, maxAcceptedSignatureCacheEntries)
+	key := acceptedSignatureCacheKey{requirement: req, manifestDigest: TestImageManifestDigest, signatureDigest: digest.FromString("last")}
+	pc.cacheAcceptedSignature(key, &Signature{DockerReference: "last/reference:latest"})
+	assert.Len(t, pc.acceptedSignatures, 1)
+	assert.Equal(t, &Signature{DockerReference: "last/reference:latest"}, pc.cachedAcceptedSignature(key))
+	assert.Nil(t, pc.cachedAcceptedSignature(acceptedSignatureCacheKey{requirement: req}))
+
+	// Destroy empties the cache
+	err = pc.Destroy()
+	require.NoError(t, err)
+	assert.Nil(t, pc.acceptedSignatures)
+}
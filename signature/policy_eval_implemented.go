@@ -0,0 +1,99 @@
+// Checking that all requirements of a policy can be evaluated.
+
+package signature
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// checkPolicyImplemented returns an InvalidPolicyFormatError if policy contains requirements or identity matches
+// which this implementation can not evaluate.
+func checkPolicyImplemented(policy *Policy) error {
+	if policy == nil {
+		return InvalidPolicyFormatError("No policy specified")
+	}
+	if err := checkPolicyRequirementsImplemented(policy.Default); err != nil {
+		return InvalidPolicyFormatError(fmt.Sprintf("Default policy: %v", err))
+	}
+	transportNames := make([]string, 0, len(policy.Transports))
+	for transportName := range policy.Transports {
+		transportNames = append(transportNames, transportName)
+	}
+	sort.Strings(transportNames)
+	for _, transportName := range transportNames {
+		transportScopes := policy.Transports[transportName]
+		scopes := make([]string, 0, len(transportScopes))
+		for scope := range transportScopes {
+			scopes = append(scopes, scope)
+		}
+		sort.Strings(scopes)
+		for _, scope := range scopes {
+			if err := checkPolicyRequirementsImplemented(transportScopes[scope]); err != nil {
+				return InvalidPolicyFormatError(fmt.Sprintf("Policy for transport %q scope %q: %v", transportName, scope, err))
+			}
+		}
+	}
+	return nil
+}
+
+// checkPolicyRequirementsImplemented returns an error if any of reqs can not be evaluated.
+func checkPolicyRequirementsImplemented(reqs PolicyRequirements) error {
+	for i, req := range reqs {
+		if err := checkPolicyRequirementImplemented(req); err != nil {
+			return errors.Errorf("Requirement %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// checkPolicyRequirementImplemented returns an error if req can not be evaluated.
+func checkPolicyRequirementImplemented(req PolicyRequirement) error {
+	switch pr := req.(type) {
+	case *prInsecureAcceptAnything, *prReject:
+		return nil
+	case *prSignedBy:
+		switch pr.KeyType {
+		case SBKeyTypeGPGKeys, SBKeyTypeSignedByX509CAs:
+		case SBKeyTypeSignedByGPGKeys, SBKeyTypeX509Certificates:
+			return errors.Errorf(`Unimplemented "keyType" value "%s"`, string(pr.KeyType))
+		default:
+			return errors.Errorf(`Unknown "keyType" value "%s"`, string(pr.KeyType))
+		}
+		return checkPolicyReferenceMatchImplemented(pr.SignedIdentity)
+	case *prSignedBaseLayer:
+		if err := checkPolicyReferenceMatchImplemented(pr.BaseLayerIdentity); err != nil {
+			return err
+		}
+		// Evaluation needs to locate a single base image; see prSignedBaseLayer.baseImageReference.
+		if _, ok := pr.BaseLayerIdentity.(*prmExactReference); !ok {
+			return errors.Errorf(`Unimplemented "baseLayerIdentity" %T, only %q is supported`, pr.BaseLayerIdentity, prmTypeExactReference)
+		}
+		return nil
+	case *prSigstoreSigned:
+		return checkPolicyReferenceMatchImplemented(pr.SignedIdentity)
+	case *prSignedByThreshold:
+		return checkPolicyReferenceMatchImplemented(pr.SignedIdentity)
+	case *prNotationSigned:
+		return nil
+	case *prNotarySigned:
+		if !notarySupported {
+			return errors.New(`"notarySigned" requirements are only supported when built with the containers_image_notary build tag`)
+		}
+		return nil
+	default:
+		return errors.Errorf("Unknown policy requirement type %T", req)
+	}
+}
+
+// checkPolicyReferenceMatchImplemented returns an error if prm can not be evaluated.
+func checkPolicyReferenceMatchImplemented(prm PolicyReferenceMatch) error {
+	switch prm.(type) {
+	case *prmMatchExact, *prmMatchRepoDigestOrExact, *prmMatchRepository, *prmExactReference, *prmExactRepository, *prmRemapIdentity:
+		return nil
+	default:
+		return errors.Errorf("Unknown policy reference match type %T", prm)
+	}
+}
@@ -0,0 +1,106 @@
+package signature
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicyContextWithOptions(t *testing.T) {
+	unimplemented := xNewPRSignedByKeyPath(SBKeyTypeX509Certificates, "/path/to/certs", NewPRMMatchExact())
+	policy := &Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest": {unimplemented},
+			},
+		},
+	}
+
+	// Unimplemented requirements are accepted by default
+	for _, options := range []*PolicyContextOptions{nil, {}} {
+		pc, err := NewPolicyContextWithOptions(policy, options)
+		require.NoError(t, err)
+		err = pc.Destroy()
+		require.NoError(t, err)
+	}
+
+	// … and rejected with RejectUnimplementedRequirements
+	_, err := NewPolicyContextWithOptions(policy, &PolicyContextOptions{RejectUnimplementedRequirements: true})
+	require.Error(t, err)
+	assert.IsType(t, InvalidPolicyFormatError(""), err)
+	assert.Contains(t, err.Error(), `"docker.io/testing/manifest"`)
+
+	policy.Transports["docker"]["docker.io/testing/manifest"] = PolicyRequirements{
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+	}
+	pc, err := NewPolicyContextWithOptions(policy, &PolicyContextOptions{RejectUnimplementedRequirements: true})
+	require.NoError(t, err)
+	err = pc.Destroy()
+	require.NoError(t, err)
+}
+
+func TestCheckPolicyImplemented(t *testing.T) {
+	threshold, err := NewPRSignedByThreshold(1, []string{"fixtures/public-key.gpg"}, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	exactReference, err := NewPRMExactReference("docker.io/library/busybox:latest")
+	require.NoError(t, err)
+	exactRepository, err := NewPRMExactRepository("docker.io/library/busybox")
+	require.NoError(t, err)
+	remapIdentity, err := NewPRMRemapIdentity("example.com", "docker.io")
+	require.NoError(t, err)
+	baseLayer, err := NewPRSignedBaseLayer(exactReference)
+	require.NoError(t, err)
+	implemented := PolicyRequirements{
+		NewPRInsecureAcceptAnything(),
+		NewPRReject(),
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+		xNewPRSignedByKeyPath(SBKeyTypeSignedByX509CAs, "/path/to/ca.pem", exactReference),
+		baseLayer,
+		xNewPRSigstoreSignedKeyPath("/path/to/cosign.pub", exactRepository),
+		xNewPRSigstoreSignedKeyPath("/path/to/cosign.pub", remapIdentity),
+		threshold,
+	}
+	err = checkPolicyImplemented(&Policy{
+		Default:    implemented,
+		Transports: map[string]PolicyTransportScopes{"docker": {"": implemented}},
+	})
+	assert.NoError(t, err)
+
+	err = checkPolicyImplemented(nil)
+	assert.IsType(t, InvalidPolicyFormatError(""), err)
+
+	withNilIdentity := *implemented[2].(*prSignedBy)
+	withNilIdentity.SignedIdentity = nil
+	withInvalidKeyType := *implemented[2].(*prSignedBy)
+	withInvalidKeyType.KeyType = "this is invalid"
+	for _, req := range []PolicyRequirement{
+		xNewPRSignedByKeyPath(SBKeyTypeSignedByGPGKeys, "/path/to/keys", NewPRMMatchExact()),
+		xNewPRSignedByKeyPath(SBKeyTypeX509Certificates, "/path/to/certs", NewPRMMatchExact()),
+		&withInvalidKeyType,
+		&withNilIdentity,
+		&prSignedBaseLayer{prCommon: prCommon{Type: prTypeSignedBaseLayer}},
+		// signedBaseLayer can only locate a base image using exactReference
+		xNewPRSignedBaseLayer(NewPRMMatchRepository()),
+		xNewPRSignedBaseLayer(exactRepository),
+		xNewPRSignedBaseLayer(remapIdentity),
+		nil,
+	} {
+		err := checkPolicyImplemented(&Policy{Default: PolicyRequirements{NewPRReject(), req}})
+		assert.IsType(t, InvalidPolicyFormatError(""), err, "%#v", req)
+		err = checkPolicyImplemented(&Policy{
+			Default:    PolicyRequirements{NewPRReject()},
+			Transports: map[string]PolicyTransportScopes{"docker": {"docker.io": {req}}},
+		})
+		assert.IsType(t, InvalidPolicyFormatError(""), err, "%#v", req)
+	}
+
+	// notarySigned can only be evaluated if built with the containers_image_notary build tag
+	err = checkPolicyImplemented(&Policy{Default: PolicyRequirements{xNewPRNotarySigned("", "/var/lib/notary")}})
+	if notarySupported {
+		assert.NoError(t, err)
+	} else {
+		assert.IsType(t, InvalidPolicyFormatError(""), err)
+	}
+}
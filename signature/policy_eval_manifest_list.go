@@ -0,0 +1,119 @@
+// Policy evaluation of signatures of manifest lists.
+
+package signature
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// unparsedImageWithManifestList is implemented by types.UnparsedImage implementations which may represent
+// a single instance selected from a manifest list, e.g. *image.UnparsedImage.
+type unparsedImageWithManifestList interface {
+	types.UnparsedImage
+	// ManifestList returns the manifest list from which this instance was selected, or nil if it was not selected from a manifest list.
+	ManifestList() types.UnparsedImage
+}
+
+// imageSignature is a signature to verify, along with the image it should be verified against.
+type imageSignature struct {
+	image     types.UnparsedImage
+	signature []byte
+}
+
+// imageSignatures returns the signatures which may be used to accept image: its own signatures, and, if image was selected
+// from a manifest list, signatures of the manifest list.
+func imageSignatures(ctx context.Context, image types.UnparsedImage) ([]imageSignature, error) {
+	sigs, err := image.Signatures(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := []imageSignature{}
+	for _, sig := range sigs {
+		res = append(res, imageSignature{image: image, signature: sig})
+	}
+
+	withList, ok := image.(unparsedImageWithManifestList)
+	if !ok {
+		return res, nil
+	}
+	list := withList.ManifestList()
+	if list == nil {
+		return res, nil
+	}
+	listSigs, err := list.Signatures(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listImage := &manifestListSignatureImage{instance: image, list: list}
+	for _, sig := range listSigs {
+		res = append(res, imageSignature{image: listImage, signature: sig})
+	}
+	return res, nil
+}
+
+// manifestListSignatureImage is a types.UnparsedImage used to verify signatures of a manifest list as signatures of an instance:
+// it has the identity of the instance, and the signatures and manifest of the list, but it only returns the manifest
+// if the list contains the instance.
+type manifestListSignatureImage struct {
+	instance types.UnparsedImage
+	list     types.UnparsedImage
+}
+
+func (img *manifestListSignatureImage) Reference() types.ImageReference {
+	return img.instance.Reference()
+}
+
+func (img *manifestListSignatureImage) Manifest(ctx context.Context) ([]byte, string, error) {
+	instanceManifest, _, err := img.instance.Manifest(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	listManifest, listMIMEType, err := img.list.Manifest(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if !manifest.MIMETypeIsMultiImage(listMIMEType) {
+		return nil, "", fmt.Errorf("Internal error: manifest list has a non-manifest-list MIME type %s", listMIMEType)
+	}
+	instanceDigests, err := manifestListInstanceDigests(listManifest)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, d := range instanceDigests {
+		matches, err := manifest.MatchesDigest(instanceManifest, d)
+		if err != nil {
+			return nil, "", err
+		}
+		if matches {
+			return listManifest, listMIMEType, nil
+		}
+	}
+	return nil, "", newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, "The manifest list does not contain the image")
+}
+
+func (img *manifestListSignatureImage) Signatures(ctx context.Context) ([][]byte, error) {
+	return img.list.Signatures(ctx)
+}
+
+// manifestListInstanceDigests returns the digests of all instances of a manifest list.
+func manifestListInstanceDigests(listManifest []byte) ([]digest.Digest, error) {
+	var list struct {
+		Manifests []struct {
+			Digest digest.Digest `json:"digest"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(listManifest, &list); err != nil {
+		return nil, err
+	}
+	res := []digest.Digest{}
+	for _, m := range list.Manifests {
+		res = append(res, m.Digest)
+	}
+	return res, nil
+}
@@ -0,0 +1,142 @@
+package signature
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containers/image/image"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Compile-time check that image.UnparsedImage allows evaluating signatures of manifest lists.
+var _ unparsedImageWithManifestList = (*image.UnparsedImage)(nil)
+
+// manifestListImageMock is a types.UnparsedImage for a manifest list, with specified signatures.
+type manifestListImageMock struct {
+	ref      types.ImageReference
+	manifest []byte
+	sigs     [][]byte
+}
+
+func (img manifestListImageMock) Reference() types.ImageReference {
+	return img.ref
+}
+func (img manifestListImageMock) Manifest(ctx context.Context) ([]byte, string, error) {
+	return img.manifest, manifest.DockerV2ListMediaType, nil
+}
+func (img manifestListImageMock) Signatures(ctx context.Context) ([][]byte, error) {
+	return img.sigs, nil
+}
+
+// manifestListInstanceMock is a types.UnparsedImage selected from a manifest list.
+type manifestListInstanceMock struct {
+	types.UnparsedImage
+	sigs [][]byte
+	list types.UnparsedImage
+}
+
+func (img manifestListInstanceMock) Signatures(ctx context.Context) ([][]byte, error) {
+	return img.sigs, nil
+}
+func (img manifestListInstanceMock) ManifestList() types.UnparsedImage {
+	return img.list
+}
+
+// manifestListTestManifest returns a manifest list blob containing instances.
+func manifestListTestManifest(t *testing.T, instances ...digest.Digest) []byte {
+	manifests := []mSI{}
+	for _, d := range instances {
+		manifests = append(manifests, mSI{
+			"mediaType": manifest.DockerV2Schema2MediaType,
+			"size":      1,
+			"digest":    d,
+			"platform":  mSI{"architecture": "amd64", "os": "linux"},
+		})
+	}
+	blob, err := json.Marshal(mSI{
+		"schemaVersion": 2,
+		"mediaType":     manifest.DockerV2ListMediaType,
+		"manifests":     manifests,
+	})
+	require.NoError(t, err)
+	return blob
+}
+
+func TestImageSignaturesWithManifestList(t *testing.T) {
+	ctx := context.WithValue(context.Background(), signingMechanismFactoryKey{}, SigningMechanismFactory(newKeyListMechanismMock))
+	instance, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	const otherDigest = digest.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	listBlob := manifestListTestManifest(t, otherDigest, TestImageManifestDigest)
+	listDigest, err := manifest.Digest(listBlob)
+	require.NoError(t, err)
+	unrelatedListBlob := manifestListTestManifest(t, otherDigest)
+	unrelatedListDigest, err := manifest.Digest(unrelatedListBlob)
+	require.NoError(t, err)
+	instanceSig := keyListTestSignature(t, "A", TestImageManifestDigest, "testing/manifest:latest")
+	listSig := keyListTestSignature(t, "A", listDigest, "testing/manifest:latest")
+	instanceFromList := func(instanceSigs [][]byte, listBlob []byte, listSigs [][]byte) types.UnparsedImage {
+		return manifestListInstanceMock{
+			UnparsedImage: instance,
+			sigs:          instanceSigs,
+			list:          manifestListImageMock{ref: instance.Reference(), manifest: listBlob, sigs: listSigs},
+		}
+	}
+
+	pr, err := NewPRSignedByKeyData(SBKeyTypeGPGKeys, []byte("A"), NewPRMMatchExact())
+	require.NoError(t, err)
+
+	// Signatures of the instance, or of the list, are accepted
+	for _, img := range []types.UnparsedImage{
+		instanceFromList([][]byte{instanceSig}, listBlob, [][]byte{}),
+		instanceFromList([][]byte{}, listBlob, [][]byte{listSig}),
+		instanceFromList([][]byte{}, listBlob, [][]byte{
+			keyListTestSignature(t, "B", listDigest, "testing/manifest:latest"),
+			listSig,
+		}),
+	} {
+		res, err := pr.isRunningImageAllowed(ctx, img)
+		assertRunningAllowed(t, res, err)
+	}
+
+	// Signatures of the list are rejected if the list does not match, or does not contain the instance
+	for _, img := range []types.UnparsedImage{
+		instanceFromList([][]byte{}, listBlob, [][]byte{keyListTestSignature(t, "A", otherDigest, "testing/manifest:latest")}),
+		instanceFromList([][]byte{}, unrelatedListBlob, [][]byte{keyListTestSignature(t, "A", unrelatedListDigest, "testing/manifest:latest")}),
+		instanceFromList([][]byte{}, unrelatedListBlob, [][]byte{instanceSig}),
+	} {
+		res, err := pr.isRunningImageAllowed(ctx, img)
+		assertRunningRejectedPolicyRequirement(t, res, err)
+		assert.Equal(t, PolicyRejectionReasonIdentityMismatch, policyRejectionReason(err))
+	}
+	// … or made by an untrusted key
+	res, err := pr.isRunningImageAllowed(ctx, instanceFromList([][]byte{}, listBlob, [][]byte{keyListTestSignature(t, "B", listDigest, "testing/manifest:latest")}))
+	assertRunningRejected(t, res, err)
+
+	// An instance with no signatures, in a list with no signatures
+	res, err = pr.isRunningImageAllowed(ctx, instanceFromList([][]byte{}, listBlob, [][]byte{}))
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assert.Equal(t, PolicyRejectionReasonNoSignatures, policyRejectionReason(err))
+
+	// An image not selected from a manifest list
+	res, err = pr.isRunningImageAllowed(ctx, manifestListInstanceMock{UnparsedImage: instance, sigs: [][]byte{listSig}})
+	assertRunningRejectedPolicyRequirement(t, res, err)
+
+	// imageSignatures returns signatures of both the instance and the list
+	img := instanceFromList([][]byte{instanceSig}, listBlob, [][]byte{listSig})
+	sigs, err := imageSignatures(ctx, img)
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+	assert.Equal(t, img, sigs[0].image)
+	assert.Equal(t, instanceSig, sigs[0].signature)
+	assert.IsType(t, &manifestListSignatureImage{}, sigs[1].image)
+	assert.Equal(t, listSig, sigs[1].signature)
+	m, _, err := sigs[1].image.Manifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, listBlob, m)
+}
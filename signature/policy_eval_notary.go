@@ -0,0 +1,92 @@
+// Policy evaluation for prNotarySigned.
+
+package signature
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultDockerHubNotaryServer is the Notary server used for docker.io images if prNotarySigned.Server is not set.
+const defaultDockerHubNotaryServer = "https://notary.docker.io"
+
+// notaryTarget is a target (i.e. a tag) recorded in the TUF metadata of a Notary repository.
+type notaryTarget struct {
+	hashes map[string][]byte // Indexed by TUF hash algorithm names, e.g. "sha256".
+	length int64
+}
+
+// lookupNotaryTarget returns the target for tag in the Notary repository for repo on server, accessed using sys,
+// after updating and verifying the TUF metadata stored in trustDir.
+// This is a variable only to allow tests to replace it.
+var lookupNotaryTarget = notaryLookupTarget
+
+func (pr *prNotarySigned) isSignatureAuthorAccepted(ctx context.Context, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	return sarUnknown, nil, nil
+}
+
+func (pr *prNotarySigned) isRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (bool, error) {
+	ref := image.Reference().DockerReference()
+	if ref == nil {
+		return false, PolicyRequirementError(fmt.Sprintf("Docker reference not available for %s, can not look it up in Notary", transports.ImageName(image.Reference())))
+	}
+	tagged, ok := ref.(reference.NamedTagged)
+	if !ok {
+		return false, PolicyRequirementError(fmt.Sprintf("Image %s is not referenced by a tag, which is required for looking it up in Notary", ref.String()))
+	}
+	repo := reference.TrimNamed(ref)
+	var sys *types.SystemContext
+	if pc := policyContextFromContext(ctx); pc != nil {
+		sys = pc.SystemContext
+	}
+
+	target, err := lookupNotaryTarget(ctx, sys, pr.notaryServer(repo), pr.TrustDir, repo, tagged.Tag())
+	if err != nil {
+		return false, err
+	}
+
+	m, _, err := image.Manifest(ctx)
+	if err != nil {
+		return false, err
+	}
+	if target.length != int64(len(m)) {
+		return false, newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, fmt.Sprintf("Notary trust data for %s does not match the image manifest size", ref.String()))
+	}
+	verified := false
+	for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+		hash, ok := target.hashes[algorithm.String()]
+		if !ok {
+			continue
+		}
+		matches, err := manifest.MatchesDigest(m, digest.NewDigestFromBytes(algorithm, hash))
+		if err != nil {
+			return false, err
+		}
+		if !matches {
+			return false, newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, fmt.Sprintf("Notary trust data for %s does not match the image manifest digest", ref.String()))
+		}
+		verified = true
+	}
+	if !verified {
+		return false, newPolicyRequirementError(PolicyRejectionReasonInvalidSignature, fmt.Sprintf("Notary trust data for %s does not contain a supported manifest digest", ref.String()))
+	}
+	return true, nil
+}
+
+// notaryServer returns the URL of the Notary server to use for repo.
+func (pr *prNotarySigned) notaryServer(repo reference.Named) string {
+	if pr.Server != "" {
+		return pr.Server
+	}
+	domain := reference.Domain(repo)
+	if domain == "docker.io" {
+		return defaultDockerHubNotaryServer
+	}
+	return "https://" + domain
+}
@@ -0,0 +1,135 @@
+package signature
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/containers/image/directory"
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notaryLookupMock records the parameters of a lookupNotaryTarget call.
+type notaryLookupMock struct {
+	server, trustDir, repo, tag string
+}
+
+// withNotaryTarget replaces lookupNotaryTarget to return target and err, recording the parameters in a returned notaryLookupMock,
+// and returns a function restoring the original value.
+func withNotaryTarget(target *notaryTarget, err error) (*notaryLookupMock, func()) {
+	mock := &notaryLookupMock{}
+	original := lookupNotaryTarget
+	lookupNotaryTarget = func(ctx context.Context, sys *types.SystemContext, server, trustDir string, repo reference.Named, tag string) (*notaryTarget, error) {
+		mock.server, mock.trustDir, mock.repo, mock.tag = server, trustDir, repo.Name(), tag
+		return target, err
+	}
+	return mock, func() { lookupNotaryTarget = original }
+}
+
+func TestPRNotarySignedIsSignatureAuthorAccepted(t *testing.T) {
+	pr, err := NewPRNotarySigned("", "/var/lib/notary")
+	require.NoError(t, err)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARUnknown(t, sar, parsedSig, err)
+}
+
+func TestPRNotarySignedIsRunningImageAllowed(t *testing.T) {
+	manifestBlob, err := ioutil.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	manifestSHA256 := sha256.Sum256(manifestBlob)
+	validTarget := &notaryTarget{hashes: map[string][]byte{"sha256": manifestSHA256[:]}, length: int64(len(manifestBlob))}
+	imageWithReference := func(dockerReference string) types.UnparsedImage {
+		ref, err := reference.ParseNormalizedNamed(dockerReference)
+		require.NoError(t, err)
+		return baseLayerImageMock{ref: pcImageReferenceMock{"docker", ref}, manifest: manifestBlob}
+	}
+
+	// Success
+	for _, c := range []struct {
+		server, dockerReference                   string
+		expectedServer, expectedRepo, expectedTag string
+	}{
+		{"", "busybox:latest", "https://notary.docker.io", "docker.io/library/busybox", "latest"},
+		{"", "example.com/ns/repo:1.0", "https://example.com", "example.com/ns/repo", "1.0"},
+		{"https://notary.example.com", "example.com/ns/repo:1.0", "https://notary.example.com", "example.com/ns/repo", "1.0"},
+		{"", "example.com/ns/repo:1.0@" + digest.FromBytes(manifestBlob).String(), "https://example.com", "example.com/ns/repo", "1.0"},
+	} {
+		pr, err := NewPRNotarySigned(c.server, "/var/lib/notary")
+		require.NoError(t, err)
+		mock, restore := withNotaryTarget(validTarget, nil)
+		allowed, err := pr.isRunningImageAllowed(context.Background(), imageWithReference(c.dockerReference))
+		restore()
+		assertRunningAllowed(t, allowed, err)
+		assert.Equal(t, notaryLookupMock{server: c.expectedServer, trustDir: "/var/lib/notary", repo: c.expectedRepo, tag: c.expectedTag}, *mock)
+	}
+
+	pr, err := NewPRNotarySigned("", "/var/lib/notary")
+	require.NoError(t, err)
+
+	// All supported hashes must match
+	sha512Digest := digest.SHA512.FromBytes(manifestBlob)
+	for _, c := range []struct {
+		hashes  map[string][]byte
+		allowed bool
+	}{
+		{map[string][]byte{"sha256": manifestSHA256[:], "sha512": digestBytes(t, sha512Digest)}, true},
+		{map[string][]byte{"sha512": digestBytes(t, sha512Digest)}, true},
+		{map[string][]byte{"sha256": manifestSHA256[:], "sha512": digestBytes(t, digest.SHA512.FromString("other"))}, false},
+		{map[string][]byte{"sha256": digestBytes(t, digest.FromString("other"))}, false},
+		{map[string][]byte{"md5": manifestSHA256[:16]}, false},
+		{map[string][]byte{}, false},
+	} {
+		_, restore := withNotaryTarget(&notaryTarget{hashes: c.hashes, length: int64(len(manifestBlob))}, nil)
+		allowed, err := pr.isRunningImageAllowed(context.Background(), imageWithReference("busybox:latest"))
+		restore()
+		if c.allowed {
+			assertRunningAllowed(t, allowed, err)
+		} else {
+			assertRunningRejectedPolicyRequirement(t, allowed, err)
+		}
+	}
+
+	// Size mismatch
+	_, restore := withNotaryTarget(&notaryTarget{hashes: validTarget.hashes, length: validTarget.length + 1}, nil)
+	allowed, err := pr.isRunningImageAllowed(context.Background(), imageWithReference("busybox:latest"))
+	restore()
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// Lookup failure
+	lookupErr := errors.New("lookup failed")
+	_, restore = withNotaryTarget(nil, lookupErr)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), imageWithReference("busybox:latest"))
+	restore()
+	assert.False(t, allowed)
+	assert.Equal(t, lookupErr, err)
+
+	// Images not referenced by a tag can not be looked up
+	mock, restore := withNotaryTarget(validTarget, nil)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), imageWithReference("busybox@"+digest.FromBytes(manifestBlob).String()))
+	restore()
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assert.Equal(t, notaryLookupMock{}, *mock)
+
+	// Images without a Docker reference can not be looked up
+	dirRef, err := directory.NewReference("fixtures/dir-img-valid")
+	require.NoError(t, err)
+	mock, restore = withNotaryTarget(validTarget, nil)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), baseLayerImageMock{ref: dirRef, manifest: manifestBlob})
+	restore()
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assert.Equal(t, notaryLookupMock{}, *mock)
+}
+
+// digestBytes returns the raw hash value of d.
+func digestBytes(t *testing.T, d digest.Digest) []byte {
+	res, err := hex.DecodeString(d.Hex())
+	require.NoError(t, err)
+	return res
+}
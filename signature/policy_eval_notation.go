@@ -0,0 +1,80 @@
+// Policy evaluation for prNotationSigned.
+
+package signature
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/pkg/errors"
+)
+
+func (pr *prNotationSigned) isSignatureAuthorAccepted(ctx context.Context, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	trustRoot, err := pr.prepareTrustRoot()
+	if err != nil {
+		return sarRejected, nil, err
+	}
+
+	if !IsNotationSignature(sig) {
+		return sarRejected, nil, PolicyRequirementError("Signature is not a Notation signature")
+	}
+	untrustedSig, err := ParseNotationSignature(sig)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	target, err := trustRoot.verifyNotationSignature(untrustedSig, time.Now())
+	if err != nil {
+		return sarRejected, nil, err
+	}
+
+	m, _, err := image.Manifest(ctx)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	digestMatches, err := manifest.MatchesDigest(m, target.Digest)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	if !digestMatches || target.Size != int64(len(m)) {
+		return sarRejected, nil, newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, fmt.Sprintf("Signature for digest %s does not match", target.Digest))
+	}
+	// Notation signatures do not claim any image name.
+	return sarAccepted, &Signature{DockerManifestDigest: target.Digest}, nil
+}
+
+func (pr *prNotationSigned) isRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (bool, error) {
+	return isRunningImageAllowedByAnySignature(ctx, image, pr)
+}
+
+// prepareTrustRoot creates a notationTrustRoot from pr.
+func (pr *prNotationSigned) prepareTrustRoot() (*notationTrustRoot, error) {
+	if pr.TrustStorePath != "" && pr.TrustStoreData != nil {
+		return nil, errors.New(`Internal inconsistency: both "trustStorePath" and "trustStoreData" specified`)
+	}
+	var trustStoreData []byte
+	if pr.TrustStoreData != nil {
+		trustStoreData = pr.TrustStoreData
+	} else {
+		d, err := ioutil.ReadFile(pr.TrustStorePath)
+		if err != nil {
+			return nil, err
+		}
+		trustStoreData = d
+	}
+	trustStore, err := newX509CertPool([][]byte{trustStoreData})
+	if err != nil {
+		return nil, err
+	}
+	trustedIdentities, err := parseNotationTrustedIdentities(pr.TrustedIdentities)
+	if err != nil {
+		return nil, err
+	}
+	return &notationTrustRoot{
+		trustStore:        trustStore,
+		trustedIdentities: trustedIdentities,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package signature
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPRNotationSignedIsSignatureAuthorAccepted(t *testing.T) {
+	caCert, caKey, caPEM := x509TestCertificate(t, x509TestCATemplate("Notation CA"), nil, nil)
+	leafCert, leafKey, _ := x509TestCertificate(t, notationTestLeafTemplate(pkix.Name{Country: []string{"US"}, Organization: []string{"Example"}, CommonName: "Signer"}), caCert, caKey)
+	chain := []*x509.Certificate{leafCert}
+	manifest, err := ioutil.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	testImage, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	testImageSig := notationTestSignature(t, leafKey, chain, TestImageManifestDigest, int64(len(manifest)))
+
+	// Successful validation, with TrustStoreData and TrustStorePath
+	pr, err := NewPRNotationSignedTrustStoreData(caPEM, []string{"x509.subject: C=US, O=Example"})
+	require.NoError(t, err)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{DockerManifestDigest: TestImageManifestDigest})
+
+	trustStoreFile := writeTestFile(t, caPEM)
+	defer os.Remove(trustStoreFile)
+	pr, err = NewPRNotationSignedTrustStorePath(trustStoreFile, []string{"*"})
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{DockerManifestDigest: TestImageManifestDigest})
+
+	// Invalid trust store path or data
+	pr, err = NewPRNotationSignedTrustStorePath("/this/does/not/exist", []string{"*"})
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+	pr, err = NewPRNotationSignedTrustStoreData([]byte("this is not a certificate"), []string{"*"})
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	pr, err = NewPRNotationSignedTrustStoreData(caPEM, []string{"*"})
+	require.NoError(t, err)
+
+	// A simple signing signature
+	simpleSig, err := ioutil.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, simpleSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A signature of a different digest
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		notationTestSignature(t, leafKey, chain, "sha256:0000000000000000000000000000000000000000000000000000000000000000", int64(len(manifest))))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A signature with a different size
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		notationTestSignature(t, leafKey, chain, TestImageManifestDigest, int64(len(manifest))+1))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A signature by an untrusted certificate
+	otherCACert, otherCAKey, _ := x509TestCertificate(t, x509TestCATemplate("Other CA"), nil, nil)
+	otherLeafCert, otherLeafKey, _ := x509TestCertificate(t, notationTestLeafTemplate(pkix.Name{CommonName: "Signer"}), otherCACert, otherCAKey)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		notationTestSignature(t, otherLeafKey, []*x509.Certificate{otherLeafCert}, TestImageManifestDigest, int64(len(manifest))))
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Error reading the manifest
+	image, closer := dirImageMock(t, "fixtures/dir-img-no-manifest", "testing/manifest:latest")
+	defer closer()
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), image, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+}
+
+func TestPRNotationSignedIsRunningImageAllowed(t *testing.T) {
+	caCert, caKey, caPEM := x509TestCertificate(t, x509TestCATemplate("Notation CA"), nil, nil)
+	leafCert, leafKey, _ := x509TestCertificate(t, notationTestLeafTemplate(pkix.Name{CommonName: "Signer"}), caCert, caKey)
+	manifest, err := ioutil.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	validSig := notationTestSignature(t, leafKey, []*x509.Certificate{leafCert}, TestImageManifestDigest, int64(len(manifest)))
+	otherCACert, otherCAKey, _ := x509TestCertificate(t, x509TestCATemplate("Other CA"), nil, nil)
+	otherLeafCert, otherLeafKey, _ := x509TestCertificate(t, notationTestLeafTemplate(pkix.Name{CommonName: "Signer"}), otherCACert, otherCAKey)
+	untrustedSig := notationTestSignature(t, otherLeafKey, []*x509.Certificate{otherLeafCert}, TestImageManifestDigest, int64(len(manifest)))
+	pr, err := NewPRNotationSignedTrustStoreData(caPEM, []string{"*"})
+	require.NoError(t, err)
+
+	// A simple success case: single valid signature.
+	dir := createSigstoreSignedDir(t, validSig)
+	defer os.RemoveAll(dir)
+	image, closer := dirImageMock(t, dir, "testing/manifest:latest")
+	defer closer()
+	allowed, err := pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningAllowed(t, allowed, err)
+
+	// Notation signatures do not claim an identity, so any reference is accepted.
+	image, closer = dirImageMock(t, dir, "testing/manifest:notlatest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningAllowed(t, allowed, err)
+
+	// No signatures
+	image, closer = dirImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// Only simple signing signatures
+	image, closer = dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// One invalid, one valid signature (in this order)
+	simpleSig, err := ioutil.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	mixedDir := createSigstoreSignedDir(t, simpleSig, untrustedSig, validSig)
+	defer os.RemoveAll(mixedDir)
+	image, closer = dirImageMock(t, mixedDir, "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningAllowed(t, allowed, err)
+
+	// 2 invalid signatures
+	invalidDir := createSigstoreSignedDir(t, simpleSig, untrustedSig)
+	defer os.RemoveAll(invalidDir)
+	image, closer = dirImageMock(t, invalidDir, "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejected(t, allowed, err)
+}
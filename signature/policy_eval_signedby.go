@@ -4,9 +4,13 @@ package signature
 
 import (
 	"context"
+	"crypto"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -18,7 +22,9 @@ import (
 func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
 	switch pr.KeyType {
 	case SBKeyTypeGPGKeys:
-	case SBKeyTypeSignedByGPGKeys, SBKeyTypeX509Certificates, SBKeyTypeSignedByX509CAs:
+	case SBKeyTypeSignedByX509CAs:
+		return pr.isSignatureAuthorAcceptedByX509CAs(ctx, image, sig)
+	case SBKeyTypeSignedByGPGKeys, SBKeyTypeX509Certificates:
 		// FIXME? Reject this at policy parsing time already?
 		return sarRejected, nil, errors.Errorf(`"Unimplemented "keyType" value "%s"`, string(pr.KeyType))
 	default:
@@ -26,45 +32,100 @@ func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image types
 		return sarRejected, nil, errors.Errorf(`"Unknown "keyType" value "%s"`, string(pr.KeyType))
 	}
 
-	if pr.KeyPath != "" && pr.KeyData != nil {
-		return sarRejected, nil, errors.New(`Internal inconsistency: both "keyPath" and "keyData" specified`)
-	}
 	// FIXME: move this to per-context initialization
-	var data []byte
-	if pr.KeyData != nil {
-		data = pr.KeyData
-	} else {
-		d, err := ioutil.ReadFile(pr.KeyPath)
-		if err != nil {
-			return sarRejected, nil, err
+	data, err := pr.trustedKeyData()
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	mech, trustedIdentities, err := newTrustedGPGSigningMechanism(ctx, data)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	defer mech.Close()
+	if len(pr.KeyFingerprints) != 0 {
+		trustedIdentities = filterKeyIdentities(trustedIdentities, pr.KeyFingerprints)
+		if len(trustedIdentities) == 0 {
+			return sarRejected, nil, newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, "None of the keys with the required fingerprints were imported")
 		}
-		data = d
 	}
 
-	// FIXME: move this to per-context initialization
-	mech, trustedIdentities, err := NewEphemeralGPGSigningMechanism(data)
+	signature, _, err := verifyGPGSignatureForImage(ctx, mech, trustedIdentities, pr.SignedIdentity, pr.validateSignatureTimes, image, sig)
 	if err != nil {
 		return sarRejected, nil, err
 	}
-	defer mech.Close()
+	return sarAccepted, signature, nil
+}
+
+// filterKeyIdentities returns the elements of identities which are listed in fingerprints, ignoring case.
+func filterKeyIdentities(identities, fingerprints []string) []string {
+	res := []string{}
+	for _, identity := range identities {
+		for _, fingerprint := range fingerprints {
+			if strings.EqualFold(identity, fingerprint) {
+				res = append(res, identity)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// validateSignatureTimes rejects signatures created, or expiring, at timestamp and expiration, if they are not acceptable for pr.
+func (pr *prSignedBy) validateSignatureTimes(timestamp, expiration *time.Time) error {
+	now := time.Now()
+	if pr.MaxSignatureAgeSeconds != 0 {
+		if timestamp == nil {
+			return newPolicyRequirementError(PolicyRejectionReasonSignatureExpired, "Signature does not record its creation time, but a maximum signature age is required")
+		}
+		maxAge := time.Duration(pr.MaxSignatureAgeSeconds) * time.Second
+		if now.Sub(*timestamp) > maxAge {
+			return newPolicyRequirementError(PolicyRejectionReasonSignatureExpired,
+				fmt.Sprintf("Signature created at %s is older than the maximum age of %s", timestamp.UTC().Format(time.RFC3339), maxAge))
+		}
+	}
+	if pr.RejectExpiredSignatures && expiration != nil && !now.Before(*expiration) {
+		return newPolicyRequirementError(PolicyRejectionReasonSignatureExpired,
+			fmt.Sprintf("Signature expired at %s", expiration.UTC().Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// newTrustedGPGSigningMechanism returns a SigningMechanism which recognizes only the keys in keyData,
+// and the identities of these keys. It fails if keyData does not contain any keys.
+// The caller must call .Close() on the returned SigningMechanism.
+func newTrustedGPGSigningMechanism(ctx context.Context, keyData [][]byte) (SigningMechanism, []string, error) {
+	mech, trustedIdentities, err := signingMechanismFactoryFromContext(ctx)(keyData)
+	if err != nil {
+		return nil, nil, err
+	}
 	if len(trustedIdentities) == 0 {
-		return sarRejected, nil, PolicyRequirementError("No public keys imported")
+		mech.Close()
+		return nil, nil, newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, "No public keys imported")
 	}
+	return mech, trustedIdentities, nil
+}
 
+// verifyGPGSignatureForImage verifies that sig is a signature of image made, using mech, by one of trustedIdentities,
+// and claiming an identity accepted by signedIdentity; if validateSignatureTimes is not nil, it must accept the signature times.
+// It returns the verified signature contents and the identity of the signing key.
+func verifyGPGSignatureForImage(ctx context.Context, mech SigningMechanism, trustedIdentities []string, signedIdentity PolicyReferenceMatch,
+	validateSignatureTimes func(timestamp, expiration *time.Time) error, image types.UnparsedImage, sig []byte) (*Signature, string, error) {
+	var signingKeyIdentity string
 	signature, err := verifyAndExtractSignature(mech, sig, signatureAcceptanceRules{
 		validateKeyIdentity: func(keyIdentity string) error {
 			for _, trustedIdentity := range trustedIdentities {
 				if keyIdentity == trustedIdentity {
+					signingKeyIdentity = keyIdentity
 					return nil
 				}
 			}
-			// Coverage: We use a private GPG home directory and only import trusted keys, so this should
-			// not be reachable.
-			return PolicyRequirementError(fmt.Sprintf("Signature by key %s is not accepted", keyIdentity))
+			// We use a private GPG home directory and only import trusted keys, so this is only reachable
+			// if the imported keys were further restricted, e.g. using prSignedBy.KeyFingerprints.
+			return newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, fmt.Sprintf("Signature by key %s is not accepted", keyIdentity))
 		},
 		validateSignedDockerReference: func(ref string) error {
-			if !pr.SignedIdentity.matchesDockerReference(image, ref) {
-				return PolicyRequirementError(fmt.Sprintf("Signature for identity %s is not accepted", ref))
+			if !signedIdentity.matchesDockerReference(image, ref) {
+				return newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, fmt.Sprintf("Signature for identity %s is not accepted", ref))
 			}
 			return nil
 		},
@@ -78,28 +139,131 @@ func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image types
 				return err
 			}
 			if !digestMatches {
-				return PolicyRequirementError(fmt.Sprintf("Signature for digest %s does not match", digest))
+				return newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, fmt.Sprintf("Signature for digest %s does not match", digest))
 			}
 			return nil
 		},
+		validateSignatureTimes: validateSignatureTimes,
 	})
+	if err != nil {
+		return nil, "", err
+	}
+	return signature, signingKeyIdentity, nil
+}
+
+// isSignatureAuthorAcceptedByX509CAs is isSignatureAuthorAccepted for SBKeyTypeSignedByX509CAs.
+// The signature must be a sigstore signature with an attached X.509 certificate which chains to one of the
+// PEM-encoded CA certificates in the key sources of pr.
+func (pr *prSignedBy) isSignatureAuthorAcceptedByX509CAs(ctx context.Context, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	// FIXME: move this to per-context initialization
+	data, err := pr.trustedKeyData()
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	if len(data) == 0 {
+		return sarRejected, nil, newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, "No CA certificates imported")
+	}
+	roots, err := newX509CertPool(data)
 	if err != nil {
 		return sarRejected, nil, err
 	}
 
-	return sarAccepted, signature, nil
+	return isSigstoreSignatureAccepted(ctx, image, sig, pr.SignedIdentity, func(untrustedSig *SigstoreSignature) (crypto.PublicKey, error) {
+		untrustedCert, ok := untrustedSig.UntrustedAnnotations[SigstoreCertificateAnnotationKey]
+		if !ok {
+			return nil, PolicyRequirementError(fmt.Sprintf("Signature has no %s annotation", SigstoreCertificateAnnotationKey))
+		}
+		untrustedChain := untrustedSig.UntrustedAnnotations[SigstoreIntermediateCertificateChainAnnotationKey]
+		cert, err := verifyX509CertificateChain(roots, []byte(untrustedCert), []byte(untrustedChain), time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	})
+}
+
+// trustedKeyData returns the contents of all trusted key sources of pr, one blob per key file.
+func (pr *prSignedBy) trustedKeyData() ([][]byte, error) {
+	sources := 0
+	if pr.KeyPath != "" {
+		sources++
+	}
+	if pr.KeyPaths != nil {
+		sources++
+	}
+	if pr.KeyData != nil {
+		sources++
+	}
+	if sources > 1 {
+		return nil, errors.New(`Internal inconsistency: more than one of "keyPath", "keyPaths" and "keyData" specified`)
+	}
+
+	if pr.KeyData != nil {
+		return [][]byte{pr.KeyData}, nil
+	}
+	paths := pr.KeyPaths
+	if pr.KeyPath != "" {
+		paths = []string{pr.KeyPath}
+	}
+	res := [][]byte{}
+	for _, path := range paths {
+		data, err := readKeyPath(path)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data...)
+	}
+	return res, nil
+}
+
+// readKeyPath returns the contents of path, or of all regular files within path if it is a directory.
+// Hidden files within a directory are ignored.
+func readKeyPath(path string) ([][]byte, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{data}, nil
+	}
+
+	entries, err := ioutil.ReadDir(path) // Sorted by name
+	if err != nil {
+		return nil, err
+	}
+	res := [][]byte{}
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(path, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+	return res, nil
 }
 
 func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (bool, error) {
-	// FIXME: pass context.Context
-	sigs, err := image.Signatures(ctx)
+	return isRunningImageAllowedByAnySignature(ctx, image, pr)
+}
+
+// isRunningImageAllowedByAnySignature implements PolicyRequirement.isRunningImageAllowed for requirements which
+// accept an image if at least one of its signatures, or of the manifest list it was selected from, is accepted by req.
+func isRunningImageAllowedByAnySignature(ctx context.Context, image types.UnparsedImage, req PolicyRequirement) (bool, error) {
+	sigs, err := imageSignatures(ctx, image)
 	if err != nil {
 		return false, err
 	}
 	var rejections []error
 	for _, s := range sigs {
 		var reason error
-		switch res, _, err := pr.isSignatureAuthorAccepted(ctx, image, s); res {
+		switch res, _, err := isSignatureAuthorAcceptedCached(ctx, req, s.image, s.signature); res {
 		case sarAccepted:
 			// One accepted signature is enough.
 			return true, nil
@@ -116,7 +280,7 @@ func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image types.Unp
 	var summary error
 	switch len(rejections) {
 	case 0:
-		summary = PolicyRequirementError("A signature was required, but no signature exists")
+		summary = newPolicyRequirementError(PolicyRejectionReasonNoSignatures, "A signature was required, but no signature exists")
 	case 1:
 		summary = rejections[0]
 	default:
@@ -124,7 +288,15 @@ func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image types.Unp
 		for _, e := range rejections {
 			msgs = append(msgs, e.Error())
 		}
-		summary = PolicyRequirementError(fmt.Sprintf("None of the signatures were accepted, reasons: %s",
+		// If all signatures were rejected for the same reason, report it; otherwise, the overall reason is unknown.
+		reason := policyRejectionReason(rejections[0])
+		for _, e := range rejections[1:] {
+			if policyRejectionReason(e) != reason {
+				reason = PolicyRejectionReasonUnknown
+				break
+			}
+		}
+		summary = newPolicyRequirementError(reason, fmt.Sprintf("None of the signatures were accepted, reasons: %s",
 			strings.Join(msgs, "; ")))
 	}
 	return false, summary
@@ -2,15 +2,20 @@ package signature
 
 import (
 	"context"
+	"crypto"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/containers/image/directory"
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/image"
 	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -54,24 +59,46 @@ func TestPRSignedByIsSignatureAuthorAccepted(t *testing.T) {
 	testImageSig, err := ioutil.ReadFile("fixtures/dir-img-valid/signature-1")
 	require.NoError(t, err)
 
-	// Successful validation, with KeyData and KeyPath
+	// Successful validation, with KeyData, KeyPath and KeyPaths
 	pr, err := NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
 	require.NoError(t, err)
 	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
-	assertSARAccepted(t, sar, parsedSig, err, Signature{
-		DockerManifestDigest: TestImageManifestDigest,
-		DockerReference:      "testing/manifest:latest",
-	})
+	assertSARAccepted(t, sar, parsedSig, err, dirImageFixtureSignature(TestDirImageSignatureTimestamp))
 
+	// A directory containing the key, and a file with no keys.
+	keyDir, err := ioutil.TempDir("", "signedby-keypaths")
+	require.NoError(t, err)
+	defer os.RemoveAll(keyDir)
 	keyData, err := ioutil.ReadFile("fixtures/public-key.gpg")
 	require.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(keyDir, "public-key.gpg"), keyData, 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(keyDir, ".hidden-invalid-key"), []byte("this is invalid"), 0644)
+	require.NoError(t, err)
+	noKeysPath := path.Join(keyDir, "..", path.Base(keyDir)+"-no-keys")
+	err = ioutil.WriteFile(noKeysPath, []byte{}, 0644)
+	require.NoError(t, err)
+	defer os.Remove(noKeysPath)
+	for _, paths := range [][]string{
+		{"fixtures/public-key.gpg"},
+		{noKeysPath, "fixtures/public-key.gpg"},
+		{keyDir},
+		{noKeysPath, keyDir},
+	} {
+		pr, err = NewPRSignedByKeyPaths(ktGPG, paths, prm)
+		require.NoError(t, err)
+		sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+		assertSARAccepted(t, sar, parsedSig, err, dirImageFixtureSignature(TestDirImageSignatureTimestamp))
+	}
+	pr, err = NewPRSignedByKeyPath(ktGPG, keyDir, prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, dirImageFixtureSignature(TestDirImageSignatureTimestamp))
+
 	pr, err = NewPRSignedByKeyData(ktGPG, keyData, prm)
 	require.NoError(t, err)
 	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
-	assertSARAccepted(t, sar, parsedSig, err, Signature{
-		DockerManifestDigest: TestImageManifestDigest,
-		DockerReference:      "testing/manifest:latest",
-	})
+	assertSARAccepted(t, sar, parsedSig, err, dirImageFixtureSignature(TestDirImageSignatureTimestamp))
 
 	// Unimplemented and invalid KeyType values
 	for _, keyType := range []sbKeyType{SBKeyTypeSignedByGPGKeys,
@@ -101,6 +128,17 @@ func TestPRSignedByIsSignatureAuthorAccepted(t *testing.T) {
 	sar, parsedSig, err = prSB.isSignatureAuthorAccepted(context.Background(), nil, nil)
 	assertSARRejected(t, sar, parsedSig, err)
 
+	// Both KeyPath and KeyPaths set. Do not use NewPRSignedBy*, because it would reject this.
+	prSB = &prSignedBy{
+		KeyType:        ktGPG,
+		KeyPath:        "/foo/bar",
+		KeyPaths:       []string{"/foo/baz"},
+		SignedIdentity: prm,
+	}
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = prSB.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+
 	// Invalid KeyPath
 	pr, err = NewPRSignedByKeyPath(ktGPG, "/this/does/not/exist", prm)
 	require.NoError(t, err)
@@ -108,6 +146,23 @@ func TestPRSignedByIsSignatureAuthorAccepted(t *testing.T) {
 	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
 	assertSARRejected(t, sar, parsedSig, err)
 
+	// Invalid KeyPaths element
+	pr, err = NewPRSignedByKeyPaths(ktGPG, []string{"fixtures/public-key.gpg", "/this/does/not/exist"}, prm)
+	require.NoError(t, err)
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// A directory with no keys.
+	emptyDir, err := ioutil.TempDir("", "signedby-empty")
+	require.NoError(t, err)
+	defer os.RemoveAll(emptyDir)
+	pr, err = NewPRSignedByKeyPath(ktGPG, emptyDir, prm)
+	require.NoError(t, err)
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
 	// Errors initializing the temporary GPG directory and mechanism are not obviously easy to reach.
 
 	// KeyData has no public keys.
@@ -263,3 +318,244 @@ func TestPRSignedByIsRunningImageAllowed(t *testing.T) {
 	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
 }
+
+func TestPRSignedByKeyFingerprints(t *testing.T) {
+	testImage, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	testImageSig, err := ioutil.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	expectedFixtureSig := dirImageFixtureSignature(TestDirImageSignatureTimestamp)
+	expectedMockSig := Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	}
+	newPR := func(keyData []byte, fingerprints []string) *prSignedBy {
+		_pr, err := NewPRSignedByKeyData(SBKeyTypeGPGKeys, keyData, NewPRMMatchExact())
+		require.NoError(t, err)
+		pr := _pr.(*prSignedBy)
+		pr.KeyFingerprints = fingerprints
+		return pr
+	}
+	keyData, err := ioutil.ReadFile("fixtures/public-key.gpg")
+	require.NoError(t, err)
+
+	// The listed fingerprint is accepted, ignoring case
+	for _, fingerprints := range [][]string{
+		{TestKeyFingerprint},
+		{strings.ToLower(TestKeyFingerprint)},
+		{"0123456789ABCDEF", TestKeyFingerprint},
+	} {
+		sar, parsedSig, err := newPR(keyData, fingerprints).isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+		assertSARAccepted(t, sar, parsedSig, err, expectedFixtureSig)
+	}
+
+	// None of the listed fingerprints were imported
+	sar, parsedSig, err := newPR(keyData, []string{"0123456789ABCDEF"}).isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+	assert.Equal(t, PolicyRejectionReasonUntrustedKey, policyRejectionReason(err))
+
+	// A keyring with several keys: only signatures by the listed keys are accepted
+	ctx := context.WithValue(context.Background(), signingMechanismFactoryKey{}, SigningMechanismFactory(newKeyListMechanismMock))
+	pr := newPR([]byte("AAAA BBBB"), []string{"aaaa"})
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(ctx, testImage, keyListTestSignature(t, "AAAA", TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARAccepted(t, sar, parsedSig, err, expectedMockSig)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(ctx, testImage, keyListTestSignature(t, "BBBB", TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+	assert.Equal(t, PolicyRejectionReasonUntrustedKey, policyRejectionReason(err))
+}
+
+func TestPRSignedBySignatureTimes(t *testing.T) {
+	ctx := context.WithValue(context.Background(), signingMechanismFactoryKey{}, SigningMechanismFactory(newKeyListMechanismMock))
+	img, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	sigWithTimes := func(timestamp, expiration *time.Time) []byte {
+		s := untrustedSignature{
+			UntrustedDockerManifestDigest: TestImageManifestDigest,
+			UntrustedDockerReference:      "testing/manifest:latest",
+		}
+		if timestamp != nil {
+			ts := timestamp.Unix()
+			s.UntrustedTimestamp = &ts
+		}
+		if expiration != nil {
+			exp := expiration.Unix()
+			s.UntrustedExpiration = &exp
+		}
+		contents, err := s.MarshalJSON()
+		require.NoError(t, err)
+		return append([]byte("A\n"), contents...)
+	}
+	now := time.Now()
+	hourAgo, dayAgo, inAnHour := now.Add(-time.Hour), now.Add(-24*time.Hour), now.Add(time.Hour)
+
+	for _, c := range []struct {
+		maxAge                int64
+		rejectExpired         bool
+		timestamp, expiration *time.Time
+		accepted              bool
+	}{
+		// No restrictions
+		{0, false, nil, nil, true},
+		{0, false, &dayAgo, &hourAgo, true},
+		// Maximum age
+		{7200, false, &hourAgo, nil, true},
+		{7200, false, &dayAgo, nil, false},
+		{7200, false, nil, nil, false},
+		{7200, false, &hourAgo, &hourAgo, true},
+		// Expiration
+		{0, true, nil, nil, true},
+		{0, true, &dayAgo, nil, true},
+		{0, true, &dayAgo, &inAnHour, true},
+		{0, true, &dayAgo, &hourAgo, false},
+		// Both
+		{7200, true, &hourAgo, &inAnHour, true},
+		{7200, true, &hourAgo, &hourAgo, false},
+		{7200, true, &dayAgo, &inAnHour, false},
+	} {
+		_pr, err := NewPRSignedByKeyData(SBKeyTypeGPGKeys, []byte("A"), NewPRMMatchExact())
+		require.NoError(t, err)
+		pr := _pr.(*prSignedBy)
+		pr.MaxSignatureAgeSeconds = c.maxAge
+		pr.RejectExpiredSignatures = c.rejectExpired
+
+		sar, parsedSig, err := pr.isSignatureAuthorAccepted(ctx, img, sigWithTimes(c.timestamp, c.expiration))
+		if c.accepted {
+			expectedSig := Signature{
+				DockerManifestDigest: TestImageManifestDigest,
+				DockerReference:      "testing/manifest:latest",
+			}
+			if c.timestamp != nil {
+				expectedSig.Timestamp = time.Unix(c.timestamp.Unix(), 0)
+			}
+			assertSARAccepted(t, sar, parsedSig, err, expectedSig)
+		} else {
+			assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+			assert.Equal(t, PolicyRejectionReasonSignatureExpired, policyRejectionReason(err))
+		}
+	}
+}
+
+// x509TestSignature returns a serialized sigstore signature of an image with manifestDigest and dockerReference by key,
+// with attached PEM-encoded certPEM and (if not empty) chainPEM.
+func x509TestSignature(t *testing.T, key crypto.Signer, certPEM, chainPEM []byte, manifestDigest digest.Digest, dockerReference string) []byte {
+	payload, err := json.Marshal(newUntrustedSigstorePayload(manifestDigest, dockerReference))
+	require.NoError(t, err)
+	annotations := map[string]string{
+		SigstoreSignatureAnnotationKey:   sigstoreTestSignPayload(t, key, payload),
+		SigstoreCertificateAnnotationKey: string(certPEM),
+	}
+	if len(chainPEM) != 0 {
+		annotations[SigstoreIntermediateCertificateChainAnnotationKey] = string(chainPEM)
+	}
+	blob, err := SigstoreSignature{
+		UntrustedMIMEType:    SigstoreSignatureMIMEType,
+		UntrustedPayload:     payload,
+		UntrustedAnnotations: annotations,
+	}.Blob()
+	require.NoError(t, err)
+	return blob
+}
+
+func TestPRSignedByX509CAsIsSignatureAuthorAccepted(t *testing.T) {
+	prm := NewPRMMatchExact()
+	testImage, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+
+	caCert, caKey, caPEM := x509TestCertificate(t, x509TestCATemplate("CA"), nil, nil)
+	intermediateCert, intermediateKey, intermediatePEM := x509TestCertificate(t, x509TestCATemplate("Intermediate"), caCert, caKey)
+	_, leafKey, leafPEM := x509TestCertificate(t, x509TestLeafTemplate("Leaf"), caCert, caKey)
+	_, chainedLeafKey, chainedLeafPEM := x509TestCertificate(t, x509TestLeafTemplate("Chained leaf"), intermediateCert, intermediateKey)
+
+	pr, err := NewPRSignedByKeyData(SBKeyTypeSignedByX509CAs, caPEM, prm)
+	require.NoError(t, err)
+
+	// Success, directly signed by the CA, and using an intermediate certificate
+	for _, sig := range [][]byte{
+		x509TestSignature(t, leafKey, leafPEM, nil, TestImageManifestDigest, "testing/manifest:latest"),
+		x509TestSignature(t, chainedLeafKey, chainedLeafPEM, intermediatePEM, TestImageManifestDigest, "testing/manifest:latest"),
+	} {
+		sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, sig)
+		assertSARAccepted(t, sar, parsedSig, err, Signature{
+			DockerManifestDigest: TestImageManifestDigest,
+			DockerReference:      "testing/manifest:latest",
+		})
+	}
+
+	// Success, using a CA bundle in a directory
+	caDir, err := ioutil.TempDir("", "signedby-x509-cas")
+	require.NoError(t, err)
+	defer os.RemoveAll(caDir)
+	_, _, otherCAPEM := x509TestCertificate(t, x509TestCATemplate("Other CA"), nil, nil)
+	err = ioutil.WriteFile(path.Join(caDir, "other-ca.pem"), otherCAPEM, 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(caDir, "ca.pem"), caPEM, 0644)
+	require.NoError(t, err)
+	dirPR, err := NewPRSignedByKeyPath(SBKeyTypeSignedByX509CAs, caDir, prm)
+	require.NoError(t, err)
+	sar, parsedSig, err := dirPR.isSignatureAuthorAccepted(context.Background(), testImage,
+		x509TestSignature(t, leafKey, leafPEM, nil, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+
+	// Invalid CA data, and no CA certificates at all
+	for _, keyPaths := range [][]string{
+		{"/this/does/not/exist"},
+		{"fixtures/public-key.gpg"},
+	} {
+		invalidPR, err := NewPRSignedByKeyPaths(SBKeyTypeSignedByX509CAs, keyPaths, prm)
+		require.NoError(t, err)
+		// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+		sar, parsedSig, err := invalidPR.isSignatureAuthorAccepted(context.Background(), nil, nil)
+		assertSARRejected(t, sar, parsedSig, err)
+	}
+	emptyDir, err := ioutil.TempDir("", "signedby-x509-no-cas")
+	require.NoError(t, err)
+	defer os.RemoveAll(emptyDir)
+	emptyPR, err := NewPRSignedByKeyPath(SBKeyTypeSignedByX509CAs, emptyDir, prm)
+	require.NoError(t, err)
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = emptyPR.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A simple signing signature
+	simpleSig, err := ioutil.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, simpleSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A sigstore signature without a certificate
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		sigstoreTestSignature(t, leafKey, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// Missing intermediate certificate
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		x509TestSignature(t, chainedLeafKey, chainedLeafPEM, nil, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A certificate issued by an unknown CA
+	otherCACert, otherCAKey, _ := x509TestCertificate(t, x509TestCATemplate("Other CA"), nil, nil)
+	_, otherLeafKey, otherLeafPEM := x509TestCertificate(t, x509TestLeafTemplate("Other leaf"), otherCACert, otherCAKey)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		x509TestSignature(t, otherLeafKey, otherLeafPEM, nil, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A signature by a key other than the one in the certificate
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		x509TestSignature(t, otherLeafKey, leafPEM, nil, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// A valid signature with a rejected identity
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		x509TestSignature(t, leafKey, leafPEM, nil, TestImageManifestDigest, "testing/manifest:notlatest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A valid signature with a non-matching manifest
+	image, closer := dirImageMock(t, "fixtures/dir-img-modified-manifest", "testing/manifest:latest")
+	defer closer()
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), image,
+		x509TestSignature(t, leafKey, leafPEM, nil, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+}
@@ -0,0 +1,231 @@
+// Policy evaluation for prSigstoreSigned.
+
+package signature
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+)
+
+func (pr *prSigstoreSigned) isSignatureAuthorAccepted(ctx context.Context, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	sources := 0
+	if pr.KeyPath != "" {
+		sources++
+	}
+	if pr.KeyData != nil {
+		sources++
+	}
+	if pr.KeyURI != "" {
+		sources++
+	}
+	if pr.Fulcio != nil {
+		sources++
+	}
+	if sources != 1 {
+		return sarRejected, nil, errors.New(`Internal inconsistency: not exactly one of "keyPath", "keyData", "keyURI" and "fulcio" specified`)
+	}
+
+	// FIXME: move this to per-context initialization
+	var rekorPublicKey crypto.PublicKey
+	if pr.RekorPublicKeyPath != "" {
+		d, err := ioutil.ReadFile(pr.RekorPublicKeyPath)
+		if err != nil {
+			return sarRejected, nil, err
+		}
+		rekorPublicKey, err = loadSigstorePublicKey(d)
+		if err != nil {
+			return sarRejected, nil, err
+		}
+	}
+
+	if pr.Fulcio != nil {
+		if rekorPublicKey == nil {
+			return sarRejected, nil, errors.New(`Internal inconsistency: "fulcio" specified without "rekorPublicKeyPath"`)
+		}
+		fulcio, err := pr.Fulcio.prepareTrustRoot()
+		if err != nil {
+			return sarRejected, nil, err
+		}
+		return isSigstoreSignatureAccepted(ctx, image, sig, pr.SignedIdentity, func(untrustedSig *SigstoreSignature) (crypto.PublicKey, error) {
+			untrustedCert, ok := untrustedSig.UntrustedAnnotations[SigstoreCertificateAnnotationKey]
+			if !ok {
+				return nil, PolicyRequirementError(fmt.Sprintf("Signature has no %s annotation", SigstoreCertificateAnnotationKey))
+			}
+			untrustedChain := untrustedSig.UntrustedAnnotations[SigstoreIntermediateCertificateChainAnnotationKey]
+			// Fulcio certificates are short-lived, so they are verified at the time recorded in the transparency log.
+			integratedTime, err := verifySigstoreSignatureRekorSET(rekorPublicKey, untrustedSig, []byte(untrustedCert))
+			if err != nil {
+				return nil, err
+			}
+			return fulcio.verifyFulcioCertificate([]byte(untrustedCert), []byte(untrustedChain), integratedTime)
+		})
+	}
+
+	var keyData []byte
+	var publicKey crypto.PublicKey
+	if pr.KeyURI != "" {
+		k, err := pr.keyURIPublicKey(ctx)
+		if err != nil {
+			return sarRejected, nil, err
+		}
+		keyData, err = marshalSigstorePublicKey(k)
+		if err != nil {
+			return sarRejected, nil, err
+		}
+		publicKey = k
+	} else {
+		if pr.KeyData != nil {
+			keyData = pr.KeyData
+		} else {
+			d, err := ioutil.ReadFile(pr.KeyPath)
+			if err != nil {
+				return sarRejected, nil, err
+			}
+			keyData = d
+		}
+		k, err := loadSigstorePublicKey(keyData)
+		if err != nil {
+			return sarRejected, nil, err
+		}
+		publicKey = k
+	}
+
+	return isSigstoreSignatureAccepted(ctx, image, sig, pr.SignedIdentity, func(untrustedSig *SigstoreSignature) (crypto.PublicKey, error) {
+		if rekorPublicKey != nil {
+			if _, err := verifySigstoreSignatureRekorSET(rekorPublicKey, untrustedSig, keyData); err != nil {
+				return nil, err
+			}
+		}
+		return publicKey, nil
+	})
+}
+
+// keyURIPublicKey returns the public key identified by pr.KeyURI.
+// Within a PolicyContext, the key is resolved only once, when it is first used, and reused afterwards.
+func (pr *prSigstoreSigned) keyURIPublicKey(ctx context.Context) (crypto.PublicKey, error) {
+	pc := policyContextFromContext(ctx)
+	if pc == nil {
+		return resolveSigstoreKeyURI(ctx, pr.KeyURI)
+	}
+	pc.sigstoreKeyURIKeysLock.Lock()
+	key, ok := pc.sigstoreKeyURIKeys[pr.KeyURI]
+	pc.sigstoreKeyURIKeysLock.Unlock()
+	if ok {
+		return key, nil
+	}
+	// Don't hold the lock while resolving the key, it may be slow; concurrent evaluations may resolve the same key twice.
+	key, err := resolveSigstoreKeyURI(ctx, pr.KeyURI)
+	if err != nil {
+		return nil, err
+	}
+	pc.sigstoreKeyURIKeysLock.Lock()
+	if pc.sigstoreKeyURIKeys == nil {
+		pc.sigstoreKeyURIKeys = map[string]crypto.PublicKey{}
+	}
+	pc.sigstoreKeyURIKeys[pr.KeyURI] = key
+	pc.sigstoreKeyURIKeysLock.Unlock()
+	return key, nil
+}
+
+// verifySigstoreSignatureRekorSET verifies that untrustedSig, made by the PEM-encoded public key or certificate
+// unverifiedKeyOrCertPEM, is recorded in a Rekor SET signed by rekorPublicKey, and returns the time of the log entry.
+func verifySigstoreSignatureRekorSET(rekorPublicKey crypto.PublicKey, untrustedSig *SigstoreSignature, unverifiedKeyOrCertPEM []byte) (time.Time, error) {
+	untrustedSET, ok := untrustedSig.UntrustedAnnotations[SigstoreSETAnnotationKey]
+	if !ok {
+		return time.Time{}, PolicyRequirementError(fmt.Sprintf("Signature has no %s annotation", SigstoreSETAnnotationKey))
+	}
+	return verifyRekorSET(rekorPublicKey, []byte(untrustedSET), unverifiedKeyOrCertPEM,
+		untrustedSig.UntrustedAnnotations[SigstoreSignatureAnnotationKey], untrustedSig.UntrustedPayload)
+}
+
+// prepareTrustRoot creates a fulcioTrustRoot from f.
+func (f *prSigstoreSignedFulcio) prepareTrustRoot() (*fulcioTrustRoot, error) {
+	if f.CAPath != "" && f.CAData != nil {
+		return nil, errors.New(`Internal inconsistency: both "caPath" and "caData" specified`)
+	}
+	var caData []byte
+	if f.CAData != nil {
+		caData = f.CAData
+	} else {
+		d, err := ioutil.ReadFile(f.CAPath)
+		if err != nil {
+			return nil, err
+		}
+		caData = d
+	}
+	caCertificates, err := newX509CertPool([][]byte{caData})
+	if err != nil {
+		return nil, err
+	}
+	return &fulcioTrustRoot{
+		caCertificates: caCertificates,
+		oidcIssuer:     f.OIDCIssuer,
+		subjectEmail:   f.SubjectEmail,
+	}, nil
+}
+
+// isSigstoreSignatureAccepted implements PolicyRequirement.isSignatureAuthorAccepted for a sigstore signature sig,
+// which must be signed by a key returned by trustedPublicKey (which may decide based on UNTRUSTED data in the signature,
+// e.g. an attached certificate), and claim an identity accepted by signedIdentity.
+func isSigstoreSignatureAccepted(ctx context.Context, image types.UnparsedImage, sig []byte, signedIdentity PolicyReferenceMatch,
+	trustedPublicKey func(untrustedSig *SigstoreSignature) (crypto.PublicKey, error)) (signatureAcceptanceResult, *Signature, error) {
+	if !IsSigstoreSignature(sig) {
+		return sarRejected, nil, PolicyRequirementError("Signature is not a sigstore signature")
+	}
+	untrustedSig, err := ParseSigstoreSignature(sig)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	if untrustedSig.UntrustedMIMEType != SigstoreSignatureMIMEType {
+		return sarRejected, nil, InvalidSignatureError{msg: fmt.Sprintf("Unexpected sigstore signature MIME type %q", untrustedSig.UntrustedMIMEType)}
+	}
+	untrustedBase64Signature, ok := untrustedSig.UntrustedAnnotations[SigstoreSignatureAnnotationKey]
+	if !ok {
+		return sarRejected, nil, InvalidSignatureError{msg: fmt.Sprintf("Missing %s annotation", SigstoreSignatureAnnotationKey)}
+	}
+	publicKey, err := trustedPublicKey(untrustedSig)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+
+	signature, err := verifySigstorePayload(publicKey, untrustedSig.UntrustedPayload, untrustedBase64Signature, sigstorePayloadAcceptanceRules{
+		validateSignedDockerReference: func(ref string) error {
+			if !signedIdentity.matchesDockerReference(image, ref) {
+				return newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, fmt.Sprintf("Signature for identity %s is not accepted", ref))
+			}
+			return nil
+		},
+		validateSignedDockerManifestDigest: func(digest digest.Digest) error {
+			m, _, err := image.Manifest(ctx)
+			if err != nil {
+				return err
+			}
+			digestMatches, err := manifest.MatchesDigest(m, digest)
+			if err != nil {
+				return err
+			}
+			if !digestMatches {
+				return newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, fmt.Sprintf("Signature for digest %s does not match", digest))
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return sarRejected, nil, err
+	}
+
+	return sarAccepted, signature, nil
+}
+
+func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (bool, error) {
+	return isRunningImageAllowedByAnySignature(ctx, image, pr)
+}
@@ -0,0 +1,515 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createSigstoreSignedDir returns a directory containing the manifest from fixtures/dir-img-valid and sigs as signatures.
+// The caller should remove the directory when done.
+func createSigstoreSignedDir(t *testing.T, sigs ...[]byte) string {
+	dir, err := ioutil.TempDir("", "sigstore-signed-dir")
+	require.NoError(t, err)
+	manifest, err := ioutil.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(dir, "manifest.json"), manifest, 0644)
+	require.NoError(t, err)
+	for i, sig := range sigs {
+		err = ioutil.WriteFile(path.Join(dir, fmt.Sprintf("signature-%d", i+1)), sig, 0644)
+		require.NoError(t, err)
+	}
+	return dir
+}
+
+func TestPRSigstoreSignedIsSignatureAuthorAccepted(t *testing.T) {
+	prm := NewPRMMatchExact()
+	key, publicKeyPEM := sigstoreTestKey(t)
+	testImage, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	testImageSig := sigstoreTestSignature(t, key, TestImageManifestDigest, "testing/manifest:latest")
+
+	// Successful validation, with KeyData and KeyPath
+	pr, err := NewPRSigstoreSignedKeyData(publicKeyPEM, prm)
+	require.NoError(t, err)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+
+	keyFile, err := ioutil.TempFile("", "sigstore-public-key")
+	require.NoError(t, err)
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.Write(publicKeyPEM)
+	require.NoError(t, err)
+	err = keyFile.Close()
+	require.NoError(t, err)
+	pr, err = NewPRSigstoreSignedKeyPath(keyFile.Name(), prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+
+	// Both KeyPath and KeyData set. Do not use NewPRSigstoreSigned*, because it would reject this.
+	prSS := &prSigstoreSigned{
+		KeyPath:        keyFile.Name(),
+		KeyData:        publicKeyPEM,
+		SignedIdentity: prm,
+	}
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = prSS.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Invalid KeyPath
+	pr, err = NewPRSigstoreSignedKeyPath("/this/does/not/exist", prm)
+	require.NoError(t, err)
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Invalid public key
+	pr, err = NewPRSigstoreSignedKeyData([]byte("this is not a public key"), prm)
+	require.NoError(t, err)
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	pr, err = NewPRSigstoreSignedKeyData(publicKeyPEM, prm)
+	require.NoError(t, err)
+
+	// A simple signing signature
+	simpleSig, err := ioutil.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image parmater..
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, simpleSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// An invalid sigstore signature blob
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, []byte(sigstoreSignaturePrefix+"invalid"))
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Invalid MIME type, and a missing signature annotation
+	validPayload, err := json.Marshal(newUntrustedSigstorePayload(TestImageManifestDigest, "testing/manifest:latest"))
+	require.NoError(t, err)
+	for _, sig := range []SigstoreSignature{
+		{
+			UntrustedMIMEType:    "application/unexpected",
+			UntrustedPayload:     validPayload,
+			UntrustedAnnotations: map[string]string{SigstoreSignatureAnnotationKey: sigstoreTestSignPayload(t, key, validPayload)},
+		},
+		{
+			UntrustedMIMEType:    SigstoreSignatureMIMEType,
+			UntrustedPayload:     validPayload,
+			UntrustedAnnotations: map[string]string{},
+		},
+	} {
+		blob, err := sig.Blob()
+		require.NoError(t, err)
+		// Pass a nil pointer to, kind of, test that the return value does not depend on the image parmater..
+		sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, blob)
+		assertSARRejected(t, sar, parsedSig, err)
+	}
+
+	// A signature which does not verify
+	invalidSigBlob, err := SigstoreSignature{
+		UntrustedMIMEType:    SigstoreSignatureMIMEType,
+		UntrustedPayload:     validPayload,
+		UntrustedAnnotations: map[string]string{SigstoreSignatureAnnotationKey: base64.StdEncoding.EncodeToString([]byte("invalid"))},
+	}.Blob()
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image parmater..
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, invalidSigBlob)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// A valid signature using an unknown key.
+	otherKey, _ := sigstoreTestKey(t)
+	sig := sigstoreTestSignature(t, otherKey, TestImageManifestDigest, "testing/manifest:latest")
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image parmater..
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, sig)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// A valid signature with a rejected identity.
+	nonmatchingPRM, err := NewPRMExactReference("this/doesnt:match")
+	require.NoError(t, err)
+	pr, err = NewPRSigstoreSignedKeyData(publicKeyPEM, nonmatchingPRM)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// Error reading image manifest
+	image, closer := dirImageMock(t, "fixtures/dir-img-no-manifest", "testing/manifest:latest")
+	defer closer()
+	pr, err = NewPRSigstoreSignedKeyData(publicKeyPEM, prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), image, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Error computing manifest digest
+	image, closer = dirImageMock(t, "fixtures/dir-img-manifest-digest-error", "testing/manifest:latest")
+	defer closer()
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), image, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// A valid signature with a non-matching manifest
+	image, closer = dirImageMock(t, "fixtures/dir-img-modified-manifest", "testing/manifest:latest")
+	defer closer()
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), image, testImageSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+}
+
+// writeTestFile writes contents to a new temporary file, and returns its path.
+// The caller should remove the file when done.
+func writeTestFile(t *testing.T, contents []byte) string {
+	file, err := ioutil.TempFile("", "signature-test-file")
+	require.NoError(t, err)
+	_, err = file.Write(contents)
+	require.NoError(t, err)
+	err = file.Close()
+	require.NoError(t, err)
+	return file.Name()
+}
+
+// sigstoreTestSignatureWithRekorSET returns a serialized sigstore signature of an image with manifestDigest and dockerReference by key,
+// with attached PEM-encoded certPEM and chainPEM (if not empty), and a Rekor SET for keyOrCertPEM by rekorKey, integrated at integratedTime.
+func sigstoreTestSignatureWithRekorSET(t *testing.T, key crypto.Signer, keyOrCertPEM, certPEM, chainPEM []byte, rekorKey crypto.Signer, integratedTime time.Time,
+	manifestDigest digest.Digest, dockerReference string) []byte {
+	payload, err := json.Marshal(newUntrustedSigstorePayload(manifestDigest, dockerReference))
+	require.NoError(t, err)
+	base64Sig := sigstoreTestSignPayload(t, key, payload)
+	annotations := map[string]string{
+		SigstoreSignatureAnnotationKey: base64Sig,
+		SigstoreSETAnnotationKey:       rekorTestSET(t, rekorKey, keyOrCertPEM, base64Sig, payload, integratedTime),
+	}
+	if len(certPEM) != 0 {
+		annotations[SigstoreCertificateAnnotationKey] = string(certPEM)
+	}
+	if len(chainPEM) != 0 {
+		annotations[SigstoreIntermediateCertificateChainAnnotationKey] = string(chainPEM)
+	}
+	blob, err := SigstoreSignature{
+		UntrustedMIMEType:    SigstoreSignatureMIMEType,
+		UntrustedPayload:     payload,
+		UntrustedAnnotations: annotations,
+	}.Blob()
+	require.NoError(t, err)
+	return blob
+}
+
+func TestPRSigstoreSignedKeyURIIsSignatureAuthorAccepted(t *testing.T) {
+	prm := NewPRMMatchExact()
+	key, publicKeyPEM := sigstoreTestKey(t)
+	otherKey, _ := sigstoreTestKey(t)
+	testImage, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	testImageSig := sigstoreTestSignature(t, key, TestImageManifestDigest, "testing/manifest:latest")
+	resolver, calls := sigstoreTestKeyURIResolver(map[string]crypto.PublicKey{
+		"testkms://valid": key.Public(),
+		"testkms://other": otherKey.Public(),
+	})
+	defer withSigstoreKeyURIResolver(t, "testkms", resolver)()
+
+	// Evaluation outside of a PolicyContext resolves the key on use
+	pr, err := NewPRSigstoreSignedKeyURI("testkms://valid", prm)
+	require.NoError(t, err)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+	assert.Equal(t, 1, *calls)
+
+	// A signature by a different key
+	pr, err = NewPRSigstoreSignedKeyURI("testkms://other", prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// A key which can not be resolved
+	pr, err = NewPRSigstoreSignedKeyURI("testkms://unknown", prm)
+	require.NoError(t, err)
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// A PolicyContext resolves the key when it is first used, and only once
+	pr, err = NewPRSigstoreSignedKeyURI("testkms://valid", prm)
+	require.NoError(t, err)
+	*calls = 0
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{pr},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {"docker.io/testing/manifest": {pr}},
+		},
+	})
+	require.NoError(t, err)
+	defer pc.Destroy()
+	assert.Equal(t, 0, *calls)
+	pcImage, pcCloser := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer pcCloser()
+	for i := 0; i < 2; i++ {
+		sigs, err := pc.GetSignaturesWithAcceptedAuthor(context.Background(), thresholdImageMock{UnparsedImage: pcImage, sigs: [][]byte{testImageSig}})
+		require.NoError(t, err)
+		assert.Len(t, sigs, 1)
+		pc.acceptedSignatures = nil // Force the signature to be verified again
+	}
+	assert.Equal(t, 1, *calls)
+
+	// Keys which can not be resolved only cause rejection of images evaluated using them
+	for _, uri := range []string{"testkms://unknown", "otherkms://valid"} {
+		pr, err = NewPRSigstoreSignedKeyURI(uri, prm)
+		require.NoError(t, err)
+		pc, err := NewPolicyContext(&Policy{
+			Default: PolicyRequirements{NewPRInsecureAcceptAnything()},
+			Transports: map[string]PolicyTransportScopes{
+				"docker": {"docker.io/testing/manifest:unresolvable": {pr}},
+			},
+		})
+		require.NoError(t, err, uri)
+		res, err := pc.IsRunningImageAllowed(context.Background(), pcImage)
+		assertRunningAllowed(t, res, err)
+		unresolvableImage, unresolvableCloser := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:unresolvable")
+		res, err = pc.IsRunningImageAllowed(context.Background(), thresholdImageMock{UnparsedImage: unresolvableImage, sigs: [][]byte{testImageSig}})
+		assertRunningRejected(t, res, err)
+		unresolvableCloser()
+		pc.Destroy()
+	}
+
+	// With a Rekor SET, the public key is recorded in the log entry in the PEM format
+	rekorKey, rekorPublicKeyPEM := sigstoreTestKey(t)
+	rekorPath := writeTestFile(t, rekorPublicKeyPEM)
+	defer os.Remove(rekorPath)
+	pr, err = newPRSigstoreSigned("", nil, "testkms://valid", nil, rekorPath, prm)
+	require.NoError(t, err)
+	sig := sigstoreTestSignatureWithRekorSET(t, key, publicKeyPEM, nil, nil, rekorKey, time.Now(), TestImageManifestDigest, "testing/manifest:latest")
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, sig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+}
+
+func TestPRSigstoreSignedRekorIsSignatureAuthorAccepted(t *testing.T) {
+	prm := NewPRMMatchExact()
+	testImage, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	key, publicKeyPEM := sigstoreTestKey(t)
+	rekorKey, rekorPublicKeyPEM := sigstoreTestKey(t)
+	rekorPath := writeTestFile(t, rekorPublicKeyPEM)
+	defer os.Remove(rekorPath)
+
+	pr, err := newPRSigstoreSigned("", publicKeyPEM, "", nil, rekorPath, prm)
+	require.NoError(t, err)
+
+	// Success
+	sig := sigstoreTestSignatureWithRekorSET(t, key, publicKeyPEM, nil, nil, rekorKey, time.Now(), TestImageManifestDigest, "testing/manifest:latest")
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, sig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+
+	// Missing SET
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		sigstoreTestSignature(t, key, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// SET by an unknown Rekor key
+	otherRekorKey, _ := sigstoreTestKey(t)
+	sig = sigstoreTestSignatureWithRekorSET(t, key, publicKeyPEM, nil, nil, otherRekorKey, time.Now(), TestImageManifestDigest, "testing/manifest:latest")
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, sig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// SET for a different key
+	_, otherPublicKeyPEM := sigstoreTestKey(t)
+	sig = sigstoreTestSignatureWithRekorSET(t, key, otherPublicKeyPEM, nil, nil, rekorKey, time.Now(), TestImageManifestDigest, "testing/manifest:latest")
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, sig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// Invalid Rekor public key
+	for _, path := range []string{"/this/does/not/exist", "fixtures/public-key.gpg"} {
+		invalidPR, err := newPRSigstoreSigned("", publicKeyPEM, "", nil, path, prm)
+		require.NoError(t, err)
+		// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+		sar, parsedSig, err = invalidPR.isSignatureAuthorAccepted(context.Background(), nil, nil)
+		assertSARRejected(t, sar, parsedSig, err)
+	}
+}
+
+func TestPRSigstoreSignedFulcioIsSignatureAuthorAccepted(t *testing.T) {
+	const testIssuer = "https://issuer.example.com"
+	const testEmail = "user@example.com"
+	prm := NewPRMMatchExact()
+	testImage, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+
+	rekorKey, rekorPublicKeyPEM := sigstoreTestKey(t)
+	rekorPath := writeTestFile(t, rekorPublicKeyPEM)
+	defer os.Remove(rekorPath)
+	caCert, caKey, caPEM := x509TestCertificate(t, x509TestCATemplate("Fulcio CA"), nil, nil)
+	intermediateCert, intermediateKey, intermediatePEM := x509TestCertificate(t, x509TestCATemplate("Fulcio intermediate"), caCert, caKey)
+	// A short-lived certificate which has already expired; it is verified at the time of the Rekor entry.
+	integratedTime := time.Now().Add(-25 * time.Minute)
+	template := fulcioTestLeafTemplate(testIssuer, testEmail)
+	template.NotBefore = integratedTime.Add(-5 * time.Minute)
+	template.NotAfter = integratedTime.Add(5 * time.Minute)
+	_, leafKey, leafPEM := x509TestCertificate(t, template, intermediateCert, intermediateKey)
+	testImageSig := sigstoreTestSignatureWithRekorSET(t, leafKey, leafPEM, leafPEM, intermediatePEM, rekorKey, integratedTime,
+		TestImageManifestDigest, "testing/manifest:latest")
+
+	// Successful validation, with CAData and CAPath
+	pr, err := NewPRSigstoreSignedFulcioCAData(caPEM, testIssuer, testEmail, rekorPath, prm)
+	require.NoError(t, err)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+
+	caPath := writeTestFile(t, caPEM)
+	defer os.Remove(caPath)
+	pr, err = NewPRSigstoreSignedFulcioCAPath(caPath, testIssuer, testEmail, rekorPath, prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+
+	testFulcio := &prSigstoreSignedFulcio{
+		CAData:       caPEM,
+		OIDCIssuer:   testIssuer,
+		SubjectEmail: testEmail,
+	}
+	// Both Fulcio and KeyData set, or Fulcio without a Rekor key. Do not use NewPRSigstoreSigned*, because it would reject this.
+	for _, prSS := range []*prSigstoreSigned{
+		{KeyData: caPEM, Fulcio: testFulcio, RekorPublicKeyPath: rekorPath, SignedIdentity: prm},
+		{Fulcio: testFulcio, SignedIdentity: prm},
+	} {
+		// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+		sar, parsedSig, err = prSS.isSignatureAuthorAccepted(context.Background(), nil, nil)
+		assertSARRejected(t, sar, parsedSig, err)
+	}
+
+	// Invalid CAPath and CAData
+	pr, err = NewPRSigstoreSignedFulcioCAPath("/this/does/not/exist", testIssuer, testEmail, rekorPath, prm)
+	require.NoError(t, err)
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+	pr, err = NewPRSigstoreSignedFulcioCAData([]byte("this is not a certificate"), testIssuer, testEmail, rekorPath, prm)
+	require.NoError(t, err)
+	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	pr, err = NewPRSigstoreSignedFulcioCAData(caPEM, testIssuer, testEmail, rekorPath, prm)
+	require.NoError(t, err)
+
+	// A signature without a certificate
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		sigstoreTestSignatureWithRekorSET(t, leafKey, leafPEM, nil, nil, rekorKey, integratedTime, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A signature without a Rekor SET
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		x509TestSignature(t, leafKey, leafPEM, intermediatePEM, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A Rekor entry at a time the certificate was not valid
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		sigstoreTestSignatureWithRekorSET(t, leafKey, leafPEM, leafPEM, intermediatePEM, rekorKey, time.Now(), TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A certificate for a different identity
+	otherTemplate := fulcioTestLeafTemplate(testIssuer, "other@example.com")
+	_, otherKey, otherEmailPEM := x509TestCertificate(t, otherTemplate, intermediateCert, intermediateKey)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		sigstoreTestSignatureWithRekorSET(t, otherKey, otherEmailPEM, otherEmailPEM, intermediatePEM, rekorKey, time.Now(), TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// A signature by a key other than the one in the certificate
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		sigstoreTestSignatureWithRekorSET(t, otherKey, leafPEM, leafPEM, intermediatePEM, rekorKey, integratedTime, TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// A valid signature with a rejected identity
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage,
+		sigstoreTestSignatureWithRekorSET(t, leafKey, leafPEM, leafPEM, intermediatePEM, rekorKey, integratedTime, TestImageManifestDigest, "testing/manifest:notlatest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+}
+
+func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
+	prm := NewPRMMatchExact()
+	key, publicKeyPEM := sigstoreTestKey(t)
+	validSig := sigstoreTestSignature(t, key, TestImageManifestDigest, "testing/manifest:latest")
+	otherKey, _ := sigstoreTestKey(t)
+	unknownKeySig := sigstoreTestSignature(t, otherKey, TestImageManifestDigest, "testing/manifest:latest")
+	pr, err := NewPRSigstoreSignedKeyData(publicKeyPEM, prm)
+	require.NoError(t, err)
+
+	// A simple success case: single valid signature.
+	dir := createSigstoreSignedDir(t, validSig)
+	defer os.RemoveAll(dir)
+	image, closer := dirImageMock(t, dir, "testing/manifest:latest")
+	defer closer()
+	allowed, err := pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningAllowed(t, allowed, err)
+
+	// Error reading signatures
+	invalidSigDir := createInvalidSigDir(t)
+	defer os.RemoveAll(invalidSigDir)
+	image, closer = dirImageMock(t, invalidSigDir, "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejected(t, allowed, err)
+
+	// No signatures
+	image, closer = dirImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// Only simple signing signatures
+	image, closer = dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// 1 invalid signature: a non-matching Docker reference
+	image, closer = dirImageMock(t, dir, "testing/manifest:notlatest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// One invalid, one valid signature (in this order)
+	simpleSig, err := ioutil.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	mixedDir := createSigstoreSignedDir(t, simpleSig, unknownKeySig, validSig)
+	defer os.RemoveAll(mixedDir)
+	image, closer = dirImageMock(t, mixedDir, "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningAllowed(t, allowed, err)
+
+	// 2 invalid signatures
+	invalidDir := createSigstoreSignedDir(t, simpleSig, unknownKeySig)
+	defer os.RemoveAll(invalidDir)
+	image, closer = dirImageMock(t, invalidDir, "testing/manifest:latest")
+	defer closer()
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejected(t, allowed, err)
+}
@@ -21,9 +21,9 @@ func (pr *prInsecureAcceptAnything) isRunningImageAllowed(ctx context.Context, i
 }
 
 func (pr *prReject) isSignatureAuthorAccepted(ctx context.Context, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
-	return sarRejected, nil, PolicyRequirementError(fmt.Sprintf("Any signatures for image %s are rejected by policy.", transports.ImageName(image.Reference())))
+	return sarRejected, nil, newPolicyRequirementError(PolicyRejectionReasonRejectedByPolicy, fmt.Sprintf("Any signatures for image %s are rejected by policy.", transports.ImageName(image.Reference())))
 }
 
 func (pr *prReject) isRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (bool, error) {
-	return false, PolicyRequirementError(fmt.Sprintf("Running image %s is rejected by policy.", transports.ImageName(image.Reference())))
+	return false, newPolicyRequirementError(PolicyRejectionReasonRejectedByPolicy, fmt.Sprintf("Running image %s is rejected by policy.", transports.ImageName(image.Reference())))
 }
@@ -3,14 +3,17 @@ package signature
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/containers/image/docker"
 	"github.com/containers/image/docker/policyconfiguration"
 	"github.com/containers/image/docker/reference"
 	"github.com/containers/image/transports"
 	"github.com/containers/image/types"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -39,6 +42,72 @@ func TestPolicyContextChangeState(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestPolicyContextStartFinishEvaluation(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{Default: PolicyRequirements{NewPRReject()}})
+	require.NoError(t, err)
+
+	// Nested evaluations
+	err = pc.startEvaluation()
+	require.NoError(t, err)
+	assert.Equal(t, pcInUse, pc.state)
+	err = pc.startEvaluation()
+	require.NoError(t, err)
+	assert.Equal(t, pcInUse, pc.state)
+	assert.Equal(t, 2, pc.inUseCount)
+	err = pc.Destroy()
+	assert.Error(t, err)
+	err = pc.finishEvaluation()
+	require.NoError(t, err)
+	assert.Equal(t, pcInUse, pc.state)
+	err = pc.finishEvaluation()
+	require.NoError(t, err)
+	assert.Equal(t, pcReady, pc.state)
+	assert.Equal(t, 0, pc.inUseCount)
+
+	// Unbalanced finishEvaluation
+	err = pc.finishEvaluation()
+	assert.Error(t, err)
+	assert.Equal(t, pcReady, pc.state)
+
+	// Evaluation after Destroy
+	err = pc.Destroy()
+	require.NoError(t, err)
+	err = pc.startEvaluation()
+	assert.Error(t, err)
+	assert.Equal(t, pcDestroyed, pc.state)
+}
+
+func TestPolicyContextConcurrentEvaluation(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{
+			xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+		},
+	})
+	require.NoError(t, err)
+
+	img, closer := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+
+	const goroutines = 10
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			res, err := pc.IsRunningImageAllowed(context.Background(), img)
+			if err == nil && !res {
+				err = errors.New("Image unexpectedly rejected")
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < goroutines; i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	assert.Equal(t, pcReady, pc.state)
+	err = pc.Destroy()
+	assert.NoError(t, err)
+}
+
 func TestPolicyContextNewDestroy(t *testing.T) {
 	pc, err := NewPolicyContext(&Policy{Default: PolicyRequirements{NewPRReject()}})
 	require.NoError(t, err)
@@ -131,9 +200,11 @@ func TestPolicyContextRequirementsForImageRefNotRegisteredTransport(t *testing.T
 	require.NoError(t, err)
 	ref, err := reference.ParseNormalizedNamed("registry.access.redhat.com/rhel7:latest")
 	require.NoError(t, err)
-	reqs := pc.requirementsForImageRef(pcImageReferenceMock{"docker", ref})
+	reqs, scopeTransport, scope := pc.requirementsForImageRef(pcImageReferenceMock{"docker", ref})
 	assert.True(t, &(reqs[0]) == &(pr[0]))
 	assert.True(t, len(reqs) == len(pr))
+	assert.Equal(t, "docker", scopeTransport)
+	assert.Equal(t, "registry.access.redhat.com", scope)
 
 }
 
@@ -156,6 +227,10 @@ func TestPolicyContextRequirementsForImageRef(t *testing.T) {
 		{"docker", "deep.com/n1/n2/n3"},
 		{"docker", "deep.com/n1/n2/n3/repo"},
 		{"docker", "deep.com/n1/n2/n3/repo:tag2"},
+		{"docker", "deep.com/n1/n2/*"},
+		{"docker", "*.example.com"},
+		{"docker", "*.sub.example.com"},
+		{"docker", "reg.example.com/team/*"},
 		{"atomic", "unmatched"},
 	} {
 		if _, ok := policy.Transports[t.transport]; !ok {
@@ -172,13 +247,24 @@ func TestPolicyContextRequirementsForImageRef(t *testing.T) {
 		{"docker", "deep.com/n1/n2/n3/repo:tag2", "docker", "deep.com/n1/n2/n3/repo:tag2"},
 		// Namespace matches
 		{"docker", "deep.com/n1/n2/n3/repo:nottag2", "docker", "deep.com/n1/n2/n3/repo"},
+		{"docker", "deep.com/n1/n2/n3/repo@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "docker", "deep.com/n1/n2/n3/repo"},
+		{"docker", "deep.com/n1/n2/n3/repo:tag2@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "docker", "deep.com/n1/n2/n3/repo:tag2"},
 		{"docker", "deep.com/n1/n2/n3/notrepo:tag2", "docker", "deep.com/n1/n2/n3"},
 		{"docker", "deep.com/n1/n2/notn3/repo:tag2", "docker", "deep.com/n1/n2"},
 		{"docker", "deep.com/n1/notn2/n3/repo:tag2", "docker", "deep.com/n1"},
 		// Host name match
 		{"docker", "deep.com/notn1/n2/n3/repo:tag2", "docker", "deep.com"},
+		// Wildcard matches, the most specific one wins
+		{"docker", "a.example.com/repo:tag", "docker", "*.example.com"},
+		{"docker", "a.sub.example.com/repo:tag", "docker", "*.sub.example.com"},
+		{"docker", "reg.example.com/team/repo:tag", "docker", "reg.example.com/team/*"},
+		{"docker", "reg.example.com/team/nested/repo:tag", "docker", "reg.example.com/team/*"},
+		{"docker", "reg.example.com/other/repo:tag", "docker", "*.example.com"},
+		// Namespace matches take precedence over wildcard matches
+		{"docker", "deep.com/n1/n2/notn3/repo:tag2", "docker", "deep.com/n1/n2"},
 		// Default
 		{"docker", "this.doesnt/match:anything", "docker", ""},
+		{"docker", "example.com/repo:tag", "docker", ""},
 		// No match within a matched transport which doesn't have a "" scope
 		{"atomic", "this.doesnt/match:anything", "", ""},
 		// No configuration available for this transport at all
@@ -195,13 +281,38 @@ func TestPolicyContextRequirementsForImageRef(t *testing.T) {
 
 		ref, err := reference.ParseNormalizedNamed(c.input)
 		require.NoError(t, err)
-		reqs := pc.requirementsForImageRef(pcImageReferenceMock{c.inputTransport, ref})
+		reqs, scopeTransport, scope := pc.requirementsForImageRef(pcImageReferenceMock{c.inputTransport, ref})
 		comment := fmt.Sprintf("case %s:%s: %#v", c.inputTransport, c.input, reqs[0])
+		assert.Equal(t, c.matchedTransport, scopeTransport, comment)
+		assert.Equal(t, c.matched, scope, comment)
 		// Do not use assert.Equal, which would do a deep contents comparison; we want to compare
 		// the pointers. Also, == does not work on slices; so test that the slices start at the
 		// same element and have the same length.
 		assert.True(t, &(reqs[0]) == &(expected[0]), comment)
 		assert.True(t, len(reqs) == len(expected), comment)
+
+		scopeTransport, scope, err = pc.PolicyScopeForImage(pcImageReferenceMock{c.inputTransport, ref})
+		require.NoError(t, err, comment)
+		assert.Equal(t, c.matchedTransport, scopeTransport, comment)
+		assert.Equal(t, c.matched, scope, comment)
+	}
+
+	// PolicyScopeForImage fails on a destroyed context
+	err = pc.Destroy()
+	require.NoError(t, err)
+	ref, err := reference.ParseNormalizedNamed("deep.com/n1/n2/n3/repo:tag2")
+	require.NoError(t, err)
+	_, _, err = pc.PolicyScopeForImage(pcImageReferenceMock{"docker", ref})
+	assert.Error(t, err)
+}
+
+// dirImageFixtureSignature returns the Signature contained in "dir-img-*/signature-1", with timestamp replaced by the specified value.
+func dirImageFixtureSignature(timestamp int64) Signature {
+	return Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+		CreatorID:            TestDirImageSignatureCreatorID,
+		Timestamp:            time.Unix(timestamp, 0),
 	}
 }
 
@@ -214,10 +325,8 @@ func pcImageMock(t *testing.T, dir, dockerReference string) (types.UnparsedImage
 }
 
 func TestPolicyContextGetSignaturesWithAcceptedAuthor(t *testing.T) {
-	expectedSig := &Signature{
-		DockerManifestDigest: TestImageManifestDigest,
-		DockerReference:      "testing/manifest:latest",
-	}
+	fixtureSig := dirImageFixtureSignature(TestDirImageSignatureTimestamp)
+	expectedSig := &fixtureSig
 
 	pc, err := NewPolicyContext(&Policy{
 		Default: PolicyRequirements{NewPRReject()},
@@ -268,7 +377,8 @@ func TestPolicyContextGetSignaturesWithAcceptedAuthor(t *testing.T) {
 	defer closer()
 	sigs, err = pc.GetSignaturesWithAcceptedAuthor(context.Background(), img)
 	require.NoError(t, err)
-	assert.Equal(t, []*Signature{expectedSig, expectedSig}, sigs)
+	fixtureSig2 := dirImageFixtureSignature(TestDirImageSignature2Timestamp)
+	assert.Equal(t, []*Signature{expectedSig, &fixtureSig2}, sigs)
 
 	// No signatures
 	img, closer = pcImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
@@ -363,6 +473,103 @@ func TestPolicyContextGetSignaturesWithAcceptedAuthor(t *testing.T) {
 	sigs, err = pc.GetSignaturesWithAcceptedAuthor(context.Background(), img)
 	assert.Error(t, err)
 	assert.Nil(t, sigs)
+
+	// Cancelled context
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	img, closer = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	sigs, err = pc.GetSignaturesWithAcceptedAuthor(cancelledCtx, img)
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, sigs)
+}
+
+func TestPolicyContextEvaluateSignatures(t *testing.T) {
+	fixtureSig := dirImageFixtureSignature(TestDirImageSignatureTimestamp)
+	expectedSig := &fixtureSig
+	accepting := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository())
+	rejecting := NewPRReject()
+	unknown := NewPRInsecureAcceptAnything()
+
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest":        {accepting},
+				"docker.io/testing/manifest:acceptUnknown": {accepting, unknown},
+				"docker.io/testing/manifest:unknownReject": {unknown, rejecting, accepting},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer pc.Destroy()
+
+	// 1 invalid, 1 valid signature (in this order)
+	img, closer := pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest")
+	defer closer()
+	evaluations, err := pc.EvaluateSignatures(context.Background(), img)
+	require.NoError(t, err)
+	require.Len(t, evaluations, 2)
+	assert.False(t, evaluations[0].Accepted)
+	assert.Nil(t, evaluations[0].Signature)
+	require.Len(t, evaluations[0].Requirements, 1)
+	assert.Equal(t, 0, evaluations[0].Requirements[0].RequirementIndex)
+	assert.Equal(t, accepting, evaluations[0].Requirements[0].Requirement)
+	assert.Equal(t, SignatureRequirementRejected, evaluations[0].Requirements[0].Result)
+	assert.Error(t, evaluations[0].Requirements[0].Err)
+	assert.Equal(t, SignatureEvaluation{
+		Accepted:  true,
+		Signature: expectedSig,
+		Requirements: []SignatureRequirementEvaluation{
+			{RequirementIndex: 0, Requirement: accepting, Result: SignatureRequirementAccepted},
+		},
+	}, evaluations[1])
+
+	// sarAccepted+sarUnknown
+	img, closer = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:acceptUnknown")
+	defer closer()
+	evaluations, err = pc.EvaluateSignatures(context.Background(), img)
+	require.NoError(t, err)
+	assert.Equal(t, []SignatureEvaluation{{
+		Accepted:  true,
+		Signature: expectedSig,
+		Requirements: []SignatureRequirementEvaluation{
+			{RequirementIndex: 0, Requirement: accepting, Result: SignatureRequirementAccepted},
+			{RequirementIndex: 1, Requirement: unknown, Result: SignatureRequirementUnknown},
+		},
+	}}, evaluations)
+
+	// sarUnknown+sarRejected: the evaluation stops at the rejecting requirement
+	img, closer = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:unknownReject")
+	defer closer()
+	evaluations, err = pc.EvaluateSignatures(context.Background(), img)
+	require.NoError(t, err)
+	require.Len(t, evaluations, 1)
+	assert.False(t, evaluations[0].Accepted)
+	assert.Nil(t, evaluations[0].Signature)
+	require.Len(t, evaluations[0].Requirements, 2)
+	assert.Equal(t, SignatureRequirementEvaluation{RequirementIndex: 0, Requirement: unknown, Result: SignatureRequirementUnknown},
+		evaluations[0].Requirements[0])
+	assert.Equal(t, 1, evaluations[0].Requirements[1].RequirementIndex)
+	assert.Equal(t, rejecting, evaluations[0].Requirements[1].Requirement)
+	assert.Equal(t, SignatureRequirementRejected, evaluations[0].Requirements[1].Result)
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonRejectedByPolicy, evaluations[0].Requirements[1].Err)
+
+	// No signatures
+	img, closer = pcImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
+	defer closer()
+	evaluations, err = pc.EvaluateSignatures(context.Background(), img)
+	require.NoError(t, err)
+	assert.Empty(t, evaluations)
+
+	// Error reading signatures.
+	invalidSigDir := createInvalidSigDir(t)
+	defer os.RemoveAll(invalidSigDir)
+	img, closer = pcImageMock(t, invalidSigDir, "testing/manifest:latest")
+	defer closer()
+	evaluations, err = pc.EvaluateSignatures(context.Background(), img)
+	assert.Error(t, err)
+	assert.Nil(t, evaluations)
 }
 
 func TestPolicyContextIsRunningImageAllowed(t *testing.T) {
@@ -467,6 +674,130 @@ func TestPolicyContextIsRunningImageAllowed(t *testing.T) {
 	// Not testing the pcInUse->pcReady transition, that would require custom PolicyRequirement
 	// implementations meddling with the state, or threads. This is for catching trivial programmer
 	// mistakes only, anyway.
+	// Cancelled context
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	img, closer = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	res, err = pc.IsRunningImageAllowed(cancelledCtx, img)
+	assertRunningRejected(t, res, err)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestPolicyContextIsRunningImageAllowedRejectionError(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+				},
+				"docker.io/testing/manifest:reject": {
+					NewPRReject(),
+				},
+				"docker.io/testing/manifest:invalidEmptyRequirements": {},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer pc.Destroy()
+
+	for _, c := range []struct {
+		dir, ref                               string
+		requirementType, scopeTransport, scope string
+		reason                                 PolicyRejectionReason
+	}{
+		{"fixtures/dir-img-valid", "testing/manifest:reject", "reject", "docker", "docker.io/testing/manifest:reject", PolicyRejectionReasonRejectedByPolicy},
+		{"fixtures/dir-img-valid", "testing/other:latest", "reject", "", "", PolicyRejectionReasonRejectedByPolicy},
+		{"fixtures/dir-img-valid", "testing/manifest:invalidEmptyRequirements", "", "docker", "docker.io/testing/manifest:invalidEmptyRequirements", PolicyRejectionReasonRejectedByPolicy},
+		{"fixtures/dir-img-unsigned", "testing/manifest:latest", "signedBy", "docker", "docker.io/testing/manifest", PolicyRejectionReasonNoSignatures},
+		{"fixtures/dir-img-modified-manifest", "testing/manifest:latest", "signedBy", "docker", "docker.io/testing/manifest", PolicyRejectionReasonIdentityMismatch},
+		{"fixtures/dir-img-valid", "testing/manifest:notlatest", "signedBy", "docker", "docker.io/testing/manifest", PolicyRejectionReasonIdentityMismatch},
+	} {
+		img, closer := pcImageMock(t, c.dir, c.ref)
+		defer closer()
+		res, err := pc.IsRunningImageAllowed(context.Background(), img)
+		assertRunningRejectedPolicyRequirement(t, res, err)
+		require.IsType(t, PolicyRejectionError{}, err, c.ref)
+		rejection := err.(PolicyRejectionError)
+		assert.Equal(t, c.requirementType, rejection.RequirementType, c.ref)
+		assert.Equal(t, c.scopeTransport, rejection.ScopeTransport, c.ref)
+		assert.Equal(t, c.scope, rejection.Scope, c.ref)
+		assert.Equal(t, c.reason, rejection.Reason, c.ref)
+		assert.Equal(t, rejection.Err.Error(), rejection.Error(), c.ref)
+		assert.Equal(t, rejection.Err, errors.Cause(err), c.ref)
+		// Callers checking for the PolicyRequirementError type continue to work.
+		assert.IsType(t, PolicyRequirementError(""), errors.Cause(err), c.ref)
+	}
+}
+
+func TestPolicyRejectionReason(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		reason PolicyRejectionReason
+	}{
+		{newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, "untrusted"), PolicyRejectionReasonUntrustedKey},
+		{errors.Wrap(newPolicyRequirementError(PolicyRejectionReasonIdentityMismatch, "mismatch"), "wrapped"), PolicyRejectionReasonIdentityMismatch},
+		{InvalidSignatureError{msg: "invalid"}, PolicyRejectionReasonInvalidSignature},
+		{PolicyRejectionError{Reason: PolicyRejectionReasonNoSignatures, Err: PolicyRequirementError("no signatures")}, PolicyRejectionReasonNoSignatures},
+		{PolicyRequirementError("unclassified"), PolicyRejectionReasonUnknown},
+		{errors.New("other"), PolicyRejectionReasonUnknown},
+	} {
+		assert.Equal(t, c.reason, policyRejectionReason(c.err), c.err.Error())
+	}
+
+	// newPolicyRequirementError preserves the error text, and the PolicyRequirementError type for errors.Cause.
+	err := newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, "message")
+	assert.Equal(t, "message", err.Error())
+	assert.Equal(t, PolicyRequirementError("message"), errors.Cause(errors.Wrap(err, "wrapped")))
+}
+
+func TestPolicyContextSigningMechanismFactory(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{
+			xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+		},
+	})
+	require.NoError(t, err)
+	defer pc.Destroy()
+
+	img, closer := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+
+	// The injected factory is used, and receives the trusted keys.
+	var usedKeyBlobs [][]byte
+	pc.SigningMechanismFactory = func(keyBlobs [][]byte) (SigningMechanism, []string, error) {
+		usedKeyBlobs = keyBlobs
+		return newEphemeralGPGSigningMechanism(keyBlobs)
+	}
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	keyData, err := ioutil.ReadFile("fixtures/public-key.gpg")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{keyData}, usedKeyBlobs)
+
+	usedKeyBlobs = nil
+	sigs, err := pc.GetSignaturesWithAcceptedAuthor(context.Background(), img)
+	require.NoError(t, err)
+	assert.Len(t, sigs, 1)
+	assert.Equal(t, [][]byte{keyData}, usedKeyBlobs)
+
+	// Errors returned by the factory are reported.
+	pc.SigningMechanismFactory = func(keyBlobs [][]byte) (SigningMechanism, []string, error) {
+		return nil, nil, errors.New("mechanism unavailable")
+	}
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejected(t, res, err)
+	sigs, err = pc.GetSignaturesWithAcceptedAuthor(context.Background(), img)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+
+	// A factory which does not trust any keys
+	pc.SigningMechanismFactory = func(keyBlobs [][]byte) (SigningMechanism, []string, error) {
+		return newEphemeralGPGSigningMechanism([][]byte{})
+	}
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
 }
 
 // Helpers for validating PolicyRequirement.isSignatureAuthorAccepted results:
@@ -479,6 +810,24 @@ func assertSARAccepted(t *testing.T, sar signatureAcceptanceResult, parsedSig *S
 	assert.NoError(t, err)
 }
 
+// assertPolicyRequirementError verifies that err is a PolicyRequirementError, possibly with a PolicyRejectionReason,
+// or a PolicyRejectionError wrapping one.
+func assertPolicyRequirementError(t *testing.T, err error) {
+	switch e := err.(type) {
+	case PolicyRequirementError, policyRequirementReasonError:
+	case PolicyRejectionError:
+		assertPolicyRequirementError(t, e.Err)
+	default:
+		assert.Fail(t, fmt.Sprintf("Unexpected error type %T: %v", err, err))
+	}
+}
+
+// assertPolicyRequirementErrorReason verifies that err is a PolicyRequirementError with reason.
+func assertPolicyRequirementErrorReason(t *testing.T, reason PolicyRejectionReason, err error) {
+	assert.IsType(t, policyRequirementReasonError{}, err)
+	assert.Equal(t, reason, policyRejectionReason(err))
+}
+
 // assertSARRejected verifies that isSignatureAuthorAccepted returns a consistent sarRejected result.
 func assertSARRejected(t *testing.T, sar signatureAcceptanceResult, parsedSig *Signature, err error) {
 	assert.Equal(t, sarRejected, sar)
@@ -490,7 +839,7 @@ func assertSARRejected(t *testing.T, sar signatureAcceptanceResult, parsedSig *S
 // and that the returned error is a PolicyRequirementError..
 func assertSARRejectedPolicyRequirement(t *testing.T, sar signatureAcceptanceResult, parsedSig *Signature, err error) {
 	assertSARRejected(t, sar, parsedSig, err)
-	assert.IsType(t, PolicyRequirementError(""), err)
+	assertPolicyRequirementError(t, err)
 }
 
 // assertSARRejected verifies that isSignatureAuthorAccepted returns a consistent sarUnknown result.
@@ -518,5 +867,5 @@ func assertRunningRejected(t *testing.T, allowed bool, err error) {
 // and that the returned error is a PolicyRequirementError.
 func assertRunningRejectedPolicyRequirement(t *testing.T, allowed bool, err error) {
 	assertRunningRejected(t, allowed, err)
-	assert.IsType(t, PolicyRequirementError(""), err)
+	assertPolicyRequirementError(t, err)
 }
@@ -0,0 +1,79 @@
+// Policy evaluation for prSignedByThreshold.
+
+package signature
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/types"
+)
+
+func (pr *prSignedByThreshold) isSignatureAuthorAccepted(ctx context.Context, image types.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	mech, trustedIdentities, err := pr.newSigningMechanism(ctx)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	defer mech.Close()
+
+	signature, _, err := verifyGPGSignatureForImage(ctx, mech, trustedIdentities, pr.SignedIdentity, nil, image, sig)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	return sarAccepted, signature, nil
+}
+
+func (pr *prSignedByThreshold) isRunningImageAllowed(ctx context.Context, image types.UnparsedImage) (bool, error) {
+	sigs, err := imageSignatures(ctx, image)
+	if err != nil {
+		return false, err
+	}
+	if len(sigs) == 0 {
+		return false, newPolicyRequirementError(PolicyRejectionReasonNoSignatures, "A signature was required, but no signature exists")
+	}
+
+	mech, trustedIdentities, err := pr.newSigningMechanism(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer mech.Close()
+
+	// Several signatures by the same key count only once.
+	signingKeys := map[string]struct{}{}
+	var rejections []string
+	for _, sig := range sigs {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		_, keyIdentity, err := verifyGPGSignatureForImage(ctx, mech, trustedIdentities, pr.SignedIdentity, nil, sig.image, sig.signature)
+		if err != nil {
+			rejections = append(rejections, err.Error())
+			continue
+		}
+		signingKeys[keyIdentity] = struct{}{}
+		if len(signingKeys) >= pr.Threshold {
+			return true, nil
+		}
+	}
+	msg := fmt.Sprintf("At least %d signatures by different trusted keys were required, but only %d were accepted", pr.Threshold, len(signingKeys))
+	if len(rejections) != 0 {
+		msg = fmt.Sprintf("%s; rejected signatures: %s", msg, strings.Join(rejections, "; "))
+	}
+	return false, newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, msg)
+}
+
+// newSigningMechanism returns a SigningMechanism which recognizes only the keys in pr.KeyPaths, and the identities of these keys.
+// The caller must call .Close() on the returned SigningMechanism.
+func (pr *prSignedByThreshold) newSigningMechanism(ctx context.Context) (SigningMechanism, []string, error) {
+	// FIXME: move this to per-context initialization
+	keyData := [][]byte{}
+	for _, path := range pr.KeyPaths {
+		data, err := readKeyPath(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyData = append(keyData, data...)
+	}
+	return newTrustedGPGSigningMechanism(ctx, keyData)
+}
@@ -0,0 +1,223 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keyListMechanismMock is a SigningMechanism which trusts key identities listed in the key blobs,
+// and can sign using them; signatures are "$keyIdentity\n$contents".
+type keyListMechanismMock struct {
+	trusted []string
+}
+
+func newKeyListMechanismMock(keyBlobs [][]byte) (SigningMechanism, []string, error) {
+	m := &keyListMechanismMock{}
+	for _, blob := range keyBlobs {
+		m.trusted = append(m.trusted, strings.Fields(string(blob))...)
+	}
+	return m, m.trusted, nil
+}
+
+func (m *keyListMechanismMock) Close() error {
+	return nil
+}
+func (m *keyListMechanismMock) SupportsSigning() error {
+	return nil
+}
+func (m *keyListMechanismMock) Sign(input []byte, keyIdentity string) ([]byte, error) {
+	for _, trusted := range m.trusted {
+		if keyIdentity == trusted {
+			return append([]byte(keyIdentity+"\n"), input...), nil
+		}
+	}
+	return nil, errors.New("unknown key " + keyIdentity)
+}
+func (m *keyListMechanismMock) Verify(unverifiedSignature []byte) ([]byte, string, error) {
+	contents, keyIdentity, err := m.UntrustedSignatureContents(unverifiedSignature)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, trusted := range m.trusted {
+		if keyIdentity == trusted {
+			return contents, keyIdentity, nil
+		}
+	}
+	return nil, "", InvalidSignatureError{msg: "unknown key " + keyIdentity}
+}
+func (m *keyListMechanismMock) UntrustedSignatureContents(untrustedSignature []byte) ([]byte, string, error) {
+	parts := strings.SplitN(string(untrustedSignature), "\n", 2)
+	if len(parts) != 2 {
+		return nil, "", errors.New("invalid signature")
+	}
+	return []byte(parts[1]), parts[0], nil
+}
+
+// thresholdImageMock is a types.UnparsedImage with replaced signatures.
+type thresholdImageMock struct {
+	types.UnparsedImage
+	sigs [][]byte
+}
+
+func (img thresholdImageMock) Signatures(ctx context.Context) ([][]byte, error) {
+	return img.sigs, nil
+}
+
+// keyListTestSignature returns a keyListMechanismMock signature by keyIdentity for manifestDigest and dockerReference.
+func keyListTestSignature(t *testing.T, keyIdentity string, manifestDigest digest.Digest, dockerReference string) []byte {
+	contents, err := untrustedSignature{
+		UntrustedDockerManifestDigest: manifestDigest,
+		UntrustedDockerReference:      dockerReference,
+	}.MarshalJSON()
+	require.NoError(t, err)
+	return append([]byte(keyIdentity+"\n"), contents...)
+}
+
+func TestPRSignedByThresholdIsSignatureAuthorAccepted(t *testing.T) {
+	ctx := context.WithValue(context.Background(), signingMechanismFactoryKey{}, SigningMechanismFactory(newKeyListMechanismMock))
+	keyDir, err := ioutil.TempDir("", "signedbythreshold")
+	require.NoError(t, err)
+	defer os.RemoveAll(keyDir)
+	keyPath := filepath.Join(keyDir, "keys")
+	err = ioutil.WriteFile(keyPath, []byte("A B"), 0644)
+	require.NoError(t, err)
+	img, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+
+	pr, err := NewPRSignedByThreshold(2, []string{keyPath}, NewPRMMatchExact())
+	require.NoError(t, err)
+
+	// A single signature by a trusted key is accepted
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(ctx, img, keyListTestSignature(t, "A", TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+
+	// A signature using a non-canonical digest algorithm
+	manifestBlob, err := ioutil.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	sha512Digest := digest.SHA512.FromBytes(manifestBlob)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(ctx, img, keyListTestSignature(t, "A", sha512Digest, "testing/manifest:latest"))
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: sha512Digest,
+		DockerReference:      "testing/manifest:latest",
+	})
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(ctx, img, keyListTestSignature(t, "A", digest.SHA512.FromString("other"), "testing/manifest:latest"))
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Untrusted key
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(ctx, img, keyListTestSignature(t, "C", TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Identity mismatch
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(ctx, img, keyListTestSignature(t, "A", TestImageManifestDigest, "testing/other:latest"))
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// Missing key path
+	pr, err = NewPRSignedByThreshold(1, []string{filepath.Join(keyDir, "this/does/not/exist")}, NewPRMMatchExact())
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(ctx, img, keyListTestSignature(t, "A", TestImageManifestDigest, "testing/manifest:latest"))
+	assertSARRejected(t, sar, parsedSig, err)
+}
+
+func TestPRSignedByThresholdIsRunningImageAllowed(t *testing.T) {
+	ctx := context.WithValue(context.Background(), signingMechanismFactoryKey{}, SigningMechanismFactory(newKeyListMechanismMock))
+	keyDir, err := ioutil.TempDir("", "signedbythreshold")
+	require.NoError(t, err)
+	defer os.RemoveAll(keyDir)
+	for name, contents := range map[string]string{
+		"a":       "A",
+		"b":       "B",
+		"c-and-d": "C D",
+		"empty":   "",
+	} {
+		err := ioutil.WriteFile(filepath.Join(keyDir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+	keyPaths := []string{filepath.Join(keyDir, "a"), filepath.Join(keyDir, "b"), filepath.Join(keyDir, "c-and-d")}
+	baseImg, closer := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	defer closer()
+	sigBy := func(keyIdentity string) []byte {
+		return keyListTestSignature(t, keyIdentity, TestImageManifestDigest, "testing/manifest:latest")
+	}
+	wrongIdentitySig := keyListTestSignature(t, "C", TestImageManifestDigest, "testing/other:latest")
+	wrongDigestSig := keyListTestSignature(t, "D", "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "testing/manifest:latest")
+
+	pr, err := NewPRSignedByThreshold(2, keyPaths, NewPRMMatchExact())
+	require.NoError(t, err)
+
+	// Success
+	for _, sigs := range [][][]byte{
+		{sigBy("A"), sigBy("B")},
+		{sigBy("C"), sigBy("D")},
+		{sigBy("X"), sigBy("A"), wrongIdentitySig, sigBy("D")},
+		{sigBy("A"), sigBy("B"), sigBy("C")},
+	} {
+		res, err := pr.isRunningImageAllowed(ctx, thresholdImageMock{UnparsedImage: baseImg, sigs: sigs})
+		assertRunningAllowed(t, res, err)
+	}
+
+	// Not enough signatures by different trusted keys
+	for _, sigs := range [][][]byte{
+		{sigBy("A")},
+		{sigBy("A"), sigBy("A")},
+		{sigBy("A"), sigBy("X")},
+		{sigBy("A"), wrongIdentitySig},
+		{sigBy("A"), wrongDigestSig},
+		{sigBy("A"), []byte("invalid signature")},
+	} {
+		res, err := pr.isRunningImageAllowed(ctx, thresholdImageMock{UnparsedImage: baseImg, sigs: sigs})
+		assertRunningRejectedPolicyRequirement(t, res, err)
+		assert.Equal(t, PolicyRejectionReasonUntrustedKey, policyRejectionReason(err))
+	}
+
+	// Signatures of the instance and of the manifest list it was selected from are both counted
+	listBlob := manifestListTestManifest(t, TestImageManifestDigest)
+	listDigest, err := manifest.Digest(listBlob)
+	require.NoError(t, err)
+	res, err := pr.isRunningImageAllowed(ctx, manifestListInstanceMock{
+		UnparsedImage: baseImg,
+		sigs:          [][]byte{sigBy("A")},
+		list: manifestListImageMock{
+			ref:      baseImg.Reference(),
+			manifest: listBlob,
+			sigs:     [][]byte{keyListTestSignature(t, "B", listDigest, "testing/manifest:latest")},
+		},
+	})
+	assertRunningAllowed(t, res, err)
+
+	// No signatures
+	res, err = pr.isRunningImageAllowed(ctx, thresholdImageMock{UnparsedImage: baseImg, sigs: [][]byte{}})
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assert.Equal(t, PolicyRejectionReasonNoSignatures, policyRejectionReason(err))
+
+	// Threshold higher than the number of signatures
+	pr, err = NewPRSignedByThreshold(3, keyPaths, NewPRMMatchExact())
+	require.NoError(t, err)
+	res, err = pr.isRunningImageAllowed(ctx, thresholdImageMock{UnparsedImage: baseImg, sigs: [][]byte{sigBy("A"), sigBy("B")}})
+	assertRunningRejectedPolicyRequirement(t, res, err)
+
+	// No trusted keys
+	pr, err = NewPRSignedByThreshold(1, []string{filepath.Join(keyDir, "empty")}, NewPRMMatchExact())
+	require.NoError(t, err)
+	res, err = pr.isRunningImageAllowed(ctx, thresholdImageMock{UnparsedImage: baseImg, sigs: [][]byte{sigBy("A")}})
+	assertRunningRejectedPolicyRequirement(t, res, err)
+
+	// Missing key path
+	pr, err = NewPRSignedByThreshold(1, []string{filepath.Join(keyDir, "this/does/not/exist")}, NewPRMMatchExact())
+	require.NoError(t, err)
+	res, err = pr.isRunningImageAllowed(ctx, thresholdImageMock{UnparsedImage: baseImg, sigs: [][]byte{sigBy("A")}})
+	assertRunningRejected(t, res, err)
+}
@@ -295,6 +295,114 @@ func TestPRMMatchRepositoryMatchesDockerReference(t *testing.T) {
 	assert.False(t, res, `unidentified vs. ""`)
 }
 
+func TestPRMRemapIdentityRefMatchesPrefix(t *testing.T) {
+	for _, c := range []struct {
+		ref, prefix string
+		expected    bool
+	}{
+		// Prefix is a reference.Domain() value
+		{"docker.io/image", "docker.io", true},
+		{"docker.io/image", "example.com", false},
+		{"example.com:5000/image", "example.com:5000", true},
+		{"example.com:50000/image", "example.com:5000", false},
+		{"example.com:5000/image", "example.com", false},
+		{"example.com/foo", "example.com", true},
+		{"example.com/foo/bar", "example.com", true},
+		{"example.com/foo/bar:baz", "example.com", true},
+		{"example.com/foo/bar" + digestSuffix, "example.com", true},
+		// Prefix is a reference.Named.Name() value or a repo namespace
+		{"docker.io/ns/image", "docker.io/library", false},
+		{"example.com/library", "docker.io/library", false},
+		{"docker.io/libraryy/image", "docker.io/library", false},
+		{"docker.io/library/busybox", "docker.io/library", true},
+		{"example.com/ns/image", "example.com/ns", true},
+		{"example.com/ns2/image", "example.com/ns", false},
+		{"example.com/n2/image", "example.com/ns", false},
+		{"example.com/ns", "example.com/ns", true},
+		{"example.com/ns", "example.com/ns/image", false},
+		{"example.com:5000/ns/image", "example.com/ns", false},
+		{"example.com/ns/image:tag", "example.com/ns", true},
+		{"example.com/ns/image" + digestSuffix, "example.com/ns", true},
+		{"example.com/ns/image:tag" + digestSuffix, "example.com/ns", true},
+	} {
+		prm, err := newPRMRemapIdentity(c.prefix, "docker.io/library/signed")
+		require.NoError(t, err, c.prefix)
+		ref, err := reference.ParseNormalizedNamed(c.ref)
+		require.NoError(t, err, c.ref)
+		res := prm.refMatchesPrefix(ref)
+		assert.Equal(t, c.expected, res, fmt.Sprintf("%s vs. %s", c.ref, c.prefix))
+	}
+}
+
+func TestPRMRemapIdentityRemapReferencePrefix(t *testing.T) {
+	for _, c := range []struct{ prefix, signedPrefix, ref, expected string }{
+		// Match sanity checking, primarily tested in TestPRMRemapIdentityRefMatchesPrefix
+		{"mirror.example", "vendor.example", "mirror.example/ns/image:tag", "vendor.example/ns/image:tag"},
+		{"mirror.example", "vendor.example", "different.com/ns/image:tag", "different.com/ns/image:tag"},
+		{"mirror.example/ns", "vendor.example/vendor-ns", "mirror.example/different-ns/image:tag", "mirror.example/different-ns/image:tag"},
+		{"mirror.example", "vendor.example", "prefixmirror.example/ns/image:tag", "prefixmirror.example/ns/image:tag"},
+		// Rewrites work as expected
+		{"example.com/mirror", "example.com/vendor", "example.com/mirror/image:tag", "example.com/vendor/image:tag"},
+		{"example.com/ns/mirror", "example.com/ns/vendor", "example.com/ns/mirror:tag", "example.com/ns/vendor:tag"},
+		{"docker.io", "not-docker-signed.example", "busybox", "not-docker-signed.example/library/busybox"},
+		{"docker.io", "not-docker-signed.example/ns", "busybox", "not-docker-signed.example/ns/library/busybox"},
+		{"docker.io/library", "not-docker-signed.example/ns", "busybox", "not-docker-signed.example/ns/busybox"},
+		{"docker.io/library/busybox", "not-docker-signed.example/ns/notbusybox", "busybox", "not-docker-signed.example/ns/notbusybox"},
+		// On the rewrite boundary
+		{"example.com/mirror", "example.com/vendor", "example.com/mirror:tag", "example.com/vendor:tag"},
+		{"example.com/mirror", "example.com/vendor", "example.com/mirror" + digestSuffix, "example.com/vendor" + digestSuffix},
+		{"example.com/mirror", "example.com/vendor", "example.com/mirror:tag" + digestSuffix, "example.com/vendor:tag" + digestSuffix},
+		// Rewriting to docker.io uses the canonical (fully-qualified) form
+		{"not-docker-signed.example/ns", "docker.io/library", "not-docker-signed.example/ns/busybox:tag", "docker.io/library/busybox:tag"},
+	} {
+		testName := fmt.Sprintf("%#v", c)
+		prm, err := newPRMRemapIdentity(c.prefix, c.signedPrefix)
+		require.NoError(t, err, testName)
+		ref, err := reference.ParseNormalizedNamed(c.ref)
+		require.NoError(t, err, testName)
+		res, err := prm.remapReferencePrefix(ref)
+		require.NoError(t, err, testName)
+		assert.Equal(t, c.expected, res.String(), testName)
+	}
+}
+
+func TestPRMRemapIdentityMatchesDockerReference(t *testing.T) {
+	// Basic sanity checks. More detailed testing is done in TestPRMRemapIdentityRemapReferencePrefix
+	// and TestPMMMatchRepoDigestOrExactMatchesDockerReference.
+	for _, c := range []struct {
+		prefix, signedPrefix, imageRef, sigRef string
+		result                                 bool
+	}{
+		// No match rewriting
+		{"does-not-match.com", "does-not-match.rewritten", "busybox:latest", "busybox:latest", true},
+		{"does-not-match.com", "does-not-match.rewritten", fullRHELRef, fullRHELRef, true},
+		{"does-not-match.com", "does-not-match.rewritten", "busybox:latest", "busybox:notlatest", false},
+		{"does-not-match.com", "does-not-match.rewritten", "busybox" + digestSuffix, "busybox:latest", true},
+		{"does-not-match.com", "does-not-match.rewritten", "busybox", "busybox:latest", false},
+		// Match rewriting non-docker
+		{"mirror.example", "vendor.example", "mirror.example/ns/image:tag", "vendor.example/ns/image:tag", true},
+		{"mirror.example", "vendor.example", "mirror.example/ns/image:tag", "vendor.example/ns/image:other", false},
+		{"mirror.example", "vendor.example", "mirror.example/ns/image:tag", "mirror.example/ns/image:tag", false},
+		{"mirror.example", "vendor.example", "mirror.example/ns/image" + digestSuffix, "vendor.example/ns/image:tag", true},
+		// Rewriting to and from docker.io
+		{"docker.io/library", "not-docker-signed.example/ns", "busybox:latest", "not-docker-signed.example/ns/busybox:latest", true},
+		{"docker.io/library", "not-docker-signed.example/ns", "busybox:latest", "busybox:latest", false},
+		{"not-docker-signed.example/ns", "docker.io/library", "not-docker-signed.example/ns/busybox:latest", "busybox:latest", true},
+		{"not-docker-signed.example/ns", "docker.io/library", "not-docker-signed.example/ns/busybox:latest", "docker.io/library/busybox:latest", true},
+		// Invalid signature reference
+		{"mirror.example", "vendor.example", "mirror.example/ns/image:tag", "UPPERCASE/ns/image:tag", false},
+	} {
+		prm, err := NewPRMRemapIdentity(c.prefix, c.signedPrefix)
+		require.NoError(t, err, c.prefix)
+		testImageAndSig(t, prm, c.imageRef, c.sigRef, c.result)
+	}
+	// Even if they are signed with an empty string as a reference, unidentified images are rejected.
+	prm, err := NewPRMRemapIdentity("docker.io", "docker.io")
+	require.NoError(t, err)
+	res := prm.matchesDockerReference(refImageMock{nil}, "")
+	assert.False(t, res, `unidentified vs. ""`)
+}
+
 func TestParseDockerReferences(t *testing.T) {
 	const (
 		ok1  = "busybox"
@@ -15,6 +15,10 @@ type Policy struct {
 	// if the image matches none of the scopes.
 	Default    PolicyRequirements               `json:"default"`
 	Transports map[string]PolicyTransportScopes `json:"transports"`
+	// AllowFragments allows DefaultPolicy to merge policy fragments from the system policy fragment directory into this policy.
+	// Fragments can add scopes which are more specific than, and therefore override, Default and other scopes,
+	// so this must only be set if any fragment is trusted to do so.
+	AllowFragments bool `json:"allowFragments,omitempty"`
 }
 
 // PolicyTransportScopes defines policies for images for a specific transport,
@@ -38,6 +42,11 @@ type prCommon struct {
 	Type prTypeIdentifier `json:"type"`
 }
 
+// requirementType returns the "type" of the requirement, as used in the JSON encoding.
+func (c prCommon) requirementType() prTypeIdentifier {
+	return c.Type
+}
+
 // prTypeIdentifier is string designating a kind of a PolicyRequirement.
 type prTypeIdentifier string
 
@@ -46,6 +55,10 @@ const (
 	prTypeReject                 prTypeIdentifier = "reject"
 	prTypeSignedBy               prTypeIdentifier = "signedBy"
 	prTypeSignedBaseLayer        prTypeIdentifier = "signedBaseLayer"
+	prTypeSigstoreSigned         prTypeIdentifier = "sigstoreSigned"
+	prTypeSignedByThreshold      prTypeIdentifier = "signedByThreshold"
+	prTypeNotationSigned         prTypeIdentifier = "notationSigned"
+	prTypeNotarySigned           prTypeIdentifier = "notarySigned"
 )
 
 // prInsecureAcceptAnything is a PolicyRequirement with type = prTypeInsecureAcceptAnything:
@@ -66,19 +79,34 @@ type prReject struct {
 type prSignedBy struct {
 	prCommon
 
-	// KeyType specifies what kind of key reference KeyPath/KeyData is.
+	// KeyType specifies what kind of key reference KeyPath/KeyPaths/KeyData is.
 	// Acceptable values are “GPGKeys” | “signedByGPGKeys” “X.509Certificates” | “signedByX.509CAs”
 	// FIXME: eventually also support GPGTOFU, X.509TOFU, with KeyPath only
 	KeyType sbKeyType `json:"keyType"`
 
-	// KeyPath is a pathname to a local file containing the trusted key(s). Exactly one of KeyPath and KeyData must be specified.
+	// KeyPath is a pathname to a local file, or a directory of files, containing the trusted key(s).
+	// Exactly one of KeyPath, KeyPaths and KeyData must be specified.
 	KeyPath string `json:"keyPath,omitempty"`
-	// KeyData contains the trusted key(s), base64-encoded. Exactly one of KeyPath and KeyData must be specified.
+	// KeyPaths is a set of pathnames to local files, or directories of files, containing the trusted key(s);
+	// a signature by any of the keys is accepted. Exactly one of KeyPath, KeyPaths and KeyData must be specified.
+	KeyPaths []string `json:"keyPaths,omitempty"`
+	// KeyData contains the trusted key(s), base64-encoded. Exactly one of KeyPath, KeyPaths and KeyData must be specified.
 	KeyData []byte `json:"keyData,omitempty"`
 
 	// SignedIdentity specifies what image identity the signature must be claiming about the image.
 	// Defaults to "match-exact" if not specified.
 	SignedIdentity PolicyReferenceMatch `json:"signedIdentity"`
+
+	// KeyFingerprints, if not empty, restricts the accepted keys to those with the listed full (40 or 64 hexadecimal digits) fingerprints,
+	// even if KeyPath/KeyPaths/KeyData contain other keys. Only supported with KeyType == “GPGKeys”.
+	KeyFingerprints []string `json:"keyFingerprints,omitempty"`
+
+	// MaxSignatureAgeSeconds, if not 0, is the maximum age of accepted signatures, based on the creation timestamp
+	// recorded in the signature; signatures without a timestamp are rejected. Only supported with KeyType == “GPGKeys”.
+	MaxSignatureAgeSeconds int64 `json:"maxSignatureAgeSeconds,omitempty"`
+	// RejectExpiredSignatures, if true, causes signatures past the expiration time recorded in the signature to be rejected.
+	// Only supported with KeyType == “GPGKeys”.
+	RejectExpiredSignatures bool `json:"rejectExpiredSignatures,omitempty"`
 }
 
 // sbKeyType are the allowed values for prSignedBy.KeyType
@@ -104,6 +132,95 @@ type prSignedBaseLayer struct {
 	BaseLayerIdentity PolicyReferenceMatch `json:"baseLayerIdentity"`
 }
 
+// prSigstoreSigned is a PolicyRequirement with type = prTypeSigstoreSigned: the image is signed by a sigstore (cosign-style)
+// signature made by a trusted key, for a specified identity
+type prSigstoreSigned struct {
+	prCommon
+
+	// KeyPath is a pathname to a local file containing the trusted PEM-encoded public key.
+	// Exactly one of KeyPath, KeyData, KeyURI and Fulcio must be specified.
+	KeyPath string `json:"keyPath,omitempty"`
+	// KeyData contains the trusted PEM-encoded public key, base64-encoded.
+	// Exactly one of KeyPath, KeyData, KeyURI and Fulcio must be specified.
+	KeyData []byte `json:"keyData,omitempty"`
+	// KeyURI identifies the trusted public key held in a key management service or a hardware token,
+	// e.g. "awskms://…" or "pkcs11:…"; it is resolved using a resolver registered by RegisterSigstoreKeyURIResolver.
+	// Exactly one of KeyPath, KeyData, KeyURI and Fulcio must be specified.
+	KeyURI string `json:"keyURI,omitempty"`
+	// Fulcio specifies that signatures must be made using a key certified by a Fulcio CA, for a specific identity.
+	// Exactly one of KeyPath, KeyData, KeyURI and Fulcio must be specified.
+	Fulcio *prSigstoreSignedFulcio `json:"fulcio,omitempty"`
+
+	// RekorPublicKeyPath is a pathname to local file containing the trusted PEM-encoded public key of a Rekor server.
+	// If it is specified, signatures must be accompanied by a Rekor signed entry timestamp (SET) made by this key.
+	// This is required if Fulcio is used, because the Fulcio certificates are only valid for a short time.
+	RekorPublicKeyPath string `json:"rekorPublicKeyPath,omitempty"`
+
+	// SignedIdentity specifies what image identity the signature must be claiming about the image.
+	// Defaults to "matchRepoDigestOrExact" if not specified.
+	SignedIdentity PolicyReferenceMatch `json:"signedIdentity"`
+}
+
+// prSignedByThreshold is a PolicyRequirement with type = prTypeSignedByThreshold: the image is signed,
+// for a specified identity, by at least Threshold different keys out of a set of trusted GPG keys.
+type prSignedByThreshold struct {
+	prCommon
+
+	// Threshold is the minimum number of different trusted keys which must have signed the image.
+	Threshold int `json:"threshold"`
+	// KeyPaths is a set of pathnames to local files, or directories of files, containing the trusted GPG key(s).
+	KeyPaths []string `json:"keyPaths"`
+
+	// SignedIdentity specifies what image identity the signatures must be claiming about the image.
+	// Defaults to "matchRepoDigestOrExact" if not specified.
+	SignedIdentity PolicyReferenceMatch `json:"signedIdentity"`
+}
+
+// prNotationSigned is a PolicyRequirement with type = prTypeNotationSigned: the image is signed by a Notation (Notary v2)
+// signature made using a certificate issued by a trusted CA to a trusted identity.
+// Notation signatures only refer to the manifest digest, not to any image name, so the images accepted for a signature
+// are only restricted by the scope of the requirement in the policy.
+type prNotationSigned struct {
+	prCommon
+
+	// TrustStorePath is a pathname to a local file containing the trusted PEM-encoded CA certificates.
+	// Exactly one of TrustStorePath and TrustStoreData must be specified.
+	TrustStorePath string `json:"trustStorePath,omitempty"`
+	// TrustStoreData contains the trusted PEM-encoded CA certificates, base64-encoded.
+	// Exactly one of TrustStorePath and TrustStoreData must be specified.
+	TrustStoreData []byte `json:"trustStoreData,omitempty"`
+	// TrustedIdentities are the accepted subjects of the signing certificates, as in Notation trust policies:
+	// either "x509.subject: " followed by a distinguished name, all attributes of which must be present in the certificate
+	// subject (e.g. "x509.subject: C=US, O=Example"), or a single "*" value, accepting any certificate issued by the trusted CAs.
+	TrustedIdentities []string `json:"trustedIdentities"`
+}
+
+// prNotarySigned is a PolicyRequirement with type = prTypeNotarySigned: the image tag is signed using Docker Content Trust,
+// i.e. the TUF metadata on a Notary (v1) server records the image manifest as the target for the tag.
+// Notary only records tags, so images referenced only by digest are rejected.
+type prNotarySigned struct {
+	prCommon
+
+	// Server is the URL of the Notary server. If empty, https://notary.docker.io is used for docker.io images,
+	// and the registry host name, using HTTPS, for other images.
+	Server string `json:"server,omitempty"`
+	// TrustDir is a pathname to a local directory used to store the TUF metadata.
+	// Keys of a repository are trusted when it is first used (as with "docker trust"), and recorded in this directory.
+	TrustDir string `json:"trustDir"`
+}
+
+// prSigstoreSignedFulcio contains the trust root and the required identity for keys certified by Fulcio.
+type prSigstoreSignedFulcio struct {
+	// CAPath is a pathname to a local file containing the trusted PEM-encoded Fulcio CA certificates. Exactly one of CAPath and CAData must be specified.
+	CAPath string `json:"caPath,omitempty"`
+	// CAData contains the trusted PEM-encoded Fulcio CA certificates, base64-encoded. Exactly one of CAPath and CAData must be specified.
+	CAData []byte `json:"caData,omitempty"`
+	// OIDCIssuer specifies the required OIDC issuer of the signing identity, as recorded in the certificate.
+	OIDCIssuer string `json:"oidcIssuer"`
+	// SubjectEmail specifies the required email address of the signing identity, as recorded in the certificate.
+	SubjectEmail string `json:"subjectEmail"`
+}
+
 // PolicyReferenceMatch specifies a set of image identities accepted in PolicyRequirement.
 // The type is public, but its implementation is private.
 
@@ -121,6 +238,7 @@ const (
 	prmTypeMatchRepository        prmTypeIdentifier = "matchRepository"
 	prmTypeExactReference         prmTypeIdentifier = "exactReference"
 	prmTypeExactRepository        prmTypeIdentifier = "exactRepository"
+	prmTypeRemapIdentity          prmTypeIdentifier = "remapIdentity"
 )
 
 // prmMatchExact is a PolicyReferenceMatch with type = prmMatchExact: the two references must match exactly.
@@ -150,3 +268,13 @@ type prmExactRepository struct {
 	prmCommon
 	DockerRepository string `json:"dockerRepository"`
 }
+
+// prmRemapIdentity is a PolicyReferenceMatch with type = prmRemapIdentity: like prmMatchRepoDigestOrExact,
+// except that a namespace (at least a host:port, at most a single repository) is substituted before matching the two references.
+type prmRemapIdentity struct {
+	prmCommon
+	Prefix       string `json:"prefix"`
+	SignedPrefix string `json:"signedPrefix"`
+	// Possibly let the users make a choice for tag/digest matching behavior
+	// similar to prmMatchExact/prmMatchRepository?
+}
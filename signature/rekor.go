@@ -0,0 +1,172 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+const (
+	// SigstoreSETAnnotationKey is the annotation containing a Rekor signed entry timestamp (SET) for the signature, if any.
+	SigstoreSETAnnotationKey = "dev.sigstore.cosign/bundle"
+
+	rekorHashedRekordKind       = "hashedrekord"
+	rekorHashedRekordAPIVersion = "0.0.1"
+	rekorHashedRekordAlgorithm  = "sha256"
+)
+
+// untrustedRekorSET is a parsed content of the SigstoreSETAnnotationKey annotation.
+type untrustedRekorSET struct {
+	UntrustedSignedEntryTimestamp []byte
+	UntrustedPayload              json.RawMessage
+}
+
+// untrustedRekorPayload is the part of an untrustedRekorSET which is signed by the Rekor key.
+// The signature is made over a canonical JSON form of this value: with keys sorted,
+// and without any whitespace. Do not reorder the fields, json.Marshal relies on it.
+type untrustedRekorPayload struct {
+	Body           []byte `json:"body"` // A base64-encoded rekor log entry
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// parseUntrustedRekorSET parses the contents of a SigstoreSETAnnotationKey annotation.
+func parseUntrustedRekorSET(data []byte) (*untrustedRekorSET, *untrustedRekorPayload, error) {
+	var set untrustedRekorSET
+	if err := paranoidUnmarshalJSONObjectExactFields(data, map[string]interface{}{
+		"SignedEntryTimestamp": &set.UntrustedSignedEntryTimestamp,
+		"Payload":              &set.UntrustedPayload,
+	}); err != nil {
+		return nil, nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid Rekor SET: %v", err)}
+	}
+	var payload untrustedRekorPayload
+	var integratedTime, logIndex float64
+	if err := paranoidUnmarshalJSONObjectExactFields(set.UntrustedPayload, map[string]interface{}{
+		"body":           &payload.Body,
+		"integratedTime": &integratedTime,
+		"logID":          &payload.LogID,
+		"logIndex":       &logIndex,
+	}); err != nil {
+		return nil, nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid Rekor SET payload: %v", err)}
+	}
+	payload.IntegratedTime = int64(integratedTime)
+	if float64(payload.IntegratedTime) != integratedTime {
+		return nil, nil, InvalidSignatureError{msg: "Rekor SET field integratedTime is not an integer"}
+	}
+	payload.LogIndex = int64(logIndex)
+	if float64(payload.LogIndex) != logIndex {
+		return nil, nil, InvalidSignatureError{msg: "Rekor SET field logIndex is not an integer"}
+	}
+	return &set, &payload, nil
+}
+
+// verifyRekorSET verifies that unverifiedRekorSET is signed by rekorPublicKey, and that it records
+// the signature unverifiedBase64Signature of unverifiedPayload, made by the PEM-encoded public key or certificate unverifiedKeyOrCertPEM.
+// It returns the time the entry was integrated into the transparency log.
+func verifyRekorSET(rekorPublicKey crypto.PublicKey, unverifiedRekorSET []byte, unverifiedKeyOrCertPEM []byte,
+	unverifiedBase64Signature string, unverifiedPayload []byte) (time.Time, error) {
+	untrustedSET, untrustedPayload, err := parseUntrustedRekorSET(unverifiedRekorSET)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Verify the SET over the canonical form of the payload, not over the bytes we have received.
+	var canonicalPayload bytes.Buffer
+	encoder := json.NewEncoder(&canonicalPayload)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(untrustedPayload); err != nil {
+		return time.Time{}, err
+	}
+	if err := verifySigstoreSignatureBytes(rekorPublicKey, bytes.TrimSuffix(canonicalPayload.Bytes(), []byte("\n")), untrustedSET.UntrustedSignedEntryTimestamp); err != nil {
+		return time.Time{}, PolicyRequirementError(fmt.Sprintf("Rekor SET verification failed: %v", err))
+	}
+	// The payload is now trusted, but it must also match the signature we are verifying.
+	rekorPayload := untrustedPayload
+
+	var entry struct {
+		APIVersion string
+		Kind       string
+		Spec       json.RawMessage
+	}
+	if err := paranoidUnmarshalJSONObjectExactFields(rekorPayload.Body, map[string]interface{}{
+		"apiVersion": &entry.APIVersion,
+		"kind":       &entry.Kind,
+		"spec":       &entry.Spec,
+	}); err != nil {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Invalid Rekor entry: %v", err)}
+	}
+	if entry.Kind != rekorHashedRekordKind || entry.APIVersion != rekorHashedRekordAPIVersion {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Unsupported Rekor entry kind %q, version %q", entry.Kind, entry.APIVersion)}
+	}
+	var data, signature json.RawMessage
+	if err := paranoidUnmarshalJSONObjectExactFields(entry.Spec, map[string]interface{}{
+		"data":      &data,
+		"signature": &signature,
+	}); err != nil {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Invalid Rekor entry: %v", err)}
+	}
+	var hash json.RawMessage
+	if err := paranoidUnmarshalJSONObjectExactFields(data, map[string]interface{}{
+		"hash": &hash,
+	}); err != nil {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Invalid Rekor entry: %v", err)}
+	}
+	var hashAlgorithm, hashValue string
+	if err := paranoidUnmarshalJSONObjectExactFields(hash, map[string]interface{}{
+		"algorithm": &hashAlgorithm,
+		"value":     &hashValue,
+	}); err != nil {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Invalid Rekor entry: %v", err)}
+	}
+	var signatureContent []byte
+	var publicKey json.RawMessage
+	if err := paranoidUnmarshalJSONObjectExactFields(signature, map[string]interface{}{
+		"content":   &signatureContent,
+		"publicKey": &publicKey,
+	}); err != nil {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Invalid Rekor entry: %v", err)}
+	}
+	var publicKeyContent []byte
+	if err := paranoidUnmarshalJSONObjectExactFields(publicKey, map[string]interface{}{
+		"content": &publicKeyContent,
+	}); err != nil {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Invalid Rekor entry: %v", err)}
+	}
+
+	if hashAlgorithm != rekorHashedRekordAlgorithm {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Unsupported Rekor entry hash algorithm %q", hashAlgorithm)}
+	}
+	payloadDigest := sha256.Sum256(unverifiedPayload)
+	if hashValue != hex.EncodeToString(payloadDigest[:]) {
+		return time.Time{}, PolicyRequirementError("Rekor entry does not match the signed payload")
+	}
+	unverifiedSignature, err := base64.StdEncoding.DecodeString(unverifiedBase64Signature)
+	if err != nil {
+		return time.Time{}, InvalidSignatureError{msg: fmt.Sprintf("Invalid base64 signature: %v", err)}
+	}
+	if !bytes.Equal(signatureContent, unverifiedSignature) {
+		return time.Time{}, PolicyRequirementError("Rekor entry does not match the signature")
+	}
+	if !pemContentsEqual(publicKeyContent, unverifiedKeyOrCertPEM) {
+		return time.Time{}, PolicyRequirementError("Rekor entry does not match the signing key")
+	}
+
+	return time.Unix(rekorPayload.IntegratedTime, 0), nil
+}
+
+// pemContentsEqual returns true if a and b contain a single PEM block each, with the same type and contents.
+func pemContentsEqual(a, b []byte) bool {
+	aBlock, aRest := pem.Decode(a)
+	bBlock, bRest := pem.Decode(b)
+	return aBlock != nil && bBlock != nil &&
+		len(bytes.TrimSpace(aRest)) == 0 && len(bytes.TrimSpace(bRest)) == 0 &&
+		aBlock.Type == bBlock.Type && bytes.Equal(aBlock.Bytes, bBlock.Bytes)
+}
@@ -0,0 +1,214 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rekorTestHashedRekordBody returns a Rekor hashedrekord entry for a signature base64Sig of payload using keyOrCertPEM.
+func rekorTestHashedRekordBody(t *testing.T, keyOrCertPEM []byte, base64Sig string, payload []byte) []byte {
+	sig, err := base64.StdEncoding.DecodeString(base64Sig)
+	require.NoError(t, err)
+	payloadDigest := sha256.Sum256(payload)
+	body, err := json.Marshal(mSI{
+		"apiVersion": rekorHashedRekordAPIVersion,
+		"kind":       rekorHashedRekordKind,
+		"spec": mSI{
+			"data": mSI{
+				"hash": mSI{
+					"algorithm": rekorHashedRekordAlgorithm,
+					"value":     hex.EncodeToString(payloadDigest[:]),
+				},
+			},
+			"signature": mSI{
+				"content":   sig,
+				"publicKey": mSI{"content": keyOrCertPEM},
+			},
+		},
+	})
+	require.NoError(t, err)
+	return body
+}
+
+// rekorTestSETWithBody returns a Rekor SET annotation value for a log entry with body and integratedTime, signed by rekorKey.
+func rekorTestSETWithBody(t *testing.T, rekorKey crypto.Signer, body []byte, integratedTime time.Time) string {
+	payload := untrustedRekorPayload{
+		Body:           body,
+		IntegratedTime: integratedTime.Unix(),
+		LogID:          "0123456789abcdef",
+		LogIndex:       42,
+	}
+	payloadJSON, err := json.Marshal(payload)
+	require.NoError(t, err)
+	payloadDigest := sha256.Sum256(payloadJSON)
+	set, err := rekorKey.Sign(rand.Reader, payloadDigest[:], crypto.SHA256)
+	require.NoError(t, err)
+	res, err := json.Marshal(mSI{
+		"SignedEntryTimestamp": set,
+		"Payload":              json.RawMessage(payloadJSON),
+	})
+	require.NoError(t, err)
+	return string(res)
+}
+
+// rekorTestSET returns a Rekor SET annotation value for a signature base64Sig of payload using keyOrCertPEM,
+// integrated at integratedTime, signed by rekorKey.
+func rekorTestSET(t *testing.T, rekorKey crypto.Signer, keyOrCertPEM []byte, base64Sig string, payload []byte, integratedTime time.Time) string {
+	return rekorTestSETWithBody(t, rekorKey, rekorTestHashedRekordBody(t, keyOrCertPEM, base64Sig, payload), integratedTime)
+}
+
+func TestParseUntrustedRekorSET(t *testing.T) {
+	rekorKey, _ := sigstoreTestKey(t)
+	validSET := rekorTestSETWithBody(t, rekorKey, []byte("body"), time.Unix(1484683104, 0))
+
+	// Success
+	set, payload, err := parseUntrustedRekorSET([]byte(validSET))
+	require.NoError(t, err)
+	assert.NotEmpty(t, set.UntrustedSignedEntryTimestamp)
+	assert.Equal(t, &untrustedRekorPayload{
+		Body:           []byte("body"),
+		IntegratedTime: 1484683104,
+		LogID:          "0123456789abcdef",
+		LogIndex:       42,
+	}, payload)
+
+	// Various ways to corrupt the JSON
+	breakFns := []func(mSI){
+		// A top-level field is missing
+		func(v mSI) { delete(v, "SignedEntryTimestamp") },
+		func(v mSI) { delete(v, "Payload") },
+		// Extra top-level sub-object
+		func(v mSI) { v["unexpected"] = 1 },
+		// Invalid "SignedEntryTimestamp"
+		func(v mSI) { v["SignedEntryTimestamp"] = 1 },
+		func(v mSI) { v["SignedEntryTimestamp"] = "this is invalid base64" },
+		// "Payload" not an object
+		func(v mSI) { v["Payload"] = 1 },
+		// A field of "Payload" is missing
+		func(v mSI) { delete(x(v, "Payload"), "body") },
+		func(v mSI) { delete(x(v, "Payload"), "integratedTime") },
+		func(v mSI) { delete(x(v, "Payload"), "logID") },
+		func(v mSI) { delete(x(v, "Payload"), "logIndex") },
+		// Extra field of "Payload"
+		func(v mSI) { x(v, "Payload")["unexpected"] = 1 },
+		// Invalid fields of "Payload"
+		func(v mSI) { x(v, "Payload")["body"] = 1 },
+		func(v mSI) { x(v, "Payload")["integratedTime"] = "unexpected" },
+		func(v mSI) { x(v, "Payload")["integratedTime"] = 0.5 },
+		func(v mSI) { x(v, "Payload")["logID"] = 1 },
+		func(v mSI) { x(v, "Payload")["logIndex"] = "unexpected" },
+		func(v mSI) { x(v, "Payload")["logIndex"] = 0.5 },
+	}
+	for _, fn := range breakFns {
+		testJSON := modifiedUntrustedSignatureJSON(t, []byte(validSET), fn)
+		_, _, err := parseUntrustedRekorSET(testJSON)
+		assert.Error(t, err, string(testJSON))
+		_, ok := err.(InvalidSignatureError)
+		assert.True(t, ok, string(testJSON))
+	}
+}
+
+func TestVerifyRekorSET(t *testing.T) {
+	integratedTime := time.Unix(1484683104, 0)
+	rekorKey, _ := sigstoreTestKey(t)
+	key, keyPEM := sigstoreTestKey(t)
+	payload := []byte("payload")
+	base64Sig := sigstoreTestSignPayload(t, key, payload)
+	validSET := rekorTestSET(t, rekorKey, keyPEM, base64Sig, payload, integratedTime)
+
+	// Success
+	res, err := verifyRekorSET(rekorKey.Public(), []byte(validSET), keyPEM, base64Sig, payload)
+	require.NoError(t, err)
+	assert.Equal(t, integratedTime, res)
+
+	// Invalid SET
+	_, err = verifyRekorSET(rekorKey.Public(), []byte("this is invalid"), keyPEM, base64Sig, payload)
+	assert.IsType(t, InvalidSignatureError{}, err)
+
+	// SET signed by a different key
+	otherRekorKey, _ := sigstoreTestKey(t)
+	_, err = verifyRekorSET(otherRekorKey.Public(), []byte(validSET), keyPEM, base64Sig, payload)
+	assert.IsType(t, PolicyRequirementError(""), err)
+
+	// Modified SET payload
+	modifiedSET := modifiedUntrustedSignatureJSON(t, []byte(validSET), func(v mSI) { x(v, "Payload")["logIndex"] = 43 })
+	_, err = verifyRekorSET(rekorKey.Public(), modifiedSET, keyPEM, base64Sig, payload)
+	assert.IsType(t, PolicyRequirementError(""), err)
+
+	// The entry is for a different payload, signature or key
+	otherPayload := []byte("other payload")
+	_, err = verifyRekorSET(rekorKey.Public(), []byte(validSET), keyPEM, sigstoreTestSignPayload(t, key, otherPayload), otherPayload)
+	assert.IsType(t, PolicyRequirementError(""), err)
+	_, err = verifyRekorSET(rekorKey.Public(), []byte(validSET), keyPEM, sigstoreTestSignPayload(t, key, payload), payload)
+	assert.IsType(t, PolicyRequirementError(""), err) // ECDSA signatures are randomized, so this is a different signature
+	_, otherKeyPEM := sigstoreTestKey(t)
+	_, err = verifyRekorSET(rekorKey.Public(), []byte(validSET), otherKeyPEM, base64Sig, payload)
+	assert.IsType(t, PolicyRequirementError(""), err)
+
+	// Invalid base64 signature
+	_, err = verifyRekorSET(rekorKey.Public(), []byte(validSET), keyPEM, "&", payload)
+	assert.IsType(t, InvalidSignatureError{}, err)
+
+	// Various ways to corrupt the log entry
+	validBody := rekorTestHashedRekordBody(t, keyPEM, base64Sig, payload)
+	breakFns := []func(mSI){
+		// A top-level field is missing
+		func(v mSI) { delete(v, "apiVersion") },
+		func(v mSI) { delete(v, "kind") },
+		func(v mSI) { delete(v, "spec") },
+		// Extra top-level sub-object
+		func(v mSI) { v["unexpected"] = 1 },
+		// Unsupported kind or version
+		func(v mSI) { v["kind"] = "rekord" },
+		func(v mSI) { v["apiVersion"] = "0.0.2" },
+		// Invalid "spec"
+		func(v mSI) { v["spec"] = 1 },
+		func(v mSI) { delete(x(v, "spec"), "data") },
+		func(v mSI) { delete(x(v, "spec"), "signature") },
+		func(v mSI) { x(v, "spec")["unexpected"] = 1 },
+		// Invalid "data"
+		func(v mSI) { x(v, "spec")["data"] = 1 },
+		func(v mSI) { delete(x(v, "spec", "data"), "hash") },
+		func(v mSI) { x(v, "spec", "data")["unexpected"] = 1 },
+		func(v mSI) { x(v, "spec", "data")["hash"] = 1 },
+		func(v mSI) { delete(x(v, "spec", "data", "hash"), "algorithm") },
+		func(v mSI) { delete(x(v, "spec", "data", "hash"), "value") },
+		func(v mSI) { x(v, "spec", "data", "hash")["algorithm"] = "sha512" },
+		func(v mSI) { x(v, "spec", "data", "hash")["value"] = "0123" },
+		// Invalid "signature"
+		func(v mSI) { x(v, "spec")["signature"] = 1 },
+		func(v mSI) { delete(x(v, "spec", "signature"), "content") },
+		func(v mSI) { delete(x(v, "spec", "signature"), "publicKey") },
+		func(v mSI) { x(v, "spec", "signature")["content"] = "this is invalid base64" },
+		func(v mSI) { x(v, "spec", "signature")["publicKey"] = 1 },
+		func(v mSI) { delete(x(v, "spec", "signature", "publicKey"), "content") },
+		func(v mSI) { x(v, "spec", "signature", "publicKey")["content"] = []byte("not PEM") },
+	}
+	for _, fn := range breakFns {
+		body := modifiedUntrustedSignatureJSON(t, validBody, fn)
+		set := rekorTestSETWithBody(t, rekorKey, body, integratedTime)
+		_, err := verifyRekorSET(rekorKey.Public(), []byte(set), keyPEM, base64Sig, payload)
+		assert.Error(t, err, string(body))
+	}
+}
+
+func TestPEMContentsEqual(t *testing.T) {
+	_, keyPEM := sigstoreTestKey(t)
+	_, otherKeyPEM := sigstoreTestKey(t)
+
+	assert.True(t, pemContentsEqual(keyPEM, keyPEM))
+	assert.True(t, pemContentsEqual(keyPEM, append(append([]byte("\n"), keyPEM...), '\n')))
+	assert.False(t, pemContentsEqual(keyPEM, otherKeyPEM))
+	assert.False(t, pemContentsEqual(keyPEM, []byte("not PEM")))
+	assert.False(t, pemContentsEqual([]byte("not PEM"), []byte("not PEM")))
+	assert.False(t, pemContentsEqual(keyPEM, append(append([]byte{}, keyPEM...), keyPEM...)))
+}
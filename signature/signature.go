@@ -17,6 +17,9 @@ import (
 
 const (
 	signatureType = "atomic container signature"
+	// signatureFormatVersion is the value of optional.format-version written by this implementation,
+	// and the highest value accepted when parsing signatures strictly.
+	signatureFormatVersion = 1
 )
 
 // InvalidSignatureError is returned when parsing an invalid signature.
@@ -33,6 +36,18 @@ func (err InvalidSignatureError) Error() string {
 type Signature struct {
 	DockerManifestDigest digest.Digest
 	DockerReference      string // FIXME: more precise type?
+	// CreatorID and Timestamp are optional metadata recorded by the signer; they are "" and the zero time.Time value
+	// if the signature does not contain them.
+	// They are only as trustworthy as the signer, and they are not validated in any way.
+	CreatorID string
+	Timestamp time.Time
+}
+
+// equal returns true if s and other contain the same data.
+// Unlike ==, it compares Timestamp values using time.Time.Equal, ignoring their locations.
+func (s *Signature) equal(other *Signature) bool {
+	return s.DockerManifestDigest == other.DockerManifestDigest && s.DockerReference == other.DockerReference &&
+		s.CreatorID == other.CreatorID && s.Timestamp.Equal(other.Timestamp)
 }
 
 // untrustedSignature is a parsed content of a signature.
@@ -45,6 +60,10 @@ type untrustedSignature struct {
 	// So, this is explicitly an int64, and we reject fractional values. If we did need more precise timestamps eventually,
 	// we would add another field, UntrustedTimestampNS int64.
 	UntrustedTimestamp *int64
+	// UntrustedExpiration is, like UntrustedTimestamp, an int64 number of seconds since the UNIX epoch.
+	UntrustedExpiration *int64
+	// UntrustedFormatVersion is the version of the format of the optional fields; a missing value is equivalent to 1.
+	UntrustedFormatVersion *int64
 }
 
 // UntrustedSignatureInformation is information available in an untrusted signature.
@@ -60,6 +79,7 @@ type UntrustedSignatureInformation struct {
 	UntrustedDockerReference      string // FIXME: more precise type?
 	UntrustedCreatorID            *string
 	UntrustedTimestamp            *time.Time
+	UntrustedExpiration           *time.Time
 	UntrustedShortKeyIdentifier   string
 }
 
@@ -70,11 +90,13 @@ func newUntrustedSignature(dockerManifestDigest digest.Digest, dockerReference s
 	// Golang guarantees that they will have a new address on every execution.
 	creatorID := "atomic " + version.Version
 	timestamp := time.Now().Unix()
+	formatVersion := int64(signatureFormatVersion)
 	return untrustedSignature{
 		UntrustedDockerManifestDigest: dockerManifestDigest,
 		UntrustedDockerReference:      dockerReference,
 		UntrustedCreatorID:            &creatorID,
 		UntrustedTimestamp:            &timestamp,
+		UntrustedFormatVersion:        &formatVersion,
 	}
 }
 
@@ -98,6 +120,12 @@ func (s untrustedSignature) MarshalJSON() ([]byte, error) {
 	if s.UntrustedTimestamp != nil {
 		optional["timestamp"] = *s.UntrustedTimestamp
 	}
+	if s.UntrustedExpiration != nil {
+		optional["expiration"] = *s.UntrustedExpiration
+	}
+	if s.UntrustedFormatVersion != nil {
+		optional["format-version"] = *s.UntrustedFormatVersion
+	}
 	signature := map[string]interface{}{
 		"critical": critical,
 		"optional": optional,
@@ -109,8 +137,21 @@ func (s untrustedSignature) MarshalJSON() ([]byte, error) {
 var _ json.Unmarshaler = (*untrustedSignature)(nil)
 
 // UnmarshalJSON implements the json.Unmarshaler interface
+// Unrecognized fields in "optional", and values of optional.format-version newer than signatureFormatVersion, are ignored;
+// use unmarshalJSONRejectingUnknownFields to reject them.
 func (s *untrustedSignature) UnmarshalJSON(data []byte) error {
-	err := s.strictUnmarshalJSON(data)
+	return s.unmarshalJSON(data, false)
+}
+
+// unmarshalJSONRejectingUnknownFields is like UnmarshalJSON, but it rejects unrecognized fields in "optional",
+// and values of optional.format-version newer than signatureFormatVersion.
+func (s *untrustedSignature) unmarshalJSONRejectingUnknownFields(data []byte) error {
+	return s.unmarshalJSON(data, true)
+}
+
+// unmarshalJSON implements UnmarshalJSON and unmarshalJSONRejectingUnknownFields.
+func (s *untrustedSignature) unmarshalJSON(data []byte, rejectUnknownFields bool) error {
+	err := s.strictUnmarshalJSON(data, rejectUnknownFields)
 	if err != nil {
 		if _, ok := err.(jsonFormatError); ok {
 			err = InvalidSignatureError{msg: err.Error()}
@@ -119,9 +160,9 @@ func (s *untrustedSignature) UnmarshalJSON(data []byte) error {
 	return err
 }
 
-// strictUnmarshalJSON is UnmarshalJSON, except that it may return the internal jsonFormatError error type.
+// strictUnmarshalJSON is unmarshalJSON, except that it may return the internal jsonFormatError error type.
 // Splitting it into a separate function allows us to do the jsonFormatError → InvalidSignatureError in a single place, the caller.
-func (s *untrustedSignature) strictUnmarshalJSON(data []byte) error {
+func (s *untrustedSignature) strictUnmarshalJSON(data []byte, rejectUnknownFields bool) error {
 	var critical, optional json.RawMessage
 	if err := paranoidUnmarshalJSONObjectExactFields(data, map[string]interface{}{
 		"critical": &critical,
@@ -131,8 +172,9 @@ func (s *untrustedSignature) strictUnmarshalJSON(data []byte) error {
 	}
 
 	var creatorID string
-	var timestamp float64
-	var gotCreatorID, gotTimestamp = false, false
+	var timestamp, expiration, formatVersion float64
+	var gotCreatorID, gotTimestamp, gotExpiration, gotFormatVersion = false, false, false, false
+	unknownField := ""
 	if err := paranoidUnmarshalJSONObject(optional, func(key string) interface{} {
 		switch key {
 		case "creator":
@@ -141,13 +183,25 @@ func (s *untrustedSignature) strictUnmarshalJSON(data []byte) error {
 		case "timestamp":
 			gotTimestamp = true
 			return &timestamp
+		case "expiration":
+			gotExpiration = true
+			return &expiration
+		case "format-version":
+			gotFormatVersion = true
+			return &formatVersion
 		default:
+			if unknownField == "" {
+				unknownField = key
+			}
 			var ignore interface{}
 			return &ignore
 		}
 	}); err != nil {
 		return err
 	}
+	if rejectUnknownFields && unknownField != "" {
+		return InvalidSignatureError{msg: fmt.Sprintf("Unrecognized field optional.%s", unknownField)}
+	}
 	if gotCreatorID {
 		s.UntrustedCreatorID = &creatorID
 	}
@@ -158,6 +212,23 @@ func (s *untrustedSignature) strictUnmarshalJSON(data []byte) error {
 		}
 		s.UntrustedTimestamp = &intTimestamp
 	}
+	if gotExpiration {
+		intExpiration := int64(expiration)
+		if float64(intExpiration) != expiration {
+			return InvalidSignatureError{msg: "Field optional.expiration is not an integer"}
+		}
+		s.UntrustedExpiration = &intExpiration
+	}
+	if gotFormatVersion {
+		intFormatVersion := int64(formatVersion)
+		if float64(intFormatVersion) != formatVersion || intFormatVersion < 1 {
+			return InvalidSignatureError{msg: "Field optional.format-version is not a positive integer"}
+		}
+		if rejectUnknownFields && intFormatVersion > signatureFormatVersion {
+			return InvalidSignatureError{msg: fmt.Sprintf("Unsupported signature format version %d", intFormatVersion)}
+		}
+		s.UntrustedFormatVersion = &intFormatVersion
+	}
 
 	var t string
 	var image, identity json.RawMessage
@@ -200,6 +271,16 @@ func (s untrustedSignature) sign(mech SigningMechanism, keyIdentity string) ([]b
 	return mech.Sign(json, keyIdentity)
 }
 
+// signWithPassphrase is like sign, but unlocks the private key using passphrase.
+func (s untrustedSignature) signWithPassphrase(mech SigningMechanismWithPassphrase, keyIdentity, passphrase string) ([]byte, error) {
+	json, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return mech.SignWithPassphrase(json, keyIdentity, passphrase)
+}
+
 // signatureAcceptanceRules specifies how to decide whether an untrusted signature is acceptable.
 // We centralize the actual parsing and data extraction in verifyAndExtractSignature; this supplies
 // the policy.  We use an object instead of supplying func parameters to verifyAndExtractSignature
@@ -209,6 +290,10 @@ type signatureAcceptanceRules struct {
 	validateKeyIdentity                func(string) error
 	validateSignedDockerReference      func(string) error
 	validateSignedDockerManifestDigest func(digest.Digest) error
+	// validateSignatureTimes, if not nil, is called with the (optional) creation and expiration times of the signature.
+	validateSignatureTimes func(timestamp, expiration *time.Time) error
+	// rejectUnknownFields, if true, causes signatures with unrecognized optional fields, or a newer format version, to be rejected.
+	rejectUnknownFields bool
 }
 
 // verifyAndExtractSignature verifies that unverifiedSignature has been signed, and that its principial components
@@ -223,7 +308,11 @@ func verifyAndExtractSignature(mech SigningMechanism, unverifiedSignature []byte
 	}
 
 	var unmatchedSignature untrustedSignature
-	if err := json.Unmarshal(signed, &unmatchedSignature); err != nil {
+	if rules.rejectUnknownFields {
+		if err := unmatchedSignature.unmarshalJSONRejectingUnknownFields(signed); err != nil {
+			return nil, InvalidSignatureError{msg: err.Error()}
+		}
+	} else if err := json.Unmarshal(signed, &unmatchedSignature); err != nil {
 		return nil, InvalidSignatureError{msg: err.Error()}
 	}
 	if err := rules.validateSignedDockerManifestDigest(unmatchedSignature.UntrustedDockerManifestDigest); err != nil {
@@ -232,11 +321,24 @@ func verifyAndExtractSignature(mech SigningMechanism, unverifiedSignature []byte
 	if err := rules.validateSignedDockerReference(unmatchedSignature.UntrustedDockerReference); err != nil {
 		return nil, err
 	}
+	if rules.validateSignatureTimes != nil {
+		if err := rules.validateSignatureTimes(unixTimePtr(unmatchedSignature.UntrustedTimestamp),
+			unixTimePtr(unmatchedSignature.UntrustedExpiration)); err != nil {
+			return nil, err
+		}
+	}
 	// signatureAcceptanceRules have accepted this value.
-	return &Signature{
+	res := &Signature{
 		DockerManifestDigest: unmatchedSignature.UntrustedDockerManifestDigest,
 		DockerReference:      unmatchedSignature.UntrustedDockerReference,
-	}, nil
+	}
+	if unmatchedSignature.UntrustedCreatorID != nil {
+		res.CreatorID = *unmatchedSignature.UntrustedCreatorID
+	}
+	if unmatchedSignature.UntrustedTimestamp != nil {
+		res.Timestamp = time.Unix(*unmatchedSignature.UntrustedTimestamp, 0)
+	}
+	return res, nil
 }
 
 // GetUntrustedSignatureInformationWithoutVerifying extracts information available in an untrusted signature,
@@ -265,16 +367,21 @@ func GetUntrustedSignatureInformationWithoutVerifying(untrustedSignatureBytes []
 		return nil, InvalidSignatureError{msg: err.Error()}
 	}
 
-	var timestamp *time.Time // = nil
-	if untrustedDecodedContents.UntrustedTimestamp != nil {
-		ts := time.Unix(*untrustedDecodedContents.UntrustedTimestamp, 0)
-		timestamp = &ts
-	}
 	return &UntrustedSignatureInformation{
 		UntrustedDockerManifestDigest: untrustedDecodedContents.UntrustedDockerManifestDigest,
 		UntrustedDockerReference:      untrustedDecodedContents.UntrustedDockerReference,
 		UntrustedCreatorID:            untrustedDecodedContents.UntrustedCreatorID,
-		UntrustedTimestamp:            timestamp,
+		UntrustedTimestamp:            unixTimePtr(untrustedDecodedContents.UntrustedTimestamp),
+		UntrustedExpiration:           unixTimePtr(untrustedDecodedContents.UntrustedExpiration),
 		UntrustedShortKeyIdentifier:   shortKeyIdentifier,
 	}, nil
 }
+
+// unixTimePtr returns a pointer to the time.Time corresponding to *seconds since the UNIX epoch, or nil if seconds is nil.
+func unixTimePtr(seconds *int64) *time.Time {
+	if seconds == nil {
+		return nil
+	}
+	t := time.Unix(*seconds, 0)
+	return &t
+}
@@ -2,6 +2,7 @@ package signature
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
@@ -22,6 +23,41 @@ func TestInvalidSignatureError(t *testing.T) {
 	assert.Equal(t, s, err.Error())
 }
 
+func TestSignatureEqual(t *testing.T) {
+	creatorID, otherCreatorID := "creator", "other creator"
+	timestamp, otherTimestamp := time.Unix(1484683104, 0), time.Unix(1516219104, 0)
+	sameTimestamp := timestamp.UTC()
+	base := Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      TestImageSignatureReference,
+		CreatorID:            creatorID,
+		Timestamp:            timestamp,
+	}
+
+	same := base
+	assert.True(t, base == same)
+	same.Timestamp = sameTimestamp
+	assert.True(t, base.equal(&same))
+	assert.True(t, same.equal(&base))
+
+	for _, modify := range []func(*Signature){
+		func(s *Signature) {
+			s.DockerManifestDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+		},
+		func(s *Signature) { s.DockerReference = "example.com/other" },
+		func(s *Signature) { s.CreatorID = "" },
+		func(s *Signature) { s.CreatorID = otherCreatorID },
+		func(s *Signature) { s.Timestamp = time.Time{} },
+		func(s *Signature) { s.Timestamp = otherTimestamp },
+	} {
+		different := base
+		modify(&different)
+		assert.False(t, base == different, fmt.Sprintf("%#v", different))
+		assert.False(t, base.equal(&different), fmt.Sprintf("%#v", different))
+		assert.False(t, different.equal(&base), fmt.Sprintf("%#v", different))
+	}
+}
+
 func TestNewUntrustedSignature(t *testing.T) {
 	timeBefore := time.Now()
 	sig := newUntrustedSignature(TestImageManifestDigest, TestImageSignatureReference)
@@ -33,6 +69,8 @@ func TestNewUntrustedSignature(t *testing.T) {
 	timeAfter := time.Now()
 	assert.True(t, timeBefore.Unix() <= *sig.UntrustedTimestamp)
 	assert.True(t, *sig.UntrustedTimestamp <= timeAfter.Unix())
+	require.NotNil(t, sig.UntrustedFormatVersion)
+	assert.Equal(t, int64(signatureFormatVersion), *sig.UntrustedFormatVersion)
 }
 
 func TestMarshalJSON(t *testing.T) {
@@ -48,6 +86,8 @@ func TestMarshalJSON(t *testing.T) {
 	// Use intermediate variables for these values so that we can take their addresses.
 	creatorID := "CREATOR"
 	timestamp := int64(1484683104)
+	expiration := int64(1516219104)
+	formatVersion := int64(1)
 	for _, c := range []struct {
 		input    untrustedSignature
 		expected string
@@ -61,6 +101,24 @@ func TestMarshalJSON(t *testing.T) {
 			},
 			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"atomic container signature\"},\"optional\":{\"creator\":\"CREATOR\",\"timestamp\":1484683104}}",
 		},
+		{
+			untrustedSignature{
+				UntrustedDockerManifestDigest: "digest!@#",
+				UntrustedDockerReference:      "reference#@!",
+				UntrustedCreatorID:            &creatorID,
+				UntrustedTimestamp:            &timestamp,
+				UntrustedExpiration:           &expiration,
+			},
+			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"atomic container signature\"},\"optional\":{\"creator\":\"CREATOR\",\"expiration\":1516219104,\"timestamp\":1484683104}}",
+		},
+		{
+			untrustedSignature{
+				UntrustedDockerManifestDigest: "digest!@#",
+				UntrustedDockerReference:      "reference#@!",
+				UntrustedFormatVersion:        &formatVersion,
+			},
+			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"atomic container signature\"},\"optional\":{\"format-version\":1}}",
+		},
 		{
 			untrustedSignature{
 				UntrustedDockerManifestDigest: "digest!@#",
@@ -184,6 +242,14 @@ func TestUnmarshalJSON(t *testing.T) {
 		// Invalid "timestamp"
 		func(v mSI) { x(v, "optional")["timestamp"] = "unexpected" },
 		func(v mSI) { x(v, "optional")["timestamp"] = 0.5 }, // Fractional input
+		// Invalid "expiration"
+		func(v mSI) { x(v, "optional")["expiration"] = "unexpected" },
+		func(v mSI) { x(v, "optional")["expiration"] = 0.5 }, // Fractional input
+		// Invalid "format-version"
+		func(v mSI) { x(v, "optional")["format-version"] = "unexpected" },
+		func(v mSI) { x(v, "optional")["format-version"] = 1.5 }, // Fractional input
+		func(v mSI) { x(v, "optional")["format-version"] = 0 },
+		func(v mSI) { x(v, "optional")["format-version"] = -1 },
 	}
 	for _, fn := range breakFns {
 		testJSON := modifiedUntrustedSignatureJSON(t, validJSON, fn)
@@ -201,6 +267,18 @@ func TestUnmarshalJSON(t *testing.T) {
 		assert.Equal(t, validSig, s)
 	}
 
+	// Newer format versions are accepted
+	testJSON := modifiedUntrustedSignatureJSON(t, validJSON, func(v mSI) { x(v, "optional")["format-version"] = signatureFormatVersion + 1 })
+	s = succesfullyUnmarshalUntrustedSignature(t, schemaLoader, testJSON)
+	require.NotNil(t, s.UntrustedFormatVersion)
+	assert.Equal(t, int64(signatureFormatVersion+1), *s.UntrustedFormatVersion)
+
+	// "expiration" is recognized
+	testJSON = modifiedUntrustedSignatureJSON(t, validJSON, func(v mSI) { x(v, "optional")["expiration"] = 1516219104 })
+	s = succesfullyUnmarshalUntrustedSignature(t, schemaLoader, testJSON)
+	require.NotNil(t, s.UntrustedExpiration)
+	assert.Equal(t, int64(1516219104), *s.UntrustedExpiration)
+
 	// Optional fields can be missing
 	validSig = untrustedSignature{
 		UntrustedDockerManifestDigest: "digest!@#",
@@ -214,6 +292,36 @@ func TestUnmarshalJSON(t *testing.T) {
 	assert.Equal(t, validSig, s)
 }
 
+func TestUnmarshalJSONRejectingUnknownFields(t *testing.T) {
+	validSig := newUntrustedSignature("digest!@#", "reference#@!")
+	validJSON, err := validSig.MarshalJSON()
+	require.NoError(t, err)
+
+	// Success
+	var s untrustedSignature
+	err = s.unmarshalJSONRejectingUnknownFields(validJSON)
+	require.NoError(t, err)
+	assert.Equal(t, validSig, s)
+
+	// Fields which are ignored by UnmarshalJSON are rejected
+	for _, fn := range []func(mSI){
+		func(v mSI) { x(v, "optional")["unexpected"] = 1 },
+		func(v mSI) { x(v, "optional")["format-version"] = signatureFormatVersion + 1 },
+	} {
+		testJSON := modifiedUntrustedSignatureJSON(t, validJSON, fn)
+		var s untrustedSignature
+		err := json.Unmarshal(testJSON, &s)
+		require.NoError(t, err, string(testJSON))
+		err = s.unmarshalJSONRejectingUnknownFields(testJSON)
+		assert.Error(t, err, string(testJSON))
+		assert.IsType(t, InvalidSignatureError{}, err)
+	}
+
+	// Other errors are reported as usual
+	err = s.unmarshalJSONRejectingUnknownFields([]byte("1"))
+	assert.Error(t, err)
+}
+
 func TestSign(t *testing.T) {
 	mech, err := newGPGSigningMechanismInDirectory(testGPGHomeDirectory)
 	require.NoError(t, err)
@@ -315,8 +423,25 @@ func TestVerifyAndExtractSignature(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, TestImageSignatureReference, sig.DockerReference)
 	assert.Equal(t, TestImageManifestDigest, sig.DockerManifestDigest)
+	assert.Equal(t, "atomic ", sig.CreatorID)
+	assert.Equal(t, time.Unix(1458239713, 0), sig.Timestamp)
 	assert.Equal(t, signatureData, recorded)
 
+	// validateSignatureTimes is called with the signature times, and can reject the signature
+	var recordedTimestamp, recordedExpiration *time.Time
+	timeRules := recordingRules
+	timeRules.validateSignatureTimes = func(timestamp, expiration *time.Time) error {
+		recordedTimestamp, recordedExpiration = timestamp, expiration
+		return errors.Errorf("signature times rejected")
+	}
+	wanted = signatureData
+	sig, err = verifyAndExtractSignature(mech, signature, timeRules)
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+	require.NotNil(t, recordedTimestamp)
+	assert.Equal(t, time.Unix(1458239713, 0), *recordedTimestamp)
+	assert.Nil(t, recordedExpiration)
+
 	// For extra paranoia, test that we return a nil signature object on error.
 
 	// Completely invalid signature.
@@ -384,6 +509,7 @@ func TestGetUntrustedSignatureInformationWithoutVerifying(t *testing.T) {
 	assert.Equal(t, "atomic ", *info.UntrustedCreatorID)
 	assert.NotNil(t, info.UntrustedTimestamp)
 	assert.Equal(t, time.Unix(1458239713, 0), *info.UntrustedTimestamp)
+	assert.Nil(t, info.UntrustedExpiration)
 	assert.Equal(t, TestKeyShortID, info.UntrustedShortKeyIdentifier)
 	// Successful parsing, no optional fields present
 	signature, err = ioutil.ReadFile("./fixtures/no-optional-fields.signature")
@@ -0,0 +1,166 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+// NOTE: Keep this in sync with docs/containers-policy.json.md!
+
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	internalsig "github.com/containers/image/internal/signature"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+const (
+	// sigstoreSignaturePrefix is the prefix of a serialized SigstoreSignature blob.
+	sigstoreSignaturePrefix = internalsig.SigstorePrefix
+
+	// SigstoreSignatureMIMEType is the MIME type of a sigstore (cosign) signature payload.
+	SigstoreSignatureMIMEType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SigstoreSignatureAnnotationKey is the annotation containing the base64-encoded signature of the payload.
+	SigstoreSignatureAnnotationKey = "dev.cosignproject.cosign/signature"
+	// SigstoreCertificateAnnotationKey is the annotation containing a PEM-encoded X.509 certificate of the signing key, if any.
+	SigstoreCertificateAnnotationKey = "dev.sigstore.cosign/certificate"
+	// SigstoreIntermediateCertificateChainAnnotationKey is the annotation containing PEM-encoded intermediate
+	// certificates used to verify SigstoreCertificateAnnotationKey, if any.
+	SigstoreIntermediateCertificateChainAnnotationKey = "dev.sigstore.cosign/chain"
+)
+
+// SigstoreSignature is a sigstore (cosign-style) signature, as stored in the signature storage of a transport.
+// All of the contents are UNTRUSTED until verified by the sigstoreSigned policy requirement.
+type SigstoreSignature struct {
+	UntrustedMIMEType    string            `json:"mimeType"`
+	UntrustedPayload     []byte            `json:"payload"`
+	UntrustedAnnotations map[string]string `json:"annotations"`
+}
+
+// IsSigstoreSignature returns true if blob is a serialized SigstoreSignature
+// (and not e.g. a simple signing signature).
+func IsSigstoreSignature(blob []byte) bool {
+	return internalsig.IsSigstore(blob)
+}
+
+// Blob returns a serialized form of s, usable in the signature storage of a transport.
+func (s SigstoreSignature) Blob() ([]byte, error) {
+	return internalsig.Sigstore{
+		MIMEType:    s.UntrustedMIMEType,
+		Payload:     s.UntrustedPayload,
+		Annotations: s.UntrustedAnnotations,
+	}.Blob()
+}
+
+// ParseSigstoreSignature parses a blob returned by SigstoreSignature.Blob.
+func ParseSigstoreSignature(blob []byte) (*SigstoreSignature, error) {
+	if !IsSigstoreSignature(blob) {
+		return nil, InvalidSignatureError{msg: "Not a sigstore signature"}
+	}
+	var res SigstoreSignature
+	if err := paranoidUnmarshalJSONObjectExactFields(blob[len(sigstoreSignaturePrefix):], map[string]interface{}{
+		"mimeType":    &res.UntrustedMIMEType,
+		"payload":     &res.UntrustedPayload,
+		"annotations": &res.UntrustedAnnotations,
+	}); err != nil {
+		return nil, InvalidSignatureError{msg: err.Error()}
+	}
+	return &res, nil
+}
+
+// loadSigstorePublicKey parses a PEM-encoded public key, as used by cosign.
+func loadSigstorePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("Public key is not in PEM format")
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, errors.New("Unexpected data after the PEM-encoded public key")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, errors.Errorf("Unexpected PEM block type %q, expected a public key", block.Type)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing public key")
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.Errorf("Unsupported public key type %T", key)
+	}
+}
+
+// ecdsaSignature is the ASN.1 structure of an ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// verifySigstoreSignatureBytes returns nil if signature is a valid signature of payload by publicKey.
+func verifySigstoreSignatureBytes(publicKey crypto.PublicKey, payload, signature []byte) error {
+	payloadDigest := sha256.Sum256(payload)
+	switch k := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		var sig ecdsaSignature
+		rest, err := asn1.Unmarshal(signature, &sig)
+		if err != nil || len(rest) != 0 || sig.R == nil || sig.S == nil {
+			return InvalidSignatureError{msg: "Invalid ECDSA signature format"}
+		}
+		if !ecdsa.Verify(k, payloadDigest[:], sig.R, sig.S) {
+			return InvalidSignatureError{msg: "Cryptographic signature verification failed"}
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, payloadDigest[:], signature); err != nil {
+			return InvalidSignatureError{msg: fmt.Sprintf("Cryptographic signature verification failed: %v", err)}
+		}
+		return nil
+	default:
+		return errors.Errorf("Unsupported public key type %T", publicKey)
+	}
+}
+
+// sigstorePayloadAcceptanceRules specifies how to decide whether an untrusted sigstore payload is acceptable.
+// See signatureAcceptanceRules for the reasoning behind using a struct.
+type sigstorePayloadAcceptanceRules struct {
+	validateSignedDockerReference      func(string) error
+	validateSignedDockerManifestDigest func(digest.Digest) error
+}
+
+// verifySigstorePayload verifies that unverifiedBase64Signature is a signature of unverifiedPayload by publicKey,
+// and that the principal components of the payload match expected values, as specified by rules.
+func verifySigstorePayload(publicKey crypto.PublicKey, unverifiedPayload []byte, unverifiedBase64Signature string, rules sigstorePayloadAcceptanceRules) (*Signature, error) {
+	unverifiedSignature, err := base64.StdEncoding.DecodeString(unverifiedBase64Signature)
+	if err != nil {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid base64 signature: %v", err)}
+	}
+	if err := verifySigstoreSignatureBytes(publicKey, unverifiedPayload, unverifiedSignature); err != nil {
+		return nil, err
+	}
+
+	var unmatchedPayload untrustedSigstorePayload
+	if err := json.Unmarshal(unverifiedPayload, &unmatchedPayload); err != nil {
+		return nil, InvalidSignatureError{msg: err.Error()}
+	}
+	if err := rules.validateSignedDockerManifestDigest(unmatchedPayload.UntrustedDockerManifestDigest); err != nil {
+		return nil, err
+	}
+	if err := rules.validateSignedDockerReference(unmatchedPayload.UntrustedDockerReference); err != nil {
+		return nil, err
+	}
+	// sigstorePayloadAcceptanceRules have accepted this value.
+	return &Signature{
+		DockerManifestDigest: unmatchedPayload.UntrustedDockerManifestDigest,
+		DockerReference:      unmatchedPayload.UntrustedDockerReference,
+	}, nil
+}
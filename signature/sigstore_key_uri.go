@@ -0,0 +1,103 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SigstoreKeyURIResolver returns the public key identified by keyURI, e.g. by querying a key management service
+// ("awskms://…", "gcpkms://…", "hashivault://…") or a hardware token ("pkcs11:…").
+type SigstoreKeyURIResolver func(ctx context.Context, keyURI string) (crypto.PublicKey, error)
+
+// knownSigstoreKeyURIResolvers is a registry of SigstoreKeyURIResolver instances, indexed by URI scheme.
+type knownSigstoreKeyURIResolvers struct {
+	resolvers map[string]SigstoreKeyURIResolver
+	mu        sync.Mutex
+}
+
+func (kr *knownSigstoreKeyURIResolvers) get(scheme string) SigstoreKeyURIResolver {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.resolvers[scheme]
+}
+
+func (kr *knownSigstoreKeyURIResolvers) add(scheme string, resolver SigstoreKeyURIResolver) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if r := kr.resolvers[scheme]; r != nil {
+		panic(fmt.Sprintf("Duplicate sigstore key URI resolver for scheme %s", scheme))
+	}
+	kr.resolvers[scheme] = resolver
+}
+
+func (kr *knownSigstoreKeyURIResolvers) remove(scheme string) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	delete(kr.resolvers, scheme)
+}
+
+var sigstoreKeyURIResolvers = &knownSigstoreKeyURIResolvers{
+	resolvers: map[string]SigstoreKeyURIResolver{},
+}
+
+// RegisterSigstoreKeyURIResolver registers resolver for "keyURI" values of "sigstoreSigned" requirements using scheme.
+// No resolvers are registered by default; callers which want to support e.g. a specific key management service
+// must register a resolver for it, typically in an init() function.
+func RegisterSigstoreKeyURIResolver(scheme string, resolver SigstoreKeyURIResolver) {
+	sigstoreKeyURIResolvers.add(strings.ToLower(scheme), resolver)
+}
+
+// sigstoreKeyURIScheme returns the scheme of keyURI, or an error if keyURI is not a valid URI.
+func sigstoreKeyURIScheme(keyURI string) (string, error) {
+	u, err := url.Parse(keyURI)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid key URI %q", keyURI)
+	}
+	if u.Scheme == "" {
+		return "", errors.Errorf("Key URI %q does not specify a scheme", keyURI)
+	}
+	return strings.ToLower(u.Scheme), nil
+}
+
+// resolveSigstoreKeyURI returns the public key identified by keyURI, using the resolver registered for its scheme.
+func resolveSigstoreKeyURI(ctx context.Context, keyURI string) (crypto.PublicKey, error) {
+	scheme, err := sigstoreKeyURIScheme(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	resolver := sigstoreKeyURIResolvers.get(scheme)
+	if resolver == nil {
+		return nil, errors.Errorf("No resolver for key URI scheme %q is available", scheme)
+	}
+	key, err := resolver(ctx, keyURI)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error resolving key URI %q", keyURI)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.Errorf("Unsupported public key type %T for key URI %q", key, keyURI)
+	}
+}
+
+// marshalSigstorePublicKey returns a PEM-encoded representation of key, in the format accepted by loadSigstorePublicKey.
+func marshalSigstorePublicKey(key crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
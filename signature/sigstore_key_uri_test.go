@@ -0,0 +1,81 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withSigstoreKeyURIResolver registers resolver for scheme, and returns a function which unregisters it.
+func withSigstoreKeyURIResolver(t *testing.T, scheme string, resolver SigstoreKeyURIResolver) func() {
+	RegisterSigstoreKeyURIResolver(scheme, resolver)
+	return func() { sigstoreKeyURIResolvers.remove(scheme) }
+}
+
+// sigstoreTestKeyURIResolver returns a SigstoreKeyURIResolver which returns keys[keyURI],
+// and a pointer to the number of times it has been called.
+func sigstoreTestKeyURIResolver(keys map[string]crypto.PublicKey) (SigstoreKeyURIResolver, *int) {
+	calls := 0
+	return func(ctx context.Context, keyURI string) (crypto.PublicKey, error) {
+		calls++
+		key, ok := keys[keyURI]
+		if !ok {
+			return nil, errors.New("unknown key")
+		}
+		return key, nil
+	}, &calls
+}
+
+func TestRegisterSigstoreKeyURIResolver(t *testing.T) {
+	resolver, _ := sigstoreTestKeyURIResolver(nil)
+	defer withSigstoreKeyURIResolver(t, "testkms", resolver)()
+
+	assert.NotNil(t, sigstoreKeyURIResolvers.get("testkms"))
+	// Duplicate registrations are rejected, case-insensitively
+	assert.Panics(t, func() { RegisterSigstoreKeyURIResolver("testkms", resolver) })
+	assert.Panics(t, func() { RegisterSigstoreKeyURIResolver("TestKMS", resolver) })
+}
+
+func TestResolveSigstoreKeyURI(t *testing.T) {
+	key, _ := sigstoreTestKey(t)
+	resolver, _ := sigstoreTestKeyURIResolver(map[string]crypto.PublicKey{
+		"testkms://valid":       key.Public(),
+		"TESTKMS://upper-case":  key.Public(),
+		"testkms://unsupported": "this is not a public key",
+	})
+	defer withSigstoreKeyURIResolver(t, "testkms", resolver)()
+
+	// Success
+	for _, uri := range []string{"testkms://valid", "TESTKMS://upper-case"} {
+		res, err := resolveSigstoreKeyURI(context.Background(), uri)
+		require.NoError(t, err, uri)
+		assert.Equal(t, key.Public(), res, uri)
+	}
+
+	// Failure
+	for _, uri := range []string{
+		"",                      // Empty
+		"no-scheme",             // No scheme
+		"%invalid://",           // Invalid URI
+		"otherkms://valid",      // Unknown scheme
+		"testkms://unknown",     // Resolver failure
+		"testkms://unsupported", // Unsupported key type
+	} {
+		_, err := resolveSigstoreKeyURI(context.Background(), uri)
+		assert.Error(t, err, uri)
+	}
+}
+
+func TestMarshalSigstorePublicKey(t *testing.T) {
+	key, publicKeyPEM := sigstoreTestKey(t)
+	res, err := marshalSigstorePublicKey(key.Public())
+	require.NoError(t, err)
+	assert.Equal(t, publicKeyPEM, res)
+	loaded, err := loadSigstorePublicKey(res)
+	require.NoError(t, err)
+	assert.Equal(t, key.Public(), loaded)
+}
@@ -0,0 +1,152 @@
+package signature
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUntrustedSigstorePayloadMarshalJSON(t *testing.T) {
+	// Empty string values
+	s := newUntrustedSigstorePayload("", "_")
+	_, err := s.MarshalJSON()
+	assert.Error(t, err)
+	s = newUntrustedSigstorePayload("_", "")
+	_, err = s.MarshalJSON()
+	assert.Error(t, err)
+
+	// Success
+	// Use intermediate variables for these values so that we can take their addresses.
+	creatorID := "CREATOR"
+	timestamp := int64(1484683104)
+	for _, c := range []struct {
+		input    untrustedSigstorePayload
+		expected string
+	}{
+		{
+			untrustedSigstorePayload{
+				UntrustedDockerManifestDigest: "digest!@#",
+				UntrustedDockerReference:      "reference#@!",
+				UntrustedCreatorID:            &creatorID,
+				UntrustedTimestamp:            &timestamp,
+			},
+			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"cosign container image signature\"},\"optional\":{\"creator\":\"CREATOR\",\"timestamp\":1484683104}}",
+		},
+		{
+			untrustedSigstorePayload{
+				UntrustedDockerManifestDigest: "digest!@#",
+				UntrustedDockerReference:      "reference#@!",
+			},
+			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"cosign container image signature\"},\"optional\":{}}",
+		},
+	} {
+		marshaled, err := c.input.MarshalJSON()
+		require.NoError(t, err)
+		assert.Equal(t, []byte(c.expected), marshaled)
+
+		// Also call MarshalJSON through the JSON package.
+		marshaled, err = json.Marshal(c.input)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(c.expected), marshaled)
+	}
+}
+
+func TestUntrustedSigstorePayloadUnmarshalJSON(t *testing.T) {
+	// Invalid input. Note that json.Unmarshal is guaranteed to validate input before calling our
+	// UnmarshalJSON implementation; so test that first, then test our error handling for completeness.
+	var s untrustedSigstorePayload
+	err := json.Unmarshal([]byte("&"), &s)
+	assert.Error(t, err)
+	err = s.UnmarshalJSON([]byte("&"))
+	assert.Error(t, err)
+
+	// Not an object
+	err = json.Unmarshal([]byte("1"), &s)
+	assert.Error(t, err)
+
+	// Start with a valid JSON.
+	validSig := newUntrustedSigstorePayload("digest!@#", "reference#@!")
+	validJSON, err := validSig.MarshalJSON()
+	require.NoError(t, err)
+
+	// Success
+	s = untrustedSigstorePayload{}
+	err = json.Unmarshal(validJSON, &s)
+	require.NoError(t, err)
+	assert.Equal(t, validSig, s)
+
+	// A payload as generated by cosign, with "optional": null
+	s = untrustedSigstorePayload{}
+	err = json.Unmarshal([]byte(`{"critical":{"identity":{"docker-reference":"example.com/ns/image"},"image":{"docker-manifest-digest":"sha256:20bf21ed457b390829cdbeec8795a7bea1626991fda603e0d01b4e7f60427e55"},"type":"cosign container image signature"},"optional":null}`), &s)
+	require.NoError(t, err)
+	assert.Equal(t, newUntrustedSigstorePayload(TestImageManifestDigest, "example.com/ns/image"), s)
+
+	// Various ways to corrupt the JSON
+	breakFns := []func(mSI){
+		// A top-level field is missing
+		func(v mSI) { delete(v, "critical") },
+		func(v mSI) { delete(v, "optional") },
+		// Extra top-level sub-object
+		func(v mSI) { v["unexpected"] = 1 },
+		// "critical" not an object
+		func(v mSI) { v["critical"] = 1 },
+		// "optional" not an object
+		func(v mSI) { v["optional"] = 1 },
+		// A field of "critical" is missing
+		func(v mSI) { delete(x(v, "critical"), "type") },
+		func(v mSI) { delete(x(v, "critical"), "image") },
+		func(v mSI) { delete(x(v, "critical"), "identity") },
+		// Extra field of "critical"
+		func(v mSI) { x(v, "critical")["unexpected"] = 1 },
+		// Invalid "type"
+		func(v mSI) { x(v, "critical")["type"] = 1 },
+		func(v mSI) { x(v, "critical")["type"] = "unexpected" },
+		func(v mSI) { x(v, "critical")["type"] = signatureType }, // A simple signing payload is not accepted
+		// Invalid "image" object
+		func(v mSI) { x(v, "critical")["image"] = 1 },
+		func(v mSI) { delete(x(v, "critical", "image"), "docker-manifest-digest") },
+		func(v mSI) { x(v, "critical", "image")["unexpected"] = 1 },
+		// Invalid "docker-manifest-digest"
+		func(v mSI) { x(v, "critical", "image")["docker-manifest-digest"] = 1 },
+		// Invalid "identity" object
+		func(v mSI) { x(v, "critical")["identity"] = 1 },
+		func(v mSI) { delete(x(v, "critical", "identity"), "docker-reference") },
+		func(v mSI) { x(v, "critical", "identity")["unexpected"] = 1 },
+		// Invalid "docker-reference"
+		func(v mSI) { x(v, "critical", "identity")["docker-reference"] = 1 },
+		// Invalid "creator"
+		func(v mSI) { x(v, "optional")["creator"] = 1 },
+		// Invalid "timestamp"
+		func(v mSI) { x(v, "optional")["timestamp"] = "unexpected" },
+		func(v mSI) { x(v, "optional")["timestamp"] = 0.5 }, // Fractional input
+	}
+	for _, fn := range breakFns {
+		testJSON := modifiedUntrustedSignatureJSON(t, validJSON, fn)
+		var s untrustedSigstorePayload
+		err := json.Unmarshal(testJSON, &s)
+		assert.Error(t, err, string(testJSON))
+	}
+
+	// Modifications to unrecognized fields in "optional" are allowed and ignored
+	testJSON := modifiedUntrustedSignatureJSON(t, validJSON, func(v mSI) { x(v, "optional")["unexpected"] = 1 })
+	s = untrustedSigstorePayload{}
+	err = json.Unmarshal(testJSON, &s)
+	require.NoError(t, err)
+	assert.Equal(t, validSig, s)
+
+	// Optional fields can be missing
+	validSig = untrustedSigstorePayload{
+		UntrustedDockerManifestDigest: "digest!@#",
+		UntrustedDockerReference:      "reference#@!",
+		UntrustedCreatorID:            nil,
+		UntrustedTimestamp:            nil,
+	}
+	validJSON, err = validSig.MarshalJSON()
+	require.NoError(t, err)
+	s = untrustedSigstorePayload{}
+	err = json.Unmarshal(validJSON, &s)
+	require.NoError(t, err)
+	assert.Equal(t, validSig, s)
+}
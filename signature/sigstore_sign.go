@@ -0,0 +1,88 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"time"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/version"
+	"github.com/pkg/errors"
+)
+
+// LoadSigstorePrivateKey parses an unencrypted PEM-encoded ECDSA or RSA private key, usable with SignDockerManifestWithSigstore.
+// Encrypted private keys, as generated by cosign by default, are not supported.
+func LoadSigstorePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("Private key is not in PEM format")
+	}
+	if _, ok := block.Headers["Proc-Type"]; ok || block.Type == "ENCRYPTED SIGSTORE PRIVATE KEY" || block.Type == "ENCRYPTED COSIGN PRIVATE KEY" {
+		return nil, errors.New("Encrypted private keys are not supported")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, errors.Errorf("Unexpected PEM block type %q, expected a private key", block.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing private key")
+	}
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case *rsa.PrivateKey:
+		return k, nil
+	default:
+		return nil, errors.Errorf("Unsupported private key type %T", key)
+	}
+}
+
+// SignDockerManifestWithSigstore returns a serialized sigstore signature (see SigstoreSignature.Blob)
+// for manifest as the specified dockerReference, using privateKey.
+func SignDockerManifestWithSigstore(m []byte, dockerReference string, privateKey crypto.Signer) ([]byte, error) {
+	manifestDigest, err := manifest.Digest(m)
+	if err != nil {
+		return nil, err
+	}
+	// Use intermediate variables for these values so that we can take their addresses.
+	creatorID := "containers/image " + version.Version
+	timestamp := time.Now().Unix()
+	payload := newUntrustedSigstorePayload(manifestDigest, dockerReference)
+	payload.UntrustedCreatorID = &creatorID
+	payload.UntrustedTimestamp = &timestamp
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both ECDSA and RSA (PKCS #1 v1.5) signers produce the signature formats accepted by verifySigstoreSignatureBytes.
+	payloadDigest := sha256.Sum256(payloadBytes)
+	sig, err := privateKey.Sign(rand.Reader, payloadDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error signing sigstore payload")
+	}
+	return SigstoreSignature{
+		UntrustedMIMEType: SigstoreSignatureMIMEType,
+		UntrustedPayload:  payloadBytes,
+		UntrustedAnnotations: map[string]string{
+			SigstoreSignatureAnnotationKey: base64.StdEncoding.EncodeToString(sig),
+		},
+	}.Blob()
+}
@@ -0,0 +1,108 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/version"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSigstorePrivateKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	pkcs8EC, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	sec1EC, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	pkcs8RSA, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		block    pem.Block
+		expected interface{}
+	}{
+		{pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8EC}, ecKey},
+		{pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1EC}, ecKey},
+		{pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8RSA}, rsaKey},
+		{pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, rsaKey},
+	} {
+		key, err := LoadSigstorePrivateKey(pem.EncodeToMemory(&c.block))
+		require.NoError(t, err, c.block.Type)
+		assert.Equal(t, c.expected, key, c.block.Type)
+	}
+
+	for _, invalid := range [][]byte{
+		[]byte("not PEM"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkcs8EC}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("not a key")}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: pkcs8RSA}),
+		pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED SIGSTORE PRIVATE KEY", Bytes: []byte("encrypted")}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Headers: map[string]string{"Proc-Type": "4,ENCRYPTED"}, Bytes: sec1EC}),
+	} {
+		_, err := LoadSigstorePrivateKey(invalid)
+		assert.Error(t, err, string(invalid))
+	}
+}
+
+func TestSignDockerManifestWithSigstore(t *testing.T) {
+	const testReference = "example.com/ns/repo:tag"
+	manifestBlob := []byte(`{"schemaVersion":2}`)
+	manifestDigest, err := manifest.Digest(manifestBlob)
+	require.NoError(t, err)
+
+	ecKey, ecPublicKey := sigstoreTestKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name      string
+		key       crypto.Signer
+		publicKey []byte
+	}{
+		{"ECDSA", ecKey, ecPublicKey},
+		{"RSA", rsaKey, sigstoreTestPublicKeyPEM(t, rsaKey.Public())},
+	} {
+		blob, err := SignDockerManifestWithSigstore(manifestBlob, testReference, c.key)
+		require.NoError(t, err, c.name)
+
+		sig, err := ParseSigstoreSignature(blob)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, SigstoreSignatureMIMEType, sig.UntrustedMIMEType, c.name)
+		publicKey, err := loadSigstorePublicKey(c.publicKey)
+		require.NoError(t, err, c.name)
+		verified, err := verifySigstorePayload(publicKey, sig.UntrustedPayload, sig.UntrustedAnnotations[SigstoreSignatureAnnotationKey], sigstorePayloadAcceptanceRules{
+			validateSignedDockerReference: func(ref string) error {
+				assert.Equal(t, testReference, ref, c.name)
+				return nil
+			},
+			validateSignedDockerManifestDigest: func(digest digest.Digest) error {
+				assert.Equal(t, manifestDigest, digest, c.name)
+				return nil
+			},
+		})
+		require.NoError(t, err, c.name)
+		assert.Equal(t, &Signature{DockerManifestDigest: manifestDigest, DockerReference: testReference}, verified, c.name)
+
+		var payload untrustedSigstorePayload
+		err = payload.UnmarshalJSON(sig.UntrustedPayload)
+		require.NoError(t, err, c.name)
+		require.NotNil(t, payload.UntrustedCreatorID, c.name)
+		assert.Equal(t, "containers/image "+version.Version, *payload.UntrustedCreatorID, c.name)
+		assert.NotNil(t, payload.UntrustedTimestamp, c.name)
+	}
+
+	// Empty reference
+	_, err = SignDockerManifestWithSigstore(manifestBlob, "", ecKey)
+	assert.Error(t, err)
+}
@@ -0,0 +1,234 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sigstoreTestPublicKeyPEM returns a PEM-encoded form of publicKey.
+func sigstoreTestPublicKeyPEM(t *testing.T, publicKey crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// sigstoreTestKey returns a new ECDSA key and its PEM-encoded public key.
+func sigstoreTestKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key, sigstoreTestPublicKeyPEM(t, key.Public())
+}
+
+// sigstoreTestSignPayload returns a base64-encoded signature of payload by key.
+func sigstoreTestSignPayload(t *testing.T, key crypto.Signer, payload []byte) string {
+	payloadDigest := sha256.Sum256(payload)
+	sig, err := key.Sign(rand.Reader, payloadDigest[:], crypto.SHA256)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// sigstoreTestSignature returns a serialized sigstore signature of an image with manifestDigest and dockerReference by key.
+func sigstoreTestSignature(t *testing.T, key crypto.Signer, manifestDigest digest.Digest, dockerReference string) []byte {
+	payload, err := json.Marshal(newUntrustedSigstorePayload(manifestDigest, dockerReference))
+	require.NoError(t, err)
+	blob, err := SigstoreSignature{
+		UntrustedMIMEType:    SigstoreSignatureMIMEType,
+		UntrustedPayload:     payload,
+		UntrustedAnnotations: map[string]string{SigstoreSignatureAnnotationKey: sigstoreTestSignPayload(t, key, payload)},
+	}.Blob()
+	require.NoError(t, err)
+	return blob
+}
+
+func TestSigstoreSignatureBlob(t *testing.T) {
+	sig := SigstoreSignature{
+		UntrustedMIMEType:    SigstoreSignatureMIMEType,
+		UntrustedPayload:     []byte("payload"),
+		UntrustedAnnotations: map[string]string{"a": "b"},
+	}
+	blob, err := sig.Blob()
+	require.NoError(t, err)
+	assert.True(t, IsSigstoreSignature(blob))
+	parsed, err := ParseSigstoreSignature(blob)
+	require.NoError(t, err)
+	assert.Equal(t, &sig, parsed)
+
+	// Simple signing signatures are not recognized
+	simpleSig, err := ioutil.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+	assert.False(t, IsSigstoreSignature(simpleSig))
+	_, err = ParseSigstoreSignature(simpleSig)
+	assert.Error(t, err)
+
+	// Invalid JSON
+	for _, invalid := range []string{
+		"",
+		"[]",
+		`{"mimeType":"a","payload":"cGF5bG9hZA==","annotations":{},"unknown":1}`,
+		`{"mimeType":"a","payload":"this is not base64","annotations":{}}`,
+		`{"payload":"cGF5bG9hZA==","annotations":{}}`,
+		`{"mimeType":"a","mimeType":"a","payload":"cGF5bG9hZA==","annotations":{}}`,
+	} {
+		_, err := ParseSigstoreSignature([]byte(sigstoreSignaturePrefix + invalid))
+		assert.Error(t, err, invalid)
+		_, ok := err.(InvalidSignatureError)
+		assert.True(t, ok, invalid)
+	}
+}
+
+func TestLoadSigstorePublicKey(t *testing.T) {
+	// ECDSA
+	_, ecdsaPEM := sigstoreTestKey(t)
+	key, err := loadSigstorePublicKey(ecdsaPEM)
+	require.NoError(t, err)
+	assert.IsType(t, &ecdsa.PublicKey{}, key)
+
+	// RSA
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err = loadSigstorePublicKey(sigstoreTestPublicKeyPEM(t, rsaKey.Public()))
+	require.NoError(t, err)
+	assert.IsType(t, &rsa.PublicKey{}, key)
+
+	// Invalid inputs
+	for _, invalid := range [][]byte{
+		[]byte{},
+		[]byte("this is not PEM"),
+		append(append([]byte{}, ecdsaPEM...), ecdsaPEM...),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("not a key")}),
+	} {
+		_, err := loadSigstorePublicKey(invalid)
+		assert.Error(t, err, string(invalid))
+	}
+}
+
+func TestVerifySigstoreSignatureBytes(t *testing.T) {
+	payload := []byte("payload")
+	payloadDigest := sha256.Sum256(payload)
+
+	ecdsaKey, _ := sigstoreTestKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	for _, key := range []crypto.Signer{ecdsaKey, rsaKey} {
+		sig, err := key.Sign(rand.Reader, payloadDigest[:], crypto.SHA256)
+		require.NoError(t, err)
+
+		// Success
+		err = verifySigstoreSignatureBytes(key.Public(), payload, sig)
+		assert.NoError(t, err)
+
+		// Modified payload
+		err = verifySigstoreSignatureBytes(key.Public(), []byte("modified"), sig)
+		assert.Error(t, err)
+
+		// Invalid signature
+		err = verifySigstoreSignatureBytes(key.Public(), payload, []byte("invalid"))
+		assert.Error(t, err)
+	}
+
+	// A signature by a different key
+	otherKey, _ := sigstoreTestKey(t)
+	sig, err := otherKey.Sign(rand.Reader, payloadDigest[:], crypto.SHA256)
+	require.NoError(t, err)
+	err = verifySigstoreSignatureBytes(ecdsaKey.Public(), payload, sig)
+	assert.Error(t, err)
+
+	// Unsupported key type
+	err = verifySigstoreSignatureBytes("not a key", payload, sig)
+	assert.Error(t, err)
+}
+
+func TestVerifySigstorePayload(t *testing.T) {
+	const testReference = "example.com/ns/image:tag"
+	key, _ := sigstoreTestKey(t)
+	payload, err := json.Marshal(newUntrustedSigstorePayload(TestImageManifestDigest, testReference))
+	require.NoError(t, err)
+	base64Sig := sigstoreTestSignPayload(t, key, payload)
+
+	recordingRules := func(digests *[]digest.Digest, refs *[]string) sigstorePayloadAcceptanceRules {
+		return sigstorePayloadAcceptanceRules{
+			validateSignedDockerReference: func(ref string) error {
+				*refs = append(*refs, ref)
+				return nil
+			},
+			validateSignedDockerManifestDigest: func(digest digest.Digest) error {
+				*digests = append(*digests, digest)
+				return nil
+			},
+		}
+	}
+
+	// Success
+	var digests []digest.Digest
+	var refs []string
+	sig, err := verifySigstorePayload(key.Public(), payload, base64Sig, recordingRules(&digests, &refs))
+	require.NoError(t, err)
+	assert.Equal(t, &Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      testReference,
+	}, sig)
+	assert.Equal(t, []digest.Digest{TestImageManifestDigest}, digests)
+	assert.Equal(t, []string{testReference}, refs)
+
+	// Invalid base64
+	digests, refs = nil, nil
+	sig, err = verifySigstorePayload(key.Public(), payload, "&", recordingRules(&digests, &refs))
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+	assert.Nil(t, digests)
+	assert.Nil(t, refs)
+
+	// Cryptographic verification failure
+	sig, err = verifySigstorePayload(key.Public(), []byte("modified"), base64Sig, recordingRules(&digests, &refs))
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+	assert.Nil(t, digests)
+	assert.Nil(t, refs)
+
+	// A signed payload which is not valid JSON
+	invalidPayload := []byte("not JSON")
+	sig, err = verifySigstorePayload(key.Public(), invalidPayload, sigstoreTestSignPayload(t, key, invalidPayload), recordingRules(&digests, &refs))
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+	assert.Nil(t, digests)
+	assert.Nil(t, refs)
+
+	// Rejected by validateSignedDockerManifestDigest
+	sig, err = verifySigstorePayload(key.Public(), payload, base64Sig, sigstorePayloadAcceptanceRules{
+		validateSignedDockerReference: func(ref string) error {
+			return nil
+		},
+		validateSignedDockerManifestDigest: func(digest digest.Digest) error {
+			return PolicyRequirementError("digest rejected")
+		},
+	})
+	assert.IsType(t, PolicyRequirementError(""), err)
+	assert.Nil(t, sig)
+
+	// Rejected by validateSignedDockerReference
+	sig, err = verifySigstorePayload(key.Public(), payload, base64Sig, sigstorePayloadAcceptanceRules{
+		validateSignedDockerReference: func(ref string) error {
+			return PolicyRequirementError("reference rejected")
+		},
+		validateSignedDockerManifestDigest: func(digest digest.Digest) error {
+			return nil
+		},
+	})
+	assert.IsType(t, PolicyRequirementError(""), err)
+	assert.Nil(t, sig)
+}
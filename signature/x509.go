@@ -0,0 +1,94 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+package signature
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// parseX509CertificatesPEM returns all certificates in PEM-encoded data.
+// It fails if data contains any other PEM blocks, or no certificates at all.
+func parseX509CertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	res := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.Errorf("Unexpected PEM block type %q, expected a certificate", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error parsing certificate")
+		}
+		res = append(res, cert)
+	}
+	if len(res) == 0 {
+		return nil, errors.New("No PEM-encoded certificates found")
+	}
+	return res, nil
+}
+
+// newX509CertPool returns a certificate pool containing all certificates in the PEM-encoded blobs.
+func newX509CertPool(blobs [][]byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, blob := range blobs {
+		certs, err := parseX509CertificatesPEM(blob)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
+	}
+	return pool, nil
+}
+
+// verifyX509CertificateChain verifies that the PEM-encoded untrustedLeafPEM, possibly using intermediate certificates
+// from the PEM-encoded untrustedIntermediatesPEM (which may be empty), chains to one of roots, and is valid for code signing at
+// verificationTime.  It returns the verified leaf certificate.
+func verifyX509CertificateChain(roots *x509.CertPool, untrustedLeafPEM, untrustedIntermediatesPEM []byte, verificationTime time.Time) (*x509.Certificate, error) {
+	untrustedLeafCerts, err := parseX509CertificatesPEM(untrustedLeafPEM)
+	if err != nil {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid signing certificate: %v", err)}
+	}
+	if len(untrustedLeafCerts) != 1 {
+		return nil, InvalidSignatureError{msg: fmt.Sprintf("Expected exactly one signing certificate, got %d", len(untrustedLeafCerts))}
+	}
+	var untrustedIntermediateCerts []*x509.Certificate
+	if len(untrustedIntermediatesPEM) != 0 {
+		untrustedIntermediateCerts, err = parseX509CertificatesPEM(untrustedIntermediatesPEM)
+		if err != nil {
+			return nil, InvalidSignatureError{msg: fmt.Sprintf("Invalid intermediate certificates: %v", err)}
+		}
+	}
+	if err := verifyX509Certificates(roots, untrustedLeafCerts[0], untrustedIntermediateCerts, verificationTime); err != nil {
+		return nil, err
+	}
+	return untrustedLeafCerts[0], nil
+}
+
+// verifyX509Certificates verifies that untrustedLeafCert, possibly using untrustedIntermediateCerts,
+// chains to one of roots, and is valid for code signing at verificationTime.
+func verifyX509Certificates(roots *x509.CertPool, untrustedLeafCert *x509.Certificate, untrustedIntermediateCerts []*x509.Certificate, verificationTime time.Time) error {
+	untrustedIntermediatePool := x509.NewCertPool()
+	for _, cert := range untrustedIntermediateCerts {
+		untrustedIntermediatePool.AddCert(cert)
+	}
+	if _, err := untrustedLeafCert.Verify(x509.VerifyOptions{
+		Intermediates: untrustedIntermediatePool,
+		Roots:         roots,
+		CurrentTime:   verificationTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return newPolicyRequirementError(PolicyRejectionReasonUntrustedKey, fmt.Sprintf("Signing certificate is not trusted: %v", err))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// x509TestCertificate returns a new certificate for a new key, created from template and signed by parent using parentKey,
+// along with the new key and a PEM-encoded form of the certificate.
+// If parent is nil, the certificate is self-signed.
+func x509TestCertificate(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// x509TestCATemplate returns a template for a CA certificate with commonName.
+func x509TestCATemplate(commonName string) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+// x509TestLeafTemplate returns a template for a code signing certificate with commonName.
+func x509TestLeafTemplate(commonName string) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+}
+
+func TestParseX509CertificatesPEM(t *testing.T) {
+	cert1, _, cert1PEM := x509TestCertificate(t, x509TestCATemplate("CA 1"), nil, nil)
+	cert2, _, cert2PEM := x509TestCertificate(t, x509TestCATemplate("CA 2"), nil, nil)
+
+	certs, err := parseX509CertificatesPEM(cert1PEM)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{cert1}, certs)
+
+	certs, err = parseX509CertificatesPEM(append(append([]byte{}, cert1PEM...), cert2PEM...))
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{cert1, cert2}, certs)
+
+	for _, invalid := range [][]byte{
+		[]byte{},
+		[]byte("this is not PEM"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1}}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a certificate")}),
+		append(append([]byte{}, cert1PEM...), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1}})...),
+	} {
+		_, err := parseX509CertificatesPEM(invalid)
+		assert.Error(t, err, string(invalid))
+	}
+}
+
+func TestNewX509CertPool(t *testing.T) {
+	_, _, cert1PEM := x509TestCertificate(t, x509TestCATemplate("CA 1"), nil, nil)
+	_, _, cert2PEM := x509TestCertificate(t, x509TestCATemplate("CA 2"), nil, nil)
+
+	pool, err := newX509CertPool([][]byte{cert1PEM, cert2PEM})
+	require.NoError(t, err)
+	assert.Len(t, pool.Subjects(), 2)
+
+	_, err = newX509CertPool([][]byte{cert1PEM, []byte("this is invalid")})
+	assert.Error(t, err)
+}
+
+func TestVerifyX509CertificateChain(t *testing.T) {
+	caCert, caKey, caPEM := x509TestCertificate(t, x509TestCATemplate("CA"), nil, nil)
+	roots, err := newX509CertPool([][]byte{caPEM})
+	require.NoError(t, err)
+	intermediateCert, intermediateKey, intermediatePEM := x509TestCertificate(t, x509TestCATemplate("Intermediate"), caCert, caKey)
+	leafCert, _, leafPEM := x509TestCertificate(t, x509TestLeafTemplate("Leaf"), caCert, caKey)
+	chainedLeafCert, _, chainedLeafPEM := x509TestCertificate(t, x509TestLeafTemplate("Chained leaf"), intermediateCert, intermediateKey)
+
+	// Success, directly signed by the CA
+	cert, err := verifyX509CertificateChain(roots, leafPEM, nil, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, leafCert, cert)
+
+	// Success, using an intermediate certificate
+	cert, err = verifyX509CertificateChain(roots, chainedLeafPEM, intermediatePEM, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, chainedLeafCert, cert)
+
+	// Missing intermediate certificate
+	_, err = verifyX509CertificateChain(roots, chainedLeafPEM, nil, time.Now())
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+
+	// Invalid leaf certificate
+	_, err = verifyX509CertificateChain(roots, []byte("this is invalid"), nil, time.Now())
+	assert.IsType(t, InvalidSignatureError{}, err)
+
+	// More than one leaf certificate
+	_, err = verifyX509CertificateChain(roots, append(append([]byte{}, leafPEM...), leafPEM...), nil, time.Now())
+	assert.IsType(t, InvalidSignatureError{}, err)
+
+	// Invalid intermediate certificates
+	_, err = verifyX509CertificateChain(roots, chainedLeafPEM, []byte("this is invalid"), time.Now())
+	assert.IsType(t, InvalidSignatureError{}, err)
+
+	// Signed by an unknown CA
+	otherCACert, otherCAKey, _ := x509TestCertificate(t, x509TestCATemplate("Other CA"), nil, nil)
+	_, _, otherLeafPEM := x509TestCertificate(t, x509TestLeafTemplate("Other leaf"), otherCACert, otherCAKey)
+	_, err = verifyX509CertificateChain(roots, otherLeafPEM, nil, time.Now())
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+
+	// Expired certificate
+	_, err = verifyX509CertificateChain(roots, leafPEM, nil, time.Now().Add(2*time.Hour))
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+
+	// A certificate not valid for code signing
+	template := x509TestLeafTemplate("Server")
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	_, _, serverPEM := x509TestCertificate(t, template, caCert, caKey)
+	_, err = verifyX509CertificateChain(roots, serverPEM, nil, time.Now())
+	assertPolicyRequirementErrorReason(t, PolicyRejectionReasonUntrustedKey, err)
+}
@@ -758,6 +758,11 @@ func (s *storageImageDestination) IgnoresEmbeddedDockerReference() bool {
 	return true // Yes, we want the unmodified manifest
 }
 
+// HasThreadSafePutBlob indicates whether PutBlob, HasBlob and ReapplyBlob can be called concurrently.
+func (s *storageImageDestination) HasThreadSafePutBlob() bool {
+	return false // The blobs are tracked in maps which are not protected by a lock.
+}
+
 // PutSignatures records the image's signatures for committing as a single data blob.
 func (s *storageImageDestination) PutSignatures(ctx context.Context, signatures [][]byte) error {
 	sizes := []int{}
@@ -824,6 +829,11 @@ func (s *storageImageCloser) Size() (int64, error) {
 	return s.size, nil
 }
 
+// SizeWithContext() returns the previously-computed size of the image, with no error.
+func (s *storageImageCloser) SizeWithContext(ctx context.Context) (int64, error) {
+	return s.size, nil
+}
+
 // newImage creates an image that also knows its size
 func newImage(ctx context.Context, sys *types.SystemContext, s storageReference) (types.ImageCloser, error) {
 	src, err := newImageSource(s)
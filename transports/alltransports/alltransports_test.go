@@ -35,6 +35,7 @@ func TestImageNameHandling(t *testing.T) {
 		{"oci", "/etc:someimage:mytag", "/etc:someimage:mytag"},
 		{"oci-archive", "/etc:someimage", "/etc:someimage"},
 		{"oci-archive", "/etc:someimage:mytag", "/etc:someimage:mytag"},
+		{"sif", "/etc/image.sif", "/etc/image.sif"},
 		// "atomic" not tested here because it depends on per-user configuration for the default cluster.
 		// "containers-storage" not tested here because it needs to initialize various directories on the fs.
 	} {
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/containers/image/docker/reference"
+	compression "github.com/containers/image/pkg/compression/types"
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go/v1"
 )
@@ -98,6 +99,17 @@ type BlobInfo struct {
 	URLs        []string
 	Annotations map[string]string
 	MediaType   string
+	// CompressionOperation is used in Image.UpdateLayerInfos to instruct
+	// whether the original layer was compressed/decompressed during the copy.
+	// PreserveOriginal if the layer was not modified.
+	CompressionOperation LayerCompression
+	// CompressionAlgorithm is used in Image.UpdateLayerInfos to set the correct
+	// MIME type for compressed layers (e.g., gzip or zstd). Only valid if CompressionOperation == Compress.
+	CompressionAlgorithm *compression.Algorithm
+	// CryptoOperation is used in Image.UpdateLayerInfos to instruct whether the
+	// original layer was encrypted/decrypted during the copy.
+	// PreserveOriginalCrypto if the layer was not encrypted or decrypted.
+	CryptoOperation LayerCrypto
 }
 
 // ImageSource is a service, possibly remote (= slow), to download components of a single image or a named image set (manifest list).
@@ -132,6 +144,14 @@ type ImageSource interface {
 	LayerInfosForCopy(ctx context.Context) ([]BlobInfo, error)
 }
 
+// BlobSizeSource is an optional interface of ImageSource implementations which can determine the size of a blob
+// without reading it (e.g. using a HTTP HEAD request).
+type BlobSizeSource interface {
+	// BlobSize returns the size of the blob with info, or -1 if it can not be determined (e.g. if the blob does not exist).
+	// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+	BlobSize(ctx context.Context, info BlobInfo) (int64, error)
+}
+
 // LayerCompression indicates if layers must be compressed, decompressed or preserved
 type LayerCompression int
 
@@ -139,12 +159,27 @@ const (
 	// PreserveOriginal indicates the layer must be preserved, ie
 	// no compression or decompression.
 	PreserveOriginal LayerCompression = iota
-	// Decompress indicates the layer must be decompressed
+	// Decompress indicates the layer must be decompressed; Image.UpdatedImage
+	// then records the layer using the uncompressed MIME type.
 	Decompress
 	// Compress indicates the layer must be compressed
 	Compress
 )
 
+// LayerCrypto indicates if layers were encrypted, decrypted or preserved
+type LayerCrypto int
+
+const (
+	// PreserveOriginalCrypto indicates the layer was neither encrypted nor decrypted.
+	PreserveOriginalCrypto LayerCrypto = iota
+	// Encrypt indicates the layer was encrypted; Image.UpdatedImage then records
+	// the layer using the encrypted (OCI) MIME type, and the annotations in BlobInfo.Annotations.
+	Encrypt
+	// Decrypt indicates the layer was decrypted; Image.UpdatedImage then records
+	// the layer using the unencrypted MIME type, and the annotations in BlobInfo.Annotations.
+	Decrypt
+)
+
 // ImageDestination is a service, possibly remote (= slow), to store components of a single image.
 //
 // There is a specific required order for some of the calls:
@@ -178,6 +213,9 @@ type ImageDestination interface {
 	// and would prefer to receive an unmodified manifest instead of one modified for the destination.
 	// Does not make a difference if Reference().DockerReference() is nil.
 	IgnoresEmbeddedDockerReference() bool
+	// HasThreadSafePutBlob indicates whether PutBlob, HasBlob and ReapplyBlob can be called concurrently,
+	// e.g. to copy several layers in parallel.
+	HasThreadSafePutBlob() bool
 
 	// PutBlob writes contents of stream and returns data representing the result.
 	// inputInfo.Digest can be optionally provided if known; it is not mandatory for the implementation to verify it.
@@ -195,7 +233,7 @@ type ImageDestination interface {
 	// ReapplyBlob informs the image destination that a blob for which HasBlob previously returned true would have been passed to PutBlob if it had returned false.  Like HasBlob and unlike PutBlob, the digest can not be empty.  If the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree.
 	ReapplyBlob(ctx context.Context, info BlobInfo) (BlobInfo, error)
 	// PutManifest writes manifest to the destination.
-	// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+	// If the MIME type of manifest is known, callers should prefer ManifestMIMETypeDestination.PutManifestWithMIMEType, if implemented.
 	// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
 	// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
 	PutManifest(ctx context.Context, manifest []byte) error
@@ -207,6 +245,28 @@ type ImageDestination interface {
 	Commit(ctx context.Context) error
 }
 
+// ManifestMIMETypeDestination is an ImageDestination which can make use of the MIME type of the manifest, if known,
+// instead of guessing it from the manifest contents.
+type ManifestMIMETypeDestination interface {
+	ImageDestination
+	// PutManifestWithMIMEType is like PutManifest, but also receives the MIME type of manifest.
+	// mimeType may be "" if unknown; then it is equivalent to PutManifest.
+	PutManifestWithMIMEType(ctx context.Context, manifest []byte, mimeType string) error
+}
+
+// ManifestListDestination is an ImageDestination which can store a manifest list together with the images it references.
+// To store such an image, the caller stores the blobs, manifest and signatures of each referenced image using PutBlob,
+// PutInstanceManifest and PutInstanceSignatures, then the manifest list and its signatures using PutManifest
+// (or ManifestMIMETypeDestination.PutManifestWithMIMEType) and PutSignatures, and finally calls Commit.
+type ManifestListDestination interface {
+	ImageDestination
+	// PutInstanceManifest writes manifest, with MIME type mimeType (which may be "" if unknown), of an image referenced by a manifest list,
+	// to the destination. instanceDigest is the digest of manifest.
+	PutInstanceManifest(ctx context.Context, manifest []byte, mimeType string, instanceDigest digest.Digest) error
+	// PutInstanceSignatures writes signatures of an image referenced by a manifest list, with manifest digest instanceDigest, to the destination.
+	PutInstanceSignatures(ctx context.Context, signatures [][]byte, instanceDigest digest.Digest) error
+}
+
 // ManifestTypeRejectedError is returned by ImageDestination.PutManifest if the destination is in principle available,
 // refuses specifically this manifest type, but may accept a different manifest type.
 type ManifestTypeRejectedError struct { // We only use a struct to allow a type assertion, without limiting the contents of the error otherwise.
@@ -277,6 +337,9 @@ type Image interface {
 	// Size returns an approximation of the amount of disk space which is consumed by the image in its current
 	// location.  If the size is not known, -1 will be returned.
 	Size() (int64, error)
+	// SizeWithContext is like Size, but any I/O needed to determine the size (e.g. requests to a registry) uses ctx,
+	// so it can be cancelled.
+	SizeWithContext(ctx context.Context) (int64, error)
 }
 
 // ImageCloser is an Image with a Close() method which must be called by the user.
@@ -293,6 +356,16 @@ type ManifestUpdateOptions struct {
 	LayerInfos              []BlobInfo // Complete BlobInfos (size+digest+urls+annotations) which should replace the originals, in order (the root layer first, and then successive layered layers). BlobInfos' MediaType fields are ignored.
 	EmbeddedDockerReference reference.Named
 	ManifestMIMEType        string
+	// If not nil, a config blob which should replace the original one; the manifest is updated to refer to it.
+	// The blob does not have to exist in the underlying storage, ConfigBlob() of the updated image returns it.
+	// Not supported for Docker schema1 images, which have no separate config.
+	ConfigBlob []byte
+	// Annotations which should be set in the manifest, replacing existing values, and keys of annotations which should be
+	// removed from the manifest (before setting SetAnnotations). Only supported for OCI images, and not together with a ManifestMIMEType
+	// conversion; annotations of individual layers can be updated using LayerInfos.
+	// If only annotations are updated, and they already have the requested values, the original manifest (and its digest) is preserved.
+	SetAnnotations    map[string]string
+	RemoveAnnotations []string
 	// The values below are NOT requests to modify the image; they provide optional context which may or may not be used.
 	InformationOnly ManifestUpdateInformation
 }
@@ -316,12 +389,39 @@ type ImageInspectInfo struct {
 	Architecture  string
 	Os            string
 	Layers        []string
+	Env           []string
+	Entrypoint    []string
+	Cmd           []string
 }
 
 // DockerAuthConfig contains authorization information for connecting to a registry.
 type DockerAuthConfig struct {
 	Username string
 	Password string
+	// IdentityToken, if not "", is an OAuth2 refresh token used to obtain registry tokens instead of Username and Password.
+	IdentityToken string
+}
+
+// DockerProxyConfig is the HTTP proxy configuration used when contacting registries.
+// The values have the same format, and semantics, as the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+type DockerProxyConfig struct {
+	// Proxy URLs used for http and https requests, respectively; "" means no proxy.
+	HTTPProxy  string
+	HTTPSProxy string
+	// A comma-separated list of hosts, domains, IP addresses and CIDR ranges which are contacted without a proxy.
+	// Note that requests to localhost are never sent through a proxy.
+	NoProxy string
+}
+
+// DockerClientCertificate identifies TLS client certificates used when connecting to a registry.
+// Either CertPath and KeyPath, or CertDirPath, or both, may be set.
+type DockerClientCertificate struct {
+	// Paths to a PEM-encoded client certificate and its private key.
+	CertPath string
+	KeyPath  string
+	// If not "", a directory containing client certificates (ending with ".cert") and their keys (ending with ".key"),
+	// with the same structure as DockerCertPath.
+	CertDirPath string
 }
 
 // SystemContext allows parameterizing access to implicitly-accessed resources,
@@ -335,7 +435,7 @@ type SystemContext struct {
 	// Not used for any paths specified by users in config files (even if the location of the config file _was_ affected by it).
 	// NOTE: If this is set, environment-variable overrides of paths are ignored (to keep the semantics simple: to create an /etc replacement, just set RootForImplicitAbsolutePaths .
 	// and there is no need to worry about the environment.)
-	// NOTE: This does NOT affect paths starting by $HOME.
+	// NOTE: This does NOT affect paths starting by $HOME; however, if this is set, the per-host certificate directories in $HOME are not used.
 	RootForImplicitAbsolutePaths string
 
 	// === Global configuration overrides ===
@@ -347,6 +447,10 @@ type SystemContext struct {
 	SystemRegistriesConfPath string
 	// If not "", overrides the default path for the authentication file
 	AuthFilePath string
+	// If not "", overrides the user's default GPG home directory ($GNUPGHOME / ~/.gnupg) used for creating signatures,
+	// and for verifying them using signature.NewGPGSigningMechanismForSystemContext.
+	// "signedBy" policy requirements only use the keys specified in the policy, and are not affected.
+	GPGHomeDirectory string
 	// If not "", overrides the use of platform.GOARCH when choosing an image or verifying architecture match.
 	ArchitectureChoice string
 	// If not "", overrides the use of platform.GOOS when choosing an image or verifying OS match.
@@ -355,6 +459,17 @@ type SystemContext struct {
 	// Additional tags when creating or copying a docker-archive.
 	DockerArchiveAdditionalTags []reference.NamedTagged
 
+	// If not nil, the compression algorithm (e.g. compression.Gzip or compression.Zstd from pkg/compression) to use when compressing
+	// layers for destinations which require compressed layers;
+	// compressed layers in a different format are recompressed. If nil, layers are compressed using gzip, and compressed layers are not modified.
+	CompressionFormat *compression.Algorithm
+	// If not nil, the compression level to use with CompressionFormat (or gzip). The accepted values depend on the algorithm.
+	CompressionLevel *int
+	// If true, layers are decompressed and stored with uncompressed layer MIME types. This is only possible for destinations
+	// which do not require compressed layers, e.g. dir: without DirForceCompress, or oci: with OCIAcceptUncompressedLayers.
+	// Can not be combined with CompressionFormat.
+	DecompressLayers bool
+
 	// === OCI.Transport overrides ===
 	// If not "", a directory containing a CA certificate (ending with ".crt"),
 	// a client certificate (ending with ".cert") and a client ceritificate key
@@ -372,19 +487,65 @@ type SystemContext struct {
 	// a client certificate (ending with ".cert") and a client ceritificate key
 	// (ending with ".key") used when talking to a Docker Registry.
 	DockerCertPath string
-	// If not "", overrides the system’s default path for a directory containing host[:port] subdirectories with the same structure as DockerCertPath above.
+	// If not "", overrides the default paths (~/.config/containers/certs.d, /etc/containers/certs.d and /etc/docker/certs.d)
+	// for a directory containing host[:port] subdirectories with the same structure as DockerCertPath above.
 	// Ignored if DockerCertPath is non-empty.
 	DockerPerHostCertDirPath string
+	// If not nil, maps registry host[:port] values to TLS client certificates presented when talking to that registry
+	// (e.g. for registries which require mutual TLS), in addition to any client certificates found in DockerCertPath
+	// or the per-host certificate directory.
+	DockerClientCertificates map[string]DockerClientCertificate
 	// Allow contacting docker registries over HTTP, or HTTPS with failed TLS verification. Note that this does not affect other TLS connections.
 	DockerInsecureSkipTLSVerify bool
+	// If not nil, the proxy configuration used when contacting registries (and lookaside signature storage),
+	// instead of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	// A proxy configured for a registry in registries.conf takes precedence.
+	DockerProxy *DockerProxyConfig
 	// if nil, the library tries to parse ~/.docker/config.json to retrieve credentials
 	DockerAuthConfig *DockerAuthConfig
 	// if not "", an User-Agent header is added to each request when contacting a registry.
 	DockerRegistryUserAgent string
+	// Additional headers added to each request when contacting a registry, e.g. to identify the client or the tenant to a proxy.
+	// Headers set by the library for the request (e.g. Accept, Authorization or User-Agent above) take precedence.
+	DockerRegistryHeaders map[string][]string
 	// if true, a V1 ping attempt isn't done to give users a better error. Default is false.
 	// Note that this field is used mainly to integrate containers/image into projectatomic/docker
 	// in order to not break any existing docker's integration tests.
 	DockerDisableV1Ping bool
+	// If true, the embedded JWS signatures of signed Docker schema1 manifests are verified when pulling,
+	// and pulling an image with invalid embedded signatures fails.  Note that this does not check whether the signing keys are trusted;
+	// docker.Image.Schema1SigningKeys can be used to retrieve them.
+	DockerVerifySchema1Signatures bool
+	// If > 0, blobs are uploaded to registries in chunks of at most this many bytes, and an upload of a chunk
+	// interrupted by a transient failure is resumed from the last offset received by the registry.
+	// If 0, each blob is uploaded in a single request.
+	DockerRegistryUploadChunkSize int64
+	// If > 0, blobs of at most this many bytes (e.g. configs and small layers) are uploaded to registries using a single request,
+	// instead of creating an upload session first; the data is buffered in memory.
+	// If <= 0, all blobs are uploaded using an upload session.
+	DockerRegistrySingleRequestUploadThreshold int64
+	// If > 0, the maximum number of times a request to a registry which is safe to repeat (or an interrupted upload of a chunk)
+	// is retried, with exponential backoff, after a timeout, a refused or reset connection, or a 5xx response; if < 0, requests are not retried.
+	// If 0, a default value is used.
+	DockerRegistryMaxRetries int
+	// If > 0, the maximum total time to wait, as requested by Retry-After headers or using exponential backoff,
+	// before repeating a request rate-limited by a registry (429 Too Many Requests); if < 0, rate-limited requests fail immediately.
+	// If 0, a default value is used. When the time is exhausted, the request fails with docker.TooManyRequestsError.
+	DockerRegistryRateLimitBudget time.Duration
+	// If not nil, the number of bytes of each blob transferred by PutBlob and GetBlob so far is reported to this channel,
+	// at most once per DockerRegistryProgressInterval, and when the blob is completely transferred.
+	// The channel must be read, or transfers block.
+	DockerRegistryProgress chan ProgressProperties
+	// The minimum time between reports to DockerRegistryProgress for a single blob; if 0, every read is reported.
+	DockerRegistryProgressInterval time.Duration
+	// If not nil, called with the text of each warning sent by a registry in a "Warning: 299 - …" response header
+	// (e.g. a deprecation notice), at most once per warning for each image source or destination.
+	// It may be called concurrently from several goroutines. If nil, the warnings are logged.
+	DockerRegistryWarnings func(warning string)
+	// If not nil, maps a registry or a namespace within it (host[:port][/namespace…], fully qualified, e.g. "docker.io/library")
+	// to mirrors (in the same format), which are tried in order before the registry itself when pulling images from it.
+	// The longest matching prefix is used. If not nil, mirrors configured in SystemRegistriesConfPath are ignored.
+	DockerRegistryMirrors map[string][]string
 	// Directory to use for OSTree temporary files
 	OSTreeTmpDirPath string
 
@@ -403,9 +564,28 @@ type SystemContext struct {
 	DirForceCompress bool
 }
 
-// ProgressProperties is used to pass information from the copy code to a monitor which
+// ProgressEvent is the type of an event reported in ProgressProperties.
+// WARNING: New event types may be added at any time; consumers should ignore events they do not recognize.
+type ProgressEvent uint
+
+const (
+	// ProgressEventNewArtifact is reported when a transfer of an artifact starts.
+	ProgressEventNewArtifact ProgressEvent = iota
+	// ProgressEventRead is reported while an artifact is being transferred.
+	ProgressEventRead
+	// ProgressEventDone is reported when a transfer of an artifact has successfully finished.
+	ProgressEventDone
+	// ProgressEventSkipped is reported when an artifact is not transferred, e.g. because it already exists at the destination.
+	ProgressEventSkipped
+)
+
+// ProgressProperties is used to pass information from the copy code, or from transports, to a monitor which
 // can use the real-time information to produce output or react to changes.
 type ProgressProperties struct {
+	Event    ProgressEvent
 	Artifact BlobInfo
-	Offset   uint64
+	// The number of bytes of Artifact transferred so far. For ProgressEventSkipped, the size of the artifact, if known.
+	Offset uint64
+	// The number of bytes transferred since the previous event for the same artifact.
+	OffsetUpdate uint64
 }